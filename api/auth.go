@@ -1,10 +1,16 @@
 package api
 
 import (
+	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
 	"tekticket/db"
+	"tekticket/service/mfa"
+	"tekticket/service/otp"
+	"tekticket/service/session"
 	"tekticket/service/worker"
 	"tekticket/util"
 
@@ -20,6 +26,24 @@ type RegisterRequest struct {
 	Role      string `json:"role" binding:"required"`
 }
 
+// Helper method: check the password against the password policy. If invalid, return the field-level errors to client and false
+func (server *Server) validatePassword(ctx *gin.Context, field, password, email string) bool {
+	violations := util.NewPasswordPolicy(server.config.Setting).Validate(password, email)
+	if len(violations) == 0 {
+		return true
+	}
+
+	util.LOGGER.Warn(
+		fmt.Sprintf("%s %s: password does not satisfy password policy", ctx.Request.Method, ctx.FullPath()),
+		"violations", len(violations),
+	)
+	ctx.JSON(http.StatusBadRequest, ValidationErrorResponse{
+		Message: "Password does not meet the requirements",
+		Fields:  map[string][]string{field: violations},
+	})
+	return false
+}
+
 type RegisterResponse struct {
 	ID        string `json:"id"`
 	FirstName string `json:"first_name"`
@@ -37,7 +61,7 @@ type RegisterResponse struct {
 // @Produce      json
 // @Param        request body RegisterRequest true "User registration information"
 // @Success      200 {object} RegisterResponse "Account created successfully"
-// @Failure      400 {object} ErrorResponse "Invalid request body | Invalid role value | Email already registered | Invalid request data"
+// @Failure      400 {object} ValidationErrorResponse "Invalid request body | Password does not meet the requirements | Invalid role value | Email already registered | Invalid request data"
 // @Failure      429 {object} ErrorResponse "Rate limit exceeded"
 // @Failure      500 {object} ErrorResponse "Internal server error | Failed to send verification email"
 // @Router       /api/auth/register [post]
@@ -50,6 +74,11 @@ func (server *Server) Register(ctx *gin.Context) {
 		return
 	}
 
+	// Check password policy
+	if !server.validatePassword(ctx, "password", req.Password, req.Email) {
+		return
+	}
+
 	// Check roles
 	var roles []db.Role
 	url := fmt.Sprintf("%s/roles?fields=id,name,description&filter[name][_icontains]=%s", server.config.DirectusAddr, req.Role)
@@ -110,6 +139,13 @@ func (server *Server) Register(ctx *gin.Context) {
 		return
 	}
 
+	// Start the resend cooldown, so that the client can't ask for another OTP right after registering.
+	// The account is already created at this point, so failing here shouldn't fail the request
+	policy := otp.NewPolicy(otp.PURPOSE_VERIFY_ACCOUNT, server.config.Setting)
+	if err := server.otpManager.StartCooldown(ctx, policy, user.ID); err != nil {
+		util.LOGGER.Warn("POST /api/auth/register: failed to start OTP resend cooldown", "id", user.ID, "error", err)
+	}
+
 	// Create background task: send verify email
 	err = server.distributor.DistributeTask(ctx, worker.SendVerifyEmail, worker.SendVerifyEmailPayload{
 		ID:       user.ID,
@@ -145,41 +181,27 @@ func (server *Server) Register(ctx *gin.Context) {
 // @Param        id   path      string  true  "User ID"
 // @Param        otp  query     string  true  "6-digit OTP verification code"
 // @Success      200  {object}  SuccessMessage  "Verify account successfully, please login"
-// @Failure      400  {object}  ErrorResponse   "Invalid OTP code | OTP expired | ID mismatch with OTP"
-// @Failure      429  {object}  ErrorResponse   "Rate limit exceeded"
+// @Failure      400  {object}  ErrorResponse   "Invalid OTP code | OTP expired"
+// @Failure      429  {object}  ErrorResponse   "Too many failed attempts, please try again later | You hit the rate limit"
 // @Failure      500  {object}  ErrorResponse   "Internal server error"
 // @Router       /api/auth/verify/{id} [post]
 func (server *Server) VerifyAccount(ctx *gin.Context) {
 	// Get user ID and OTP code
 	id := ctx.Param("id")
-	otp := ctx.Query("otp")
+	code := ctx.Query("otp")
 
 	// OTP validation
-	if otp = strings.TrimSpace(otp); len(otp) != 6 {
-		util.LOGGER.Warn("POST /api/auth/verify/{id}: invalid otp format", "otp len", len(otp))
+	if code = strings.TrimSpace(code); len(code) != otp.CODE_LENGTH {
+		util.LOGGER.Warn("POST /api/auth/verify/{id}: invalid otp format", "otp len", len(code))
 		ctx.JSON(http.StatusBadRequest, ErrorResponse{"Invalid OTP code"})
 		return
 	}
 
-	// Get user ID from cache
-	idCached, err := server.queries.GetCache(ctx, otp)
-	if err != nil && !server.queries.IsCacheMiss(err) {
-		// If error, but not a cache miss -> server error
-		util.LOGGER.Error("POST /api/auth/verify: failed to get OTP code from cache", "error", err)
-		ctx.JSON(http.StatusInternalServerError, ErrorResponse{"Internal server error"})
-		return
-	}
-
-	if idCached == "" {
-		// If the returned ID is empty, it would either be an invalid OTP that isn't store in cache, or the OTP expired.
-		// But whatever reason, the result is same -> client need to get a new OTP, so we are just telling them that OTP expired
-		ctx.JSON(http.StatusBadRequest, ErrorResponse{"OTP expired"})
-		return
-	}
-
-	// Compare if the ID provided from client, and the cached ID is match
-	if idCached != id {
-		ctx.JSON(http.StatusBadRequest, ErrorResponse{"ID mismatch with OTP"})
+	// Verify the OTP issued for this user
+	policy := otp.NewPolicy(otp.PURPOSE_VERIFY_ACCOUNT, server.config.Setting)
+	if err := server.otpManager.Verify(ctx, policy, id, code); err != nil {
+		util.LOGGER.Warn("POST /api/auth/verify/{id}: OTP verification failed", "id", id, "error", err)
+		server.OTPError(ctx, err)
 		return
 	}
 
@@ -187,8 +209,11 @@ func (server *Server) VerifyAccount(ctx *gin.Context) {
 	url := fmt.Sprintf("%s/users/%s", server.config.DirectusAddr, id)
 	status, err := db.MakeRequest("PATCH", url, map[string]any{"status": "active"}, server.config.DirectusStaticToken, nil)
 	if err != nil {
-		// Internal operation -> always return 500
+		// Internal operation -> always return 500. The code was consumed, put it back so that the user can retry it
 		util.LOGGER.Error("POST /api/auth/verify: failed to update account status", "status", status, "error", err)
+		if err := server.otpManager.Restore(ctx, policy, id, code); err != nil {
+			util.LOGGER.Error("POST /api/auth/verify: failed to restore OTP", "id", id, "error", err)
+		}
 		ctx.JSON(http.StatusInternalServerError, ErrorResponse{"Internal server error"})
 		return
 	}
@@ -199,6 +224,7 @@ func (server *Server) VerifyAccount(ctx *gin.Context) {
 // ResendOTP godoc
 // @Summary      Resend account verification OTP
 // @Description  Resends a new OTP code to the user's registered email address if the account is still inactive.
+// @Description  A new code can only be requested once per cooldown period, and the previous code is invalidated.
 // @Tags         Auth
 // @Accept       json
 // @Produce      json
@@ -206,7 +232,7 @@ func (server *Server) VerifyAccount(ctx *gin.Context) {
 // @Success      200  {object}  SuccessMessage  "OTP resent successfully"
 // @Failure      400  {object}  ErrorResponse   "Account status not unverified"
 // @Failure      404  {object}  ErrorResponse   "No item with such ID"
-// @Failure      429  {object}  ErrorResponse   "Rate limit exceeded"
+// @Failure      429  {object}  ErrorResponse   "Rate limit exceeded | OTP was requested recently, please wait | Too many failed attempts, please try again later"
 // @Failure      500  {object}  ErrorResponse   "Internal server error"
 // @Router       /api/auth/resend-otp/{id} [post]
 func (server *Server) ResendOTP(ctx *gin.Context) {
@@ -235,6 +261,14 @@ func (server *Server) ResendOTP(ctx *gin.Context) {
 		return
 	}
 
+	// Check the resend cooldown before issuing a new OTP
+	policy := otp.NewPolicy(otp.PURPOSE_VERIFY_ACCOUNT, server.config.Setting)
+	if err := server.otpManager.StartCooldown(ctx, policy, user.ID); err != nil {
+		util.LOGGER.Warn("POST /api/auth/resend-otp/{id}: cannot resend OTP yet", "id", id, "error", err)
+		server.OTPError(ctx, err)
+		return
+	}
+
 	// Create background job, send OTP
 	err = server.distributor.DistributeTask(ctx, worker.SendVerifyEmail, worker.SendVerifyEmailPayload{
 		ID:       user.ID,
@@ -251,6 +285,30 @@ func (server *Server) ResendOTP(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, SuccessMessage{"OTP resend successfully"})
 }
 
+// Helper method: handling OTP error
+func (server *Server) OTPError(ctx *gin.Context, err error) {
+	// If the client has to wait, tell them how long
+	var waitErr *otp.WaitError
+	if errors.As(err, &waitErr) {
+		ctx.Header("Retry-After", strconv.Itoa(int(math.Ceil(waitErr.RetryAfter.Seconds()))))
+	}
+
+	switch {
+	case errors.Is(err, otp.ErrExpired):
+		// Whether the OTP never existed or expired, the client need to get a new OTP, so we just tell them that OTP expired
+		ctx.JSON(http.StatusBadRequest, ErrorResponse{"OTP expired"})
+	case errors.Is(err, otp.ErrInvalid):
+		ctx.JSON(http.StatusBadRequest, ErrorResponse{"Invalid OTP code"})
+	case errors.Is(err, otp.ErrLocked):
+		ctx.JSON(http.StatusTooManyRequests, ErrorResponse{"Too many failed attempts, please try again later"})
+	case errors.Is(err, otp.ErrCooldown):
+		ctx.JSON(http.StatusTooManyRequests, ErrorResponse{"OTP was requested recently, please wait"})
+	default:
+		// Cache error -> server side error
+		ctx.JSON(http.StatusInternalServerError, ErrorResponse{"Internal server error"})
+	}
+}
+
 type LoginRequest struct {
 	Email    string `json:"email" binding:"required,email"`
 	Password string `json:"password" binding:"required"`
@@ -266,11 +324,14 @@ type LoginResponse struct {
 // Login godoc
 // @Summary      User login
 // @Description  Authenticates a user with Directus and returns an access token and refresh token.
+// @Description  If the user has two-factor authentication enabled, returns an MFA challenge instead, to complete with
+// @Description  /api/auth/login/mfa
 // @Tags         Auth
 // @Accept       json
 // @Produce      json
 // @Param        request body LoginRequest true "User login credentials"
 // @Success      200 {object} LoginResponse "Login successful"
+// @Success      202 {object} MFAChallengeResponse "Second factor required"
 // @Failure      400 {object} ErrorResponse "Invalid request body"
 // @Failure      401 {object} ErrorResponse "Incorrect login credentials"
 // @Failure      429 {object} ErrorResponse "Rate limit exceeded"
@@ -301,12 +362,49 @@ func (server *Server) Login(ctx *gin.Context) {
 
 	// Get user ID from access token.
 	// Note that JWT payload should use base64.RawURLEncoding instead of base64.URLEncoding
-	// Even if this failed for some reasons, the consumer (client) can still get the user ID from the JWT access token, so we won't
-	// return error here.
-	if id, err := util.ExtractIDFromToken(result.AccessToken); err == nil {
-		result.ID = id
-	} else {
+	// The ID is needed to check the second factor, so we can't let the user in without it
+	id, err := util.ExtractIDFromToken(result.AccessToken)
+	if err != nil {
 		util.LOGGER.Error("POST /api/auth/login: failed to decode JWT payload", "error", err)
+		ctx.JSON(http.StatusInternalServerError, ErrorResponse{"Internal server error"})
+		return
+	}
+	result.ID = id
+
+	// If two-factor authentication is enabled, hold the tokens back until the second factor is verified
+	// If the MFA record can't be read, the login fails rather than skipping the second factor
+	record, status, err := server.getUserMFA(result.ID)
+	if err != nil {
+		util.LOGGER.Error("POST /api/auth/login: failed to get MFA record", "status", status, "error", err)
+		server.DirectusError(ctx, err)
+		return
+	}
+
+	if record != nil && record.Status == MFA_STATUS_ENABLED {
+		challenge, err := server.mfaManager.CreateChallenge(ctx, mfa.Challenge{
+			UserID:       result.ID,
+			AccessToken:  result.AccessToken,
+			RefreshToken: result.RefreshToken,
+			Expires:      result.Expires,
+		})
+		if err != nil {
+			util.LOGGER.Error("POST /api/auth/login: failed to create MFA challenge", "error", err)
+			ctx.JSON(http.StatusInternalServerError, ErrorResponse{"Internal server error"})
+			return
+		}
+
+		ctx.JSON(http.StatusAccepted, MFAChallengeResponse{
+			MFARequired: true,
+			Challenge:   challenge,
+			ExpiresIn:   int(mfa.CHALLENGE_TTL.Seconds()),
+		})
+		return
+	}
+
+	// Start the session with the device, so that it can be listed and revoked later. Failing to do so only means the
+	// session can't be revoked by us, so we don't fail the login here
+	if _, err := server.sessions.Start(ctx, result.ID, result.AccessToken, result.RefreshToken, requestDevice(ctx)); err != nil {
+		util.LOGGER.Error("POST /api/auth/login: failed to track session", "id", result.ID, "error", err)
 	}
 
 	ctx.JSON(http.StatusOK, result)
@@ -338,6 +436,16 @@ func (server *Server) Logout(ctx *gin.Context) {
 		return
 	}
 
+	// Sessions of social login are issued by us, not Directus
+	if ok, err := server.sessions.Logout(ctx, req.RefreshToken); err != nil {
+		util.LOGGER.Error("POST /api/auth/logout: failed to logout issued session", "error", err)
+		ctx.JSON(http.StatusInternalServerError, ErrorResponse{"Internal server error"})
+		return
+	} else if ok {
+		ctx.JSON(http.StatusOK, SuccessMessage{"Logout success"})
+		return
+	}
+
 	// Make request to Directus
 	url := fmt.Sprintf("%s/auth/logout", server.config.DirectusAddr)
 	status, err := db.MakeRequest(
@@ -353,6 +461,13 @@ func (server *Server) Logout(ctx *gin.Context) {
 		return
 	}
 
+	// End this session if we know who the user is
+	if id, err := util.ExtractIDFromToken(server.GetToken(ctx)); err == nil {
+		if err := server.sessions.End(ctx, id, req.RefreshToken); err != nil {
+			util.LOGGER.Warn("POST /api/auth/logout: failed to end session", "id", id, "error", err)
+		}
+	}
+
 	ctx.JSON(http.StatusOK, SuccessMessage{"Logout success"})
 }
 
@@ -368,6 +483,7 @@ func (server *Server) Logout(ctx *gin.Context) {
 // @Failure      403 {object} ErrorResponse "Invalid token"
 // @Failure      429 {object} ErrorResponse "Rate limit exceeded"
 // @Failure      500 {object} ErrorResponse "Internal server error"
+// @Failure      503 {object} ErrorResponse "Session is being renewed, please retry"
 // @Router       /api/auth/refresh [post]
 func (server *Server) RefreshToken(ctx *gin.Context) {
 	// Get request body
@@ -378,6 +494,28 @@ func (server *Server) RefreshToken(ctx *gin.Context) {
 		return
 	}
 
+	// Sessions of social login are issued by us, not Directus
+	tokens, err := server.sessions.Refresh(ctx, req.RefreshToken, requestDevice(ctx))
+	if err == nil {
+		server.scheduleAccessTokenExpiry(ctx, tokens)
+		ctx.JSON(http.StatusOK, LoginResponse{
+			ID:           tokens.UserID,
+			AccessToken:  tokens.AccessToken,
+			RefreshToken: tokens.RefreshToken,
+			Expires:      tokens.Expires,
+		})
+		return
+	}
+	if errors.Is(err, session.ErrAccessTokenBusy) {
+		accessTokenBusy(ctx)
+		return
+	}
+	if !errors.Is(err, session.ErrUnknownRefreshToken) {
+		util.LOGGER.Error("POST /api/auth/refresh: failed to refresh issued session", "error", err)
+		ctx.JSON(http.StatusInternalServerError, ErrorResponse{"Internal server error"})
+		return
+	}
+
 	// Make request to Directus
 	url := fmt.Sprintf("%s/auth/refresh", server.config.DirectusAddr)
 	var result LoginResponse
@@ -389,6 +527,17 @@ func (server *Server) RefreshToken(ctx *gin.Context) {
 		return
 	}
 
+	// Directus rotate the refresh token, so move the session to the new tokens
+	if id, err := util.ExtractIDFromToken(result.AccessToken); err == nil {
+		result.ID = id
+		err := server.sessions.Rotate(ctx, id, req.RefreshToken, result.AccessToken, result.RefreshToken, requestDevice(ctx))
+		if err != nil {
+			util.LOGGER.Error("POST /api/auth/refresh: failed to rotate session", "id", id, "error", err)
+		}
+	} else {
+		util.LOGGER.Error("POST /api/auth/refresh: failed to decode JWT payload", "error", err)
+	}
+
 	ctx.JSON(http.StatusOK, result)
 }
 
@@ -462,19 +611,21 @@ func (server *Server) SendResetPasswordRequest(ctx *gin.Context) {
 }
 
 type ResetPasswordRequest struct {
-	Token       string `json:"token"`
-	NewPassword string `json:"new_password"`
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
 }
 
 // ResetPassword godoc
 // @Summary      Reset user password
-// @Description  Resets the user's password using a valid reset token. The token must be verified before updating the password.
+// @Description  Resets the user's password using a valid reset token. A token can only be used once, and is revoked when a
+// @Description  newer one is requested or the password changes. All existing sessions of the user are logged out.
 // @Tags         Auth
 // @Accept       json
 // @Produce      json
 // @Param        request body ResetPasswordRequest true "Token and new password"
 // @Success      200 {object} SuccessMessage "Password change successfully"
-// @Failure      400 {object} ErrorResponse "Invalid request body | Invalid request data"
+// @Failure      400 {object} ValidationErrorResponse "Invalid request body | Password does not meet the requirements | Invalid request data | Invalid token"
+// @Failure      410 {object} ErrorResponse "Token expired or already used"
 // @Failure      429 {object} ErrorResponse "Rate limit exceeded"
 // @Failure      500 {object} ErrorResponse "Internal server error"
 // @Router       /api/auth/password/reset [post]
@@ -483,20 +634,33 @@ func (server *Server) ResetPassword(ctx *gin.Context) {
 	var req ResetPasswordRequest
 	if err := ctx.ShouldBindJSON(&req); err != nil {
 		util.LOGGER.Warn("POST /api/auth/password/reset: failed to bind request body", "error", err)
-		ctx.JSON(http.StatusInternalServerError, ErrorResponse{"Internal server error"})
+		ctx.JSON(http.StatusBadRequest, ErrorResponse{"Invalid request body"})
 		return
 	}
 
-	// Verify token
-	payload, err := worker.VerifyResetPasswordToken(req.Token, server.config.SecretKey)
+	// Check the token first, so that a password rejected by the policy doesn't burn the token
+	segments, err := worker.VerifyResetPasswordToken(req.Token, server.config.SecretKey)
 	if err != nil {
-		util.LOGGER.Error("POST /api/auth/password/reset: failed to verify token", "error", err)
-		ctx.JSON(http.StatusInternalServerError, ErrorResponse{"Internal server error"})
+		util.LOGGER.Warn("POST /api/auth/password/reset: failed to verify token", "error", err)
+		server.resetTokenError(ctx, err)
+		return
+	}
+
+	// Check password policy. The token segments are: user ID, email, token ID and timestamp
+	if !server.validatePassword(ctx, "new_password", req.NewPassword, segments[1]) {
+		return
+	}
+
+	// Consume token, so that it can't be used again
+	userID, err := worker.ConsumeResetPasswordToken(ctx, server.queries.Cache, req.Token, server.config.SecretKey)
+	if err != nil {
+		util.LOGGER.Warn("POST /api/auth/password/reset: failed to consume token", "error", err)
+		server.resetTokenError(ctx, err)
 		return
 	}
 
 	// Update password
-	url := fmt.Sprintf("%s/users/%s", server.config.DirectusAddr, payload[0])
+	url := fmt.Sprintf("%s/users/%s", server.config.DirectusAddr, userID)
 	status, err := db.MakeRequest("PATCH", url, map[string]any{"password": req.NewPassword}, server.config.DirectusStaticToken, nil)
 	if err != nil {
 		util.LOGGER.Error("POST /api/auth/password/reset: failed to reset password", "status", status, "error", err)
@@ -504,5 +668,34 @@ func (server *Server) ResetPassword(ctx *gin.Context) {
 		return
 	}
 
+	// Revoke everything that was issued with the old password
+	server.revokeCredentials(ctx, userID)
+
 	ctx.JSON(http.StatusOK, SuccessMessage{"Password change successfully"})
 }
+
+// Helper method: handling reset password token error
+func (server *Server) resetTokenError(ctx *gin.Context, err error) {
+	switch {
+	case errors.Is(err, worker.ErrInvalidResetToken):
+		ctx.JSON(http.StatusBadRequest, ErrorResponse{"Invalid token"})
+	case errors.Is(err, worker.ErrResetTokenExpired):
+		ctx.JSON(http.StatusGone, ErrorResponse{"Token expired or already used"})
+	default:
+		ctx.JSON(http.StatusInternalServerError, ErrorResponse{"Internal server error"})
+	}
+}
+
+// Helper method: revoke the reset password token and all sessions of a user after their password changed.
+// The password has already been changed at this point, so errors are only logged
+func (server *Server) revokeCredentials(ctx *gin.Context, userID string) {
+	caller := fmt.Sprintf("%s %s", ctx.Request.Method, ctx.FullPath())
+
+	if err := worker.RevokeResetPasswordToken(ctx, server.queries.Cache, userID); err != nil {
+		util.LOGGER.Error(caller+": failed to revoke reset password token", "id", userID, "error", err)
+	}
+
+	if err := server.sessions.RevokeAll(ctx, userID); err != nil {
+		util.LOGGER.Error(caller+": failed to revoke sessions", "id", userID, "error", err)
+	}
+}
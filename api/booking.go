@@ -1,15 +1,20 @@
 package api
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
-	"strconv"
 	"strings"
 	"tekticket/db"
+	"tekticket/service/promo"
+	"tekticket/service/worker"
 	"tekticket/util"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/hibiken/asynq"
 )
 
 // ListBookingHistory godoc
@@ -18,10 +23,11 @@ import (
 // @Tags         Bookings
 // @Accept       json
 // @Produce      json
-// @Param        limit          query     int     false  "Maximum number of records to return (default: 50)"
-// @Param        offset         query     int     false  "Number of records to skip before returning results (default: 0)"
-// @Param        sort           query     string  false  "Sort order, e.g. -date_created (default)"
-// @Success      200  {array}   []db.Booking      "List of completed bookings retrieved successfully"
+// @Param        limit          query     int     false  "Maximum number of records to return (default: 50, max: 100)"
+// @Param        cursor         query     string  false  "Cursor of the next page, from the previous page"
+// @Param        sort           query     string  false  "Sort order: -date_created (default) or date_created"
+// @Success      200  {object}  Page[db.Booking]         "List of completed bookings retrieved successfully"
+// @Failure      400  {object}  ValidationErrorResponse  "Invalid pagination parameters"
 // @Failure      401  {object}  ErrorResponse     "Unauthorized access | Token expired"
 // @Failure      403  {object}  ErrorResponse     "Invalid token"
 // @Failure      429  {object}  ErrorResponse     "You hit the rate limit"
@@ -55,46 +61,29 @@ func (server *Server) ListBookingHistory(ctx *gin.Context) {
 	queryParams.Add("filter[status][_icontains]", "complete")
 	queryParams.Add("[deep][payments][_filter][status][_eq]", "success")
 
-	// Pagination
-	limit := 50
-	if val, err := strconv.Atoi(ctx.Query("limit")); err == nil && val > 0 {
-		limit = val
-	}
-	queryParams.Add("limit", strconv.Itoa(limit))
-
-	offset := 0
-	if val, err := strconv.Atoi(ctx.Query("offset")); err == nil && val >= 0 {
-		offset = val
-	}
-	queryParams.Add("offset", strconv.Itoa(offset))
-
-	// Sort
-	sort := ctx.Query("sort")
-	if sort == "" {
-		sort = "-date_created" // Default: newest first
+	// Pagination, default: newest first
+	pagination, ok := server.parsePagination(ctx, "-date_created", "-date_created", "date_created")
+	if !ok {
+		return
 	}
-	queryParams.Add("sort", sort)
-
-	// Build the URL
-	url := fmt.Sprintf("%s/items/bookings?%s", server.config.DirectusAddr, queryParams.Encode())
 
 	// Make request to Directus
-	var results []db.Booking
-	status, err := db.MakeRequest("GET", url, nil, token, &results)
+	url := fmt.Sprintf("%s/items/bookings", server.config.DirectusAddr)
+	page, status, err := listPage[db.Booking](url, queryParams, pagination, token)
 	if err != nil {
-		util.LOGGER.Error("GET /api/bookings/{id}: failed to get booking history", "status", status, "error", err)
+		util.LOGGER.Error("GET /api/bookings: failed to get booking history", "status", status, "error", err)
 		server.DirectusError(ctx, err)
 		return
 	}
 
 	// Remap preview_image of event
-	for _, result := range results {
-		if result.Event.PreviewImage != "" {
+	for _, result := range page.Data {
+		if result.Event != nil && result.Event.PreviewImage != "" {
 			result.Event.PreviewImage = util.CreateImageLink(server.config.ServerDomain, result.Event.PreviewImage)
 		}
 	}
 
-	ctx.JSON(http.StatusOK, results)
+	ctx.JSON(http.StatusOK, page)
 }
 
 // GetBooking godoc
@@ -122,7 +111,7 @@ func (server *Server) GetBooking(ctx *gin.Context) {
 	// Build the query parameter
 	queryParams := url.Values{}
 	fields := []string{
-		"id", "status", "date_created",
+		"id", "status", "date_created", "confirmation_steps",
 		"event_id.id", "event_id.name", "event_id.address", "event_id.city", "event_id.country", "event_id.preview_image",
 		"event_id.event_schedules.id", "event_id.event_schedules.start_time", "event_id.event_schedules.end_time",
 		"event_id.event_schedules.start_checkin_time", "event_id.event_schedules.end_checkin_time",
@@ -158,6 +147,68 @@ func (server *Server) GetBooking(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, result)
 }
 
+// DownloadBookingTickets godoc
+// @Summary      Download the tickets of a booking
+// @Description  Downloads the ticket document of a booking: a PDF with one page per ticket, including its QR code. The
+// @Description  document is generated once the tickets are issued
+// @Tags         Bookings
+// @Produce      application/pdf
+// @Produce      json
+// @Param        id   path      string  true  "Booking ID"
+// @Success      200  {file}    file           "Ticket document"
+// @Failure      401  {object}  ErrorResponse  "Unauthorized access | Token expired"
+// @Failure      403  {object}  ErrorResponse  "Invalid token"
+// @Failure      404  {object}  ErrorResponse  "No item with such ID | Tickets are not issued yet"
+// @Failure      429  {object}  ErrorResponse  "You hit the rate limit"
+// @Failure      500  {object}  ErrorResponse  "Internal server error"
+// @Security     BearerAuth
+// @Router       /api/bookings/{id}/tickets.pdf [get]
+func (server *Server) DownloadBookingTickets(ctx *gin.Context) {
+	id := ctx.Param("id")
+
+	// The booking is read with the user's token, so that only the customer can download it
+	url := fmt.Sprintf("%s/items/bookings/%s?fields=id,tickets_pdf", server.config.DirectusAddr, id)
+	var booking db.Booking
+	status, err := db.MakeRequest("GET", url, nil, server.GetToken(ctx), &booking)
+	if err != nil {
+		util.LOGGER.Error("GET /api/bookings/:id/tickets.pdf: failed to get booking", "status", status, "error", err, "id", id)
+		server.DirectusError(ctx, err)
+		return
+	}
+	if booking.TicketsPDF == "" {
+		ctx.JSON(http.StatusNotFound, ErrorResponse{"Tickets are not issued yet"})
+		return
+	}
+
+	// Stream the file from Directus, like GetImage
+	url = fmt.Sprintf("%s/assets/%s", server.config.DirectusAddr, booking.TicketsPDF)
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		util.LOGGER.Error("GET /api/bookings/:id/tickets.pdf: failed to create request", "error", err)
+		ctx.JSON(http.StatusInternalServerError, ErrorResponse{"Internal server error"})
+		return
+	}
+	req.Header.Set("Authorization", "Bearer "+server.config.DirectusStaticToken)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		util.LOGGER.Error("GET /api/bookings/:id/tickets.pdf: failed to get assets", "error", err)
+		ctx.JSON(http.StatusInternalServerError, ErrorResponse{"Internal server error"})
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		util.LOGGER.Error("GET /api/bookings/:id/tickets.pdf: ticket document not found", "id", booking.TicketsPDF, "status", resp.StatusCode)
+		ctx.JSON(http.StatusInternalServerError, ErrorResponse{"Internal server error"})
+		return
+	}
+
+	ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", worker.TicketPDFFilename(booking.ID)))
+	ctx.Header("Cache-Control", "no-store")
+	ctx.DataFromReader(http.StatusOK, resp.ContentLength, worker.PDF_CONTENT_TYPE, resp.Body, nil)
+}
+
 type BookingItemCreate struct {
 	TicketID        string `json:"ticket_id" binding:"required"`
 	EventScheduleID string `json:"event_schedule_id" binding:"required"`
@@ -165,8 +216,9 @@ type BookingItemCreate struct {
 }
 
 type CreateBookingRequest struct {
-	EventID string              `json:"event_id" binding:"required"`
-	Items   []BookingItemCreate `json:"items" binding:"required,min=1,dive"`
+	EventID   string              `json:"event_id" binding:"required"`
+	Items     []BookingItemCreate `json:"items" binding:"required,min=1,dive"`
+	PromoCode string              `json:"promo_code"` // Optional promo code
 }
 
 type CreateBookingResponse struct {
@@ -177,19 +229,29 @@ type CreateBookingResponse struct {
 	Tickets        []db.BookingItem `json:"tickets"`
 	TotalPricePaid int              `json:"total_price_paid"`
 	FeeCharged     int              `json:"fee_charged"`
+	MemberDiscount int              `json:"member_discount"` // Discount of the membership
+	PromoDiscount  int              `json:"promo_discount"`  // Discount of the promo code, 0 if it is not used
+	PromoCode      string           `json:"promo_code,omitempty"`
 }
 
 // CreateBooking godoc
 // @Summary      Create a new booking
 // @Description  Creates a new booking for an event, including its associated ticket and seat items.
+// @Description  The tickets are priced with the membership discount of the customer and, if any, the promo code. A code that
+// @Description  doesn't stack with the membership discount is only used if it is the better discount. A used code is held by
+// @Description  the booking until it is paid, and counts toward its usage limits for good once paid. The tickets reserved for
+// @Description  the waitlist are only sold to the customers they are offered to. A booking not paid by the end of its
+// @Description  reservation expires: its tickets are released and offered to the waitlists
 // @Tags         Bookings
 // @Accept       json
 // @Produce      json
 // @Param        request body    CreateBookingRequest   true   "Booking creation payload"
 // @Success      200  {object}   CreateBookingResponse         "Booking created successfully"
-// @Failure      400  {object}   ErrorResponse                 "Invalid request body | Invalid request data"
+// @Failure      400  {object}   ErrorResponse                 "Invalid request body | Invalid request data | Promo code is not active | Promo code is not valid yet | Promo code has expired | Promo code does not apply to these tickets"
 // @Failure      401  {object}   ErrorResponse                 "Unauthorized access | Token expired"
 // @Failure      403  {object}   ErrorResponse                 "Invalid token"
+// @Failure      404  {object}   ErrorResponse                 "No promo code with such code"
+// @Failure      409  {object}   ErrorResponse                 "Promo code has reached its usage limit | You have reached the usage limit of this promo code | Tickets are reserved for the customers on the waitlist | Event is canceled | Ticket prices changed, please book again"
 // @Failure      429  {object}   ErrorResponse                 "You hit the rate limit"
 // @Failure      500  {object}   ErrorResponse                 "Internal server error"
 // @Security     BearerAuth
@@ -214,12 +276,60 @@ func (server *Server) CreateBooking(ctx *gin.Context) {
 		return
 	}
 
-	// Create booking with all items
+	// The booking ID is generated here, so that the holds of the booking can be released if it fails to be created
+	bookingID := uuid.New().String()
+
+	// The tickets reserved for the waitlist are only sold to the customers they are offered to
+	holds, ok := server.holdWaitlistTickets(ctx, userID, req.EventID, bookingID, req.Items)
+	if !ok {
+		return
+	}
+	created := false
+	defer func() { server.releaseWaitlistHolds(ctx, holds, !created) }()
+
+	// Price the tickets with the membership discount and the promo code, if any. A code that is used is held by the booking
+	// until it is paid
+	ticketIDs := make([]string, 0, len(req.Items))
+	for _, item := range req.Items {
+		ticketIDs = append(ticketIDs, item.TicketID)
+	}
+	checkout, ok := server.getCheckout(ctx, req.EventID, ticketIDs)
+	if !ok {
+		return
+	}
+	var code *db.PromoCode
+	if req.PromoCode != "" {
+		code, ok = server.checkPromoCode(ctx, req.PromoCode, userID, checkout)
+		if !ok {
+			return
+		}
+	}
+	quote := promo.Apply(code, checkout)
+
 	payload := map[string]any{
+		"id":          bookingID,
 		"customer_id": userID,
 		"event_id":    req.EventID,
 		"status":      "pending",
+		"discount":    quote.MemberDiscount + quote.PromoDiscount,
+	}
+	if quote.Applied {
+		now := time.Now()
+		expiresAt := now.Add(util.NewPromoPolicy(server.config.Setting).Hold)
+		err := server.promoCounter.Hold(ctx, code.ID, code.UsageLimit, code.PerUserLimit, bookingID, userID, now, expiresAt)
+		if errors.Is(err, promo.ErrUsageLimit) || errors.Is(err, promo.ErrUserUsageLimit) {
+			ctx.JSON(http.StatusConflict, ErrorResponse{promoErrorMessage(err)})
+			return
+		}
+		if err != nil {
+			util.LOGGER.Error("POST /api/bookings: failed to hold promo code", "code", code.ID, "error", err)
+			ctx.JSON(http.StatusInternalServerError, ErrorResponse{"Internal server error"})
+			return
+		}
+		payload["promo_code_id"] = code.ID
 	}
+
+	// Create booking with all items
 	items := make([]map[string]any, 0)
 	for _, item := range req.Items {
 		items = append(items, map[string]any{
@@ -244,10 +354,57 @@ func (server *Server) CreateBooking(ctx *gin.Context) {
 	status, err := db.MakeRequest("POST", url, payload, token, &result)
 	if err != nil {
 		util.LOGGER.Error("POST /api/bookings: failed to create booking", "status", status, "error", err)
+		if quote.Applied {
+			if _, err := server.promoCounter.Release(ctx, code.ID, bookingID); err != nil {
+				util.LOGGER.Error("POST /api/bookings: failed to release promo code hold", "code", code.ID, "error", err)
+			}
+		}
 		server.DirectusError(ctx, err)
 		return
 	}
 
+	// The booking is charged by the prices of its items, set by Directus, so they must be the prices it was quoted with.
+	// Otherwise the booking is expired right away, rather than charged a price its discounts were not computed on
+	subtotal := 0
+	for _, item := range result.BookingItems {
+		subtotal += item.Price
+	}
+	if subtotal != quote.Subtotal {
+		util.LOGGER.Error("POST /api/bookings: booking items don't match the quote", "id", result.ID, "items", subtotal, "quote", quote.Subtotal)
+		if quote.Applied {
+			if _, err := server.promoCounter.Release(ctx, code.ID, bookingID); err != nil {
+				util.LOGGER.Error("POST /api/bookings: failed to release promo code hold", "code", code.ID, "error", err)
+			}
+		}
+		err := server.distributor.DistributeTask(
+			ctx,
+			worker.ExpireBooking,
+			worker.ExpireBookingPayload{BookingID: result.ID},
+			asynq.Queue(worker.HIGH_IMPACT),
+			asynq.MaxRetry(5),
+		)
+		if err != nil {
+			util.LOGGER.Error("POST /api/bookings: failed to expire booking", "task", worker.ExpireBooking, "booking_id", result.ID, "error", err)
+		}
+		ctx.JSON(http.StatusConflict, ErrorResponse{"Ticket prices changed, please book again"})
+		return
+	}
+
+	created = true
+
+	// Expire the booking if it is not paid by the end of its reservation
+	err = server.distributor.DistributeTask(
+		ctx,
+		worker.ExpireBooking,
+		worker.ExpireBookingPayload{BookingID: result.ID},
+		asynq.Queue(worker.HIGH_IMPACT),
+		asynq.MaxRetry(5),
+		asynq.ProcessIn(util.NewBookingPolicy(server.config.Setting).Reservation),
+	)
+	if err != nil {
+		util.LOGGER.Error("POST /api/bookings: failed to schedule booking expiry", "task", worker.ExpireBooking, "booking_id", result.ID, "error", err)
+	}
+
 	// Remap event's preview image
 	if result.Event.PreviewImage != "" {
 		result.Event.PreviewImage = util.CreateImageLink(server.config.ServerDomain, result.Event.PreviewImage)
@@ -261,14 +418,16 @@ func (server *Server) CreateBooking(ctx *gin.Context) {
 		Tickets:  result.BookingItems,
 	}
 
-	// Calculate total price paid: sum of all booking_item.price
-	for _, item := range result.BookingItems {
-		booking.TotalPricePaid += item.Price
+	// Calculate total price paid: sum of all booking_item.price, minus the discounts of the membership and the promo code
+	booking.MemberDiscount, booking.PromoDiscount = quote.MemberDiscount, quote.PromoDiscount
+	booking.TotalPricePaid = max(subtotal-quote.MemberDiscount-quote.PromoDiscount, 0)
+	if quote.Applied {
+		booking.PromoCode = code.Code
 	}
 	util.LOGGER.Info("POST /api/bookings: total amount before charged", "id", booking.ID, "amount", booking.TotalPricePaid)
 
 	// Applying additional charged
-	booking.FeeCharged = int(float64(server.config.PaymentFeePercent) * float64(booking.TotalPricePaid) / 100)
+	booking.FeeCharged = util.PaymentFee(booking.TotalPricePaid, server.config.PaymentFeePercent)
 	booking.TotalPricePaid += booking.FeeCharged
 	util.LOGGER.Info("POST /api/bookings: total amount after charging fee", "id", booking.ID, "amount", booking.TotalPricePaid)
 
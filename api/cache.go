@@ -0,0 +1,117 @@
+package api
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	neturl "net/url"
+	"strconv"
+	"tekticket/util"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TTL of the cached catalog. Event details include the seat statuses and the available tickets, which change with every
+// booking without invalidation, so they are kept the shortest
+const (
+	EVENT_CACHE_TTL      = 30 * time.Second
+	EVENT_LIST_CACHE_TTL = time.Minute
+	CATALOG_CACHE_TTL    = time.Hour // Categories and memberships
+)
+
+// Cache tags of the catalog
+const (
+	CACHE_TAG_EVENTS      = "events"
+	CACHE_TAG_CATEGORIES  = "categories"
+	CACHE_TAG_MEMBERSHIPS = "memberships"
+)
+
+// Cache tags to invalidate when an item of a Directus collection changes
+var collectionCacheTags = map[string][]string{
+	"events":                   {CACHE_TAG_EVENTS},
+	"event_schedules":          {CACHE_TAG_EVENTS},
+	"seat_zones":               {CACHE_TAG_EVENTS},
+	"tickets":                  {CACHE_TAG_EVENTS},
+	"ticket_selling_schedules": {CACHE_TAG_EVENTS},
+	"categories":               {CACHE_TAG_CATEGORIES, CACHE_TAG_EVENTS}, // Events embed their category
+	"memberships":              {CACHE_TAG_MEMBERSHIPS},
+}
+
+// Helper function: cache key of a page of a catalog list, by its pagination
+func catalogPageKey(ctx *gin.Context, prefix string, pagination Pagination) string {
+	params := neturl.Values{}
+	params.Set("sort", pagination.Sort)
+	params.Set("limit", strconv.Itoa(pagination.Limit))
+	params.Set("cursor", ctx.Query("cursor"))
+	return fmt.Sprintf("%s:%x", prefix, sha256.Sum256([]byte(params.Encode())))
+}
+
+// Header of the shared secret sent by Directus flows
+const WEBHOOK_SECRET_HEADER = "X-Webhook-Secret"
+
+// Helper method: check the shared secret of a webhook called by a Directus flow. If invalid, write the error response and
+// return false
+func (server *Server) checkWebhookSecret(ctx *gin.Context) bool {
+	secret := ctx.GetHeader(WEBHOOK_SECRET_HEADER)
+	if server.config.WebhookSecret == "" || subtle.ConstantTimeCompare([]byte(secret), []byte(server.config.WebhookSecret)) != 1 {
+		util.LOGGER.Warn(ctx.Request.Method + " " + ctx.FullPath() + ": invalid webhook secret")
+		ctx.JSON(http.StatusUnauthorized, ErrorResponse{"Invalid webhook secret"})
+		return false
+	}
+	return true
+}
+
+type CacheInvalidationRequest struct {
+	Collection string `json:"collection" binding:"required"` // Collection of the changed items, the trigger's $trigger.collection
+}
+
+type CacheInvalidationResponse struct {
+	Tags    []string `json:"tags"`
+	Deleted int      `json:"deleted"` // Number of cached values deleted
+}
+
+// InvalidateCacheWebhook godoc
+// @Summary      Invalidate cached catalog
+// @Description  Called by a Directus flow when items of events, event_schedules, seat_zones, tickets, ticket_selling_schedules,
+// @Description  categories or memberships are created, updated or deleted. Deletes the cached values of the collection.
+// @Description  The flow must send the webhook secret in the X-Webhook-Secret header
+// @Tags         Webhooks
+// @Accept       json
+// @Produce      json
+// @Param        X-Webhook-Secret  header  string                    true  "Webhook secret"
+// @Param        request           body    CacheInvalidationRequest  true  "Changed collection"
+// @Success      200  {object}  CacheInvalidationResponse  "Cache invalidated"
+// @Failure      400  {object}  ErrorResponse              "Invalid request body | Collection is not cached"
+// @Failure      401  {object}  ErrorResponse              "Invalid webhook secret"
+// @Failure      500  {object}  ErrorResponse              "Internal server error"
+// @Router       /api/webhook/cache [post]
+func (server *Server) InvalidateCacheWebhook(ctx *gin.Context) {
+	if !server.checkWebhookSecret(ctx) {
+		return
+	}
+
+	var req CacheInvalidationRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		util.LOGGER.Warn("POST /api/webhook/cache: failed to bind request body", "error", err)
+		ctx.JSON(http.StatusBadRequest, ErrorResponse{"Invalid request body"})
+		return
+	}
+
+	tags, ok := collectionCacheTags[req.Collection]
+	if !ok {
+		ctx.JSON(http.StatusBadRequest, ErrorResponse{"Collection is not cached"})
+		return
+	}
+
+	deleted, err := server.queries.InvalidateCache(ctx, tags...)
+	if err != nil {
+		util.LOGGER.Error("POST /api/webhook/cache: failed to invalidate cache", "tags", tags, "error", err)
+		ctx.JSON(http.StatusInternalServerError, ErrorResponse{"Internal server error"})
+		return
+	}
+
+	util.LOGGER.Info("POST /api/webhook/cache: cache invalidated", "collection", req.Collection, "deleted", deleted)
+	ctx.JSON(http.StatusOK, CacheInvalidationResponse{Tags: tags, Deleted: deleted})
+}
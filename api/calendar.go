@@ -0,0 +1,282 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	neturl "net/url"
+	"strings"
+	"tekticket/db"
+	"tekticket/service/calendar"
+	"tekticket/util"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Fields of the bookings exported to calendars
+var calendarBookingFields = []string{
+	"id",
+	"event_id.id", "event_id.name", "event_id.address", "event_id.city", "event_id.country",
+	"event_id.latitude", "event_id.longitude",
+	"event_id.event_schedules.id", "event_id.event_schedules.start_time", "event_id.event_schedules.end_time",
+	"event_id.event_schedules.start_checkin_time", "event_id.event_schedules.end_checkin_time",
+	"booking_items.event_schedule_id.id",
+}
+
+type CalendarFeedResponse struct {
+	URL string `json:"url"` // Subscription URL of the feed, secret
+}
+
+// GetEventCalendar godoc
+// @Summary      Export an event to a calendar
+// @Description  Exports every schedule of a published event as an iCalendar file, with a reminder when check-in opens.
+// @Description  No login required
+// @Tags         Events
+// @Produce      text/calendar
+// @Produce      json
+// @Param        id   path      string  true  "Event ID or slug"
+// @Success      200  {file}    file           "iCalendar file"
+// @Failure      404  {object}  ErrorResponse  "No event found"
+// @Failure      429  {object}  ErrorResponse  "You hit the rate limit"
+// @Failure      500  {object}  ErrorResponse  "Internal server error"
+// @Router       /api/events/{id}/calendar.ics [get]
+func (server *Server) GetEventCalendar(ctx *gin.Context) {
+	event, ok := server.getPublicEvent(ctx, ctx.Param("id"))
+	if !ok {
+		return
+	}
+
+	server.writeCalendar(ctx, "event-"+event.ID+".ics", calendar.Calendar{
+		Name: event.Name,
+		Events: calendar.Events(db.Event{
+			Name:           event.Name,
+			Address:        event.Address,
+			City:           event.City,
+			Country:        event.Country,
+			Latitude:       event.Latitude,
+			Longitude:      event.Longitude,
+			EventSchedules: event.EventSchedules,
+		}, server.calendarDomain()),
+	})
+}
+
+// GetBookingCalendar godoc
+// @Summary      Export a booking to a calendar
+// @Description  Exports the booked schedules of a booking as an iCalendar file, with a reminder when check-in opens
+// @Tags         Bookings
+// @Produce      text/calendar
+// @Produce      json
+// @Param        id   path      string  true  "Booking ID"
+// @Success      200  {file}    file           "iCalendar file"
+// @Failure      401  {object}  ErrorResponse  "Unauthorized access | Token expired"
+// @Failure      403  {object}  ErrorResponse  "Invalid token"
+// @Failure      404  {object}  ErrorResponse  "No item with such ID"
+// @Failure      429  {object}  ErrorResponse  "You hit the rate limit"
+// @Failure      500  {object}  ErrorResponse  "Internal server error"
+// @Security     BearerAuth
+// @Router       /api/bookings/{id}/calendar.ics [get]
+func (server *Server) GetBookingCalendar(ctx *gin.Context) {
+	id := ctx.Param("id")
+
+	url := fmt.Sprintf("%s/items/bookings/%s?fields=%s", server.config.DirectusAddr, id, strings.Join(calendarBookingFields, ","))
+	var booking db.Booking
+	status, err := db.MakeRequest("GET", url, nil, server.GetToken(ctx), &booking)
+	if err != nil {
+		util.LOGGER.Error("GET /api/bookings/:id/calendar.ics: failed to get booking", "status", status, "error", err, "id", id)
+		server.DirectusError(ctx, err)
+		return
+	}
+
+	server.writeCalendar(ctx, "booking-"+booking.ID+".ics", calendar.Calendar{
+		Events: calendar.Events(bookedSchedules(booking), server.calendarDomain()),
+	})
+}
+
+// CreateCalendarFeed godoc
+// @Summary      Create the calendar feed of the user
+// @Description  Creates a secret URL that calendar apps can subscribe to, to keep the schedules of the user's completed
+// @Description  bookings in sync. Creating a new feed revokes the previous URL
+// @Tags         Profile
+// @Produce      json
+// @Success      201  {object}  CalendarFeedResponse  "Calendar feed created"
+// @Failure      401  {object}  ErrorResponse         "Token expired"
+// @Failure      403  {object}  ErrorResponse         "Invalid token"
+// @Failure      429  {object}  ErrorResponse         "You hit the rate limit"
+// @Failure      500  {object}  ErrorResponse         "Internal server error"
+// @Security     BearerAuth
+// @Router       /api/profile/calendar [post]
+func (server *Server) CreateCalendarFeed(ctx *gin.Context) {
+	userID, err := util.ExtractIDFromToken(server.GetToken(ctx))
+	if err != nil {
+		util.LOGGER.Error("POST /api/profile/calendar: failed to extract user ID from access token", "error", err)
+		ctx.JSON(http.StatusForbidden, ErrorResponse{"Invalid token"})
+		return
+	}
+
+	// Revoke the previous feed
+	if status, err := server.deleteCalendarFeeds(userID); err != nil {
+		util.LOGGER.Error("POST /api/profile/calendar: failed to delete previous calendar feed", "status", status, "error", err)
+		server.DirectusError(ctx, err)
+		return
+	}
+
+	token := calendar.NewFeedToken()
+	url := fmt.Sprintf("%s/items/user_calendars", server.config.DirectusAddr)
+	body := map[string]any{"user_id": userID, "token_hash": calendar.HashFeedToken(token, server.config.SecretKey)}
+	if status, err := db.MakeRequest("POST", url, body, server.config.DirectusStaticToken, nil); err != nil {
+		util.LOGGER.Error("POST /api/profile/calendar: failed to create calendar feed", "status", status, "error", err)
+		server.DirectusError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, CalendarFeedResponse{
+		URL: fmt.Sprintf("%s/api/calendar/feed.ics?token=%s", server.config.ServerDomain, neturl.QueryEscape(token)),
+	})
+}
+
+// DeleteCalendarFeed godoc
+// @Summary      Delete the calendar feed of the user
+// @Description  Revokes the subscription URL of the user's calendar feed
+// @Tags         Profile
+// @Produce      json
+// @Success      200  {object}  SuccessMessage  "Calendar feed deleted"
+// @Failure      401  {object}  ErrorResponse   "Token expired"
+// @Failure      403  {object}  ErrorResponse   "Invalid token"
+// @Failure      429  {object}  ErrorResponse   "You hit the rate limit"
+// @Failure      500  {object}  ErrorResponse   "Internal server error"
+// @Security     BearerAuth
+// @Router       /api/profile/calendar [delete]
+func (server *Server) DeleteCalendarFeed(ctx *gin.Context) {
+	userID, err := util.ExtractIDFromToken(server.GetToken(ctx))
+	if err != nil {
+		util.LOGGER.Error("DELETE /api/profile/calendar: failed to extract user ID from access token", "error", err)
+		ctx.JSON(http.StatusForbidden, ErrorResponse{"Invalid token"})
+		return
+	}
+
+	if status, err := server.deleteCalendarFeeds(userID); err != nil {
+		util.LOGGER.Error("DELETE /api/profile/calendar: failed to delete calendar feed", "status", status, "error", err)
+		server.DirectusError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, SuccessMessage{"Calendar feed deleted"})
+}
+
+// GetCalendarFeed godoc
+// @Summary      Calendar feed of a user
+// @Description  Subscribable iCalendar feed of the booked schedules of a user's completed bookings, authenticated by the
+// @Description  secret token of the feed URL
+// @Tags         Profile
+// @Produce      text/calendar
+// @Produce      json
+// @Param        token  query     string  true  "Feed token"
+// @Success      200    {file}    file           "iCalendar feed"
+// @Failure      404    {object}  ErrorResponse  "Calendar feed not found"
+// @Failure      429    {object}  ErrorResponse  "You hit the rate limit"
+// @Failure      500    {object}  ErrorResponse  "Internal server error"
+// @Router       /api/calendar/feed.ics [get]
+func (server *Server) GetCalendarFeed(ctx *gin.Context) {
+	token := ctx.Query("token")
+	if token == "" {
+		ctx.JSON(http.StatusNotFound, ErrorResponse{"Calendar feed not found"})
+		return
+	}
+
+	// Find the user of the feed
+	queryParams := neturl.Values{}
+	queryParams.Add("fields", "id,user_id.id")
+	queryParams.Add("filter[token_hash][_eq]", calendar.HashFeedToken(token, server.config.SecretKey))
+	queryParams.Add("limit", "1")
+	url := fmt.Sprintf("%s/items/user_calendars?%s", server.config.DirectusAddr, queryParams.Encode())
+	var feeds []db.UserCalendar
+	status, err := db.MakeRequest("GET", url, nil, server.config.DirectusStaticToken, &feeds)
+	if err != nil {
+		util.LOGGER.Error("GET /api/calendar/feed.ics: failed to get calendar feed", "status", status, "error", err)
+		ctx.JSON(http.StatusInternalServerError, ErrorResponse{"Internal server error"})
+		return
+	}
+	if len(feeds) == 0 || feeds[0].User == nil {
+		util.LOGGER.Warn("GET /api/calendar/feed.ics: invalid token")
+		ctx.JSON(http.StatusNotFound, ErrorResponse{"Calendar feed not found"})
+		return
+	}
+
+	// Completed bookings of the user
+	queryParams = neturl.Values{}
+	queryParams.Add("fields", strings.Join(calendarBookingFields, ","))
+	queryParams.Add("filter[customer_id][_eq]", feeds[0].User.ID)
+	queryParams.Add("filter[status][_icontains]", "complete")
+	queryParams.Add("limit", "-1")
+	url = fmt.Sprintf("%s/items/bookings?%s", server.config.DirectusAddr, queryParams.Encode())
+	var bookings []db.Booking
+	status, err = db.MakeRequest("GET", url, nil, server.config.DirectusStaticToken, &bookings)
+	if err != nil {
+		util.LOGGER.Error("GET /api/calendar/feed.ics: failed to get bookings", "status", status, "error", err)
+		ctx.JSON(http.StatusInternalServerError, ErrorResponse{"Internal server error"})
+		return
+	}
+
+	// A schedule booked twice is a single event
+	feed := calendar.Calendar{Name: "Tekticket"}
+	seen := map[string]bool{}
+	for _, booking := range bookings {
+		for _, event := range calendar.Events(bookedSchedules(booking), server.calendarDomain()) {
+			if !seen[event.UID] {
+				seen[event.UID] = true
+				feed.Events = append(feed.Events, event)
+			}
+		}
+	}
+
+	server.writeCalendar(ctx, "tekticket.ics", feed)
+}
+
+// Helper method: delete the calendar feeds of a user
+func (server *Server) deleteCalendarFeeds(userID string) (int, error) {
+	url := fmt.Sprintf("%s/items/user_calendars", server.config.DirectusAddr)
+	body := map[string]any{"query": map[string]any{"filter": map[string]any{"user_id": map[string]any{"_eq": userID}}}}
+	return db.MakeRequest("DELETE", url, body, server.config.DirectusStaticToken, nil)
+}
+
+// Helper method: host of the server, which scopes the UIDs of the exported events
+func (server *Server) calendarDomain() string {
+	if url, err := neturl.Parse(server.config.ServerDomain); err == nil && url.Host != "" {
+		return url.Host
+	}
+	return server.config.ServerDomain
+}
+
+// Helper method: send a calendar as an iCalendar file
+func (server *Server) writeCalendar(ctx *gin.Context, filename string, cal calendar.Calendar) {
+	ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	ctx.Header("Cache-Control", "no-cache")
+	ctx.Data(http.StatusOK, calendar.CONTENT_TYPE, cal.Encode(time.Now()))
+}
+
+// Helper function: the event of a booking, with only the booked schedules. Bookings without schedule on their items keep
+// every schedule of the event
+func bookedSchedules(booking db.Booking) db.Event {
+	if booking.Event == nil {
+		return db.Event{}
+	}
+	event := *booking.Event
+
+	booked := map[string]bool{}
+	for _, item := range booking.BookingItems {
+		if item.EventSchedule != nil {
+			booked[item.EventSchedule.ID] = true
+		}
+	}
+	if len(booked) == 0 {
+		return event
+	}
+
+	event.EventSchedules = nil
+	for _, schedule := range booking.Event.EventSchedules {
+		if booked[schedule.ID] {
+			event.EventSchedules = append(event.EventSchedules, schedule)
+		}
+	}
+	return event
+}
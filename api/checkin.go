@@ -1,10 +1,12 @@
 package api
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
 	"tekticket/db"
+	"tekticket/service/mfa"
 	"tekticket/service/worker"
 	"tekticket/util"
 	"time"
@@ -15,6 +17,7 @@ import (
 type CheckinRequest struct {
 	StaffEmail    string `json:"staff_email" binding:"required"`
 	StaffPassword string `json:"staff_password" binding:"required"`
+	StaffOTP      string `json:"staff_otp"` // Required if the staff has two-factor authentication enabled
 	CheckinDevice string `json:"checkin_device" binding:"required"`
 	Token         string `json:"token" binding:"required"`
 }
@@ -22,17 +25,18 @@ type CheckinRequest struct {
 // Checkin godoc
 // @Summary      Check in attendee via QR code
 // @Description  Allows event staff to verify a QR token, validate the event schedule,
-// @Description  and mark a ticket as checked in. Requires staff credentials and Directus authentication.
+// @Description  and mark a ticket as checked in. Requires staff credentials and Directus authentication, plus a TOTP code
+// @Description  when the staff has two-factor authentication enabled.
 // @Tags         Checkin
 // @Accept       json
 // @Produce      json
 // @Param        request body CheckinRequest true "Check-in request payload"
 // @Success      200  {object}  SuccessMessage  "Check-in successful"
 // @Failure      400  {object}  ErrorResponse   "Invalid request body | Checkin time not started yet | Checkin time has ended | QR not available | Invalid request data"
-// @Failure      401  {object}  ErrorResponse   "Incorrect login credentials"
+// @Failure      401  {object}  ErrorResponse   "Incorrect login credentials | Invalid MFA code"
 // @Failure      403  {object}  ErrorResponse   "You don't have permission to perform this request"
 // @Failure      404  {object}  ErrorResponse   "No item with such ID"
-// @Failure      429  {object}  ErrorResponse   "You hit the rate limit"
+// @Failure      429  {object}  ErrorResponse   "You hit the rate limit | Too many failed MFA attempts, please retry later"
 // @Failure      500  {object}  ErrorResponse   "Internal server or Directus error"
 // @Router       /api/checkins [post]
 func (server *Server) Checkin(ctx *gin.Context) {
@@ -44,7 +48,15 @@ func (server *Server) Checkin(ctx *gin.Context) {
 		return
 	}
 
-	// First, check if the staff information is valid
+	// Verify the QR first, so that a forged QR never reaches the staff credentials
+	bookingItemID, err := worker.VerifyQRToken(req.Token, server.config.SecretKey)
+	if err != nil {
+		util.LOGGER.Warn("POST /api/checkins: failed to verify check in token", "error", err)
+		ctx.JSON(http.StatusBadRequest, ErrorResponse{"QR not available"})
+		return
+	}
+
+	// Then, check if the staff information is valid
 	url := fmt.Sprintf("%s/auth/login", server.config.DirectusAddr)
 	var loginResp LoginResponse
 	body := map[string]any{"email": req.StaffEmail, "password": req.StaffPassword}
@@ -77,17 +89,58 @@ func (server *Server) Checkin(ctx *gin.Context) {
 		return
 	}
 
-	// Veirfy token
-	bookingItemID, err := worker.VerifyQRToken(req.Token, server.config.SecretKey)
+	// Check the second factor of the staff, if enabled. The same code is reused for every scan within its time window, so
+	// unlike login, a code is not single-use here: it is bound to the first device that used it. The failed codes are
+	// limited per staff, so that the password alone can't be used to guess the codes
+	record, status, err := server.getUserMFA(staffID)
 	if err != nil {
-		util.LOGGER.Error("POST /api/checkins: failed to verify check in token", "error", err)
-		ctx.JSON(http.StatusInternalServerError, ErrorResponse{"Internal server error"})
+		util.LOGGER.Error("POST /api/checkins: failed to get staff MFA record", "status", status, "error", err)
+		server.DirectusError(ctx, err)
 		return
 	}
 
+	if record != nil && record.Status == MFA_STATUS_ENABLED {
+		blocked, err := server.mfaManager.Blocked(ctx, mfa.SCOPE_CHECKIN, staffID)
+		if err != nil {
+			util.LOGGER.Error("POST /api/checkins: failed to get staff MFA attempts", "error", err)
+			ctx.JSON(http.StatusInternalServerError, ErrorResponse{"Internal server error"})
+			return
+		}
+		if blocked {
+			ctx.JSON(http.StatusTooManyRequests, ErrorResponse{"Too many failed MFA attempts, please retry later"})
+			return
+		}
+
+		secret, err := server.decryptMFASecret(record.Secret)
+		if err != nil {
+			util.LOGGER.Error("POST /api/checkins: failed to decrypt staff MFA secret", "error", err)
+			ctx.JSON(http.StatusInternalServerError, ErrorResponse{"Internal server error"})
+			return
+		}
+
+		step, ok := mfa.ValidateCode(secret, req.StaffOTP, time.Now())
+		if ok {
+			ok, err = server.mfaManager.UseCheckinStep(ctx, staffID, req.CheckinDevice, step)
+			if err != nil {
+				util.LOGGER.Error("POST /api/checkins: failed to mark staff MFA code as used", "error", err)
+				ctx.JSON(http.StatusInternalServerError, ErrorResponse{"Internal server error"})
+				return
+			}
+		}
+		if !ok {
+			util.LOGGER.Warn("POST /api/checkins: invalid staff MFA code", "staff_id", staffID)
+			if err := server.mfaManager.RecordUserFailure(ctx, mfa.SCOPE_CHECKIN, staffID); err != nil && !errors.Is(err, mfa.ErrTooManyAttempts) {
+				util.LOGGER.Error("POST /api/checkins: failed to record staff MFA failure", "error", err)
+			}
+			ctx.JSON(http.StatusUnauthorized, ErrorResponse{"Invalid MFA code"})
+			return
+		}
+	}
+
 	// Get booking data
 	fields := []string{
-		"id", "status", "event_schedule_id.id", "event_schedule_id.start_checkin_time", "event_schedule_id.end_checkin_time",
+		"id", "status", "checkin_token",
+		"event_schedule_id.id", "event_schedule_id.start_checkin_time", "event_schedule_id.end_checkin_time",
 	}
 	url = fmt.Sprintf("%s/items/booking_items/%s?fields=%s", server.config.DirectusAddr, bookingItemID, strings.Join(fields, ","))
 	var bookingItem db.BookingItem
@@ -147,6 +200,14 @@ func (server *Server) Checkin(ctx *gin.Context) {
 		return
 	}
 
+	// Only the latest QR of a ticket is valid, the previous ones are revoked when the ticket changes hands. Tickets issued
+	// before the tokens were stored have none
+	if bookingItem.CheckinToken != "" && bookingItem.CheckinToken != req.Token {
+		util.LOGGER.Warn("POST /api/checkins: QR token revoked", "id", bookingItem.ID)
+		ctx.JSON(http.StatusBadRequest, ErrorResponse{"QR not available"})
+		return
+	}
+
 	// Create checkin record in database
 	url = fmt.Sprintf("%s/items/checkins", server.config.DirectusAddr)
 	body = map[string]any{
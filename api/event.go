@@ -1,56 +1,141 @@
 package api
 
 import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"math"
 	"net/http"
 	"net/url"
+	"slices"
 	"strconv"
 	"time"
 
 	"strings"
 	"tekticket/db"
+	"tekticket/service/search"
 	"tekticket/util"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 )
 
+// Organizer of a public event, without their private data
+type PublicOrganizer struct {
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+}
+
+// Ticket of a public event
+type PublicTicket struct {
+	db.Ticket
+	MemberPrice *int `json:"member_price,omitempty"` // Price with the membership discount, only for logged in users
+}
+
+// Event details for customers and anonymous visitors
+type PublicEvent struct {
+	ID             string             `json:"id"`
+	Name           string             `json:"name"`
+	Description    string             `json:"description"`
+	Address        string             `json:"address"`
+	City           string             `json:"city"`
+	Country        string             `json:"country"`
+	Latitude       *float64           `json:"latitude,omitempty"`
+	Longitude      *float64           `json:"longitude,omitempty"`
+	Slug           string             `json:"slug"`
+	PreviewImage   string             `json:"preview_image"`
+	Category       *db.Category       `json:"category"`
+	Organizer      *PublicOrganizer   `json:"organizer"`
+	EventSchedules []db.EventSchedule `json:"event_schedules"`
+	SeatZones      []db.SeatZone      `json:"seat_zones"`
+	Tickets        []PublicTicket     `json:"tickets"`
+}
+
+// Helper function: build the public details of an event
+func newPublicEvent(event db.Event) PublicEvent {
+	publicEvent := PublicEvent{
+		ID:             event.ID,
+		Name:           event.Name,
+		Description:    event.Description,
+		Address:        event.Address,
+		City:           event.City,
+		Country:        event.Country,
+		Latitude:       event.Latitude,
+		Longitude:      event.Longitude,
+		Slug:           event.Slug,
+		PreviewImage:   event.PreviewImage,
+		Category:       event.Category,
+		EventSchedules: event.EventSchedules,
+		SeatZones:      event.SeatZones,
+		Tickets:        make([]PublicTicket, 0, len(event.Tickets)),
+	}
+	if event.Creator != nil {
+		publicEvent.Organizer = &PublicOrganizer{FirstName: event.Creator.FirstName, LastName: event.Creator.LastName}
+	}
+	for _, ticket := range event.Tickets {
+		publicEvent.Tickets = append(publicEvent.Tickets, PublicTicket{Ticket: ticket})
+	}
+	return publicEvent
+}
+
 // GetEvent godoc
 // @Summary      Retrieve a single event by ID or by its slug
-// @Description  Returns detailed information about a specific event, including category, images, and schedule data.
+// @Description  Returns detailed information about a specific published event, including category, images, and schedule
+// @Description  data. No login required, but logged in users also get the member price of the tickets.
 // @Tags         Events
 // @Accept       json
 // @Produce      json
 // @Param        id              path      string  true   "Event ID"
-// @Success      200  {object}  db.Event          "Event details retrieved successfully"
-// @Failure      401  {object}  ErrorResponse     "Unauthorized access | Token expired"
-// @Failure      403  {object}  ErrorResponse     "Invalid token"
+// @Success      200  {object}  PublicEvent       "Event details retrieved successfully"
 // @Failure      404  {object}  ErrorResponse     "No item with such ID"
 // @Failure      429  {object}  ErrorResponse     "You hit the rate limit"
 // @Failure      500  {object}  ErrorResponse     "Internal server error"
 // @Security     BearerAuth
 // @Router       /api/events/{id} [get]
 func (server *Server) GetEvent(ctx *gin.Context) {
-	// Get access token
-	token := server.GetToken(ctx)
-
 	// Get event ID by request path parameter
 	id := ctx.Param("id") // Although it was called id, it can be either event ID or slug
 
+	event, ok := server.getPublicEvent(ctx, id)
+	if !ok {
+		return
+	}
+
+	// Personalized extras of logged in users, on top of the cached event
+	discount, ok := server.getMemberDiscount(ctx)
+	if !ok {
+		return
+	}
+	if discount != nil {
+		event.Tickets = slices.Clone(event.Tickets) // Shared with the concurrent requests of the same load
+		for i := range event.Tickets {
+			price := util.MemberPrice(event.Tickets[i].BasePrice, *discount)
+			event.Tickets[i].MemberPrice = &price
+		}
+	}
+
+	ctx.JSON(http.StatusOK, event)
+}
+
+// Helper method: get a published event by ID or by slug, from the cache or from Directus. If failed, return the error to
+// client and false
+func (server *Server) getPublicEvent(ctx *gin.Context, id string) (PublicEvent, bool) {
+	caller := fmt.Sprintf("%s %s", ctx.Request.Method, ctx.FullPath())
+
 	// Build the query URL with status fields
 	queryParams := url.Values{}
 	fields := []string{
-		"id", "name", "description", "address", "city", "country", "slug", "preview_image",
+		"id", "name", "description", "address", "city", "country", "latitude", "longitude", "slug", "preview_image",
 		"event_schedules.id", "event_schedules.start_time", "event_schedules.end_time",
 		"event_schedules.start_checkin_time", "event_schedules.end_checkin_time",
 		"seat_zones.id", "seat_zones.description", "seat_zones.total_seats", "seat_zones.status",
 		"seat_zones.seats.id", "seat_zones.seats.status", "seat_zones.seats.seat_number",
+		"seat_zones.seats.row", "seat_zones.seats.x", "seat_zones.seats.y",
 		"tickets.id", "tickets.rank", "tickets.description", "tickets.base_price", "tickets.status",
 		"tickets.ticket_selling_schedules.id", "tickets.ticket_selling_schedules.total",
 		"tickets.ticket_selling_schedules.available", "tickets.ticket_selling_schedules.start_selling_time",
 		"tickets.ticket_selling_schedules.end_selling_time", "tickets.ticket_selling_schedules.status",
-		"creator_id.first_name", "creator_id.last_name", "creator_id.email",
+		"creator_id.first_name", "creator_id.last_name",
 		"category_id.id", "category_id.name", "category_id.description", "category_id.status",
 	}
 	queryParams.Add("fields", strings.Join(fields, ","))
@@ -60,6 +145,39 @@ func (server *Server) GetEvent(ctx *gin.Context) {
 	queryParams.Add("filter[category_id][status][_icontains]", "published")
 	queryParams.Add("filter[status][_icontains]", "published")
 
+	event, err := db.GetOrLoad(ctx, server.queries, "event:"+id, EVENT_CACHE_TTL, []string{CACHE_TAG_EVENTS}, func() (PublicEvent, error) {
+		event, err := server.loadEvent(id, queryParams)
+		return newPublicEvent(event), err
+	})
+	if errors.Is(err, errEventNotFound) {
+		ctx.JSON(http.StatusNotFound, ErrorResponse{"No event found"})
+		return event, false
+	}
+	if err != nil {
+		util.LOGGER.Error(caller+": failed to get event", "error", err, "id", id)
+		server.DirectusError(ctx, err)
+		return event, false
+	}
+
+	return event, true
+}
+
+// Default and maximum radius of the geo filter, in kilometers
+const (
+	DEFAULT_SEARCH_RADIUS = 10.0
+	MAX_SEARCH_RADIUS     = 500.0
+)
+
+// Maximum number of words in a search text, each one is a filter of Directus
+const MAX_SEARCH_WORDS = 10
+
+// Maximum number of events sorted by the search, when the order is computed or the events are searched near a location
+const MAX_SEARCH_CANDIDATES = 1000
+
+var errEventNotFound = errors.New("event not found")
+
+// Helper method: load a published event from Directus, by ID or by slug
+func (server *Server) loadEvent(id string, queryParams url.Values) (db.Event, error) {
 	// Check if 'id' is an actual UUID (search by ID), or a normal string (search by slug)
 	// If 'id' is an UUID, then we'll hit the single item endpoint (/items/events/{id}), which is faster and cleaner
 	// If 'id' is a string (slug), then we will have to search for every event that match this slug, and get the first item,
@@ -71,26 +189,23 @@ func (server *Server) GetEvent(ctx *gin.Context) {
 
 		// Make request to Directus
 		var results []db.Event
-		status, err := db.MakeRequest("GET", url, nil, token, &results)
+		status, err := db.MakeRequest("GET", url, nil, server.config.DirectusPublicToken, &results)
 		if err != nil {
 			util.LOGGER.Error("GET /api/events/:id: failed to get event from Directus", "status", status, "error", err, "id", id)
-			server.DirectusError(ctx, err)
-			return
+			return event, err
 		}
 
 		// If empty slice -> not found
 		if len(results) == 0 {
-			ctx.JSON(http.StatusNotFound, ErrorResponse{"No event found"})
-			return
+			return event, errEventNotFound
 		}
 		event = results[0]
 	} else {
 		url := fmt.Sprintf("%s/items/events/%s?%s", server.config.DirectusAddr, id, queryParams.Encode())
-		status, err := db.MakeRequest("GET", url, nil, token, &event)
+		status, err := db.MakeRequest("GET", url, nil, server.config.DirectusPublicToken, &event)
 		if err != nil {
 			util.LOGGER.Error("GET /api/events/:id: failed to get event from Directus", "status", status, "error", err, "id", id)
-			server.DirectusError(ctx, err)
-			return
+			return event, err
 		}
 	}
 
@@ -99,88 +214,186 @@ func (server *Server) GetEvent(ctx *gin.Context) {
 		event.PreviewImage = util.CreateImageLink(server.config.ServerDomain, event.PreviewImage)
 	}
 
-	ctx.JSON(http.StatusOK, event)
+	return event, nil
 }
 
-// Helper method: calculate the smallest base price of a ticket belong to an event
-func (server *Server) calculateEventMinimumBasePrice(tickets []db.Ticket) int {
-	if len(tickets) == 0 {
-		return 0
-	}
+// Event minimal info for list view
+type EventInfo struct {
+	ID           string      `json:"id"`
+	Name         string      `json:"name"`
+	Address      string      `json:"address"`
+	City         string      `json:"city"`
+	Country      string      `json:"country"`
+	PreviewImage string      `json:"preview_image"`
+	Category     db.Category `json:"category"`
+	StartTime    string      `json:"start_time"`             // Closest upcoming schedule time, among the schedules in the date range
+	BasePrice    int         `json:"base_price"`             // Minimum ticket price, among the tickets in the price range
+	MemberPrice  *int        `json:"member_price,omitempty"` // Base price with the membership discount, only for logged in users
+	Distance     *float64    `json:"distance,omitempty"`     // Distance in kilometers, when searching near a location
+}
+
+// Page of the event list. Truncated is set when the search sorted only the newest MAX_SEARCH_CANDIDATES matching events,
+// the filters have to be narrowed to list the others
+type EventPage struct {
+	Page[EventInfo]
+	Truncated bool `json:"truncated"`
+}
 
-	minPrice := tickets[0].BasePrice
-	for i := 1; i < len(tickets); i++ {
-		minPrice = min(minPrice, tickets[i].BasePrice)
+// Helper method: parse the search query parameters. If invalid, return the field-level errors
+func (server *Server) parseSearchQuery(ctx *gin.Context) (search.Query, map[string][]string) {
+	query := search.Query{Text: strings.TrimSpace(ctx.Query("q"))}
+	violations := map[string][]string{}
+
+	if len(search.Words(query.Text)) > MAX_SEARCH_WORDS {
+		violations["q"] = append(violations["q"], fmt.Sprintf("must have at most %d words", MAX_SEARCH_WORDS))
 	}
 
-	return minPrice
-}
+	parseTime := func(field string, endOfDay bool) *time.Time {
+		value := ctx.Query(field)
+		if value == "" {
+			return nil
+		}
+		if t, err := time.Parse(time.RFC3339, value); err == nil {
+			return &t
+		}
+		t, err := time.Parse(time.DateOnly, value)
+		if err != nil {
+			violations[field] = append(violations[field], "must be a date (YYYY-MM-DD) or a RFC 3339 time")
+			return nil
+		}
+		if endOfDay {
+			t = t.Add(24*time.Hour - time.Nanosecond)
+		}
+		return &t
+	}
+	query.From = parseTime("from", false)
+	query.To = parseTime("to", true)
+	if query.From != nil && query.To != nil && query.To.Before(*query.From) {
+		violations["to"] = append(violations["to"], "must not be before from")
+	}
 
-// Helper method: get the nearest (before or after) start time of an event
-func (server *Server) getNearestEventStartTime(schedules []db.EventSchedule) string {
-	if len(schedules) == 0 {
-		return ""
+	parsePrice := func(field string) *int {
+		value := ctx.Query(field)
+		if value == "" {
+			return nil
+		}
+		price, err := strconv.Atoi(value)
+		if err != nil || price < 0 {
+			violations[field] = append(violations[field], "must be a non-negative integer")
+			return nil
+		}
+		return &price
+	}
+	query.MinPrice = parsePrice("min_price")
+	query.MaxPrice = parsePrice("max_price")
+	if query.MinPrice != nil && query.MaxPrice != nil && *query.MaxPrice < *query.MinPrice {
+		violations["max_price"] = append(violations["max_price"], "must not be less than min_price")
 	}
 
-	now := time.Now()
-	nearestDiff := time.Duration(math.MaxInt64)
-	var nearest *db.DateTime
-
-	for _, schedule := range schedules {
-		diff := now.Sub(time.Time(*schedule.StartTime)).Abs()
-		if diff < nearestDiff {
-			nearestDiff = diff
-			nearest = schedule.StartTime
+	if value := ctx.Query("available"); value != "" {
+		available, err := strconv.ParseBool(value)
+		if err != nil {
+			violations["available"] = append(violations["available"], "must be true or false")
 		}
+		query.Available = available
 	}
 
-	return time.Time(*nearest).String()
-}
+	lat, lng := ctx.Query("lat"), ctx.Query("lng")
+	if lat != "" || lng != "" {
+		latitude, latErr := strconv.ParseFloat(lat, 64)
+		longitude, lngErr := strconv.ParseFloat(lng, 64)
+		if latErr != nil || latitude < -90 || latitude > 90 {
+			violations["lat"] = append(violations["lat"], "must be a latitude between -90 and 90")
+		}
+		if lngErr != nil || longitude < -180 || longitude > 180 {
+			violations["lng"] = append(violations["lng"], "must be a longitude between -180 and 180")
+		}
 
-// Event minimal info for list view
-type EventInfo struct {
-	ID           string      `json:"id"`
-	Name         string      `json:"name"`
-	Address      string      `json:"address"`
-	City         string      `json:"city"`
-	Country      string      `json:"country"`
-	PreviewImage string      `json:"preview_image"`
-	Category     db.Category `json:"category"`
-	StartTime    string      `json:"start_time"` // Closest upcoming schedule time
-	BasePrice    int         `json:"base_price"` // Minimum ticket price
+		query.Near = &search.Point{Latitude: latitude, Longitude: longitude}
+		query.Radius = DEFAULT_SEARCH_RADIUS
+		if value := ctx.Query("radius"); value != "" {
+			radius, err := strconv.ParseFloat(value, 64)
+			if err != nil || radius <= 0 || radius > MAX_SEARCH_RADIUS {
+				violations["radius"] = append(violations["radius"], fmt.Sprintf("must be between 0 and %g kilometers", MAX_SEARCH_RADIUS))
+			}
+			query.Radius = radius
+		}
+	}
+
+	return query, violations
 }
 
 // ListEvents godoc
 // @Summary      List all events
-// @Description  Returns a list of published events with minimal information
+// @Description  Returns a list of published events with minimal information. The full-text search matches every word of q
+// @Description  case-insensitively, and ranks name matches above description matches. Sorting by relevance, start_time,
+// @Description  price, -price or distance, or searching near a location, sorts the 1000 newest matching events at most, and
+// @Description  the page is then marked as truncated. No login required, but logged in users also get the member price
 // @Tags         Events
 // @Accept       json
 // @Produce      json
+// @Param        q            query     string  false  "Full-text search over name and description, 10 words at most"
 // @Param        name         query     string  false  "Filter by event name (case-insensitive contains)"
 // @Param        location     query     string  false  "Filter by city or country (case-insensitive contains)"
 // @Param        category     query     string  false  "Filter by category name (case-insensitive contains)"
-// @Param        limit        query     int     false  "Limit number of results (default: 50)"
-// @Param        offset       query     int     false  "Offset for pagination (default: 0)"
-// @Param        sort         query     string  false  "Sort field (default: -date_created). Use - prefix for descending"
-// @Success      200  {array}   EventInfo         "List of events retrieved successfully"
-// @Failure      401  {object}  ErrorResponse     "Unauthorized access | Token expired"
-// @Failure      403  {object}  ErrorResponse     "Invalid token"
-// @Failure      429  {object}  ErrorResponse     "You hit the rate limit"
-// @Failure      500  {object}  ErrorResponse     "Internal server error"
+// @Param        from         query     string  false  "Only events with a schedule starting at or after this date (YYYY-MM-DD or RFC 3339)"
+// @Param        to           query     string  false  "Only events with a schedule starting at or before this date (YYYY-MM-DD or RFC 3339)"
+// @Param        min_price    query     int     false  "Only events with a ticket at or above this price"
+// @Param        max_price    query     int     false  "Only events with a ticket at or below this price"
+// @Param        available    query     bool    false  "Only events with tickets on sale"
+// @Param        lat          query     number  false  "Latitude of the location to search near"
+// @Param        lng          query     number  false  "Longitude of the location to search near"
+// @Param        radius       query     number  false  "Search radius in kilometers (default: 10)"
+// @Param        limit        query     int     false  "Limit number of results (default: 50, max: 100)"
+// @Param        cursor       query     string  false  "Cursor of the next page, from the previous page"
+// @Param        sort         query     string  false  "relevance (default with q), start_time, price, -price, distance, name, -name, date_created or -date_created (default)"
+// @Success      200  {object}  EventPage                "List of events retrieved successfully"
+// @Failure      400  {object}  ValidationErrorResponse  "Invalid search parameters | Invalid pagination parameters"
+// @Failure      429  {object}  ErrorResponse            "You hit the rate limit"
+// @Failure      500  {object}  ErrorResponse            "Internal server error"
 // @Security     BearerAuth
 // @Router       /api/events [get]
 func (server *Server) ListEvents(ctx *gin.Context) {
-	// Get access token
-	token := server.GetToken(ctx)
+	query, violations := server.parseSearchQuery(ctx)
+	if len(violations) > 0 {
+		util.LOGGER.Warn("GET /api/events: invalid search parameters", "violations", len(violations))
+		ctx.JSON(http.StatusBadRequest, ValidationErrorResponse{Message: "Invalid search parameters", Fields: violations})
+		return
+	}
+
+	// Sort, default: by relevance when searching a text, newest first otherwise
+	defaultSort := "-date_created"
+	if query.Text != "" {
+		defaultSort = search.SORT_RELEVANCE
+	}
+	pagination, ok := server.parsePagination(
+		ctx,
+		defaultSort,
+		"-date_created", "date_created", "name", "-name",
+		search.SORT_RELEVANCE, search.SORT_START_TIME, search.SORT_PRICE, search.SORT_PRICE_DESC, search.SORT_DISTANCE,
+	)
+	if !ok {
+		return
+	}
+	if pagination.Sort == search.SORT_DISTANCE && query.Near == nil {
+		ctx.JSON(http.StatusBadRequest, ValidationErrorResponse{
+			Message: "Invalid search parameters",
+			Fields:  map[string][]string{"sort": {"distance requires lat and lng"}},
+		})
+		return
+	}
 
 	// Build query parameters
 	queryParams := url.Values{}
 
 	// Fields to retrieve
 	fields := []string{
-		"id", "status", "name", "address", "city", "country", "preview_image",
+		"id", "status", "name", "description", "address", "city", "country", "latitude", "longitude", "preview_image",
+		"date_created",
 		"event_schedules.start_time",
 		"tickets.base_price", "tickets.status",
+		"tickets.ticket_selling_schedules.available", "tickets.ticket_selling_schedules.end_selling_time",
+		"tickets.ticket_selling_schedules.status",
 		"category_id.id", "category_id.name", "category_id.description", "category_id.status",
 	}
 	queryParams.Add("fields", strings.Join(fields, ","))
@@ -207,42 +420,141 @@ func (server *Server) ListEvents(ctx *gin.Context) {
 		queryParams.Add("filter[category_id][name][_icontains]", category)
 	}
 
-	// Pagination
-	limit := 50
-	if val, err := strconv.Atoi(ctx.Query("limit")); err == nil && val > 0 {
-		limit = val
+	// Filter: every word of the text, in the name or the description. The first filter[_and] is the pagination cursor
+	for i, word := range search.Words(query.Text) {
+		queryParams.Add(fmt.Sprintf("filter[_and][%d][_or][0][name][_icontains]", i+1), word)
+		queryParams.Add(fmt.Sprintf("filter[_and][%d][_or][1][description][_icontains]", i+1), word)
 	}
-	queryParams.Add("limit", strconv.Itoa(limit))
 
-	offset := 0
-	if val, err := strconv.Atoi(ctx.Query("offset")); err == nil && val >= 0 {
-		offset = val
+	// Filter: a schedule in the date range
+	if query.From != nil {
+		queryParams.Add("filter[event_schedules][_some][start_time][_gte]", query.From.Format(time.RFC3339))
+	}
+	if query.To != nil {
+		queryParams.Add("filter[event_schedules][_some][start_time][_lte]", query.To.Format(time.RFC3339))
 	}
-	queryParams.Add("offset", strconv.Itoa(offset))
 
-	// Sort
-	sort := ctx.Query("sort")
-	if sort == "" {
-		sort = "-date_created" // Default: newest first
+	// Filter: a published ticket in the price range, on sale if requested
+	if query.MinPrice != nil || query.MaxPrice != nil || query.Available {
+		queryParams.Add("filter[tickets][_some][status][_eq]", search.PUBLISHED)
+	}
+	if query.MinPrice != nil {
+		queryParams.Add("filter[tickets][_some][base_price][_gte]", strconv.Itoa(*query.MinPrice))
+	}
+	if query.MaxPrice != nil {
+		queryParams.Add("filter[tickets][_some][base_price][_lte]", strconv.Itoa(*query.MaxPrice))
+	}
+	if query.Available {
+		onSale := "filter[tickets][_some][ticket_selling_schedules][_some]"
+		queryParams.Add(onSale+"[status][_eq]", search.PUBLISHED)
+		queryParams.Add(onSale+"[available][_gt]", "0")
+		queryParams.Add(onSale+"[_or][0][end_selling_time][_gt]", "$NOW")
+		queryParams.Add(onSale+"[_or][1][end_selling_time][_null]", "true")
 	}
-	queryParams.Add("sort", sort)
 
-	// Build URL
-	directusURL := fmt.Sprintf("%s/items/events?%s", server.config.DirectusAddr, queryParams.Encode())
+	// Filter: the bounding box of the radius, the search keeps the events within the radius
+	if query.Near != nil {
+		minLat, maxLat, minLng, maxLng := search.BoundingBox(*query.Near, query.Radius)
+		queryParams.Add("filter[latitude][_between]", fmt.Sprintf("%f,%f", minLat, maxLat))
+		queryParams.Add("filter[longitude][_between]", fmt.Sprintf("%f,%f", minLng, maxLng))
+	}
 
-	// Make request to Directus
-	var directusResult []db.Event
-	status, err := db.MakeRequest("GET", directusURL, nil, token, &directusResult)
+	// Get the page of matching events, cached by the parsed query
+	key := eventListKey(ctx, query, pagination)
+	page, err := db.GetOrLoad(ctx, server.queries, key, EVENT_LIST_CACHE_TTL, []string{CACHE_TAG_EVENTS}, func() (EventPage, error) {
+		return server.loadEventPage(queryParams, query, pagination)
+	})
+	if errors.Is(err, util.ErrInvalidCursor) {
+		util.LOGGER.Warn("GET /api/events: invalid cursor", "error", err)
+		ctx.JSON(http.StatusBadRequest, ValidationErrorResponse{
+			Message: "Invalid pagination parameters",
+			Fields:  map[string][]string{"cursor": {"must be the next_cursor of the previous page, with the same sort"}},
+		})
+		return
+	}
 	if err != nil {
-		util.LOGGER.Error("GET /api/events: failed to get events from Directus", "status", status, "error", err)
+		util.LOGGER.Error("GET /api/events: failed to get events", "error", err)
 		server.DirectusError(ctx, err)
 		return
 	}
 
-	// Transform and filter data
-	events := make([]EventInfo, 0)
+	// Personalized extras of logged in users, on top of the cached page
+	discount, ok := server.getMemberDiscount(ctx)
+	if !ok {
+		return
+	}
+	if discount != nil {
+		page.Data = slices.Clone(page.Data) // Shared with the concurrent requests of the same load
+		for i := range page.Data {
+			price := util.MemberPrice(page.Data[i].BasePrice, *discount)
+			page.Data[i].MemberPrice = &price
+		}
+	}
+
+	// Return empty array if no events found
+	ctx.JSON(http.StatusOK, page)
+}
+
+// Helper function: cache key of a list of events. The key is built from the parsed parameters, so that the unknown
+// parameters and the different spellings of the same query share a cache entry
+func eventListKey(ctx *gin.Context, query search.Query, pagination Pagination) string {
+	params := url.Values{}
+	params.Set("q", strings.Join(search.Words(query.Text), " "))
+	params.Set("name", ctx.Query("name"))
+	params.Set("location", ctx.Query("location"))
+	params.Set("category", ctx.Query("category"))
+	if query.From != nil {
+		params.Set("from", query.From.Format(time.RFC3339Nano))
+	}
+	if query.To != nil {
+		params.Set("to", query.To.Format(time.RFC3339Nano))
+	}
+	if query.MinPrice != nil {
+		params.Set("min_price", strconv.Itoa(*query.MinPrice))
+	}
+	if query.MaxPrice != nil {
+		params.Set("max_price", strconv.Itoa(*query.MaxPrice))
+	}
+	params.Set("available", strconv.FormatBool(query.Available))
+	if query.Near != nil {
+		params.Set("lat", strconv.FormatFloat(query.Near.Latitude, 'g', -1, 64))
+		params.Set("lng", strconv.FormatFloat(query.Near.Longitude, 'g', -1, 64))
+		params.Set("radius", strconv.FormatFloat(query.Radius, 'g', -1, 64))
+	}
+	params.Set("sort", pagination.Sort)
+	params.Set("limit", strconv.Itoa(pagination.Limit))
+	params.Set("cursor", ctx.Query("cursor"))
+
+	return fmt.Sprintf("events:%x", sha256.Sum256([]byte(params.Encode())))
+}
+
+// Helper method: load a page of events from Directus, matched against the search query
+func (server *Server) loadEventPage(queryParams url.Values, query search.Query, pagination Pagination) (EventPage, error) {
+	var (
+		results   []search.Result
+		next      string
+		total     int
+		truncated bool
+		err       error
+	)
+	if search.Computed(pagination.Sort) || query.Near != nil {
+		results, next, total, truncated, err = server.searchEventCandidates(queryParams, query, pagination)
+	} else {
+		results, next, total, err = server.searchEventsByField(queryParams, query, pagination)
+	}
+	if err != nil {
+		return EventPage{}, err
+	}
+
+	// Transform data
+	page := EventPage{
+		Page:      Page[EventInfo]{Data: make([]EventInfo, 0, len(results)), NextCursor: next, Total: total},
+		Truncated: truncated,
+	}
+
+	for _, result := range results {
+		event := result.Event
 
-	for _, event := range directusResult {
 		// Create event info
 		eventInfo := EventInfo{
 			ID:           event.ID,
@@ -251,65 +563,157 @@ func (server *Server) ListEvents(ctx *gin.Context) {
 			City:         event.City,
 			Country:      event.Country,
 			PreviewImage: event.PreviewImage,
-			Category:     *event.Category,
+			Distance:     result.Distance,
+		}
+		if event.Category != nil {
+			eventInfo.Category = *event.Category
+		}
+		if result.MinPrice != nil {
+			eventInfo.BasePrice = *result.MinPrice
+		}
+		if result.StartTime != nil {
+			eventInfo.StartTime = result.StartTime.String()
 		}
-
-		// Calculate smallest base price for this event
-		eventInfo.BasePrice = server.calculateEventMinimumBasePrice(event.Tickets)
-
-		// Get the nearest time in relative to the current time
-		eventInfo.StartTime = server.getNearestEventStartTime(event.EventSchedules)
 
 		// Remap preview_image ID to link
 		if eventInfo.PreviewImage != "" {
 			eventInfo.PreviewImage = util.CreateImageLink(server.config.ServerDomain, eventInfo.PreviewImage)
 		}
 
-		events = append(events, eventInfo)
+		page.Data = append(page.Data, eventInfo)
 	}
 
-	// Return empty array if no events found
-	ctx.JSON(http.StatusOK, events)
+	return page, nil
+}
+
+// Helper method: get a page of events sorted by a Directus field. Without a location, every filter of the query is
+// expressed in Directus, so Directus pages the events, and the search only computes the values of the list view
+func (server *Server) searchEventsByField(
+	queryParams url.Values,
+	query search.Query,
+	pagination Pagination,
+) ([]search.Result, string, int, error) {
+	directusURL := fmt.Sprintf("%s/items/events", server.config.DirectusAddr)
+	items, total, status, err := pagination.fetch(directusURL, queryParams, server.config.DirectusPublicToken)
+	if err != nil {
+		util.LOGGER.Error("GET /api/events: failed to get events from Directus", "status", status, "error", err)
+		return nil, "", 0, err
+	}
+
+	items, next, err := pagination.page(items)
+	if err != nil {
+		return nil, "", 0, fmt.Errorf("failed to build next cursor: %w", err)
+	}
+
+	now := time.Now()
+	results := make([]search.Result, 0, len(items))
+	for _, item := range items {
+		var event db.Event
+		if err := json.Unmarshal(item, &event); err != nil {
+			return nil, "", 0, fmt.Errorf("failed to parse event: %w", err)
+		}
+		result, _ := search.Match(event, query, now)
+		results = append(results, result)
+	}
+
+	return results, next, total, nil
+}
+
+// Helper method: get a page of events sorted by an order computed by the search, or searched near a location. Directus
+// filters the candidates, the newest MAX_SEARCH_CANDIDATES are matched and sorted, then the page resumes after the cursor.
+// Also return whether there were more candidates, left out of the sort
+func (server *Server) searchEventCandidates(
+	queryParams url.Values,
+	query search.Query,
+	pagination Pagination,
+) ([]search.Result, string, int, bool, error) {
+	queryParams.Set("sort", "-date_created,-id")
+	queryParams.Set("limit", strconv.Itoa(MAX_SEARCH_CANDIDATES))
+	queryParams.Set("meta", "filter_count")
+
+	var events []db.Event
+	directusURL := fmt.Sprintf("%s/items/events?%s", server.config.DirectusAddr, queryParams.Encode())
+	meta, status, err := db.MakeListRequest(directusURL, server.config.DirectusPublicToken, &events)
+	if err != nil {
+		util.LOGGER.Error("GET /api/events: failed to get events from Directus", "status", status, "error", err)
+		return nil, "", 0, false, err
+	}
+	truncated := meta.FilterCount > len(events)
+	if truncated {
+		util.LOGGER.Warn("GET /api/events: too many search candidates, only the newest are sorted", "count", meta.FilterCount)
+	}
+
+	now := time.Now()
+	results := make([]search.Result, 0, len(events))
+	for _, event := range events {
+		if result, ok := search.Match(event, query, now); ok {
+			results = append(results, result)
+		}
+	}
+	search.Sort(results, pagination.Sort, now)
+	total := len(results)
+
+	if pagination.Cursor != nil {
+		results, err = search.After(results, pagination.Sort, pagination.Cursor.Value, pagination.Cursor.ID, now)
+		if err != nil {
+			return nil, "", 0, false, fmt.Errorf("%w: %w", util.ErrInvalidCursor, err)
+		}
+	}
+
+	if len(results) <= pagination.Limit {
+		return results, "", total, truncated, nil
+	}
+
+	results = results[:pagination.Limit]
+	last := results[len(results)-1]
+	next := util.EncodeCursor(util.Cursor{
+		Sort:  pagination.Sort,
+		Value: search.Key(last, pagination.Sort),
+		ID:    last.Event.ID,
+	})
+	return results, next, total, truncated, nil
 }
 
 // GetCategories godoc
 // @Summary      Retrieve all categories
-// @Description  Returns a list of all available event categories from the database.
+// @Description  Returns a page of the available event categories from the database. No login required
 // @Tags         Events
 // @Accept       json
 // @Produce      json
-// @Success      200  {array}   db.Category       "List of categories retrieved successfully"
-// @Failure      401  {object}  ErrorResponse     "Unauthorized access | Token expired"
-// @Failure      403  {object}  ErrorResponse     "Invalid token"
-// @Failure      429  {object}  ErrorResponse     "You hit the rate limit"
-// @Failure      500  {object}  ErrorResponse     "Internal server error"
-// @Security     BearerAuth
+// @Param        limit   query     int     false  "Maximum number of records to return (default: 50, max: 100)"
+// @Param        cursor  query     string  false  "Cursor of the next page, from the previous page"
+// @Param        sort    query     string  false  "Sort order: name (default) or -name"
+// @Success      200  {object}  Page[db.Category]        "List of categories retrieved successfully"
+// @Failure      400  {object}  ValidationErrorResponse  "Invalid pagination parameters"
+// @Failure      429  {object}  ErrorResponse            "You hit the rate limit"
+// @Failure      500  {object}  ErrorResponse            "Internal server error"
 // @Router       /api/categories [get]
 func (server *Server) ListCategories(ctx *gin.Context) {
-	// Get access token
-	token := server.GetToken(ctx)
-	if token == "" {
-		ctx.JSON(http.StatusUnauthorized, ErrorResponse{"Unauthorized access"})
+	pagination, ok := server.parsePagination(ctx, "name", "name", "-name")
+	if !ok {
 		return
 	}
 
 	// Build the query URL
 	queryParams := url.Values{}
 	queryParams.Add("fields", "id,name,description")
-	queryParams.Add("sort", "name")
-	queryParams.Add("limit", "-1") // Category wouldn't be much, so we will get all the category by setting limit = -1
 	queryParams.Add("filter[status][_icontains]", "published")
 
-	directusURL := fmt.Sprintf("%s/items/categories?%s", server.config.DirectusAddr, queryParams.Encode())
+	directusURL := fmt.Sprintf("%s/items/categories", server.config.DirectusAddr)
 
-	// Make request to Directus
-	var categories []db.Category
-	status, err := db.MakeRequest("GET", directusURL, nil, token, &categories)
+	// Make request to Directus, or get the page from cache
+	key := catalogPageKey(ctx, "categories", pagination)
+	page, err := db.GetOrLoad(ctx, server.queries, key, CATALOG_CACHE_TTL, []string{CACHE_TAG_CATEGORIES}, func() (Page[db.Category], error) {
+		page, status, err := listPage[db.Category](directusURL, queryParams, pagination, server.config.DirectusPublicToken)
+		if err != nil {
+			util.LOGGER.Error("GET /api/categories: failed to get categories from Directus", "status", status, "error", err)
+		}
+		return page, err
+	})
 	if err != nil {
-		util.LOGGER.Error("GET /api/events/categories: failed to get categories from Directus", "status", status, "error", err)
 		server.DirectusError(ctx, err)
 		return
 	}
 
-	ctx.JSON(http.StatusOK, categories)
+	ctx.JSON(http.StatusOK, page)
 }
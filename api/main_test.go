@@ -0,0 +1,39 @@
+package api
+
+import (
+	"context"
+	"os"
+	"strings"
+	"tekticket/db"
+	"tekticket/util"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	ctx     = context.Background()
+	queries *db.Queries
+)
+
+func TestMain(m *testing.M) {
+	// This integration test shouldn't be run in CI, it needs Redis
+	if strings.TrimSpace(os.Getenv("CI")) != "" {
+		util.LOGGER.Warn("CI environment, skip integration test")
+		return
+	}
+
+	queries = db.NewQueries()
+	err := queries.ConnectRedis(ctx, &redis.Options{
+		Addr: os.Getenv("REDIS_ADDR"),
+	})
+
+	if err != nil {
+		util.LOGGER.Error("failed to connect to Redis for testing", "error", err)
+		os.Exit(1)
+	}
+
+	gin.SetMode(gin.TestMode)
+	os.Exit(m.Run())
+}
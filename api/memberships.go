@@ -32,15 +32,27 @@ type MembershipResponse struct {
 // @Security     BearerAuth
 // @Router       /api/memberships/me [get]
 func (server *Server) GetUserMembership(ctx *gin.Context) {
+	result, ok := server.getUserMembership(ctx)
+	if !ok {
+		return
+	}
+
+	ctx.JSON(http.StatusOK, result)
+}
+
+// Helper method: get the membership of the current user. If failed, return the error to client and false
+func (server *Server) getUserMembership(ctx *gin.Context) (MembershipResponse, bool) {
+	caller := fmt.Sprintf("%s %s", ctx.Request.Method, ctx.FullPath())
+
 	// Get access token
 	token := server.GetToken(ctx)
 
 	// Get user ID
 	userID, err := util.ExtractIDFromToken(token)
 	if err != nil {
-		util.LOGGER.Error("GET /api/memberships/me: failed to get user ID from access token", "error", err)
+		util.LOGGER.Error(caller+": failed to get user ID from access token", "error", err)
 		ctx.JSON(http.StatusForbidden, ErrorResponse{"Invalid token"})
-		return
+		return MembershipResponse{}, false
 	}
 
 	// To get the user current point, we just need to get the latest log of that user, resulting_points would be the current point
@@ -54,9 +66,9 @@ func (server *Server) GetUserMembership(ctx *gin.Context) {
 	var logs []db.UserMembershipLog
 	status, err := db.MakeRequest("GET", directusURL, nil, token, &logs)
 	if err != nil {
-		util.LOGGER.Error("GET api/memberships/me: failed to make request to Directus", "status", status, "error", err)
+		util.LOGGER.Error(caller+": failed to make request to Directus", "status", status, "error", err)
 		server.DirectusError(ctx, err)
-		return
+		return MembershipResponse{}, false
 	}
 
 	result := MembershipResponse{}
@@ -72,7 +84,7 @@ func (server *Server) GetUserMembership(ctx *gin.Context) {
 	// tier with base point lower or equal than current point
 	memberships, err := server.listMemberships(ctx)
 	if err != nil {
-		return
+		return MembershipResponse{}, false
 	}
 
 	for _, membership := range memberships {
@@ -85,47 +97,78 @@ func (server *Server) GetUserMembership(ctx *gin.Context) {
 		}
 	}
 
-	ctx.JSON(http.StatusOK, result)
+	return result, true
+}
+
+// Helper method: get the membership discount of the current user, in percent, for the member prices of public routes.
+// Return nil for anonymous visitors. If failed, return the error to client and false
+func (server *Server) getMemberDiscount(ctx *gin.Context) (*float64, bool) {
+	if server.GetToken(ctx) == "" {
+		return nil, true
+	}
+
+	membership, ok := server.getUserMembership(ctx)
+	return &membership.Discount, ok
 }
 
 // ListMemberships godoc
 // @Summary      List all published membership tiers
-// @Description  Retrieves all published membership tiers sorted by resulting points in ascending order.
+// @Description  Retrieves a page of the published membership tiers sorted by resulting points. No login required
 // @Tags         Memberships
 // @Accept       json
 // @Produce      json
-// @Success      200  {array}   db.Membership        "List of memberships retrieved successfully"
-// @Failure      401  {object}  ErrorResponse        "Token expired"
-// @Failure      403  {object}  ErrorResponse        "Invalid token"
-// @Failure      429  {object}  ErrorResponse        "You hit the rate limit"
-// @Failure      500  {object}  ErrorResponse        "Internal server error"
-// @Security     BearerAuth
+// @Param        limit   query     int     false  "Maximum number of records to return (default: 50, max: 100)"
+// @Param        cursor  query     string  false  "Cursor of the next page, from the previous page"
+// @Param        sort    query     string  false  "Sort order: base_point (default) or -base_point"
+// @Success      200  {object}  Page[db.Membership]      "List of memberships retrieved successfully"
+// @Failure      400  {object}  ValidationErrorResponse  "Invalid pagination parameters"
+// @Failure      429  {object}  ErrorResponse            "You hit the rate limit"
+// @Failure      500  {object}  ErrorResponse            "Internal server error"
 // @Router       /api/memberships [get]
 func (server *Server) ListMemberships(ctx *gin.Context) {
-	// Get the list of all memberships tier
-	memberships, err := server.listMemberships(ctx)
+	pagination, ok := server.parsePagination(ctx, "base_point", "base_point", "-base_point")
+	if !ok {
+		return
+	}
+
+	queryParams := url.Values{}
+	queryParams.Add("filter[status][_eq]", "published")
+	directusURL := fmt.Sprintf("%s/items/memberships", server.config.DirectusAddr)
+
+	// Make request to Directus, or get the page from cache
+	key := catalogPageKey(ctx, "memberships", pagination)
+	page, err := db.GetOrLoad(ctx, server.queries, key, CATALOG_CACHE_TTL, []string{CACHE_TAG_MEMBERSHIPS}, func() (Page[db.Membership], error) {
+		page, status, err := listPage[db.Membership](directusURL, queryParams, pagination, server.config.DirectusPublicToken)
+		if err != nil {
+			util.LOGGER.Error("GET /api/memberships: failed to get memberships from Directus", "status", status, "error", err)
+		}
+		return page, err
+	})
 	if err != nil {
-		// The helper already handle error return to client, so we just return here
+		server.DirectusError(ctx, err)
 		return
 	}
-	ctx.JSON(http.StatusOK, memberships)
+
+	ctx.JSON(http.StatusOK, page)
 }
 
 // Helper method: Get the list of all memberships
 func (server *Server) listMemberships(ctx *gin.Context) ([]db.Membership, error) {
-	// Get access token
-	token := server.GetToken(ctx)
-
 	// Get the list of all memberships. It should be a short list, so we don't need to provide any paging here
 	url := fmt.Sprintf("%s/items/memberships?filter[status][_eq]=published&sort=base_point", server.config.DirectusAddr)
-	var memberships = []db.Membership{} // Make sure it's an empty slice instead of nil for better JSON returned
-	status, err := db.MakeRequest("GET", url, nil, token, &memberships)
+	memberships, err := db.GetOrLoad(ctx, server.queries, "memberships", CATALOG_CACHE_TTL, []string{CACHE_TAG_MEMBERSHIPS}, func() ([]db.Membership, error) {
+		var memberships = []db.Membership{} // Make sure it's an empty slice instead of nil for better JSON returned
+		status, err := db.MakeRequest("GET", url, nil, server.config.DirectusPublicToken, &memberships)
+		if err != nil {
+			util.LOGGER.Error(
+				fmt.Sprintf("%s %s: failed to get the list of all memberships", ctx.Request.Method, ctx.FullPath()),
+				"status", status,
+				"error", err,
+			)
+		}
+		return memberships, err
+	})
 	if err != nil {
-		util.LOGGER.Error(
-			fmt.Sprintf("%s %s: failed to get the list of all memberships", ctx.Request.Method, ctx.FullPath()),
-			"status", status,
-			"error", err,
-		)
 		server.DirectusError(ctx, err)
 		return nil, err
 	}
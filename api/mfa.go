@@ -0,0 +1,623 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"tekticket/db"
+	"tekticket/service/mfa"
+	"tekticket/util"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	MFA_ISSUER         = "Tekticket"
+	MFA_STATUS_PENDING = "pending"
+	MFA_STATUS_ENABLED = "enabled"
+)
+
+// Roles that can enroll in two-factor authentication
+var mfaRoles = []string{"organizer", "staff"}
+
+// Helper method: get the MFA record of a user, return nil if the user never enrolled
+func (server *Server) getUserMFA(userID string) (*db.UserMFA, int, error) {
+	url := fmt.Sprintf(
+		"%s/items/user_mfas?fields=id,status,secret,recovery_codes&filter[user_id][_eq]=%s&limit=1",
+		server.config.DirectusAddr,
+		userID,
+	)
+	var records []db.UserMFA
+	status, err := db.MakeRequest("GET", url, nil, server.config.DirectusStaticToken, &records)
+	if err != nil {
+		return nil, status, err
+	}
+
+	if len(records) == 0 {
+		return nil, status, nil
+	}
+	return &records[0], status, nil
+}
+
+// Helper method: encrypt the TOTP secret before storing it in Directus
+func (server *Server) encryptMFASecret(secret string) (string, error) {
+	encrypted, err := util.Encrypt([]byte(server.config.SecretKey), []byte(secret))
+	if err != nil {
+		return "", err
+	}
+	return util.Encode(string(encrypted)), nil
+}
+
+// Helper method: decrypt the TOTP secret stored in Directus
+func (server *Server) decryptMFASecret(encoded string) (string, error) {
+	decoded, err := util.Decode(encoded)
+	if err != nil {
+		return "", err
+	}
+
+	secret, err := util.Decrypt([]byte(server.config.SecretKey), []byte(decoded))
+	if err != nil {
+		return "", err
+	}
+	return string(secret), nil
+}
+
+// Helper method: check a TOTP code of the user. A code can only be used once, so that an intercepted code can't be replayed
+func (server *Server) checkTOTP(ctx context.Context, userID string, record *db.UserMFA, code string) (bool, error) {
+	secret, err := server.decryptMFASecret(record.Secret)
+	if err != nil {
+		return false, err
+	}
+
+	step, ok := mfa.ValidateCode(secret, code, time.Now())
+	if !ok {
+		return false, nil
+	}
+
+	return server.mfaManager.UseStep(ctx, userID, step)
+}
+
+// Helper method: check a recovery code of the user. A valid recovery code is consumed. The codes are locked while one is used
+// and read again under the lock, so that concurrent requests can't use the same code, nor write back a used one
+func (server *Server) useRecoveryCode(ctx context.Context, userID string, record *db.UserMFA, code string) (bool, error) {
+	hash := server.mfaManager.HashRecoveryCode(code)
+	if !slices.Contains(record.RecoveryCodes, hash) {
+		return false, nil
+	}
+
+	locked, err := server.mfaManager.LockRecoveryCodes(ctx, userID)
+	if err != nil || !locked {
+		return false, err
+	}
+	defer server.mfaManager.UnlockRecoveryCodes(ctx, userID)
+
+	current, _, err := server.getUserMFA(userID)
+	if err != nil {
+		return false, err
+	}
+	if current == nil || current.ID != record.ID {
+		return false, nil
+	}
+	index := slices.Index(current.RecoveryCodes, hash)
+	if index < 0 {
+		return false, nil
+	}
+
+	remaining := slices.Delete(slices.Clone(current.RecoveryCodes), index, index+1)
+	url := fmt.Sprintf("%s/items/user_mfas/%s", server.config.DirectusAddr, record.ID)
+	body := map[string]any{"recovery_codes": remaining}
+	if _, err := db.MakeRequest("PATCH", url, body, server.config.DirectusStaticToken, nil); err != nil {
+		return false, err
+	}
+
+	record.RecoveryCodes = remaining
+	return true, nil
+}
+
+// Helper method: check the second factor of the user, either a TOTP code or a recovery code
+func (server *Server) verifySecondFactor(ctx context.Context, userID string, record *db.UserMFA, code, recoveryCode string) (bool, error) {
+	if code = strings.TrimSpace(code); code != "" {
+		return server.checkTOTP(ctx, userID, record, code)
+	}
+
+	if recoveryCode = strings.TrimSpace(recoveryCode); recoveryCode != "" {
+		return server.useRecoveryCode(ctx, userID, record, recoveryCode)
+	}
+
+	return false, nil
+}
+
+// Helper method: check the second factor of the user on the profile routes, either a TOTP code or a recovery code. The
+// failed codes are limited per user, so that a stolen access token can't be used to guess them. If failed or invalid,
+// return the error to client and false
+func (server *Server) checkProfileSecondFactor(ctx *gin.Context, userID string, record *db.UserMFA, code, recoveryCode string) bool {
+	caller := ctx.Request.Method + " " + ctx.FullPath()
+
+	blocked, err := server.mfaManager.Blocked(ctx, mfa.SCOPE_PROFILE, userID)
+	if err != nil {
+		util.LOGGER.Error(caller+": failed to get MFA attempts", "error", err)
+		ctx.JSON(http.StatusInternalServerError, ErrorResponse{"Internal server error"})
+		return false
+	}
+	if blocked {
+		ctx.JSON(http.StatusTooManyRequests, ErrorResponse{"Too many failed MFA attempts, please retry later"})
+		return false
+	}
+
+	ok, err := server.verifySecondFactor(ctx, userID, record, code, recoveryCode)
+	if err != nil {
+		util.LOGGER.Error(caller+": failed to check second factor", "error", err)
+		ctx.JSON(http.StatusInternalServerError, ErrorResponse{"Internal server error"})
+		return false
+	}
+	if ok {
+		return true
+	}
+
+	util.LOGGER.Warn(caller+": invalid MFA code", "id", userID)
+	err = server.mfaManager.RecordUserFailure(ctx, mfa.SCOPE_PROFILE, userID)
+	switch {
+	case errors.Is(err, mfa.ErrTooManyAttempts):
+		ctx.JSON(http.StatusTooManyRequests, ErrorResponse{"Too many failed MFA attempts, please retry later"})
+	case err != nil:
+		util.LOGGER.Error(caller+": failed to record MFA failure", "error", err)
+		ctx.JSON(http.StatusInternalServerError, ErrorResponse{"Internal server error"})
+	default:
+		ctx.JSON(http.StatusBadRequest, ErrorResponse{"Invalid MFA code"})
+	}
+	return false
+}
+
+// Helper method: generate new recovery codes for the user, store their hash and return the plain codes
+func (server *Server) resetRecoveryCodes(record *db.UserMFA, status string) ([]string, error) {
+	codes, err := mfa.GenerateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := make([]string, 0, len(codes))
+	for _, code := range codes {
+		hashes = append(hashes, server.mfaManager.HashRecoveryCode(code))
+	}
+
+	url := fmt.Sprintf("%s/items/user_mfas/%s", server.config.DirectusAddr, record.ID)
+	body := map[string]any{"status": status, "recovery_codes": hashes}
+	if _, err := db.MakeRequest("PATCH", url, body, server.config.DirectusStaticToken, nil); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+type EnrollMFAResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURL string `json:"otpauth_url"`
+	QRCode     string `json:"qr_code"` // PNG image, as a data URL
+}
+
+// EnrollMFA godoc
+// @Summary      Enroll in two-factor authentication
+// @Description  Generates a new TOTP secret for the current organizer or staff account, returned as plain text, otpauth:// URL
+// @Description  and QR code to scan with an authenticator app. Two-factor authentication is only enabled after a code is
+// @Description  verified with /api/profile/mfa/verify. Enrolling again before verifying replaces the previous secret
+// @Tags         Profile
+// @Produce      json
+// @Success      200  {object}  EnrollMFAResponse  "TOTP secret"
+// @Failure      401  {object}  ErrorResponse      "Token expired"
+// @Failure      403  {object}  ErrorResponse      "Invalid token | You don't have permission to perform this request"
+// @Failure      409  {object}  ErrorResponse      "Two-factor authentication already enabled"
+// @Failure      429  {object}  ErrorResponse      "You hit the rate limit"
+// @Failure      500  {object}  ErrorResponse      "Internal server error"
+// @Security     BearerAuth
+// @Router       /api/profile/mfa/enroll [post]
+func (server *Server) EnrollMFA(ctx *gin.Context) {
+	token := server.GetToken(ctx)
+
+	// Only organizer and staff can enroll
+	role, err := util.ExtractRoleFromToken(token, server.config.DirectusAddr, server.config.DirectusStaticToken)
+	if err != nil {
+		util.LOGGER.Error("POST /api/profile/mfa/enroll: failed to get requester role", "error", err)
+		ctx.JSON(http.StatusInternalServerError, ErrorResponse{"Internal server error"})
+		return
+	}
+
+	if role = strings.ToLower(strings.TrimSpace(role)); !slices.Contains(mfaRoles, role) {
+		util.LOGGER.Warn("POST /api/profile/mfa/enroll: invalid role", "role", role)
+		ctx.JSON(http.StatusForbidden, ErrorResponse{"You don't have permission to perform this request"})
+		return
+	}
+
+	// Get the user email, used as the account name in authenticator apps
+	var user db.User
+	url := fmt.Sprintf("%s/users/me?fields=id,email", server.config.DirectusAddr)
+	status, err := db.MakeRequest("GET", url, nil, token, &user)
+	if err != nil {
+		util.LOGGER.Error("POST /api/profile/mfa/enroll: failed to get user", "status", status, "error", err)
+		server.DirectusError(ctx, err)
+		return
+	}
+
+	// Check the current MFA record
+	record, status, err := server.getUserMFA(user.ID)
+	if err != nil {
+		util.LOGGER.Error("POST /api/profile/mfa/enroll: failed to get MFA record", "status", status, "error", err)
+		server.DirectusError(ctx, err)
+		return
+	}
+
+	if record != nil && record.Status == MFA_STATUS_ENABLED {
+		util.LOGGER.Warn("POST /api/profile/mfa/enroll: MFA already enabled", "id", user.ID)
+		ctx.JSON(http.StatusConflict, ErrorResponse{"Two-factor authentication already enabled"})
+		return
+	}
+
+	// Generate a new secret
+	secret, err := mfa.GenerateSecret()
+	if err != nil {
+		util.LOGGER.Error("POST /api/profile/mfa/enroll: failed to generate secret", "error", err)
+		ctx.JSON(http.StatusInternalServerError, ErrorResponse{"Internal server error"})
+		return
+	}
+
+	encrypted, err := server.encryptMFASecret(secret)
+	if err != nil {
+		util.LOGGER.Error("POST /api/profile/mfa/enroll: failed to encrypt secret", "error", err)
+		ctx.JSON(http.StatusInternalServerError, ErrorResponse{"Internal server error"})
+		return
+	}
+
+	// Save the pending secret, replace the previous pending one if any
+	body := map[string]any{"status": MFA_STATUS_PENDING, "secret": encrypted, "recovery_codes": []string{}}
+	if record == nil {
+		body["user_id"] = user.ID
+		url = fmt.Sprintf("%s/items/user_mfas", server.config.DirectusAddr)
+		status, err = db.MakeRequest("POST", url, body, server.config.DirectusStaticToken, nil)
+	} else {
+		url = fmt.Sprintf("%s/items/user_mfas/%s", server.config.DirectusAddr, record.ID)
+		status, err = db.MakeRequest("PATCH", url, body, server.config.DirectusStaticToken, nil)
+	}
+
+	if err != nil {
+		util.LOGGER.Error("POST /api/profile/mfa/enroll: failed to save MFA record", "status", status, "error", err)
+		server.DirectusError(ctx, err)
+		return
+	}
+
+	// Render the provisioning URI as QR code
+	uri := mfa.ProvisioningURI(MFA_ISSUER, user.Email, secret)
+	qr, err := util.GenerateQR(uri)
+	if err != nil {
+		util.LOGGER.Error("POST /api/profile/mfa/enroll: failed to generate QR", "error", err)
+		ctx.JSON(http.StatusInternalServerError, ErrorResponse{"Internal server error"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, EnrollMFAResponse{
+		Secret:     secret,
+		OTPAuthURL: uri,
+		QRCode:     "data:image/png;base64," + base64.StdEncoding.EncodeToString(qr),
+	})
+}
+
+type MFACodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// VerifyMFA godoc
+// @Summary      Verify two-factor authentication enrollment
+// @Description  Verifies a code from the authenticator app to finish the enrollment, then enables two-factor authentication.
+// @Description  Returns the recovery codes, which are only shown once: each of them can be used once instead of a TOTP code
+// @Tags         Profile
+// @Accept       json
+// @Produce      json
+// @Param        request  body  MFACodeRequest  true  "TOTP code"
+// @Success      200  {object}  RecoveryCodesResponse  "Two-factor authentication enabled"
+// @Failure      400  {object}  ErrorResponse          "Invalid request body | Invalid MFA code | No pending enrollment"
+// @Failure      401  {object}  ErrorResponse          "Token expired"
+// @Failure      403  {object}  ErrorResponse          "Invalid token"
+// @Failure      429  {object}  ErrorResponse          "Too many failed MFA attempts, please retry later | You hit the rate limit"
+// @Failure      500  {object}  ErrorResponse          "Internal server error"
+// @Security     BearerAuth
+// @Router       /api/profile/mfa/verify [post]
+func (server *Server) VerifyMFA(ctx *gin.Context) {
+	var req MFACodeRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		util.LOGGER.Warn("POST /api/profile/mfa/verify: failed to bind request body", "error", err)
+		ctx.JSON(http.StatusBadRequest, ErrorResponse{"Invalid request body"})
+		return
+	}
+
+	userID, err := util.ExtractIDFromToken(server.GetToken(ctx))
+	if err != nil {
+		util.LOGGER.Error("POST /api/profile/mfa/verify: failed to get user ID from token", "error", err)
+		ctx.JSON(http.StatusInternalServerError, ErrorResponse{"Internal server error"})
+		return
+	}
+
+	record, status, err := server.getUserMFA(userID)
+	if err != nil {
+		util.LOGGER.Error("POST /api/profile/mfa/verify: failed to get MFA record", "status", status, "error", err)
+		server.DirectusError(ctx, err)
+		return
+	}
+
+	if record == nil || record.Status != MFA_STATUS_PENDING {
+		util.LOGGER.Warn("POST /api/profile/mfa/verify: no pending enrollment", "id", userID)
+		ctx.JSON(http.StatusBadRequest, ErrorResponse{"No pending enrollment"})
+		return
+	}
+
+	if !server.checkProfileSecondFactor(ctx, userID, record, req.Code, "") {
+		return
+	}
+
+	// Enable MFA, with a fresh set of recovery codes
+	codes, err := server.resetRecoveryCodes(record, MFA_STATUS_ENABLED)
+	if err != nil {
+		util.LOGGER.Error("POST /api/profile/mfa/verify: failed to enable MFA", "error", err)
+		server.DirectusError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, RecoveryCodesResponse{codes})
+}
+
+// RegenerateRecoveryCodes godoc
+// @Summary      Regenerate recovery codes
+// @Description  Replaces every recovery code of the current user with new ones. Requires a code from the authenticator app
+// @Tags         Profile
+// @Accept       json
+// @Produce      json
+// @Param        request  body  MFACodeRequest  true  "TOTP code"
+// @Success      200  {object}  RecoveryCodesResponse  "New recovery codes"
+// @Failure      400  {object}  ErrorResponse          "Invalid request body | Invalid MFA code | Two-factor authentication not enabled"
+// @Failure      401  {object}  ErrorResponse          "Token expired"
+// @Failure      403  {object}  ErrorResponse          "Invalid token"
+// @Failure      409  {object}  ErrorResponse          "A recovery code is being used, please retry"
+// @Failure      429  {object}  ErrorResponse          "Too many failed MFA attempts, please retry later | You hit the rate limit"
+// @Failure      500  {object}  ErrorResponse          "Internal server error"
+// @Security     BearerAuth
+// @Router       /api/profile/mfa/recovery-codes [post]
+func (server *Server) RegenerateRecoveryCodes(ctx *gin.Context) {
+	var req MFACodeRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		util.LOGGER.Warn("POST /api/profile/mfa/recovery-codes: failed to bind request body", "error", err)
+		ctx.JSON(http.StatusBadRequest, ErrorResponse{"Invalid request body"})
+		return
+	}
+
+	userID, err := util.ExtractIDFromToken(server.GetToken(ctx))
+	if err != nil {
+		util.LOGGER.Error("POST /api/profile/mfa/recovery-codes: failed to get user ID from token", "error", err)
+		ctx.JSON(http.StatusInternalServerError, ErrorResponse{"Internal server error"})
+		return
+	}
+
+	record, status, err := server.getUserMFA(userID)
+	if err != nil {
+		util.LOGGER.Error("POST /api/profile/mfa/recovery-codes: failed to get MFA record", "status", status, "error", err)
+		server.DirectusError(ctx, err)
+		return
+	}
+
+	if record == nil || record.Status != MFA_STATUS_ENABLED {
+		util.LOGGER.Warn("POST /api/profile/mfa/recovery-codes: MFA not enabled", "id", userID)
+		ctx.JSON(http.StatusBadRequest, ErrorResponse{"Two-factor authentication not enabled"})
+		return
+	}
+
+	if !server.checkProfileSecondFactor(ctx, userID, record, req.Code, "") {
+		return
+	}
+
+	// A recovery code being used would write back the previous codes
+	locked, err := server.mfaManager.LockRecoveryCodes(ctx, userID)
+	if err != nil {
+		util.LOGGER.Error("POST /api/profile/mfa/recovery-codes: failed to lock recovery codes", "error", err)
+		ctx.JSON(http.StatusInternalServerError, ErrorResponse{"Internal server error"})
+		return
+	}
+	if !locked {
+		ctx.JSON(http.StatusConflict, ErrorResponse{"A recovery code is being used, please retry"})
+		return
+	}
+	defer server.mfaManager.UnlockRecoveryCodes(ctx, userID)
+
+	codes, err := server.resetRecoveryCodes(record, MFA_STATUS_ENABLED)
+	if err != nil {
+		util.LOGGER.Error("POST /api/profile/mfa/recovery-codes: failed to save recovery codes", "error", err)
+		server.DirectusError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, RecoveryCodesResponse{codes})
+}
+
+type SecondFactorRequest struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// DisableMFA godoc
+// @Summary      Disable two-factor authentication
+// @Description  Disables two-factor authentication of the current user. Requires either a code from the authenticator app,
+// @Description  or a recovery code
+// @Tags         Profile
+// @Accept       json
+// @Produce      json
+// @Param        request  body  SecondFactorRequest  true  "TOTP code or recovery code"
+// @Success      200  {object}  SuccessMessage  "Two-factor authentication disabled"
+// @Failure      400  {object}  ErrorResponse   "Invalid request body | Invalid MFA code | Two-factor authentication not enabled"
+// @Failure      401  {object}  ErrorResponse   "Token expired"
+// @Failure      403  {object}  ErrorResponse   "Invalid token"
+// @Failure      429  {object}  ErrorResponse   "Too many failed MFA attempts, please retry later | You hit the rate limit"
+// @Failure      500  {object}  ErrorResponse   "Internal server error"
+// @Security     BearerAuth
+// @Router       /api/profile/mfa [delete]
+func (server *Server) DisableMFA(ctx *gin.Context) {
+	var req SecondFactorRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		util.LOGGER.Warn("DELETE /api/profile/mfa: failed to bind request body", "error", err)
+		ctx.JSON(http.StatusBadRequest, ErrorResponse{"Invalid request body"})
+		return
+	}
+
+	userID, err := util.ExtractIDFromToken(server.GetToken(ctx))
+	if err != nil {
+		util.LOGGER.Error("DELETE /api/profile/mfa: failed to get user ID from token", "error", err)
+		ctx.JSON(http.StatusInternalServerError, ErrorResponse{"Internal server error"})
+		return
+	}
+
+	record, status, err := server.getUserMFA(userID)
+	if err != nil {
+		util.LOGGER.Error("DELETE /api/profile/mfa: failed to get MFA record", "status", status, "error", err)
+		server.DirectusError(ctx, err)
+		return
+	}
+
+	if record == nil || record.Status != MFA_STATUS_ENABLED {
+		util.LOGGER.Warn("DELETE /api/profile/mfa: MFA not enabled", "id", userID)
+		ctx.JSON(http.StatusBadRequest, ErrorResponse{"Two-factor authentication not enabled"})
+		return
+	}
+
+	if !server.checkProfileSecondFactor(ctx, userID, record, req.Code, req.RecoveryCode) {
+		return
+	}
+
+	url := fmt.Sprintf("%s/items/user_mfas/%s", server.config.DirectusAddr, record.ID)
+	status, err = db.MakeRequest("DELETE", url, nil, server.config.DirectusStaticToken, nil)
+	if err != nil {
+		util.LOGGER.Error("DELETE /api/profile/mfa: failed to delete MFA record", "status", status, "error", err)
+		server.DirectusError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, SuccessMessage{"Two-factor authentication disabled"})
+}
+
+type MFAChallengeResponse struct {
+	MFARequired bool   `json:"mfa_required"`
+	Challenge   string `json:"challenge"`
+	ExpiresIn   int    `json:"expires_in"` // Seconds
+}
+
+type LoginMFARequest struct {
+	Challenge    string `json:"challenge" binding:"required"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// LoginMFA godoc
+// @Summary      Complete login with the second factor
+// @Description  Second step of the login for users with two-factor authentication enabled. Exchanges the challenge returned by
+// @Description  /api/auth/login and a code from the authenticator app (or a recovery code) for the access and refresh tokens.
+// @Description  After too many failed attempts, the challenge is dropped and the user has to log in again
+// @Tags         Auth
+// @Accept       json
+// @Produce      json
+// @Param        request body LoginMFARequest true "Challenge and TOTP code or recovery code"
+// @Success      200 {object} LoginResponse "Login successful"
+// @Failure      400 {object} ErrorResponse "Invalid request body"
+// @Failure      401 {object} ErrorResponse "Invalid MFA code | MFA challenge expired, please login again"
+// @Failure      429 {object} ErrorResponse "Rate limit exceeded | Too many failed attempts, please login again"
+// @Failure      500 {object} ErrorResponse "Internal server error"
+// @Router       /api/auth/login/mfa [post]
+func (server *Server) LoginMFA(ctx *gin.Context) {
+	var req LoginMFARequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		util.LOGGER.Warn("POST /api/auth/login/mfa: failed to bind request body", "error", err)
+		ctx.JSON(http.StatusBadRequest, ErrorResponse{"Invalid request body"})
+		return
+	}
+
+	challenge, err := server.mfaManager.GetChallenge(ctx, req.Challenge)
+	if errors.Is(err, mfa.ErrChallengeNotFound) {
+		util.LOGGER.Warn("POST /api/auth/login/mfa: challenge not found")
+		ctx.JSON(http.StatusUnauthorized, ErrorResponse{"MFA challenge expired, please login again"})
+		return
+	}
+	if err != nil {
+		util.LOGGER.Error("POST /api/auth/login/mfa: failed to get challenge", "error", err)
+		ctx.JSON(http.StatusInternalServerError, ErrorResponse{"Internal server error"})
+		return
+	}
+
+	record, status, err := server.getUserMFA(challenge.UserID)
+	if err != nil {
+		util.LOGGER.Error("POST /api/auth/login/mfa: failed to get MFA record", "status", status, "error", err)
+		server.DirectusError(ctx, err)
+		return
+	}
+
+	// MFA has been disabled in between, there is nothing left to check
+	ok := record == nil || record.Status != MFA_STATUS_ENABLED
+	if !ok {
+		if ok, err = server.verifySecondFactor(ctx, challenge.UserID, record, req.Code, req.RecoveryCode); err != nil {
+			util.LOGGER.Error("POST /api/auth/login/mfa: failed to check second factor", "error", err)
+			ctx.JSON(http.StatusInternalServerError, ErrorResponse{"Internal server error"})
+			return
+		}
+	}
+
+	if !ok {
+		util.LOGGER.Warn("POST /api/auth/login/mfa: invalid MFA code", "id", challenge.UserID)
+		err := server.mfaManager.RecordFailure(ctx, req.Challenge)
+		switch {
+		case errors.Is(err, mfa.ErrTooManyAttempts):
+			// The challenge is gone, so log out the Directus session waiting behind it
+			server.logoutChallenge(challenge)
+			ctx.JSON(http.StatusTooManyRequests, ErrorResponse{"Too many failed attempts, please login again"})
+		case err != nil:
+			util.LOGGER.Error("POST /api/auth/login/mfa: failed to record failed attempt", "error", err)
+			ctx.JSON(http.StatusInternalServerError, ErrorResponse{"Internal server error"})
+		default:
+			ctx.JSON(http.StatusUnauthorized, ErrorResponse{"Invalid MFA code"})
+		}
+		return
+	}
+
+	// Second factor verified, claim the challenge so that it can't be used again. Only one of concurrent requests gets it
+	challenge, err = server.mfaManager.ClaimChallenge(ctx, req.Challenge)
+	if errors.Is(err, mfa.ErrChallengeNotFound) {
+		util.LOGGER.Warn("POST /api/auth/login/mfa: challenge already claimed")
+		ctx.JSON(http.StatusUnauthorized, ErrorResponse{"MFA challenge expired, please login again"})
+		return
+	}
+	if err != nil {
+		util.LOGGER.Error("POST /api/auth/login/mfa: failed to claim challenge", "error", err)
+		ctx.JSON(http.StatusInternalServerError, ErrorResponse{"Internal server error"})
+		return
+	}
+
+	_, err = server.sessions.Start(ctx, challenge.UserID, challenge.AccessToken, challenge.RefreshToken, requestDevice(ctx))
+	if err != nil {
+		util.LOGGER.Error("POST /api/auth/login/mfa: failed to start session", "id", challenge.UserID, "error", err)
+	}
+
+	ctx.JSON(http.StatusOK, LoginResponse{
+		ID:           challenge.UserID,
+		AccessToken:  challenge.AccessToken,
+		RefreshToken: challenge.RefreshToken,
+		Expires:      challenge.Expires,
+	})
+}
+
+// Helper method: log out the Directus session of an abandoned challenge
+func (server *Server) logoutChallenge(challenge *mfa.Challenge) {
+	url := fmt.Sprintf("%s/auth/logout", server.config.DirectusAddr)
+	body := map[string]any{"refresh_token": challenge.RefreshToken}
+	if status, err := db.MakeRequest("POST", url, body, server.config.DirectusStaticToken, nil); err != nil {
+		util.LOGGER.Warn("failed to log out session of MFA challenge", "id", challenge.UserID, "status", status, "error", err)
+	}
+}
@@ -1,18 +1,41 @@
 package api
 
 import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
+	"tekticket/db"
+	"tekticket/service/ratelimit"
+	"tekticket/util"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
 )
 
+// Default rate limits (requests per minute), used when the dynamic config doesn't set them
+const (
+	DEFAULT_AUTH_RATE_LIMIT  = 5
+	DEFAULT_EVENT_RATE_LIMIT = 120
+)
+
+// Context key of the ID of the user authenticated by AuthMiddleware
+const AUTH_USER_ID = "auth_user_id"
+
+// How long the user of a verified access token is cached, at most
+const AUTH_TOKEN_CACHE_TTL = time.Minute
+
 // CORS middleware
 func (server *Server) CORSMiddleware() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		ctx.Header("Access-Control-Allow-Origin", "*")
 		ctx.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
 		ctx.Header("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Requested-With")
+		ctx.Header("Access-Control-Expose-Headers", "Retry-After, X-RateLimit-Limit, X-RateLimit-Remaining, X-RateLimit-Reset")
 
 		// Handle preflight and return immediately so Gin doesn't respond 404 for OPTIONS
 		if ctx.Request.Method == http.MethodOptions {
@@ -30,7 +53,143 @@ func (server *Server) AuthMiddleware() gin.HandlerFunc {
 		token := strings.TrimPrefix(ctx.Request.Header.Get("Authorization"), "Bearer ")
 		if token == "" {
 			ctx.AbortWithStatusJSON(http.StatusUnauthorized, ErrorResponse{"Unauthorized access"})
+			return
+		}
+
+		userID, err := server.authenticate(ctx, token)
+		if errors.Is(err, errSessionRevoked) {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, ErrorResponse{"Session revoked, please login again"})
+			return
+		}
+		if err != nil {
+			util.LOGGER.Warn(fmt.Sprintf("%s %s: failed to verify token", ctx.Request.Method, ctx.FullPath()), "error", err)
+			server.DirectusError(ctx, err)
+			ctx.Abort()
+			return
 		}
+		ctx.Set(AUTH_USER_ID, userID)
+
+		ctx.Next()
+	}
+}
+
+var errSessionRevoked = errors.New("session revoked")
+
+// Helper method: authenticate an access token, and return the ID of its user. Return errSessionRevoked if the token has
+// been revoked
+func (server *Server) authenticate(ctx *gin.Context, token string) (string, error) {
+	// Check if the token has been revoked (after a password change, or when its session is revoked from another device).
+	// Directus access tokens stay valid until they expire, so this is the only place where we can reject them
+	revoked, err := server.sessions.IsRevoked(ctx, token)
+	if err != nil {
+		// Malformed token will be rejected by Directus anyway, and if Redis is down, we let the request go through
+		util.LOGGER.Warn(
+			fmt.Sprintf("%s %s: failed to check if token is revoked", ctx.Request.Method, ctx.FullPath()),
+			"error", err,
+		)
+	}
+	if revoked {
+		return "", errSessionRevoked
+	}
+
+	// The user ID keys the rate limits of the user, so it must come from a token verified by Directus
+	return server.verifyToken(ctx, token)
+}
+
+// Helper method: get the ID of the user of an access token from Directus, which verifies the token. The user is cached
+// until the token expires, for AUTH_TOKEN_CACHE_TTL at most
+func (server *Server) verifyToken(ctx *gin.Context, token string) (string, error) {
+	key := fmt.Sprintf("auth:token:%x", sha256.Sum256([]byte(token)))
+	userID, err := server.queries.Cache.Get(ctx, key).Result()
+	if err == nil {
+		return userID, nil
+	}
+	if err != redis.Nil {
+		util.LOGGER.Warn(fmt.Sprintf("%s %s: failed to get cached token", ctx.Request.Method, ctx.FullPath()), "error", err)
+	}
+
+	url := fmt.Sprintf("%s/users/me?fields=id", server.config.DirectusAddr)
+	var user db.User
+	if _, err := db.MakeRequest("GET", url, nil, token, &user); err != nil {
+		return "", err
+	}
+
+	ttl := AUTH_TOKEN_CACHE_TTL
+	if expiresAt, err := util.ExtractExpiresAtFromToken(token); err == nil {
+		ttl = min(ttl, time.Until(expiresAt))
+	}
+	if ttl > 0 {
+		if err := server.queries.Cache.Set(ctx, key, user.ID, ttl).Err(); err != nil {
+			util.LOGGER.Warn(fmt.Sprintf("%s %s: failed to cache token", ctx.Request.Method, ctx.FullPath()), "error", err)
+		}
+	}
+	return user.ID, nil
+}
+
+// Optional authentication middleware, for public routes with personalized extras: a request with a valid token is
+// authenticated like by AuthMiddleware, any other goes through as anonymous. An expired or revoked token is dropped from
+// the request, so that the handlers don't personalize it
+func (server *Server) OptionalAuthMiddleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		token := server.GetToken(ctx)
+		if token == "" {
+			ctx.Next()
+			return
+		}
+
+		userID, err := server.authenticate(ctx, token)
+		if err != nil {
+			util.LOGGER.Info(fmt.Sprintf("%s %s: invalid token, continue as anonymous", ctx.Request.Method, ctx.FullPath()), "error", err)
+			ctx.Request.Header.Del("Authorization")
+			ctx.Next()
+			return
+		}
+		ctx.Set(AUTH_USER_ID, userID)
+
+		ctx.Next()
+	}
+}
+
+// Rate limit middleware: limit the number of requests a client can make to a route group in a sliding window.
+// The client is identified by user ID after AuthMiddleware, or by IP otherwise. `name` separates the buckets of different
+// route groups, so spamming one endpoint doesn't lock the client out of the others.
+func (server *Server) RateLimitMiddleware(name string, rule ratelimit.Rule) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		// Only the users verified by AuthMiddleware are trusted, a forged token must not pick a fresh bucket. The IP is
+		// only read from X-Forwarded-For behind the trusted proxies
+		client := "ip:" + ctx.ClientIP()
+		if userID := ctx.GetString(AUTH_USER_ID); userID != "" {
+			client = "user:" + userID
+		}
+
+		result, err := server.limiter.Allow(ctx, fmt.Sprintf("%s:%s", name, client), rule)
+		if err != nil {
+			// If Redis is down, we'd rather let the request go through than block every client
+			util.LOGGER.Error(
+				fmt.Sprintf("%s %s: failed to check rate limit", ctx.Request.Method, ctx.FullPath()),
+				"client", client,
+				"error", err,
+			)
+			ctx.Next()
+			return
+		}
+
+		ctx.Header("X-RateLimit-Limit", strconv.Itoa(result.Limit))
+		ctx.Header("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		ctx.Header("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(result.ResetAfter).Unix(), 10))
+
+		if !result.Allowed {
+			retryAfter := int(math.Ceil(result.RetryAfter.Seconds()))
+			ctx.Header("Retry-After", strconv.Itoa(max(retryAfter, 1)))
+			util.LOGGER.Warn(
+				fmt.Sprintf("%s %s: rate limit exceeded", ctx.Request.Method, ctx.FullPath()),
+				"client", client,
+				"retry_after", retryAfter,
+			)
+			ctx.AbortWithStatusJSON(http.StatusTooManyRequests, ErrorResponse{"You hit the rate limit"})
+			return
+		}
+
 		ctx.Next()
 	}
 }
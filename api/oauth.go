@@ -0,0 +1,255 @@
+package api
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net/http"
+	neturl "net/url"
+	"strings"
+	"tekticket/db"
+	"tekticket/service/oauth"
+	"tekticket/service/session"
+	"tekticket/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Social login is for customers only
+const OAUTH_ROLE = "customer"
+
+type OAuthAuthorizeResponse struct {
+	AuthorizationURL string `json:"authorization_url"`
+}
+
+// OAuthAuthorize godoc
+// @Summary      Start social login
+// @Description  Starts the OAuth2/OIDC authorization code flow (with PKCE) with the provider, like google. Redirect the user
+// @Description  to the returned URL; the provider then redirects back to the frontend callback page with a code and state,
+// @Description  to send to /api/auth/oauth/callback. The state is valid for 10 minutes and can only be used once
+// @Tags         Auth
+// @Produce      json
+// @Param        provider  path  string  true  "Provider name"
+// @Success      200  {object}  OAuthAuthorizeResponse  "Authorization URL"
+// @Failure      404  {object}  ErrorResponse           "Unknown provider"
+// @Failure      429  {object}  ErrorResponse           "Rate limit exceeded"
+// @Failure      500  {object}  ErrorResponse           "Internal server error"
+// @Router       /api/auth/oauth/{provider} [get]
+func (server *Server) OAuthAuthorize(ctx *gin.Context) {
+	provider := ctx.Param("provider")
+
+	authURL, err := server.oauthManager.AuthorizationURL(ctx, provider)
+	if errors.Is(err, oauth.ErrUnknownProvider) {
+		util.LOGGER.Warn("GET /api/auth/oauth/{provider}: unknown provider", "provider", provider)
+		ctx.JSON(http.StatusNotFound, ErrorResponse{"Unknown provider"})
+		return
+	}
+	if err != nil {
+		util.LOGGER.Error("GET /api/auth/oauth/{provider}: failed to build authorization URL", "provider", provider, "error", err)
+		ctx.JSON(http.StatusInternalServerError, ErrorResponse{"Internal server error"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, OAuthAuthorizeResponse{authURL})
+}
+
+type OAuthCallbackRequest struct {
+	State string `json:"state" binding:"required"`
+	Code  string `json:"code" binding:"required"`
+}
+
+// OAuthCallback godoc
+// @Summary      Complete social login
+// @Description  Exchanges the code returned by the provider for the user identity, then logs the user in. The identity is
+// @Description  linked to the customer account with the same email if the provider verified it, and a new active customer
+// @Description  account is created if there is none.
+// @Tags         Auth
+// @Accept       json
+// @Produce      json
+// @Param        request body OAuthCallbackRequest true "State and code from the provider redirect"
+// @Success      200 {object} LoginResponse "Login successful"
+// @Failure      400 {object} ErrorResponse "Invalid request body | Invalid or expired state | Invalid request data"
+// @Failure      401 {object} ErrorResponse "Failed to authenticate with the provider"
+// @Failure      403 {object} ErrorResponse "Email not verified by the provider | Account is not active | Social login is only available for customers"
+// @Failure      429 {object} ErrorResponse "Rate limit exceeded"
+// @Failure      500 {object} ErrorResponse "Internal server error"
+// @Failure      503 {object} ErrorResponse "Session is being renewed, please retry"
+// @Router       /api/auth/oauth/callback [post]
+func (server *Server) OAuthCallback(ctx *gin.Context) {
+	var req OAuthCallbackRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		util.LOGGER.Warn("POST /api/auth/oauth/callback: failed to bind request body", "error", err)
+		ctx.JSON(http.StatusBadRequest, ErrorResponse{"Invalid request body"})
+		return
+	}
+
+	// Verify the identity with the provider
+	provider, claims, err := server.oauthManager.Complete(ctx, req.State, req.Code)
+	switch {
+	case errors.Is(err, oauth.ErrInvalidState), errors.Is(err, oauth.ErrUnknownProvider):
+		util.LOGGER.Warn("POST /api/auth/oauth/callback: invalid state", "error", err)
+		ctx.JSON(http.StatusBadRequest, ErrorResponse{"Invalid or expired state"})
+		return
+	case errors.Is(err, oauth.ErrExchangeFailed), errors.Is(err, oauth.ErrInvalidIDToken):
+		util.LOGGER.Warn("POST /api/auth/oauth/callback: provider authentication failed", "provider", provider, "error", err)
+		ctx.JSON(http.StatusUnauthorized, ErrorResponse{"Failed to authenticate with the provider"})
+		return
+	case err != nil:
+		util.LOGGER.Error("POST /api/auth/oauth/callback: failed to complete login", "provider", provider, "error", err)
+		ctx.JSON(http.StatusInternalServerError, ErrorResponse{"Internal server error"})
+		return
+	}
+
+	// Find the user linked with this identity
+	fields := "user_id.id,user_id.status,user_id.role.id,user_id.role.name"
+	url := fmt.Sprintf(
+		"%s/items/user_identities?fields=%s&filter[provider][_eq]=%s&filter[subject][_eq]=%s&limit=1",
+		server.config.DirectusAddr,
+		fields,
+		neturl.QueryEscape(provider),
+		neturl.QueryEscape(claims.Subject),
+	)
+	var identities []db.UserIdentity
+	status, err := db.MakeRequest("GET", url, nil, server.config.DirectusStaticToken, &identities)
+	if err != nil {
+		util.LOGGER.Error("POST /api/auth/oauth/callback: failed to get user identity", "status", status, "error", err)
+		server.DirectusError(ctx, err)
+		return
+	}
+
+	var user *db.User
+	if len(identities) != 0 && identities[0].User != nil {
+		user = identities[0].User
+	} else {
+		// First login with this identity: link it by verified email, or create a new account
+		if !claims.EmailVerified || strings.TrimSpace(claims.Email) == "" {
+			util.LOGGER.Warn("POST /api/auth/oauth/callback: email not verified by provider", "provider", provider)
+			ctx.JSON(http.StatusForbidden, ErrorResponse{"Email not verified by the provider"})
+			return
+		}
+
+		if user, status, err = server.findOrCreateOAuthUser(claims); err != nil {
+			util.LOGGER.Error("POST /api/auth/oauth/callback: failed to find or create user", "status", status, "error", err)
+			server.DirectusError(ctx, err)
+			return
+		}
+
+		url = fmt.Sprintf("%s/items/user_identities", server.config.DirectusAddr)
+		body := map[string]any{"user_id": user.ID, "provider": provider, "subject": claims.Subject, "email": claims.Email}
+		if status, err := db.MakeRequest("POST", url, body, server.config.DirectusStaticToken, nil); err != nil {
+			util.LOGGER.Error("POST /api/auth/oauth/callback: failed to link identity", "status", status, "error", err)
+			server.DirectusError(ctx, err)
+			return
+		}
+	}
+
+	if user.Role == nil || !strings.EqualFold(user.Role.Name, OAUTH_ROLE) {
+		util.LOGGER.Warn("POST /api/auth/oauth/callback: user is not a customer", "id", user.ID)
+		ctx.JSON(http.StatusForbidden, ErrorResponse{"Social login is only available for customers"})
+		return
+	}
+
+	// The provider verified the email, so an unverified account doesn't need the OTP anymore. Anyone could have registered
+	// the email without owning it, so the password set at registration is replaced and its sessions are revoked, leaving
+	// the account only to the owner of the email
+	switch user.Status {
+	case "active":
+	case "unverified":
+		url = fmt.Sprintf("%s/users/%s", server.config.DirectusAddr, user.ID)
+		body := map[string]any{"status": "active", "password": rand.Text()}
+		if status, err := db.MakeRequest("PATCH", url, body, server.config.DirectusStaticToken, nil); err != nil {
+			util.LOGGER.Error("POST /api/auth/oauth/callback: failed to activate user", "status", status, "error", err)
+			server.DirectusError(ctx, err)
+			return
+		}
+		if err := server.sessions.RevokeAll(ctx, user.ID); err != nil {
+			util.LOGGER.Error("POST /api/auth/oauth/callback: failed to revoke sessions", "id", user.ID, "error", err)
+			ctx.JSON(http.StatusInternalServerError, ErrorResponse{"Internal server error"})
+			return
+		}
+	default:
+		util.LOGGER.Warn("POST /api/auth/oauth/callback: account is not active", "id", user.ID, "status", user.Status)
+		ctx.JSON(http.StatusForbidden, ErrorResponse{"Account is not active"})
+		return
+	}
+
+	// Directus can't log in a user without password, so the session is issued by us
+	tokens, err := server.sessions.Issue(ctx, user.ID, requestDevice(ctx))
+	if errors.Is(err, session.ErrAccessTokenBusy) {
+		accessTokenBusy(ctx)
+		return
+	}
+	if err != nil {
+		util.LOGGER.Error("POST /api/auth/oauth/callback: failed to issue session", "id", user.ID, "error", err)
+		ctx.JSON(http.StatusInternalServerError, ErrorResponse{"Internal server error"})
+		return
+	}
+	server.scheduleAccessTokenExpiry(ctx, tokens)
+
+	ctx.JSON(http.StatusOK, LoginResponse{
+		ID:           tokens.UserID,
+		AccessToken:  tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		Expires:      tokens.Expires,
+	})
+}
+
+// Helper method: find the customer account with the email of the identity, or create a new one
+func (server *Server) findOrCreateOAuthUser(claims *oauth.Claims) (*db.User, int, error) {
+	email := strings.ToLower(strings.TrimSpace(claims.Email))
+	fields := "id,status,role.id,role.name"
+	url := fmt.Sprintf(
+		"%s/users?fields=%s&filter[email][_eq]=%s&filter[role][name][_icontains]=%s&limit=1",
+		server.config.DirectusAddr,
+		fields,
+		neturl.QueryEscape(email),
+		OAUTH_ROLE,
+	)
+	var users []db.User
+	status, err := db.MakeRequest("GET", url, nil, server.config.DirectusStaticToken, &users)
+	if err != nil {
+		return nil, status, err
+	}
+
+	if len(users) != 0 {
+		return &users[0], status, nil
+	}
+
+	// Get the customer role
+	url = fmt.Sprintf("%s/roles?fields=id,name&filter[name][_icontains]=%s", server.config.DirectusAddr, OAUTH_ROLE)
+	var roles []db.Role
+	status, err = db.MakeRequest("GET", url, nil, server.config.DirectusStaticToken, &roles)
+	if err != nil {
+		return nil, status, err
+	}
+
+	if len(roles) == 0 {
+		return nil, http.StatusInternalServerError, fmt.Errorf("role %s not found", OAUTH_ROLE)
+	}
+
+	// Fallback to the full name, then to the email, if the provider doesn't split the name
+	firstname, lastname := claims.GivenName, claims.FamilyName
+	if firstname == "" && lastname == "" {
+		firstname, lastname, _ = strings.Cut(strings.TrimSpace(claims.Name), " ")
+	}
+	if firstname == "" {
+		firstname, _, _ = strings.Cut(email, "@")
+	}
+
+	// No password: the account can only log in with the provider, until the user sets one with reset password
+	url = fmt.Sprintf("%s/users?fields=%s", server.config.DirectusAddr, fields)
+	body := map[string]any{
+		"first_name": firstname,
+		"last_name":  lastname,
+		"email":      email,
+		"role":       roles[0].ID,
+		"status":     "active",
+	}
+	var user db.User
+	status, err = db.MakeRequest("POST", url, body, server.config.DirectusStaticToken, &user)
+	if err != nil {
+		return nil, status, err
+	}
+
+	return &user, status, nil
+}
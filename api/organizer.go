@@ -0,0 +1,911 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	neturl "net/url"
+	"strings"
+	"tekticket/db"
+	"tekticket/service/worker"
+	"tekticket/util"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hibiken/asynq"
+)
+
+// Only organizers can manage events, and only the ones they created
+const ORGANIZER_ROLE = "organizer"
+
+// Status of events and their seat zones, tickets and selling schedules
+const (
+	EVENT_STATUS_DRAFT     = "draft"
+	EVENT_STATUS_PUBLISHED = "published"
+	EVENT_STATUS_CANCELED  = "canceled"
+)
+
+// Helper method: check that the requester is an organizer. Return the organizer ID, or write the error response and return
+// false. The user is fetched with the requester token, so that Directus verifies it
+func (server *Server) requireOrganizer(ctx *gin.Context) (string, bool) {
+	caller := fmt.Sprintf("%s %s", ctx.Request.Method, ctx.FullPath())
+
+	var user db.User
+	url := fmt.Sprintf("%s/users/me?fields=id,role.name", server.config.DirectusAddr)
+	status, err := db.MakeRequest("GET", url, nil, server.GetToken(ctx), &user)
+	if err != nil {
+		util.LOGGER.Error(caller+": failed to get user", "status", status, "error", err)
+		server.DirectusError(ctx, err)
+		return "", false
+	}
+
+	if user.Role == nil || !strings.EqualFold(strings.TrimSpace(user.Role.Name), ORGANIZER_ROLE) {
+		util.LOGGER.Warn(caller+": requester is not an organizer", "id", user.ID)
+		ctx.JSON(http.StatusForbidden, ErrorResponse{"You don't have permission to perform this request"})
+		return "", false
+	}
+
+	return user.ID, true
+}
+
+// Helper method: get the event of the path parameter, with the given fields, and check that the organizer created it.
+// Write the error response and return false otherwise
+func (server *Server) getOrganizerEvent(ctx *gin.Context, organizerID string, fields ...string) (*db.Event, bool) {
+	caller := fmt.Sprintf("%s %s", ctx.Request.Method, ctx.FullPath())
+
+	fields = append(fields, "id", "status", "creator_id.id")
+	url := fmt.Sprintf(
+		"%s/items/events/%s?fields=%s",
+		server.config.DirectusAddr,
+		neturl.PathEscape(ctx.Param("id")),
+		strings.Join(fields, ","),
+	)
+	var event db.Event
+	status, err := db.MakeRequest("GET", url, nil, server.config.DirectusStaticToken, &event)
+	if err != nil {
+		util.LOGGER.Error(caller+": failed to get event", "status", status, "error", err)
+		server.DirectusError(ctx, err)
+		return nil, false
+	}
+
+	if event.Creator == nil || event.Creator.ID != organizerID {
+		util.LOGGER.Warn(caller+": event not created by requester", "id", organizerID, "event", event.ID)
+		ctx.JSON(http.StatusForbidden, ErrorResponse{"You don't have permission to perform this request"})
+		return nil, false
+	}
+
+	return &event, true
+}
+
+// Helper method: check that an item of a collection belongs to the event, using the filter that leads from the item to the
+// event (for example "filter[event_id][_eq]"). Write the error response and return false otherwise
+func (server *Server) checkEventItem(ctx *gin.Context, collection, itemID, eventFilter, eventID string) bool {
+	caller := fmt.Sprintf("%s %s", ctx.Request.Method, ctx.FullPath())
+
+	queryParams := neturl.Values{}
+	queryParams.Add("fields", "id")
+	queryParams.Add("filter[id][_eq]", itemID)
+	queryParams.Add(eventFilter, eventID)
+	queryParams.Add("limit", "1")
+
+	var items []map[string]any
+	url := fmt.Sprintf("%s/items/%s?%s", server.config.DirectusAddr, collection, queryParams.Encode())
+	status, err := db.MakeRequest("GET", url, nil, server.config.DirectusStaticToken, &items)
+	if err != nil {
+		util.LOGGER.Error(caller+": failed to get event item", "collection", collection, "status", status, "error", err)
+		server.DirectusError(ctx, err)
+		return false
+	}
+
+	if len(items) == 0 {
+		util.LOGGER.Warn(caller+": item not found in event", "collection", collection, "id", itemID, "event", eventID)
+		ctx.JSON(http.StatusNotFound, ErrorResponse{"No item with such ID"})
+		return false
+	}
+
+	return true
+}
+
+// Helper method: check that the event has no booking yet, since its schedules, seat zones and tickets are referenced by
+// the bookings. Write the error response and return false otherwise
+func (server *Server) checkEventWithoutBookings(ctx *gin.Context, eventID string) bool {
+	caller := fmt.Sprintf("%s %s", ctx.Request.Method, ctx.FullPath())
+
+	var bookings []db.Booking
+	url := fmt.Sprintf("%s/items/bookings?fields=id&filter[event_id][_eq]=%s&limit=1", server.config.DirectusAddr, eventID)
+	status, err := db.MakeRequest("GET", url, nil, server.config.DirectusStaticToken, &bookings)
+	if err != nil {
+		util.LOGGER.Error(caller+": failed to get bookings of event", "status", status, "error", err)
+		server.DirectusError(ctx, err)
+		return false
+	}
+
+	if len(bookings) != 0 {
+		util.LOGGER.Warn(caller+": event already has bookings", "event", eventID)
+		ctx.JSON(http.StatusConflict, ErrorResponse{"Event already has bookings"})
+		return false
+	}
+
+	return true
+}
+
+// Helper method: write the violations of the event policy to client
+func (server *Server) eventPolicyError(ctx *gin.Context, message string, violations map[string][]string) {
+	util.LOGGER.Warn(
+		fmt.Sprintf("%s %s: request does not satisfy event policy", ctx.Request.Method, ctx.FullPath()),
+		"violations", len(violations),
+	)
+	ctx.JSON(http.StatusBadRequest, ValidationErrorResponse{Message: message, Fields: violations})
+}
+
+// Helper method: generate a unique slug for the event name. eventID is the event being renamed, empty for a new event
+func (server *Server) generateEventSlug(name, eventID string) (string, int, error) {
+	slug := util.Slugify(name)
+	if slug == "" {
+		slug = "event"
+	}
+
+	queryParams := neturl.Values{}
+	queryParams.Add("fields", "id")
+	queryParams.Add("filter[slug][_eq]", slug)
+	queryParams.Add("limit", "1")
+	if eventID != "" {
+		queryParams.Add("filter[id][_neq]", eventID)
+	}
+
+	var events []db.Event
+	url := fmt.Sprintf("%s/items/events?%s", server.config.DirectusAddr, queryParams.Encode())
+	status, err := db.MakeRequest("GET", url, nil, server.config.DirectusStaticToken, &events)
+	if err != nil {
+		return "", status, err
+	}
+
+	// Another event already has this slug: add a random suffix, it's unlikely that 2 events get the same
+	if len(events) != 0 {
+		slug = fmt.Sprintf("%s-%s", slug, strings.ToLower(util.RandomString(6)))
+	}
+
+	return slug, status, nil
+}
+
+// Helper method: check that the category exists and is published. Write the error response and return false otherwise
+func (server *Server) checkCategory(ctx *gin.Context, categoryID string) bool {
+	caller := fmt.Sprintf("%s %s", ctx.Request.Method, ctx.FullPath())
+
+	var categories []db.Category
+	url := fmt.Sprintf(
+		"%s/items/categories?fields=id&filter[id][_eq]=%s&filter[status][_eq]=%s&limit=1",
+		server.config.DirectusAddr,
+		neturl.QueryEscape(categoryID),
+		EVENT_STATUS_PUBLISHED,
+	)
+	status, err := db.MakeRequest("GET", url, nil, server.config.DirectusStaticToken, &categories)
+	if err != nil {
+		util.LOGGER.Error(caller+": failed to get category", "status", status, "error", err)
+		server.DirectusError(ctx, err)
+		return false
+	}
+
+	if len(categories) == 0 {
+		util.LOGGER.Warn(caller+": invalid category", "category", categoryID)
+		ctx.JSON(http.StatusBadRequest, ErrorResponse{"Invalid category"})
+		return false
+	}
+
+	return true
+}
+
+// Helper function: format a time for Directus, or nil for zero time
+func directusTime(t *time.Time) any {
+	if t == nil || t.IsZero() {
+		return nil
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+type EventRequest struct {
+	Name        string   `json:"name" binding:"required"`
+	Description string   `json:"description"`
+	Address     string   `json:"address" binding:"required"`
+	City        string   `json:"city" binding:"required"`
+	Country     string   `json:"country" binding:"required"`
+	Latitude    *float64 `json:"latitude" binding:"omitempty,min=-90,max=90"`
+	Longitude   *float64 `json:"longitude" binding:"omitempty,min=-180,max=180"`
+	CategoryID  string   `json:"category_id" binding:"required"`
+}
+
+// ListOrganizerEvents godoc
+// @Summary      List organizer events
+// @Description  Returns the events created by the current organizer, with every status (draft and published)
+// @Tags         Organizer
+// @Produce      json
+// @Param        limit   query  int     false  "Limit number of results (default: 50, max: 100)"
+// @Param        cursor  query  string  false  "Cursor of the next page, from the previous page"
+// @Param        sort    query  string  false  "Sort order: -date_created (default), date_created, name or -name"
+// @Success      200  {object}  Page[db.Event]           "List of events"
+// @Failure      400  {object}  ValidationErrorResponse  "Invalid pagination parameters"
+// @Failure      401  {object}  ErrorResponse  "Unauthorized access | Token expired"
+// @Failure      403  {object}  ErrorResponse  "Invalid token | You don't have permission to perform this request"
+// @Failure      429  {object}  ErrorResponse  "You hit the rate limit"
+// @Failure      500  {object}  ErrorResponse  "Internal server error"
+// @Security     BearerAuth
+// @Router       /api/organizer/events [get]
+func (server *Server) ListOrganizerEvents(ctx *gin.Context) {
+	organizerID, ok := server.requireOrganizer(ctx)
+	if !ok {
+		return
+	}
+
+	queryParams := neturl.Values{}
+	fields := []string{
+		"id", "name", "slug", "status", "address", "city", "country", "preview_image",
+		"event_schedules.id", "event_schedules.start_time", "event_schedules.end_time",
+		"category_id.id", "category_id.name",
+	}
+	queryParams.Add("fields", strings.Join(fields, ","))
+	queryParams.Add("filter[creator_id][_eq]", organizerID)
+
+	pagination, ok := server.parsePagination(ctx, "-date_created", "-date_created", "date_created", "name", "-name")
+	if !ok {
+		return
+	}
+
+	url := fmt.Sprintf("%s/items/events", server.config.DirectusAddr)
+	page, status, err := listPage[db.Event](url, queryParams, pagination, server.config.DirectusStaticToken)
+	if err != nil {
+		util.LOGGER.Error("GET /api/organizer/events: failed to get events", "status", status, "error", err)
+		server.DirectusError(ctx, err)
+		return
+	}
+
+	for i := range page.Data {
+		if page.Data[i].PreviewImage != "" {
+			page.Data[i].PreviewImage = util.CreateImageLink(server.config.ServerDomain, page.Data[i].PreviewImage)
+		}
+	}
+
+	ctx.JSON(http.StatusOK, page)
+}
+
+// GetOrganizerEvent godoc
+// @Summary      Get organizer event
+// @Description  Returns an event created by the current organizer, with all its schedules, seat zones, tickets and
+// @Description  selling schedules, whatever their status
+// @Tags         Organizer
+// @Produce      json
+// @Param        id   path      string  true  "Event ID"
+// @Success      200  {object}  db.Event       "Event details"
+// @Failure      401  {object}  ErrorResponse  "Unauthorized access | Token expired"
+// @Failure      403  {object}  ErrorResponse  "Invalid token | You don't have permission to perform this request"
+// @Failure      404  {object}  ErrorResponse  "No item with such ID"
+// @Failure      429  {object}  ErrorResponse  "You hit the rate limit"
+// @Failure      500  {object}  ErrorResponse  "Internal server error"
+// @Security     BearerAuth
+// @Router       /api/organizer/events/{id} [get]
+func (server *Server) GetOrganizerEvent(ctx *gin.Context) {
+	organizerID, ok := server.requireOrganizer(ctx)
+	if !ok {
+		return
+	}
+
+	event, ok := server.getOrganizerEvent(
+		ctx,
+		organizerID,
+		"name", "description", "address", "city", "country", "latitude", "longitude", "slug", "preview_image",
+		"event_schedules.id", "event_schedules.start_time", "event_schedules.end_time",
+		"event_schedules.start_checkin_time", "event_schedules.end_checkin_time",
+		"seat_zones.id", "seat_zones.description", "seat_zones.total_seats", "seat_zones.status",
+		"seat_zones.seats.id", "seat_zones.seats.seat_number", "seat_zones.seats.status",
+		"seat_zones.seats.row", "seat_zones.seats.x", "seat_zones.seats.y",
+		"tickets.id", "tickets.rank", "tickets.description", "tickets.base_price", "tickets.status", "tickets.seat_zone_id.id",
+		"tickets.ticket_selling_schedules.id", "tickets.ticket_selling_schedules.total",
+		"tickets.ticket_selling_schedules.available", "tickets.ticket_selling_schedules.start_selling_time",
+		"tickets.ticket_selling_schedules.end_selling_time", "tickets.ticket_selling_schedules.status",
+		"category_id.id", "category_id.name",
+	)
+	if !ok {
+		return
+	}
+
+	if event.PreviewImage != "" {
+		event.PreviewImage = util.CreateImageLink(server.config.ServerDomain, event.PreviewImage)
+	}
+
+	ctx.JSON(http.StatusOK, event)
+}
+
+// CreateEvent godoc
+// @Summary      Create event
+// @Description  Creates a draft event for the current organizer. The slug is generated from the name. Add schedules, seat
+// @Description  zones and tickets, then publish it
+// @Tags         Organizer
+// @Accept       json
+// @Produce      json
+// @Param        request  body  EventRequest  true  "Event information"
+// @Success      201  {object}  db.Event       "Event created"
+// @Failure      400  {object}  ErrorResponse  "Invalid request body | Invalid category"
+// @Failure      401  {object}  ErrorResponse  "Unauthorized access | Token expired"
+// @Failure      403  {object}  ErrorResponse  "Invalid token | You don't have permission to perform this request"
+// @Failure      429  {object}  ErrorResponse  "You hit the rate limit"
+// @Failure      500  {object}  ErrorResponse  "Internal server error"
+// @Security     BearerAuth
+// @Router       /api/organizer/events [post]
+func (server *Server) CreateEvent(ctx *gin.Context) {
+	var req EventRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		util.LOGGER.Warn("POST /api/organizer/events: failed to bind request body", "error", err)
+		ctx.JSON(http.StatusBadRequest, ErrorResponse{"Invalid request body"})
+		return
+	}
+
+	organizerID, ok := server.requireOrganizer(ctx)
+	if !ok {
+		return
+	}
+
+	if !server.checkCategory(ctx, req.CategoryID) {
+		return
+	}
+
+	slug, status, err := server.generateEventSlug(req.Name, "")
+	if err != nil {
+		util.LOGGER.Error("POST /api/organizer/events: failed to generate slug", "status", status, "error", err)
+		server.DirectusError(ctx, err)
+		return
+	}
+
+	url := fmt.Sprintf("%s/items/events?fields=id,name,slug,status", server.config.DirectusAddr)
+	body := map[string]any{
+		"name":        strings.TrimSpace(req.Name),
+		"description": req.Description,
+		"address":     req.Address,
+		"city":        req.City,
+		"country":     req.Country,
+		"latitude":    req.Latitude,
+		"longitude":   req.Longitude,
+		"category_id": req.CategoryID,
+		"creator_id":  organizerID,
+		"slug":        slug,
+		"status":      EVENT_STATUS_DRAFT,
+	}
+	var event db.Event
+	status, err = db.MakeRequest("POST", url, body, server.config.DirectusStaticToken, &event)
+	if err != nil {
+		util.LOGGER.Error("POST /api/organizer/events: failed to create event", "status", status, "error", err)
+		server.DirectusError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, event)
+}
+
+// UpdateEvent godoc
+// @Summary      Update event
+// @Description  Updates the information of an event created by the current organizer. The slug follows the name while the
+// @Description  event is a draft, and is kept once published so that shared links keep working
+// @Tags         Organizer
+// @Accept       json
+// @Produce      json
+// @Param        id       path  string        true  "Event ID"
+// @Param        request  body  EventRequest  true  "Event information"
+// @Success      200  {object}  db.Event       "Event updated"
+// @Failure      400  {object}  ErrorResponse  "Invalid request body | Invalid category"
+// @Failure      401  {object}  ErrorResponse  "Unauthorized access | Token expired"
+// @Failure      403  {object}  ErrorResponse  "Invalid token | You don't have permission to perform this request"
+// @Failure      404  {object}  ErrorResponse  "No item with such ID"
+// @Failure      429  {object}  ErrorResponse  "You hit the rate limit"
+// @Failure      500  {object}  ErrorResponse  "Internal server error"
+// @Security     BearerAuth
+// @Router       /api/organizer/events/{id} [put]
+func (server *Server) UpdateEvent(ctx *gin.Context) {
+	var req EventRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		util.LOGGER.Warn("PUT /api/organizer/events/:id: failed to bind request body", "error", err)
+		ctx.JSON(http.StatusBadRequest, ErrorResponse{"Invalid request body"})
+		return
+	}
+
+	organizerID, ok := server.requireOrganizer(ctx)
+	if !ok {
+		return
+	}
+
+	event, ok := server.getOrganizerEvent(ctx, organizerID, "name")
+	if !ok {
+		return
+	}
+
+	if !server.checkCategory(ctx, req.CategoryID) {
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	body := map[string]any{
+		"name":        name,
+		"description": req.Description,
+		"address":     req.Address,
+		"city":        req.City,
+		"country":     req.Country,
+		"latitude":    req.Latitude,
+		"longitude":   req.Longitude,
+		"category_id": req.CategoryID,
+	}
+
+	if event.Status == EVENT_STATUS_DRAFT && name != event.Name {
+		slug, status, err := server.generateEventSlug(req.Name, event.ID)
+		if err != nil {
+			util.LOGGER.Error("PUT /api/organizer/events/:id: failed to generate slug", "status", status, "error", err)
+			server.DirectusError(ctx, err)
+			return
+		}
+		body["slug"] = slug
+	}
+
+	url := fmt.Sprintf("%s/items/events/%s?fields=id,name,slug,status", server.config.DirectusAddr, event.ID)
+	var result db.Event
+	status, err := db.MakeRequest("PATCH", url, body, server.config.DirectusStaticToken, &result)
+	if err != nil {
+		util.LOGGER.Error("PUT /api/organizer/events/:id: failed to update event", "status", status, "error", err)
+		server.DirectusError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, result)
+}
+
+// PublishEvent godoc
+// @Summary      Publish event
+// @Description  Publishes an event created by the current organizer, so that customers can see it and book tickets. The
+// @Description  event needs at least one schedule, and one published ticket with a selling schedule
+// @Tags         Organizer
+// @Produce      json
+// @Param        id   path      string  true  "Event ID"
+// @Success      200  {object}  SuccessMessage           "Event published"
+// @Failure      400  {object}  ValidationErrorResponse  "Event is not ready to be published"
+// @Failure      401  {object}  ErrorResponse            "Unauthorized access | Token expired"
+// @Failure      403  {object}  ErrorResponse            "Invalid token | You don't have permission to perform this request"
+// @Failure      404  {object}  ErrorResponse            "No item with such ID"
+// @Failure      409  {object}  ErrorResponse            "Event is canceled"
+// @Failure      429  {object}  ErrorResponse            "You hit the rate limit"
+// @Failure      500  {object}  ErrorResponse            "Internal server error"
+// @Security     BearerAuth
+// @Router       /api/organizer/events/{id}/publish [post]
+func (server *Server) PublishEvent(ctx *gin.Context) {
+	organizerID, ok := server.requireOrganizer(ctx)
+	if !ok {
+		return
+	}
+
+	event, ok := server.getOrganizerEvent(
+		ctx,
+		organizerID,
+		"event_schedules.id", "tickets.status", "tickets.ticket_selling_schedules.status",
+	)
+	if !ok {
+		return
+	}
+
+	if event.Status == EVENT_STATUS_CANCELED {
+		ctx.JSON(http.StatusConflict, ErrorResponse{"Event is canceled"})
+		return
+	}
+
+	// Check that customers will be able to book something
+	violations := map[string][]string{}
+	if len(event.EventSchedules) == 0 {
+		violations["event_schedules"] = []string{"at least one schedule is required"}
+	}
+
+	sellable := false
+	for _, ticket := range event.Tickets {
+		if ticket.Status != EVENT_STATUS_PUBLISHED {
+			continue
+		}
+		for _, schedule := range ticket.TicketSellingSchedules {
+			sellable = sellable || schedule.Status == EVENT_STATUS_PUBLISHED
+		}
+	}
+	if !sellable {
+		violations["tickets"] = []string{"at least one published ticket with a published selling schedule is required"}
+	}
+
+	if len(violations) != 0 {
+		server.eventPolicyError(ctx, "Event is not ready to be published", violations)
+		return
+	}
+
+	url := fmt.Sprintf("%s/items/events/%s", server.config.DirectusAddr, event.ID)
+	body := map[string]any{"status": EVENT_STATUS_PUBLISHED}
+	if status, err := db.MakeRequest("PATCH", url, body, server.config.DirectusStaticToken, nil); err != nil {
+		util.LOGGER.Error("POST /api/organizer/events/:id/publish: failed to publish event", "status", status, "error", err)
+		server.DirectusError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, SuccessMessage{"Event published"})
+}
+
+// UnpublishEvent godoc
+// @Summary      Unpublish event
+// @Description  Moves an event created by the current organizer back to draft, hiding it from customers. An event that
+// @Description  already has bookings can't be unpublished
+// @Tags         Organizer
+// @Produce      json
+// @Param        id   path      string  true  "Event ID"
+// @Success      200  {object}  SuccessMessage  "Event unpublished"
+// @Failure      401  {object}  ErrorResponse   "Unauthorized access | Token expired"
+// @Failure      403  {object}  ErrorResponse   "Invalid token | You don't have permission to perform this request"
+// @Failure      404  {object}  ErrorResponse   "No item with such ID"
+// @Failure      409  {object}  ErrorResponse   "Event already has bookings | Event is canceled"
+// @Failure      429  {object}  ErrorResponse   "You hit the rate limit"
+// @Failure      500  {object}  ErrorResponse   "Internal server error"
+// @Security     BearerAuth
+// @Router       /api/organizer/events/{id}/unpublish [post]
+func (server *Server) UnpublishEvent(ctx *gin.Context) {
+	organizerID, ok := server.requireOrganizer(ctx)
+	if !ok {
+		return
+	}
+
+	event, ok := server.getOrganizerEvent(ctx, organizerID)
+	if !ok {
+		return
+	}
+
+	if event.Status == EVENT_STATUS_CANCELED {
+		ctx.JSON(http.StatusConflict, ErrorResponse{"Event is canceled"})
+		return
+	}
+
+	// Customers who booked must still see the event
+	if !server.checkEventWithoutBookings(ctx, event.ID) {
+		return
+	}
+
+	url := fmt.Sprintf("%s/items/events/%s", server.config.DirectusAddr, event.ID)
+	body := map[string]any{"status": EVENT_STATUS_DRAFT}
+	if status, err := db.MakeRequest("PATCH", url, body, server.config.DirectusStaticToken, nil); err != nil {
+		util.LOGGER.Error("POST /api/organizer/events/:id/unpublish: failed to unpublish event", "status", status, "error", err)
+		server.DirectusError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, SuccessMessage{"Event unpublished"})
+}
+
+type CancelEventRequest struct {
+	Reason string `json:"reason" binding:"required"` // Shown to the attendees
+}
+
+// CancelEvent godoc
+// @Summary      Cancel event
+// @Description  Cancels an event created by the current organizer. Every successful payment of the event is refunded in
+// @Description  full in the background, in batches, its tickets are invalidated and its customer is notified through every
+// @Description  channel. The holders of transferred tickets are notified too. Follow the progress with the cancellation report
+// @Tags         Organizer
+// @Accept       json
+// @Produce      json
+// @Param        id       path    string              true  "Event ID"
+// @Param        request  body    CancelEventRequest  true  "Cancellation reason"
+// @Success      202  {object}  SuccessMessage  "Event canceled, refunds in progress"
+// @Failure      400  {object}  ErrorResponse   "Invalid request body"
+// @Failure      401  {object}  ErrorResponse   "Unauthorized access | Token expired"
+// @Failure      403  {object}  ErrorResponse   "Invalid token | You don't have permission to perform this request"
+// @Failure      404  {object}  ErrorResponse   "No item with such ID"
+// @Failure      409  {object}  ErrorResponse   "Event already canceled"
+// @Failure      429  {object}  ErrorResponse   "You hit the rate limit"
+// @Failure      500  {object}  ErrorResponse   "Internal server error"
+// @Security     BearerAuth
+// @Router       /api/organizer/events/{id}/cancel [post]
+func (server *Server) CancelEvent(ctx *gin.Context) {
+	organizerID, ok := server.requireOrganizer(ctx)
+	if !ok {
+		return
+	}
+
+	var req CancelEventRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		util.LOGGER.Warn("POST /api/organizer/events/:id/cancel: failed to bind request body", "error", err)
+		ctx.JSON(http.StatusBadRequest, ErrorResponse{"Invalid request body"})
+		return
+	}
+
+	event, ok := server.getOrganizerEvent(ctx, organizerID)
+	if !ok {
+		return
+	}
+
+	if event.Status == EVENT_STATUS_CANCELED {
+		ctx.JSON(http.StatusConflict, ErrorResponse{"Event already canceled"})
+		return
+	}
+
+	url := fmt.Sprintf("%s/items/events/%s", server.config.DirectusAddr, event.ID)
+	body := map[string]any{"status": EVENT_STATUS_CANCELED}
+	if status, err := db.MakeRequest("PATCH", url, body, server.config.DirectusStaticToken, nil); err != nil {
+		util.LOGGER.Error("POST /api/organizer/events/:id/cancel: failed to cancel event", "status", status, "error", err)
+		server.DirectusError(ctx, err)
+		return
+	}
+
+	err := server.distributor.DistributeTask(
+		ctx,
+		worker.CancelEvent,
+		worker.CancelEventPayload{EventID: event.ID, Reason: strings.TrimSpace(req.Reason)},
+		asynq.Queue(worker.HIGH_IMPACT),
+		asynq.MaxRetry(10),
+	)
+	if err != nil {
+		// The event is canceled anyway, the refunds have to be started manually
+		util.LOGGER.Error(
+			"POST /api/organizer/events/:id/cancel: failed to distribute background task",
+			"task", worker.CancelEvent,
+			"event_id", event.ID,
+			"error", err,
+		)
+		ctx.JSON(http.StatusInternalServerError, ErrorResponse{"Internal server error"})
+		return
+	}
+
+	ctx.JSON(http.StatusAccepted, SuccessMessage{"Event canceled, refunds in progress"})
+}
+
+// GetEventCancellation godoc
+// @Summary      Get event cancellation report
+// @Description  Gets the progress of the cancellation of an event created by the current organizer: the refunded and failed
+// @Description  payments, and the refunded amount against the paid amount. The payments in failures must be refunded
+// @Description  manually. The report is kept for 30 days
+// @Tags         Organizer
+// @Produce      json
+// @Param        id   path      string  true  "Event ID"
+// @Success      200  {object}  worker.EventCancellation  "Cancellation report"
+// @Failure      401  {object}  ErrorResponse             "Unauthorized access | Token expired"
+// @Failure      403  {object}  ErrorResponse             "Invalid token | You don't have permission to perform this request"
+// @Failure      404  {object}  ErrorResponse             "No item with such ID | Event is not canceled"
+// @Failure      429  {object}  ErrorResponse             "You hit the rate limit"
+// @Failure      500  {object}  ErrorResponse             "Internal server error"
+// @Security     BearerAuth
+// @Router       /api/organizer/events/{id}/cancel [get]
+func (server *Server) GetEventCancellation(ctx *gin.Context) {
+	organizerID, ok := server.requireOrganizer(ctx)
+	if !ok {
+		return
+	}
+
+	event, ok := server.getOrganizerEvent(ctx, organizerID)
+	if !ok {
+		return
+	}
+
+	cancellation, err := worker.GetEventCancellation(ctx, server.queries.Cache, event.ID)
+	if err != nil {
+		util.LOGGER.Error("GET /api/organizer/events/:id/cancel: failed to get cancellation report", "error", err)
+		ctx.JSON(http.StatusInternalServerError, ErrorResponse{"Internal server error"})
+		return
+	}
+	if cancellation == nil {
+		ctx.JSON(http.StatusNotFound, ErrorResponse{"Event is not canceled"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, cancellation)
+}
+
+type EventScheduleRequest struct {
+	StartTime        time.Time  `json:"start_time" binding:"required"`
+	EndTime          time.Time  `json:"end_time" binding:"required"`
+	StartCheckinTime *time.Time `json:"start_checkin_time"`
+	EndCheckinTime   *time.Time `json:"end_checkin_time"`
+}
+
+// Helper method: validate a schedule request against the event policy. Write the error response and return false if invalid
+func (server *Server) validateEventSchedule(ctx *gin.Context, req EventScheduleRequest) bool {
+	var startCheckin, endCheckin time.Time
+	if req.StartCheckinTime != nil {
+		startCheckin = *req.StartCheckinTime
+	}
+	if req.EndCheckinTime != nil {
+		endCheckin = *req.EndCheckinTime
+	}
+
+	policy := util.NewEventPolicy(server.config.Setting)
+	violations := policy.ValidateSchedule(req.StartTime, req.EndTime, startCheckin, endCheckin, time.Now())
+	if len(violations) != 0 {
+		server.eventPolicyError(ctx, "Schedule does not meet the requirements", violations)
+		return false
+	}
+
+	return true
+}
+
+// Helper function: the Directus body of a schedule request
+func eventScheduleBody(req EventScheduleRequest) map[string]any {
+	return map[string]any{
+		"start_time":         directusTime(&req.StartTime),
+		"end_time":           directusTime(&req.EndTime),
+		"start_checkin_time": directusTime(req.StartCheckinTime),
+		"end_checkin_time":   directusTime(req.EndCheckinTime),
+	}
+}
+
+// CreateEventSchedule godoc
+// @Summary      Add event schedule
+// @Description  Adds a schedule (one occurrence of the event) to an event created by the current organizer. The schedule
+// @Description  must start at least MinEventLeadDays days from now, and last at least MinEventDurationMinutes minutes
+// @Tags         Organizer
+// @Accept       json
+// @Produce      json
+// @Param        id       path  string                true  "Event ID"
+// @Param        request  body  EventScheduleRequest  true  "Schedule"
+// @Success      201  {object}  db.EventSchedule         "Schedule created"
+// @Failure      400  {object}  ValidationErrorResponse  "Invalid request body | Schedule does not meet the requirements"
+// @Failure      401  {object}  ErrorResponse            "Unauthorized access | Token expired"
+// @Failure      403  {object}  ErrorResponse            "Invalid token | You don't have permission to perform this request"
+// @Failure      404  {object}  ErrorResponse            "No item with such ID"
+// @Failure      429  {object}  ErrorResponse            "You hit the rate limit"
+// @Failure      500  {object}  ErrorResponse            "Internal server error"
+// @Security     BearerAuth
+// @Router       /api/organizer/events/{id}/schedules [post]
+func (server *Server) CreateEventSchedule(ctx *gin.Context) {
+	var req EventScheduleRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		util.LOGGER.Warn("POST /api/organizer/events/:id/schedules: failed to bind request body", "error", err)
+		ctx.JSON(http.StatusBadRequest, ErrorResponse{"Invalid request body"})
+		return
+	}
+
+	organizerID, ok := server.requireOrganizer(ctx)
+	if !ok {
+		return
+	}
+
+	event, ok := server.getOrganizerEvent(ctx, organizerID)
+	if !ok {
+		return
+	}
+
+	if !server.validateEventSchedule(ctx, req) {
+		return
+	}
+
+	url := fmt.Sprintf("%s/items/event_schedules", server.config.DirectusAddr)
+	body := eventScheduleBody(req)
+	body["event_id"] = event.ID
+	var schedule db.EventSchedule
+	status, err := db.MakeRequest("POST", url, body, server.config.DirectusStaticToken, &schedule)
+	if err != nil {
+		util.LOGGER.Error("POST /api/organizer/events/:id/schedules: failed to create schedule", "status", status, "error", err)
+		server.DirectusError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, schedule)
+}
+
+// UpdateEventSchedule godoc
+// @Summary      Update event schedule
+// @Description  Updates a schedule of an event created by the current organizer. The schedule is validated like a new one.
+// @Description  The wallet passes of the tickets of the schedule are updated in the background
+// @Tags         Organizer
+// @Accept       json
+// @Produce      json
+// @Param        id          path  string                true  "Event ID"
+// @Param        scheduleID  path  string                true  "Schedule ID"
+// @Param        request     body  EventScheduleRequest  true  "Schedule"
+// @Success      200  {object}  db.EventSchedule         "Schedule updated"
+// @Failure      400  {object}  ValidationErrorResponse  "Invalid request body | Schedule does not meet the requirements"
+// @Failure      401  {object}  ErrorResponse            "Unauthorized access | Token expired"
+// @Failure      403  {object}  ErrorResponse            "Invalid token | You don't have permission to perform this request"
+// @Failure      404  {object}  ErrorResponse            "No item with such ID"
+// @Failure      429  {object}  ErrorResponse            "You hit the rate limit"
+// @Failure      500  {object}  ErrorResponse            "Internal server error"
+// @Security     BearerAuth
+// @Router       /api/organizer/events/{id}/schedules/{scheduleID} [put]
+func (server *Server) UpdateEventSchedule(ctx *gin.Context) {
+	var req EventScheduleRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		util.LOGGER.Warn("PUT /api/organizer/events/:id/schedules/:scheduleID: failed to bind request body", "error", err)
+		ctx.JSON(http.StatusBadRequest, ErrorResponse{"Invalid request body"})
+		return
+	}
+
+	organizerID, ok := server.requireOrganizer(ctx)
+	if !ok {
+		return
+	}
+
+	event, ok := server.getOrganizerEvent(ctx, organizerID)
+	if !ok {
+		return
+	}
+
+	scheduleID := ctx.Param("scheduleID")
+	if !server.checkEventItem(ctx, "event_schedules", scheduleID, "filter[event_id][_eq]", event.ID) {
+		return
+	}
+
+	if !server.validateEventSchedule(ctx, req) {
+		return
+	}
+
+	url := fmt.Sprintf("%s/items/event_schedules/%s", server.config.DirectusAddr, scheduleID)
+	var schedule db.EventSchedule
+	status, err := db.MakeRequest("PATCH", url, eventScheduleBody(req), server.config.DirectusStaticToken, &schedule)
+	if err != nil {
+		util.LOGGER.Error("PUT /api/organizer/events/:id/schedules/:scheduleID: failed to update schedule", "status", status, "error", err)
+		server.DirectusError(ctx, err)
+		return
+	}
+
+	// Update the wallet passes of the tickets of the schedule. The schedule is already updated, so this must not fail the request
+	err = server.distributor.DistributeTask(
+		ctx,
+		worker.UpdateWalletPasses,
+		worker.UpdateWalletPassesPayload{ScheduleID: scheduleID},
+		asynq.Queue(worker.MEDIUM_IMPACT),
+		asynq.MaxRetry(5),
+	)
+	if err != nil {
+		util.LOGGER.Error(
+			"PUT /api/organizer/events/:id/schedules/:scheduleID: failed to distribute background task",
+			"task", worker.UpdateWalletPasses,
+			"error", err,
+		)
+	}
+
+	ctx.JSON(http.StatusOK, schedule)
+}
+
+// DeleteEventSchedule godoc
+// @Summary      Delete event schedule
+// @Description  Deletes a schedule of an event created by the current organizer. Not allowed once the event has bookings
+// @Tags         Organizer
+// @Produce      json
+// @Param        id          path  string  true  "Event ID"
+// @Param        scheduleID  path  string  true  "Schedule ID"
+// @Success      200  {object}  SuccessMessage  "Schedule deleted"
+// @Failure      401  {object}  ErrorResponse   "Unauthorized access | Token expired"
+// @Failure      403  {object}  ErrorResponse   "Invalid token | You don't have permission to perform this request"
+// @Failure      404  {object}  ErrorResponse   "No item with such ID"
+// @Failure      409  {object}  ErrorResponse   "Event already has bookings | Event is canceled"
+// @Failure      429  {object}  ErrorResponse   "You hit the rate limit"
+// @Failure      500  {object}  ErrorResponse   "Internal server error"
+// @Security     BearerAuth
+// @Router       /api/organizer/events/{id}/schedules/{scheduleID} [delete]
+func (server *Server) DeleteEventSchedule(ctx *gin.Context) {
+	server.deleteEventItem(ctx, "event_schedules", ctx.Param("scheduleID"), "filter[event_id][_eq]", "Schedule deleted")
+}
+
+// Helper method: delete an item of an event created by the requester, if the event has no booking yet
+func (server *Server) deleteEventItem(ctx *gin.Context, collection, itemID, eventFilter, message string) {
+	organizerID, ok := server.requireOrganizer(ctx)
+	if !ok {
+		return
+	}
+
+	event, ok := server.getOrganizerEvent(ctx, organizerID)
+	if !ok {
+		return
+	}
+
+	if !server.checkEventItem(ctx, collection, itemID, eventFilter, event.ID) {
+		return
+	}
+
+	if !server.checkEventWithoutBookings(ctx, event.ID) {
+		return
+	}
+
+	url := fmt.Sprintf("%s/items/%s/%s", server.config.DirectusAddr, collection, itemID)
+	if status, err := db.MakeRequest("DELETE", url, nil, server.config.DirectusStaticToken, nil); err != nil {
+		util.LOGGER.Error(
+			fmt.Sprintf("%s %s: failed to delete item", ctx.Request.Method, ctx.FullPath()),
+			"collection", collection,
+			"status", status,
+			"error", err,
+		)
+		server.DirectusError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, SuccessMessage{message})
+}
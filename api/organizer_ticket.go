@@ -0,0 +1,605 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	neturl "net/url"
+	"tekticket/db"
+	"tekticket/util"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SeatZoneRequest struct {
+	Description string `json:"description" binding:"required"`
+	TotalSeats  int    `json:"total_seats" binding:"required,min=1"`
+	Status      string `json:"status" binding:"omitempty,oneof=draft published"` // Default: published
+}
+
+type TicketRequest struct {
+	Rank        string `json:"rank" binding:"required"`
+	Description string `json:"description"`
+	BasePrice   int    `json:"base_price" binding:"min=0"`
+	SeatZoneID  string `json:"seat_zone_id"`
+	Status      string `json:"status" binding:"omitempty,oneof=draft published"` // Default: published
+}
+
+type CreateTicketRequest struct {
+	TicketRequest
+	SellingSchedules []SellingScheduleRequest `json:"selling_schedules" binding:"dive"`
+}
+
+type SellingScheduleRequest struct {
+	Total            int       `json:"total" binding:"required,min=1"`
+	StartSellingTime time.Time `json:"start_selling_time" binding:"required"`
+	EndSellingTime   time.Time `json:"end_selling_time" binding:"required"`
+	Status           string    `json:"status" binding:"omitempty,oneof=draft published"` // Default: published
+}
+
+// Helper function: the status of a new item, published unless asked otherwise. The item is only visible to customers once
+// its event is published anyway
+func itemStatus(status string) string {
+	if status == "" {
+		return EVENT_STATUS_PUBLISHED
+	}
+	return status
+}
+
+// Helper function: the end of the last schedule of the event, zero if it has no schedule
+func lastScheduleEnd(event *db.Event) time.Time {
+	var end time.Time
+	for _, schedule := range event.EventSchedules {
+		if schedule.EndTime != nil && time.Time(*schedule.EndTime).After(end) {
+			end = time.Time(*schedule.EndTime)
+		}
+	}
+	return end
+}
+
+// Helper method: validate selling schedules against the event policy. Write the error response and return false if invalid
+func (server *Server) validateSellingSchedules(ctx *gin.Context, event *db.Event, schedules ...SellingScheduleRequest) bool {
+	policy := util.NewEventPolicy(server.config.Setting)
+	eventEnd := lastScheduleEnd(event)
+
+	for i, schedule := range schedules {
+		violations := policy.ValidateSellingSchedule(schedule.StartSellingTime, schedule.EndSellingTime, eventEnd, schedule.Total)
+		if len(violations) == 0 {
+			continue
+		}
+
+		// Prefix the fields with the index, when there are several schedules
+		if len(schedules) > 1 {
+			prefixed := map[string][]string{}
+			for field, messages := range violations {
+				prefixed[fmt.Sprintf("selling_schedules[%d].%s", i, field)] = messages
+			}
+			violations = prefixed
+		}
+
+		server.eventPolicyError(ctx, "Selling schedule does not meet the requirements", violations)
+		return false
+	}
+
+	return true
+}
+
+// Helper method: check that the seat zone of a ticket, if any, belongs to the event
+func (server *Server) checkTicketSeatZone(ctx *gin.Context, req TicketRequest, eventID string) bool {
+	if req.SeatZoneID == "" {
+		return true
+	}
+	return server.checkEventItem(ctx, "seat_zones", req.SeatZoneID, "filter[event_id][_eq]", eventID)
+}
+
+// Helper function: the Directus body of a ticket request
+func ticketBody(req TicketRequest) map[string]any {
+	body := map[string]any{
+		"rank":         req.Rank,
+		"description":  req.Description,
+		"base_price":   req.BasePrice,
+		"status":       itemStatus(req.Status),
+		"seat_zone_id": nil,
+	}
+	if req.SeatZoneID != "" {
+		body["seat_zone_id"] = req.SeatZoneID
+	}
+	return body
+}
+
+// CreateSeatZone godoc
+// @Summary      Add seat zone
+// @Description  Adds a seat zone to an event created by the current organizer
+// @Tags         Organizer
+// @Accept       json
+// @Produce      json
+// @Param        id       path  string           true  "Event ID"
+// @Param        request  body  SeatZoneRequest  true  "Seat zone"
+// @Success      201  {object}  db.SeatZone    "Seat zone created"
+// @Failure      400  {object}  ErrorResponse  "Invalid request body"
+// @Failure      401  {object}  ErrorResponse  "Unauthorized access | Token expired"
+// @Failure      403  {object}  ErrorResponse  "Invalid token | You don't have permission to perform this request"
+// @Failure      404  {object}  ErrorResponse  "No item with such ID"
+// @Failure      429  {object}  ErrorResponse  "You hit the rate limit"
+// @Failure      500  {object}  ErrorResponse  "Internal server error"
+// @Security     BearerAuth
+// @Router       /api/organizer/events/{id}/seat-zones [post]
+func (server *Server) CreateSeatZone(ctx *gin.Context) {
+	var req SeatZoneRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		util.LOGGER.Warn("POST /api/organizer/events/:id/seat-zones: failed to bind request body", "error", err)
+		ctx.JSON(http.StatusBadRequest, ErrorResponse{"Invalid request body"})
+		return
+	}
+
+	organizerID, ok := server.requireOrganizer(ctx)
+	if !ok {
+		return
+	}
+
+	event, ok := server.getOrganizerEvent(ctx, organizerID)
+	if !ok {
+		return
+	}
+
+	url := fmt.Sprintf("%s/items/seat_zones", server.config.DirectusAddr)
+	body := map[string]any{
+		"description": req.Description,
+		"total_seats": req.TotalSeats,
+		"status":      itemStatus(req.Status),
+		"event_id":    event.ID,
+	}
+	var zone db.SeatZone
+	status, err := db.MakeRequest("POST", url, body, server.config.DirectusStaticToken, &zone)
+	if err != nil {
+		util.LOGGER.Error("POST /api/organizer/events/:id/seat-zones: failed to create seat zone", "status", status, "error", err)
+		server.DirectusError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, zone)
+}
+
+// UpdateSeatZone godoc
+// @Summary      Update seat zone
+// @Description  Updates a seat zone of an event created by the current organizer. Once a seat map is imported, the total seats must match it
+// @Tags         Organizer
+// @Accept       json
+// @Produce      json
+// @Param        id       path  string           true  "Event ID"
+// @Param        zoneID   path  string           true  "Seat zone ID"
+// @Param        request  body  SeatZoneRequest  true  "Seat zone"
+// @Success      200  {object}  db.SeatZone    "Seat zone updated"
+// @Failure      400  {object}  ErrorResponse  "Invalid request body | Total seats must match the seat map"
+// @Failure      401  {object}  ErrorResponse  "Unauthorized access | Token expired"
+// @Failure      403  {object}  ErrorResponse  "Invalid token | You don't have permission to perform this request"
+// @Failure      404  {object}  ErrorResponse  "No item with such ID"
+// @Failure      429  {object}  ErrorResponse  "You hit the rate limit"
+// @Failure      500  {object}  ErrorResponse  "Internal server error"
+// @Security     BearerAuth
+// @Router       /api/organizer/events/{id}/seat-zones/{zoneID} [put]
+func (server *Server) UpdateSeatZone(ctx *gin.Context) {
+	var req SeatZoneRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		util.LOGGER.Warn("PUT /api/organizer/events/:id/seat-zones/:zoneID: failed to bind request body", "error", err)
+		ctx.JSON(http.StatusBadRequest, ErrorResponse{"Invalid request body"})
+		return
+	}
+
+	organizerID, ok := server.requireOrganizer(ctx)
+	if !ok {
+		return
+	}
+
+	event, ok := server.getOrganizerEvent(ctx, organizerID)
+	if !ok {
+		return
+	}
+
+	zoneID := ctx.Param("zoneID")
+	if !server.checkEventItem(ctx, "seat_zones", zoneID, "filter[event_id][_eq]", event.ID) {
+		return
+	}
+
+	// Once a seat map is imported, the total seats follow it
+	seatCount, status, err := server.countZoneSeats(zoneID)
+	if err != nil {
+		util.LOGGER.Error("PUT /api/organizer/events/:id/seat-zones/:zoneID: failed to count seats", "status", status, "error", err)
+		server.DirectusError(ctx, err)
+		return
+	}
+	if seatCount > 0 && req.TotalSeats != seatCount {
+		ctx.JSON(http.StatusBadRequest, ErrorResponse{fmt.Sprintf("Total seats must match the %d seats of the seat map", seatCount)})
+		return
+	}
+
+	url := fmt.Sprintf("%s/items/seat_zones/%s", server.config.DirectusAddr, zoneID)
+	body := map[string]any{
+		"description": req.Description,
+		"total_seats": req.TotalSeats,
+		"status":      itemStatus(req.Status),
+	}
+	var zone db.SeatZone
+	status, err = db.MakeRequest("PATCH", url, body, server.config.DirectusStaticToken, &zone)
+	if err != nil {
+		util.LOGGER.Error("PUT /api/organizer/events/:id/seat-zones/:zoneID: failed to update seat zone", "status", status, "error", err)
+		server.DirectusError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, zone)
+}
+
+// DeleteSeatZone godoc
+// @Summary      Delete seat zone
+// @Description  Deletes a seat zone of an event created by the current organizer. Not allowed once the event has bookings
+// @Tags         Organizer
+// @Produce      json
+// @Param        id      path  string  true  "Event ID"
+// @Param        zoneID  path  string  true  "Seat zone ID"
+// @Success      200  {object}  SuccessMessage  "Seat zone deleted"
+// @Failure      401  {object}  ErrorResponse   "Unauthorized access | Token expired"
+// @Failure      403  {object}  ErrorResponse   "Invalid token | You don't have permission to perform this request"
+// @Failure      404  {object}  ErrorResponse   "No item with such ID"
+// @Failure      409  {object}  ErrorResponse   "Event already has bookings"
+// @Failure      429  {object}  ErrorResponse   "You hit the rate limit"
+// @Failure      500  {object}  ErrorResponse   "Internal server error"
+// @Security     BearerAuth
+// @Router       /api/organizer/events/{id}/seat-zones/{zoneID} [delete]
+func (server *Server) DeleteSeatZone(ctx *gin.Context) {
+	server.deleteEventItem(ctx, "seat_zones", ctx.Param("zoneID"), "filter[event_id][_eq]", "Seat zone deleted")
+}
+
+// CreateTicket godoc
+// @Summary      Add ticket
+// @Description  Adds a ticket type to an event created by the current organizer, with its selling schedules. Each selling
+// @Description  schedule must last at least MinSellingDurationMinutes minutes, and end before the last event schedule ends
+// @Tags         Organizer
+// @Accept       json
+// @Produce      json
+// @Param        id       path  string               true  "Event ID"
+// @Param        request  body  CreateTicketRequest  true  "Ticket"
+// @Success      201  {object}  db.Ticket                "Ticket created"
+// @Failure      400  {object}  ValidationErrorResponse  "Invalid request body | Selling schedule does not meet the requirements"
+// @Failure      401  {object}  ErrorResponse            "Unauthorized access | Token expired"
+// @Failure      403  {object}  ErrorResponse            "Invalid token | You don't have permission to perform this request"
+// @Failure      404  {object}  ErrorResponse            "No item with such ID"
+// @Failure      429  {object}  ErrorResponse            "You hit the rate limit"
+// @Failure      500  {object}  ErrorResponse            "Internal server error"
+// @Security     BearerAuth
+// @Router       /api/organizer/events/{id}/tickets [post]
+func (server *Server) CreateTicket(ctx *gin.Context) {
+	var req CreateTicketRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		util.LOGGER.Warn("POST /api/organizer/events/:id/tickets: failed to bind request body", "error", err)
+		ctx.JSON(http.StatusBadRequest, ErrorResponse{"Invalid request body"})
+		return
+	}
+
+	organizerID, ok := server.requireOrganizer(ctx)
+	if !ok {
+		return
+	}
+
+	event, ok := server.getOrganizerEvent(ctx, organizerID, "event_schedules.end_time")
+	if !ok {
+		return
+	}
+
+	if !server.checkTicketSeatZone(ctx, req.TicketRequest, event.ID) {
+		return
+	}
+
+	if !server.validateSellingSchedules(ctx, event, req.SellingSchedules...) {
+		return
+	}
+
+	// The selling schedules are created with the ticket, in the same request
+	schedules := make([]map[string]any, 0, len(req.SellingSchedules))
+	for _, schedule := range req.SellingSchedules {
+		schedules = append(schedules, map[string]any{
+			"total":              schedule.Total,
+			"available":          schedule.Total,
+			"start_selling_time": directusTime(&schedule.StartSellingTime),
+			"end_selling_time":   directusTime(&schedule.EndSellingTime),
+			"status":             itemStatus(schedule.Status),
+		})
+	}
+
+	url := fmt.Sprintf(
+		"%s/items/tickets?fields=*,ticket_selling_schedules.*",
+		server.config.DirectusAddr,
+	)
+	body := ticketBody(req.TicketRequest)
+	body["event_id"] = event.ID
+	body["ticket_selling_schedules"] = schedules
+	var ticket db.Ticket
+	status, err := db.MakeRequest("POST", url, body, server.config.DirectusStaticToken, &ticket)
+	if err != nil {
+		util.LOGGER.Error("POST /api/organizer/events/:id/tickets: failed to create ticket", "status", status, "error", err)
+		server.DirectusError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, ticket)
+}
+
+// UpdateTicket godoc
+// @Summary      Update ticket
+// @Description  Updates a ticket type of an event created by the current organizer. Its selling schedules are managed with
+// @Description  the selling schedule endpoints
+// @Tags         Organizer
+// @Accept       json
+// @Produce      json
+// @Param        id        path  string         true  "Event ID"
+// @Param        ticketID  path  string         true  "Ticket ID"
+// @Param        request   body  TicketRequest  true  "Ticket"
+// @Success      200  {object}  db.Ticket      "Ticket updated"
+// @Failure      400  {object}  ErrorResponse  "Invalid request body"
+// @Failure      401  {object}  ErrorResponse  "Unauthorized access | Token expired"
+// @Failure      403  {object}  ErrorResponse  "Invalid token | You don't have permission to perform this request"
+// @Failure      404  {object}  ErrorResponse  "No item with such ID"
+// @Failure      429  {object}  ErrorResponse  "You hit the rate limit"
+// @Failure      500  {object}  ErrorResponse  "Internal server error"
+// @Security     BearerAuth
+// @Router       /api/organizer/events/{id}/tickets/{ticketID} [put]
+func (server *Server) UpdateTicket(ctx *gin.Context) {
+	var req TicketRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		util.LOGGER.Warn("PUT /api/organizer/events/:id/tickets/:ticketID: failed to bind request body", "error", err)
+		ctx.JSON(http.StatusBadRequest, ErrorResponse{"Invalid request body"})
+		return
+	}
+
+	organizerID, ok := server.requireOrganizer(ctx)
+	if !ok {
+		return
+	}
+
+	event, ok := server.getOrganizerEvent(ctx, organizerID)
+	if !ok {
+		return
+	}
+
+	ticketID := ctx.Param("ticketID")
+	if !server.checkEventItem(ctx, "tickets", ticketID, "filter[event_id][_eq]", event.ID) {
+		return
+	}
+
+	if !server.checkTicketSeatZone(ctx, req, event.ID) {
+		return
+	}
+
+	url := fmt.Sprintf("%s/items/tickets/%s", server.config.DirectusAddr, ticketID)
+	var ticket db.Ticket
+	status, err := db.MakeRequest("PATCH", url, ticketBody(req), server.config.DirectusStaticToken, &ticket)
+	if err != nil {
+		util.LOGGER.Error("PUT /api/organizer/events/:id/tickets/:ticketID: failed to update ticket", "status", status, "error", err)
+		server.DirectusError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, ticket)
+}
+
+// DeleteTicket godoc
+// @Summary      Delete ticket
+// @Description  Deletes a ticket type of an event created by the current organizer. Not allowed once the event has bookings
+// @Tags         Organizer
+// @Produce      json
+// @Param        id        path  string  true  "Event ID"
+// @Param        ticketID  path  string  true  "Ticket ID"
+// @Success      200  {object}  SuccessMessage  "Ticket deleted"
+// @Failure      401  {object}  ErrorResponse   "Unauthorized access | Token expired"
+// @Failure      403  {object}  ErrorResponse   "Invalid token | You don't have permission to perform this request"
+// @Failure      404  {object}  ErrorResponse   "No item with such ID"
+// @Failure      409  {object}  ErrorResponse   "Event already has bookings"
+// @Failure      429  {object}  ErrorResponse   "You hit the rate limit"
+// @Failure      500  {object}  ErrorResponse   "Internal server error"
+// @Security     BearerAuth
+// @Router       /api/organizer/events/{id}/tickets/{ticketID} [delete]
+func (server *Server) DeleteTicket(ctx *gin.Context) {
+	server.deleteEventItem(ctx, "tickets", ctx.Param("ticketID"), "filter[event_id][_eq]", "Ticket deleted")
+}
+
+// CreateSellingSchedule godoc
+// @Summary      Add ticket selling schedule
+// @Description  Adds a selling schedule to a ticket of an event created by the current organizer
+// @Tags         Organizer
+// @Accept       json
+// @Produce      json
+// @Param        id        path  string                  true  "Event ID"
+// @Param        ticketID  path  string                  true  "Ticket ID"
+// @Param        request   body  SellingScheduleRequest  true  "Selling schedule"
+// @Success      201  {object}  db.TicketSellingSchedule  "Selling schedule created"
+// @Failure      400  {object}  ValidationErrorResponse   "Invalid request body | Selling schedule does not meet the requirements"
+// @Failure      401  {object}  ErrorResponse             "Unauthorized access | Token expired"
+// @Failure      403  {object}  ErrorResponse             "Invalid token | You don't have permission to perform this request"
+// @Failure      404  {object}  ErrorResponse             "No item with such ID"
+// @Failure      429  {object}  ErrorResponse             "You hit the rate limit"
+// @Failure      500  {object}  ErrorResponse             "Internal server error"
+// @Security     BearerAuth
+// @Router       /api/organizer/events/{id}/tickets/{ticketID}/selling-schedules [post]
+func (server *Server) CreateSellingSchedule(ctx *gin.Context) {
+	var req SellingScheduleRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		util.LOGGER.Warn("POST /api/organizer/events/:id/tickets/:ticketID/selling-schedules: failed to bind request body", "error", err)
+		ctx.JSON(http.StatusBadRequest, ErrorResponse{"Invalid request body"})
+		return
+	}
+
+	organizerID, ok := server.requireOrganizer(ctx)
+	if !ok {
+		return
+	}
+
+	event, ok := server.getOrganizerEvent(ctx, organizerID, "event_schedules.end_time")
+	if !ok {
+		return
+	}
+
+	ticketID := ctx.Param("ticketID")
+	if !server.checkEventItem(ctx, "tickets", ticketID, "filter[event_id][_eq]", event.ID) {
+		return
+	}
+
+	if !server.validateSellingSchedules(ctx, event, req) {
+		return
+	}
+
+	url := fmt.Sprintf("%s/items/ticket_selling_schedules", server.config.DirectusAddr)
+	body := map[string]any{
+		"total":              req.Total,
+		"available":          req.Total,
+		"start_selling_time": directusTime(&req.StartSellingTime),
+		"end_selling_time":   directusTime(&req.EndSellingTime),
+		"status":             itemStatus(req.Status),
+		"ticket_id":          ticketID,
+	}
+	var schedule db.TicketSellingSchedule
+	status, err := db.MakeRequest("POST", url, body, server.config.DirectusStaticToken, &schedule)
+	if err != nil {
+		util.LOGGER.Error(
+			"POST /api/organizer/events/:id/tickets/:ticketID/selling-schedules: failed to create selling schedule",
+			"status", status,
+			"error", err,
+		)
+		server.DirectusError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, schedule)
+}
+
+// UpdateSellingSchedule godoc
+// @Summary      Update ticket selling schedule
+// @Description  Updates a selling schedule of a ticket of an event created by the current organizer. Changing the total
+// @Description  changes the available tickets by the same amount, and the total can't go below the tickets already sold
+// @Tags         Organizer
+// @Accept       json
+// @Produce      json
+// @Param        id          path  string                  true  "Event ID"
+// @Param        ticketID    path  string                  true  "Ticket ID"
+// @Param        scheduleID  path  string                  true  "Selling schedule ID"
+// @Param        request     body  SellingScheduleRequest  true  "Selling schedule"
+// @Success      200  {object}  db.TicketSellingSchedule  "Selling schedule updated"
+// @Failure      400  {object}  ValidationErrorResponse   "Invalid request body | Selling schedule does not meet the requirements"
+// @Failure      401  {object}  ErrorResponse             "Unauthorized access | Token expired"
+// @Failure      403  {object}  ErrorResponse             "Invalid token | You don't have permission to perform this request"
+// @Failure      404  {object}  ErrorResponse             "No item with such ID"
+// @Failure      409  {object}  ErrorResponse             "Total is lower than the tickets already sold"
+// @Failure      429  {object}  ErrorResponse             "You hit the rate limit"
+// @Failure      500  {object}  ErrorResponse             "Internal server error"
+// @Security     BearerAuth
+// @Router       /api/organizer/events/{id}/tickets/{ticketID}/selling-schedules/{scheduleID} [put]
+func (server *Server) UpdateSellingSchedule(ctx *gin.Context) {
+	var req SellingScheduleRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		util.LOGGER.Warn("PUT /api/organizer/events/:id/tickets/:ticketID/selling-schedules/:scheduleID: failed to bind request body", "error", err)
+		ctx.JSON(http.StatusBadRequest, ErrorResponse{"Invalid request body"})
+		return
+	}
+
+	organizerID, ok := server.requireOrganizer(ctx)
+	if !ok {
+		return
+	}
+
+	event, ok := server.getOrganizerEvent(ctx, organizerID, "event_schedules.end_time")
+	if !ok {
+		return
+	}
+
+	ticketID, scheduleID := ctx.Param("ticketID"), ctx.Param("scheduleID")
+	if !server.checkEventItem(ctx, "tickets", ticketID, "filter[event_id][_eq]", event.ID) {
+		return
+	}
+
+	if !server.validateSellingSchedules(ctx, event, req) {
+		return
+	}
+
+	// Get the current total, to know how many tickets have been sold
+	url := fmt.Sprintf(
+		"%s/items/ticket_selling_schedules?fields=id,total,available&filter[id][_eq]=%s&filter[ticket_id][_eq]=%s&limit=1",
+		server.config.DirectusAddr,
+		neturl.QueryEscape(scheduleID),
+		neturl.QueryEscape(ticketID),
+	)
+	var schedules []db.TicketSellingSchedule
+	status, err := db.MakeRequest("GET", url, nil, server.config.DirectusStaticToken, &schedules)
+	if err != nil {
+		util.LOGGER.Error(
+			"PUT /api/organizer/events/:id/tickets/:ticketID/selling-schedules/:scheduleID: failed to get selling schedule",
+			"status", status,
+			"error", err,
+		)
+		server.DirectusError(ctx, err)
+		return
+	}
+
+	if len(schedules) == 0 {
+		ctx.JSON(http.StatusNotFound, ErrorResponse{"No item with such ID"})
+		return
+	}
+
+	available := schedules[0].Avaible + req.Total - schedules[0].Total
+	if available < 0 {
+		util.LOGGER.Warn(
+			"PUT /api/organizer/events/:id/tickets/:ticketID/selling-schedules/:scheduleID: total lower than sold tickets",
+			"schedule", scheduleID,
+		)
+		ctx.JSON(http.StatusConflict, ErrorResponse{"Total is lower than the tickets already sold"})
+		return
+	}
+
+	url = fmt.Sprintf("%s/items/ticket_selling_schedules/%s", server.config.DirectusAddr, scheduleID)
+	body := map[string]any{
+		"total":              req.Total,
+		"available":          available,
+		"start_selling_time": directusTime(&req.StartSellingTime),
+		"end_selling_time":   directusTime(&req.EndSellingTime),
+		"status":             itemStatus(req.Status),
+	}
+	var schedule db.TicketSellingSchedule
+	status, err = db.MakeRequest("PATCH", url, body, server.config.DirectusStaticToken, &schedule)
+	if err != nil {
+		util.LOGGER.Error(
+			"PUT /api/organizer/events/:id/tickets/:ticketID/selling-schedules/:scheduleID: failed to update selling schedule",
+			"status", status,
+			"error", err,
+		)
+		server.DirectusError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, schedule)
+}
+
+// DeleteSellingSchedule godoc
+// @Summary      Delete ticket selling schedule
+// @Description  Deletes a selling schedule of a ticket of an event created by the current organizer. Not allowed once the
+// @Description  event has bookings
+// @Tags         Organizer
+// @Produce      json
+// @Param        id          path  string  true  "Event ID"
+// @Param        ticketID    path  string  true  "Ticket ID"
+// @Param        scheduleID  path  string  true  "Selling schedule ID"
+// @Success      200  {object}  SuccessMessage  "Selling schedule deleted"
+// @Failure      401  {object}  ErrorResponse   "Unauthorized access | Token expired"
+// @Failure      403  {object}  ErrorResponse   "Invalid token | You don't have permission to perform this request"
+// @Failure      404  {object}  ErrorResponse   "No item with such ID"
+// @Failure      409  {object}  ErrorResponse   "Event already has bookings"
+// @Failure      429  {object}  ErrorResponse   "You hit the rate limit"
+// @Failure      500  {object}  ErrorResponse   "Internal server error"
+// @Security     BearerAuth
+// @Router       /api/organizer/events/{id}/tickets/{ticketID}/selling-schedules/{scheduleID} [delete]
+func (server *Server) DeleteSellingSchedule(ctx *gin.Context) {
+	server.deleteEventItem(
+		ctx,
+		"ticket_selling_schedules",
+		ctx.Param("scheduleID"),
+		"filter[ticket_id][event_id][_eq]",
+		"Selling schedule deleted",
+	)
+}
@@ -0,0 +1,234 @@
+package api
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	neturl "net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"tekticket/db"
+	"tekticket/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+/*
+ * Cursor-based pagination of the list endpoints. A page is requested with limit, sort and the cursor returned by the
+ * previous page, and returned in a {data, next_cursor, total} envelope.
+ * Directus pages by keyset: the items after the cursor are (field > value) OR (field = value AND id > ID), sorted by the
+ * field then the ID, so the sort fields must not be null. The cursor filter is added as filter[_and][0], so list handlers
+ * add their own filter[_and] groups from index 1.
+ */
+
+// Default and maximum number of items in a page
+const (
+	DEFAULT_PAGE_SIZE = 50
+	MAX_PAGE_SIZE     = 100
+)
+
+// Page of a list
+type Page[T any] struct {
+	Data       []T    `json:"data"`
+	NextCursor string `json:"next_cursor"` // Cursor of the next page, empty on the last page
+	Total      int    `json:"total"`       // Number of items in the whole list
+}
+
+// Pagination of a list request
+type Pagination struct {
+	Limit  int
+	Sort   string       // A field, with a - prefix for descending
+	Cursor *util.Cursor // Position after the previous page, nil on the first page
+}
+
+// Helper method: parse the limit, sort and cursor query parameters. The sort must be one of the sortable orders, and the
+// limit is capped to MAX_PAGE_SIZE. If invalid, return the error to client and false
+func (server *Server) parsePagination(ctx *gin.Context, defaultSort string, sortable ...string) (Pagination, bool) {
+	caller := fmt.Sprintf("%s %s", ctx.Request.Method, ctx.FullPath())
+	pagination := Pagination{Limit: DEFAULT_PAGE_SIZE, Sort: defaultSort}
+
+	if val, err := strconv.Atoi(ctx.Query("limit")); err == nil && val > 0 {
+		pagination.Limit = min(val, MAX_PAGE_SIZE)
+	}
+
+	if sort := ctx.Query("sort"); sort != "" {
+		if !slices.Contains(sortable, sort) {
+			util.LOGGER.Warn(caller+": invalid sort", "sort", sort)
+			ctx.JSON(http.StatusBadRequest, ValidationErrorResponse{
+				Message: "Invalid pagination parameters",
+				Fields:  map[string][]string{"sort": {"must be one of " + strings.Join(sortable, ", ")}},
+			})
+			return pagination, false
+		}
+		pagination.Sort = sort
+	}
+
+	if encoded := ctx.Query("cursor"); encoded != "" {
+		cursor, err := util.DecodeCursor(encoded, pagination.Sort)
+		if err != nil {
+			util.LOGGER.Warn(caller+": invalid cursor", "error", err)
+			ctx.JSON(http.StatusBadRequest, ValidationErrorResponse{
+				Message: "Invalid pagination parameters",
+				Fields:  map[string][]string{"cursor": {"must be the next_cursor of the previous page, with the same sort"}},
+			})
+			return pagination, false
+		}
+		pagination.Cursor = &cursor
+	}
+
+	return pagination, true
+}
+
+// Sort field, and whether the order is descending
+func (pagination Pagination) field() (string, bool) {
+	field, desc := strings.CutPrefix(pagination.Sort, "-")
+	return field, desc
+}
+
+// Add the sort, limit, filter count and cursor filter of the page to a Directus query. One more item than the limit is
+// requested, to know whether there is a next page
+func (pagination Pagination) apply(queryParams neturl.Values) {
+	field, desc := pagination.field()
+
+	// The cursor is built from the sort field and the ID of the last item
+	if fields := queryParams.Get("fields"); fields != "" {
+		for _, required := range []string{"id", field} {
+			if !slices.Contains(strings.Split(fields, ","), required) {
+				fields += "," + required
+			}
+		}
+		queryParams.Set("fields", fields)
+	}
+
+	if desc {
+		queryParams.Set("sort", fmt.Sprintf("-%s,-id", field))
+	} else {
+		queryParams.Set("sort", fmt.Sprintf("%s,id", field))
+	}
+	queryParams.Set("limit", strconv.Itoa(pagination.Limit+1))
+	queryParams.Set("meta", "filter_count")
+
+	if pagination.Cursor != nil {
+		operator := "_gt"
+		if desc {
+			operator = "_lt"
+		}
+		queryParams.Add(fmt.Sprintf("filter[_and][0][_or][0][%s][%s]", field, operator), pagination.Cursor.Value)
+		queryParams.Add(fmt.Sprintf("filter[_and][0][_or][1][%s][_eq]", field), pagination.Cursor.Value)
+		queryParams.Add(fmt.Sprintf("filter[_and][0][_or][1][id][%s]", operator), pagination.Cursor.ID)
+	}
+}
+
+// Get the items of a page from Directus, and the number of items in the whole list. The filter count of a page after
+// the first one excludes the items before the cursor, so the whole list is counted by another request
+func (pagination Pagination) fetch(url string, queryParams neturl.Values, token string) ([]json.RawMessage, int, int, error) {
+	counted := maps.Clone(queryParams)
+	pagination.apply(queryParams)
+
+	var items []json.RawMessage
+	meta, status, err := db.MakeListRequest(fmt.Sprintf("%s?%s", url, queryParams.Encode()), token, &items)
+	if err != nil || pagination.Cursor == nil {
+		return items, meta.FilterCount, status, err
+	}
+
+	counted.Set("fields", "id")
+	counted.Set("limit", "1")
+	counted.Set("meta", "filter_count")
+	meta, status, err = db.MakeListRequest(fmt.Sprintf("%s?%s", url, counted.Encode()), token, &[]json.RawMessage{})
+	return items, meta.FilterCount, status, err
+}
+
+// Cut the items returned by Directus to the page, and build the cursor of the next page
+func (pagination Pagination) page(items []json.RawMessage) ([]json.RawMessage, string, error) {
+	if len(items) <= pagination.Limit {
+		return items, "", nil
+	}
+
+	items = items[:pagination.Limit]
+	var last map[string]json.RawMessage
+	if err := json.Unmarshal(items[len(items)-1], &last); err != nil {
+		return nil, "", err
+	}
+
+	field, _ := pagination.field()
+	value, err := cursorValue(last[field])
+	if err != nil {
+		return nil, "", fmt.Errorf("sort field %s: %w", field, err)
+	}
+	id, err := cursorValue(last["id"])
+	if err != nil {
+		return nil, "", fmt.Errorf("id: %w", err)
+	}
+
+	next := util.EncodeCursor(util.Cursor{Sort: pagination.Sort, Value: value, ID: id})
+	return items, next, nil
+}
+
+// Helper function: the value of a field in a cursor, a string or a number
+func cursorValue(raw json.RawMessage) (string, error) {
+	var value any
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return "", err
+	}
+
+	switch value := value.(type) {
+	case string:
+		return value, nil
+	case float64:
+		return string(raw), nil
+	default:
+		return "", fmt.Errorf("cannot page by %s", raw)
+	}
+}
+
+// Helper function: get a page of items from Directus. The URL is the list URL without query, the query parameters are
+// completed with the pagination
+func listPage[T any](url string, queryParams neturl.Values, pagination Pagination, token string) (Page[T], int, error) {
+	items, total, status, err := pagination.fetch(url, queryParams, token)
+	if err != nil {
+		return Page[T]{}, status, err
+	}
+
+	items, next, err := pagination.page(items)
+	if err != nil {
+		return Page[T]{}, http.StatusInternalServerError, err
+	}
+
+	page := Page[T]{Data: make([]T, len(items)), NextCursor: next, Total: total}
+	for i, item := range items {
+		if err := json.Unmarshal(item, &page.Data[i]); err != nil {
+			return Page[T]{}, http.StatusInternalServerError, err
+		}
+	}
+	return page, status, nil
+}
+
+// Helper function: get a page of a list held in memory rather than in Directus, sorted by the order of the pagination then
+// by ID. The key of an item is its sort value and its ID, the sort values must compare as strings
+func memoryPage[T any](items []T, pagination Pagination, key func(T) (string, string)) Page[T] {
+	_, desc := pagination.field()
+	page := Page[T]{Data: []T{}, Total: len(items)}
+	for _, item := range items {
+		if pagination.Cursor != nil {
+			value, id := key(item)
+			order := cmp.Or(strings.Compare(value, pagination.Cursor.Value), strings.Compare(id, pagination.Cursor.ID))
+			if desc {
+				order = -order
+			}
+			if order <= 0 {
+				continue
+			}
+		}
+
+		if len(page.Data) == pagination.Limit {
+			value, id := key(page.Data[len(page.Data)-1])
+			page.NextCursor = util.EncodeCursor(util.Cursor{Sort: pagination.Sort, Value: value, ID: id})
+			break
+		}
+		page.Data = append(page.Data, item)
+	}
+	return page
+}
@@ -3,6 +3,8 @@ package api
 import (
 	"fmt"
 	"net/http"
+	neturl "net/url"
+	"slices"
 	"strings"
 	"tekticket/db"
 	"tekticket/service/payment"
@@ -74,16 +76,18 @@ type CreatePaymentError struct {
 // @Summary      Create or retry a Stripe payment
 // @Description  Creates a new payment intent in Stripe and records it in Directus.
 // @Description  If a `payment_id` is provided, retries the payment only if the existing record’s status is `failed`.
+// @Description  The amount must be the total of the booking, with its discounts and the payment fee.
 // @Description  Validates amount range for VND, creates a Stripe payment intent with idempotency protection, and updates Directus with transaction details.
 // @Tags         Payments
 // @Accept       json
 // @Produce      json
 // @Param        request  body  CreatePaymentRequest  true  "Payment creation payload"
 // @Success      200  {object}  CreatePaymentResponse  "Payment intent successfully created"
-// @Failure      400  {object}  CreatePaymentError     "Invalid request body"
+// @Failure      400  {object}  CreatePaymentError     "Invalid request body | Booking is not waiting for payment | Payment amount must be ... VND"
 // @Failure      401  {object}  CreatePaymentError     "Unauthorized access | Token expired"
 // @Failure      403  {object}  CreatePaymentError     "Invalid token"
 // @Failure      404  {object}  CreatePaymentError     "No item with such ID"
+// @Failure      409  {object}  CreatePaymentError     "Event is canceled"
 // @Failure      429  {object}  CreatePaymentError     "You hit the rate limit"
 // @Failure      500  {object}  CreatePaymentError     "Internal server error or failed Stripe/Directus operation"
 // @Security     BearerAuth
@@ -106,6 +110,27 @@ func (server *Server) CreatePayment(ctx *gin.Context) {
 		return
 	}
 
+	// The amount is priced by the server, from the tickets of the booking with their discounts, or from its resale listing
+	bookingInfo, status, err := server.getPaymentBooking(req.BookingID, token)
+	if err != nil {
+		util.LOGGER.Error("POST /api/payments: failed to get booking", "status", status, "error", err)
+		server.DirectusError(ctx, err)
+		return
+	}
+	if bookingInfo.Status != "pending" {
+		ctx.JSON(http.StatusBadRequest, CreatePaymentError{Message: "Booking is not waiting for payment"})
+		return
+	}
+	if bookingInfo.Event != nil && bookingInfo.Event.Status == EVENT_STATUS_CANCELED {
+		ctx.JSON(http.StatusConflict, CreatePaymentError{Message: "Event is canceled"})
+		return
+	}
+	if amount := util.BookingAmount(bookingInfo, server.config.PaymentFeePercent); req.Amount != int64(amount) {
+		util.LOGGER.Warn("POST /api/payments: payment amount doesn't match booking", "amount", req.Amount, "booking_amount", amount)
+		ctx.JSON(http.StatusBadRequest, CreatePaymentError{Message: fmt.Sprintf("Payment amount must be %d VND", amount)})
+		return
+	}
+
 	// Ensure that a paymentID always exists for Stripe create payment intent, since we use paymentID as the idempotency key
 	paymentInfo, status, err := server.ensurePaymentRecordExists(token, req.PaymentID, req.BookingID, req.Amount)
 	if err != nil {
@@ -127,31 +152,12 @@ func (server *Server) CreatePayment(ctx *gin.Context) {
 	if err != nil {
 		util.LOGGER.Error("POST /api/payments: failed to create payment intent in Stripe", "error", err)
 
-		// We create a background task for retry, in case database is down and the update didn't work somehow
-		payload := worker.UpdatePaymentRecordPayload{
-			URL:     fmt.Sprintf("%s/items/payments/%s", server.config.DirectusAddr, paymentInfo.ID),
-			Body:    map[string]any{"status": "failed"},
-			Token:   token,
-			Caller:  "POST /api/payments",
-			Context: "rollback payment status to 'failed' after creat payment intent in Stripe failed",
-		}
-
-		err = server.distributor.DistributeTask(
-			ctx,
-			worker.UpdatePaymentRecord,
-			payload,
-			asynq.Queue(worker.HIGH_IMPACT),
-			asynq.MaxRetry(5),
-		)
-
-		if err != nil {
-			// If even task distributing failed, the only thing we can do is log and manually fix the problem :v
-			util.LOGGER.Error(
-				"POST /api/payments: failed to distribute background task",
-				"task_issued_reason", "update payment after create payment intent failed",
-				"error", err,
-			)
-		}
+		// Compensate the payment record in the background, in case database is down and the update didn't work somehow
+		server.issueCommand(ctx, worker.SetPaymentStatusPayload{
+			PaymentID: paymentInfo.ID,
+			Status:    "failed",
+			Reason:    "create payment intent in Stripe failed",
+		})
 
 		ctx.JSON(http.StatusInternalServerError, CreatePaymentError{
 			Message:   "Internal server error! Please use the payment ID provided and retry again",
@@ -161,29 +167,12 @@ func (server *Server) CreatePayment(ctx *gin.Context) {
 	}
 
 	// Update payment transaction_id to payment_intent_id and status to pending
-	payload := worker.UpdatePaymentRecordPayload{
-		URL:     fmt.Sprintf("%s/items/payments/%s", server.config.DirectusAddr, paymentInfo.ID),
-		Body:    map[string]any{"transaction_id": intent.ID, "status": "pending"},
-		Token:   token,
-		Caller:  "POST /api/payyments",
-		Context: "update payment with transaction_id and status = pending after create payment intent success",
-	}
-
-	err = server.distributor.DistributeTask(
-		ctx,
-		worker.UpdatePaymentRecord,
-		payload,
-		asynq.Queue(worker.HIGH_IMPACT),
-		asynq.MaxRetry(5),
-	)
-
-	if err != nil {
-		util.LOGGER.Error(
-			"POST /api/payments: failed to distribute background tasks",
-			"task_issued_reason", "update payment after create payment intent success",
-			"error", err,
-		)
-	}
+	server.issueCommand(ctx, worker.SetPaymentStatusPayload{
+		PaymentID:     paymentInfo.ID,
+		Status:        "pending",
+		TransactionID: intent.ID,
+		Reason:        "create payment intent in Stripe succeeded",
+	})
 
 	// Return data back to client
 	ctx.JSON(http.StatusOK, CreatePaymentResponse{
@@ -194,6 +183,17 @@ func (server *Server) CreatePayment(ctx *gin.Context) {
 	})
 }
 
+// Helper method: get a booking with what it is priced by
+func (server *Server) getPaymentBooking(bookingID, token string) (db.Booking, int, error) {
+	url := fmt.Sprintf(
+		"%s/items/bookings/%s?fields=id,status,discount,event_id.status,booking_items.price,resale_listing_id.price",
+		server.config.DirectusAddr, bookingID,
+	)
+	var booking db.Booking
+	status, err := db.MakeRequest("GET", url, nil, token, &booking)
+	return booking, status, err
+}
+
 // CreatePaymentMethod godoc
 // @Summary      Create payment method
 // @Description  Create payment method for confirm payment. This API is solely for internal testing, not to be consumed by any client
@@ -215,6 +215,19 @@ func (server *Server) CreatePaymentMethod(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, SuccessMessage{"Payment method: " + pm.ID})
 }
 
+// Helper method: issue a domain command to the worker. The request already reached Stripe, so a failure is only logged, to
+// fix manually
+func (server *Server) issueCommand(ctx *gin.Context, command worker.Command) {
+	if err := worker.IssueCommand(ctx, server.distributor, command); err != nil {
+		util.LOGGER.Error(
+			ctx.Request.Method+" "+ctx.FullPath()+": failed to distribute background task",
+			"task", command.TaskName(),
+			"command", command,
+			"error", err,
+		)
+	}
+}
+
 // Helper method: extract reason for payment confirmation or refund failed
 func (server *Server) extractFailedPaymentReason(intent *stripe.PaymentIntent) (int, string) {
 	// If payment failed but last payment error is nil (which somehow contradict, we call it some unexpected error)
@@ -265,7 +278,9 @@ type ConfirmPaymentResponse struct {
 
 // ConfirmPayment godoc
 // @Summary      Confirm an existing payment
-// @Description  Confirms a Stripe payment intent and updates the payment record in the database with the confirmation status.
+// @Description  Confirms a Stripe payment intent. Once the payment succeeded, the booking is confirmed in the background:
+// @Description  the payment is recorded, the booking completed, the tickets issued, the loyalty points credited and the
+// @Description  customer notified. The progress is shown in the confirmation_steps of the booking
 // @Tags         Payments
 // @Accept       json
 // @Produce      json
@@ -276,6 +291,7 @@ type ConfirmPaymentResponse struct {
 // @Failure      401  {object}  CreatePaymentError                      "Unauthorized access | Token expired"
 // @Failure      403  {object}  CreatePaymentError                      "Invalid token"
 // @Failure      404  {object}  CreatePaymentError                      "No item with such ID"
+// @Failure      409  {object}  ErrorResponse                           "Event is canceled"
 // @Failure      429  {object}  CreatePaymentError                      "You hit the rate limit"
 // @Failure      500  {object}  ErrorResponse                           "Internal server error"
 // @Security BearerAuth
@@ -294,7 +310,7 @@ func (server *Server) ConfirmPayment(ctx *gin.Context) {
 
 	// Check if payment ID exists and payment status must be pending before processing
 	paymentID := ctx.Param("id")
-	url := fmt.Sprintf("%s/items/payments/%s?fields=id,status", server.config.DirectusAddr, paymentID)
+	url := fmt.Sprintf("%s/items/payments/%s?fields=id,status,booking_id.id,booking_id.event_id.status", server.config.DirectusAddr, paymentID)
 	var paymentInfo db.Payment
 	status, err := db.MakeRequest("GET", url, nil, token, &paymentInfo)
 	if err != nil {
@@ -324,6 +340,19 @@ func (server *Server) ConfirmPayment(ctx *gin.Context) {
 		return
 	}
 
+	if paymentInfo.Booking == nil {
+		util.LOGGER.Error("POST /api/payments/:id/confirm: payment has no booking", "id", paymentID)
+		ctx.JSON(http.StatusInternalServerError, ErrorResponse{"Internal server error"})
+		return
+	}
+
+	// A canceled event is not sold anymore. A payment succeeding while the event is canceled is refunded by the confirmation
+	if paymentInfo.Booking.Event != nil && paymentInfo.Booking.Event.Status == EVENT_STATUS_CANCELED {
+		util.LOGGER.Warn("POST /api/payments/:id/confirm: event is canceled", "id", paymentID)
+		ctx.JSON(http.StatusConflict, ErrorResponse{"Event is canceled"})
+		return
+	}
+
 	// Check if this payment actuall paid or not
 	intent, err := payment.GetPaymentIntent(req.PaymentIntentID)
 	if err != nil {
@@ -338,9 +367,16 @@ func (server *Server) ConfirmPayment(ctx *gin.Context) {
 		return
 	}
 
-	// Update payment status into processing to avoid spamming. Since this is the first operation, no need to retry
+	// Update payment status into processing to avoid spamming. Since this is the first operation, no need to retry. Its
+	// compensation is issued if the confirmation fails
+	processing := worker.SetPaymentStatusPayload{
+		PaymentID:      paymentID,
+		Status:         "processing",
+		PreviousStatus: paymentInfo.Status,
+		Reason:         "payment confirmation",
+	}
 	url = fmt.Sprintf("%s/items/payments/%s", server.config.DirectusAddr, paymentID)
-	status, err = db.MakeRequest("PATCH", url, map[string]any{"status": "processing"}, token, nil)
+	status, err = db.MakeRequest("PATCH", url, map[string]any{"status": processing.Status}, token, nil)
 	if err != nil {
 		util.LOGGER.Error("POST /api/payments/:id/confirm: failed to update payment status to processing", "error", err)
 		ctx.JSON(http.StatusInternalServerError, ErrorResponse{"Internal server error"})
@@ -352,30 +388,8 @@ func (server *Server) ConfirmPayment(ctx *gin.Context) {
 	if err != nil {
 		util.LOGGER.Error("POST /api/payments/:id/confirm: failed to confirm payment intent", "error", err)
 
-		// Rollback: update payment status from 'processing' to 'pending'
-		payload := worker.UpdatePaymentRecordPayload{
-			URL:     fmt.Sprintf("%s/items/payments/%s", server.config.DirectusAddr, paymentID),
-			Body:    map[string]any{"status": "pending"},
-			Token:   token,
-			Caller:  "POST /api/payments/:id/confirm",
-			Context: "rollback after payment confirmation error",
-		}
-
-		err = server.distributor.DistributeTask(
-			ctx,
-			worker.UpdatePaymentRecord,
-			payload,
-			asynq.Queue(worker.HIGH_IMPACT),
-			asynq.MaxRetry(5),
-		)
-
-		if err != nil {
-			util.LOGGER.Error(
-				"POST /api/payments/:id/confirm: failed to distribute background task",
-				"task_issued_reason", "rollback payment status after payment confirmation error",
-				"error", err,
-			)
-		}
+		// Rollback: update payment status from 'processing' back to 'pending'
+		server.issueCommand(ctx, processing.Compensation())
 
 		ctx.JSON(http.StatusInternalServerError, ErrorResponse{"Internal server error"})
 		return
@@ -388,57 +402,33 @@ func (server *Server) ConfirmPayment(ctx *gin.Context) {
 		// Try getting the reason why payment confirmation failed
 		status, reason := server.extractFailedPaymentReason(confirmIntent)
 
-		// Rollback: update payment status from 'processing' to 'pending'
-		payload := worker.UpdatePaymentRecordPayload{
-			URL:     fmt.Sprintf("%s/items/payments/%s", server.config.DirectusAddr, paymentID),
-			Body:    map[string]any{"status": "pending"},
-			Token:   token,
-			Caller:  "POST /api/payments/:id/confirm",
-			Context: "rollback after payment confirmation failure",
-		}
-
-		err = server.distributor.DistributeTask(
-			ctx,
-			worker.UpdatePaymentRecord,
-			payload,
-			asynq.Queue(worker.HIGH_IMPACT),
-			asynq.MaxRetry(5),
-		)
-
-		if err != nil {
-			util.LOGGER.Error(
-				"POST /api/payments/:id/confirm: failed to distribute background task",
-				"task_issued_reason", "rollback payment status after payment confirmation failure",
-				"error", err,
-			)
-		}
+		// Rollback: update payment status from 'processing' back to 'pending'
+		server.issueCommand(ctx, processing.Compensation())
 
 		ctx.JSON(status, ErrorResponse{reason})
 		return
 	}
 
-	// Update payment with payment method type and status = success
+	// Confirm the booking in the background: record the payment, complete the booking, publish the tickets, credit the
+	// loyalty points and notify the customer. The payment already succeeded, so this must not fail the request
 	util.LOGGER.Info("POST /api/payments/:id/confirm", "payment_method", confirmIntent.PaymentMethod)
-	payload := worker.UpdatePaymentRecordPayload{
-		URL:     fmt.Sprintf("%s/items/payments/%s", server.config.DirectusAddr, paymentID),
-		Body:    map[string]any{"payment_method": "visa", "status": "success"},
-		Token:   token,
-		Caller:  "POST /api/payments/:id/confirm",
-		Context: "update payment with payment_method and status after payment confirmation success",
-	}
-
 	err = server.distributor.DistributeTask(
 		ctx,
-		worker.UpdatePaymentRecord,
-		payload,
+		worker.ConfirmBooking,
+		worker.ConfirmBookingPayload{
+			BookingID:     paymentInfo.Booking.ID,
+			PaymentID:     paymentID,
+			PaymentMethod: "visa",
+		},
 		asynq.Queue(worker.HIGH_IMPACT),
-		asynq.MaxRetry(5),
+		asynq.MaxRetry(25),
 	)
 
 	if err != nil {
 		util.LOGGER.Error(
 			"POST /api/payments/:id/confirm: failed to distribute background task",
-			"task_issued_reason", "update payment with payment_method and status after payment confirmation success",
+			"task", worker.ConfirmBooking,
+			"booking_id", paymentInfo.Booking.ID,
 			"error", err,
 		)
 	}
@@ -450,20 +440,125 @@ func (server *Server) ConfirmPayment(ctx *gin.Context) {
 	})
 }
 
+// Fields of a payment used by the refunds
+var refundPaymentFields = []string{
+	"id", "date_created", "transaction_id", "amount", "items_total", "status",
+	"booking_id.id",
+	"booking_id.booking_items.id", "booking_id.booking_items.price", "booking_id.booking_items.status",
+	"booking_id.booking_items.seat_id.id", "booking_id.booking_items.ticket_id.id",
+	"booking_id.booking_items.event_schedule_id.start_time",
+	"booking_id.booking_items.refund_id.id", "booking_id.booking_items.refund_id.status",
+	"refunds.id", "refunds.amount", "refunds.status",
+}
+
+// How long a refund of a payment blocks the other refunds of the same payment
+const REFUND_LOCK_TTL = time.Minute
+
+type RefundItemPreview struct {
+	BookingItemID string `json:"booking_item_id"`
+	Price         int    `json:"price"`
+	Percent       int    `json:"percent"` // Refunded percent of the item, by the refund policy
+	Amount        int    `json:"amount"`  // Refunded amount, with the share of the fees of the item
+	Refundable    bool   `json:"refundable"`
+	Reason        string `json:"reason,omitempty"` // Why the item can't be refunded
+}
+
+type RefundPreviewResponse struct {
+	PaymentID      string              `json:"payment_id"`
+	PaidAmount     int                 `json:"paid_amount"`
+	RefundedAmount int                 `json:"refunded_amount"` // Already refunded, or being refunded
+	Amount         int                 `json:"amount"`          // Refundable amount of the requested items
+	Items          []RefundItemPreview `json:"items"`
+	Reasons        []string            `json:"reasons"` // Refund reasons the customer can choose
+}
+
+type CreateRefundRequest struct {
+	BookingItemIDs []string `json:"booking_item_ids"` // Items to refund. Default: every refundable item of the payment
+	Reason         string   `json:"reason" binding:"required,oneof=cannot-attend schedule-conflict event-changed duplicate-purchase other"`
+}
+
+type CreateRefundResponse struct {
+	ID             string   `json:"id"`
+	Status         string   `json:"status"` // success, or pending while Stripe completes the refund
+	Amount         int      `json:"amount"`
+	RefundedAmount int      `json:"refunded_amount"` // Total refunded amount of the payment, with this refund
+	BookingItemIDs []string `json:"booking_item_ids"`
+}
+
+// PreviewRefund godoc
+// @Summary      Preview the refund of a payment
+// @Description  Previews the amount refunded for the tickets of a successful payment, before the customer commits. The
+// @Description  refunded percent of each ticket follows the refund policy: it depends on the time left before the start of
+// @Description  its schedule, with a full refund during a grace period after the payment
+// @Tags         Payments
+// @Produce      json
+// @Param        id     path      string  true   "Payment ID"
+// @Param        items  query     string  false  "Comma separated booking item IDs. Default: every item of the payment"
+// @Success      200  {object}  RefundPreviewResponse  "Refund preview"
+// @Failure      400  {object}  ErrorResponse          "A payment must success first before refund | No item with such ID in this payment"
+// @Failure      401  {object}  ErrorResponse          "Unauthorized access | Token expired"
+// @Failure      403  {object}  ErrorResponse          "Invalid token"
+// @Failure      404  {object}  ErrorResponse          "No item with such ID"
+// @Failure      429  {object}  ErrorResponse          "You hit the rate limit"
+// @Failure      500  {object}  ErrorResponse          "Internal server error"
+// @Security     BearerAuth
+// @Router       /api/payments/{id}/refund [get]
+func (server *Server) PreviewRefund(ctx *gin.Context) {
+	paymentInfo, status, err := server.getRefundPayment(ctx.Param("id"), server.GetToken(ctx))
+	if err != nil {
+		util.LOGGER.Error("GET /api/payments/:id/refund: failed to get payment info", "status", status, "error", err)
+		server.DirectusError(ctx, err)
+		return
+	}
+
+	if paymentInfo.Status != "success" {
+		ctx.JSON(http.StatusBadRequest, ErrorResponse{"A payment must success first before refund"})
+		return
+	}
+
+	checkedIn, status, err := server.getCheckedInItems(paymentInfo)
+	if err != nil {
+		util.LOGGER.Error("GET /api/payments/:id/refund: failed to get checkins", "status", status, "error", err)
+		server.DirectusError(ctx, err)
+		return
+	}
+
+	var itemIDs []string
+	if items := strings.TrimSpace(ctx.Query("items")); items != "" {
+		itemIDs = strings.Split(items, ",")
+	}
+	preview, ok := server.previewRefund(paymentInfo, itemIDs, checkedIn, time.Now())
+	if !ok {
+		ctx.JSON(http.StatusBadRequest, ErrorResponse{"No item with such ID in this payment"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, preview)
+}
+
 // Refund godoc
-// @Summary      Refund a successful payment
-// @Description  Initiates a Stripe refund for a completed payment and records it in Directus.
-// @Description  This API is for user-requested refunds (partial refund if outside the allowed time window)
+// @Summary      Refund tickets of a successful payment
+// @Description  Refunds the chosen tickets of a successful payment (every refundable ticket by default) through Stripe, by
+// @Description  the refund policy (see the refund preview). The refunded tickets are invalidated and their seats released,
+// @Description  and the tickets are offered to the waitlists of their types.
+// @Description  Tickets already checked in can't be refunded.
+// @Description  A payment can be refunded several times, until every ticket is refunded. A refund that Stripe doesn't
+// @Description  complete right away is answered with 202 and the pending refund: its tickets are released once it succeeds,
+// @Description  or the refund is marked as failed
 // @Tags         Payments
 // @Accept       json
 // @Produce      json
-// @Param        id                path   string  true   "Payment ID"
-// @Success      200  {string}  SuccessMessage  "Refund processed successfully"
-// @Failure      400  {object}  ErrorResponse   "A payment must success first before refund | Refund failed"
+// @Param        id       path    string               true  "Payment ID"
+// @Param        request  body    CreateRefundRequest  true  "Refunded tickets and reason"
+// @Success      200  {object}  CreateRefundResponse  "Refund processed successfully"
+// @Success      202  {object}  CreateRefundResponse  "Refund pending in Stripe, settled in the background"
+// @Failure      400  {object}  ErrorResponse   "Invalid request body | A payment must success first before refund | No item with such ID in this payment | Nothing to refund | Refund failed"
 // @Failure      401  {object}  ErrorResponse   "Unauthorized access | Token expired"
 // @Failure      403  {object}  ErrorResponse   "Invalid token"
 // @Failure      404  {object}  ErrorResponse   "No item with such ID"
+// @Failure      409  {object}  ErrorResponse   "A refund of this payment is in progress | A ticket is listed for resale, cancel the listing first | A ticket has a pending transfer, cancel the transfer first"
 // @Failure      429  {object}  ErrorResponse   "You hit the rate limit"
+// @Failure      500  {object}  ErrorResponse   "Internal server error"
 // @Security BearerAuth
 // @Router       /api/payments/{id}/refund [post]
 func (server *Server) Refund(ctx *gin.Context) {
@@ -473,13 +568,31 @@ func (server *Server) Refund(ctx *gin.Context) {
 	// Get payment ID from path parameter
 	paymentID := ctx.Param("id")
 
+	var req CreateRefundRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		util.LOGGER.Warn("POST /api/payments/:id/refund: failed to bind request body", "error", err)
+		ctx.JSON(http.StatusBadRequest, ErrorResponse{"Invalid request body"})
+		return
+	}
+
+	// Only one refund of a payment at a time, so that concurrent requests can't refund the same tickets twice
+	lockKey := refundLockKey(paymentID)
+	locked, err := server.queries.Cache.SetNX(ctx, lockKey, 1, REFUND_LOCK_TTL).Result()
+	if err != nil {
+		util.LOGGER.Error("POST /api/payments/:id/refund: failed to lock payment", "error", err)
+		ctx.JSON(http.StatusInternalServerError, ErrorResponse{"Internal server error"})
+		return
+	}
+	if !locked {
+		ctx.JSON(http.StatusConflict, ErrorResponse{"A refund of this payment is in progress"})
+		return
+	}
+	defer server.queries.Cache.Del(ctx, lockKey)
+
 	// Try get payment info
-	var paymentInfo db.Payment
-	fields := []string{"id", "date_created", "transaction_id", "amount", "status"}
-	url := fmt.Sprintf("%s/items/payments/%s?fields=%s", server.config.DirectusAddr, paymentID, strings.Join(fields, ","))
-	status, err := db.MakeRequest("GET", url, nil, token, &paymentInfo)
+	paymentInfo, status, err := server.getRefundPayment(paymentID, token)
 	if err != nil {
-		util.LOGGER.Error("POST /api/payments/:id/refund: failed to get payment info", "error", err)
+		util.LOGGER.Error("POST /api/payments/:id/refund: failed to get payment info", "status", status, "error", err)
 		server.DirectusError(ctx, err)
 		return
 	}
@@ -491,20 +604,70 @@ func (server *Server) Refund(ctx *gin.Context) {
 		return
 	}
 
-	// Check if this payment can get a full refund, or just a partial refund based on the payment created time
-	amount := paymentInfo.Amount
-	if time.Time(*paymentInfo.DateCreated).Add(time.Hour * time.Duration(server.config.MaxFullRefundHours)).Before(time.Now()) {
-		amount /= 2
+	// Refunded amount of the items, by the refund policy
+	checkedIn, status, err := server.getCheckedInItems(paymentInfo)
+	if err != nil {
+		util.LOGGER.Error("POST /api/payments/:id/refund: failed to get checkins", "status", status, "error", err)
+		server.DirectusError(ctx, err)
+		return
+	}
+	preview, ok := server.previewRefund(paymentInfo, req.BookingItemIDs, checkedIn, time.Now())
+	if !ok {
+		ctx.JSON(http.StatusBadRequest, ErrorResponse{"No item with such ID in this payment"})
+		return
 	}
 
-	// Create the refund record with status pending
-	url = fmt.Sprintf("%s/items/refunds?fields=id", server.config.DirectusAddr)
+	// Only the refundable items are refunded, an item requested explicitly must be refundable
+	release := worker.ReleaseTicketsPayload{Reason: "refund in Stripe succeeded"}
+	for _, item := range preview.Items {
+		if !item.Refundable {
+			if len(req.BookingItemIDs) != 0 {
+				ctx.JSON(http.StatusBadRequest, ErrorResponse{fmt.Sprintf("Item %s can't be refunded: %s", item.BookingItemID, item.Reason)})
+				return
+			}
+			continue
+		}
+		release.BookingItemIDs = append(release.BookingItemIDs, item.BookingItemID)
+	}
+	if len(release.BookingItemIDs) == 0 || preview.Amount <= 0 {
+		ctx.JSON(http.StatusBadRequest, ErrorResponse{"Nothing to refund"})
+		return
+	}
+	listed, status, err := server.hasActiveListing(release.BookingItemIDs)
+	if err != nil {
+		util.LOGGER.Error("POST /api/payments/:id/refund: failed to get active listings", "status", status, "error", err)
+		server.DirectusError(ctx, err)
+		return
+	}
+	if listed {
+		ctx.JSON(http.StatusConflict, ErrorResponse{"A ticket is listed for resale, cancel the listing first"})
+		return
+	}
+	transferring, status, err := server.hasPendingTransfer(release.BookingItemIDs)
+	if err != nil {
+		util.LOGGER.Error("POST /api/payments/:id/refund: failed to get pending transfers", "status", status, "error", err)
+		server.DirectusError(ctx, err)
+		return
+	}
+	if transferring {
+		ctx.JSON(http.StatusConflict, ErrorResponse{"A ticket has a pending transfer, cancel the transfer first"})
+		return
+	}
+	for _, item := range paymentInfo.Booking.BookingItems {
+		if item.Seat != nil && slices.Contains(release.BookingItemIDs, item.ID) {
+			release.SeatIDs = append(release.SeatIDs, item.Seat.ID)
+		}
+	}
+
+	// Create the refund record with status pending, linked to its items
+	url := fmt.Sprintf("%s/items/refunds?fields=id", server.config.DirectusAddr)
 	var refundRecord db.Refund
 	body := map[string]any{
-		"amount":     amount,
-		"status":     "pending",
-		"payment_id": paymentInfo.ID,
-		"reason":     "user-canceled",
+		"amount":        preview.Amount,
+		"status":        "pending",
+		"payment_id":    paymentInfo.ID,
+		"reason":        req.Reason,
+		"booking_items": release.BookingItemIDs,
 	}
 	status, err = db.MakeRequest("POST", url, body, token, &refundRecord)
 	if err != nil {
@@ -518,41 +681,47 @@ func (server *Server) Refund(ctx *gin.Context) {
 	}
 
 	// Refund. Since Stripe only allow for 3 reasons that was defined in their API, we're gonna use requested by customer
-	refund, err := payment.CreateRefund(paymentInfo.TransactionID, payment.RequestedByCustomer, int64(amount))
+	// unless the customer bought the tickets twice
+	reason := payment.RequestedByCustomer
+	if req.Reason == util.REFUND_REASON_DUPLICATE_PURCHASE {
+		reason = payment.Duplicate
+	}
+	refund, err := payment.CreateRefund(paymentInfo.TransactionID, reason, int64(preview.Amount))
 	if err != nil {
 		util.LOGGER.Error("POST /api/payments/:id/refund: failed to request refund in Stripe", "error", err)
 
-		// Rollback, update refund status back to failed
-		payload := worker.UpdatePaymentRecordPayload{
-			URL:     fmt.Sprintf("%s/items/refunds/%s", server.config.DirectusAddr, refundRecord.ID),
-			Body:    map[string]any{"status": "failed"},
-			Token:   token,
-			Caller:  "POST /api/payments/:id/refund",
-			Context: "rollback refund with status failed after failling refund on Stripe",
-		}
-
-		err = server.distributor.DistributeTask(
-			ctx,
-			worker.UpdatePaymentRecord,
-			payload,
-			asynq.Queue(worker.HIGH_IMPACT),
-			asynq.MaxRetry(5),
-		)
-
-		if err != nil {
-			util.LOGGER.Error(
-				"POST /api/payments/:id/refund: failed to distribute background task",
-				"task_issued_reason", "rollback after refund failed",
-				"error", err,
-			)
-		}
+		// Rollback, update refund status to failed
+		server.issueCommand(ctx, worker.SetRefundStatusPayload{
+			RefundID:       refundRecord.ID,
+			Status:         "failed",
+			PreviousStatus: "pending",
+			Reason:         "refund in Stripe failed",
+		})
 
 		ctx.JSON(http.StatusInternalServerError, ErrorResponse{"Internal server error"})
 		return
 	}
 
+	// The refunded tickets are offered to the waitlists once they are released
+	var ticketIDs []string
+	for _, item := range paymentInfo.Booking.BookingItems {
+		if item.Ticket != nil && slices.Contains(release.BookingItemIDs, item.ID) {
+			ticketIDs = append(ticketIDs, item.Ticket.ID)
+		}
+	}
+	response := CreateRefundResponse{
+		ID:             refundRecord.ID,
+		Status:         "success",
+		Amount:         preview.Amount,
+		RefundedAmount: preview.RefundedAmount + preview.Amount,
+		BookingItemIDs: release.BookingItemIDs,
+	}
+
 	// Check if the refund success or not. Just like with confirm, a refund failure does not mean an error.
-	if refund.Status != stripe.RefundStatusSucceeded {
+	switch refund.Status {
+	case stripe.RefundStatusSucceeded:
+		// Settled below
+	case stripe.RefundStatusFailed, stripe.RefundStatusCanceled:
 		// Unlike with intent, Stripe refund object only has a small reason for failured, with no HTTP code return
 		// Most of the refund failure reason seems like it client side more than server side, so we'll return 400 here
 		util.LOGGER.Warn(
@@ -560,34 +729,174 @@ func (server *Server) Refund(ctx *gin.Context) {
 			"status", string(refund.Status),
 			"reason", string(refund.FailureReason),
 		)
+
+		// A failed refund frees its items for another refund
+		server.issueCommand(ctx, worker.SetRefundStatusPayload{
+			RefundID:       refundRecord.ID,
+			Status:         "failed",
+			PreviousStatus: "pending",
+			Reason:         "refund in Stripe failed",
+		})
 		ctx.JSON(http.StatusBadRequest, ErrorResponse{"Refund failed: " + string(refund.FailureReason)})
 		return
+	default:
+		// Accepted, but not completed yet by Stripe (pending, requires_action). The refund keeps its items until it is
+		// settled in the background: its tickets are released once it succeeded, or the refund is marked as failed
+		util.LOGGER.Info("POST /api/payments/:id/refund: refund pending in Stripe", "id", refundRecord.ID, "status", string(refund.Status))
+		err := worker.ScheduleRefundSettlement(ctx, server.distributor, worker.SettleRefundPayload{
+			RefundID:       refundRecord.ID,
+			StripeRefundID: refund.ID,
+			Release:        release,
+			TicketIDs:      ticketIDs,
+		})
+		if err != nil {
+			util.LOGGER.Error(
+				"POST /api/payments/:id/refund: failed to distribute background task",
+				"task", worker.SettleRefund,
+				"id", refundRecord.ID,
+				"error", err,
+			)
+		}
+
+		response.Status = "pending"
+		ctx.JSON(http.StatusAccepted, response)
+		return
 	}
 
 	// Update refund record
-	payload := worker.UpdatePaymentRecordPayload{
-		URL:     fmt.Sprintf("%s/items/refunds/%s", server.config.DirectusAddr, refundRecord.ID),
-		Body:    map[string]any{"status": "success"},
-		Token:   token,
-		Caller:  "POST /api/payments/:id/refund",
-		Context: "update refund with status success after succeeding refund on Stripe",
+	server.issueCommand(ctx, worker.SetRefundStatusPayload{
+		RefundID:       refundRecord.ID,
+		Status:         "success",
+		PreviousStatus: "pending",
+		Reason:         "refund in Stripe succeeded",
+	})
+
+	// Invalidate the tickets and release their seats
+	server.issueCommand(ctx, release)
+
+	// The refunded tickets are back on sale, offered to the waitlists first
+	for _, ticketID := range ticketIDs {
+		server.offerWaitlist(ctx, ticketID)
 	}
 
-	err = server.distributor.DistributeTask(
-		ctx,
-		worker.UpdatePaymentRecord,
-		payload,
-		asynq.Queue(worker.HIGH_IMPACT),
-		asynq.MaxRetry(5),
+	ctx.JSON(http.StatusOK, response)
+}
+
+// Helper method: get a payment with its items and refunds
+func (server *Server) getRefundPayment(paymentID, token string) (db.Payment, int, error) {
+	url := fmt.Sprintf(
+		"%s/items/payments/%s?fields=%s",
+		server.config.DirectusAddr, paymentID, strings.Join(refundPaymentFields, ","),
 	)
+	var paymentInfo db.Payment
+	status, err := db.MakeRequest("GET", url, nil, token, &paymentInfo)
+	return paymentInfo, status, err
+}
 
+// Helper method: get the IDs of the items of a payment checked in at the door. Check-in only records the scan, it doesn't
+// change the status of the item
+func (server *Server) getCheckedInItems(paymentInfo db.Payment) ([]string, int, error) {
+	if paymentInfo.Booking == nil || len(paymentInfo.Booking.BookingItems) == 0 {
+		return nil, http.StatusOK, nil
+	}
+
+	itemIDs := make([]string, 0, len(paymentInfo.Booking.BookingItems))
+	for _, item := range paymentInfo.Booking.BookingItems {
+		itemIDs = append(itemIDs, item.ID)
+	}
+	queryParams := neturl.Values{}
+	queryParams.Add("fields", "booking_item_id.id")
+	queryParams.Add("filter[booking_item_id][_in]", strings.Join(itemIDs, ","))
+	queryParams.Add("limit", "-1")
+	url := fmt.Sprintf("%s/items/checkins?%s", server.config.DirectusAddr, queryParams.Encode())
+	var checkins []db.Checkin
+	status, err := db.MakeRequest("GET", url, nil, server.config.DirectusStaticToken, &checkins)
 	if err != nil {
-		util.LOGGER.Error(
-			"POST /api/payments/:id/refund: failed to distribute background task",
-			"task_issued_reason", "update after refund succeeded",
-			"error", err,
-		)
+		return nil, status, err
+	}
+
+	checkedIn := make([]string, 0, len(checkins))
+	for _, checkin := range checkins {
+		if checkin.BookingItem != nil {
+			checkedIn = append(checkedIn, checkin.BookingItem.ID)
+		}
+	}
+	return checkedIn, status, nil
+}
+
+// Helper function: Redis key of the lock of the refunds of a payment
+func refundLockKey(paymentID string) string {
+	return "refund:lock:" + paymentID
+}
+
+// Helper method: preview the refund of the items of a payment (every item if itemIDs is empty) by the refund policy, the
+// checked in items aren't refundable. Return false if an item is not in the payment
+func (server *Server) previewRefund(paymentInfo db.Payment, itemIDs, checkedIn []string, now time.Time) (RefundPreviewResponse, bool) {
+	preview := RefundPreviewResponse{
+		PaymentID:  paymentInfo.ID,
+		PaidAmount: paymentInfo.Amount,
+		Items:      []RefundItemPreview{},
+		Reasons:    util.RefundReasons,
+	}
+
+	// Refunds succeeded or in progress count as refunded
+	for _, refund := range paymentInfo.Refunds {
+		if refund.Status != "failed" {
+			preview.RefundedAmount += refund.Amount
+		}
+	}
+
+	var items []db.BookingItem
+	if paymentInfo.Booking != nil {
+		items = paymentInfo.Booking.BookingItems
+	}
+	for _, id := range itemIDs {
+		if !slices.ContainsFunc(items, func(item db.BookingItem) bool { return item.ID == id }) {
+			return preview, false
+		}
+	}
+
+	// The share of an item is by the price of the items paid for, some of them may have moved to other bookings since. The
+	// payments recorded before the price was kept fall back on the items left
+	totalPrice := paymentInfo.ItemsTotal
+	if totalPrice == 0 {
+		for _, item := range items {
+			totalPrice += item.Price
+		}
+	}
+	paidAt := time.Time{}
+	if paymentInfo.DateCreated != nil {
+		paidAt = time.Time(*paymentInfo.DateCreated)
+	}
+	policy := util.NewRefundPolicy(server.config.Setting)
+	remaining := max(paymentInfo.Amount-preview.RefundedAmount, 0)
+
+	for _, item := range items {
+		if len(itemIDs) != 0 && !slices.Contains(itemIDs, item.ID) {
+			continue
+		}
+
+		itemPreview := RefundItemPreview{BookingItemID: item.ID, Price: item.Price}
+		start := time.Time{}
+		if item.EventSchedule != nil && item.EventSchedule.StartTime != nil {
+			start = time.Time(*item.EventSchedule.StartTime)
+		}
+
+		if reason := util.RefundBlockedReason(item, slices.Contains(checkedIn, item.ID)); reason != "" {
+			itemPreview.Reason = reason
+		} else {
+			itemPreview.Percent = policy.Percent(start, paidAt, now)
+			itemPreview.Amount = min(util.RefundAmount(item.Price, totalPrice, paymentInfo.Amount, itemPreview.Percent), remaining)
+			if itemPreview.Amount > 0 {
+				itemPreview.Refundable = true
+				remaining -= itemPreview.Amount
+				preview.Amount += itemPreview.Amount
+			} else {
+				itemPreview.Reason = "refund deadline has passed"
+			}
+		}
+		preview.Items = append(preview.Items, itemPreview)
 	}
 
-	ctx.JSON(http.StatusOK, SuccessMessage{"Refund success"})
+	return preview, true
 }
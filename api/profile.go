@@ -2,14 +2,20 @@ package api
 
 import (
 	"encoding/base64"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"strings"
 	"tekticket/db"
+	"tekticket/service/mfa"
+	"tekticket/service/worker"
 	"tekticket/util"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/hibiken/asynq"
 )
 
 type ProfileResponse struct {
@@ -64,13 +70,14 @@ type UpdateProfileRequest struct {
 // UpdateProfile godoc
 // @Summary      Update user profile
 // @Description  Updates the current user's profile information including first name, last name, password, and avatar.
-// @Description  The avatar is expected to be a base64-encoded image
+// @Description  The avatar is expected to be a base64-encoded image. Changing the password logs out every session, including
+// @Description  the current one
 // @Tags         Profile
 // @Accept       json
 // @Produce      json
 // @Param        request  body  UpdateProfileRequest true  "Profile update request body"
 // @Success      200  {object}  ProfileResponse            "Profile updated successfully"
-// @Failure      400  {object}  ErrorResponse              "Invalid request body"
+// @Failure      400  {object}  ValidationErrorResponse    "Invalid request body | Password does not meet the requirements"
 // @Failure      401  {object}  ErrorResponse              "Token expired"
 // @Failure      403  {object}  ErrorResponse              "Invalid token"
 // @Failure      429  {object}  ErrorResponse              "You hit the rate limit"
@@ -102,6 +109,20 @@ func (server *Server) UpdateProfile(ctx *gin.Context) {
 	}
 
 	if req.Password = strings.TrimSpace(req.Password); req.Password != "" {
+		// Get the current email for the password policy check
+		url := fmt.Sprintf("%s/users/me?fields=email", server.config.DirectusAddr)
+		var user db.User
+		status, err := db.MakeRequest("GET", url, nil, server.GetToken(ctx), &user)
+		if err != nil {
+			util.LOGGER.Error("PUT /api/profile: failed to get user email", "status", status, "error", err)
+			server.DirectusError(ctx, err)
+			return
+		}
+
+		if !server.validatePassword(ctx, "password", req.Password, user.Email) {
+			return
+		}
+
 		data["password"] = req.Password
 	}
 
@@ -134,6 +155,15 @@ func (server *Server) UpdateProfile(ctx *gin.Context) {
 		return
 	}
 
+	// If the password changed, every session (including the current one) and reset password token must be revoked
+	if _, ok := data["password"]; ok {
+		if id, err := util.ExtractIDFromToken(server.GetToken(ctx)); err == nil {
+			server.revokeCredentials(ctx, id)
+		} else {
+			util.LOGGER.Error("PUT /api/profile: failed to get user ID from access token", "error", err)
+		}
+	}
+
 	// Remap image link
 	if profile.Avatar != "" {
 		profile.Avatar = util.CreateImageLink(server.config.ServerDomain, profile.Avatar)
@@ -141,3 +171,288 @@ func (server *Server) UpdateProfile(ctx *gin.Context) {
 
 	ctx.JSON(http.StatusOK, profile)
 }
+
+// Minimum time between 2 data exports of the same user, since an export is an expensive task
+const DATA_EXPORT_COOLDOWN = 10 * time.Minute
+
+// ExportProfile godoc
+// @Summary      Export all user data
+// @Description  Starts building an archive of everything we store about the current user: profile, bookings, booking items,
+// @Description  payments, refunds, check-ins, membership logs and Telegram links. The archive is built in the background,
+// @Description  and a download link valid for 24 hours is sent by email.
+// @Tags         Profile
+// @Produce      json
+// @Param        format  query  string  false  "Archive format: zip (default) or json"
+// @Success      202  {object}  SuccessMessage  "Data export started"
+// @Failure      400  {object}  ErrorResponse   "Invalid format"
+// @Failure      401  {object}  ErrorResponse   "Token expired"
+// @Failure      403  {object}  ErrorResponse   "Invalid token"
+// @Failure      429  {object}  ErrorResponse   "You hit the rate limit | A data export was requested recently, please wait"
+// @Failure      500  {object}  ErrorResponse   "Internal server error"
+// @Security     BearerAuth
+// @Router       /api/profile/export [get]
+func (server *Server) ExportProfile(ctx *gin.Context) {
+	format := strings.ToLower(strings.TrimSpace(ctx.DefaultQuery("format", worker.DATA_EXPORT_FORMAT_ZIP)))
+	if format != worker.DATA_EXPORT_FORMAT_ZIP && format != worker.DATA_EXPORT_FORMAT_JSON {
+		util.LOGGER.Warn("GET /api/profile/export: invalid format", "format", format)
+		ctx.JSON(http.StatusBadRequest, ErrorResponse{"Invalid format"})
+		return
+	}
+
+	userID, err := util.ExtractIDFromToken(server.GetToken(ctx))
+	if err != nil {
+		util.LOGGER.Error("GET /api/profile/export: failed to get user ID from access token", "error", err)
+		ctx.JSON(http.StatusForbidden, ErrorResponse{"Invalid token"})
+		return
+	}
+
+	// Only one export per user in the cooldown window
+	err = server.distributor.DistributeTask(ctx, worker.ExportUserData, worker.ExportUserDataPayload{
+		UserID: userID,
+		Format: format,
+	}, asynq.Queue(worker.LOW_IMPACT), asynq.MaxRetry(3), asynq.Unique(DATA_EXPORT_COOLDOWN))
+
+	if errors.Is(err, asynq.ErrDuplicateTask) {
+		util.LOGGER.Warn("GET /api/profile/export: export already requested", "id", userID)
+		ctx.JSON(http.StatusTooManyRequests, ErrorResponse{"A data export was requested recently, please wait"})
+		return
+	}
+	if err != nil {
+		util.LOGGER.Error("GET /api/profile/export: failed to distribute task", "task", worker.ExportUserData, "error", err)
+		ctx.JSON(http.StatusInternalServerError, ErrorResponse{"Internal server error"})
+		return
+	}
+
+	// Delete the export once its link has expired. The export task should be done within the hour
+	now := time.Now()
+	err = server.distributor.DistributeTask(ctx, worker.DeleteDataExports, worker.DeleteDataExportsPayload{
+		UserID: userID,
+		Before: now.Add(time.Hour).Unix(),
+	}, asynq.Queue(worker.LOW_IMPACT), asynq.MaxRetry(5), asynq.ProcessIn(worker.DATA_EXPORT_LINK_TTL+time.Hour))
+
+	if err != nil {
+		// The export is still sent, it just stays in storage, so we don't fail the request
+		util.LOGGER.Error("GET /api/profile/export: failed to schedule export cleanup", "task", worker.DeleteDataExports, "error", err)
+	}
+
+	ctx.JSON(http.StatusAccepted, SuccessMessage{"Your data export is being prepared, you will receive the download link by email"})
+}
+
+// DownloadDataExport godoc
+// @Summary      Download a data export
+// @Description  Downloads the data export archive, using the token from the link sent by email
+// @Tags         Profile
+// @Produce      application/zip
+// @Produce      json
+// @Param        token  query  string  true  "Download token"
+// @Success      200  {file}    file           "Data export archive"
+// @Failure      410  {object}  ErrorResponse  "Download link invalid or expired"
+// @Failure      500  {object}  ErrorResponse  "Internal server error"
+// @Router       /api/exports/download [get]
+func (server *Server) DownloadDataExport(ctx *gin.Context) {
+	fileID, _, err := worker.VerifyDataExportToken(ctx.Query("token"), server.config.SecretKey)
+	if err != nil {
+		util.LOGGER.Warn("GET /api/exports/download: invalid token", "error", err)
+		ctx.JSON(http.StatusGone, ErrorResponse{"Download link invalid or expired"})
+		return
+	}
+
+	// Stream the file from Directus, like GetImage
+	url := fmt.Sprintf("%s/assets/%s?download", server.config.DirectusAddr, fileID)
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		util.LOGGER.Error("GET /api/exports/download: failed to create request", "error", err)
+		ctx.JSON(http.StatusInternalServerError, ErrorResponse{"Internal server error"})
+		return
+	}
+	req.Header.Set("Authorization", "Bearer "+server.config.DirectusStaticToken)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		util.LOGGER.Error("GET /api/exports/download: failed to get assets", "error", err)
+		ctx.JSON(http.StatusInternalServerError, ErrorResponse{"Internal server error"})
+		return
+	}
+	defer resp.Body.Close()
+
+	// The file has been deleted, or never existed
+	if resp.StatusCode != http.StatusOK {
+		util.LOGGER.Warn("GET /api/exports/download: data export not found", "id", fileID, "status", resp.StatusCode)
+		ctx.JSON(http.StatusGone, ErrorResponse{"Download link invalid or expired"})
+		return
+	}
+
+	ctx.Header("Content-Type", resp.Header.Get("Content-Type"))
+	ctx.Header("Content-Disposition", resp.Header.Get("Content-Disposition"))
+	ctx.Header("Cache-Control", "no-store")
+	io.Copy(ctx.Writer, resp.Body)
+}
+
+type DeleteProfileRequest struct {
+	Password string `json:"password"`
+}
+
+// Collections holding personal links of a user, which are deleted with the account
+var personalCollections = []string{"user_telegrams", "user_identities", "user_mfas", "user_calendars"}
+
+// DeleteProfile godoc
+// @Summary      Delete user account
+// @Description  Deletes the current user account. Personal information is anonymized and the personal links (Telegram,
+// @Description  social login, two-factor authentication) are deleted, while bookings, payments, refunds and check-ins are
+// @Description  kept for accounting. Every session is logged out. Requires the current password whenever the account has
+// @Description  one. An account without a password must log in with a social login provider.
+// @Tags         Profile
+// @Accept       json
+// @Produce      json
+// @Param        request  body  DeleteProfileRequest  false  "Current password"
+// @Success      200  {object}  SuccessMessage  "Account deleted"
+// @Failure      400  {object}  ErrorResponse   "Invalid request body | Password is required"
+// @Failure      401  {object}  ErrorResponse   "Token expired | Incorrect login credentials"
+// @Failure      403  {object}  ErrorResponse   "Invalid token"
+// @Failure      429  {object}  ErrorResponse   "Too many failed attempts, please try again later | You hit the rate limit"
+// @Failure      500  {object}  ErrorResponse   "Internal server error"
+// @Security     BearerAuth
+// @Router       /api/profile [delete]
+func (server *Server) DeleteProfile(ctx *gin.Context) {
+	// The body is optional
+	var req DeleteProfileRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		util.LOGGER.Warn("DELETE /api/profile: failed to bind request body", "error", err)
+		ctx.JSON(http.StatusBadRequest, ErrorResponse{"Invalid request body"})
+		return
+	}
+
+	// Get the current user
+	url := fmt.Sprintf("%s/users/me?fields=id,email,avatar", server.config.DirectusAddr)
+	var user db.User
+	status, err := db.MakeRequest("GET", url, nil, server.GetToken(ctx), &user)
+	if err != nil {
+		util.LOGGER.Error("DELETE /api/profile: failed to get user", "status", status, "error", err)
+		server.DirectusError(ctx, err)
+		return
+	}
+
+	// Whether the account has a password. Directus masks the hash of a password that is set, and returns null otherwise
+	url = fmt.Sprintf("%s/users/%s?fields=password", server.config.DirectusAddr, user.ID)
+	var credentials db.User
+	status, err = db.MakeRequest("GET", url, nil, server.config.DirectusStaticToken, &credentials)
+	if err != nil {
+		util.LOGGER.Error("DELETE /api/profile: failed to get user password", "status", status, "error", err)
+		server.DirectusError(ctx, err)
+		return
+	}
+
+	// Confirm it's really the user: check the password if the account has one, or else that the account logs in with a
+	// social login provider
+	if credentials.Password != "" {
+		if req.Password == "" {
+			util.LOGGER.Warn("DELETE /api/profile: password not provided", "id", user.ID)
+			ctx.JSON(http.StatusBadRequest, ErrorResponse{"Password is required"})
+			return
+		}
+
+		// The password is checked by a login, so a stolen access token can't be used to guess it
+		blocked, err := server.mfaManager.Blocked(ctx, mfa.SCOPE_DELETE, user.ID)
+		if err != nil {
+			util.LOGGER.Error("DELETE /api/profile: failed to get password attempts", "error", err)
+			ctx.JSON(http.StatusInternalServerError, ErrorResponse{"Internal server error"})
+			return
+		}
+		if blocked {
+			util.LOGGER.Warn("DELETE /api/profile: too many failed passwords", "id", user.ID)
+			ctx.JSON(http.StatusTooManyRequests, ErrorResponse{"Too many failed attempts, please try again later"})
+			return
+		}
+
+		url = fmt.Sprintf("%s/auth/login", server.config.DirectusAddr)
+		var login LoginResponse
+		body := map[string]any{"email": user.Email, "password": req.Password}
+		status, err = db.MakeRequest("POST", url, body, server.config.DirectusStaticToken, &login)
+		if err != nil {
+			util.LOGGER.Warn("DELETE /api/profile: password confirmation failed", "status", status, "error", err)
+			if status == http.StatusUnauthorized {
+				recordErr := server.mfaManager.RecordUserFailure(ctx, mfa.SCOPE_DELETE, user.ID)
+				if errors.Is(recordErr, mfa.ErrTooManyAttempts) {
+					ctx.JSON(http.StatusTooManyRequests, ErrorResponse{"Too many failed attempts, please try again later"})
+					return
+				}
+				if recordErr != nil {
+					util.LOGGER.Error("DELETE /api/profile: failed to record password failure", "error", recordErr)
+				}
+			}
+			server.DirectusError(ctx, err)
+			return
+		}
+
+		// The session was only opened to check the password
+		url = fmt.Sprintf("%s/auth/logout", server.config.DirectusAddr)
+		body = map[string]any{"refresh_token": login.RefreshToken}
+		if status, err := db.MakeRequest("POST", url, body, server.config.DirectusStaticToken, nil); err != nil {
+			util.LOGGER.Warn("DELETE /api/profile: failed to log out password confirmation session", "status", status, "error", err)
+		}
+	} else {
+		url = fmt.Sprintf("%s/items/user_identities?fields=id&filter[user_id][_eq]=%s&limit=1", server.config.DirectusAddr, user.ID)
+		var identities []db.UserIdentity
+		status, err = db.MakeRequest("GET", url, nil, server.config.DirectusStaticToken, &identities)
+		if err != nil {
+			util.LOGGER.Error("DELETE /api/profile: failed to get user identities", "status", status, "error", err)
+			server.DirectusError(ctx, err)
+			return
+		}
+
+		if len(identities) == 0 {
+			util.LOGGER.Warn("DELETE /api/profile: user has neither password nor social login", "id", user.ID)
+			ctx.JSON(http.StatusBadRequest, ErrorResponse{"Password is required"})
+			return
+		}
+	}
+
+	// Anonymize the user. The record itself is kept, since the bookings and payments reference it.
+	// The archived status prevents any further login
+	url = fmt.Sprintf("%s/users/%s", server.config.DirectusAddr, user.ID)
+	body := map[string]any{
+		"first_name":          "Deleted",
+		"last_name":           "User",
+		"email":               fmt.Sprintf("deleted-%s@deleted.invalid", user.ID),
+		"password":            util.RandomString(64),
+		"location":            nil,
+		"avatar":              nil,
+		"external_identifier": nil,
+		"tfa_secret":          nil,
+		"status":              "archived",
+	}
+	status, err = db.MakeRequest("PATCH", url, body, server.config.DirectusStaticToken, nil)
+	if err != nil {
+		util.LOGGER.Error("DELETE /api/profile: failed to anonymize user", "status", status, "error", err)
+		server.DirectusError(ctx, err)
+		return
+	}
+
+	// From here, the account is deleted, so the remaining cleanup shouldn't fail the request
+	if user.Avatar != "" {
+		url = fmt.Sprintf("%s/files/%s", server.config.DirectusAddr, user.Avatar)
+		if status, err := db.MakeRequest("DELETE", url, nil, server.config.DirectusStaticToken, nil); err != nil {
+			util.LOGGER.Error("DELETE /api/profile: failed to delete avatar", "status", status, "error", err)
+		}
+	}
+
+	for _, collection := range personalCollections {
+		url = fmt.Sprintf("%s/items/%s", server.config.DirectusAddr, collection)
+		body := map[string]any{"query": map[string]any{"filter": map[string]any{"user_id": map[string]any{"_eq": user.ID}}}}
+		if status, err := db.MakeRequest("DELETE", url, body, server.config.DirectusStaticToken, nil); err != nil {
+			util.LOGGER.Error("DELETE /api/profile: failed to delete personal records", "collection", collection, "status", status, "error", err)
+		}
+	}
+
+	server.revokeCredentials(ctx, user.ID)
+
+	err = server.distributor.DistributeTask(ctx, worker.DeleteDataExports, worker.DeleteDataExportsPayload{
+		UserID: user.ID,
+		Before: time.Now().Add(time.Hour).Unix(),
+	}, asynq.Queue(worker.LOW_IMPACT), asynq.MaxRetry(5))
+	if err != nil {
+		util.LOGGER.Error("DELETE /api/profile: failed to distribute task", "task", worker.DeleteDataExports, "error", err)
+	}
+
+	ctx.JSON(http.StatusOK, SuccessMessage{"Account deleted"})
+}
@@ -0,0 +1,203 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	neturl "net/url"
+	"strings"
+	"tekticket/db"
+	"tekticket/service/promo"
+	"tekticket/util"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Fields of a promo code
+var promoCodeFields = []string{
+	"id", "code", "status", "discount_type", "value", "max_discount", "event_id.id", "category_id.id", "ticket_rank",
+	"start_time", "end_time", "usage_limit", "per_user_limit", "stackable_with_membership",
+}
+
+type PromoCodeItem struct {
+	TicketID string `json:"ticket_id" binding:"required"`
+}
+
+type ValidatePromoCodeRequest struct {
+	Code    string          `json:"code" binding:"required"`
+	EventID string          `json:"event_id" binding:"required"`
+	Items   []PromoCodeItem `json:"items" binding:"required,min=1,dive"` // One item per ticket to book
+}
+
+type ValidatePromoCodeResponse struct {
+	Code         string      `json:"code"`
+	DiscountType string      `json:"discount_type"`
+	Value        float64     `json:"value"`
+	Quote        promo.Quote `json:"quote"` // Price of the tickets at their base price, with the discounts
+}
+
+// ValidatePromoCode godoc
+// @Summary      Validate a promo code
+// @Description  Checks a promo code for the tickets of an event before checkout, and prices them at their base price with the
+// @Description  membership discount of the current user and the code. A code that doesn't stack with the membership discount
+// @Description  is only used if it is the better discount. The code is not used until a booking is created with it
+// @Tags         Bookings
+// @Accept       json
+// @Produce      json
+// @Param        request  body      ValidatePromoCodeRequest  true  "Code and tickets"
+// @Success      200  {object}  ValidatePromoCodeResponse  "Code valid, with the price"
+// @Failure      400  {object}  ErrorResponse              "Invalid request body | Invalid request data | Promo code is not active | Promo code is not valid yet | Promo code has expired | Promo code does not apply to these tickets"
+// @Failure      401  {object}  ErrorResponse              "Unauthorized access | Token expired"
+// @Failure      403  {object}  ErrorResponse              "Invalid token"
+// @Failure      404  {object}  ErrorResponse              "No promo code with such code"
+// @Failure      409  {object}  ErrorResponse              "Promo code has reached its usage limit | You have reached the usage limit of this promo code | Event is canceled"
+// @Failure      429  {object}  ErrorResponse              "You hit the rate limit"
+// @Failure      500  {object}  ErrorResponse              "Internal server error"
+// @Security     BearerAuth
+// @Router       /api/promo-codes/validate [post]
+func (server *Server) ValidatePromoCode(ctx *gin.Context) {
+	userID, err := util.ExtractIDFromToken(server.GetToken(ctx))
+	if err != nil {
+		util.LOGGER.Error("POST /api/promo-codes/validate: failed to extract user ID from access token", "error", err)
+		ctx.JSON(http.StatusForbidden, ErrorResponse{"Invalid token"})
+		return
+	}
+
+	var req ValidatePromoCodeRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		util.LOGGER.Warn("POST /api/promo-codes/validate: failed to bind request body", "error", err)
+		ctx.JSON(http.StatusBadRequest, ErrorResponse{"Invalid request body"})
+		return
+	}
+
+	ticketIDs := make([]string, 0, len(req.Items))
+	for _, item := range req.Items {
+		ticketIDs = append(ticketIDs, item.TicketID)
+	}
+	checkout, ok := server.getCheckout(ctx, req.EventID, ticketIDs)
+	if !ok {
+		return
+	}
+	code, ok := server.checkPromoCode(ctx, req.Code, userID, checkout)
+	if !ok {
+		return
+	}
+
+	ctx.JSON(http.StatusOK, ValidatePromoCodeResponse{
+		Code:         code.Code,
+		DiscountType: code.DiscountType,
+		Value:        float64(code.Value),
+		Quote:        promo.Apply(code, checkout),
+	})
+}
+
+// Helper method: get the checkout of the tickets of an event booked by the current user: the tickets at their base price,
+// which must be of the event, and the membership discount of the user. A canceled event can't be booked. If failed, return
+// the error to client and false
+func (server *Server) getCheckout(ctx *gin.Context, eventID string, ticketIDs []string) (promo.Checkout, bool) {
+	caller := fmt.Sprintf("%s %s", ctx.Request.Method, ctx.FullPath())
+	checkout := promo.Checkout{EventID: eventID}
+
+	queryParams := neturl.Values{}
+	queryParams.Add("fields", "id,rank,base_price,event_id.status,event_id.category_id.id")
+	queryParams.Add("filter[id][_in]", strings.Join(ticketIDs, ","))
+	queryParams.Add("filter[event_id][_eq]", eventID)
+	queryParams.Add("limit", "-1")
+	url := fmt.Sprintf("%s/items/tickets?%s", server.config.DirectusAddr, queryParams.Encode())
+	var tickets []db.Ticket
+	if status, err := db.MakeRequest("GET", url, nil, server.config.DirectusStaticToken, &tickets); err != nil {
+		util.LOGGER.Error(caller+": failed to get tickets", "status", status, "error", err)
+		server.DirectusError(ctx, err)
+		return checkout, false
+	}
+	byID := make(map[string]db.Ticket, len(tickets))
+	for _, ticket := range tickets {
+		if ticket.Event != nil && ticket.Event.Status == EVENT_STATUS_CANCELED {
+			ctx.JSON(http.StatusConflict, ErrorResponse{"Event is canceled"})
+			return checkout, false
+		}
+		byID[ticket.ID] = ticket
+		if ticket.Event != nil && ticket.Event.Category != nil {
+			checkout.CategoryID = ticket.Event.Category.ID
+		}
+	}
+	for _, id := range ticketIDs {
+		ticket, ok := byID[id]
+		if !ok {
+			ctx.JSON(http.StatusBadRequest, ErrorResponse{"Invalid request data"})
+			return checkout, false
+		}
+		checkout.Items = append(checkout.Items, promo.Item{Price: ticket.BasePrice, TicketRank: ticket.Rank})
+	}
+
+	discount, ok := server.getMemberDiscount(ctx)
+	if !ok {
+		return checkout, false
+	}
+	if discount != nil {
+		checkout.MemberDiscount = *discount
+	}
+	return checkout, true
+}
+
+// Helper method: get a promo code, and check it for a checkout of a user: its status, validity window, scope and usage
+// limits. If failed, return the error to client and false
+func (server *Server) checkPromoCode(ctx *gin.Context, rawCode, userID string, checkout promo.Checkout) (*db.PromoCode, bool) {
+	caller := fmt.Sprintf("%s %s", ctx.Request.Method, ctx.FullPath())
+
+	queryParams := neturl.Values{}
+	queryParams.Add("fields", strings.Join(promoCodeFields, ","))
+	queryParams.Add("filter[code][_eq]", promo.Normalize(rawCode))
+	queryParams.Add("limit", "1")
+	url := fmt.Sprintf("%s/items/promo_codes?%s", server.config.DirectusAddr, queryParams.Encode())
+	var codes []db.PromoCode
+	if status, err := db.MakeRequest("GET", url, nil, server.config.DirectusStaticToken, &codes); err != nil {
+		util.LOGGER.Error(caller+": failed to get promo code", "status", status, "error", err)
+		server.DirectusError(ctx, err)
+		return nil, false
+	}
+	if len(codes) == 0 {
+		ctx.JSON(http.StatusNotFound, ErrorResponse{"No promo code with such code"})
+		return nil, false
+	}
+	code := codes[0]
+
+	now := time.Now()
+	if err := promo.Check(code, checkout, now); err != nil {
+		ctx.JSON(http.StatusBadRequest, ErrorResponse{promoErrorMessage(err)})
+		return nil, false
+	}
+
+	// The limits are checked again atomically when the code is held by a booking
+	total, used, err := server.promoCounter.Usage(ctx, code.ID, userID, now)
+	if err != nil {
+		util.LOGGER.Error(caller+": failed to get promo code usage", "error", err)
+		ctx.JSON(http.StatusInternalServerError, ErrorResponse{"Internal server error"})
+		return nil, false
+	}
+	if code.UsageLimit > 0 && total >= code.UsageLimit {
+		ctx.JSON(http.StatusConflict, ErrorResponse{promoErrorMessage(promo.ErrUsageLimit)})
+		return nil, false
+	}
+	if code.PerUserLimit > 0 && used >= code.PerUserLimit {
+		ctx.JSON(http.StatusConflict, ErrorResponse{promoErrorMessage(promo.ErrUserUsageLimit)})
+		return nil, false
+	}
+
+	return &code, true
+}
+
+// Helper function: message of a promo code error for the client
+func promoErrorMessage(err error) string {
+	for _, known := range []error{
+		promo.ErrCodeInactive, promo.ErrCodeNotStarted, promo.ErrCodeExpired, promo.ErrCodeNotApplicable,
+		promo.ErrUsageLimit, promo.ErrUserUsageLimit,
+	} {
+		if errors.Is(err, known) {
+			message := known.Error()
+			return strings.ToUpper(message[:1]) + message[1:]
+		}
+	}
+	return "Internal server error"
+}
@@ -0,0 +1,510 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	neturl "net/url"
+	"slices"
+	"strings"
+	"tekticket/db"
+	"tekticket/service/payment"
+	"tekticket/service/worker"
+	"tekticket/util"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// How long a purchase or a cancellation of a listing blocks the other operations on the same listing
+const RESALE_LOCK_TTL = time.Minute
+
+// Fields of a listing, as shown to the buyers
+var resaleListingFields = []string{
+	"id", "date_created", "status", "price", "reserved_until",
+	"booking_item_id.id", "booking_item_id.price",
+	"booking_item_id.ticket_id.id", "booking_item_id.ticket_id.rank", "booking_item_id.ticket_id.description",
+	"booking_item_id.seat_id.id", "booking_item_id.seat_id.seat_number",
+	"booking_item_id.event_schedule_id.id", "booking_item_id.event_schedule_id.start_time",
+	"booking_item_id.event_schedule_id.end_time",
+}
+
+// Fields of a listing, as shown to its seller
+var sellerResaleListingFields = append(slices.Clone(resaleListingFields),
+	"platform_fee", "payout", "payout_pending", "date_sold", "booking_item_id.booking_id.event_id.id", "booking_item_id.booking_id.event_id.name",
+)
+
+// Fields of a listing used to buy or cancel it
+var holdResaleListingFields = []string{
+	"id", "status", "price", "reserved_until", "seller_id.id", "buyer_id.id", "from_booking_id.id",
+	"booking_id.id", "booking_id.payments.id", "booking_id.payments.status", "booking_id.payments.transaction_id",
+	"booking_item_id.id", "booking_item_id.status", "booking_item_id.booking_id.id", "booking_item_id.booking_id.event_id.id",
+	"booking_item_id.event_schedule_id.start_time", "booking_item_id.event_schedule_id.start_checkin_time",
+}
+
+type CreateResaleListingRequest struct {
+	Price int `json:"price" binding:"required,min=100"` // Asked price in VND, capped over the original price of the ticket
+}
+
+type BuyResaleListingResponse struct {
+	BookingID      string       `json:"booking_id"` // Booking to pay through the payment endpoints
+	ListingID      string       `json:"listing_id"`
+	Price          int          `json:"price"`
+	FeeCharged     int          `json:"fee_charged"`
+	TotalPricePaid int          `json:"total_price_paid"` // Amount of the payment
+	ReservedUntil  *db.DateTime `json:"reserved_until"`   // The booking must be paid before, or the listing is on sale again
+}
+
+// CreateResaleListing godoc
+// @Summary      List a ticket for resale
+// @Description  Puts a ticket of a booking of the current user on sale on the resale marketplace. The price is capped at a
+// @Description  percentage over the original price of the ticket. Once sold, the ticket moves to the buyer with a new QR, and
+// @Description  the price minus the platform fee is paid out to the seller. The seller keeps the ticket until it is sold
+// @Tags         Resale
+// @Accept       json
+// @Produce      json
+// @Param        id       path      string                      true  "Booking ID"
+// @Param        itemId   path      string                      true  "Booking item ID"
+// @Param        request  body      CreateResaleListingRequest  true  "Asked price"
+// @Success      201  {object}  db.ResaleListing  "Ticket listed"
+// @Failure      400  {object}  ErrorResponse     "Invalid request body | Ticket is not issued yet | Check-in has started, the ticket can't be resold | Price must not exceed the cap"
+// @Failure      401  {object}  ErrorResponse     "Unauthorized access | Token expired"
+// @Failure      403  {object}  ErrorResponse     "Invalid token"
+// @Failure      404  {object}  ErrorResponse     "No item with such ID"
+// @Failure      409  {object}  ErrorResponse     "Ticket is already listed for resale | Ticket has a pending transfer"
+// @Failure      429  {object}  ErrorResponse     "You hit the rate limit"
+// @Failure      500  {object}  ErrorResponse     "Internal server error"
+// @Security     BearerAuth
+// @Router       /api/bookings/{id}/items/{itemId}/resale [post]
+func (server *Server) CreateResaleListing(ctx *gin.Context) {
+	token := server.GetToken(ctx)
+	userID, err := util.ExtractIDFromToken(token)
+	if err != nil {
+		util.LOGGER.Error("POST /api/bookings/:id/items/:itemId/resale: failed to extract user ID from access token", "error", err)
+		ctx.JSON(http.StatusForbidden, ErrorResponse{"Invalid token"})
+		return
+	}
+
+	var req CreateResaleListingRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		util.LOGGER.Warn("POST /api/bookings/:id/items/:itemId/resale: failed to bind request body", "error", err)
+		ctx.JSON(http.StatusBadRequest, ErrorResponse{"Invalid request body"})
+		return
+	}
+
+	// The item is read with the user's token, so that only the customer can resell it
+	id, itemID := ctx.Param("id"), ctx.Param("itemId")
+	fields := []string{
+		"id", "status", "price", "booking_id.id", "booking_id.customer_id.id",
+		"event_schedule_id.start_time", "event_schedule_id.start_checkin_time",
+	}
+	url := fmt.Sprintf("%s/items/booking_items/%s?fields=%s", server.config.DirectusAddr, itemID, strings.Join(fields, ","))
+	var item db.BookingItem
+	status, err := db.MakeRequest("GET", url, nil, token, &item)
+	if err != nil {
+		util.LOGGER.Error("POST /api/bookings/:id/items/:itemId/resale: failed to get booking item", "status", status, "error", err)
+		server.DirectusError(ctx, err)
+		return
+	}
+	if item.Booking == nil || item.Booking.ID != id || item.Booking.Customer == nil || item.Booking.Customer.ID != userID {
+		ctx.JSON(http.StatusNotFound, ErrorResponse{"No item with such ID"})
+		return
+	}
+	if item.Status != "valid" {
+		ctx.JSON(http.StatusBadRequest, ErrorResponse{"Ticket is not issued yet"})
+		return
+	}
+	if !server.transferAllowed(item) {
+		ctx.JSON(http.StatusBadRequest, ErrorResponse{"Check-in has started, the ticket can't be resold"})
+		return
+	}
+
+	policy := util.NewResalePolicy(server.config.Setting)
+	if maxPrice := policy.MaxPrice(item.Price); req.Price > maxPrice {
+		ctx.JSON(http.StatusBadRequest, ErrorResponse{fmt.Sprintf("Price must not exceed %d VND", maxPrice)})
+		return
+	}
+
+	// A ticket changes hands one way at a time
+	listed, status, err := server.hasActiveListing([]string{item.ID})
+	if err != nil {
+		util.LOGGER.Error("POST /api/bookings/:id/items/:itemId/resale: failed to get active listings", "status", status, "error", err)
+		server.DirectusError(ctx, err)
+		return
+	}
+	if listed {
+		ctx.JSON(http.StatusConflict, ErrorResponse{"Ticket is already listed for resale"})
+		return
+	}
+	transferring, status, err := server.hasPendingTransfer([]string{item.ID})
+	if err != nil {
+		util.LOGGER.Error("POST /api/bookings/:id/items/:itemId/resale: failed to get pending transfers", "status", status, "error", err)
+		server.DirectusError(ctx, err)
+		return
+	}
+	if transferring {
+		ctx.JSON(http.StatusConflict, ErrorResponse{"Ticket has a pending transfer"})
+		return
+	}
+
+	// The fee is settled when listing, so that the seller knows what they get
+	fee, payout := policy.Split(req.Price)
+	url = fmt.Sprintf("%s/items/resale_listings?fields=%s", server.config.DirectusAddr, strings.Join(sellerResaleListingFields, ","))
+	body := map[string]any{
+		"status":          worker.RESALE_STATUS_ACTIVE,
+		"price":           req.Price,
+		"platform_fee":    fee,
+		"payout":          payout,
+		"booking_item_id": item.ID,
+		"seller_id":       userID,
+		"from_booking_id": item.Booking.ID,
+	}
+	var listing db.ResaleListing
+	if status, err := db.MakeRequest("POST", url, body, server.config.DirectusStaticToken, &listing); err != nil {
+		util.LOGGER.Error("POST /api/bookings/:id/items/:itemId/resale: failed to create listing", "status", status, "error", err)
+		server.DirectusError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, listing)
+}
+
+// ListEventResaleListings godoc
+// @Summary      List the resale tickets of an event
+// @Description  Lists the tickets of an event on sale on the resale marketplace, cheapest first. The tickets held by a buyer
+// @Description  while they pay are not listed
+// @Tags         Resale
+// @Produce      json
+// @Param        id      path      string  true   "Event ID"
+// @Param        limit   query     int     false  "Maximum number of records to return (default: 50, max: 100)"
+// @Param        cursor  query     string  false  "Cursor of the next page, from the previous page"
+// @Param        sort    query     string  false  "Sort order: price (default), -price, -date_created or date_created"
+// @Success      200  {object}  Page[db.ResaleListing]   "List of listings"
+// @Failure      400  {object}  ValidationErrorResponse  "Invalid pagination parameters"
+// @Failure      429  {object}  ErrorResponse            "You hit the rate limit"
+// @Failure      500  {object}  ErrorResponse            "Internal server error"
+// @Router       /api/events/{id}/resale [get]
+func (server *Server) ListEventResaleListings(ctx *gin.Context) {
+	queryParams := neturl.Values{}
+	queryParams.Add("fields", strings.Join(resaleListingFields, ","))
+	queryParams.Add("filter[booking_item_id][booking_id][event_id][_eq]", ctx.Param("id"))
+	queryParams.Add("filter[status][_eq]", worker.RESALE_STATUS_ACTIVE)
+	queryParams.Add("filter[_or][0][reserved_until][_null]", "true")
+	queryParams.Add("filter[_or][1][reserved_until][_lt]", time.Now().UTC().Format(time.RFC3339))
+
+	pagination, ok := server.parsePagination(ctx, "price", "price", "-price", "-date_created", "date_created")
+	if !ok {
+		return
+	}
+
+	url := fmt.Sprintf("%s/items/resale_listings", server.config.DirectusAddr)
+	page, status, err := listPage[db.ResaleListing](url, queryParams, pagination, server.config.DirectusStaticToken)
+	if err != nil {
+		util.LOGGER.Error("GET /api/events/:id/resale: failed to get listings", "status", status, "error", err)
+		server.DirectusError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, page)
+}
+
+// ListResaleListings godoc
+// @Summary      List my resale listings
+// @Description  Lists the tickets the current user listed for resale, newest first, with the platform fee and the payout
+// @Tags         Resale
+// @Produce      json
+// @Param        limit   query     int     false  "Maximum number of records to return (default: 50, max: 100)"
+// @Param        cursor  query     string  false  "Cursor of the next page, from the previous page"
+// @Param        sort    query     string  false  "Sort order: -date_created (default) or date_created"
+// @Param        status  query     string  false  "Status filter"  Enums(active, sold, canceled)
+// @Success      200  {object}  Page[db.ResaleListing]   "List of listings"
+// @Failure      400  {object}  ValidationErrorResponse  "Invalid pagination parameters"
+// @Failure      401  {object}  ErrorResponse            "Unauthorized access | Token expired"
+// @Failure      403  {object}  ErrorResponse            "Invalid token"
+// @Failure      429  {object}  ErrorResponse            "You hit the rate limit"
+// @Failure      500  {object}  ErrorResponse            "Internal server error"
+// @Security     BearerAuth
+// @Router       /api/resale [get]
+func (server *Server) ListResaleListings(ctx *gin.Context) {
+	userID, err := util.ExtractIDFromToken(server.GetToken(ctx))
+	if err != nil {
+		util.LOGGER.Error("GET /api/resale: failed to extract user ID from access token", "error", err)
+		ctx.JSON(http.StatusForbidden, ErrorResponse{"Invalid token"})
+		return
+	}
+
+	queryParams := neturl.Values{}
+	queryParams.Add("fields", strings.Join(sellerResaleListingFields, ","))
+	queryParams.Add("filter[seller_id][_eq]", userID)
+	if status := ctx.Query("status"); status != "" {
+		queryParams.Add("filter[status][_eq]", status)
+	}
+
+	pagination, ok := server.parsePagination(ctx, "-date_created", "-date_created", "date_created")
+	if !ok {
+		return
+	}
+
+	url := fmt.Sprintf("%s/items/resale_listings", server.config.DirectusAddr)
+	page, status, err := listPage[db.ResaleListing](url, queryParams, pagination, server.config.DirectusStaticToken)
+	if err != nil {
+		util.LOGGER.Error("GET /api/resale: failed to get listings", "status", status, "error", err)
+		server.DirectusError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, page)
+}
+
+// BuyResaleListing godoc
+// @Summary      Buy a resale ticket
+// @Description  Holds a listing for the current user and creates their booking for it, to pay through the payment endpoints
+// @Description  like any booking. The listing is held until reserved_until; once paid, the ticket moves to the booking with a
+// @Description  new QR, and the seller is paid out. Buying again while holding the listing returns the same booking
+// @Tags         Resale
+// @Produce      json
+// @Param        id   path      string  true  "Listing ID"
+// @Success      200  {object}  BuyResaleListingResponse  "Listing held, booking to pay"
+// @Failure      400  {object}  ErrorResponse             "You can't buy your own ticket"
+// @Failure      401  {object}  ErrorResponse             "Unauthorized access | Token expired"
+// @Failure      403  {object}  ErrorResponse             "Invalid token"
+// @Failure      404  {object}  ErrorResponse             "No item with such ID"
+// @Failure      409  {object}  ErrorResponse             "Listing is not for sale | Listing is held by another buyer | Listing is being updated, please retry | The ticket can't be resold anymore"
+// @Failure      429  {object}  ErrorResponse             "You hit the rate limit"
+// @Failure      500  {object}  ErrorResponse             "Internal server error"
+// @Security     BearerAuth
+// @Router       /api/resale/{id}/buy [post]
+func (server *Server) BuyResaleListing(ctx *gin.Context) {
+	userID, err := util.ExtractIDFromToken(server.GetToken(ctx))
+	if err != nil {
+		util.LOGGER.Error("POST /api/resale/:id/buy: failed to extract user ID from access token", "error", err)
+		ctx.JSON(http.StatusForbidden, ErrorResponse{"Invalid token"})
+		return
+	}
+
+	listing, ok := server.lockResaleListing(ctx)
+	if !ok {
+		return
+	}
+	defer server.queries.Cache.Del(ctx, resaleLockKey(listing.ID))
+
+	if listing.Status != worker.RESALE_STATUS_ACTIVE {
+		ctx.JSON(http.StatusConflict, ErrorResponse{"Listing is not for sale"})
+		return
+	}
+	if listing.Seller != nil && listing.Seller.ID == userID {
+		ctx.JSON(http.StatusBadRequest, ErrorResponse{"You can't buy your own ticket"})
+		return
+	}
+
+	policy := util.NewResalePolicy(server.config.Setting)
+	response := BuyResaleListingResponse{ListingID: listing.ID, Price: listing.Price}
+	response.FeeCharged = util.PaymentFee(listing.Price, server.config.PaymentFeePercent)
+	response.TotalPricePaid = listing.Price + response.FeeCharged
+
+	// Buying again while holding the listing returns the same booking
+	if resaleHeld(*listing, time.Now()) {
+		if listing.Buyer == nil || listing.Buyer.ID != userID || listing.Booking == nil {
+			ctx.JSON(http.StatusConflict, ErrorResponse{"Listing is held by another buyer"})
+			return
+		}
+		response.BookingID, response.ReservedUntil = listing.Booking.ID, listing.ReservedUntil
+		ctx.JSON(http.StatusOK, response)
+		return
+	}
+	if !server.releaseResaleHold(ctx, listing) {
+		return
+	}
+
+	// The ticket must still be on sale in the booking of the seller
+	item := listing.BookingItem
+	if item == nil || item.Status != "valid" || item.Booking == nil || listing.FromBooking == nil ||
+		item.Booking.ID != listing.FromBooking.ID || !server.transferAllowed(*item) {
+		ctx.JSON(http.StatusConflict, ErrorResponse{"The ticket can't be resold anymore"})
+		return
+	}
+
+	// Booking of the buyer, paid through the normal payment flow. The ticket joins it once paid
+	url := fmt.Sprintf("%s/items/bookings?fields=id", server.config.DirectusAddr)
+	body := map[string]any{
+		"customer_id":       userID,
+		"status":            "pending",
+		"resale_listing_id": listing.ID,
+	}
+	if item.Booking.Event != nil {
+		body["event_id"] = item.Booking.Event.ID
+	}
+	var booking db.Booking
+	if status, err := db.MakeRequest("POST", url, body, server.config.DirectusStaticToken, &booking); err != nil {
+		util.LOGGER.Error("POST /api/resale/:id/buy: failed to create booking of buyer", "status", status, "error", err)
+		server.DirectusError(ctx, err)
+		return
+	}
+
+	reservedUntil := db.DateTime(time.Now().Add(policy.Hold).UTC())
+	url = fmt.Sprintf("%s/items/resale_listings/%s", server.config.DirectusAddr, listing.ID)
+	body = map[string]any{
+		"buyer_id":       userID,
+		"booking_id":     booking.ID,
+		"reserved_until": time.Time(reservedUntil).Format(time.RFC3339),
+	}
+	if status, err := db.MakeRequest("PATCH", url, body, server.config.DirectusStaticToken, nil); err != nil {
+		util.LOGGER.Error("POST /api/resale/:id/buy: failed to hold listing", "status", status, "error", err)
+		server.DirectusError(ctx, err)
+		return
+	}
+
+	response.BookingID, response.ReservedUntil = booking.ID, &reservedUntil
+	ctx.JSON(http.StatusOK, response)
+}
+
+// CancelResaleListing godoc
+// @Summary      Cancel a resale listing
+// @Description  Takes a ticket of the current user off the resale marketplace. A listing held by a buyer can't be canceled
+// @Description  until the hold ends
+// @Tags         Resale
+// @Produce      json
+// @Param        id   path      string  true  "Listing ID"
+// @Success      200  {object}  SuccessMessage  "Listing canceled"
+// @Failure      401  {object}  ErrorResponse   "Unauthorized access | Token expired"
+// @Failure      403  {object}  ErrorResponse   "Invalid token"
+// @Failure      404  {object}  ErrorResponse   "No item with such ID"
+// @Failure      409  {object}  ErrorResponse   "Listing is not for sale | Listing is held by a buyer | Listing is being updated, please retry"
+// @Failure      429  {object}  ErrorResponse   "You hit the rate limit"
+// @Failure      500  {object}  ErrorResponse   "Internal server error"
+// @Security     BearerAuth
+// @Router       /api/resale/{id} [delete]
+func (server *Server) CancelResaleListing(ctx *gin.Context) {
+	userID, err := util.ExtractIDFromToken(server.GetToken(ctx))
+	if err != nil {
+		util.LOGGER.Error("DELETE /api/resale/:id: failed to extract user ID from access token", "error", err)
+		ctx.JSON(http.StatusForbidden, ErrorResponse{"Invalid token"})
+		return
+	}
+
+	listing, ok := server.lockResaleListing(ctx)
+	if !ok {
+		return
+	}
+	defer server.queries.Cache.Del(ctx, resaleLockKey(listing.ID))
+
+	// Listings of other users don't exist for this user
+	if listing.Seller == nil || listing.Seller.ID != userID {
+		ctx.JSON(http.StatusNotFound, ErrorResponse{"No item with such ID"})
+		return
+	}
+	if listing.Status != worker.RESALE_STATUS_ACTIVE {
+		ctx.JSON(http.StatusConflict, ErrorResponse{"Listing is not for sale"})
+		return
+	}
+	if resaleHeld(*listing, time.Now()) {
+		ctx.JSON(http.StatusConflict, ErrorResponse{"Listing is held by a buyer"})
+		return
+	}
+	if !server.releaseResaleHold(ctx, listing) {
+		return
+	}
+
+	url := fmt.Sprintf("%s/items/resale_listings/%s", server.config.DirectusAddr, listing.ID)
+	body := map[string]any{"status": worker.RESALE_STATUS_CANCELED}
+	if status, err := db.MakeRequest("PATCH", url, body, server.config.DirectusStaticToken, nil); err != nil {
+		util.LOGGER.Error("DELETE /api/resale/:id: failed to cancel listing", "status", status, "error", err)
+		server.DirectusError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, SuccessMessage{"Listing canceled"})
+}
+
+// Helper method: get the listing of the path parameter, and lock it against concurrent purchases and cancellations. Write
+// the error response and return false otherwise
+func (server *Server) lockResaleListing(ctx *gin.Context) (*db.ResaleListing, bool) {
+	caller := fmt.Sprintf("%s %s", ctx.Request.Method, ctx.FullPath())
+
+	url := fmt.Sprintf(
+		"%s/items/resale_listings/%s?fields=%s",
+		server.config.DirectusAddr, neturl.PathEscape(ctx.Param("id")), strings.Join(holdResaleListingFields, ","),
+	)
+	var listing db.ResaleListing
+	if status, err := db.MakeRequest("GET", url, nil, server.config.DirectusStaticToken, &listing); err != nil {
+		util.LOGGER.Error(caller+": failed to get listing", "status", status, "error", err)
+		server.DirectusError(ctx, err)
+		return nil, false
+	}
+
+	locked, err := server.queries.Cache.SetNX(ctx, resaleLockKey(listing.ID), 1, RESALE_LOCK_TTL).Result()
+	if err != nil {
+		util.LOGGER.Error(caller+": failed to lock listing", "error", err)
+		ctx.JSON(http.StatusInternalServerError, ErrorResponse{"Internal server error"})
+		return nil, false
+	}
+	if !locked {
+		ctx.JSON(http.StatusConflict, ErrorResponse{"Listing is being updated, please retry"})
+		return nil, false
+	}
+
+	return &listing, true
+}
+
+// Helper method: end the expired hold of the previous buyer of a listing, if any. Their payment can't be confirmed anymore:
+// its pending intent is canceled in Stripe, and their booking is canceled. A payment already being processed or successful
+// keeps the hold, since the confirmation of the booking moves the ticket. Write the error response and return false if the
+// hold can't be ended
+func (server *Server) releaseResaleHold(ctx *gin.Context, listing *db.ResaleListing) bool {
+	if listing.Booking == nil {
+		return true
+	}
+	caller := fmt.Sprintf("%s %s", ctx.Request.Method, ctx.FullPath())
+
+	for _, paymentInfo := range listing.Booking.Payments {
+		switch paymentInfo.Status {
+		case "processing", "success":
+			ctx.JSON(http.StatusConflict, ErrorResponse{"Listing is held by another buyer"})
+			return false
+		case "pending":
+			if paymentInfo.TransactionID != "" {
+				if err := payment.CancelPaymentIntent(paymentInfo.TransactionID); err != nil {
+					util.LOGGER.Warn(caller+": failed to cancel payment intent of previous buyer", "payment_id", paymentInfo.ID, "error", err)
+					ctx.JSON(http.StatusConflict, ErrorResponse{"Listing is held by another buyer"})
+					return false
+				}
+			}
+			server.issueCommand(ctx, worker.SetPaymentStatusPayload{
+				PaymentID:      paymentInfo.ID,
+				Status:         "failed",
+				PreviousStatus: "pending",
+				Reason:         "hold of resale listing expired",
+			})
+		}
+	}
+
+	url := fmt.Sprintf("%s/items/bookings/%s", server.config.DirectusAddr, listing.Booking.ID)
+	if status, err := db.MakeRequest("PATCH", url, map[string]any{"status": "canceled"}, server.config.DirectusStaticToken, nil); err != nil {
+		util.LOGGER.Error(caller+": failed to cancel booking of previous buyer", "status", status, "error", err)
+		server.DirectusError(ctx, err)
+		return false
+	}
+	return true
+}
+
+// Helper method: check whether some of the items are listed for resale
+func (server *Server) hasActiveListing(itemIDs []string) (bool, int, error) {
+	queryParams := neturl.Values{}
+	queryParams.Add("fields", "id")
+	queryParams.Add("filter[booking_item_id][_in]", strings.Join(itemIDs, ","))
+	queryParams.Add("filter[status][_eq]", worker.RESALE_STATUS_ACTIVE)
+	queryParams.Add("limit", "1")
+	url := fmt.Sprintf("%s/items/resale_listings?%s", server.config.DirectusAddr, queryParams.Encode())
+	var listings []db.ResaleListing
+	status, err := db.MakeRequest("GET", url, nil, server.config.DirectusStaticToken, &listings)
+	return len(listings) != 0, status, err
+}
+
+// Helper function: whether a buyer still holds a listing to pay for it
+func resaleHeld(listing db.ResaleListing, now time.Time) bool {
+	return listing.Booking != nil && listing.ReservedUntil != nil && now.Before(time.Time(*listing.ReservedUntil))
+}
+
+// Helper function: Redis key of the lock of a listing
+func resaleLockKey(listingID string) string {
+	return "resale:lock:" + listingID
+}
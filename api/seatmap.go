@@ -0,0 +1,200 @@
+package api
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	neturl "net/url"
+	"strings"
+	"tekticket/db"
+	"tekticket/service/seatmap"
+	"tekticket/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Number of seats created per Directus request
+const SEAT_BATCH_SIZE = 500
+
+// Maximum size of an imported seat map file
+const MAX_SEAT_MAP_FILE_SIZE = 1 << 20
+
+type SeatMapRequest struct {
+	Layout   *seatmap.Layout `json:"layout"`   // Compact layout to generate the seats from
+	Filename string          `json:"filename"` // Name of the imported file, its extension tells the format (.csv or .json)
+	File     string          `json:"file"`     // Base64 content of the imported file
+}
+
+type SeatMapResponse struct {
+	TotalSeats int            `json:"total_seats"`
+	Seats      []seatmap.Seat `json:"seats"`
+}
+
+// Helper method: count the seats of a seat zone
+func (server *Server) countZoneSeats(zoneID string) (int, int, error) {
+	// Directus returns the count as a string or a number, depending on the database
+	var result []struct {
+		Count struct {
+			ID db.DecimalFloat `json:"id"`
+		} `json:"count"`
+	}
+	url := fmt.Sprintf(
+		"%s/items/seats?aggregate[count]=id&filter[seat_zone_id][_eq]=%s",
+		server.config.DirectusAddr,
+		neturl.QueryEscape(zoneID),
+	)
+	status, err := db.MakeRequest("GET", url, nil, server.config.DirectusStaticToken, &result)
+	if err != nil {
+		return 0, status, err
+	}
+
+	if len(result) == 0 {
+		return 0, status, nil
+	}
+	return int(result[0].Count.ID), status, nil
+}
+
+// Helper method: delete every seat of a seat zone
+func (server *Server) deleteZoneSeats(zoneID string) (int, error) {
+	url := fmt.Sprintf("%s/items/seats", server.config.DirectusAddr)
+	body := map[string]any{"query": map[string]any{"filter": map[string]any{"seat_zone_id": map[string]any{"_eq": zoneID}}}}
+	return db.MakeRequest("DELETE", url, body, server.config.DirectusStaticToken, nil)
+}
+
+// ImportSeatMap godoc
+// @Summary      Import seat map
+// @Description  Replaces the seats of a seat zone of an event created by the current organizer, and sets the total seats of
+// @Description  the zone to the number of seats. The seats are either generated from a compact layout, like
+// @Description  {"rows": "A-J", "seats_per_row": 20, "aisles": [5, 15], "skip": ["13", "A1"]}, or imported from a base64
+// @Description  CSV file (columns seat_number, and optionally row, x and y) or JSON file (an array of seats, or a layout).
+// @Description  Not allowed once the event has bookings
+// @Tags         Organizer
+// @Accept       json
+// @Produce      json
+// @Param        id       path  string          true  "Event ID"
+// @Param        zoneID   path  string          true  "Seat zone ID"
+// @Param        request  body  SeatMapRequest  true  "Layout or file"
+// @Success      201  {object}  SeatMapResponse  "Seats created"
+// @Failure      400  {object}  ErrorResponse    "Invalid request body | Invalid seat map"
+// @Failure      401  {object}  ErrorResponse    "Unauthorized access | Token expired"
+// @Failure      403  {object}  ErrorResponse    "Invalid token | You don't have permission to perform this request"
+// @Failure      404  {object}  ErrorResponse    "No item with such ID"
+// @Failure      409  {object}  ErrorResponse    "Event already has bookings"
+// @Failure      413  {object}  ErrorResponse    "Seat map file too large"
+// @Failure      429  {object}  ErrorResponse    "You hit the rate limit"
+// @Failure      500  {object}  ErrorResponse    "Internal server error"
+// @Security     BearerAuth
+// @Router       /api/organizer/events/{id}/seat-zones/{zoneID}/seats [post]
+func (server *Server) ImportSeatMap(ctx *gin.Context) {
+	var req SeatMapRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		util.LOGGER.Warn("POST /api/organizer/events/:id/seat-zones/:zoneID/seats: failed to bind request body", "error", err)
+		ctx.JSON(http.StatusBadRequest, ErrorResponse{"Invalid request body"})
+		return
+	}
+
+	// Build the seats first, it doesn't need any request to Directus
+	var (
+		seats []seatmap.Seat
+		err   error
+	)
+	switch {
+	case req.Layout != nil:
+		seats, err = seatmap.Generate(*req.Layout)
+	case strings.TrimSpace(req.File) != "":
+		if base64.StdEncoding.DecodedLen(len(req.File)) > MAX_SEAT_MAP_FILE_SIZE {
+			util.LOGGER.Warn("POST /api/organizer/events/:id/seat-zones/:zoneID/seats: file too large", "size", len(req.File))
+			ctx.JSON(http.StatusRequestEntityTooLarge, ErrorResponse{"Seat map file too large"})
+			return
+		}
+
+		data, decodeErr := base64.StdEncoding.DecodeString(strings.TrimSpace(req.File))
+		if decodeErr != nil {
+			util.LOGGER.Warn("POST /api/organizer/events/:id/seat-zones/:zoneID/seats: failed to decode file", "error", decodeErr)
+			ctx.JSON(http.StatusBadRequest, ErrorResponse{"Invalid base64 value for file"})
+			return
+		}
+		seats, err = seatmap.Parse(req.Filename, data)
+	default:
+		ctx.JSON(http.StatusBadRequest, ErrorResponse{"Either layout or file is required"})
+		return
+	}
+
+	if errors.Is(err, seatmap.ErrInvalidSeatMap) {
+		util.LOGGER.Warn("POST /api/organizer/events/:id/seat-zones/:zoneID/seats: invalid seat map", "error", err)
+		message := strings.TrimPrefix(err.Error(), seatmap.ErrInvalidSeatMap.Error()+": ")
+		ctx.JSON(http.StatusBadRequest, ErrorResponse{"Invalid seat map: " + message})
+		return
+	}
+	if err != nil {
+		util.LOGGER.Error("POST /api/organizer/events/:id/seat-zones/:zoneID/seats: failed to build seat map", "error", err)
+		ctx.JSON(http.StatusInternalServerError, ErrorResponse{"Internal server error"})
+		return
+	}
+
+	organizerID, ok := server.requireOrganizer(ctx)
+	if !ok {
+		return
+	}
+
+	event, ok := server.getOrganizerEvent(ctx, organizerID)
+	if !ok {
+		return
+	}
+
+	zoneID := ctx.Param("zoneID")
+	if !server.checkEventItem(ctx, "seat_zones", zoneID, "filter[event_id][_eq]", event.ID) {
+		return
+	}
+
+	// Bookings reference the seats
+	if !server.checkEventWithoutBookings(ctx, event.ID) {
+		return
+	}
+
+	if status, err := server.deleteZoneSeats(zoneID); err != nil {
+		util.LOGGER.Error("POST /api/organizer/events/:id/seat-zones/:zoneID/seats: failed to delete old seats", "status", status, "error", err)
+		server.DirectusError(ctx, err)
+		return
+	}
+
+	// Create the seats in batches. A batch is created in a single transaction by Directus, but the batches are not, so
+	// on failure the seats of the previous batches are deleted, and the zone is left without seats
+	url := fmt.Sprintf("%s/items/seats", server.config.DirectusAddr)
+	for start := 0; start < len(seats); start += SEAT_BATCH_SIZE {
+		batch := seats[start:min(start+SEAT_BATCH_SIZE, len(seats))]
+
+		body := make([]map[string]any, 0, len(batch))
+		for _, seat := range batch {
+			body = append(body, map[string]any{
+				"seat_number":  seat.SeatNumber,
+				"row":          seat.Row,
+				"x":            seat.X,
+				"y":            seat.Y,
+				"status":       seatmap.SEAT_STATUS_AVAILABLE,
+				"seat_zone_id": zoneID,
+			})
+		}
+
+		if status, err := db.MakeRequest("POST", url, body, server.config.DirectusStaticToken, nil); err != nil {
+			util.LOGGER.Error("POST /api/organizer/events/:id/seat-zones/:zoneID/seats: failed to create seats", "status", status, "error", err)
+			if status, err := server.deleteZoneSeats(zoneID); err != nil {
+				util.LOGGER.Error("POST /api/organizer/events/:id/seat-zones/:zoneID/seats: failed to clean up seats", "status", status, "error", err)
+			}
+			server.DirectusError(ctx, err)
+			return
+		}
+	}
+
+	// Keep the total seats of the zone consistent with its seat map
+	url = fmt.Sprintf("%s/items/seat_zones/%s", server.config.DirectusAddr, zoneID)
+	body := map[string]any{"total_seats": len(seats)}
+	if status, err := db.MakeRequest("PATCH", url, body, server.config.DirectusStaticToken, nil); err != nil {
+		util.LOGGER.Error("POST /api/organizer/events/:id/seat-zones/:zoneID/seats: failed to update total seats", "status", status, "error", err)
+		server.DirectusError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, SeatMapResponse{TotalSeats: len(seats), Seats: seats})
+}
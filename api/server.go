@@ -9,10 +9,19 @@ import (
 	"tekticket/db"
 	_ "tekticket/docs"
 	"tekticket/service/bot"
+	"tekticket/service/mfa"
 	"tekticket/service/notify"
+	"tekticket/service/oauth"
+	"tekticket/service/otp"
+	"tekticket/service/promo"
+	"tekticket/service/ratelimit"
+	"tekticket/service/session"
 	"tekticket/service/uploader"
+	"tekticket/service/waitlist"
+	"tekticket/service/wallet"
 	"tekticket/service/worker"
 	"tekticket/util"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/hibiken/asynq"
@@ -31,11 +40,20 @@ type Server struct {
 	queries *db.Queries
 
 	// Dependencies
-	distributor   worker.TaskDistributor
-	mailService   notify.MailService
-	uploadService *uploader.Uploader
-	bot           *bot.Chatbot
-	config        *util.Config
+	distributor    worker.TaskDistributor
+	mailService    notify.MailService
+	uploadService  *uploader.Uploader
+	bot            *bot.Chatbot
+	limiter        *ratelimit.Limiter
+	promoCounter   *promo.Counter
+	waitlist       *waitlist.Queue
+	otpManager     *otp.Manager
+	sessions       *session.Manager
+	mfaManager     *mfa.Manager
+	oauthManager   *oauth.Manager
+	walletIssuer   *wallet.Issuer
+	walletRegistry *wallet.Registry
+	config         *util.Config
 }
 
 // Constructor method for server struct
@@ -47,15 +65,62 @@ func NewServer(
 	bot *bot.Chatbot,
 	config *util.Config,
 ) *Server {
+	// The client IP keys the rate limits, so the X-Forwarded-For header is only read from the configured proxies
+	router := gin.Default()
+	if err := router.SetTrustedProxies(config.TrustedProxies); err != nil {
+		util.LOGGER.Error("invalid trusted proxies, trust none", "proxies", config.TrustedProxies, "error", err)
+		router.SetTrustedProxies(nil)
+	}
+
 	return &Server{
-		router:        gin.Default(),
+		router:        router,
 		queries:       queries,
 		distributor:   distributor,
 		uploadService: uploadService,
 		mailService:   mailService,
 		bot:           bot,
-		config:        config,
+		limiter:       ratelimit.NewLimiter(queries.Cache),
+		promoCounter:  promo.NewCounter(queries.Cache),
+		waitlist:      waitlist.NewQueue(queries.Cache),
+		otpManager:    otp.NewManager(queries.Cache, config.SecretKey),
+		sessions: session.NewManager(
+			queries.Cache,
+			config.SecretKey,
+			config.DirectusAddr,
+			config.DirectusStaticToken,
+		),
+		mfaManager:     mfa.NewManager(queries.Cache, config.SecretKey),
+		oauthManager:   newOAuthManager(queries, config),
+		walletIssuer:   wallet.NewIssuer(config),
+		walletRegistry: wallet.NewRegistry(queries.Cache),
+		config:         config,
+	}
+}
+
+// Helper function: create the social login manager with the providers that have a client ID configured
+func newOAuthManager(queries *db.Queries, config *util.Config) *oauth.Manager {
+	var providers []*oauth.Provider
+	if config.GoogleClientID != "" {
+		providers = append(providers, oauth.NewProvider(
+			oauth.GoogleConfig(config.GoogleClientID, config.GoogleClientSecret, config.OAuthRedirectURL),
+		))
+	}
+
+	if config.OIDCClientID != "" && config.OIDCIssuer != "" {
+		name := config.OIDCProviderName
+		if name == "" {
+			name = "oidc"
+		}
+		providers = append(providers, oauth.NewProvider(oauth.ProviderConfig{
+			Name:         name,
+			Issuer:       config.OIDCIssuer,
+			ClientID:     config.OIDCClientID,
+			ClientSecret: config.OIDCClientSecret,
+			RedirectURL:  config.OAuthRedirectURL,
+		}))
 	}
+
+	return oauth.NewManager(queries.Cache, providers...)
 }
 
 // Helper method to register handler for API
@@ -69,6 +134,16 @@ func (server *Server) RegisterHandler() {
 	})
 	server.router.Any("/monitoring/*a", gin.WrapH(h))
 
+	// Rate limit rules. Auth endpoints are strict since they are the target of brute force and email spamming
+	authLimit := ratelimit.Rule{Limit: server.config.AuthRateLimit, Window: time.Minute}
+	if authLimit.Limit <= 0 {
+		authLimit.Limit = DEFAULT_AUTH_RATE_LIMIT
+	}
+	eventLimit := ratelimit.Rule{Limit: server.config.EventRateLimit, Window: time.Minute}
+	if eventLimit.Limit <= 0 {
+		eventLimit.Limit = DEFAULT_EVENT_RATE_LIMIT
+	}
+
 	// API routes
 	api := server.router.Group("/api")
 	{
@@ -79,14 +154,17 @@ func (server *Server) RegisterHandler() {
 		// Auth routes
 		auth := api.Group("/auth")
 		{
-			auth.POST("/register", server.Register)
-			auth.POST("/verify/:id", server.VerifyAccount)
-			auth.POST("/resend-otp/:id", server.ResendOTP)
-			auth.POST("/login", server.Login)
+			auth.POST("/register", server.RateLimitMiddleware("register", authLimit), server.Register)
+			auth.POST("/verify/:id", server.RateLimitMiddleware("verify", authLimit), server.VerifyAccount)
+			auth.POST("/resend-otp/:id", server.RateLimitMiddleware("resend-otp", authLimit), server.ResendOTP)
+			auth.POST("/login", server.RateLimitMiddleware("login", authLimit), server.Login)
+			auth.POST("/login/mfa", server.RateLimitMiddleware("login-mfa", authLimit), server.LoginMFA)
+			auth.GET("/oauth/:provider", server.RateLimitMiddleware("oauth", authLimit), server.OAuthAuthorize)
+			auth.POST("/oauth/callback", server.RateLimitMiddleware("oauth-callback", authLimit), server.OAuthCallback)
 			auth.POST("/logout", server.Logout)
 			auth.POST("/refresh", server.RefreshToken)
-			auth.POST("/password/request", server.SendResetPasswordRequest)
-			auth.POST("/password/reset", server.ResetPassword)
+			auth.POST("/password/request", server.RateLimitMiddleware("password-request", authLimit), server.SendResetPasswordRequest)
+			auth.POST("/password/reset", server.RateLimitMiddleware("password-reset", authLimit), server.ResetPassword)
 		}
 
 		// Profile routes
@@ -94,6 +172,49 @@ func (server *Server) RegisterHandler() {
 		{
 			profile.GET("", server.GetProfile)
 			profile.PUT("", server.UpdateProfile)
+			profile.DELETE("", server.RateLimitMiddleware("delete-profile", authLimit), server.DeleteProfile)
+			profile.GET("/export", server.ExportProfile)
+			profile.GET("/sessions", server.ListSessions)
+			profile.DELETE("/sessions", server.RevokeAllSessions)
+			profile.DELETE("/sessions/:id", server.RevokeSession)
+			profile.POST("/mfa/enroll", server.RateLimitMiddleware("mfa", authLimit), server.EnrollMFA)
+			profile.POST("/mfa/verify", server.RateLimitMiddleware("mfa", authLimit), server.VerifyMFA)
+			profile.POST("/mfa/recovery-codes", server.RateLimitMiddleware("mfa", authLimit), server.RegenerateRecoveryCodes)
+			profile.DELETE("/mfa", server.RateLimitMiddleware("mfa", authLimit), server.DisableMFA)
+			profile.POST("/calendar", server.CreateCalendarFeed)
+			profile.DELETE("/calendar", server.DeleteCalendarFeed)
+		}
+
+		// Data export download, authenticated by the token of the link sent by email
+		api.GET("/exports/download", server.DownloadDataExport)
+
+		// Calendar feed, authenticated by the token of its URL
+		api.GET("/calendar/feed.ics", server.RateLimitMiddleware("calendar", eventLimit), server.GetCalendarFeed)
+
+		// Organizer routes: manage the events created by the organizer
+		organizer := api.Group("/organizer", server.AuthMiddleware())
+		{
+			organizer.GET("/events", server.ListOrganizerEvents)
+			organizer.POST("/events", server.CreateEvent)
+			organizer.GET("/events/:id", server.GetOrganizerEvent)
+			organizer.PUT("/events/:id", server.UpdateEvent)
+			organizer.POST("/events/:id/publish", server.PublishEvent)
+			organizer.POST("/events/:id/unpublish", server.UnpublishEvent)
+			organizer.POST("/events/:id/cancel", server.CancelEvent)
+			organizer.GET("/events/:id/cancel", server.GetEventCancellation)
+			organizer.POST("/events/:id/schedules", server.CreateEventSchedule)
+			organizer.PUT("/events/:id/schedules/:scheduleID", server.UpdateEventSchedule)
+			organizer.DELETE("/events/:id/schedules/:scheduleID", server.DeleteEventSchedule)
+			organizer.POST("/events/:id/seat-zones", server.CreateSeatZone)
+			organizer.PUT("/events/:id/seat-zones/:zoneID", server.UpdateSeatZone)
+			organizer.DELETE("/events/:id/seat-zones/:zoneID", server.DeleteSeatZone)
+			organizer.POST("/events/:id/seat-zones/:zoneID/seats", server.ImportSeatMap)
+			organizer.POST("/events/:id/tickets", server.CreateTicket)
+			organizer.PUT("/events/:id/tickets/:ticketID", server.UpdateTicket)
+			organizer.DELETE("/events/:id/tickets/:ticketID", server.DeleteTicket)
+			organizer.POST("/events/:id/tickets/:ticketID/selling-schedules", server.CreateSellingSchedule)
+			organizer.PUT("/events/:id/tickets/:ticketID/selling-schedules/:scheduleID", server.UpdateSellingSchedule)
+			organizer.DELETE("/events/:id/tickets/:ticketID/selling-schedules/:scheduleID", server.DeleteSellingSchedule)
 		}
 
 		// Booking routes
@@ -101,42 +222,83 @@ func (server *Server) RegisterHandler() {
 		{
 			booking.GET("", server.ListBookingHistory)
 			booking.GET("/:id", server.GetBooking)
+			booking.GET("/:id/calendar.ics", server.GetBookingCalendar)
+			booking.GET("/:id/tickets.pdf", server.DownloadBookingTickets)
+			booking.GET("/:id/items/:itemId/pass", server.GetBookingItemPass)
+			booking.POST("/:id/items/:itemId/transfer", server.TransferBookingItem)
+			booking.POST("/:id/items/:itemId/resale", server.CreateResaleListing)
 			booking.POST("", server.CreateBooking)
 		}
 
+		// Ticket transfer routes
+		transfers := api.Group("/transfers", server.AuthMiddleware())
+		{
+			transfers.GET("", server.ListTicketTransfers)
+			transfers.POST("/:id/accept", server.AcceptTicketTransfer)
+			transfers.POST("/:id/cancel", server.CancelTicketTransfer)
+		}
+
+		// Resale marketplace routes
+		resale := api.Group("/resale", server.AuthMiddleware())
+		{
+			resale.GET("", server.ListResaleListings)
+			resale.POST("/:id/buy", server.BuyResaleListing)
+			resale.DELETE("/:id", server.CancelResaleListing)
+		}
+
+		// Promo code routes
+		promoCodes := api.Group("/promo-codes", server.AuthMiddleware())
+		{
+			promoCodes.POST("/validate", server.ValidatePromoCode)
+		}
+
+		// PassKit web service, called by Apple Wallet on the devices holding the passes
+		walletService := api.Group("/wallet/v1", server.RateLimitMiddleware("wallet", eventLimit))
+		{
+			walletService.POST("/devices/:deviceID/registrations/:passTypeID/:serialNumber", server.RegisterWalletDevice)
+			walletService.DELETE("/devices/:deviceID/registrations/:passTypeID/:serialNumber", server.UnregisterWalletDevice)
+			walletService.GET("/devices/:deviceID/registrations/:passTypeID", server.ListWalletPasses)
+			walletService.GET("/passes/:passTypeID/:serialNumber", server.GetWalletPass)
+			walletService.POST("/log", server.WalletLog)
+		}
+
 		// Payment routes
 		payments := api.Group("/payments", server.AuthMiddleware())
 		{
 			payments.POST("", server.CreatePayment)
 			payments.GET("/method", server.CreatePaymentMethod)
 			payments.POST("/:id/confirm", server.ConfirmPayment)
+			payments.GET("/:id/refund", server.PreviewRefund)
 			payments.POST("/:id/refund", server.Refund)
 		}
 
 		// Checkin routes
-		checkin := api.Group("/checkins")
+		checkin := api.Group("/checkins", server.RateLimitMiddleware("checkin", eventLimit))
 		{
 			checkin.POST("", server.Checkin)
 		}
 
-		// Categories routes
-		categories := api.Group("/categories", server.AuthMiddleware())
+		// Categories routes, public
+		categories := api.Group("/categories", server.RateLimitMiddleware("events", eventLimit))
 		{
 			categories.GET("", server.ListCategories)
 		}
 
-		// Event routes
-		events := api.Group("/events", server.AuthMiddleware())
+		// Event routes, public with personalized extras for logged in users
+		events := api.Group("/events", server.OptionalAuthMiddleware(), server.RateLimitMiddleware("events", eventLimit))
 		{
 			events.GET("", server.ListEvents)
 			events.GET("/:id", server.GetEvent)
+			events.GET("/:id/calendar.ics", server.GetEventCalendar)
+			events.GET("/:id/resale", server.ListEventResaleListings)
+			events.POST("/:id/waitlist", server.JoinWaitlist)
 		}
 
-		// Memberships routes
-		memberships := api.Group("/memberships", server.AuthMiddleware())
+		// Memberships routes. The tiers are public
+		memberships := api.Group("/memberships")
 		{
-			memberships.GET("", server.ListMemberships)
-			memberships.GET("/me", server.GetUserMembership)
+			memberships.GET("", server.RateLimitMiddleware("events", eventLimit), server.ListMemberships)
+			memberships.GET("/me", server.AuthMiddleware(), server.GetUserMembership)
 		}
 
 		// Webhook handler
@@ -145,7 +307,10 @@ func (server *Server) RegisterHandler() {
 			webhook.POST("/telegram", server.TelegramWebhook)
 			webhook.POST("/notifications", server.NotificationWebhook)
 			webhook.POST("/refund", server.RefundWebhook)
-			webhook.POST("/tickets/publish", server.PublishQRTickets)
+			webhook.POST("/tickets/publish", server.PublishQRTicketsWebhook) // Deprecated alias of the booking confirmation
+			webhook.POST("/tickets/released", server.TicketsReleasedWebhook)
+			webhook.POST("/cache", server.InvalidateCacheWebhook)
+			webhook.POST("/bookings/:id/confirm", server.ResumeBookingConfirmationWebhook)
 		}
 	}
 
@@ -169,6 +334,12 @@ type ErrorResponse struct {
 	Message string `json:"error"`
 }
 
+// Validation error response struct: the error message, and the list of problems of each invalid field (if any)
+type ValidationErrorResponse struct {
+	Message string              `json:"error"`
+	Fields  map[string][]string `json:"fields,omitempty"`
+}
+
 // Success message struct
 type SuccessMessage struct {
 	Message string `json:"message"`
@@ -0,0 +1,203 @@
+package api
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"tekticket/db"
+	"tekticket/service/session"
+	"tekticket/service/worker"
+	"tekticket/util"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hibiken/asynq"
+)
+
+type SessionResponse struct {
+	ID         string    `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	Current    bool      `json:"current"`
+}
+
+// Fixed width time format of the session cursors, so that the times compare as strings
+const SESSION_CURSOR_TIME_FORMAT = "2006-01-02T15:04:05.000000000Z07:00"
+
+// Helper method: the device of the request, recorded with the session it logs in
+func requestDevice(ctx *gin.Context) session.Device {
+	return session.Device{UserAgent: ctx.Request.UserAgent(), IP: ctx.ClientIP()}
+}
+
+// Helper method: clear the static token set by a session issued by us from Directus once the access token expired, since
+// Directus never expires it. A failure is only logged, the expired token is still rejected by the session manager
+func (server *Server) scheduleAccessTokenExpiry(ctx *gin.Context, tokens *session.Tokens) {
+	err := server.distributor.DistributeTask(
+		ctx,
+		worker.ClearAccessToken,
+		worker.ClearAccessTokenPayload{UserID: tokens.UserID},
+		asynq.Queue(worker.LOW_IMPACT),
+		asynq.MaxRetry(5),
+		asynq.ProcessIn(time.Duration(tokens.Expires)*time.Millisecond+worker.CLEAR_ACCESS_TOKEN_DELAY),
+	)
+	if err != nil {
+		util.LOGGER.Error(
+			ctx.Request.Method+" "+ctx.FullPath()+": failed to distribute background task",
+			"task", worker.ClearAccessToken,
+			"user_id", tokens.UserID,
+			"error", err,
+		)
+	}
+}
+
+// Helper method: answer a session that can't be issued because the access token of the user is being replaced, the
+// client can retry right after
+func accessTokenBusy(ctx *gin.Context) {
+	ctx.Header("Retry-After", "1")
+	ctx.JSON(http.StatusServiceUnavailable, ErrorResponse{"Session is being renewed, please retry"})
+}
+
+// Helper method: get the current user ID from Directus. Sessions are only stored in Redis, so the token must be verified
+// by Directus before we act on the user ID inside it
+func (server *Server) getCurrentUserID(ctx *gin.Context) (string, int, error) {
+	var user db.User
+	url := fmt.Sprintf("%s/users/me?fields=id", server.config.DirectusAddr)
+	status, err := db.MakeRequest("GET", url, nil, server.GetToken(ctx), &user)
+	if err != nil {
+		return "", status, err
+	}
+
+	return user.ID, status, nil
+}
+
+// ListSessions godoc
+// @Summary      List active sessions
+// @Description  Lists the active sessions of the current user, most recently used first, with the device they were
+// @Description  created from. The session of the current access token is marked as current
+// @Tags         Profile
+// @Produce      json
+// @Param        limit   query     int     false  "Maximum number of records to return (default: 50, max: 100)"
+// @Param        cursor  query     string  false  "Cursor of the next page, from the previous page"
+// @Success      200  {object}  Page[SessionResponse]    "Active sessions"
+// @Failure      400  {object}  ValidationErrorResponse  "Invalid pagination parameters"
+// @Failure      401  {object}  ErrorResponse            "Token expired | Session revoked, please login again"
+// @Failure      403  {object}  ErrorResponse            "Invalid token"
+// @Failure      429  {object}  ErrorResponse            "You hit the rate limit"
+// @Failure      500  {object}  ErrorResponse            "Internal server error"
+// @Security     BearerAuth
+// @Router       /api/profile/sessions [get]
+func (server *Server) ListSessions(ctx *gin.Context) {
+	pagination, ok := server.parsePagination(ctx, "-last_used_at", "-last_used_at")
+	if !ok {
+		return
+	}
+
+	userID, status, err := server.getCurrentUserID(ctx)
+	if err != nil {
+		util.LOGGER.Error("GET /api/profile/sessions: failed to get user", "status", status, "error", err)
+		server.DirectusError(ctx, err)
+		return
+	}
+
+	sessions, err := server.sessions.List(ctx, userID)
+	if err != nil {
+		util.LOGGER.Error("GET /api/profile/sessions: failed to list sessions", "id", userID, "error", err)
+		ctx.JSON(http.StatusInternalServerError, ErrorResponse{"Internal server error"})
+		return
+	}
+
+	token := server.GetToken(ctx)
+	result := make([]SessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		result = append(result, SessionResponse{
+			ID:         session.ID,
+			UserAgent:  session.UserAgent,
+			IP:         session.IP,
+			CreatedAt:  session.CreatedAt,
+			LastUsedAt: session.LastUsedAt,
+			Current:    session.Owns(token),
+		})
+	}
+
+	// Sessions live in Redis, so they are paged in memory, by the last use then the ID
+	slices.SortFunc(result, func(a, b SessionResponse) int {
+		return cmp.Or(b.LastUsedAt.Compare(a.LastUsedAt), strings.Compare(b.ID, a.ID))
+	})
+	page := memoryPage(result, pagination, func(session SessionResponse) (string, string) {
+		return session.LastUsedAt.UTC().Format(SESSION_CURSOR_TIME_FORMAT), session.ID
+	})
+
+	ctx.JSON(http.StatusOK, page)
+}
+
+// RevokeSession godoc
+// @Summary      Revoke a session
+// @Description  Logs out a session of the current user, for example on a lost device. Its refresh token is logged out and
+// @Description  its access tokens are rejected immediately
+// @Tags         Profile
+// @Produce      json
+// @Param        id   path      string  true  "Session ID"
+// @Success      200  {object}  SuccessMessage  "Session revoked"
+// @Failure      401  {object}  ErrorResponse   "Token expired | Session revoked, please login again"
+// @Failure      403  {object}  ErrorResponse   "Invalid token"
+// @Failure      404  {object}  ErrorResponse   "Session not found"
+// @Failure      429  {object}  ErrorResponse   "You hit the rate limit"
+// @Failure      500  {object}  ErrorResponse   "Internal server error"
+// @Security     BearerAuth
+// @Router       /api/profile/sessions/{id} [delete]
+func (server *Server) RevokeSession(ctx *gin.Context) {
+	userID, status, err := server.getCurrentUserID(ctx)
+	if err != nil {
+		util.LOGGER.Error("DELETE /api/profile/sessions/:id: failed to get user", "status", status, "error", err)
+		server.DirectusError(ctx, err)
+		return
+	}
+
+	err = server.sessions.Revoke(ctx, userID, ctx.Param("id"))
+	if errors.Is(err, session.ErrSessionNotFound) {
+		util.LOGGER.Warn("DELETE /api/profile/sessions/:id: session not found", "id", userID, "session", ctx.Param("id"))
+		ctx.JSON(http.StatusNotFound, ErrorResponse{"Session not found"})
+		return
+	}
+	if err != nil {
+		util.LOGGER.Error("DELETE /api/profile/sessions/:id: failed to revoke session", "id", userID, "error", err)
+		ctx.JSON(http.StatusInternalServerError, ErrorResponse{"Internal server error"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, SuccessMessage{"Session revoked"})
+}
+
+// RevokeAllSessions godoc
+// @Summary      Log out everywhere
+// @Description  Logs out every session of the current user, including the current one
+// @Tags         Profile
+// @Produce      json
+// @Success      200  {object}  SuccessMessage  "Logged out from all sessions"
+// @Failure      401  {object}  ErrorResponse   "Token expired | Session revoked, please login again"
+// @Failure      403  {object}  ErrorResponse   "Invalid token"
+// @Failure      429  {object}  ErrorResponse   "You hit the rate limit"
+// @Failure      500  {object}  ErrorResponse   "Internal server error"
+// @Security     BearerAuth
+// @Router       /api/profile/sessions [delete]
+func (server *Server) RevokeAllSessions(ctx *gin.Context) {
+	userID, status, err := server.getCurrentUserID(ctx)
+	if err != nil {
+		util.LOGGER.Error("DELETE /api/profile/sessions: failed to get user", "status", status, "error", err)
+		server.DirectusError(ctx, err)
+		return
+	}
+
+	if err := server.sessions.RevokeAll(ctx, userID); err != nil {
+		util.LOGGER.Error("DELETE /api/profile/sessions: failed to revoke sessions", "id", userID, "error", err)
+		ctx.JSON(http.StatusInternalServerError, ErrorResponse{"Internal server error"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, SuccessMessage{"Logged out from all sessions"})
+}
@@ -0,0 +1,524 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	neturl "net/url"
+	"strings"
+	"tekticket/db"
+	"tekticket/service/worker"
+	"tekticket/util"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hibiken/asynq"
+)
+
+// Status of the ticket transfers
+const (
+	TRANSFER_STATUS_PENDING  = "pending"
+	TRANSFER_STATUS_ACCEPTED = "accepted"
+	TRANSFER_STATUS_DECLINED = "declined" // By the recipient
+	TRANSFER_STATUS_CANCELED = "canceled" // By the sender, or because the ticket can't be transferred anymore
+)
+
+// How long the acceptance of a transfer blocks the other operations on the same transfer
+const TRANSFER_LOCK_TTL = time.Minute
+
+// Fields of a ticket transfer
+var transferFields = []string{
+	"id", "date_created", "status", "date_accepted",
+	"sender_id.id", "sender_id.first_name", "sender_id.last_name", "sender_id.email",
+	"recipient_id.id", "recipient_id.first_name", "recipient_id.last_name", "recipient_id.email",
+	"from_booking_id.id", "to_booking_id.id",
+	"booking_item_id.id", "booking_item_id.status", "booking_item_id.booking_id.id",
+	"booking_item_id.booking_id.event_id.id", "booking_item_id.booking_id.event_id.name",
+	"booking_item_id.event_schedule_id.id", "booking_item_id.event_schedule_id.start_time",
+	"booking_item_id.event_schedule_id.start_checkin_time",
+	"booking_item_id.ticket_id.rank", "booking_item_id.seat_id.seat_number",
+}
+
+type TransferBookingItemRequest struct {
+	Email string `json:"email" binding:"required,email"` // Email of the recipient, who must have an account
+}
+
+// TransferBookingItem godoc
+// @Summary      Transfer a ticket
+// @Description  Offers a ticket of a booking of the current user to another user, found by email. The recipient is notified
+// @Description  with a link to accept the transfer; once accepted, the ticket moves to a booking of the recipient and gets a
+// @Description  new QR, the old one is revoked. Tickets can't be transferred once the check-in of their schedule started
+// @Tags         Bookings
+// @Accept       json
+// @Produce      json
+// @Param        id       path      string                      true  "Booking ID"
+// @Param        itemId   path      string                      true  "Booking item ID"
+// @Param        request  body      TransferBookingItemRequest  true  "Recipient"
+// @Success      201  {object}  db.TicketTransfer  "Transfer offered"
+// @Failure      400  {object}  ErrorResponse      "Invalid request body | Ticket is not issued yet | Check-in has started, the ticket can't be transferred | You can't transfer a ticket to yourself"
+// @Failure      401  {object}  ErrorResponse      "Unauthorized access | Token expired"
+// @Failure      403  {object}  ErrorResponse      "Invalid token"
+// @Failure      404  {object}  ErrorResponse      "No item with such ID | No user with such email"
+// @Failure      409  {object}  ErrorResponse      "Ticket already has a pending transfer | Ticket is listed for resale"
+// @Failure      429  {object}  ErrorResponse      "You hit the rate limit"
+// @Failure      500  {object}  ErrorResponse      "Internal server error"
+// @Security     BearerAuth
+// @Router       /api/bookings/{id}/items/{itemId}/transfer [post]
+func (server *Server) TransferBookingItem(ctx *gin.Context) {
+	token := server.GetToken(ctx)
+	userID, err := util.ExtractIDFromToken(token)
+	if err != nil {
+		util.LOGGER.Error("POST /api/bookings/:id/items/:itemId/transfer: failed to extract user ID from access token", "error", err)
+		ctx.JSON(http.StatusForbidden, ErrorResponse{"Invalid token"})
+		return
+	}
+
+	var req TransferBookingItemRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		util.LOGGER.Warn("POST /api/bookings/:id/items/:itemId/transfer: failed to bind request body", "error", err)
+		ctx.JSON(http.StatusBadRequest, ErrorResponse{"Invalid request body"})
+		return
+	}
+
+	// The item is read with the user's token, so that only the customer can transfer it
+	id, itemID := ctx.Param("id"), ctx.Param("itemId")
+	fields := []string{
+		"id", "status", "booking_id.id", "booking_id.customer_id.id", "booking_id.event_id.name",
+		"event_schedule_id.start_time", "event_schedule_id.start_checkin_time",
+	}
+	url := fmt.Sprintf("%s/items/booking_items/%s?fields=%s", server.config.DirectusAddr, itemID, strings.Join(fields, ","))
+	var item db.BookingItem
+	status, err := db.MakeRequest("GET", url, nil, token, &item)
+	if err != nil {
+		util.LOGGER.Error("POST /api/bookings/:id/items/:itemId/transfer: failed to get booking item", "status", status, "error", err)
+		server.DirectusError(ctx, err)
+		return
+	}
+	if item.Booking == nil || item.Booking.ID != id || item.Booking.Customer == nil || item.Booking.Customer.ID != userID {
+		ctx.JSON(http.StatusNotFound, ErrorResponse{"No item with such ID"})
+		return
+	}
+	if item.Status != "valid" {
+		ctx.JSON(http.StatusBadRequest, ErrorResponse{"Ticket is not issued yet"})
+		return
+	}
+	if !server.transferAllowed(item) {
+		ctx.JSON(http.StatusBadRequest, ErrorResponse{"Check-in has started, the ticket can't be transferred"})
+		return
+	}
+
+	// Recipient
+	queryParams := neturl.Values{}
+	queryParams.Add("fields", "id,first_name,last_name,email")
+	queryParams.Add("filter[email][_eq]", strings.ToLower(strings.TrimSpace(req.Email)))
+	queryParams.Add("limit", "1")
+	url = fmt.Sprintf("%s/users?%s", server.config.DirectusAddr, queryParams.Encode())
+	var recipients []db.User
+	if status, err := db.MakeRequest("GET", url, nil, server.config.DirectusStaticToken, &recipients); err != nil {
+		util.LOGGER.Error("POST /api/bookings/:id/items/:itemId/transfer: failed to get recipient", "status", status, "error", err)
+		server.DirectusError(ctx, err)
+		return
+	}
+	if len(recipients) == 0 {
+		ctx.JSON(http.StatusNotFound, ErrorResponse{"No user with such email"})
+		return
+	}
+	recipient := recipients[0]
+	if recipient.ID == userID {
+		ctx.JSON(http.StatusBadRequest, ErrorResponse{"You can't transfer a ticket to yourself"})
+		return
+	}
+
+	// A ticket changes hands one way at a time
+	listed, status, err := server.hasActiveListing([]string{item.ID})
+	if err != nil {
+		util.LOGGER.Error("POST /api/bookings/:id/items/:itemId/transfer: failed to get active listings", "status", status, "error", err)
+		server.DirectusError(ctx, err)
+		return
+	}
+	if listed {
+		ctx.JSON(http.StatusConflict, ErrorResponse{"Ticket is listed for resale"})
+		return
+	}
+
+	// One pending transfer per ticket
+	queryParams = neturl.Values{}
+	queryParams.Add("fields", "id")
+	queryParams.Add("filter[booking_item_id][_eq]", item.ID)
+	queryParams.Add("filter[status][_eq]", TRANSFER_STATUS_PENDING)
+	queryParams.Add("limit", "1")
+	url = fmt.Sprintf("%s/items/ticket_transfers?%s", server.config.DirectusAddr, queryParams.Encode())
+	var pending []db.TicketTransfer
+	if status, err := db.MakeRequest("GET", url, nil, server.config.DirectusStaticToken, &pending); err != nil {
+		util.LOGGER.Error("POST /api/bookings/:id/items/:itemId/transfer: failed to get pending transfers", "status", status, "error", err)
+		server.DirectusError(ctx, err)
+		return
+	}
+	if len(pending) != 0 {
+		ctx.JSON(http.StatusConflict, ErrorResponse{"Ticket already has a pending transfer"})
+		return
+	}
+
+	url = fmt.Sprintf("%s/items/ticket_transfers?fields=%s", server.config.DirectusAddr, strings.Join(transferFields, ","))
+	body := map[string]any{
+		"status":          TRANSFER_STATUS_PENDING,
+		"booking_item_id": item.ID,
+		"sender_id":       userID,
+		"recipient_id":    recipient.ID,
+		"from_booking_id": item.Booking.ID,
+	}
+	var transfer db.TicketTransfer
+	if status, err := db.MakeRequest("POST", url, body, server.config.DirectusStaticToken, &transfer); err != nil {
+		util.LOGGER.Error("POST /api/bookings/:id/items/:itemId/transfer: failed to create transfer", "status", status, "error", err)
+		server.DirectusError(ctx, err)
+		return
+	}
+
+	eventName := ""
+	if item.Booking.Event != nil {
+		eventName = item.Booking.Event.Name
+	}
+	server.notifyCustomer(ctx, worker.NotifyCustomerPayload{
+		CustomerID: recipient.ID,
+		Name:       "ticket-transfer-offered",
+		Title:      "A ticket was sent to you",
+		Body: fmt.Sprintf(
+			"You received a ticket for %s. Accept it before the check-in starts: %s?id=%s",
+			eventName, server.config.TransferURL, transfer.ID,
+		),
+	})
+
+	ctx.JSON(http.StatusCreated, transfer)
+}
+
+// ListTicketTransfers godoc
+// @Summary      List ticket transfers
+// @Description  Lists the ticket transfers sent or received by the current user, newest first: the pending offers to accept,
+// @Description  and the history of the transfers
+// @Tags         Bookings
+// @Produce      json
+// @Param        limit   query     int     false  "Maximum number of records to return (default: 50, max: 100)"
+// @Param        cursor  query     string  false  "Cursor of the next page, from the previous page"
+// @Param        sort    query     string  false  "Sort order: -date_created (default) or date_created"
+// @Param        status  query     string  false  "Status filter"  Enums(pending, accepted, declined, canceled)
+// @Success      200  {object}  Page[db.TicketTransfer]  "List of transfers"
+// @Failure      400  {object}  ValidationErrorResponse  "Invalid pagination parameters"
+// @Failure      401  {object}  ErrorResponse            "Unauthorized access | Token expired"
+// @Failure      403  {object}  ErrorResponse            "Invalid token"
+// @Failure      429  {object}  ErrorResponse            "You hit the rate limit"
+// @Failure      500  {object}  ErrorResponse            "Internal server error"
+// @Security     BearerAuth
+// @Router       /api/transfers [get]
+func (server *Server) ListTicketTransfers(ctx *gin.Context) {
+	userID, err := util.ExtractIDFromToken(server.GetToken(ctx))
+	if err != nil {
+		util.LOGGER.Error("GET /api/transfers: failed to extract user ID from access token", "error", err)
+		ctx.JSON(http.StatusForbidden, ErrorResponse{"Invalid token"})
+		return
+	}
+
+	queryParams := neturl.Values{}
+	queryParams.Add("fields", strings.Join(transferFields, ","))
+	queryParams.Add("filter[_or][0][sender_id][_eq]", userID)
+	queryParams.Add("filter[_or][1][recipient_id][_eq]", userID)
+	if status := ctx.Query("status"); status != "" {
+		queryParams.Add("filter[status][_eq]", status)
+	}
+
+	pagination, ok := server.parsePagination(ctx, "-date_created", "-date_created", "date_created")
+	if !ok {
+		return
+	}
+
+	url := fmt.Sprintf("%s/items/ticket_transfers", server.config.DirectusAddr)
+	page, status, err := listPage[db.TicketTransfer](url, queryParams, pagination, server.config.DirectusStaticToken)
+	if err != nil {
+		util.LOGGER.Error("GET /api/transfers: failed to get transfers", "status", status, "error", err)
+		server.DirectusError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, page)
+}
+
+// AcceptTicketTransfer godoc
+// @Summary      Accept a ticket transfer
+// @Description  Accepts a ticket transfer offered to the current user. The ticket moves to a new booking of the recipient,
+// @Description  and a new QR is issued in the background; the QR of the sender is revoked at once
+// @Tags         Bookings
+// @Produce      json
+// @Param        id   path      string  true  "Transfer ID"
+// @Success      200  {object}  db.TicketTransfer  "Transfer accepted"
+// @Failure      400  {object}  ErrorResponse      "Check-in has started, the ticket can't be transferred"
+// @Failure      401  {object}  ErrorResponse      "Unauthorized access | Token expired"
+// @Failure      403  {object}  ErrorResponse      "Invalid token"
+// @Failure      404  {object}  ErrorResponse      "No item with such ID"
+// @Failure      409  {object}  ErrorResponse      "Transfer is not pending anymore | The ticket can't be transferred anymore | A refund of this ticket is in progress"
+// @Failure      429  {object}  ErrorResponse      "You hit the rate limit"
+// @Failure      500  {object}  ErrorResponse      "Internal server error"
+// @Security     BearerAuth
+// @Router       /api/transfers/{id}/accept [post]
+func (server *Server) AcceptTicketTransfer(ctx *gin.Context) {
+	transfer, ok := server.lockPendingTransfer(ctx, true)
+	if !ok {
+		return
+	}
+	defer server.queries.Cache.Del(ctx, transferLockKey(transfer.ID))
+
+	// The ticket must still be in the booking it was offered from
+	item := transfer.BookingItem
+	if item == nil || item.Status != "valid" || item.Booking == nil || transfer.FromBooking == nil ||
+		item.Booking.ID != transfer.FromBooking.ID {
+		server.closeTransfer(ctx, transfer, TRANSFER_STATUS_CANCELED)
+		ctx.JSON(http.StatusConflict, ErrorResponse{"The ticket can't be transferred anymore"})
+		return
+	}
+	if !server.transferAllowed(*item) {
+		ctx.JSON(http.StatusBadRequest, ErrorResponse{"Check-in has started, the ticket can't be transferred"})
+		return
+	}
+
+	// The ticket must not be refunded, or being refunded. The refunds of the payment of the sender are locked meanwhile, so
+	// that a refund can't start before the ticket moves
+	url := fmt.Sprintf(
+		"%s/items/booking_items/%s?fields=refund_id.status,booking_id.payments.id,booking_id.payments.status",
+		server.config.DirectusAddr, item.ID,
+	)
+	var paid db.BookingItem
+	if status, err := db.MakeRequest("GET", url, nil, server.config.DirectusStaticToken, &paid); err != nil {
+		util.LOGGER.Error("POST /api/transfers/:id/accept: failed to get refund of booking item", "status", status, "error", err)
+		server.DirectusError(ctx, err)
+		return
+	}
+	if paid.Refund != nil && paid.Refund.Status != "failed" {
+		server.closeTransfer(ctx, transfer, TRANSFER_STATUS_CANCELED)
+		ctx.JSON(http.StatusConflict, ErrorResponse{"The ticket can't be transferred anymore"})
+		return
+	}
+	if paid.Booking != nil {
+		for _, payment := range paid.Booking.Payments {
+			if payment.Status != "success" {
+				continue
+			}
+			locked, err := server.queries.Cache.SetNX(ctx, refundLockKey(payment.ID), 1, REFUND_LOCK_TTL).Result()
+			if err != nil {
+				util.LOGGER.Error("POST /api/transfers/:id/accept: failed to lock refunds", "error", err)
+				ctx.JSON(http.StatusInternalServerError, ErrorResponse{"Internal server error"})
+				return
+			}
+			if !locked {
+				ctx.JSON(http.StatusConflict, ErrorResponse{"A refund of this ticket is in progress"})
+				return
+			}
+			defer server.queries.Cache.Del(ctx, refundLockKey(payment.ID))
+		}
+	}
+
+	// Booking of the recipient for the ticket, already completed since the sender paid for it
+	url = fmt.Sprintf("%s/items/bookings?fields=id", server.config.DirectusAddr)
+	body := map[string]any{
+		"customer_id": transfer.Recipient.ID,
+		"status":      "completed",
+	}
+	if item.Booking.Event != nil {
+		body["event_id"] = item.Booking.Event.ID
+	}
+	var booking db.Booking
+	if status, err := db.MakeRequest("POST", url, body, server.config.DirectusStaticToken, &booking); err != nil {
+		util.LOGGER.Error("POST /api/transfers/:id/accept: failed to create booking of recipient", "status", status, "error", err)
+		server.DirectusError(ctx, err)
+		return
+	}
+
+	// Move the ticket, and revoke its QR until the new one is issued
+	server.revokeWalletPass(ctx, item.ID)
+	url = fmt.Sprintf("%s/items/booking_items/%s", server.config.DirectusAddr, item.ID)
+	body = map[string]any{"booking_id": booking.ID, "status": "pending", "qr": nil, "checkin_token": nil}
+	if status, err := db.MakeRequest("PATCH", url, body, server.config.DirectusStaticToken, nil); err != nil {
+		util.LOGGER.Error("POST /api/transfers/:id/accept: failed to move booking item", "status", status, "error", err)
+		server.DirectusError(ctx, err)
+		return
+	}
+
+	url = fmt.Sprintf("%s/items/ticket_transfers/%s?fields=%s", server.config.DirectusAddr, transfer.ID, strings.Join(transferFields, ","))
+	body = map[string]any{
+		"status":        TRANSFER_STATUS_ACCEPTED,
+		"to_booking_id": booking.ID,
+		"date_accepted": time.Now().UTC().Format(time.RFC3339),
+	}
+	var result db.TicketTransfer
+	if status, err := db.MakeRequest("PATCH", url, body, server.config.DirectusStaticToken, &result); err != nil {
+		util.LOGGER.Error("POST /api/transfers/:id/accept: failed to update transfer", "status", status, "error", err)
+		server.DirectusError(ctx, err)
+		return
+	}
+
+	// New QR of the recipient
+	err := server.distributor.DistributeTask(
+		ctx,
+		worker.PublishQRTicket,
+		worker.PublishQRTicketPayload{BookingItemIDs: []string{item.ID}, CheckInURL: server.config.CheckinURL},
+		asynq.Queue(worker.HIGH_IMPACT),
+		asynq.MaxRetry(10),
+	)
+	if err != nil {
+		util.LOGGER.Error(
+			"POST /api/transfers/:id/accept: failed to distribute background task",
+			"task", worker.PublishQRTicket,
+			"booking_item_id", item.ID,
+			"error", err,
+		)
+	}
+
+	server.notifyCustomer(ctx, worker.NotifyCustomerPayload{
+		CustomerID: transfer.Sender.ID,
+		Name:       "ticket-transfer-accepted",
+		Title:      "Ticket transfer accepted",
+		Body:       fmt.Sprintf("%s accepted your ticket, its QR is no longer valid for you.", transfer.Recipient.Email),
+	})
+
+	ctx.JSON(http.StatusOK, result)
+}
+
+// CancelTicketTransfer godoc
+// @Summary      Cancel a ticket transfer
+// @Description  Closes a pending ticket transfer: the sender takes the ticket back, or the recipient declines it. The ticket
+// @Description  stays with the sender
+// @Tags         Bookings
+// @Produce      json
+// @Param        id   path      string  true  "Transfer ID"
+// @Success      200  {object}  SuccessMessage  "Transfer canceled | Transfer declined"
+// @Failure      401  {object}  ErrorResponse   "Unauthorized access | Token expired"
+// @Failure      403  {object}  ErrorResponse   "Invalid token"
+// @Failure      404  {object}  ErrorResponse   "No item with such ID"
+// @Failure      409  {object}  ErrorResponse   "Transfer is not pending anymore"
+// @Failure      429  {object}  ErrorResponse   "You hit the rate limit"
+// @Failure      500  {object}  ErrorResponse   "Internal server error"
+// @Security     BearerAuth
+// @Router       /api/transfers/{id}/cancel [post]
+func (server *Server) CancelTicketTransfer(ctx *gin.Context) {
+	transfer, ok := server.lockPendingTransfer(ctx, false)
+	if !ok {
+		return
+	}
+	defer server.queries.Cache.Del(ctx, transferLockKey(transfer.ID))
+
+	// The recipient declines, the sender cancels
+	userID, _ := util.ExtractIDFromToken(server.GetToken(ctx))
+	status, message, notified := TRANSFER_STATUS_CANCELED, "Transfer canceled", transfer.Recipient
+	if transfer.Recipient.ID == userID {
+		status, message, notified = TRANSFER_STATUS_DECLINED, "Transfer declined", transfer.Sender
+	}
+	if !server.closeTransfer(ctx, transfer, status) {
+		ctx.JSON(http.StatusInternalServerError, ErrorResponse{"Internal server error"})
+		return
+	}
+
+	server.notifyCustomer(ctx, worker.NotifyCustomerPayload{
+		CustomerID: notified.ID,
+		Name:       "ticket-transfer-" + status,
+		Title:      message,
+		Body:       fmt.Sprintf("The ticket transfer between %s and %s was %s.", transfer.Sender.Email, transfer.Recipient.Email, status),
+	})
+
+	ctx.JSON(http.StatusOK, SuccessMessage{message})
+}
+
+// Helper method: get the pending transfer of the path parameter, and lock it against concurrent operations. Only its
+// recipient can accept it (recipientOnly), while both its sender and recipient can close it. Write the error response and
+// return false otherwise
+func (server *Server) lockPendingTransfer(ctx *gin.Context, recipientOnly bool) (*db.TicketTransfer, bool) {
+	caller := fmt.Sprintf("%s %s", ctx.Request.Method, ctx.FullPath())
+
+	userID, err := util.ExtractIDFromToken(server.GetToken(ctx))
+	if err != nil {
+		util.LOGGER.Error(caller+": failed to extract user ID from access token", "error", err)
+		ctx.JSON(http.StatusForbidden, ErrorResponse{"Invalid token"})
+		return nil, false
+	}
+
+	url := fmt.Sprintf(
+		"%s/items/ticket_transfers/%s?fields=%s",
+		server.config.DirectusAddr, neturl.PathEscape(ctx.Param("id")), strings.Join(transferFields, ","),
+	)
+	var transfer db.TicketTransfer
+	if status, err := db.MakeRequest("GET", url, nil, server.config.DirectusStaticToken, &transfer); err != nil {
+		util.LOGGER.Error(caller+": failed to get transfer", "status", status, "error", err)
+		server.DirectusError(ctx, err)
+		return nil, false
+	}
+
+	// Transfers of other users don't exist for this user
+	isRecipient := transfer.Recipient != nil && transfer.Recipient.ID == userID
+	isSender := transfer.Sender != nil && transfer.Sender.ID == userID
+	if !isRecipient && (recipientOnly || !isSender) {
+		ctx.JSON(http.StatusNotFound, ErrorResponse{"No item with such ID"})
+		return nil, false
+	}
+
+	locked, err := server.queries.Cache.SetNX(ctx, transferLockKey(transfer.ID), 1, TRANSFER_LOCK_TTL).Result()
+	if err != nil {
+		util.LOGGER.Error(caller+": failed to lock transfer", "error", err)
+		ctx.JSON(http.StatusInternalServerError, ErrorResponse{"Internal server error"})
+		return nil, false
+	}
+	if !locked || transfer.Status != TRANSFER_STATUS_PENDING {
+		if locked {
+			server.queries.Cache.Del(ctx, transferLockKey(transfer.ID))
+		}
+		ctx.JSON(http.StatusConflict, ErrorResponse{"Transfer is not pending anymore"})
+		return nil, false
+	}
+
+	return &transfer, true
+}
+
+// Helper method: close a pending transfer with the given status. Return false if failed
+func (server *Server) closeTransfer(ctx *gin.Context, transfer *db.TicketTransfer, status string) bool {
+	url := fmt.Sprintf("%s/items/ticket_transfers/%s", server.config.DirectusAddr, transfer.ID)
+	if code, err := db.MakeRequest("PATCH", url, map[string]any{"status": status}, server.config.DirectusStaticToken, nil); err != nil {
+		util.LOGGER.Error(ctx.Request.Method+" "+ctx.FullPath()+": failed to close transfer", "status", code, "error", err)
+		return false
+	}
+	return true
+}
+
+// Helper method: whether any of the booking items has a pending transfer
+func (server *Server) hasPendingTransfer(itemIDs []string) (bool, int, error) {
+	queryParams := neturl.Values{}
+	queryParams.Add("fields", "id")
+	queryParams.Add("filter[booking_item_id][_in]", strings.Join(itemIDs, ","))
+	queryParams.Add("filter[status][_eq]", TRANSFER_STATUS_PENDING)
+	queryParams.Add("limit", "1")
+	url := fmt.Sprintf("%s/items/ticket_transfers?%s", server.config.DirectusAddr, queryParams.Encode())
+	var transfers []db.TicketTransfer
+	status, err := db.MakeRequest("GET", url, nil, server.config.DirectusStaticToken, &transfers)
+	return len(transfers) != 0, status, err
+}
+
+// Helper method: check that a ticket can still change hands, before the check-in of its schedule starts
+func (server *Server) transferAllowed(item db.BookingItem) bool {
+	if item.EventSchedule == nil {
+		return true
+	}
+	deadline := util.TicketTransferDeadline(*item.EventSchedule)
+	return deadline.IsZero() || time.Now().Before(deadline)
+}
+
+// Helper method: notify a customer through all of their channels in the background. A failure is only logged, the
+// notification is not worth failing the request
+func (server *Server) notifyCustomer(ctx *gin.Context, payload worker.NotifyCustomerPayload) {
+	err := server.distributor.DistributeTask(ctx, worker.NotifyCustomer, payload, asynq.Queue(worker.MEDIUM_IMPACT), asynq.MaxRetry(5))
+	if err != nil {
+		util.LOGGER.Error(
+			ctx.Request.Method+" "+ctx.FullPath()+": failed to distribute background task",
+			"task", worker.NotifyCustomer,
+			"notification", payload.Name,
+			"error", err,
+		)
+	}
+}
+
+// Helper function: Redis key of the lock of a transfer
+func transferLockKey(transferID string) string {
+	return "transfer:lock:" + transferID
+}
@@ -0,0 +1,154 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"tekticket/db"
+	"tekticket/service/wallet"
+	"tekticket/service/worker"
+	"tekticket/util"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/hibiken/asynq"
+	"github.com/stretchr/testify/require"
+)
+
+// Request received by the fake Directus
+type directusRequest struct {
+	Method string
+	Path   string
+	Body   map[string]any
+}
+
+// Distributor recording the distributed tasks instead of enqueuing them
+type recordingDistributor struct {
+	tasks []string
+}
+
+func (distributor *recordingDistributor) DistributeTask(ctx context.Context, taskName string, payload any, opts ...asynq.Option) error {
+	distributor.tasks = append(distributor.tasks, taskName)
+	return nil
+}
+
+// Helper function: a server talking to a fake Directus, which answers the GET requests of a path with the given item, and
+// records the other requests and answers them with a created item
+func newFakeDirectusServer(t *testing.T, items map[string]any) (*Server, *recordingDistributor, *[]directusRequest) {
+	requests := []directusRequest{}
+	directus := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+		data, ok := items[r.URL.Path]
+		if r.Method != "GET" {
+			requests = append(requests, directusRequest{Method: r.Method, Path: r.URL.Path, Body: body})
+			data, ok = map[string]any{"id": uuid.NewString()}, true
+		}
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]any{"errors": []map[string]any{{"message": "not found"}}})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"data": data})
+	}))
+	t.Cleanup(directus.Close)
+
+	distributor := &recordingDistributor{}
+	server := NewServer(queries, distributor, nil, nil, nil, &util.Config{DirectusAddr: directus.URL})
+	return server, distributor, &requests
+}
+
+// Helper function: call a handler for the transfer as the given user, return the status of the response
+func callTransferHandler(handler gin.HandlerFunc, transferID, userID string) int {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"id":"%s"}`, userID)))
+	recorder := httptest.NewRecorder()
+	ginCtx, _ := gin.CreateTestContext(recorder)
+	ginCtx.Request = httptest.NewRequest("POST", "/api/transfers/"+transferID+"/accept", nil)
+	ginCtx.Request.Header.Set("Authorization", "Bearer header."+payload+".signature")
+	ginCtx.Params = gin.Params{{Key: "id", Value: transferID}}
+	handler(ginCtx)
+	return recorder.Code
+}
+
+// Test: the recipient of a pending transfer accepting it moves the ticket to a new booking of theirs, with a new QR
+func TestAcceptTicketTransfer(t *testing.T) {
+	transferID, itemID, paymentID := uuid.NewString(), uuid.NewString(), uuid.NewString()
+	transfer := db.TicketTransfer{
+		ID:          transferID,
+		Status:      TRANSFER_STATUS_PENDING,
+		Sender:      &db.User{ID: "sender", Email: "sender@example.com"},
+		Recipient:   &db.User{ID: "recipient", Email: "recipient@example.com"},
+		FromBooking: &db.Booking{ID: "sender-booking"},
+		BookingItem: &db.BookingItem{
+			ID: itemID, Status: "valid", Booking: &db.Booking{ID: "sender-booking", Event: &db.Event{ID: "event"}},
+		},
+	}
+	item := db.BookingItem{
+		ID:           itemID,
+		CheckinToken: uuid.NewString(),
+		Booking:      &db.Booking{Payments: []db.Payment{{ID: paymentID, Status: "success"}}},
+	}
+	server, distributor, requests := newFakeDirectusServer(t, map[string]any{
+		"/items/ticket_transfers/" + transferID: &transfer,
+		"/items/booking_items/" + itemID:        &item,
+	})
+	defer queries.Cache.Del(ctx, transferLockKey(transferID), refundLockKey(paymentID))
+
+	// Only the recipient can accept the transfer
+	require.Equal(t, http.StatusNotFound, callTransferHandler(server.AcceptTicketTransfer, transferID, "sender"))
+
+	// Not while a refund of the payment of the sender is in progress
+	require.NoError(t, queries.Cache.Set(ctx, refundLockKey(paymentID), 1, REFUND_LOCK_TTL).Err())
+	require.Equal(t, http.StatusConflict, callTransferHandler(server.AcceptTicketTransfer, transferID, "recipient"))
+	require.NoError(t, queries.Cache.Del(ctx, refundLockKey(paymentID)).Err())
+	require.Empty(t, *requests)
+
+	// The wallet pass of the sender is revoked, and the ticket moves without its QR
+	serialNumber := wallet.SerialNumber(itemID, item.CheckinToken)
+	defer queries.Cache.Del(ctx, "wallet:devices:device", "wallet:devices:device:passes")
+	_, err := server.walletRegistry.Register(ctx, "device", "push-token", serialNumber)
+	require.NoError(t, err)
+
+	require.Equal(t, http.StatusOK, callTransferHandler(server.AcceptTicketTransfer, transferID, "recipient"))
+	devices, err := queries.Cache.SMembers(ctx, fmt.Sprintf("wallet:passes:%s", serialNumber)).Result()
+	require.NoError(t, err)
+	require.Empty(t, devices)
+
+	require.Len(t, *requests, 3)
+	require.Equal(t, "/items/bookings", (*requests)[0].Path)
+	require.Equal(t, map[string]any{"customer_id": "recipient", "status": "completed", "event_id": "event"}, (*requests)[0].Body)
+	require.Equal(t, "/items/booking_items/"+itemID, (*requests)[1].Path)
+	require.Equal(t, "pending", (*requests)[1].Body["status"])
+	require.Nil(t, (*requests)[1].Body["qr"])
+	require.Nil(t, (*requests)[1].Body["checkin_token"])
+	require.NotEqual(t, "sender-booking", (*requests)[1].Body["booking_id"])
+	require.Equal(t, "/items/ticket_transfers/"+transferID, (*requests)[2].Path)
+	require.Equal(t, TRANSFER_STATUS_ACCEPTED, (*requests)[2].Body["status"])
+	require.Equal(t, (*requests)[1].Body["booking_id"], (*requests)[2].Body["to_booking_id"])
+	require.Equal(t, []string{worker.PublishQRTicket, worker.NotifyCustomer}, distributor.tasks)
+
+	// The locks are released
+	exists, err := queries.Cache.Exists(ctx, transferLockKey(transferID), refundLockKey(paymentID)).Result()
+	require.NoError(t, err)
+	require.Zero(t, exists)
+
+	// A refunded ticket can't be transferred anymore, and the transfer is canceled
+	*requests = (*requests)[:0]
+	item.Refund = &db.Refund{Status: "pending"}
+	require.Equal(t, http.StatusConflict, callTransferHandler(server.AcceptTicketTransfer, transferID, "recipient"))
+	require.Equal(t, []directusRequest{{
+		Method: "PATCH",
+		Path:   "/items/ticket_transfers/" + transferID,
+		Body:   map[string]any{"status": TRANSFER_STATUS_CANCELED},
+	}}, *requests)
+
+	// A transfer that is not pending anymore can't be accepted
+	*requests = (*requests)[:0]
+	transfer.Status = TRANSFER_STATUS_ACCEPTED
+	require.Equal(t, http.StatusConflict, callTransferHandler(server.AcceptTicketTransfer, transferID, "recipient"))
+	require.Empty(t, *requests)
+}
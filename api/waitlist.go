@@ -0,0 +1,245 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	neturl "net/url"
+	"tekticket/db"
+	"tekticket/service/waitlist"
+	"tekticket/service/worker"
+	"tekticket/util"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hibiken/asynq"
+)
+
+type JoinWaitlistRequest struct {
+	TicketID string `json:"ticket_id" binding:"required"`
+}
+
+type JoinWaitlistResponse struct {
+	TicketID string `json:"ticket_id"`
+	Position int    `json:"position"` // 1 for the next customer offered a ticket
+}
+
+// JoinWaitlist godoc
+// @Summary      Join the waitlist of a sold-out ticket type
+// @Description  Joins the FIFO waitlist of a ticket type of an event, once its tickets on sale are sold out. When a ticket
+// @Description  frees up (booking expiry, refund or cancellation), it is offered to the next customer in line, and reserved
+// @Description  for them for a while to book it. The customer is notified through their channels. An offer not claimed in
+// @Description  time rolls over to the next customer. Joining again keeps the place in the queue
+// @Tags         Events
+// @Accept       json
+// @Produce      json
+// @Param        id       path      string               true  "Event ID"
+// @Param        request  body      JoinWaitlistRequest  true  "Ticket type"
+// @Success      200  {object}  JoinWaitlistResponse  "Joined the waitlist"
+// @Failure      400  {object}  ErrorResponse         "Invalid request body | Ticket is not on sale"
+// @Failure      401  {object}  ErrorResponse         "Unauthorized access"
+// @Failure      404  {object}  ErrorResponse         "No ticket with such ID in this event"
+// @Failure      409  {object}  ErrorResponse         "Tickets are still on sale | A ticket is already reserved for you"
+// @Failure      429  {object}  ErrorResponse         "You hit the rate limit"
+// @Failure      500  {object}  ErrorResponse         "Internal server error"
+// @Security     BearerAuth
+// @Router       /api/events/{id}/waitlist [post]
+func (server *Server) JoinWaitlist(ctx *gin.Context) {
+	// The route is under the optional authentication of the events, which verified the token if any
+	userID := ctx.GetString(AUTH_USER_ID)
+	if userID == "" {
+		ctx.JSON(http.StatusUnauthorized, ErrorResponse{"Unauthorized access"})
+		return
+	}
+
+	var req JoinWaitlistRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		util.LOGGER.Warn("POST /api/events/:id/waitlist: failed to bind request body", "error", err)
+		ctx.JSON(http.StatusBadRequest, ErrorResponse{"Invalid request body"})
+		return
+	}
+
+	ticket, status, err := server.getTicketSales(ctx.Param("id"), req.TicketID)
+	if err != nil {
+		util.LOGGER.Error("POST /api/events/:id/waitlist: failed to get ticket", "status", status, "error", err)
+		server.DirectusError(ctx, err)
+		return
+	}
+	if ticket == nil {
+		ctx.JSON(http.StatusNotFound, ErrorResponse{"No ticket with such ID in this event"})
+		return
+	}
+
+	// Only a sold-out ticket type has a waitlist: every ticket on sale is sold or reserved by an offer
+	now := time.Now()
+	available, selling := worker.TicketsOnSale(*ticket, now)
+	if !selling {
+		ctx.JSON(http.StatusBadRequest, ErrorResponse{"Ticket is not on sale"})
+		return
+	}
+	reserved, err := server.waitlist.Reserved(ctx, ticket.ID, now)
+	if err != nil {
+		util.LOGGER.Error("POST /api/events/:id/waitlist: failed to get reserved tickets", "error", err)
+		ctx.JSON(http.StatusInternalServerError, ErrorResponse{"Internal server error"})
+		return
+	}
+	if available > reserved {
+		ctx.JSON(http.StatusConflict, ErrorResponse{"Tickets are still on sale"})
+		return
+	}
+
+	position, err := server.waitlist.Join(ctx, ticket.ID, userID, now)
+	if errors.Is(err, waitlist.ErrAlreadyOffered) {
+		ctx.JSON(http.StatusConflict, ErrorResponse{"A ticket is already reserved for you"})
+		return
+	}
+	if err != nil {
+		util.LOGGER.Error("POST /api/events/:id/waitlist: failed to join waitlist", "error", err)
+		ctx.JSON(http.StatusInternalServerError, ErrorResponse{"Internal server error"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, JoinWaitlistResponse{TicketID: ticket.ID, Position: position})
+}
+
+type TicketsReleasedRequest struct {
+	TicketID string `json:"ticket_id" binding:"required"`
+	Quantity int    `json:"quantity" binding:"required,min=1"` // Number of tickets of the type back on sale
+}
+
+// TicketsReleasedWebhook godoc
+// @Summary      Offer released tickets to the waitlist
+// @Description  Called by a Directus flow when tickets of a type are back on sale outside of the API, for example after a
+// @Description  booking was canceled in Directus. The tickets freed by the expired bookings and the refunds are already
+// @Description  offered by the API. Each ticket is offered to the next customer in the waitlist of its type, if any. The
+// @Description  flow must send the webhook secret in the X-Webhook-Secret header
+// @Tags         Webhooks
+// @Accept       json
+// @Produce      json
+// @Param        X-Webhook-Secret  header  string                  true  "Webhook secret"
+// @Param        request           body    TicketsReleasedRequest  true  "Released tickets"
+// @Success      200  {object}  SuccessMessage  "Tickets offered to the waitlist"
+// @Failure      400  {object}  ErrorResponse   "Invalid request body"
+// @Failure      401  {object}  ErrorResponse   "Invalid webhook secret"
+// @Failure      500  {object}  ErrorResponse   "Internal server error"
+// @Router       /api/webhook/tickets/released [post]
+func (server *Server) TicketsReleasedWebhook(ctx *gin.Context) {
+	if !server.checkWebhookSecret(ctx) {
+		return
+	}
+
+	var req TicketsReleasedRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		util.LOGGER.Warn("POST /api/webhook/tickets/released: failed to bind request body", "error", err)
+		ctx.JSON(http.StatusBadRequest, ErrorResponse{"Invalid request body"})
+		return
+	}
+
+	for range req.Quantity {
+		if !server.offerWaitlist(ctx, req.TicketID) {
+			ctx.JSON(http.StatusInternalServerError, ErrorResponse{"Internal server error"})
+			return
+		}
+	}
+
+	ctx.JSON(http.StatusOK, SuccessMessage{"Tickets offered to the waitlist"})
+}
+
+// Helper method: get a ticket of an event with its selling schedules, nil if not found
+func (server *Server) getTicketSales(eventID, ticketID string) (*db.Ticket, int, error) {
+	queryParams := neturl.Values{}
+	queryParams.Add("fields", "id,ticket_selling_schedules.available,ticket_selling_schedules.start_selling_time,ticket_selling_schedules.end_selling_time")
+	queryParams.Add("filter[id][_eq]", ticketID)
+	queryParams.Add("filter[event_id][_eq]", eventID)
+	queryParams.Add("limit", "1")
+	url := fmt.Sprintf("%s/items/tickets?%s", server.config.DirectusAddr, queryParams.Encode())
+	var tickets []db.Ticket
+	status, err := db.MakeRequest("GET", url, nil, server.config.DirectusStaticToken, &tickets)
+	if err != nil || len(tickets) == 0 {
+		return nil, status, err
+	}
+	return &tickets[0], status, nil
+}
+
+// Helper method: offer a freed ticket of a type to the next customer in its waitlist, in the background. Return false if
+// the task couldn't be distributed
+func (server *Server) offerWaitlist(ctx *gin.Context, ticketID string) bool {
+	err := server.distributor.DistributeTask(
+		ctx,
+		worker.OfferWaitlist,
+		worker.OfferWaitlistPayload{TicketID: ticketID},
+		asynq.Queue(worker.HIGH_IMPACT),
+		asynq.MaxRetry(5),
+	)
+	if err != nil {
+		util.LOGGER.Error(
+			ctx.Request.Method+" "+ctx.FullPath()+": failed to distribute background task",
+			"task", worker.OfferWaitlist,
+			"ticket_id", ticketID,
+			"error", err,
+		)
+		return false
+	}
+	return true
+}
+
+// Helper method: hold the tickets of a booking being created against the waitlist offers. A ticket type with offers running
+// only sells its tickets beyond the reserved ones, except to the customers holding an offer, whose offer is claimed by the
+// booking. The check and the hold are atomic, see waitlist.Queue.Hold. If failed, release the holds already taken, return
+// the error to client and false
+func (server *Server) holdWaitlistTickets(
+	ctx *gin.Context,
+	userID, eventID, bookingID string,
+	items []BookingItemCreate,
+) ([]waitlist.Hold, bool) {
+	caller := fmt.Sprintf("%s %s", ctx.Request.Method, ctx.FullPath())
+	now := time.Now()
+	counts := map[string]int{}
+	for _, item := range items {
+		counts[item.TicketID]++
+	}
+
+	holds := []waitlist.Hold{}
+	for ticketID, count := range counts {
+		ticket, status, err := server.getTicketSales(eventID, ticketID)
+		if err != nil {
+			util.LOGGER.Error(caller+": failed to get ticket", "status", status, "error", err)
+			server.releaseWaitlistHolds(ctx, holds, true)
+			server.DirectusError(ctx, err)
+			return nil, false
+		}
+		if ticket == nil {
+			// Not a ticket of the event, left to the creation of the booking to reject
+			continue
+		}
+
+		available, _ := worker.TicketsOnSale(*ticket, now)
+		hold, err := server.waitlist.Hold(ctx, ticketID, userID, bookingID, count, available, now)
+		if err != nil {
+			server.releaseWaitlistHolds(ctx, holds, true)
+			if errors.Is(err, waitlist.ErrTicketsReserved) {
+				ctx.JSON(http.StatusConflict, ErrorResponse{"Tickets are reserved for the customers on the waitlist"})
+				return nil, false
+			}
+			util.LOGGER.Error(caller+": failed to hold tickets against the waitlist", "ticket_id", ticketID, "error", err)
+			ctx.JSON(http.StatusInternalServerError, ErrorResponse{"Internal server error"})
+			return nil, false
+		}
+		holds = append(holds, hold)
+	}
+	return holds, true
+}
+
+// Helper method: release the waitlist holds of a booking, once it is created or failed. The offers claimed by a failed
+// booking are given back to the customer
+func (server *Server) releaseWaitlistHolds(ctx *gin.Context, holds []waitlist.Hold, failed bool) {
+	for _, hold := range holds {
+		if err := server.waitlist.Release(ctx, hold, failed); err != nil {
+			util.LOGGER.Error(
+				ctx.Request.Method+" "+ctx.FullPath()+": failed to release waitlist hold",
+				"ticket_id", hold.TicketID,
+				"error", err,
+			)
+		}
+	}
+}
@@ -0,0 +1,314 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	neturl "net/url"
+	"strconv"
+	"strings"
+	"tekticket/db"
+	"tekticket/service/wallet"
+	"tekticket/service/worker"
+	"tekticket/util"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Fields of a booking item shown on its wallet pass
+var walletItemFields = []string{
+	"id", "price", "status", "checkin_token",
+	"booking_id.id", "booking_id.customer_id.first_name", "booking_id.customer_id.last_name",
+	"booking_id.event_id.name", "booking_id.event_id.address", "booking_id.event_id.city", "booking_id.event_id.country",
+	"booking_id.event_id.latitude", "booking_id.event_id.longitude",
+	"event_schedule_id.id", "event_schedule_id.start_time", "event_schedule_id.end_time",
+	"ticket_id.rank",
+	"seat_id.row", "seat_id.seat_number",
+}
+
+// Authorization scheme of the PassKit web service requests
+const APPLE_PASS_AUTH_SCHEME = "ApplePass "
+
+type WalletSaveLinkResponse struct {
+	URL string `json:"url"` // "Add to Google Wallet" link
+}
+
+// GetBookingItemPass godoc
+// @Summary      Get the wallet pass of a ticket
+// @Description  Gets the phone wallet pass of a booking item, with the same check-in QR as the ticket. With wallet=apple
+// @Description  (default), downloads the signed .pkpass file; with wallet=google, returns the "Add to Google Wallet" link.
+// @Description  The passes are updated on the phones when the schedule of the ticket changes
+// @Tags         Bookings
+// @Produce      application/vnd.apple.pkpass
+// @Produce      json
+// @Param        id      path      string  true   "Booking ID"
+// @Param        itemId  path      string  true   "Booking item ID"
+// @Param        wallet  query     string  false  "Wallet: apple or google"  Enums(apple, google)
+// @Success      200  {object}  WalletSaveLinkResponse  "Apple Wallet pass file | Google Wallet save link"
+// @Failure      401  {object}  ErrorResponse           "Unauthorized access | Token expired"
+// @Failure      403  {object}  ErrorResponse           "Invalid token"
+// @Failure      404  {object}  ErrorResponse           "No item with such ID | Ticket is not issued yet | Wallet is not available"
+// @Failure      429  {object}  ErrorResponse           "You hit the rate limit"
+// @Failure      500  {object}  ErrorResponse           "Internal server error"
+// @Security     BearerAuth
+// @Router       /api/bookings/{id}/items/{itemId}/pass [get]
+func (server *Server) GetBookingItemPass(ctx *gin.Context) {
+	walletType := strings.ToLower(ctx.DefaultQuery("wallet", wallet.APPLE))
+	if (walletType != wallet.APPLE || server.walletIssuer.Apple == nil) &&
+		(walletType != wallet.GOOGLE || server.walletIssuer.Google == nil) {
+		ctx.JSON(http.StatusNotFound, ErrorResponse{"Wallet is not available"})
+		return
+	}
+
+	// The item is read with the user's token, so that only the customer can get its pass
+	id, itemID := ctx.Param("id"), ctx.Param("itemId")
+	item, status, err := server.getWalletItem(itemID, server.GetToken(ctx))
+	if err != nil {
+		util.LOGGER.Error("GET /api/bookings/:id/items/:itemId/pass: failed to get booking item", "status", status, "error", err, "id", itemID)
+		server.DirectusError(ctx, err)
+		return
+	}
+	if item.Booking == nil || item.Booking.ID != id {
+		ctx.JSON(http.StatusNotFound, ErrorResponse{"No item with such ID"})
+		return
+	}
+	if item.Status != "valid" {
+		ctx.JSON(http.StatusNotFound, ErrorResponse{"Ticket is not issued yet"})
+		return
+	}
+
+	ticket, err := server.walletTicket(item)
+	if err != nil {
+		util.LOGGER.Error("GET /api/bookings/:id/items/:itemId/pass: failed to generate check-in token", "error", err)
+		ctx.JSON(http.StatusInternalServerError, ErrorResponse{"Internal server error"})
+		return
+	}
+
+	if walletType == wallet.GOOGLE {
+		link, err := server.walletIssuer.Google.SaveLink(ticket)
+		if err != nil {
+			util.LOGGER.Error("GET /api/bookings/:id/items/:itemId/pass: failed to sign Google Wallet link", "error", err)
+			ctx.JSON(http.StatusInternalServerError, ErrorResponse{"Internal server error"})
+			return
+		}
+		ctx.JSON(http.StatusOK, WalletSaveLinkResponse{link})
+		return
+	}
+
+	server.writePass(ctx, ticket, "GET /api/bookings/:id/items/:itemId/pass")
+}
+
+type RegisterWalletDeviceRequest struct {
+	PushToken string `json:"pushToken" binding:"required"`
+}
+
+// PassKit web service: register a device for the updates of a pass
+func (server *Server) RegisterWalletDevice(ctx *gin.Context) {
+	if !server.authenticatePass(ctx) {
+		return
+	}
+
+	var req RegisterWalletDeviceRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		util.LOGGER.Warn("POST /api/wallet/v1/devices: failed to bind request body", "error", err)
+		ctx.Status(http.StatusBadRequest)
+		return
+	}
+	if _, ok := server.getCurrentPassItem(ctx); !ok {
+		return
+	}
+
+	added, err := server.walletRegistry.Register(ctx, ctx.Param("deviceID"), req.PushToken, ctx.Param("serialNumber"))
+	if err != nil {
+		util.LOGGER.Error("POST /api/wallet/v1/devices: failed to register device", "error", err)
+		ctx.Status(http.StatusInternalServerError)
+		return
+	}
+
+	if added {
+		ctx.Status(http.StatusCreated)
+		return
+	}
+	ctx.Status(http.StatusOK)
+}
+
+// PassKit web service: unregister a device from the updates of a pass
+func (server *Server) UnregisterWalletDevice(ctx *gin.Context) {
+	if !server.authenticatePass(ctx) {
+		return
+	}
+
+	if err := server.walletRegistry.Unregister(ctx, ctx.Param("deviceID"), ctx.Param("serialNumber")); err != nil {
+		util.LOGGER.Error("DELETE /api/wallet/v1/devices: failed to unregister device", "error", err)
+		ctx.Status(http.StatusInternalServerError)
+		return
+	}
+	ctx.Status(http.StatusOK)
+}
+
+type WalletPassesResponse struct {
+	SerialNumbers []string `json:"serialNumbers"`
+	LastUpdated   string   `json:"lastUpdated"` // Update tag, sent back by the device as passesUpdatedSince
+}
+
+// PassKit web service: list the passes of a device updated since its last fetch. The response format is set by Apple Wallet,
+// which pages by the update tag rather than a cursor, so it is not returned as a Page
+func (server *Server) ListWalletPasses(ctx *gin.Context) {
+	if server.walletIssuer.Apple == nil || ctx.Param("passTypeID") != server.walletIssuer.Apple.PassTypeID() {
+		ctx.Status(http.StatusNotFound)
+		return
+	}
+
+	since, _ := strconv.ParseInt(ctx.Query("passesUpdatedSince"), 10, 64)
+	serialNumbers, lastUpdated, err := server.walletRegistry.UpdatedPasses(ctx, ctx.Param("deviceID"), since)
+	if err != nil {
+		util.LOGGER.Error("GET /api/wallet/v1/devices: failed to list updated passes", "error", err)
+		ctx.Status(http.StatusInternalServerError)
+		return
+	}
+
+	if len(serialNumbers) == 0 {
+		ctx.Status(http.StatusNoContent)
+		return
+	}
+	ctx.JSON(http.StatusOK, WalletPassesResponse{SerialNumbers: serialNumbers, LastUpdated: strconv.FormatInt(lastUpdated, 10)})
+}
+
+// PassKit web service: get the latest version of a pass
+func (server *Server) GetWalletPass(ctx *gin.Context) {
+	if !server.authenticatePass(ctx) {
+		return
+	}
+
+	serialNumber := ctx.Param("serialNumber")
+	lastUpdated, err := server.walletRegistry.LastUpdated(ctx, serialNumber)
+	if err != nil {
+		util.LOGGER.Error("GET /api/wallet/v1/passes: failed to get last update of pass", "error", err)
+		ctx.Status(http.StatusInternalServerError)
+		return
+	}
+	if since, err := http.ParseTime(ctx.GetHeader("If-Modified-Since")); err == nil && lastUpdated <= since.Unix() {
+		ctx.Status(http.StatusNotModified)
+		return
+	}
+
+	item, ok := server.getCurrentPassItem(ctx)
+	if !ok {
+		return
+	}
+
+	ticket, err := server.walletTicket(item)
+	if err != nil {
+		util.LOGGER.Error("GET /api/wallet/v1/passes: failed to generate check-in token", "error", err)
+		ctx.Status(http.StatusInternalServerError)
+		return
+	}
+
+	if lastUpdated > 0 {
+		ctx.Header("Last-Modified", time.Unix(lastUpdated, 0).UTC().Format(http.TimeFormat))
+	}
+	server.writePass(ctx, ticket, "GET /api/wallet/v1/passes")
+}
+
+type WalletLogRequest struct {
+	Logs []string `json:"logs"`
+}
+
+// PassKit web service: errors reported by the devices
+func (server *Server) WalletLog(ctx *gin.Context) {
+	var req WalletLogRequest
+	if err := ctx.ShouldBindJSON(&req); err == nil {
+		for _, message := range req.Logs {
+			util.LOGGER.Warn("POST /api/wallet/v1/log: device log", "message", message)
+		}
+	}
+	ctx.Status(http.StatusOK)
+}
+
+// Helper method: check the pass type and the authentication token of a PassKit web service request. The token is
+// derived from the serial number of the pass, so that only the holders of the pass can register for it. The serial
+// number is bound to the check-in token of the item, see getCurrentPassItem
+func (server *Server) authenticatePass(ctx *gin.Context) bool {
+	if server.walletIssuer.Apple == nil || ctx.Param("passTypeID") != server.walletIssuer.Apple.PassTypeID() {
+		ctx.Status(http.StatusNotFound)
+		return false
+	}
+
+	token, ok := strings.CutPrefix(ctx.GetHeader("Authorization"), APPLE_PASS_AUTH_SCHEME)
+	if !ok || !server.walletIssuer.Apple.Authenticate(ctx.Param("serialNumber"), token) {
+		util.LOGGER.Warn("PassKit web service: invalid authentication token", "serial_number", ctx.Param("serialNumber"))
+		ctx.Status(http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+// Helper method: get the booking item of the pass of a PassKit web service request, which must still be the current pass
+// of the item: the item is valid, and its check-in token is the one of the serial number. A ticket reissued to another
+// holder has a new token, so the pass of the previous holder is refused. If failed, write the error status and return false
+func (server *Server) getCurrentPassItem(ctx *gin.Context) (db.BookingItem, bool) {
+	serialNumber := ctx.Param("serialNumber")
+	item, status, err := server.getWalletItem(wallet.ItemID(serialNumber), server.config.DirectusStaticToken)
+	if err != nil {
+		util.LOGGER.Error("PassKit web service: failed to get booking item", "status", status, "error", err, "serial_number", serialNumber)
+		ctx.Status(http.StatusNotFound)
+		return item, false
+	}
+	if item.Status != "valid" || wallet.SerialNumber(item.ID, item.CheckinToken) != serialNumber {
+		util.LOGGER.Warn("PassKit web service: pass revoked", "serial_number", serialNumber, "status", item.Status)
+		ctx.Status(http.StatusUnauthorized)
+		return item, false
+	}
+	return item, true
+}
+
+// Helper method: unregister the devices holding the pass of a booking item, before the item is reissued to another holder
+// and its check-in token rotated. The new token gives a new serial number anyway, so a failure is only logged
+func (server *Server) revokeWalletPass(ctx *gin.Context, itemID string) {
+	url := fmt.Sprintf("%s/items/booking_items/%s?fields=id,checkin_token", server.config.DirectusAddr, itemID)
+	var item db.BookingItem
+	status, err := db.MakeRequest("GET", url, nil, server.config.DirectusStaticToken, &item)
+	if err == nil {
+		err = server.walletRegistry.Revoke(ctx, wallet.SerialNumber(item.ID, item.CheckinToken))
+	}
+	if err != nil {
+		util.LOGGER.Warn(ctx.Request.Method+" "+ctx.FullPath()+": failed to revoke wallet pass", "id", itemID, "status", status, "error", err)
+	}
+}
+
+// Helper method: get a booking item with the fields of its pass
+func (server *Server) getWalletItem(itemID, token string) (db.BookingItem, int, error) {
+	queryParams := neturl.Values{}
+	queryParams.Add("fields", strings.Join(walletItemFields, ","))
+	url := fmt.Sprintf("%s/items/booking_items/%s?%s", server.config.DirectusAddr, itemID, queryParams.Encode())
+	var item db.BookingItem
+	status, err := db.MakeRequest("GET", url, nil, token, &item)
+	return item, status, err
+}
+
+// Helper method: build the ticket of a pass. Items issued before the check-in tokens were stored get a new token, which
+// is as valid as the one of their QR
+func (server *Server) walletTicket(item db.BookingItem) (wallet.Ticket, error) {
+	token := item.CheckinToken
+	if token == "" {
+		var err error
+		if token, err = worker.GenerateQRToken(item.ID, server.config.SecretKey); err != nil {
+			return wallet.Ticket{}, err
+		}
+	}
+	return wallet.NewTicket(item, fmt.Sprintf("%s?token=%s", server.config.CheckinURL, token)), nil
+}
+
+// Helper method: write the signed Apple Wallet pass of a ticket
+func (server *Server) writePass(ctx *gin.Context, ticket wallet.Ticket, route string) {
+	bundle, err := server.walletIssuer.Apple.Bundle(ticket)
+	if err != nil {
+		util.LOGGER.Error(route+": failed to sign Apple Wallet pass", "error", err)
+		ctx.JSON(http.StatusInternalServerError, ErrorResponse{"Internal server error"})
+		return
+	}
+
+	ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "ticket-"+ticket.SerialNumber+".pkpass"))
+	ctx.Header("Cache-Control", "no-store")
+	ctx.Data(http.StatusOK, wallet.PKPASS_CONTENT_TYPE, bundle)
+}
@@ -3,6 +3,7 @@ package api
 import (
 	"fmt"
 	"net/http"
+	neturl "net/url"
 	"strings"
 	"tekticket/db"
 	"tekticket/service/bot"
@@ -291,43 +292,118 @@ func (server *Server) NotificationWebhook(ctx *gin.Context) {
 	}
 }
 
-// Publish QR webhook
-type PublishQRTicketsRequest struct {
-	BookingItemIDs []string `json:"booking_item_ids" binding:"required"`
-}
-
-func (server *Server) PublishQRTickets(ctx *gin.Context) {
-	// Get and validate request body
-	var req PublishQRTicketsRequest
-	if err := ctx.ShouldBindJSON(&req); err != nil {
-		util.LOGGER.Warn("POST /api/tickets/pulish: failed to bind request body", "error", err)
-		ctx.JSON(http.StatusBadRequest, ErrorResponse{"Invalid request body"})
+// ResumeBookingConfirmationWebhook godoc
+// @Summary      Resume the confirmation of a booking
+// @Description  Restarts the confirmation of a paid booking whose background confirmation stopped, for example after its
+// @Description  retries ran out. The completed steps of the booking are skipped. A booking is never confirmed without a
+// @Description  successful payment, or a processing one whose Stripe payment intent succeeded. The flow must send the webhook
+// @Description  secret in the X-Webhook-Secret header
+// @Tags         Webhooks
+// @Produce      json
+// @Param        X-Webhook-Secret  header  string  true  "Webhook secret"
+// @Param        id                path    string  true  "Booking ID"
+// @Success      200  {object}  SuccessMessage  "Booking confirmation resumed"
+// @Failure      401  {object}  ErrorResponse   "Invalid webhook secret"
+// @Failure      500  {object}  ErrorResponse   "Internal server error"
+// @Router       /api/webhook/bookings/{id}/confirm [post]
+func (server *Server) ResumeBookingConfirmationWebhook(ctx *gin.Context) {
+	if !server.checkWebhookSecret(ctx) {
 		return
 	}
 
-	// Distribute background task: publish QR
+	bookingID := ctx.Param("id")
 	err := server.distributor.DistributeTask(
 		ctx,
-		worker.PublishQRTicket,
-		worker.PublishQRTicketPayload{
-			BookingItemIDs: req.BookingItemIDs,
-			CheckInURL:     server.config.CheckinURL,
-		},
-		asynq.Queue(worker.MEDIUM_IMPACT),
-		asynq.MaxRetry(5),
+		worker.ConfirmBooking,
+		worker.ConfirmBookingPayload{BookingID: bookingID},
+		asynq.Queue(worker.HIGH_IMPACT),
+		asynq.MaxRetry(25),
 	)
-
 	if err != nil {
 		util.LOGGER.Error(
-			"POST /api/webhook/tickets/publish: failed to distribute background task",
-			"task", worker.PublishQRTicket,
+			"POST /api/webhook/bookings/:id/confirm: failed to distribute background task",
+			"task", worker.ConfirmBooking,
+			"booking_id", bookingID,
 			"error", err,
 		)
 		ctx.JSON(http.StatusInternalServerError, ErrorResponse{"Internal server error"})
 		return
 	}
 
-	ctx.JSON(http.StatusOK, SuccessMessage{"Start publishing QR"})
+	ctx.JSON(http.StatusOK, SuccessMessage{"Booking confirmation resumed"})
+}
+
+type PublishQRTicketsRequest struct {
+	BookingItemIDs []string `json:"booking_item_ids" binding:"required"`
+}
+
+// PublishQRTicketsWebhook godoc
+// @Summary      Publish the QR of booking items (deprecated)
+// @Description  Kept for one release for the flows still calling it, use /api/webhook/bookings/{id}/confirm instead. Resumes
+// @Description  the confirmation of the bookings of the items, which publishes their QR once the booking is paid. The flow
+// @Description  must send the webhook secret in the X-Webhook-Secret header
+// @Tags         Webhooks
+// @Accept       json
+// @Produce      json
+// @Param        X-Webhook-Secret  header  string                   true  "Webhook secret"
+// @Param        request           body    PublishQRTicketsRequest  true  "Booking items"
+// @Success      200  {object}  SuccessMessage  "Booking confirmation resumed"
+// @Failure      400  {object}  ErrorResponse   "Invalid request body"
+// @Failure      401  {object}  ErrorResponse   "Invalid webhook secret"
+// @Failure      500  {object}  ErrorResponse   "Internal server error"
+// @Deprecated
+// @Router       /api/webhook/tickets/publish [post]
+func (server *Server) PublishQRTicketsWebhook(ctx *gin.Context) {
+	if !server.checkWebhookSecret(ctx) {
+		return
+	}
+
+	var req PublishQRTicketsRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil || len(req.BookingItemIDs) == 0 {
+		util.LOGGER.Warn("POST /api/webhook/tickets/publish: failed to bind request body", "error", err)
+		ctx.JSON(http.StatusBadRequest, ErrorResponse{"Invalid request body"})
+		return
+	}
+
+	// The QR are published by the confirmation of their bookings
+	queryParams := neturl.Values{}
+	queryParams.Add("fields", "booking_id.id")
+	queryParams.Add("filter[id][_in]", strings.Join(req.BookingItemIDs, ","))
+	url := fmt.Sprintf("%s/items/booking_items?%s", server.config.DirectusAddr, queryParams.Encode())
+	var items []db.BookingItem
+	if status, err := db.MakeRequest("GET", url, nil, server.config.DirectusStaticToken, &items); err != nil {
+		util.LOGGER.Error("POST /api/webhook/tickets/publish: failed to get booking items", "status", status, "error", err)
+		server.DirectusError(ctx, err)
+		return
+	}
+
+	bookingIDs := map[string]bool{}
+	for _, item := range items {
+		if item.Booking == nil || bookingIDs[item.Booking.ID] {
+			continue
+		}
+		bookingIDs[item.Booking.ID] = true
+
+		err := server.distributor.DistributeTask(
+			ctx,
+			worker.ConfirmBooking,
+			worker.ConfirmBookingPayload{BookingID: item.Booking.ID},
+			asynq.Queue(worker.HIGH_IMPACT),
+			asynq.MaxRetry(25),
+		)
+		if err != nil {
+			util.LOGGER.Error(
+				"POST /api/webhook/tickets/publish: failed to distribute background task",
+				"task", worker.ConfirmBooking,
+				"booking_id", item.Booking.ID,
+				"error", err,
+			)
+			ctx.JSON(http.StatusInternalServerError, ErrorResponse{"Internal server error"})
+			return
+		}
+	}
+
+	ctx.JSON(http.StatusOK, SuccessMessage{"Booking confirmation resumed"})
 }
 
 // Refund webhook for event-cancelling -> called by Directus
@@ -0,0 +1,85 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+/*
+ * Read-through cache of Directus reads. A value is loaded once, stored as JSON with a TTL, and served from Redis until it
+ * expires or is invalidated. Concurrent misses of the same key share a single load, so an expired popular key doesn't send
+ * every waiting request to Directus at once.
+ * Every cached key is indexed in the sets of its tags, and invalidating a tag deletes its keys. A value loaded while its
+ * tag is invalidated may still be stored, so the TTL bounds how stale a value can be.
+ */
+
+// Prefix of the cached values, and of the tag sets that index them
+const (
+	CACHE_PREFIX     = "cache:"
+	CACHE_TAG_PREFIX = "cache:tag:"
+)
+
+// TTL of the tag sets, refreshed on every store. It must be longer than the TTL of the cached values
+const CACHE_TAG_TTL = 24 * time.Hour
+
+// Get a cached value, or load it and cache it for ttl, indexed by tags. Load errors are not cached, and a Redis failure
+// falls back to the load, so that the cache is never the reason of a failed request
+func GetOrLoad[T any](ctx context.Context, queries *Queries, key string, ttl time.Duration, tags []string, load func() (T, error)) (T, error) {
+	key = CACHE_PREFIX + key
+	if data, err := queries.Cache.Get(ctx, key).Bytes(); err == nil {
+		var value T
+		if err := json.Unmarshal(data, &value); err == nil {
+			return value, nil
+		}
+	}
+
+	// The load outlives the request that started it, since other requests wait for it
+	ctx = context.WithoutCancel(ctx)
+	result, err, _ := queries.loads.Do(key, func() (any, error) {
+		value, err := load()
+		if err != nil {
+			return nil, err
+		}
+
+		if data, err := json.Marshal(value); err == nil {
+			pipe := queries.Cache.TxPipeline()
+			pipe.Set(ctx, key, data, ttl)
+			for _, tag := range tags {
+				pipe.SAdd(ctx, CACHE_TAG_PREFIX+tag, key)
+				pipe.Expire(ctx, CACHE_TAG_PREFIX+tag, CACHE_TAG_TTL)
+			}
+			pipe.Exec(ctx)
+		}
+		return value, nil
+	})
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return result.(T), nil
+}
+
+// Delete the cached values of tags. Return the number of deleted values
+func (queries *Queries) InvalidateCache(ctx context.Context, tags ...string) (int, error) {
+	deleted := 0
+	for _, tag := range tags {
+		keys, err := queries.Cache.SMembers(ctx, CACHE_TAG_PREFIX+tag).Result()
+		if err != nil {
+			return deleted, err
+		}
+
+		if len(keys) > 0 {
+			count, err := queries.Cache.Del(ctx, keys...).Result()
+			if err != nil {
+				return deleted, err
+			}
+			deleted += int(count)
+		}
+
+		if err := queries.Cache.Del(ctx, CACHE_TAG_PREFIX+tag).Err(); err != nil {
+			return deleted, err
+		}
+	}
+	return deleted, nil
+}
@@ -0,0 +1,97 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	ctx     = context.Background()
+	queries *Queries
+)
+
+func TestMain(m *testing.M) {
+	// This integration test need a running Redis, so we skip it in CI environment
+	if strings.TrimSpace(os.Getenv("CI")) != "" {
+		slog.Warn("CI environment, skip integration test")
+		return
+	}
+
+	queries = NewQueries()
+	if err := queries.ConnectRedis(ctx, &redis.Options{Addr: os.Getenv("REDIS_ADDR")}); err != nil {
+		slog.Error("failed to connect to Redis for testing", "error", err)
+		os.Exit(1)
+	}
+	os.Exit(m.Run())
+}
+
+// Test: a value is loaded once, then served from the cache until its tag is invalidated
+func TestGetOrLoad(t *testing.T) {
+	type item struct {
+		Name string `json:"name"`
+	}
+	key, tag := "test:"+uuid.NewString(), "test:"+uuid.NewString()
+
+	loads := 0
+	load := func() (item, error) {
+		loads++
+		return item{Name: "concert"}, nil
+	}
+
+	for range 3 {
+		value, err := GetOrLoad(ctx, queries, key, time.Minute, []string{tag}, load)
+		require.NoError(t, err)
+		require.Equal(t, "concert", value.Name)
+	}
+	require.Equal(t, 1, loads)
+
+	deleted, err := queries.InvalidateCache(ctx, tag)
+	require.NoError(t, err)
+	require.Equal(t, 1, deleted)
+
+	_, err = GetOrLoad(ctx, queries, key, time.Minute, []string{tag}, load)
+	require.NoError(t, err)
+	require.Equal(t, 2, loads)
+
+	// Errors are not cached
+	errLoad := errors.New("directus is down")
+	failing := func() (item, error) { return item{}, errLoad }
+	_, err = GetOrLoad(ctx, queries, "test:"+uuid.NewString(), time.Minute, nil, failing)
+	require.ErrorIs(t, err, errLoad)
+}
+
+// Test: concurrent misses of the same key share a single load
+func TestGetOrLoadConcurrent(t *testing.T) {
+	key := "test:" + uuid.NewString()
+
+	var loads atomic.Int32
+	load := func() ([]int, error) {
+		loads.Add(1)
+		time.Sleep(100 * time.Millisecond)
+		return []int{1, 2, 3}, nil
+	}
+
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			value, err := GetOrLoad(ctx, queries, key, time.Minute, nil, load)
+			require.NoError(t, err)
+			require.Equal(t, []int{1, 2, 3}, value)
+		}()
+	}
+	wg.Wait()
+	require.Equal(t, int32(1), loads.Load())
+}
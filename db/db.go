@@ -6,11 +6,13 @@ import (
 	"time"
 
 	"github.com/redis/go-redis/v9"
+	"golang.org/x/sync/singleflight"
 )
 
 // The queries object for interacting with database and cache
 type Queries struct {
 	Cache *redis.Client
+	loads singleflight.Group // Loads of the cache misses in progress, see GetOrLoad
 }
 
 // Constructor for Queries
@@ -11,7 +11,14 @@ import (
 
 // Directus share structure: most directus request, if success, will return one field 'data' that contains all information
 type DirectusResp struct {
-	Data any `json:"data"`
+	Data any           `json:"data"`
+	Meta *DirectusMeta `json:"meta,omitempty"`
+}
+
+// Directus list metadata, returned when requested with the meta query parameter
+type DirectusMeta struct {
+	FilterCount int `json:"filter_count"` // Number of items matching the filter
+	TotalCount  int `json:"total_count"`  // Number of items in the collection
 }
 
 // Directus error extensions field
@@ -67,6 +74,19 @@ func IsDirectusError(err error) bool {
 }
 
 func MakeRequest(method, url string, body any, token string, result any) (int, error) {
+	return makeRequest(method, url, body, token, &DirectusResp{Data: result})
+}
+
+// Make a GET request to list items, and return the list metadata along with the items. The URL should request the
+// metadata with the meta query parameter, like meta=filter_count
+func MakeListRequest(url string, token string, result any) (DirectusMeta, int, error) {
+	directusResp := DirectusResp{Data: result, Meta: &DirectusMeta{}}
+	status, err := makeRequest("GET", url, nil, token, &directusResp)
+	return *directusResp.Meta, status, err
+}
+
+// Helper function: make a request to Directus, and parse the response into directusResp
+func makeRequest(method, url string, body any, token string, directusResp *DirectusResp) (int, error) {
 	var (
 		req *http.Request
 		err error
@@ -111,8 +131,7 @@ func MakeRequest(method, url string, body any, token string, result any) (int, e
 	// Parse Directus response
 	if resp.StatusCode != http.StatusNoContent {
 		// Only parse if Directus actually return something
-		directusResp := DirectusResp{Data: result}
-		if err := json.NewDecoder(resp.Body).Decode(&directusResp); err != nil {
+		if err := json.NewDecoder(resp.Body).Decode(directusResp); err != nil {
 			return http.StatusInternalServerError, err
 		}
 	}
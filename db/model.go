@@ -35,6 +35,31 @@ type UserTelegram struct {
 	User           *User  `json:"user_id,omitempty"`
 }
 
+// user_identities: link between a user and an external identity provider account (social login)
+type UserIdentity struct {
+	ID       string `json:"id,omitempty"`
+	Provider string `json:"provider,omitempty"`
+	Subject  string `json:"subject,omitempty"` // The user ID in the provider (sub claim)
+	Email    string `json:"email,omitempty"`
+	User     *User  `json:"user_id,omitempty"`
+}
+
+// user_mfas: TOTP two-factor authentication of a user. The secret is encrypted, the recovery codes are hashed
+type UserMFA struct {
+	ID            string   `json:"id,omitempty"`
+	Status        string   `json:"status,omitempty"` // pending (enrolled, not verified yet) or enabled
+	Secret        string   `json:"secret,omitempty"`
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
+	User          *User    `json:"user_id,omitempty"`
+}
+
+// user_calendars: calendar feed of a user. The feed token is hashed
+type UserCalendar struct {
+	ID        string `json:"id,omitempty"`
+	TokenHash string `json:"token_hash,omitempty"`
+	User      *User  `json:"user_id,omitempty"`
+}
+
 // memberships
 type Membership struct {
 	ID           string       `json:"id,omitempty"`
@@ -68,6 +93,8 @@ type Event struct {
 	Address        string          `json:"address,omitempty"`
 	City           string          `json:"city,omitempty"`
 	Country        string          `json:"country,omitempty"`
+	Latitude       *float64        `json:"latitude,omitempty"`
+	Longitude      *float64        `json:"longitude,omitempty"`
 	Slug           string          `json:"slug,omitempty"`
 	PreviewImage   string          `json:"preview_image,omitempty"`
 	Status         string          `json:"status,omitempty"`
@@ -77,6 +104,7 @@ type Event struct {
 	SeatZones      []SeatZone      `json:"seat_zones,omitempty"`
 	Tickets        []Ticket        `json:"tickets,omitempty"`
 	Bookings       []Booking       `json:"bookings,omitempty"`
+	DateCreated    *DateTime       `json:"date_created,omitempty"`
 }
 
 // event_schedules
@@ -86,6 +114,7 @@ type EventSchedule struct {
 	EndTime          *DateTime `json:"end_time,omitempty"`
 	StartCheckinTime *DateTime `json:"start_checkin_time,omitempty"`
 	EndCheckinTime   *DateTime `json:"end_checkin_time,omitempty"`
+	Event            *Event    `json:"event_id,omitempty"`
 }
 
 // seat_zones
@@ -103,6 +132,9 @@ type SeatZone struct {
 type Seat struct {
 	ID         string    `json:"id,omitempty"`
 	SeatNumber string    `json:"seat_number,omitempty"`
+	Row        string    `json:"row,omitempty"`
+	X          *int      `json:"x,omitempty"` // Column on the seat map
+	Y          *int      `json:"y,omitempty"` // Row index on the seat map, from the front
 	Status     string    `json:"status,omitempty"`
 	ReserveBy  *User     `json:"reserved_by,omitempty"`
 	SeatZone   *SeatZone `json:"seat_zone_id,omitempty"`
@@ -133,12 +165,35 @@ type TicketSellingSchedule struct {
 
 // bookings
 type Booking struct {
-	ID           string        `json:"id,omitempty"`
-	Status       string        `json:"status,omitempty"`
-	Customer     *User         `json:"customer_id,omitempty"`
-	Event        *Event        `json:"event_id,omitempty"`
-	BookingItems []BookingItem `json:"booking_items,omitempty"`
-	Payments     []Payment     `json:"payments,omitempty"`
+	ID                string         `json:"id,omitempty"`
+	Status            string         `json:"status,omitempty"`
+	Customer          *User          `json:"customer_id,omitempty"`
+	Event             *Event         `json:"event_id,omitempty"`
+	BookingItems      []BookingItem  `json:"booking_items,omitempty"`
+	Payments          []Payment      `json:"payments,omitempty"`
+	TicketsPDF        string         `json:"tickets_pdf,omitempty"`        // File of the ticket document, once the tickets are issued
+	ConfirmationSteps []string       `json:"confirmation_steps,omitempty"` // Completed steps of the confirmation after the payment
+	ResaleListing     *ResaleListing `json:"resale_listing_id,omitempty"`  // The resale listing bought by the booking, if any
+	PromoCode         *PromoCode     `json:"promo_code_id,omitempty"`      // The promo code applied to the booking, if any
+	Discount          int            `json:"discount,omitempty"`           // Discount of the membership and the promo code, in VND
+}
+
+// promo_codes: discount campaigns. A code is scoped to an event, a category and a ticket rank when they are set
+type PromoCode struct {
+	ID                      string       `json:"id,omitempty"`
+	Code                    string       `json:"code,omitempty"` // Upper case
+	Status                  string       `json:"status,omitempty"`
+	DiscountType            string       `json:"discount_type,omitempty"` // percentage or fixed
+	Value                   DecimalFloat `json:"value,omitempty"`         // Percent off, or VND off for a fixed discount
+	MaxDiscount             int          `json:"max_discount,omitempty"`  // Cap of a percentage discount, in VND. 0 for no cap
+	Event                   *Event       `json:"event_id,omitempty"`
+	Category                *Category    `json:"category_id,omitempty"`
+	TicketRank              string       `json:"ticket_rank,omitempty"`
+	StartTime               *DateTime    `json:"start_time,omitempty"`
+	EndTime                 *DateTime    `json:"end_time,omitempty"`
+	UsageLimit              int          `json:"usage_limit,omitempty"`    // Bookings using the code, 0 for no limit
+	PerUserLimit            int          `json:"per_user_limit,omitempty"` // Bookings of a customer using the code, 0 for no limit
+	StackableWithMembership bool         `json:"stackable_with_membership,omitempty"`
 }
 
 // booking_items
@@ -146,11 +201,13 @@ type BookingItem struct {
 	ID            string         `json:"id,omitempty"`
 	Price         int            `json:"price,omitempty"`
 	QR            string         `json:"qr,omitempty"`
+	CheckinToken  string         `json:"checkin_token,omitempty"` // Token of the QR, also embedded in the wallet passes
 	Status        string         `json:"status,omitempty"`
 	Booking       *Booking       `json:"booking_id,omitempty"`
 	Ticket        *Ticket        `json:"ticket_id,omitempty"`
 	Seat          *Seat          `json:"seat_id,omitempty"`
 	EventSchedule *EventSchedule `json:"event_schedule_id,omitempty"`
+	Refund        *Refund        `json:"refund_id,omitempty"` // The refund of the item, if it was refunded
 }
 
 // payments
@@ -159,6 +216,7 @@ type Payment struct {
 	DateCreated    *DateTime `json:"date_created,omitempty"`
 	TransactionID  string    `json:"transaction_id,omitempty"`
 	Amount         int       `json:"amount,omitempty"`
+	ItemsTotal     int       `json:"items_total,omitempty"` // Price of the items paid for, recorded once paid, before they change hands
 	PaymentGateway string    `json:"payment_gateway,omitempty"`
 	PaymentMethod  string    `json:"payment_method,omitempty"`
 	Status         string    `json:"status,omitempty"`
@@ -168,11 +226,45 @@ type Payment struct {
 
 // refunds
 type Refund struct {
-	ID      string   `json:"id,omitempty"`
-	Amount  int      `json:"amount,omitempty"`
-	Reason  string   `json:"reason,omitempty"`
-	Status  string   `json:"status,omitempty"`
-	Payment *Payment `json:"payment_id,omitempty"`
+	ID           string        `json:"id,omitempty"`
+	DateCreated  *DateTime     `json:"date_created,omitempty"`
+	Amount       int           `json:"amount,omitempty"`
+	Reason       string        `json:"reason,omitempty"`
+	Status       string        `json:"status,omitempty"`
+	Payment      *Payment      `json:"payment_id,omitempty"`
+	BookingItems []BookingItem `json:"booking_items,omitempty"` // The refunded items
+}
+
+// ticket_transfers
+type TicketTransfer struct {
+	ID           string       `json:"id,omitempty"`
+	DateCreated  *DateTime    `json:"date_created,omitempty"`
+	Status       string       `json:"status,omitempty"`
+	BookingItem  *BookingItem `json:"booking_item_id,omitempty"`
+	Sender       *User        `json:"sender_id,omitempty"`
+	Recipient    *User        `json:"recipient_id,omitempty"`
+	FromBooking  *Booking     `json:"from_booking_id,omitempty"` // Booking of the sender the ticket was in
+	ToBooking    *Booking     `json:"to_booking_id,omitempty"`   // Booking of the recipient the ticket moved to, once accepted
+	DateAccepted *DateTime    `json:"date_accepted,omitempty"`
+}
+
+// resale_listings
+type ResaleListing struct {
+	ID            string       `json:"id,omitempty"`
+	DateCreated   *DateTime    `json:"date_created,omitempty"`
+	Status        string       `json:"status,omitempty"`
+	Price         int          `json:"price,omitempty"` // Asked price, capped over the original price of the ticket
+	BookingItem   *BookingItem `json:"booking_item_id,omitempty"`
+	Seller        *User        `json:"seller_id,omitempty"`
+	FromBooking   *Booking     `json:"from_booking_id,omitempty"` // Booking of the seller the ticket was in
+	Buyer         *User        `json:"buyer_id,omitempty"`
+	Booking       *Booking     `json:"booking_id,omitempty"`     // Booking of the buyer, paid through the normal payment flow
+	ReservedUntil *DateTime    `json:"reserved_until,omitempty"` // End of the hold of the buyer on the listing while they pay
+	PlatformFee   int          `json:"platform_fee,omitempty"`   // Kept by the platform once sold
+	Payout        int          `json:"payout,omitempty"`         // Owed to the seller once sold: the price minus the platform fee
+	Refund        *Refund      `json:"refund_id,omitempty"`      // Refund of the payment of the seller paying out the listing
+	PayoutPending int          `json:"payout_pending,omitempty"` // Part of the payout beyond the refund, left to the platform to pay
+	DateSold      *DateTime    `json:"date_sold,omitempty"`
 }
 
 // checkins
@@ -196,18 +288,37 @@ type Setting struct {
 	MaxReservationHoldMinutes int          `json:"max_reservation_hold_minutes"`
 	MinSellingDurationMinutes int          `json:"min_selling_duration_minutes"`
 	PaymentFeePercent         DecimalFloat `json:"payment_fee_percent"`
-	MaxFullRefundHours        int          `json:"max_full_refund_hours"`
-	Email                     string       `json:"email"`                  // Platform email
-	AppPassword               string       `json:"app_password"`           // Platform email's app password
-	SecretKey                 string       `json:"secret_key"`             // Platfrom secret key
-	ResetPasswordURL          string       `json:"reset_password_url"`     // The frontend URL of the reset password page
-	CheckinURL                string       `json:"checkin_url"`            // The frontend URL of the checkin page
-	StripePublishableKey      string       `json:"stripe_publishable_key"` // Stripe publishable key
-	StripeSecretKey           string       `json:"stripe_secret_key"`      // Stripe secret key
-	AblyApiKey                string       `json:"ably_api_key"`           // Ably API key
-	TelegramBotToken          string       `json:"telegram_bot_token"`     // Telegram bot token
-	ServerDomain              string       `json:"server_domain"`          // Server domain, used for external API calling
-	MaxWorkers                int          `json:"max_workers"`            // The total of background workers running in the background
+	MaxFullRefundHours        int          `json:"max_full_refund_hours"`       // Grace period after payment with a full refund
+	RefundTiers               []RefundTier `json:"refund_tiers"`                // Refund rules relative to the start of the event
+	ResaleMaxMarkupPercent    int          `json:"resale_max_markup_percent"`   // Cap of a resale price, over the original price of the ticket
+	ResaleFeePercent          DecimalFloat `json:"resale_fee_percent"`          // Platform fee kept on a resale
+	WaitlistOfferMinutes      int          `json:"waitlist_offer_minutes"`      // How long a waitlist offer reserves a ticket
+	Email                     string       `json:"email"`                       // Platform email
+	AppPassword               string       `json:"app_password"`                // Platform email's app password
+	SecretKey                 string       `json:"secret_key"`                  // Platfrom secret key
+	ResetPasswordURL          string       `json:"reset_password_url"`          // The frontend URL of the reset password page
+	CheckinURL                string       `json:"checkin_url"`                 // The frontend URL of the checkin page
+	TransferURL               string       `json:"transfer_url"`                // The frontend URL of the ticket transfer page
+	StripePublishableKey      string       `json:"stripe_publishable_key"`      // Stripe publishable key
+	StripeSecretKey           string       `json:"stripe_secret_key"`           // Stripe secret key
+	AblyApiKey                string       `json:"ably_api_key"`                // Ably API key
+	TelegramBotToken          string       `json:"telegram_bot_token"`          // Telegram bot token
+	ServerDomain              string       `json:"server_domain"`               // Server domain, used for external API calling
+	MaxWorkers                int          `json:"max_workers"`                 // The total of background workers running in the background
+	AuthRateLimit             int          `json:"auth_rate_limit"`             // Max requests per minute on sensitive auth endpoints
+	EventRateLimit            int          `json:"event_rate_limit"`            // Max requests per minute on event browsing endpoints
+	OTPTTLSeconds             int          `json:"otp_ttl_seconds"`             // How long an OTP is valid
+	OTPMaxAttempts            int          `json:"otp_max_attempts"`            // Failed OTP attempts before lockout
+	OTPLockoutMinutes         int          `json:"otp_lockout_minutes"`         // How long a user is locked after too many failed attempts
+	OTPResendCooldownSeconds  int          `json:"otp_resend_cooldown_seconds"` // Minimum time between 2 OTP requests
+	PasswordMinLength         int          `json:"password_min_length"`         // Minimum password length
+	PasswordMinCharClasses    int          `json:"password_min_char_classes"`   // Minimum character classes (lower, upper, digit, symbol) in a password
+}
+
+// A refund rule of the settings: the percent of the price refunded up to some time before the start of the event
+type RefundTier struct {
+	MinHoursBeforeStart int `json:"min_hours_before_start"`
+	Percent             int `json:"percent"`
 }
 
 // Image response: the response when uploading image in Directus
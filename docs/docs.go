@@ -17,7 +17,7 @@ const docTemplate = `{
     "paths": {
         "/api/auth/login": {
             "post": {
-                "description": "Authenticates a user with Directus and returns an access token and refresh token.",
+                "description": "Authenticates a user with Directus and returns an access token and refresh token.\nIf the user has two-factor authentication enabled, returns an MFA challenge instead, to complete with\n/api/auth/login/mfa",
                 "consumes": [
                     "application/json"
                 ],
@@ -46,6 +46,12 @@ const docTemplate = `{
                             "$ref": "#/definitions/api.LoginResponse"
                         }
                     },
+                    "202": {
+                        "description": "Second factor required",
+                        "schema": {
+                            "$ref": "#/definitions/api.MFAChallengeResponse"
+                        }
+                    },
                     "400": {
                         "description": "Invalid request body",
                         "schema": {
@@ -73,6 +79,64 @@ const docTemplate = `{
                 }
             }
         },
+        "/api/auth/login/mfa": {
+            "post": {
+                "description": "Second step of the login for users with two-factor authentication enabled. Exchanges the challenge returned by\n/api/auth/login and a code from the authenticator app (or a recovery code) for the access and refresh tokens.\nAfter too many failed attempts, the challenge is dropped and the user has to log in again",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Auth"
+                ],
+                "summary": "Complete login with the second factor",
+                "parameters": [
+                    {
+                        "description": "Challenge and TOTP code or recovery code",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/api.LoginMFARequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Login successful",
+                        "schema": {
+                            "$ref": "#/definitions/api.LoginResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request body",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid MFA code | MFA challenge expired, please login again",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Rate limit exceeded | Too many failed attempts, please login again",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
         "/api/auth/logout": {
             "post": {
                 "description": "Logs out a user by invalidating the provided refresh token in Directus.",
@@ -131,6 +195,123 @@ const docTemplate = `{
                 }
             }
         },
+        "/api/auth/oauth/callback": {
+            "post": {
+                "description": "Exchanges the code returned by the provider for the user identity, then logs the user in. The identity is\nlinked to the customer account with the same email if the provider verified it, and a new active customer\naccount is created if there is none.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Auth"
+                ],
+                "summary": "Complete social login",
+                "parameters": [
+                    {
+                        "description": "State and code from the provider redirect",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/api.OAuthCallbackRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Login successful",
+                        "schema": {
+                            "$ref": "#/definitions/api.LoginResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request body | Invalid or expired state | Invalid request data",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Failed to authenticate with the provider",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Email not verified by the provider | Account is not active | Social login is only available for customers",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Rate limit exceeded",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Session is being renewed, please retry",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/auth/oauth/{provider}": {
+            "get": {
+                "description": "Starts the OAuth2/OIDC authorization code flow (with PKCE) with the provider, like google. Redirect the user\nto the returned URL; the provider then redirects back to the frontend callback page with a code and state,\nto send to /api/auth/oauth/callback. The state is valid for 10 minutes and can only be used once",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Auth"
+                ],
+                "summary": "Start social login",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Provider name",
+                        "name": "provider",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Authorization URL",
+                        "schema": {
+                            "$ref": "#/definitions/api.OAuthAuthorizeResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Unknown provider",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Rate limit exceeded",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
         "/api/auth/password/request": {
             "post": {
                 "description": "Sends a password reset email to the specified email address if the account exists.\nThe email will contain a link or OTP to reset the user's password.",
@@ -189,7 +370,7 @@ const docTemplate = `{
         },
         "/api/auth/password/reset": {
             "post": {
-                "description": "Resets the user's password using a valid reset token. The token must be verified before updating the password.",
+                "description": "Resets the user's password using a valid reset token. A token can only be used once, and is revoked when a\nnewer one is requested or the password changes. All existing sessions of the user are logged out.",
                 "consumes": [
                     "application/json"
                 ],
@@ -219,7 +400,13 @@ const docTemplate = `{
                         }
                     },
                     "400": {
-                        "description": "Invalid request body | Invalid request data",
+                        "description": "Invalid request body | Password does not meet the requirements | Invalid request data | Invalid token",
+                        "schema": {
+                            "$ref": "#/definitions/api.ValidationErrorResponse"
+                        }
+                    },
+                    "410": {
+                        "description": "Token expired or already used",
                         "schema": {
                             "$ref": "#/definitions/api.ErrorResponse"
                         }
@@ -293,6 +480,12 @@ const docTemplate = `{
                         "schema": {
                             "$ref": "#/definitions/api.ErrorResponse"
                         }
+                    },
+                    "503": {
+                        "description": "Session is being renewed, please retry",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
                     }
                 }
             }
@@ -329,9 +522,9 @@ const docTemplate = `{
                         }
                     },
                     "400": {
-                        "description": "Invalid request body | Invalid role value | Email already registered | Invalid request data",
+                        "description": "Invalid request body | Password does not meet the requirements | Invalid role value | Email already registered | Invalid request data",
                         "schema": {
-                            "$ref": "#/definitions/api.ErrorResponse"
+                            "$ref": "#/definitions/api.ValidationErrorResponse"
                         }
                     },
                     "429": {
@@ -351,7 +544,7 @@ const docTemplate = `{
         },
         "/api/auth/resend-otp/{id}": {
             "post": {
-                "description": "Resends a new OTP code to the user's registered email address if the account is still inactive.",
+                "description": "Resends a new OTP code to the user's registered email address if the account is still inactive.\nA new code can only be requested once per cooldown period, and the previous code is invalidated.",
                 "consumes": [
                     "application/json"
                 ],
@@ -391,7 +584,7 @@ const docTemplate = `{
                         }
                     },
                     "429": {
-                        "description": "Rate limit exceeded",
+                        "description": "Rate limit exceeded | OTP was requested recently, please wait | Too many failed attempts, please try again later",
                         "schema": {
                             "$ref": "#/definitions/api.ErrorResponse"
                         }
@@ -442,13 +635,13 @@ const docTemplate = `{
                         }
                     },
                     "400": {
-                        "description": "Invalid OTP code | OTP expired | ID mismatch with OTP",
+                        "description": "Invalid OTP code | OTP expired",
                         "schema": {
                             "$ref": "#/definitions/api.ErrorResponse"
                         }
                     },
                     "429": {
-                        "description": "Rate limit exceeded",
+                        "description": "Too many failed attempts, please try again later | You hit the rate limit",
                         "schema": {
                             "$ref": "#/definitions/api.ErrorResponse"
                         }
@@ -483,19 +676,19 @@ const docTemplate = `{
                 "parameters": [
                     {
                         "type": "integer",
-                        "description": "Maximum number of records to return (default: 50)",
+                        "description": "Maximum number of records to return (default: 50, max: 100)",
                         "name": "limit",
                         "in": "query"
                     },
                     {
-                        "type": "integer",
-                        "description": "Number of records to skip before returning results (default: 0)",
-                        "name": "offset",
+                        "type": "string",
+                        "description": "Cursor of the next page, from the previous page",
+                        "name": "cursor",
                         "in": "query"
                     },
                     {
                         "type": "string",
-                        "description": "Sort order, e.g. -date_created (default)",
+                        "description": "Sort order: -date_created (default) or date_created",
                         "name": "sort",
                         "in": "query"
                     }
@@ -504,13 +697,13 @@ const docTemplate = `{
                     "200": {
                         "description": "List of completed bookings retrieved successfully",
                         "schema": {
-                            "type": "array",
-                            "items": {
-                                "type": "array",
-                                "items": {
-                                    "$ref": "#/definitions/db.Booking"
-                                }
-                            }
+                            "$ref": "#/definitions/api.Page-db_Booking"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid pagination parameters",
+                        "schema": {
+                            "$ref": "#/definitions/api.ValidationErrorResponse"
                         }
                     },
                     "401": {
@@ -545,7 +738,7 @@ const docTemplate = `{
                         "BearerAuth": []
                     }
                 ],
-                "description": "Creates a new booking for an event, including its associated ticket and seat items.",
+                "description": "Creates a new booking for an event, including its associated ticket and seat items.\nThe tickets are priced with the membership discount of the customer and, if any, the promo code. A code that\ndoesn't stack with the membership discount is only used if it is the better discount. A used code is held by\nthe booking until it is paid, and counts toward its usage limits for good once paid. The tickets reserved for\nthe waitlist are only sold to the customers they are offered to. A booking not paid by the end of its\nreservation expires: its tickets are released and offered to the waitlists",
                 "consumes": [
                     "application/json"
                 ],
@@ -575,7 +768,7 @@ const docTemplate = `{
                         }
                     },
                     "400": {
-                        "description": "Invalid request body | Invalid request data",
+                        "description": "Invalid request body | Invalid request data | Promo code is not active | Promo code is not valid yet | Promo code has expired | Promo code does not apply to these tickets",
                         "schema": {
                             "$ref": "#/definitions/api.ErrorResponse"
                         }
@@ -592,6 +785,18 @@ const docTemplate = `{
                             "$ref": "#/definitions/api.ErrorResponse"
                         }
                     },
+                    "404": {
+                        "description": "No promo code with such code",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Promo code has reached its usage limit | You have reached the usage limit of this promo code | Tickets are reserved for the customers on the waitlist | Event is canceled | Ticket prices changed, please book again",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
                     "429": {
                         "description": "You hit the rate limit",
                         "schema": {
@@ -674,32 +879,36 @@ const docTemplate = `{
                 }
             }
         },
-        "/api/categories": {
+        "/api/bookings/{id}/calendar.ics": {
             "get": {
                 "security": [
                     {
                         "BearerAuth": []
                     }
                 ],
-                "description": "Returns a list of all available event categories from the database.",
-                "consumes": [
-                    "application/json"
-                ],
+                "description": "Exports the booked schedules of a booking as an iCalendar file, with a reminder when check-in opens",
                 "produces": [
+                    "text/calendar",
                     "application/json"
                 ],
                 "tags": [
-                    "Events"
+                    "Bookings"
+                ],
+                "summary": "Export a booking to a calendar",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Booking ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
                 ],
-                "summary": "Retrieve all categories",
                 "responses": {
                     "200": {
-                        "description": "List of categories retrieved successfully",
+                        "description": "iCalendar file",
                         "schema": {
-                            "type": "array",
-                            "items": {
-                                "$ref": "#/definitions/db.Category"
-                            }
+                            "type": "file"
                         }
                     },
                     "401": {
@@ -714,6 +923,12 @@ const docTemplate = `{
                             "$ref": "#/definitions/api.ErrorResponse"
                         }
                     },
+                    "404": {
+                        "description": "No item with such ID",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
                     "429": {
                         "description": "You hit the rate limit",
                         "schema": {
@@ -729,57 +944,69 @@ const docTemplate = `{
                 }
             }
         },
-        "/api/checkins": {
-            "post": {
-                "description": "Allows event staff to verify a QR token, validate the event schedule,\nand mark a ticket as checked in. Requires staff credentials and Directus authentication.",
-                "consumes": [
-                    "application/json"
+        "/api/bookings/{id}/items/{itemId}/pass": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
                 ],
+                "description": "Gets the phone wallet pass of a booking item, with the same check-in QR as the ticket. With wallet=apple\n(default), downloads the signed .pkpass file; with wallet=google, returns the \"Add to Google Wallet\" link.\nThe passes are updated on the phones when the schedule of the ticket changes",
                 "produces": [
+                    "application/vnd.apple.pkpass",
                     "application/json"
                 ],
                 "tags": [
-                    "Checkin"
+                    "Bookings"
                 ],
-                "summary": "Check in attendee via QR code",
+                "summary": "Get the wallet pass of a ticket",
                 "parameters": [
                     {
-                        "description": "Check-in request payload",
-                        "name": "request",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/api.CheckinRequest"
-                        }
+                        "type": "string",
+                        "description": "Booking ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Booking item ID",
+                        "name": "itemId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "enum": [
+                            "apple",
+                            "google"
+                        ],
+                        "type": "string",
+                        "description": "Wallet: apple or google",
+                        "name": "wallet",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "Check-in successful",
-                        "schema": {
-                            "$ref": "#/definitions/api.SuccessMessage"
-                        }
-                    },
-                    "400": {
-                        "description": "Invalid request body | Checkin time not started yet | Checkin time has ended | QR not available | Invalid request data",
+                        "description": "Apple Wallet pass file | Google Wallet save link",
                         "schema": {
-                            "$ref": "#/definitions/api.ErrorResponse"
+                            "$ref": "#/definitions/api.WalletSaveLinkResponse"
                         }
                     },
                     "401": {
-                        "description": "Incorrect login credentials",
+                        "description": "Unauthorized access | Token expired",
                         "schema": {
                             "$ref": "#/definitions/api.ErrorResponse"
                         }
                     },
                     "403": {
-                        "description": "You don't have permission to perform this request",
+                        "description": "Invalid token",
                         "schema": {
                             "$ref": "#/definitions/api.ErrorResponse"
                         }
                     },
                     "404": {
-                        "description": "No item with such ID",
+                        "description": "No item with such ID | Ticket is not issued yet | Wallet is not available",
                         "schema": {
                             "$ref": "#/definitions/api.ErrorResponse"
                         }
@@ -791,7 +1018,7 @@ const docTemplate = `{
                         }
                     },
                     "500": {
-                        "description": "Internal server or Directus error",
+                        "description": "Internal server error",
                         "schema": {
                             "$ref": "#/definitions/api.ErrorResponse"
                         }
@@ -799,14 +1026,14 @@ const docTemplate = `{
                 }
             }
         },
-        "/api/events": {
-            "get": {
+        "/api/bookings/{id}/items/{itemId}/resale": {
+            "post": {
                 "security": [
                     {
                         "BearerAuth": []
                     }
                 ],
-                "description": "Returns a list of published events with minimal information",
+                "description": "Puts a ticket of a booking of the current user on sale on the resale marketplace. The price is capped at a\npercentage over the original price of the ticket. Once sold, the ticket moves to the buyer with a new QR, and\nthe price minus the platform fee is paid out to the seller. The seller keeps the ticket until it is sold",
                 "consumes": [
                     "application/json"
                 ],
@@ -814,55 +1041,45 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "Events"
+                    "Resale"
                 ],
-                "summary": "List all events",
+                "summary": "List a ticket for resale",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "Filter by event name (case-insensitive contains)",
-                        "name": "name",
-                        "in": "query"
-                    },
-                    {
-                        "type": "string",
-                        "description": "Filter by city or country (case-insensitive contains)",
-                        "name": "location",
-                        "in": "query"
+                        "description": "Booking ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
                     },
                     {
                         "type": "string",
-                        "description": "Filter by category name (case-insensitive contains)",
-                        "name": "category",
-                        "in": "query"
-                    },
-                    {
-                        "type": "integer",
-                        "description": "Limit number of results (default: 50)",
-                        "name": "limit",
-                        "in": "query"
-                    },
-                    {
-                        "type": "integer",
-                        "description": "Offset for pagination (default: 0)",
-                        "name": "offset",
-                        "in": "query"
+                        "description": "Booking item ID",
+                        "name": "itemId",
+                        "in": "path",
+                        "required": true
                     },
                     {
-                        "type": "string",
-                        "description": "Sort field (default: -date_created). Use - prefix for descending",
-                        "name": "sort",
-                        "in": "query"
+                        "description": "Asked price",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/api.CreateResaleListingRequest"
+                        }
                     }
                 ],
                 "responses": {
-                    "200": {
-                        "description": "List of events retrieved successfully",
+                    "201": {
+                        "description": "Ticket listed",
+                        "schema": {
+                            "$ref": "#/definitions/db.ResaleListing"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request body | Ticket is not issued yet | Check-in has started, the ticket can't be resold | Price must not exceed the cap",
                         "schema": {
-                            "type": "array",
-                            "items": {
-                                "$ref": "#/definitions/api.EventInfo"
-                            }
+                            "$ref": "#/definitions/api.ErrorResponse"
                         }
                     },
                     "401": {
@@ -877,6 +1094,18 @@ const docTemplate = `{
                             "$ref": "#/definitions/api.ErrorResponse"
                         }
                     },
+                    "404": {
+                        "description": "No item with such ID",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Ticket is already listed for resale | Ticket has a pending transfer",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
                     "429": {
                         "description": "You hit the rate limit",
                         "schema": {
@@ -892,14 +1121,14 @@ const docTemplate = `{
                 }
             }
         },
-        "/api/events/{id}": {
-            "get": {
+        "/api/bookings/{id}/items/{itemId}/transfer": {
+            "post": {
                 "security": [
                     {
                         "BearerAuth": []
                     }
                 ],
-                "description": "Returns detailed information about a specific event, including category, images, and schedule data.",
+                "description": "Offers a ticket of a booking of the current user to another user, found by email. The recipient is notified\nwith a link to accept the transfer; once accepted, the ticket moves to a booking of the recipient and gets a\nnew QR, the old one is revoked. Tickets can't be transferred once the check-in of their schedule started",
                 "consumes": [
                     "application/json"
                 ],
@@ -907,23 +1136,45 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "Events"
+                    "Bookings"
                 ],
-                "summary": "Retrieve a single event by ID or by its slug",
+                "summary": "Transfer a ticket",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "Event ID",
+                        "description": "Booking ID",
                         "name": "id",
                         "in": "path",
                         "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Booking item ID",
+                        "name": "itemId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Recipient",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/api.TransferBookingItemRequest"
+                        }
                     }
                 ],
                 "responses": {
-                    "200": {
-                        "description": "Event details retrieved successfully",
+                    "201": {
+                        "description": "Transfer offered",
                         "schema": {
-                            "$ref": "#/definitions/db.Event"
+                            "$ref": "#/definitions/db.TicketTransfer"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request body | Ticket is not issued yet | Check-in has started, the ticket can't be transferred | You can't transfer a ticket to yourself",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
                         }
                     },
                     "401": {
@@ -939,7 +1190,13 @@ const docTemplate = `{
                         }
                     },
                     "404": {
-                        "description": "No item with such ID",
+                        "description": "No item with such ID | No user with such email",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Ticket already has a pending transfer | Ticket is listed for resale",
                         "schema": {
                             "$ref": "#/definitions/api.ErrorResponse"
                         }
@@ -959,36 +1216,40 @@ const docTemplate = `{
                 }
             }
         },
-        "/api/memberships": {
+        "/api/bookings/{id}/tickets.pdf": {
             "get": {
                 "security": [
                     {
                         "BearerAuth": []
                     }
                 ],
-                "description": "Retrieves all published membership tiers sorted by resulting points in ascending order.",
-                "consumes": [
-                    "application/json"
-                ],
+                "description": "Downloads the ticket document of a booking: a PDF with one page per ticket, including its QR code. The\ndocument is generated once the tickets are issued",
                 "produces": [
+                    "application/pdf",
                     "application/json"
                 ],
                 "tags": [
-                    "Memberships"
+                    "Bookings"
+                ],
+                "summary": "Download the tickets of a booking",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Booking ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
                 ],
-                "summary": "List all published membership tiers",
                 "responses": {
                     "200": {
-                        "description": "List of memberships retrieved successfully",
+                        "description": "Ticket document",
                         "schema": {
-                            "type": "array",
-                            "items": {
-                                "$ref": "#/definitions/db.Membership"
-                            }
+                            "type": "file"
                         }
                     },
                     "401": {
-                        "description": "Token expired",
+                        "description": "Unauthorized access | Token expired",
                         "schema": {
                             "$ref": "#/definitions/api.ErrorResponse"
                         }
@@ -999,6 +1260,12 @@ const docTemplate = `{
                             "$ref": "#/definitions/api.ErrorResponse"
                         }
                     },
+                    "404": {
+                        "description": "No item with such ID | Tickets are not issued yet",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
                     "429": {
                         "description": "You hit the rate limit",
                         "schema": {
@@ -1014,14 +1281,57 @@ const docTemplate = `{
                 }
             }
         },
-        "/api/memberships/me": {
+        "/api/calendar/feed.ics": {
             "get": {
-                "security": [
+                "description": "Subscribable iCalendar feed of the booked schedules of a user's completed bookings, authenticated by the\nsecret token of the feed URL",
+                "produces": [
+                    "text/calendar",
+                    "application/json"
+                ],
+                "tags": [
+                    "Profile"
+                ],
+                "summary": "Calendar feed of a user",
+                "parameters": [
                     {
-                        "BearerAuth": []
+                        "type": "string",
+                        "description": "Feed token",
+                        "name": "token",
+                        "in": "query",
+                        "required": true
                     }
                 ],
-                "description": "Get customer membership information, including tier, current point, and their current privilege",
+                "responses": {
+                    "200": {
+                        "description": "iCalendar feed",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "404": {
+                        "description": "Calendar feed not found",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "You hit the rate limit",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/categories": {
+            "get": {
+                "description": "Returns a page of the available event categories from the database. No login required",
                 "consumes": [
                     "application/json"
                 ],
@@ -1029,26 +1339,40 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "Memberships"
+                    "Events"
+                ],
+                "summary": "Retrieve all categories",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Maximum number of records to return (default: 50, max: 100)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Cursor of the next page, from the previous page",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Sort order: name (default) or -name",
+                        "name": "sort",
+                        "in": "query"
+                    }
                 ],
-                "summary": "Get customer membership info",
                 "responses": {
                     "200": {
-                        "description": "Customer membership info",
-                        "schema": {
-                            "$ref": "#/definitions/api.MembershipResponse"
-                        }
-                    },
-                    "401": {
-                        "description": "Token expired",
+                        "description": "List of categories retrieved successfully",
                         "schema": {
-                            "$ref": "#/definitions/api.ErrorResponse"
+                            "$ref": "#/definitions/api.Page-db_Category"
                         }
                     },
-                    "403": {
-                        "description": "Invalid token",
+                    "400": {
+                        "description": "Invalid pagination parameters",
                         "schema": {
-                            "$ref": "#/definitions/api.ErrorResponse"
+                            "$ref": "#/definitions/api.ValidationErrorResponse"
                         }
                     },
                     "429": {
@@ -1066,14 +1390,9 @@ const docTemplate = `{
                 }
             }
         },
-        "/api/payments": {
+        "/api/checkins": {
             "post": {
-                "security": [
-                    {
-                        "BearerAuth": []
-                    }
-                ],
-                "description": "Creates a new payment intent in Stripe and records it in Directus.\nIf a ` + "`" + `payment_id` + "`" + ` is provided, retries the payment only if the existing record’s status is ` + "`" + `failed` + "`" + `.\nValidates amount range for VND, creates a Stripe payment intent with idempotency protection, and updates Directus with transaction details.",
+                "description": "Allows event staff to verify a QR token, validate the event schedule,\nand mark a ticket as checked in. Requires staff credentials and Directus authentication, plus a TOTP code\nwhen the staff has two-factor authentication enabled.",
                 "consumes": [
                     "application/json"
                 ],
@@ -1081,74 +1400,74 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "Payments"
+                    "Checkin"
                 ],
-                "summary": "Create or retry a Stripe payment",
+                "summary": "Check in attendee via QR code",
                 "parameters": [
                     {
-                        "description": "Payment creation payload",
+                        "description": "Check-in request payload",
                         "name": "request",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/api.CreatePaymentRequest"
+                            "$ref": "#/definitions/api.CheckinRequest"
                         }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "Payment intent successfully created",
+                        "description": "Check-in successful",
                         "schema": {
-                            "$ref": "#/definitions/api.CreatePaymentResponse"
+                            "$ref": "#/definitions/api.SuccessMessage"
                         }
                     },
                     "400": {
-                        "description": "Invalid request body",
+                        "description": "Invalid request body | Checkin time not started yet | Checkin time has ended | QR not available | Invalid request data",
                         "schema": {
-                            "$ref": "#/definitions/api.CreatePaymentError"
+                            "$ref": "#/definitions/api.ErrorResponse"
                         }
                     },
                     "401": {
-                        "description": "Unauthorized access | Token expired",
+                        "description": "Incorrect login credentials | Invalid MFA code",
                         "schema": {
-                            "$ref": "#/definitions/api.CreatePaymentError"
+                            "$ref": "#/definitions/api.ErrorResponse"
                         }
                     },
                     "403": {
-                        "description": "Invalid token",
+                        "description": "You don't have permission to perform this request",
                         "schema": {
-                            "$ref": "#/definitions/api.CreatePaymentError"
+                            "$ref": "#/definitions/api.ErrorResponse"
                         }
                     },
                     "404": {
                         "description": "No item with such ID",
                         "schema": {
-                            "$ref": "#/definitions/api.CreatePaymentError"
+                            "$ref": "#/definitions/api.ErrorResponse"
                         }
                     },
                     "429": {
-                        "description": "You hit the rate limit",
+                        "description": "You hit the rate limit | Too many failed MFA attempts, please retry later",
                         "schema": {
-                            "$ref": "#/definitions/api.CreatePaymentError"
+                            "$ref": "#/definitions/api.ErrorResponse"
                         }
                     },
                     "500": {
-                        "description": "Internal server error or failed Stripe/Directus operation",
+                        "description": "Internal server or Directus error",
                         "schema": {
-                            "$ref": "#/definitions/api.CreatePaymentError"
+                            "$ref": "#/definitions/api.ErrorResponse"
                         }
                     }
                 }
             }
         },
-        "/api/payments/method": {
+        "/api/events": {
             "get": {
                 "security": [
                     {
                         "BearerAuth": []
                     }
                 ],
-                "description": "Create payment method for confirm payment. This API is solely for internal testing, not to be consumed by any client",
+                "description": "Returns a list of published events with minimal information. The full-text search matches every word of q\ncase-insensitively, and ranks name matches above description matches. Sorting by relevance, start_time,\nprice, -price or distance, or searching near a location, sorts the 1000 newest matching events at most, and\nthe page is then marked as truncated. No login required, but logged in users also get the member price",
                 "consumes": [
                     "application/json"
                 ],
@@ -1156,96 +1475,118 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "Payments"
+                    "Events"
                 ],
-                "summary": "Create payment method",
-                "responses": {
-                    "200": {
-                        "description": "Payment method ID of mock visa",
-                        "schema": {
-                            "$ref": "#/definitions/api.SuccessMessage"
-                        }
+                "summary": "List all events",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Full-text search over name and description, 10 words at most",
+                        "name": "q",
+                        "in": "query"
                     },
-                    "500": {
-                        "description": "Internal server error",
-                        "schema": {
-                            "$ref": "#/definitions/api.ErrorResponse"
-                        }
-                    }
-                }
-            }
-        },
-        "/api/payments/{id}/confirm": {
-            "post": {
-                "security": [
                     {
-                        "BearerAuth": []
-                    }
-                ],
-                "description": "Confirms a Stripe payment intent and updates the payment record in the database with the confirmation status.",
-                "consumes": [
-                    "application/json"
-                ],
-                "produces": [
-                    "application/json"
-                ],
-                "tags": [
-                    "Payments"
-                ],
-                "summary": "Confirm an existing payment",
-                "parameters": [
+                        "type": "string",
+                        "description": "Filter by event name (case-insensitive contains)",
+                        "name": "name",
+                        "in": "query"
+                    },
                     {
                         "type": "string",
-                        "description": "Payment ID",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
+                        "description": "Filter by city or country (case-insensitive contains)",
+                        "name": "location",
+                        "in": "query"
                     },
                     {
-                        "description": "Payment confirmation payload",
-                        "name": "request",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/api.ConfirmPaymentRequest"
-                        }
+                        "type": "string",
+                        "description": "Filter by category name (case-insensitive contains)",
+                        "name": "category",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only events with a schedule starting at or after this date (YYYY-MM-DD or RFC 3339)",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only events with a schedule starting at or before this date (YYYY-MM-DD or RFC 3339)",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Only events with a ticket at or above this price",
+                        "name": "min_price",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Only events with a ticket at or below this price",
+                        "name": "max_price",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Only events with tickets on sale",
+                        "name": "available",
+                        "in": "query"
+                    },
+                    {
+                        "type": "number",
+                        "description": "Latitude of the location to search near",
+                        "name": "lat",
+                        "in": "query"
+                    },
+                    {
+                        "type": "number",
+                        "description": "Longitude of the location to search near",
+                        "name": "lng",
+                        "in": "query"
+                    },
+                    {
+                        "type": "number",
+                        "description": "Search radius in kilometers (default: 10)",
+                        "name": "radius",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Limit number of results (default: 50, max: 100)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Cursor of the next page, from the previous page",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "relevance (default with q), start_time, price, -price, distance, name, -name, date_created or -date_created (default)",
+                        "name": "sort",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "Payment confirmed successfully",
+                        "description": "List of events retrieved successfully",
                         "schema": {
-                            "$ref": "#/definitions/db.Payment"
+                            "$ref": "#/definitions/api.EventPage"
                         }
                     },
                     "400": {
-                        "description": "Invalid request body",
-                        "schema": {
-                            "$ref": "#/definitions/api.ErrorResponse"
-                        }
-                    },
-                    "401": {
-                        "description": "Unauthorized access | Token expired",
-                        "schema": {
-                            "$ref": "#/definitions/api.CreatePaymentError"
-                        }
-                    },
-                    "403": {
-                        "description": "Invalid token",
+                        "description": "Invalid search parameters | Invalid pagination parameters",
                         "schema": {
-                            "$ref": "#/definitions/api.CreatePaymentError"
-                        }
-                    },
-                    "404": {
-                        "description": "No item with such ID",
-                        "schema": {
-                            "$ref": "#/definitions/api.CreatePaymentError"
+                            "$ref": "#/definitions/api.ValidationErrorResponse"
                         }
                     },
                     "429": {
                         "description": "You hit the rate limit",
                         "schema": {
-                            "$ref": "#/definitions/api.CreatePaymentError"
+                            "$ref": "#/definitions/api.ErrorResponse"
                         }
                     },
                     "500": {
@@ -1257,14 +1598,14 @@ const docTemplate = `{
                 }
             }
         },
-        "/api/payments/{id}/refund": {
-            "post": {
+        "/api/events/{id}": {
+            "get": {
                 "security": [
                     {
                         "BearerAuth": []
                     }
                 ],
-                "description": "Initiates a Stripe refund for a completed payment and records it in Directus.\nThis API is for user-requested refunds (partial refund if outside the allowed time window)",
+                "description": "Returns detailed information about a specific published event, including category, images, and schedule\ndata. No login required, but logged in users also get the member price of the tickets.",
                 "consumes": [
                     "application/json"
                 ],
@@ -1272,13 +1613,13 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "Payments"
+                    "Events"
                 ],
-                "summary": "Refund a successful payment",
+                "summary": "Retrieve a single event by ID or by its slug",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "Payment ID",
+                        "description": "Event ID",
                         "name": "id",
                         "in": "path",
                         "required": true
@@ -1286,31 +1627,61 @@ const docTemplate = `{
                 ],
                 "responses": {
                     "200": {
-                        "description": "Refund processed successfully",
+                        "description": "Event details retrieved successfully",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/api.PublicEvent"
                         }
                     },
-                    "400": {
-                        "description": "A payment must success first before refund | Refund failed",
+                    "404": {
+                        "description": "No item with such ID",
                         "schema": {
                             "$ref": "#/definitions/api.ErrorResponse"
                         }
                     },
-                    "401": {
-                        "description": "Unauthorized access | Token expired",
+                    "429": {
+                        "description": "You hit the rate limit",
                         "schema": {
                             "$ref": "#/definitions/api.ErrorResponse"
                         }
                     },
-                    "403": {
-                        "description": "Invalid token",
+                    "500": {
+                        "description": "Internal server error",
                         "schema": {
                             "$ref": "#/definitions/api.ErrorResponse"
                         }
+                    }
+                }
+            }
+        },
+        "/api/events/{id}/calendar.ics": {
+            "get": {
+                "description": "Exports every schedule of a published event as an iCalendar file, with a reminder when check-in opens.\nNo login required",
+                "produces": [
+                    "text/calendar",
+                    "application/json"
+                ],
+                "tags": [
+                    "Events"
+                ],
+                "summary": "Export an event to a calendar",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Event ID or slug",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "iCalendar file",
+                        "schema": {
+                            "type": "file"
+                        }
                     },
                     "404": {
-                        "description": "No item with such ID",
+                        "description": "No event found",
                         "schema": {
                             "$ref": "#/definitions/api.ErrorResponse"
                         }
@@ -1320,45 +1691,64 @@ const docTemplate = `{
                         "schema": {
                             "$ref": "#/definitions/api.ErrorResponse"
                         }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
                     }
                 }
             }
         },
-        "/api/profile": {
+        "/api/events/{id}/resale": {
             "get": {
-                "security": [
-                    {
-                        "BearerAuth": []
-                    }
-                ],
-                "description": "Get user profile",
-                "consumes": [
-                    "application/json"
-                ],
+                "description": "Lists the tickets of an event on sale on the resale marketplace, cheapest first. The tickets held by a buyer\nwhile they pay are not listed",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Profile"
+                    "Resale"
+                ],
+                "summary": "List the resale tickets of an event",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Event ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Maximum number of records to return (default: 50, max: 100)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Cursor of the next page, from the previous page",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Sort order: price (default), -price, -date_created or date_created",
+                        "name": "sort",
+                        "in": "query"
+                    }
                 ],
-                "summary": "User profile",
                 "responses": {
                     "200": {
-                        "description": "User profile",
-                        "schema": {
-                            "$ref": "#/definitions/api.ProfileResponse"
-                        }
-                    },
-                    "401": {
-                        "description": "Token expired",
+                        "description": "List of listings",
                         "schema": {
-                            "$ref": "#/definitions/api.ErrorResponse"
+                            "$ref": "#/definitions/api.Page-db_ResaleListing"
                         }
                     },
-                    "403": {
-                        "description": "Invalid token",
+                    "400": {
+                        "description": "Invalid pagination parameters",
                         "schema": {
-                            "$ref": "#/definitions/api.ErrorResponse"
+                            "$ref": "#/definitions/api.ValidationErrorResponse"
                         }
                     },
                     "429": {
@@ -1374,14 +1764,16 @@ const docTemplate = `{
                         }
                     }
                 }
-            },
-            "put": {
+            }
+        },
+        "/api/events/{id}/waitlist": {
+            "post": {
                 "security": [
                     {
                         "BearerAuth": []
                     }
                 ],
-                "description": "Updates the current user's profile information including first name, last name, password, and avatar.\nThe avatar is expected to be a base64-encoded image",
+                "description": "Joins the FIFO waitlist of a ticket type of an event, once its tickets on sale are sold out. When a ticket\nfrees up (booking expiry, refund or cancellation), it is offered to the next customer in line, and reserved\nfor them for a while to book it. The customer is notified through their channels. An offer not claimed in\ntime rolls over to the next customer. Joining again keeps the place in the queue",
                 "consumes": [
                     "application/json"
                 ],
@@ -1389,41 +1781,54 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "Profile"
+                    "Events"
                 ],
-                "summary": "Update user profile",
+                "summary": "Join the waitlist of a sold-out ticket type",
                 "parameters": [
                     {
-                        "description": "Profile update request body",
+                        "type": "string",
+                        "description": "Event ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Ticket type",
                         "name": "request",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/api.UpdateProfileRequest"
+                            "$ref": "#/definitions/api.JoinWaitlistRequest"
                         }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "Profile updated successfully",
+                        "description": "Joined the waitlist",
                         "schema": {
-                            "$ref": "#/definitions/api.ProfileResponse"
+                            "$ref": "#/definitions/api.JoinWaitlistResponse"
                         }
                     },
                     "400": {
-                        "description": "Invalid request body",
+                        "description": "Invalid request body | Ticket is not on sale",
                         "schema": {
                             "$ref": "#/definitions/api.ErrorResponse"
                         }
                     },
                     "401": {
-                        "description": "Token expired",
+                        "description": "Unauthorized access",
                         "schema": {
                             "$ref": "#/definitions/api.ErrorResponse"
                         }
                     },
-                    "403": {
-                        "description": "Invalid token",
+                    "404": {
+                        "description": "No ticket with such ID in this event",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Tickets are still on sale | A ticket is already reserved for you",
                         "schema": {
                             "$ref": "#/definitions/api.ErrorResponse"
                         }
@@ -1443,453 +1848,5219 @@ const docTemplate = `{
                 }
             }
         },
-        "/api/webhook/notifications": {
-            "post": {
-                "description": "Receives webhook payloads from Directus flows and dispatches notifications to various destinations (in-app, Telegram, email) using background workers.",
-                "consumes": [
-                    "application/json"
-                ],
+        "/api/exports/download": {
+            "get": {
+                "description": "Downloads the data export archive, using the token from the link sent by email",
                 "produces": [
+                    "application/zip",
                     "application/json"
                 ],
                 "tags": [
-                    "Notifications"
+                    "Profile"
                 ],
-                "summary": "Handle Directus notification webhook",
+                "summary": "Download a data export",
                 "parameters": [
                     {
-                        "description": "Notification webhook payload",
-                        "name": "request",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/api.NotificationRequest"
-                        }
+                        "type": "string",
+                        "description": "Download token",
+                        "name": "token",
+                        "in": "query",
+                        "required": true
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "Notification dispatched successfully",
+                        "description": "Data export archive",
                         "schema": {
-                            "$ref": "#/definitions/api.SuccessMessage"
+                            "type": "file"
                         }
                     },
-                    "400": {
-                        "description": "Invalid request body or missing required destinations",
+                    "410": {
+                        "description": "Download link invalid or expired",
                         "schema": {
                             "$ref": "#/definitions/api.ErrorResponse"
                         }
                     },
                     "500": {
-                        "description": "Internal server error or failed to distribute background task",
+                        "description": "Internal server error",
                         "schema": {
                             "$ref": "#/definitions/api.ErrorResponse"
                         }
                     }
                 }
             }
-        }
-    },
-    "definitions": {
-        "api.BookingItemCreate": {
-            "type": "object",
+        },
+        "/api/memberships": {
+            "get": {
+                "description": "Retrieves a page of the published membership tiers sorted by resulting points. No login required",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Memberships"
+                ],
+                "summary": "List all published membership tiers",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Maximum number of records to return (default: 50, max: 100)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Cursor of the next page, from the previous page",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Sort order: base_point (default) or -base_point",
+                        "name": "sort",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "List of memberships retrieved successfully",
+                        "schema": {
+                            "$ref": "#/definitions/api.Page-db_Membership"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid pagination parameters",
+                        "schema": {
+                            "$ref": "#/definitions/api.ValidationErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "You hit the rate limit",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/memberships/me": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Get customer membership information, including tier, current point, and their current privilege",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Memberships"
+                ],
+                "summary": "Get customer membership info",
+                "responses": {
+                    "200": {
+                        "description": "Customer membership info",
+                        "schema": {
+                            "$ref": "#/definitions/api.MembershipResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Token expired",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Invalid token",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "You hit the rate limit",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/organizer/events": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Returns the events created by the current organizer, with every status (draft and published)",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Organizer"
+                ],
+                "summary": "List organizer events",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Limit number of results (default: 50, max: 100)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Cursor of the next page, from the previous page",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Sort order: -date_created (default), date_created, name or -name",
+                        "name": "sort",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "List of events",
+                        "schema": {
+                            "$ref": "#/definitions/api.Page-db_Event"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid pagination parameters",
+                        "schema": {
+                            "$ref": "#/definitions/api.ValidationErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized access | Token expired",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Invalid token | You don't have permission to perform this request",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "You hit the rate limit",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Creates a draft event for the current organizer. The slug is generated from the name. Add schedules, seat\nzones and tickets, then publish it",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Organizer"
+                ],
+                "summary": "Create event",
+                "parameters": [
+                    {
+                        "description": "Event information",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/api.EventRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Event created",
+                        "schema": {
+                            "$ref": "#/definitions/db.Event"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request body | Invalid category",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized access | Token expired",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Invalid token | You don't have permission to perform this request",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "You hit the rate limit",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/organizer/events/{id}": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Returns an event created by the current organizer, with all its schedules, seat zones, tickets and\nselling schedules, whatever their status",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Organizer"
+                ],
+                "summary": "Get organizer event",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Event ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Event details",
+                        "schema": {
+                            "$ref": "#/definitions/db.Event"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized access | Token expired",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Invalid token | You don't have permission to perform this request",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "No item with such ID",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "You hit the rate limit",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Updates the information of an event created by the current organizer. The slug follows the name while the\nevent is a draft, and is kept once published so that shared links keep working",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Organizer"
+                ],
+                "summary": "Update event",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Event ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Event information",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/api.EventRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Event updated",
+                        "schema": {
+                            "$ref": "#/definitions/db.Event"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request body | Invalid category",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized access | Token expired",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Invalid token | You don't have permission to perform this request",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "No item with such ID",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "You hit the rate limit",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/organizer/events/{id}/cancel": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Gets the progress of the cancellation of an event created by the current organizer: the refunded and failed\npayments, and the refunded amount against the paid amount. The payments in failures must be refunded\nmanually. The report is kept for 30 days",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Organizer"
+                ],
+                "summary": "Get event cancellation report",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Event ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Cancellation report",
+                        "schema": {
+                            "$ref": "#/definitions/worker.EventCancellation"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized access | Token expired",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Invalid token | You don't have permission to perform this request",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "No item with such ID | Event is not canceled",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "You hit the rate limit",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Cancels an event created by the current organizer. Every successful payment of the event is refunded in\nfull in the background, in batches, its tickets are invalidated and its customer is notified through every\nchannel. The holders of transferred tickets are notified too. Follow the progress with the cancellation report",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Organizer"
+                ],
+                "summary": "Cancel event",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Event ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Cancellation reason",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/api.CancelEventRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Event canceled, refunds in progress",
+                        "schema": {
+                            "$ref": "#/definitions/api.SuccessMessage"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request body",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized access | Token expired",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Invalid token | You don't have permission to perform this request",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "No item with such ID",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Event already canceled",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "You hit the rate limit",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/organizer/events/{id}/publish": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Publishes an event created by the current organizer, so that customers can see it and book tickets. The\nevent needs at least one schedule, and one published ticket with a selling schedule",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Organizer"
+                ],
+                "summary": "Publish event",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Event ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Event published",
+                        "schema": {
+                            "$ref": "#/definitions/api.SuccessMessage"
+                        }
+                    },
+                    "400": {
+                        "description": "Event is not ready to be published",
+                        "schema": {
+                            "$ref": "#/definitions/api.ValidationErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized access | Token expired",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Invalid token | You don't have permission to perform this request",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "No item with such ID",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Event is canceled",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "You hit the rate limit",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/organizer/events/{id}/schedules": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Adds a schedule (one occurrence of the event) to an event created by the current organizer. The schedule\nmust start at least MinEventLeadDays days from now, and last at least MinEventDurationMinutes minutes",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Organizer"
+                ],
+                "summary": "Add event schedule",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Event ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Schedule",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/api.EventScheduleRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Schedule created",
+                        "schema": {
+                            "$ref": "#/definitions/db.EventSchedule"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request body | Schedule does not meet the requirements",
+                        "schema": {
+                            "$ref": "#/definitions/api.ValidationErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized access | Token expired",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Invalid token | You don't have permission to perform this request",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "No item with such ID",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "You hit the rate limit",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/organizer/events/{id}/schedules/{scheduleID}": {
+            "put": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Updates a schedule of an event created by the current organizer. The schedule is validated like a new one.\nThe wallet passes of the tickets of the schedule are updated in the background",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Organizer"
+                ],
+                "summary": "Update event schedule",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Event ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Schedule ID",
+                        "name": "scheduleID",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Schedule",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/api.EventScheduleRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Schedule updated",
+                        "schema": {
+                            "$ref": "#/definitions/db.EventSchedule"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request body | Schedule does not meet the requirements",
+                        "schema": {
+                            "$ref": "#/definitions/api.ValidationErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized access | Token expired",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Invalid token | You don't have permission to perform this request",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "No item with such ID",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "You hit the rate limit",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Deletes a schedule of an event created by the current organizer. Not allowed once the event has bookings",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Organizer"
+                ],
+                "summary": "Delete event schedule",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Event ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Schedule ID",
+                        "name": "scheduleID",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Schedule deleted",
+                        "schema": {
+                            "$ref": "#/definitions/api.SuccessMessage"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized access | Token expired",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Invalid token | You don't have permission to perform this request",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "No item with such ID",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Event already has bookings | Event is canceled",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "You hit the rate limit",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/organizer/events/{id}/seat-zones": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Adds a seat zone to an event created by the current organizer",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Organizer"
+                ],
+                "summary": "Add seat zone",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Event ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Seat zone",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/api.SeatZoneRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Seat zone created",
+                        "schema": {
+                            "$ref": "#/definitions/db.SeatZone"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request body",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized access | Token expired",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Invalid token | You don't have permission to perform this request",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "No item with such ID",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "You hit the rate limit",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/organizer/events/{id}/seat-zones/{zoneID}": {
+            "put": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Updates a seat zone of an event created by the current organizer. Once a seat map is imported, the total seats must match it",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Organizer"
+                ],
+                "summary": "Update seat zone",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Event ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Seat zone ID",
+                        "name": "zoneID",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Seat zone",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/api.SeatZoneRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Seat zone updated",
+                        "schema": {
+                            "$ref": "#/definitions/db.SeatZone"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request body | Total seats must match the seat map",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized access | Token expired",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Invalid token | You don't have permission to perform this request",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "No item with such ID",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "You hit the rate limit",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Deletes a seat zone of an event created by the current organizer. Not allowed once the event has bookings",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Organizer"
+                ],
+                "summary": "Delete seat zone",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Event ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Seat zone ID",
+                        "name": "zoneID",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Seat zone deleted",
+                        "schema": {
+                            "$ref": "#/definitions/api.SuccessMessage"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized access | Token expired",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Invalid token | You don't have permission to perform this request",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "No item with such ID",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Event already has bookings",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "You hit the rate limit",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/organizer/events/{id}/seat-zones/{zoneID}/seats": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Replaces the seats of a seat zone of an event created by the current organizer, and sets the total seats of\nthe zone to the number of seats. The seats are either generated from a compact layout, like\n{\"rows\": \"A-J\", \"seats_per_row\": 20, \"aisles\": [5, 15], \"skip\": [\"13\", \"A1\"]}, or imported from a base64\nCSV file (columns seat_number, and optionally row, x and y) or JSON file (an array of seats, or a layout).\nNot allowed once the event has bookings",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Organizer"
+                ],
+                "summary": "Import seat map",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Event ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Seat zone ID",
+                        "name": "zoneID",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Layout or file",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/api.SeatMapRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Seats created",
+                        "schema": {
+                            "$ref": "#/definitions/api.SeatMapResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request body | Invalid seat map",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized access | Token expired",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Invalid token | You don't have permission to perform this request",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "No item with such ID",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Event already has bookings",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "413": {
+                        "description": "Seat map file too large",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "You hit the rate limit",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/organizer/events/{id}/tickets": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Adds a ticket type to an event created by the current organizer, with its selling schedules. Each selling\nschedule must last at least MinSellingDurationMinutes minutes, and end before the last event schedule ends",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Organizer"
+                ],
+                "summary": "Add ticket",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Event ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Ticket",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/api.CreateTicketRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Ticket created",
+                        "schema": {
+                            "$ref": "#/definitions/db.Ticket"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request body | Selling schedule does not meet the requirements",
+                        "schema": {
+                            "$ref": "#/definitions/api.ValidationErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized access | Token expired",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Invalid token | You don't have permission to perform this request",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "No item with such ID",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "You hit the rate limit",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/organizer/events/{id}/tickets/{ticketID}": {
+            "put": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Updates a ticket type of an event created by the current organizer. Its selling schedules are managed with\nthe selling schedule endpoints",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Organizer"
+                ],
+                "summary": "Update ticket",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Event ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Ticket ID",
+                        "name": "ticketID",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Ticket",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/api.TicketRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Ticket updated",
+                        "schema": {
+                            "$ref": "#/definitions/db.Ticket"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request body",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized access | Token expired",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Invalid token | You don't have permission to perform this request",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "No item with such ID",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "You hit the rate limit",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Deletes a ticket type of an event created by the current organizer. Not allowed once the event has bookings",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Organizer"
+                ],
+                "summary": "Delete ticket",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Event ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Ticket ID",
+                        "name": "ticketID",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Ticket deleted",
+                        "schema": {
+                            "$ref": "#/definitions/api.SuccessMessage"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized access | Token expired",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Invalid token | You don't have permission to perform this request",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "No item with such ID",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Event already has bookings",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "You hit the rate limit",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/organizer/events/{id}/tickets/{ticketID}/selling-schedules": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Adds a selling schedule to a ticket of an event created by the current organizer",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Organizer"
+                ],
+                "summary": "Add ticket selling schedule",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Event ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Ticket ID",
+                        "name": "ticketID",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Selling schedule",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/api.SellingScheduleRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Selling schedule created",
+                        "schema": {
+                            "$ref": "#/definitions/db.TicketSellingSchedule"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request body | Selling schedule does not meet the requirements",
+                        "schema": {
+                            "$ref": "#/definitions/api.ValidationErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized access | Token expired",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Invalid token | You don't have permission to perform this request",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "No item with such ID",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "You hit the rate limit",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/organizer/events/{id}/tickets/{ticketID}/selling-schedules/{scheduleID}": {
+            "put": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Updates a selling schedule of a ticket of an event created by the current organizer. Changing the total\nchanges the available tickets by the same amount, and the total can't go below the tickets already sold",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Organizer"
+                ],
+                "summary": "Update ticket selling schedule",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Event ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Ticket ID",
+                        "name": "ticketID",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Selling schedule ID",
+                        "name": "scheduleID",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Selling schedule",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/api.SellingScheduleRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Selling schedule updated",
+                        "schema": {
+                            "$ref": "#/definitions/db.TicketSellingSchedule"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request body | Selling schedule does not meet the requirements",
+                        "schema": {
+                            "$ref": "#/definitions/api.ValidationErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized access | Token expired",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Invalid token | You don't have permission to perform this request",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "No item with such ID",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Total is lower than the tickets already sold",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "You hit the rate limit",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Deletes a selling schedule of a ticket of an event created by the current organizer. Not allowed once the\nevent has bookings",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Organizer"
+                ],
+                "summary": "Delete ticket selling schedule",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Event ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Ticket ID",
+                        "name": "ticketID",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Selling schedule ID",
+                        "name": "scheduleID",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Selling schedule deleted",
+                        "schema": {
+                            "$ref": "#/definitions/api.SuccessMessage"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized access | Token expired",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Invalid token | You don't have permission to perform this request",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "No item with such ID",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Event already has bookings",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "You hit the rate limit",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/organizer/events/{id}/unpublish": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Moves an event created by the current organizer back to draft, hiding it from customers. An event that\nalready has bookings can't be unpublished",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Organizer"
+                ],
+                "summary": "Unpublish event",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Event ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Event unpublished",
+                        "schema": {
+                            "$ref": "#/definitions/api.SuccessMessage"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized access | Token expired",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Invalid token | You don't have permission to perform this request",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "No item with such ID",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Event already has bookings | Event is canceled",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "You hit the rate limit",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/payments": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Creates a new payment intent in Stripe and records it in Directus.\nIf a ` + "`" + `payment_id` + "`" + ` is provided, retries the payment only if the existing record’s status is ` + "`" + `failed` + "`" + `.\nThe amount must be the total of the booking, with its discounts and the payment fee.\nValidates amount range for VND, creates a Stripe payment intent with idempotency protection, and updates Directus with transaction details.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Payments"
+                ],
+                "summary": "Create or retry a Stripe payment",
+                "parameters": [
+                    {
+                        "description": "Payment creation payload",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/api.CreatePaymentRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Payment intent successfully created",
+                        "schema": {
+                            "$ref": "#/definitions/api.CreatePaymentResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request body | Booking is not waiting for payment | Payment amount must be ... VND",
+                        "schema": {
+                            "$ref": "#/definitions/api.CreatePaymentError"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized access | Token expired",
+                        "schema": {
+                            "$ref": "#/definitions/api.CreatePaymentError"
+                        }
+                    },
+                    "403": {
+                        "description": "Invalid token",
+                        "schema": {
+                            "$ref": "#/definitions/api.CreatePaymentError"
+                        }
+                    },
+                    "404": {
+                        "description": "No item with such ID",
+                        "schema": {
+                            "$ref": "#/definitions/api.CreatePaymentError"
+                        }
+                    },
+                    "409": {
+                        "description": "Event is canceled",
+                        "schema": {
+                            "$ref": "#/definitions/api.CreatePaymentError"
+                        }
+                    },
+                    "429": {
+                        "description": "You hit the rate limit",
+                        "schema": {
+                            "$ref": "#/definitions/api.CreatePaymentError"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error or failed Stripe/Directus operation",
+                        "schema": {
+                            "$ref": "#/definitions/api.CreatePaymentError"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/payments/method": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Create payment method for confirm payment. This API is solely for internal testing, not to be consumed by any client",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Payments"
+                ],
+                "summary": "Create payment method",
+                "responses": {
+                    "200": {
+                        "description": "Payment method ID of mock visa",
+                        "schema": {
+                            "$ref": "#/definitions/api.SuccessMessage"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/payments/{id}/confirm": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Confirms a Stripe payment intent. Once the payment succeeded, the booking is confirmed in the background:\nthe payment is recorded, the booking completed, the tickets issued, the loyalty points credited and the\ncustomer notified. The progress is shown in the confirmation_steps of the booking",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Payments"
+                ],
+                "summary": "Confirm an existing payment",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Payment ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Payment confirmation payload",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/api.ConfirmPaymentRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Payment confirmed successfully",
+                        "schema": {
+                            "$ref": "#/definitions/db.Payment"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request body",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized access | Token expired",
+                        "schema": {
+                            "$ref": "#/definitions/api.CreatePaymentError"
+                        }
+                    },
+                    "403": {
+                        "description": "Invalid token",
+                        "schema": {
+                            "$ref": "#/definitions/api.CreatePaymentError"
+                        }
+                    },
+                    "404": {
+                        "description": "No item with such ID",
+                        "schema": {
+                            "$ref": "#/definitions/api.CreatePaymentError"
+                        }
+                    },
+                    "409": {
+                        "description": "Event is canceled",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "You hit the rate limit",
+                        "schema": {
+                            "$ref": "#/definitions/api.CreatePaymentError"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/payments/{id}/refund": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Previews the amount refunded for the tickets of a successful payment, before the customer commits. The\nrefunded percent of each ticket follows the refund policy: it depends on the time left before the start of\nits schedule, with a full refund during a grace period after the payment",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Payments"
+                ],
+                "summary": "Preview the refund of a payment",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Payment ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Comma separated booking item IDs. Default: every item of the payment",
+                        "name": "items",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Refund preview",
+                        "schema": {
+                            "$ref": "#/definitions/api.RefundPreviewResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "A payment must success first before refund | No item with such ID in this payment",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized access | Token expired",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Invalid token",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "No item with such ID",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "You hit the rate limit",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Refunds the chosen tickets of a successful payment (every refundable ticket by default) through Stripe, by\nthe refund policy (see the refund preview). The refunded tickets are invalidated and their seats released,\nand the tickets are offered to the waitlists of their types.\nTickets already checked in can't be refunded.\nA payment can be refunded several times, until every ticket is refunded. A refund that Stripe doesn't\ncomplete right away is answered with 202 and the pending refund: its tickets are released once it succeeds,\nor the refund is marked as failed",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Payments"
+                ],
+                "summary": "Refund tickets of a successful payment",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Payment ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Refunded tickets and reason",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/api.CreateRefundRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Refund processed successfully",
+                        "schema": {
+                            "$ref": "#/definitions/api.CreateRefundResponse"
+                        }
+                    },
+                    "202": {
+                        "description": "Refund pending in Stripe, settled in the background",
+                        "schema": {
+                            "$ref": "#/definitions/api.CreateRefundResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request body | A payment must success first before refund | No item with such ID in this payment | Nothing to refund | Refund failed",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized access | Token expired",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Invalid token",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "No item with such ID",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "A refund of this payment is in progress | A ticket is listed for resale, cancel the listing first | A ticket has a pending transfer, cancel the transfer first",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "You hit the rate limit",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/profile": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Get user profile",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Profile"
+                ],
+                "summary": "User profile",
+                "responses": {
+                    "200": {
+                        "description": "User profile",
+                        "schema": {
+                            "$ref": "#/definitions/api.ProfileResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Token expired",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Invalid token",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "You hit the rate limit",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Updates the current user's profile information including first name, last name, password, and avatar.\nThe avatar is expected to be a base64-encoded image. Changing the password logs out every session, including\nthe current one",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Profile"
+                ],
+                "summary": "Update user profile",
+                "parameters": [
+                    {
+                        "description": "Profile update request body",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/api.UpdateProfileRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Profile updated successfully",
+                        "schema": {
+                            "$ref": "#/definitions/api.ProfileResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request body | Password does not meet the requirements",
+                        "schema": {
+                            "$ref": "#/definitions/api.ValidationErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Token expired",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Invalid token",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "You hit the rate limit",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Deletes the current user account. Personal information is anonymized and the personal links (Telegram,\nsocial login, two-factor authentication) are deleted, while bookings, payments, refunds and check-ins are\nkept for accounting. Every session is logged out. Requires the current password whenever the account has\none. An account without a password must log in with a social login provider.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Profile"
+                ],
+                "summary": "Delete user account",
+                "parameters": [
+                    {
+                        "description": "Current password",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/api.DeleteProfileRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Account deleted",
+                        "schema": {
+                            "$ref": "#/definitions/api.SuccessMessage"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request body | Password is required",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Token expired | Incorrect login credentials",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Invalid token",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Too many failed attempts, please try again later | You hit the rate limit",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/profile/calendar": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Creates a secret URL that calendar apps can subscribe to, to keep the schedules of the user's completed\nbookings in sync. Creating a new feed revokes the previous URL",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Profile"
+                ],
+                "summary": "Create the calendar feed of the user",
+                "responses": {
+                    "201": {
+                        "description": "Calendar feed created",
+                        "schema": {
+                            "$ref": "#/definitions/api.CalendarFeedResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Token expired",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Invalid token",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "You hit the rate limit",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Revokes the subscription URL of the user's calendar feed",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Profile"
+                ],
+                "summary": "Delete the calendar feed of the user",
+                "responses": {
+                    "200": {
+                        "description": "Calendar feed deleted",
+                        "schema": {
+                            "$ref": "#/definitions/api.SuccessMessage"
+                        }
+                    },
+                    "401": {
+                        "description": "Token expired",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Invalid token",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "You hit the rate limit",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/profile/export": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Starts building an archive of everything we store about the current user: profile, bookings, booking items,\npayments, refunds, check-ins, membership logs and Telegram links. The archive is built in the background,\nand a download link valid for 24 hours is sent by email.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Profile"
+                ],
+                "summary": "Export all user data",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Archive format: zip (default) or json",
+                        "name": "format",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Data export started",
+                        "schema": {
+                            "$ref": "#/definitions/api.SuccessMessage"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid format",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Token expired",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Invalid token",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "You hit the rate limit | A data export was requested recently, please wait",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/profile/mfa": {
+            "delete": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Disables two-factor authentication of the current user. Requires either a code from the authenticator app,\nor a recovery code",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Profile"
+                ],
+                "summary": "Disable two-factor authentication",
+                "parameters": [
+                    {
+                        "description": "TOTP code or recovery code",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/api.SecondFactorRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Two-factor authentication disabled",
+                        "schema": {
+                            "$ref": "#/definitions/api.SuccessMessage"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request body | Invalid MFA code | Two-factor authentication not enabled",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Token expired",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Invalid token",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Too many failed MFA attempts, please retry later | You hit the rate limit",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/profile/mfa/enroll": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Generates a new TOTP secret for the current organizer or staff account, returned as plain text, otpauth:// URL\nand QR code to scan with an authenticator app. Two-factor authentication is only enabled after a code is\nverified with /api/profile/mfa/verify. Enrolling again before verifying replaces the previous secret",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Profile"
+                ],
+                "summary": "Enroll in two-factor authentication",
+                "responses": {
+                    "200": {
+                        "description": "TOTP secret",
+                        "schema": {
+                            "$ref": "#/definitions/api.EnrollMFAResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Token expired",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Invalid token | You don't have permission to perform this request",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Two-factor authentication already enabled",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "You hit the rate limit",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/profile/mfa/recovery-codes": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Replaces every recovery code of the current user with new ones. Requires a code from the authenticator app",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Profile"
+                ],
+                "summary": "Regenerate recovery codes",
+                "parameters": [
+                    {
+                        "description": "TOTP code",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/api.MFACodeRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "New recovery codes",
+                        "schema": {
+                            "$ref": "#/definitions/api.RecoveryCodesResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request body | Invalid MFA code | Two-factor authentication not enabled",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Token expired",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Invalid token",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "A recovery code is being used, please retry",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Too many failed MFA attempts, please retry later | You hit the rate limit",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/profile/mfa/verify": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Verifies a code from the authenticator app to finish the enrollment, then enables two-factor authentication.\nReturns the recovery codes, which are only shown once: each of them can be used once instead of a TOTP code",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Profile"
+                ],
+                "summary": "Verify two-factor authentication enrollment",
+                "parameters": [
+                    {
+                        "description": "TOTP code",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/api.MFACodeRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Two-factor authentication enabled",
+                        "schema": {
+                            "$ref": "#/definitions/api.RecoveryCodesResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request body | Invalid MFA code | No pending enrollment",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Token expired",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Invalid token",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Too many failed MFA attempts, please retry later | You hit the rate limit",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/profile/sessions": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Lists the active sessions of the current user, most recently used first, with the device they were\ncreated from. The session of the current access token is marked as current",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Profile"
+                ],
+                "summary": "List active sessions",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Maximum number of records to return (default: 50, max: 100)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Cursor of the next page, from the previous page",
+                        "name": "cursor",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Active sessions",
+                        "schema": {
+                            "$ref": "#/definitions/api.Page-api_SessionResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid pagination parameters",
+                        "schema": {
+                            "$ref": "#/definitions/api.ValidationErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Token expired | Session revoked, please login again",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Invalid token",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "You hit the rate limit",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Logs out every session of the current user, including the current one",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Profile"
+                ],
+                "summary": "Log out everywhere",
+                "responses": {
+                    "200": {
+                        "description": "Logged out from all sessions",
+                        "schema": {
+                            "$ref": "#/definitions/api.SuccessMessage"
+                        }
+                    },
+                    "401": {
+                        "description": "Token expired | Session revoked, please login again",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Invalid token",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "You hit the rate limit",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/profile/sessions/{id}": {
+            "delete": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Logs out a session of the current user, for example on a lost device. Its refresh token is logged out and\nits access tokens are rejected immediately",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Profile"
+                ],
+                "summary": "Revoke a session",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Session ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Session revoked",
+                        "schema": {
+                            "$ref": "#/definitions/api.SuccessMessage"
+                        }
+                    },
+                    "401": {
+                        "description": "Token expired | Session revoked, please login again",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Invalid token",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Session not found",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "You hit the rate limit",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/promo-codes/validate": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Checks a promo code for the tickets of an event before checkout, and prices them at their base price with the\nmembership discount of the current user and the code. A code that doesn't stack with the membership discount\nis only used if it is the better discount. The code is not used until a booking is created with it",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Bookings"
+                ],
+                "summary": "Validate a promo code",
+                "parameters": [
+                    {
+                        "description": "Code and tickets",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/api.ValidatePromoCodeRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Code valid, with the price",
+                        "schema": {
+                            "$ref": "#/definitions/api.ValidatePromoCodeResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request body | Invalid request data | Promo code is not active | Promo code is not valid yet | Promo code has expired | Promo code does not apply to these tickets",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized access | Token expired",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Invalid token",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "No promo code with such code",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Promo code has reached its usage limit | You have reached the usage limit of this promo code | Event is canceled",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "You hit the rate limit",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/resale": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Lists the tickets the current user listed for resale, newest first, with the platform fee and the payout",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Resale"
+                ],
+                "summary": "List my resale listings",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Maximum number of records to return (default: 50, max: 100)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Cursor of the next page, from the previous page",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Sort order: -date_created (default) or date_created",
+                        "name": "sort",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "active",
+                            "sold",
+                            "canceled"
+                        ],
+                        "type": "string",
+                        "description": "Status filter",
+                        "name": "status",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "List of listings",
+                        "schema": {
+                            "$ref": "#/definitions/api.Page-db_ResaleListing"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid pagination parameters",
+                        "schema": {
+                            "$ref": "#/definitions/api.ValidationErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized access | Token expired",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Invalid token",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "You hit the rate limit",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/resale/{id}": {
+            "delete": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Takes a ticket of the current user off the resale marketplace. A listing held by a buyer can't be canceled\nuntil the hold ends",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Resale"
+                ],
+                "summary": "Cancel a resale listing",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Listing ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Listing canceled",
+                        "schema": {
+                            "$ref": "#/definitions/api.SuccessMessage"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized access | Token expired",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Invalid token",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "No item with such ID",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Listing is not for sale | Listing is held by a buyer | Listing is being updated, please retry",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "You hit the rate limit",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/resale/{id}/buy": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Holds a listing for the current user and creates their booking for it, to pay through the payment endpoints\nlike any booking. The listing is held until reserved_until; once paid, the ticket moves to the booking with a\nnew QR, and the seller is paid out. Buying again while holding the listing returns the same booking",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Resale"
+                ],
+                "summary": "Buy a resale ticket",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Listing ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Listing held, booking to pay",
+                        "schema": {
+                            "$ref": "#/definitions/api.BuyResaleListingResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "You can't buy your own ticket",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized access | Token expired",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Invalid token",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "No item with such ID",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Listing is not for sale | Listing is held by another buyer | Listing is being updated, please retry | The ticket can't be resold anymore",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "You hit the rate limit",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/transfers": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Lists the ticket transfers sent or received by the current user, newest first: the pending offers to accept,\nand the history of the transfers",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Bookings"
+                ],
+                "summary": "List ticket transfers",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Maximum number of records to return (default: 50, max: 100)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Cursor of the next page, from the previous page",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Sort order: -date_created (default) or date_created",
+                        "name": "sort",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "pending",
+                            "accepted",
+                            "declined",
+                            "canceled"
+                        ],
+                        "type": "string",
+                        "description": "Status filter",
+                        "name": "status",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "List of transfers",
+                        "schema": {
+                            "$ref": "#/definitions/api.Page-db_TicketTransfer"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid pagination parameters",
+                        "schema": {
+                            "$ref": "#/definitions/api.ValidationErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized access | Token expired",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Invalid token",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "You hit the rate limit",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/transfers/{id}/accept": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Accepts a ticket transfer offered to the current user. The ticket moves to a new booking of the recipient,\nand a new QR is issued in the background; the QR of the sender is revoked at once",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Bookings"
+                ],
+                "summary": "Accept a ticket transfer",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Transfer ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Transfer accepted",
+                        "schema": {
+                            "$ref": "#/definitions/db.TicketTransfer"
+                        }
+                    },
+                    "400": {
+                        "description": "Check-in has started, the ticket can't be transferred",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized access | Token expired",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Invalid token",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "No item with such ID",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Transfer is not pending anymore | The ticket can't be transferred anymore | A refund of this ticket is in progress",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "You hit the rate limit",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/transfers/{id}/cancel": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Closes a pending ticket transfer: the sender takes the ticket back, or the recipient declines it. The ticket\nstays with the sender",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Bookings"
+                ],
+                "summary": "Cancel a ticket transfer",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Transfer ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Transfer canceled | Transfer declined",
+                        "schema": {
+                            "$ref": "#/definitions/api.SuccessMessage"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized access | Token expired",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Invalid token",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "No item with such ID",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Transfer is not pending anymore",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "You hit the rate limit",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/webhook/bookings/{id}/confirm": {
+            "post": {
+                "description": "Restarts the confirmation of a paid booking whose background confirmation stopped, for example after its\nretries ran out. The completed steps of the booking are skipped. A booking is never confirmed without a\nsuccessful payment, or a processing one whose Stripe payment intent succeeded. The flow must send the webhook\nsecret in the X-Webhook-Secret header",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Webhooks"
+                ],
+                "summary": "Resume the confirmation of a booking",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Webhook secret",
+                        "name": "X-Webhook-Secret",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Booking ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Booking confirmation resumed",
+                        "schema": {
+                            "$ref": "#/definitions/api.SuccessMessage"
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid webhook secret",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/webhook/cache": {
+            "post": {
+                "description": "Called by a Directus flow when items of events, event_schedules, seat_zones, tickets, ticket_selling_schedules,\ncategories or memberships are created, updated or deleted. Deletes the cached values of the collection.\nThe flow must send the webhook secret in the X-Webhook-Secret header",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Webhooks"
+                ],
+                "summary": "Invalidate cached catalog",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Webhook secret",
+                        "name": "X-Webhook-Secret",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "Changed collection",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/api.CacheInvalidationRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Cache invalidated",
+                        "schema": {
+                            "$ref": "#/definitions/api.CacheInvalidationResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request body | Collection is not cached",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid webhook secret",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/webhook/notifications": {
+            "post": {
+                "description": "Receives webhook payloads from Directus flows and dispatches notifications to various destinations (in-app, Telegram, email) using background workers.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Notifications"
+                ],
+                "summary": "Handle Directus notification webhook",
+                "parameters": [
+                    {
+                        "description": "Notification webhook payload",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/api.NotificationRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Notification dispatched successfully",
+                        "schema": {
+                            "$ref": "#/definitions/api.SuccessMessage"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request body or missing required destinations",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error or failed to distribute background task",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/webhook/tickets/publish": {
+            "post": {
+                "description": "Kept for one release for the flows still calling it, use /api/webhook/bookings/{id}/confirm instead. Resumes\nthe confirmation of the bookings of the items, which publishes their QR once the booking is paid. The flow\nmust send the webhook secret in the X-Webhook-Secret header",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Webhooks"
+                ],
+                "summary": "Publish the QR of booking items (deprecated)",
+                "deprecated": true,
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Webhook secret",
+                        "name": "X-Webhook-Secret",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "Booking items",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/api.PublishQRTicketsRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Booking confirmation resumed",
+                        "schema": {
+                            "$ref": "#/definitions/api.SuccessMessage"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request body",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid webhook secret",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/webhook/tickets/released": {
+            "post": {
+                "description": "Called by a Directus flow when tickets of a type are back on sale outside of the API, for example after a\nbooking was canceled in Directus. The tickets freed by the expired bookings and the refunds are already\noffered by the API. Each ticket is offered to the next customer in the waitlist of its type, if any. The\nflow must send the webhook secret in the X-Webhook-Secret header",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Webhooks"
+                ],
+                "summary": "Offer released tickets to the waitlist",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Webhook secret",
+                        "name": "X-Webhook-Secret",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "Released tickets",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/api.TicketsReleasedRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Tickets offered to the waitlist",
+                        "schema": {
+                            "$ref": "#/definitions/api.SuccessMessage"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request body",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid webhook secret",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "api.BookingItemCreate": {
+            "type": "object",
+            "required": [
+                "event_schedule_id",
+                "seat_id",
+                "ticket_id"
+            ],
+            "properties": {
+                "event_schedule_id": {
+                    "type": "string"
+                },
+                "seat_id": {
+                    "type": "string"
+                },
+                "ticket_id": {
+                    "type": "string"
+                }
+            }
+        },
+        "api.BuyResaleListingResponse": {
+            "type": "object",
+            "properties": {
+                "booking_id": {
+                    "description": "Booking to pay through the payment endpoints",
+                    "type": "string"
+                },
+                "fee_charged": {
+                    "type": "integer"
+                },
+                "listing_id": {
+                    "type": "string"
+                },
+                "price": {
+                    "type": "integer"
+                },
+                "reserved_until": {
+                    "description": "The booking must be paid before, or the listing is on sale again",
+                    "type": "string"
+                },
+                "total_price_paid": {
+                    "description": "Amount of the payment",
+                    "type": "integer"
+                }
+            }
+        },
+        "api.CacheInvalidationRequest": {
+            "type": "object",
+            "required": [
+                "collection"
+            ],
+            "properties": {
+                "collection": {
+                    "description": "Collection of the changed items, the trigger's $trigger.collection",
+                    "type": "string"
+                }
+            }
+        },
+        "api.CacheInvalidationResponse": {
+            "type": "object",
+            "properties": {
+                "deleted": {
+                    "description": "Number of cached values deleted",
+                    "type": "integer"
+                },
+                "tags": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "api.CalendarFeedResponse": {
+            "type": "object",
+            "properties": {
+                "url": {
+                    "description": "Subscription URL of the feed, secret",
+                    "type": "string"
+                }
+            }
+        },
+        "api.CancelEventRequest": {
+            "type": "object",
+            "required": [
+                "reason"
+            ],
+            "properties": {
+                "reason": {
+                    "description": "Shown to the attendees",
+                    "type": "string"
+                }
+            }
+        },
+        "api.CheckinRequest": {
+            "type": "object",
+            "required": [
+                "checkin_device",
+                "staff_email",
+                "staff_password",
+                "token"
+            ],
+            "properties": {
+                "checkin_device": {
+                    "type": "string"
+                },
+                "staff_email": {
+                    "type": "string"
+                },
+                "staff_otp": {
+                    "description": "Required if the staff has two-factor authentication enabled",
+                    "type": "string"
+                },
+                "staff_password": {
+                    "type": "string"
+                },
+                "token": {
+                    "type": "string"
+                }
+            }
+        },
+        "api.ConfirmPaymentRequest": {
+            "type": "object",
+            "required": [
+                "payment_intent_id",
+                "payment_method_id"
+            ],
+            "properties": {
+                "payment_intent_id": {
+                    "type": "string"
+                },
+                "payment_method_id": {
+                    "type": "string"
+                }
+            }
+        },
+        "api.CreateBookingRequest": {
+            "type": "object",
+            "required": [
+                "event_id",
+                "items"
+            ],
+            "properties": {
+                "event_id": {
+                    "type": "string"
+                },
+                "items": {
+                    "type": "array",
+                    "minItems": 1,
+                    "items": {
+                        "$ref": "#/definitions/api.BookingItemCreate"
+                    }
+                },
+                "promo_code": {
+                    "description": "Optional promo code",
+                    "type": "string"
+                }
+            }
+        },
+        "api.CreateBookingResponse": {
+            "type": "object",
+            "properties": {
+                "customer": {
+                    "$ref": "#/definitions/db.User"
+                },
+                "event": {
+                    "$ref": "#/definitions/db.Event"
+                },
+                "fee_charged": {
+                    "type": "integer"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "member_discount": {
+                    "description": "Discount of the membership",
+                    "type": "integer"
+                },
+                "promo_code": {
+                    "type": "string"
+                },
+                "promo_discount": {
+                    "description": "Discount of the promo code, 0 if it is not used",
+                    "type": "integer"
+                },
+                "status": {
+                    "type": "string"
+                },
+                "tickets": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/db.BookingItem"
+                    }
+                },
+                "total_price_paid": {
+                    "type": "integer"
+                }
+            }
+        },
+        "api.CreatePaymentError": {
+            "type": "object",
+            "properties": {
+                "message": {
+                    "type": "string"
+                },
+                "payment_id": {
+                    "type": "string"
+                }
+            }
+        },
+        "api.CreatePaymentRequest": {
+            "type": "object",
+            "required": [
+                "amount",
+                "booking_id"
+            ],
+            "properties": {
+                "amount": {
+                    "type": "integer"
+                },
+                "booking_id": {
+                    "type": "string"
+                },
+                "payment_id": {
+                    "description": "Used for retry",
+                    "type": "string"
+                }
+            }
+        },
+        "api.CreatePaymentResponse": {
+            "type": "object",
+            "properties": {
+                "client_secret": {
+                    "description": "Client secret",
+                    "type": "string"
+                },
+                "payment_id": {
+                    "description": "Database ID",
+                    "type": "string"
+                },
+                "publishable_key": {
+                    "description": "Stripe publishable key",
+                    "type": "string"
+                },
+                "transaction_id": {
+                    "description": "Stripe payment_intent_id",
+                    "type": "string"
+                }
+            }
+        },
+        "api.CreateRefundRequest": {
+            "type": "object",
+            "required": [
+                "reason"
+            ],
+            "properties": {
+                "booking_item_ids": {
+                    "description": "Items to refund. Default: every refundable item of the payment",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "reason": {
+                    "type": "string",
+                    "enum": [
+                        "cannot-attend",
+                        "schedule-conflict",
+                        "event-changed",
+                        "duplicate-purchase",
+                        "other"
+                    ]
+                }
+            }
+        },
+        "api.CreateRefundResponse": {
+            "type": "object",
+            "properties": {
+                "amount": {
+                    "type": "integer"
+                },
+                "booking_item_ids": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "id": {
+                    "type": "string"
+                },
+                "refunded_amount": {
+                    "description": "Total refunded amount of the payment, with this refund",
+                    "type": "integer"
+                },
+                "status": {
+                    "description": "success, or pending while Stripe completes the refund",
+                    "type": "string"
+                }
+            }
+        },
+        "api.CreateResaleListingRequest": {
+            "type": "object",
+            "required": [
+                "price"
+            ],
+            "properties": {
+                "price": {
+                    "description": "Asked price in VND, capped over the original price of the ticket",
+                    "type": "integer",
+                    "minimum": 100
+                }
+            }
+        },
+        "api.CreateTicketRequest": {
+            "type": "object",
+            "required": [
+                "rank"
+            ],
+            "properties": {
+                "base_price": {
+                    "type": "integer",
+                    "minimum": 0
+                },
+                "description": {
+                    "type": "string"
+                },
+                "rank": {
+                    "type": "string"
+                },
+                "seat_zone_id": {
+                    "type": "string"
+                },
+                "selling_schedules": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/api.SellingScheduleRequest"
+                    }
+                },
+                "status": {
+                    "description": "Default: published",
+                    "type": "string",
+                    "enum": [
+                        "draft",
+                        "published"
+                    ]
+                }
+            }
+        },
+        "api.DeleteProfileRequest": {
+            "type": "object",
+            "properties": {
+                "password": {
+                    "type": "string"
+                }
+            }
+        },
+        "api.EnrollMFAResponse": {
+            "type": "object",
+            "properties": {
+                "otpauth_url": {
+                    "type": "string"
+                },
+                "qr_code": {
+                    "description": "PNG image, as a data URL",
+                    "type": "string"
+                },
+                "secret": {
+                    "type": "string"
+                }
+            }
+        },
+        "api.ErrorResponse": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "type": "string"
+                }
+            }
+        },
+        "api.EventInfo": {
+            "type": "object",
+            "properties": {
+                "address": {
+                    "type": "string"
+                },
+                "base_price": {
+                    "description": "Minimum ticket price, among the tickets in the price range",
+                    "type": "integer"
+                },
+                "category": {
+                    "$ref": "#/definitions/db.Category"
+                },
+                "city": {
+                    "type": "string"
+                },
+                "country": {
+                    "type": "string"
+                },
+                "distance": {
+                    "description": "Distance in kilometers, when searching near a location",
+                    "type": "number"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "member_price": {
+                    "description": "Base price with the membership discount, only for logged in users",
+                    "type": "integer"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "preview_image": {
+                    "type": "string"
+                },
+                "start_time": {
+                    "description": "Closest upcoming schedule time, among the schedules in the date range",
+                    "type": "string"
+                }
+            }
+        },
+        "api.EventPage": {
+            "type": "object",
+            "properties": {
+                "data": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/api.EventInfo"
+                    }
+                },
+                "next_cursor": {
+                    "description": "Cursor of the next page, empty on the last page",
+                    "type": "string"
+                },
+                "total": {
+                    "description": "Number of items in the whole list",
+                    "type": "integer"
+                },
+                "truncated": {
+                    "type": "boolean"
+                }
+            }
+        },
+        "api.EventRequest": {
+            "type": "object",
+            "required": [
+                "address",
+                "category_id",
+                "city",
+                "country",
+                "name"
+            ],
+            "properties": {
+                "address": {
+                    "type": "string"
+                },
+                "category_id": {
+                    "type": "string"
+                },
+                "city": {
+                    "type": "string"
+                },
+                "country": {
+                    "type": "string"
+                },
+                "description": {
+                    "type": "string"
+                },
+                "latitude": {
+                    "type": "number",
+                    "maximum": 90,
+                    "minimum": -90
+                },
+                "longitude": {
+                    "type": "number",
+                    "maximum": 180,
+                    "minimum": -180
+                },
+                "name": {
+                    "type": "string"
+                }
+            }
+        },
+        "api.EventScheduleRequest": {
+            "type": "object",
+            "required": [
+                "end_time",
+                "start_time"
+            ],
+            "properties": {
+                "end_checkin_time": {
+                    "type": "string"
+                },
+                "end_time": {
+                    "type": "string"
+                },
+                "start_checkin_time": {
+                    "type": "string"
+                },
+                "start_time": {
+                    "type": "string"
+                }
+            }
+        },
+        "api.JoinWaitlistRequest": {
+            "type": "object",
             "required": [
-                "event_schedule_id",
-                "seat_id",
                 "ticket_id"
             ],
             "properties": {
-                "event_schedule_id": {
+                "ticket_id": {
+                    "type": "string"
+                }
+            }
+        },
+        "api.JoinWaitlistResponse": {
+            "type": "object",
+            "properties": {
+                "position": {
+                    "description": "1 for the next customer offered a ticket",
+                    "type": "integer"
+                },
+                "ticket_id": {
+                    "type": "string"
+                }
+            }
+        },
+        "api.LoginMFARequest": {
+            "type": "object",
+            "required": [
+                "challenge"
+            ],
+            "properties": {
+                "challenge": {
+                    "type": "string"
+                },
+                "code": {
+                    "type": "string"
+                },
+                "recovery_code": {
+                    "type": "string"
+                }
+            }
+        },
+        "api.LoginRequest": {
+            "type": "object",
+            "required": [
+                "email",
+                "password"
+            ],
+            "properties": {
+                "email": {
+                    "type": "string"
+                },
+                "password": {
+                    "type": "string"
+                }
+            }
+        },
+        "api.LoginResponse": {
+            "type": "object",
+            "properties": {
+                "access_token": {
+                    "type": "string"
+                },
+                "expires": {
+                    "type": "integer"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "refresh_token": {
+                    "type": "string"
+                }
+            }
+        },
+        "api.LogoutRequest": {
+            "type": "object",
+            "required": [
+                "refresh_token"
+            ],
+            "properties": {
+                "refresh_token": {
+                    "type": "string"
+                }
+            }
+        },
+        "api.MFAChallengeResponse": {
+            "type": "object",
+            "properties": {
+                "challenge": {
+                    "type": "string"
+                },
+                "expires_in": {
+                    "description": "Seconds",
+                    "type": "integer"
+                },
+                "mfa_required": {
+                    "type": "boolean"
+                }
+            }
+        },
+        "api.MFACodeRequest": {
+            "type": "object",
+            "required": [
+                "code"
+            ],
+            "properties": {
+                "code": {
+                    "type": "string"
+                }
+            }
+        },
+        "api.MembershipResponse": {
+            "type": "object",
+            "properties": {
+                "discount": {
+                    "type": "number"
+                },
+                "early_buy_time": {
+                    "type": "integer"
+                },
+                "points": {
+                    "type": "integer"
+                },
+                "tier": {
+                    "type": "string"
+                }
+            }
+        },
+        "api.NotificationRequest": {
+            "type": "object",
+            "properties": {
+                "body": {
+                    "description": "Notification body",
                     "type": "string"
                 },
-                "seat_id": {
+                "dest_email": {
+                    "description": "The destination email, if allow sending email notification",
                     "type": "string"
                 },
-                "ticket_id": {
+                "dest_inapp": {
+                    "description": "The channel to send the in app notification using Pub/Sub model",
+                    "type": "string"
+                },
+                "dest_telegram": {
+                    "description": "The chat ID of telegram, if allow telegram notification",
+                    "type": "integer"
+                },
+                "name": {
+                    "description": "Event name (in can be the notification category)",
+                    "type": "string"
+                },
+                "queue": {
+                    "description": "The impact of this notification. It can be: low, default or critical",
+                    "type": "string"
+                },
+                "title": {
+                    "description": "Notification title",
                     "type": "string"
                 }
             }
         },
-        "api.CheckinRequest": {
+        "api.OAuthAuthorizeResponse": {
+            "type": "object",
+            "properties": {
+                "authorization_url": {
+                    "type": "string"
+                }
+            }
+        },
+        "api.OAuthCallbackRequest": {
             "type": "object",
             "required": [
-                "checkin_device",
-                "staff_email",
-                "staff_password",
-                "token"
+                "code",
+                "state"
             ],
             "properties": {
-                "checkin_device": {
+                "code": {
                     "type": "string"
                 },
-                "staff_email": {
+                "state": {
                     "type": "string"
+                }
+            }
+        },
+        "api.Page-api_SessionResponse": {
+            "type": "object",
+            "properties": {
+                "data": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/api.SessionResponse"
+                    }
                 },
-                "staff_password": {
+                "next_cursor": {
+                    "description": "Cursor of the next page, empty on the last page",
                     "type": "string"
                 },
-                "token": {
+                "total": {
+                    "description": "Number of items in the whole list",
+                    "type": "integer"
+                }
+            }
+        },
+        "api.Page-db_Booking": {
+            "type": "object",
+            "properties": {
+                "data": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/db.Booking"
+                    }
+                },
+                "next_cursor": {
+                    "description": "Cursor of the next page, empty on the last page",
                     "type": "string"
+                },
+                "total": {
+                    "description": "Number of items in the whole list",
+                    "type": "integer"
                 }
             }
         },
-        "api.ConfirmPaymentRequest": {
+        "api.Page-db_Category": {
             "type": "object",
-            "required": [
-                "payment_intent_id",
-                "payment_method_id"
-            ],
             "properties": {
-                "payment_intent_id": {
+                "data": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/db.Category"
+                    }
+                },
+                "next_cursor": {
+                    "description": "Cursor of the next page, empty on the last page",
                     "type": "string"
                 },
-                "payment_method_id": {
+                "total": {
+                    "description": "Number of items in the whole list",
+                    "type": "integer"
+                }
+            }
+        },
+        "api.Page-db_Event": {
+            "type": "object",
+            "properties": {
+                "data": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/db.Event"
+                    }
+                },
+                "next_cursor": {
+                    "description": "Cursor of the next page, empty on the last page",
                     "type": "string"
+                },
+                "total": {
+                    "description": "Number of items in the whole list",
+                    "type": "integer"
                 }
             }
         },
-        "api.CreateBookingRequest": {
+        "api.Page-db_Membership": {
+            "type": "object",
+            "properties": {
+                "data": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/db.Membership"
+                    }
+                },
+                "next_cursor": {
+                    "description": "Cursor of the next page, empty on the last page",
+                    "type": "string"
+                },
+                "total": {
+                    "description": "Number of items in the whole list",
+                    "type": "integer"
+                }
+            }
+        },
+        "api.Page-db_ResaleListing": {
+            "type": "object",
+            "properties": {
+                "data": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/db.ResaleListing"
+                    }
+                },
+                "next_cursor": {
+                    "description": "Cursor of the next page, empty on the last page",
+                    "type": "string"
+                },
+                "total": {
+                    "description": "Number of items in the whole list",
+                    "type": "integer"
+                }
+            }
+        },
+        "api.Page-db_TicketTransfer": {
+            "type": "object",
+            "properties": {
+                "data": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/db.TicketTransfer"
+                    }
+                },
+                "next_cursor": {
+                    "description": "Cursor of the next page, empty on the last page",
+                    "type": "string"
+                },
+                "total": {
+                    "description": "Number of items in the whole list",
+                    "type": "integer"
+                }
+            }
+        },
+        "api.ProfileResponse": {
+            "type": "object",
+            "properties": {
+                "avatar": {
+                    "type": "string"
+                },
+                "email": {
+                    "type": "string"
+                },
+                "first_name": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "last_name": {
+                    "type": "string"
+                },
+                "location": {
+                    "type": "string"
+                }
+            }
+        },
+        "api.PromoCodeItem": {
             "type": "object",
             "required": [
-                "event_id",
-                "items"
+                "ticket_id"
             ],
             "properties": {
-                "event_id": {
+                "ticket_id": {
+                    "type": "string"
+                }
+            }
+        },
+        "api.PublicEvent": {
+            "type": "object",
+            "properties": {
+                "address": {
                     "type": "string"
                 },
-                "items": {
+                "category": {
+                    "$ref": "#/definitions/db.Category"
+                },
+                "city": {
+                    "type": "string"
+                },
+                "country": {
+                    "type": "string"
+                },
+                "description": {
+                    "type": "string"
+                },
+                "event_schedules": {
                     "type": "array",
-                    "minItems": 1,
                     "items": {
-                        "$ref": "#/definitions/api.BookingItemCreate"
+                        "$ref": "#/definitions/db.EventSchedule"
+                    }
+                },
+                "id": {
+                    "type": "string"
+                },
+                "latitude": {
+                    "type": "number"
+                },
+                "longitude": {
+                    "type": "number"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "organizer": {
+                    "$ref": "#/definitions/api.PublicOrganizer"
+                },
+                "preview_image": {
+                    "type": "string"
+                },
+                "seat_zones": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/db.SeatZone"
+                    }
+                },
+                "slug": {
+                    "type": "string"
+                },
+                "tickets": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/api.PublicTicket"
                     }
                 }
             }
         },
-        "api.CreateBookingResponse": {
+        "api.PublicOrganizer": {
             "type": "object",
             "properties": {
-                "customer": {
-                    "$ref": "#/definitions/db.User"
+                "first_name": {
+                    "type": "string"
                 },
-                "event": {
+                "last_name": {
+                    "type": "string"
+                }
+            }
+        },
+        "api.PublicTicket": {
+            "type": "object",
+            "properties": {
+                "base_price": {
+                    "type": "integer"
+                },
+                "description": {
+                    "type": "string"
+                },
+                "event_id": {
                     "$ref": "#/definitions/db.Event"
                 },
-                "fee_charged": {
+                "id": {
+                    "type": "string"
+                },
+                "member_price": {
+                    "description": "Price with the membership discount, only for logged in users",
                     "type": "integer"
                 },
-                "id": {
+                "rank": {
                     "type": "string"
                 },
+                "seat_zone_id": {
+                    "$ref": "#/definitions/db.SeatZone"
+                },
                 "status": {
                     "type": "string"
                 },
-                "tickets": {
+                "ticket_selling_schedules": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/db.TicketSellingSchedule"
+                    }
+                }
+            }
+        },
+        "api.PublishQRTicketsRequest": {
+            "type": "object",
+            "required": [
+                "booking_item_ids"
+            ],
+            "properties": {
+                "booking_item_ids": {
                     "type": "array",
                     "items": {
-                        "$ref": "#/definitions/db.BookingItem"
+                        "type": "string"
                     }
-                },
-                "total_price_paid": {
-                    "type": "integer"
                 }
             }
         },
-        "api.CreatePaymentError": {
+        "api.RecoveryCodesResponse": {
             "type": "object",
             "properties": {
-                "message": {
-                    "type": "string"
-                },
-                "payment_id": {
-                    "type": "string"
+                "recovery_codes": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
                 }
             }
         },
-        "api.CreatePaymentRequest": {
+        "api.RefundItemPreview": {
             "type": "object",
-            "required": [
-                "amount",
-                "booking_id"
-            ],
             "properties": {
                 "amount": {
+                    "description": "Refunded amount, with the share of the fees of the item",
                     "type": "integer"
                 },
-                "booking_id": {
+                "booking_item_id": {
                     "type": "string"
                 },
-                "payment_id": {
-                    "description": "Used for retry",
+                "percent": {
+                    "description": "Refunded percent of the item, by the refund policy",
+                    "type": "integer"
+                },
+                "price": {
+                    "type": "integer"
+                },
+                "reason": {
+                    "description": "Why the item can't be refunded",
                     "type": "string"
+                },
+                "refundable": {
+                    "type": "boolean"
                 }
             }
         },
-        "api.CreatePaymentResponse": {
+        "api.RefundPreviewResponse": {
             "type": "object",
             "properties": {
-                "client_secret": {
-                    "description": "Client secret",
-                    "type": "string"
+                "amount": {
+                    "description": "Refundable amount of the requested items",
+                    "type": "integer"
+                },
+                "items": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/api.RefundItemPreview"
+                    }
+                },
+                "paid_amount": {
+                    "type": "integer"
                 },
                 "payment_id": {
-                    "description": "Database ID",
                     "type": "string"
                 },
-                "publishable_key": {
-                    "description": "Stripe publishable key",
-                    "type": "string"
+                "reasons": {
+                    "description": "Refund reasons the customer can choose",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
                 },
-                "transaction_id": {
-                    "description": "Stripe payment_intent_id",
-                    "type": "string"
+                "refunded_amount": {
+                    "description": "Already refunded, or being refunded",
+                    "type": "integer"
                 }
             }
         },
-        "api.ErrorResponse": {
+        "api.RegisterRequest": {
             "type": "object",
+            "required": [
+                "email",
+                "firstname",
+                "lastname",
+                "password",
+                "role"
+            ],
             "properties": {
-                "error": {
+                "email": {
+                    "type": "string"
+                },
+                "firstname": {
+                    "type": "string"
+                },
+                "lastname": {
+                    "type": "string"
+                },
+                "password": {
+                    "type": "string"
+                },
+                "role": {
                     "type": "string"
                 }
             }
         },
-        "api.EventInfo": {
+        "api.RegisterResponse": {
             "type": "object",
             "properties": {
-                "address": {
-                    "type": "string"
-                },
-                "base_price": {
-                    "description": "Minimum ticket price",
-                    "type": "integer"
-                },
-                "category": {
-                    "$ref": "#/definitions/db.Category"
-                },
-                "city": {
+                "email": {
                     "type": "string"
                 },
-                "country": {
+                "first_name": {
                     "type": "string"
                 },
                 "id": {
                     "type": "string"
                 },
-                "name": {
+                "last_name": {
                     "type": "string"
                 },
-                "preview_image": {
+                "role": {
                     "type": "string"
                 },
-                "start_time": {
-                    "description": "Closest upcoming schedule time",
+                "status": {
                     "type": "string"
                 }
             }
         },
-        "api.LoginRequest": {
+        "api.ResetPasswordRequest": {
             "type": "object",
             "required": [
-                "email",
-                "password"
+                "new_password",
+                "token"
             ],
             "properties": {
-                "email": {
+                "new_password": {
                     "type": "string"
                 },
-                "password": {
+                "token": {
                     "type": "string"
                 }
             }
         },
-        "api.LoginResponse": {
+        "api.SeatMapRequest": {
             "type": "object",
             "properties": {
-                "access_token": {
+                "file": {
+                    "description": "Base64 content of the imported file",
                     "type": "string"
                 },
-                "expires": {
-                    "type": "integer"
-                },
-                "id": {
+                "filename": {
+                    "description": "Name of the imported file, its extension tells the format (.csv or .json)",
                     "type": "string"
                 },
-                "refresh_token": {
-                    "type": "string"
+                "layout": {
+                    "description": "Compact layout to generate the seats from",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/seatmap.Layout"
+                        }
+                    ]
                 }
             }
         },
-        "api.LogoutRequest": {
+        "api.SeatMapResponse": {
             "type": "object",
-            "required": [
-                "refresh_token"
-            ],
             "properties": {
-                "refresh_token": {
-                    "type": "string"
+                "seats": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/seatmap.Seat"
+                    }
+                },
+                "total_seats": {
+                    "type": "integer"
                 }
             }
         },
-        "api.MembershipResponse": {
+        "api.SeatZoneRequest": {
             "type": "object",
+            "required": [
+                "description",
+                "total_seats"
+            ],
             "properties": {
-                "discount": {
-                    "type": "number"
-                },
-                "early_buy_time": {
-                    "type": "integer"
+                "description": {
+                    "type": "string"
                 },
-                "points": {
-                    "type": "integer"
+                "status": {
+                    "description": "Default: published",
+                    "type": "string",
+                    "enum": [
+                        "draft",
+                        "published"
+                    ]
                 },
-                "tier": {
-                    "type": "string"
+                "total_seats": {
+                    "type": "integer",
+                    "minimum": 1
                 }
             }
         },
-        "api.NotificationRequest": {
+        "api.SecondFactorRequest": {
             "type": "object",
             "properties": {
-                "body": {
-                    "description": "Notification body",
+                "code": {
                     "type": "string"
                 },
-                "dest_email": {
-                    "description": "The destination email, if allow sending email notification",
+                "recovery_code": {
                     "type": "string"
-                },
-                "dest_inapp": {
-                    "description": "The channel to send the in app notification using Pub/Sub model",
+                }
+            }
+        },
+        "api.SellingScheduleRequest": {
+            "type": "object",
+            "required": [
+                "end_selling_time",
+                "start_selling_time",
+                "total"
+            ],
+            "properties": {
+                "end_selling_time": {
                     "type": "string"
                 },
-                "dest_telegram": {
-                    "description": "The chat ID of telegram, if allow telegram notification",
-                    "type": "integer"
-                },
-                "name": {
-                    "description": "Event name (in can be the notification category)",
+                "start_selling_time": {
                     "type": "string"
                 },
-                "queue": {
-                    "description": "The impact of this notification. It can be: low, default or critical",
-                    "type": "string"
+                "status": {
+                    "description": "Default: published",
+                    "type": "string",
+                    "enum": [
+                        "draft",
+                        "published"
+                    ]
                 },
-                "title": {
-                    "description": "Notification title",
-                    "type": "string"
+                "total": {
+                    "type": "integer",
+                    "minimum": 1
                 }
             }
         },
-        "api.ProfileResponse": {
+        "api.SessionResponse": {
             "type": "object",
             "properties": {
-                "avatar": {
+                "created_at": {
                     "type": "string"
                 },
-                "email": {
-                    "type": "string"
+                "current": {
+                    "type": "boolean"
                 },
-                "first_name": {
+                "id": {
                     "type": "string"
                 },
-                "id": {
+                "ip": {
                     "type": "string"
                 },
-                "last_name": {
+                "last_used_at": {
                     "type": "string"
                 },
-                "location": {
+                "user_agent": {
                     "type": "string"
                 }
             }
         },
-        "api.RegisterRequest": {
+        "api.SuccessMessage": {
+            "type": "object",
+            "properties": {
+                "message": {
+                    "type": "string"
+                }
+            }
+        },
+        "api.TicketRequest": {
             "type": "object",
             "required": [
-                "email",
-                "firstname",
-                "lastname",
-                "password",
-                "role"
+                "rank"
             ],
             "properties": {
-                "email": {
-                    "type": "string"
+                "base_price": {
+                    "type": "integer",
+                    "minimum": 0
                 },
-                "firstname": {
+                "description": {
                     "type": "string"
                 },
-                "lastname": {
+                "rank": {
                     "type": "string"
                 },
-                "password": {
+                "seat_zone_id": {
                     "type": "string"
                 },
-                "role": {
+                "status": {
+                    "description": "Default: published",
+                    "type": "string",
+                    "enum": [
+                        "draft",
+                        "published"
+                    ]
+                }
+            }
+        },
+        "api.TicketsReleasedRequest": {
+            "type": "object",
+            "required": [
+                "quantity",
+                "ticket_id"
+            ],
+            "properties": {
+                "quantity": {
+                    "description": "Number of tickets of the type back on sale",
+                    "type": "integer",
+                    "minimum": 1
+                },
+                "ticket_id": {
                     "type": "string"
                 }
             }
         },
-        "api.RegisterResponse": {
+        "api.TransferBookingItemRequest": {
             "type": "object",
+            "required": [
+                "email"
+            ],
             "properties": {
                 "email": {
+                    "description": "Email of the recipient, who must have an account",
                     "type": "string"
-                },
-                "first_name": {
+                }
+            }
+        },
+        "api.UpdateProfileRequest": {
+            "type": "object",
+            "properties": {
+                "avatar": {
                     "type": "string"
                 },
-                "id": {
+                "first_name": {
                     "type": "string"
                 },
                 "last_name": {
                     "type": "string"
                 },
-                "role": {
+                "location": {
                     "type": "string"
                 },
-                "status": {
+                "password": {
                     "type": "string"
                 }
             }
         },
-        "api.ResetPasswordRequest": {
+        "api.ValidatePromoCodeRequest": {
             "type": "object",
+            "required": [
+                "code",
+                "event_id",
+                "items"
+            ],
             "properties": {
-                "new_password": {
+                "code": {
                     "type": "string"
                 },
-                "token": {
-                    "type": "string"
-                }
-            }
-        },
-        "api.SuccessMessage": {
-            "type": "object",
-            "properties": {
-                "message": {
+                "event_id": {
                     "type": "string"
+                },
+                "items": {
+                    "description": "One item per ticket to book",
+                    "type": "array",
+                    "minItems": 1,
+                    "items": {
+                        "$ref": "#/definitions/api.PromoCodeItem"
+                    }
                 }
             }
         },
-        "api.UpdateProfileRequest": {
+        "api.ValidatePromoCodeResponse": {
             "type": "object",
             "properties": {
-                "avatar": {
+                "code": {
                     "type": "string"
                 },
-                "first_name": {
+                "discount_type": {
                     "type": "string"
                 },
-                "last_name": {
-                    "type": "string"
+                "quote": {
+                    "description": "Price of the tickets at their base price, with the discounts",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/promo.Quote"
+                        }
+                    ]
                 },
-                "location": {
+                "value": {
+                    "type": "number"
+                }
+            }
+        },
+        "api.ValidationErrorResponse": {
+            "type": "object",
+            "properties": {
+                "error": {
                     "type": "string"
                 },
-                "password": {
+                "fields": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "api.WalletSaveLinkResponse": {
+            "type": "object",
+            "properties": {
+                "url": {
+                    "description": "\"Add to Google Wallet\" link",
                     "type": "string"
                 }
             }
@@ -1903,9 +7074,20 @@ const docTemplate = `{
                         "$ref": "#/definitions/db.BookingItem"
                     }
                 },
+                "confirmation_steps": {
+                    "description": "Completed steps of the confirmation after the payment",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
                 "customer_id": {
                     "$ref": "#/definitions/db.User"
                 },
+                "discount": {
+                    "description": "Discount of the membership and the promo code, in VND",
+                    "type": "integer"
+                },
                 "event_id": {
                     "$ref": "#/definitions/db.Event"
                 },
@@ -1918,8 +7100,28 @@ const docTemplate = `{
                         "$ref": "#/definitions/db.Payment"
                     }
                 },
+                "promo_code_id": {
+                    "description": "The promo code applied to the booking, if any",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/db.PromoCode"
+                        }
+                    ]
+                },
+                "resale_listing_id": {
+                    "description": "The resale listing bought by the booking, if any",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/db.ResaleListing"
+                        }
+                    ]
+                },
                 "status": {
                     "type": "string"
+                },
+                "tickets_pdf": {
+                    "description": "File of the ticket document, once the tickets are issued",
+                    "type": "string"
                 }
             }
         },
@@ -1929,6 +7131,10 @@ const docTemplate = `{
                 "booking_id": {
                     "$ref": "#/definitions/db.Booking"
                 },
+                "checkin_token": {
+                    "description": "Token of the QR, also embedded in the wallet passes",
+                    "type": "string"
+                },
                 "event_schedule_id": {
                     "$ref": "#/definitions/db.EventSchedule"
                 },
@@ -1941,6 +7147,14 @@ const docTemplate = `{
                 "qr": {
                     "type": "string"
                 },
+                "refund_id": {
+                    "description": "The refund of the item, if it was refunded",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/db.Refund"
+                        }
+                    ]
+                },
                 "seat_id": {
                     "$ref": "#/definitions/db.Seat"
                 },
@@ -1993,6 +7207,9 @@ const docTemplate = `{
                 "creator_id": {
                     "$ref": "#/definitions/db.User"
                 },
+                "date_created": {
+                    "type": "string"
+                },
                 "description": {
                     "type": "string"
                 },
@@ -2005,6 +7222,12 @@ const docTemplate = `{
                 "id": {
                     "type": "string"
                 },
+                "latitude": {
+                    "type": "number"
+                },
+                "longitude": {
+                    "type": "number"
+                },
                 "name": {
                     "type": "string"
                 },
@@ -2040,6 +7263,9 @@ const docTemplate = `{
                 "end_time": {
                     "type": "string"
                 },
+                "event_id": {
+                    "$ref": "#/definitions/db.Event"
+                },
                 "id": {
                     "type": "string"
                 },
@@ -2089,6 +7315,10 @@ const docTemplate = `{
                 "id": {
                     "type": "string"
                 },
+                "items_total": {
+                    "description": "Price of the items paid for, recorded once paid, before they change hands",
+                    "type": "integer"
+                },
                 "payment_gateway": {
                     "type": "string"
                 },
@@ -2109,12 +7339,75 @@ const docTemplate = `{
                 }
             }
         },
+        "db.PromoCode": {
+            "type": "object",
+            "properties": {
+                "category_id": {
+                    "$ref": "#/definitions/db.Category"
+                },
+                "code": {
+                    "description": "Upper case",
+                    "type": "string"
+                },
+                "discount_type": {
+                    "description": "percentage or fixed",
+                    "type": "string"
+                },
+                "end_time": {
+                    "type": "string"
+                },
+                "event_id": {
+                    "$ref": "#/definitions/db.Event"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "max_discount": {
+                    "description": "Cap of a percentage discount, in VND. 0 for no cap",
+                    "type": "integer"
+                },
+                "per_user_limit": {
+                    "description": "Bookings of a customer using the code, 0 for no limit",
+                    "type": "integer"
+                },
+                "stackable_with_membership": {
+                    "type": "boolean"
+                },
+                "start_time": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                },
+                "ticket_rank": {
+                    "type": "string"
+                },
+                "usage_limit": {
+                    "description": "Bookings using the code, 0 for no limit",
+                    "type": "integer"
+                },
+                "value": {
+                    "description": "Percent off, or VND off for a fixed discount",
+                    "type": "number"
+                }
+            }
+        },
         "db.Refund": {
             "type": "object",
             "properties": {
                 "amount": {
                     "type": "integer"
                 },
+                "booking_items": {
+                    "description": "The refunded items",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/db.BookingItem"
+                    }
+                },
+                "date_created": {
+                    "type": "string"
+                },
                 "id": {
                     "type": "string"
                 },
@@ -2129,6 +7422,76 @@ const docTemplate = `{
                 }
             }
         },
+        "db.ResaleListing": {
+            "type": "object",
+            "properties": {
+                "booking_id": {
+                    "description": "Booking of the buyer, paid through the normal payment flow",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/db.Booking"
+                        }
+                    ]
+                },
+                "booking_item_id": {
+                    "$ref": "#/definitions/db.BookingItem"
+                },
+                "buyer_id": {
+                    "$ref": "#/definitions/db.User"
+                },
+                "date_created": {
+                    "type": "string"
+                },
+                "date_sold": {
+                    "type": "string"
+                },
+                "from_booking_id": {
+                    "description": "Booking of the seller the ticket was in",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/db.Booking"
+                        }
+                    ]
+                },
+                "id": {
+                    "type": "string"
+                },
+                "payout": {
+                    "description": "Owed to the seller once sold: the price minus the platform fee",
+                    "type": "integer"
+                },
+                "payout_pending": {
+                    "description": "Part of the payout beyond the refund, left to the platform to pay",
+                    "type": "integer"
+                },
+                "platform_fee": {
+                    "description": "Kept by the platform once sold",
+                    "type": "integer"
+                },
+                "price": {
+                    "description": "Asked price, capped over the original price of the ticket",
+                    "type": "integer"
+                },
+                "refund_id": {
+                    "description": "Refund of the payment of the seller paying out the listing",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/db.Refund"
+                        }
+                    ]
+                },
+                "reserved_until": {
+                    "description": "End of the hold of the buyer on the listing while they pay",
+                    "type": "string"
+                },
+                "seller_id": {
+                    "$ref": "#/definitions/db.User"
+                },
+                "status": {
+                    "type": "string"
+                }
+            }
+        },
         "db.Role": {
             "type": "object",
             "properties": {
@@ -2152,6 +7515,9 @@ const docTemplate = `{
                 "reserved_by": {
                     "$ref": "#/definitions/db.User"
                 },
+                "row": {
+                    "type": "string"
+                },
                 "seat_number": {
                     "type": "string"
                 },
@@ -2160,6 +7526,14 @@ const docTemplate = `{
                 },
                 "status": {
                     "type": "string"
+                },
+                "x": {
+                    "description": "Column on the seat map",
+                    "type": "integer"
+                },
+                "y": {
+                    "description": "Row index on the seat map, from the front",
+                    "type": "integer"
                 }
             }
         },
@@ -2253,6 +7627,48 @@ const docTemplate = `{
                 }
             }
         },
+        "db.TicketTransfer": {
+            "type": "object",
+            "properties": {
+                "booking_item_id": {
+                    "$ref": "#/definitions/db.BookingItem"
+                },
+                "date_accepted": {
+                    "type": "string"
+                },
+                "date_created": {
+                    "type": "string"
+                },
+                "from_booking_id": {
+                    "description": "Booking of the sender the ticket was in",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/db.Booking"
+                        }
+                    ]
+                },
+                "id": {
+                    "type": "string"
+                },
+                "recipient_id": {
+                    "$ref": "#/definitions/db.User"
+                },
+                "sender_id": {
+                    "$ref": "#/definitions/db.User"
+                },
+                "status": {
+                    "type": "string"
+                },
+                "to_booking_id": {
+                    "description": "Booking of the recipient the ticket moved to, once accepted",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/db.Booking"
+                        }
+                    ]
+                }
+            }
+        },
         "db.User": {
             "type": "object",
             "properties": {
@@ -2330,6 +7746,132 @@ const docTemplate = `{
                     "$ref": "#/definitions/db.User"
                 }
             }
+        },
+        "promo.Quote": {
+            "type": "object",
+            "properties": {
+                "applied": {
+                    "description": "Whether the code is used, and counts toward its usage limits",
+                    "type": "boolean"
+                },
+                "member_discount": {
+                    "description": "Discount of the membership",
+                    "type": "integer"
+                },
+                "promo_discount": {
+                    "description": "Discount of the code, 0 if the code is not used",
+                    "type": "integer"
+                },
+                "subtotal": {
+                    "description": "Price of the tickets",
+                    "type": "integer"
+                },
+                "total": {
+                    "description": "Price after the discounts, before the payment fee",
+                    "type": "integer"
+                }
+            }
+        },
+        "seatmap.Layout": {
+            "type": "object",
+            "properties": {
+                "aisles": {
+                    "description": "Seat numbers followed by an aisle",
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                },
+                "rows": {
+                    "description": "Row labels: ranges and single labels separated by commas, like \"A-H,J-K\"",
+                    "type": "string"
+                },
+                "seats_per_row": {
+                    "description": "Seats are numbered from 1 to SeatsPerRow in each row",
+                    "type": "integer"
+                },
+                "skip": {
+                    "description": "Skipped seats: a number (\"13\") in every row, or a seat number (\"A13\")",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "seatmap.Seat": {
+            "type": "object",
+            "properties": {
+                "row": {
+                    "type": "string"
+                },
+                "seat_number": {
+                    "type": "string"
+                },
+                "x": {
+                    "type": "integer"
+                },
+                "y": {
+                    "type": "integer"
+                }
+            }
+        },
+        "worker.EventCancellation": {
+            "type": "object",
+            "properties": {
+                "event_id": {
+                    "type": "string"
+                },
+                "failed_payments": {
+                    "description": "Payments whose refund failed after every retry",
+                    "type": "integer"
+                },
+                "failures": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/worker.EventCancellationFailure"
+                    }
+                },
+                "finished_at": {
+                    "type": "string"
+                },
+                "paid_amount": {
+                    "description": "Total of the successful payments",
+                    "type": "integer"
+                },
+                "reason": {
+                    "type": "string"
+                },
+                "refunded_amount": {
+                    "description": "Refunded by the cancellation",
+                    "type": "integer"
+                },
+                "refunded_payments": {
+                    "description": "Payments refunded, or with nothing left to refund",
+                    "type": "integer"
+                },
+                "started_at": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                },
+                "total_payments": {
+                    "description": "Successful payments of the event",
+                    "type": "integer"
+                }
+            }
+        },
+        "worker.EventCancellationFailure": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "type": "string"
+                },
+                "payment_id": {
+                    "type": "string"
+                }
+            }
         }
     },
     "securityDefinitions": {
@@ -0,0 +1,190 @@
+package calendar
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"tekticket/db"
+	"time"
+	"unicode/utf8"
+)
+
+/*
+ * iCalendar (RFC 5545) export of event schedules. Every schedule is a VEVENT with a UID derived from the schedule ID, so
+ * that a calendar importing or subscribing to the export again updates the event instead of duplicating it. The check-in
+ * window is announced by a VALARM when check-in opens.
+ */
+
+const (
+	PRODUCT_ID   = "-//Tekticket//Tekticket API//EN"
+	CONTENT_TYPE = "text/calendar; charset=utf-8"
+	MAX_LINE     = 75 // Maximum length of a content line in octets, without the CRLF
+)
+
+// UTC date-time format of iCalendar
+const DATETIME_FORMAT = "20060102T150405Z"
+
+// Calendar to export
+type Calendar struct {
+	Name   string // Display name of the calendar, for subscriptions
+	Events []Event
+}
+
+// VEVENT of a calendar
+type Event struct {
+	UID         string
+	Summary     string
+	Description string
+	Location    string
+	Latitude    *float64
+	Longitude   *float64
+	Start       time.Time
+	End         *time.Time
+	Alarms      []Alarm
+}
+
+// VALARM of an event, displayed at an absolute time
+type Alarm struct {
+	Trigger     time.Time
+	Description string
+}
+
+// Build the VEVENTs of the schedules of an event. The UIDs are scoped by domain, the host of the server. Schedules without
+// a start time are skipped
+func Events(event db.Event, domain string) []Event {
+	location := make([]string, 0, 3)
+	for _, part := range []string{event.Address, event.City, event.Country} {
+		if part = strings.TrimSpace(part); part != "" {
+			location = append(location, part)
+		}
+	}
+
+	events := make([]Event, 0, len(event.EventSchedules))
+	for _, schedule := range event.EventSchedules {
+		if schedule.StartTime == nil {
+			continue
+		}
+
+		calendarEvent := Event{
+			UID:       fmt.Sprintf("schedule-%s@%s", schedule.ID, domain),
+			Summary:   event.Name,
+			Location:  strings.Join(location, ", "),
+			Latitude:  event.Latitude,
+			Longitude: event.Longitude,
+			Start:     time.Time(*schedule.StartTime),
+		}
+		if schedule.EndTime != nil {
+			end := time.Time(*schedule.EndTime)
+			calendarEvent.End = &end
+		}
+
+		// Check-in window
+		if schedule.StartCheckinTime != nil {
+			checkin := fmt.Sprintf("Check-in opens at %s", formatTime(time.Time(*schedule.StartCheckinTime)))
+			if schedule.EndCheckinTime != nil {
+				checkin += fmt.Sprintf(" and closes at %s", formatTime(time.Time(*schedule.EndCheckinTime)))
+			}
+			calendarEvent.Description = checkin
+			calendarEvent.Alarms = append(calendarEvent.Alarms, Alarm{
+				Trigger:     time.Time(*schedule.StartCheckinTime),
+				Description: fmt.Sprintf("Check-in for %s is open", event.Name),
+			})
+		}
+
+		events = append(events, calendarEvent)
+	}
+	return events
+}
+
+// Encode the calendar as an iCalendar object. Now is the DTSTAMP of the events
+func (calendar Calendar) Encode(now time.Time) []byte {
+	var sb strings.Builder
+	writeLine(&sb, "BEGIN", "VCALENDAR")
+	writeLine(&sb, "VERSION", "2.0")
+	writeLine(&sb, "PRODID", PRODUCT_ID)
+	writeLine(&sb, "CALSCALE", "GREGORIAN")
+	writeLine(&sb, "METHOD", "PUBLISH")
+	if calendar.Name != "" {
+		writeLine(&sb, "X-WR-CALNAME", escape(calendar.Name))
+	}
+
+	for _, event := range calendar.Events {
+		writeLine(&sb, "BEGIN", "VEVENT")
+		writeLine(&sb, "UID", event.UID)
+		writeLine(&sb, "DTSTAMP", formatDateTime(now))
+		writeLine(&sb, "DTSTART", formatDateTime(event.Start))
+		if event.End != nil {
+			writeLine(&sb, "DTEND", formatDateTime(*event.End))
+		}
+		writeLine(&sb, "SUMMARY", escape(event.Summary))
+		if event.Description != "" {
+			writeLine(&sb, "DESCRIPTION", escape(event.Description))
+		}
+		if event.Location != "" {
+			writeLine(&sb, "LOCATION", escape(event.Location))
+		}
+		if event.Latitude != nil && event.Longitude != nil {
+			writeLine(&sb, "GEO", fmt.Sprintf("%f;%f", *event.Latitude, *event.Longitude))
+		}
+		for _, alarm := range event.Alarms {
+			writeLine(&sb, "BEGIN", "VALARM")
+			writeLine(&sb, "ACTION", "DISPLAY")
+			writeLine(&sb, "TRIGGER;VALUE=DATE-TIME", formatDateTime(alarm.Trigger))
+			writeLine(&sb, "DESCRIPTION", escape(alarm.Description))
+			writeLine(&sb, "END", "VALARM")
+		}
+		writeLine(&sb, "END", "VEVENT")
+	}
+
+	writeLine(&sb, "END", "VCALENDAR")
+	return []byte(sb.String())
+}
+
+// Generate the secret token of a calendar feed
+func NewFeedToken() string {
+	return rand.Text()
+}
+
+// Hash the token of a calendar feed, so that it can be stored and looked up without keeping the plain token
+func HashFeedToken(token, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(token))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Helper function: format a time in UTC
+func formatDateTime(t time.Time) string {
+	return t.UTC().Format(DATETIME_FORMAT)
+}
+
+// Helper function: format a time for humans, in the description
+func formatTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02 15:04 UTC")
+}
+
+// Helper function: escape a TEXT value
+func escape(text string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`).Replace(text)
+}
+
+// Helper function: write a content line, folded to MAX_LINE octets without splitting a UTF-8 character. The continuation
+// lines start with a space, which counts in their length
+func writeLine(sb *strings.Builder, name, value string) {
+	line := name + ":" + value
+	limit := MAX_LINE
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		sb.WriteString(line[:cut])
+		sb.WriteString("\r\n ")
+		line = line[cut:]
+		limit = MAX_LINE - 1
+	}
+	sb.WriteString(line)
+	sb.WriteString("\r\n")
+}
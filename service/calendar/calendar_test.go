@@ -0,0 +1,89 @@
+package calendar
+
+import (
+	"strings"
+	"tekticket/db"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Helper function: build a datetime
+func at(t time.Time) *db.DateTime {
+	dt := db.DateTime(t)
+	return &dt
+}
+
+// Test: build the VEVENTs of the schedules of an event
+func TestEvents(t *testing.T) {
+	start := time.Date(2025, 12, 31, 20, 0, 0, 0, time.UTC)
+	lat, lon := 21.0285, 105.8542
+	event := db.Event{
+		Name:      "Countdown",
+		Address:   "1 Trang Tien",
+		City:      "Hanoi",
+		Latitude:  &lat,
+		Longitude: &lon,
+		EventSchedules: []db.EventSchedule{
+			{
+				ID:               "s1",
+				StartTime:        at(start),
+				EndTime:          at(start.Add(4 * time.Hour)),
+				StartCheckinTime: at(start.Add(-time.Hour)),
+				EndCheckinTime:   at(start.Add(time.Hour)),
+			},
+			{ID: "s2", StartTime: at(start.Add(24 * time.Hour))},
+			{ID: "s3"},
+		},
+	}
+
+	events := Events(event, "api.tekticket.com")
+	require.Len(t, events, 2)
+	require.Equal(t, "schedule-s1@api.tekticket.com", events[0].UID)
+	require.Equal(t, "1 Trang Tien, Hanoi", events[0].Location)
+	require.Equal(t, start.Add(4*time.Hour), *events[0].End)
+	require.Len(t, events[0].Alarms, 1)
+	require.Equal(t, start.Add(-time.Hour), events[0].Alarms[0].Trigger)
+	require.Contains(t, events[0].Description, "closes at 2025-12-31 21:00 UTC")
+
+	require.Nil(t, events[1].End)
+	require.Empty(t, events[1].Alarms)
+}
+
+// Test: encode a calendar, with escaped text and folded lines
+func TestEncode(t *testing.T) {
+	start := time.Date(2025, 12, 31, 20, 0, 0, 0, time.FixedZone("ICT", 7*3600))
+	calendar := Calendar{
+		Name: "My bookings",
+		Events: []Event{{
+			UID:         "schedule-s1@api.tekticket.com",
+			Summary:     "Rock, jazz; and blues",
+			Description: strings.Repeat("Đêm nhạc ", 20),
+			Start:       start,
+			Alarms:      []Alarm{{Trigger: start.Add(-time.Hour), Description: "Check-in is open"}},
+		}},
+	}
+	data := string(calendar.Encode(start))
+
+	require.True(t, strings.HasPrefix(data, "BEGIN:VCALENDAR\r\nVERSION:2.0\r\n"))
+	require.True(t, strings.HasSuffix(data, "END:VCALENDAR\r\n"))
+	require.Contains(t, data, "DTSTART:20251231T130000Z\r\n")
+	require.Contains(t, data, "TRIGGER;VALUE=DATE-TIME:20251231T120000Z\r\n")
+	require.Contains(t, data, `SUMMARY:Rock\, jazz\; and blues`)
+	require.NotContains(t, data, "DTEND")
+
+	// Every line is at most 75 octets, and unfolding restores the text
+	for line := range strings.SplitSeq(strings.TrimSuffix(data, "\r\n"), "\r\n") {
+		require.LessOrEqual(t, len(line), MAX_LINE)
+	}
+	require.Contains(t, strings.ReplaceAll(data, "\r\n ", ""), "DESCRIPTION:"+strings.Repeat("Đêm nhạc ", 20))
+}
+
+// Test: feed tokens are random, and hashed with the secret
+func TestFeedToken(t *testing.T) {
+	token := NewFeedToken()
+	require.NotEqual(t, token, NewFeedToken())
+	require.Equal(t, HashFeedToken(token, "secret"), HashFeedToken(token, "secret"))
+	require.NotEqual(t, HashFeedToken(token, "secret"), HashFeedToken(token, "other"))
+}
@@ -0,0 +1,236 @@
+package mfa
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"tekticket/util"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+/*
+ * Two-factor authentication manager. The TOTP secret and the hashed recovery codes live in the user_mfa collection in
+ * Directus, this manager only keeps the short-lived state in Redis:
+ * - mfa:challenge:{id}          : encrypted tokens of a login waiting for the second factor
+ * - mfa:challenge:{id}:attempts : number of failed attempts on the challenge
+ * - mfa:used:{userID}:{step}    : TOTP time step already used by the user, to reject replayed codes
+ * - mfa:recovery:{userID}:lock  : set while a recovery code of the user is used, so that codes are used one at a time
+ * - mfa:{scope}:{userID}:attempts : number of failed codes of a user, counted by scope (check-in, profile, deletion)
+ * - mfa:checkin:{userID}:{step}   : check-in device that used a TOTP time step of a staff
+ */
+
+const (
+	CHALLENGE_TTL          = 5 * time.Minute
+	MAX_CHALLENGE_ATTEMPTS = 5
+	MAX_USER_ATTEMPTS      = 5 // Failed codes of a user in a scope before they are blocked for CHALLENGE_TTL
+	RECOVERY_LOCK_TTL      = 30 * time.Second
+)
+
+// Scopes of the failed codes of a user, counted apart
+const (
+	SCOPE_CHECKIN = "checkin" // Codes of a staff scanning tickets
+	SCOPE_PROFILE = "profile" // Codes of a user managing their two-factor authentication
+	SCOPE_DELETE  = "delete"  // Passwords of a user confirming the deletion of their account
+)
+
+var (
+	ErrChallengeNotFound = errors.New("MFA challenge not found or expired")
+	ErrTooManyAttempts   = errors.New("too many failed MFA attempts")
+)
+
+// Login waiting for the second factor. The tokens are issued by Directus after the password check, but are only given to the
+// user once the second factor is verified
+type Challenge struct {
+	UserID       string `json:"user_id"`
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	Expires      int    `json:"expires"`
+}
+
+// MFA manager
+type Manager struct {
+	client *redis.Client
+	secret []byte
+}
+
+// Constructor method for MFA manager
+func NewManager(client *redis.Client, secret string) *Manager {
+	return &Manager{client: client, secret: []byte(secret)}
+}
+
+// Hash a recovery code, so that it can be stored and compared without keeping the plain code
+func (manager *Manager) HashRecoveryCode(code string) string {
+	mac := hmac.New(sha256.New, manager.secret)
+	mac.Write([]byte(NormalizeRecoveryCode(code)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Mark a TOTP time step as used by the user. Return false if it has already been used, meaning the code is replayed
+func (manager *Manager) UseStep(ctx context.Context, userID string, step int64) (bool, error) {
+	// The step stays acceptable for TOTP_SKEW periods after it ends, so it has to be remembered at least that long
+	ttl := TOTP_PERIOD * time.Duration(2*TOTP_SKEW+1)
+	return manager.client.SetNX(ctx, fmt.Sprintf("mfa:used:%s:%d", userID, step), 1, ttl).Result()
+}
+
+// Lock the recovery codes of a user while one of them is used, so that a code can't be used twice by concurrent requests and
+// an update of the codes can't restore a used one. Return false if they are already locked
+func (manager *Manager) LockRecoveryCodes(ctx context.Context, userID string) (bool, error) {
+	return manager.client.SetNX(ctx, fmt.Sprintf("mfa:recovery:%s:lock", userID), 1, RECOVERY_LOCK_TTL).Result()
+}
+
+// Unlock the recovery codes of a user
+func (manager *Manager) UnlockRecoveryCodes(ctx context.Context, userID string) error {
+	return manager.client.Del(ctx, fmt.Sprintf("mfa:recovery:%s:lock", userID)).Err()
+}
+
+// Mark a TOTP time step as used by a staff on a check-in device. A staff scans many tickets within a time step, so the
+// device that used the step first can reuse it, but not another device. Return false if another device used it
+func (manager *Manager) UseCheckinStep(ctx context.Context, userID, device string, step int64) (bool, error) {
+	key := fmt.Sprintf("mfa:checkin:%s:%d", userID, step)
+	ttl := TOTP_PERIOD * time.Duration(2*TOTP_SKEW+1)
+	set, err := manager.client.SetNX(ctx, key, device, ttl).Result()
+	if err != nil || set {
+		return set, err
+	}
+
+	used, err := manager.client.Get(ctx, key).Result()
+	if err == redis.Nil {
+		return false, nil
+	}
+	return used == device, err
+}
+
+// Whether a user failed too many codes in a scope recently
+func (manager *Manager) Blocked(ctx context.Context, scope, userID string) (bool, error) {
+	attempts, err := manager.client.Get(ctx, fmt.Sprintf("mfa:%s:%s:attempts", scope, userID)).Int()
+	if err == redis.Nil {
+		return false, nil
+	}
+	return attempts >= MAX_USER_ATTEMPTS, err
+}
+
+// Record a failed code of a user in a scope. Once MAX_USER_ATTEMPTS is reached, ErrTooManyAttempts is returned, and the
+// user is blocked in the scope until the attempts expire
+func (manager *Manager) RecordUserFailure(ctx context.Context, scope, userID string) error {
+	key := fmt.Sprintf("mfa:%s:%s:attempts", scope, userID)
+
+	pipe := manager.client.TxPipeline()
+	incr := pipe.Incr(ctx, key)
+	pipe.Expire(ctx, key, CHALLENGE_TTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+
+	if incr.Val() >= MAX_USER_ATTEMPTS {
+		return ErrTooManyAttempts
+	}
+	return nil
+}
+
+// Store a challenge, return its ID
+func (manager *Manager) CreateChallenge(ctx context.Context, challenge Challenge) (string, error) {
+	data, err := json.Marshal(challenge)
+	if err != nil {
+		return "", err
+	}
+
+	encrypted, err := util.Encrypt(manager.secret, data)
+	if err != nil {
+		return "", err
+	}
+
+	id := uuid.New().String()
+	if err := manager.client.Set(ctx, fmt.Sprintf("mfa:challenge:%s", id), util.Encode(string(encrypted)), CHALLENGE_TTL).Err(); err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+// Get a challenge by its ID
+func (manager *Manager) GetChallenge(ctx context.Context, id string) (*Challenge, error) {
+	encoded, err := manager.client.Get(ctx, fmt.Sprintf("mfa:challenge:%s", id)).Result()
+	if err == redis.Nil {
+		return nil, ErrChallengeNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return manager.decodeChallenge(encoded)
+}
+
+// Claim a challenge once its second factor is verified: get and delete it at once, so that concurrent requests can't
+// complete the same challenge twice. Return ErrChallengeNotFound if it was claimed or dropped in between
+func (manager *Manager) ClaimChallenge(ctx context.Context, id string) (*Challenge, error) {
+	pipe := manager.client.TxPipeline()
+	get := pipe.GetDel(ctx, fmt.Sprintf("mfa:challenge:%s", id))
+	pipe.Del(ctx, fmt.Sprintf("mfa:challenge:%s:attempts", id))
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	encoded, err := get.Result()
+	if err == redis.Nil {
+		return nil, ErrChallengeNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return manager.decodeChallenge(encoded)
+}
+
+// Helper method: decrypt a stored challenge
+func (manager *Manager) decodeChallenge(encoded string) (*Challenge, error) {
+	decoded, err := util.Decode(encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := util.Decrypt(manager.secret, []byte(decoded))
+	if err != nil {
+		return nil, err
+	}
+
+	var challenge Challenge
+	if err := json.Unmarshal(data, &challenge); err != nil {
+		return nil, err
+	}
+
+	return &challenge, nil
+}
+
+// Record a failed attempt on a challenge. Once MAX_CHALLENGE_ATTEMPTS is reached, the challenge is deleted and
+// ErrTooManyAttempts is returned, the user has to log in again
+func (manager *Manager) RecordFailure(ctx context.Context, id string) error {
+	key := fmt.Sprintf("mfa:challenge:%s:attempts", id)
+
+	pipe := manager.client.TxPipeline()
+	incr := pipe.Incr(ctx, key)
+	pipe.Expire(ctx, key, CHALLENGE_TTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+
+	if incr.Val() >= MAX_CHALLENGE_ATTEMPTS {
+		if err := manager.DeleteChallenge(ctx, id); err != nil {
+			return err
+		}
+		return ErrTooManyAttempts
+	}
+
+	return nil
+}
+
+// Delete a challenge, once it is completed or abandoned
+func (manager *Manager) DeleteChallenge(ctx context.Context, id string) error {
+	return manager.client.Del(ctx, fmt.Sprintf("mfa:challenge:%s", id), fmt.Sprintf("mfa:challenge:%s:attempts", id)).Err()
+}
@@ -0,0 +1,211 @@
+package mfa
+
+import (
+	"context"
+	"encoding/base32"
+	"net/url"
+	"os"
+	"strings"
+	"tekticket/util"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	ctx     = context.Background()
+	manager *Manager
+)
+
+func TestMain(m *testing.M) {
+	// The integration tests need a running Redis, so they are skipped in CI environment, or when Redis is not reachable.
+	// The other tests always run
+	if strings.TrimSpace(os.Getenv("CI")) == "" {
+		client := redis.NewClient(&redis.Options{Addr: os.Getenv("REDIS_ADDR")})
+		if err := client.Ping(ctx).Err(); err != nil {
+			util.LOGGER.Warn("failed to connect to Redis for testing, skip integration tests", "error", err)
+		} else {
+			manager = NewManager(client, util.RandomString(32))
+		}
+	}
+
+	os.Exit(m.Run())
+}
+
+// Helper: skip an integration test when Redis is not available
+func requireRedis(t *testing.T) {
+	if manager == nil {
+		t.Skip("Redis is not available")
+	}
+}
+
+// Test: generated codes match the SHA-1 test vectors of RFC 6238 (truncated to 6 digits)
+func TestGenerateCode(t *testing.T) {
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+	testCases := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tc := range testCases {
+		code, err := GenerateCode(secret, time.Unix(tc.unix, 0))
+		require.NoError(t, err)
+		require.Equal(t, tc.code, code)
+	}
+}
+
+// Test: codes are accepted within the allowed clock drift only
+func TestValidateCode(t *testing.T) {
+	secret, err := GenerateSecret()
+	require.NoError(t, err)
+
+	now := time.Now()
+	code, err := GenerateCode(secret, now)
+	require.NoError(t, err)
+
+	step, ok := ValidateCode(secret, code, now)
+	require.True(t, ok)
+	require.Equal(t, TimeStep(now), step)
+
+	_, ok = ValidateCode(secret, code, now.Add(TOTP_PERIOD))
+	require.True(t, ok)
+
+	_, ok = ValidateCode(secret, code, now.Add(time.Duration(TOTP_SKEW+1)*TOTP_PERIOD))
+	require.False(t, ok)
+
+	_, ok = ValidateCode(secret, "12345", now)
+	require.False(t, ok)
+}
+
+// Test: provisioning URI contains every parameter needed by authenticator apps
+func TestProvisioningURI(t *testing.T) {
+	uri := ProvisioningURI("Tekticket", "staff@example.com", "JBSWY3DPEHPK3PXP")
+
+	parsed, err := url.Parse(uri)
+	require.NoError(t, err)
+	require.Equal(t, "otpauth", parsed.Scheme)
+	require.Equal(t, "totp", parsed.Host)
+	require.Equal(t, "/Tekticket:staff@example.com", parsed.Path)
+	require.Equal(t, "JBSWY3DPEHPK3PXP", parsed.Query().Get("secret"))
+	require.Equal(t, "Tekticket", parsed.Query().Get("issuer"))
+}
+
+// Test: recovery codes are unique, and their hash ignores formatting
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes()
+	require.NoError(t, err)
+	require.Len(t, codes, RECOVERY_CODE_COUNT)
+
+	seen := map[string]bool{}
+	for _, code := range codes {
+		require.Len(t, code, 11)
+		require.False(t, seen[code])
+		seen[code] = true
+	}
+
+	manager := NewManager(nil, util.RandomString(32))
+	require.Equal(t, manager.HashRecoveryCode(codes[0]), manager.HashRecoveryCode(" "+strings.ToUpper(codes[0])+" "))
+	require.NotEqual(t, manager.HashRecoveryCode(codes[0]), manager.HashRecoveryCode(codes[1]))
+}
+
+// Test: a TOTP time step can only be used once by the same user
+func TestUseStep(t *testing.T) {
+	requireRedis(t)
+
+	userID := uuid.New().String()
+	step := TimeStep(time.Now())
+
+	ok, err := manager.UseStep(ctx, userID, step)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	ok, err = manager.UseStep(ctx, userID, step)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	ok, err = manager.UseStep(ctx, uuid.New().String(), step)
+	require.NoError(t, err)
+	require.True(t, ok)
+}
+
+// Test: the recovery codes of a user are locked by one request at a time
+func TestLockRecoveryCodes(t *testing.T) {
+	requireRedis(t)
+
+	userID := uuid.New().String()
+
+	ok, err := manager.LockRecoveryCodes(ctx, userID)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	ok, err = manager.LockRecoveryCodes(ctx, userID)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	require.NoError(t, manager.UnlockRecoveryCodes(ctx, userID))
+	ok, err = manager.LockRecoveryCodes(ctx, userID)
+	require.NoError(t, err)
+	require.True(t, ok)
+}
+
+// Test: challenge round trip, and deletion after too many failed attempts
+func TestChallenge(t *testing.T) {
+	requireRedis(t)
+
+	challenge := Challenge{
+		UserID:       uuid.New().String(),
+		AccessToken:  util.RandomString(64),
+		RefreshToken: util.RandomString(64),
+		Expires:      900000,
+	}
+
+	id, err := manager.CreateChallenge(ctx, challenge)
+	require.NoError(t, err)
+
+	stored, err := manager.GetChallenge(ctx, id)
+	require.NoError(t, err)
+	require.Equal(t, challenge, *stored)
+
+	for range MAX_CHALLENGE_ATTEMPTS - 1 {
+		require.NoError(t, manager.RecordFailure(ctx, id))
+	}
+	require.ErrorIs(t, manager.RecordFailure(ctx, id), ErrTooManyAttempts)
+
+	_, err = manager.GetChallenge(ctx, id)
+	require.ErrorIs(t, err, ErrChallengeNotFound)
+}
+
+// Test: a challenge can only be claimed once
+func TestClaimChallenge(t *testing.T) {
+	requireRedis(t)
+
+	challenge := Challenge{
+		UserID:       uuid.New().String(),
+		AccessToken:  util.RandomString(64),
+		RefreshToken: util.RandomString(64),
+		Expires:      900000,
+	}
+
+	id, err := manager.CreateChallenge(ctx, challenge)
+	require.NoError(t, err)
+
+	claimed, err := manager.ClaimChallenge(ctx, id)
+	require.NoError(t, err)
+	require.Equal(t, challenge, *claimed)
+
+	_, err = manager.ClaimChallenge(ctx, id)
+	require.ErrorIs(t, err, ErrChallengeNotFound)
+	_, err = manager.GetChallenge(ctx, id)
+	require.ErrorIs(t, err, ErrChallengeNotFound)
+}
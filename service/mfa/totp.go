@@ -0,0 +1,147 @@
+package mfa
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+/*
+ * Time-based one-time password (RFC 6238), compatible with Google Authenticator, Authy, 1Password...
+ * Only the default parameters are supported: HMAC-SHA1, 6 digits and 30 seconds period.
+ */
+
+const (
+	TOTP_PERIOD         = 30 * time.Second
+	TOTP_DIGITS         = 6
+	TOTP_SKEW           = 1  // Number of periods before and after the current one that are still accepted (clock drift)
+	SECRET_SIZE         = 20 // 160 bits, as recommended by RFC 4226
+	RECOVERY_CODE_COUNT = 10
+)
+
+var base32NoPadding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// Generate a random TOTP secret, encoded in base32 (without padding) as expected by authenticator apps
+func GenerateSecret() (string, error) {
+	secret := make([]byte, SECRET_SIZE)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return base32NoPadding.EncodeToString(secret), nil
+}
+
+// Helper: decode a base32 secret, ignoring case, spaces and padding
+func decodeSecret(secret string) ([]byte, error) {
+	secret = strings.ToUpper(strings.ReplaceAll(secret, " ", ""))
+	return base32NoPadding.DecodeString(strings.TrimRight(secret, "="))
+}
+
+// Helper: compute the HOTP value (RFC 4226) of a counter
+func hotp(key []byte, counter uint64) string {
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, counter)
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+
+	// Dynamic truncation
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for range TOTP_DIGITS {
+		mod *= 10
+	}
+
+	return fmt.Sprintf("%0*d", TOTP_DIGITS, value%mod)
+}
+
+// Get the time step of a time
+func TimeStep(t time.Time) int64 {
+	return t.Unix() / int64(TOTP_PERIOD/time.Second)
+}
+
+// Generate the code of a secret at a given time
+func GenerateCode(secret string, t time.Time) (string, error) {
+	key, err := decodeSecret(secret)
+	if err != nil {
+		return "", err
+	}
+	return hotp(key, uint64(TimeStep(t))), nil
+}
+
+// Validate a code at a given time, allowing TOTP_SKEW periods of clock drift.
+// Return the time step that matched, so that the caller can reject a replay of the same code
+func ValidateCode(secret, code string, t time.Time) (int64, bool) {
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	if len(code) != TOTP_DIGITS {
+		return 0, false
+	}
+
+	key, err := decodeSecret(secret)
+	if err != nil {
+		return 0, false
+	}
+
+	current := TimeStep(t)
+	for delta := int64(-TOTP_SKEW); delta <= TOTP_SKEW; delta++ {
+		step := current + delta
+		if subtle.ConstantTimeCompare([]byte(hotp(key, uint64(step))), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+
+	return 0, false
+}
+
+// Build the otpauth:// URI of a secret, which authenticator apps read from a QR code.
+// See https://github.com/google/google-authenticator/wiki/Key-Uri-Format
+func ProvisioningURI(issuer, account, secret string) string {
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", issuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprintf("%d", TOTP_DIGITS))
+	params.Set("period", fmt.Sprintf("%d", int(TOTP_PERIOD/time.Second)))
+
+	label := url.PathEscape(issuer) + ":" + url.PathEscape(account)
+	return fmt.Sprintf("otpauth://totp/%s?%s", label, params.Encode())
+}
+
+// Generate a set of single-use recovery codes, formatted as xxxxx-xxxxx
+func GenerateRecoveryCodes() ([]string, error) {
+	const charset = "abcdefghjkmnpqrstuvwxyz23456789" // Without look-alike characters
+	codes := make([]string, 0, RECOVERY_CODE_COUNT)
+
+	for range RECOVERY_CODE_COUNT {
+		raw := make([]byte, 10)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, err
+		}
+
+		var sb strings.Builder
+		for i, b := range raw {
+			if i == 5 {
+				sb.WriteByte('-')
+			}
+			sb.WriteByte(charset[int(b)%len(charset)])
+		}
+		codes = append(codes, sb.String())
+	}
+
+	return codes, nil
+}
+
+// Normalize a recovery code entered by the user before hashing it
+func NormalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.ReplaceAll(strings.ReplaceAll(code, " ", ""), "-", "")
+}
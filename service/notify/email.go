@@ -1,14 +1,26 @@
 package notify
 
 import (
+	"encoding/base64"
 	"fmt"
+	"mime"
+	"mime/multipart"
 	"net/smtp"
+	"net/textproto"
 	"strings"
 )
 
 // Universal interface for mail service
 type MailService interface {
 	SendEmail(to, subject, body string) error
+	SendEmailWithAttachments(to, subject, body string, attachments ...Attachment) error
+}
+
+// File attached to an email
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
 }
 
 // Email service struct, which holds configurations related to email sending
@@ -34,13 +46,48 @@ func NewEmailService(email, password string) *EmailService {
 
 // Method to send email
 func (service *EmailService) SendEmail(to, subject, body string) error {
+	return service.SendEmailWithAttachments(to, subject, body)
+}
+
+// Method to send email with attached files. The HTML body and the files are sent as a multipart/mixed message
+func (service *EmailService) SendEmailWithAttachments(to, subject, body string, attachments ...Attachment) error {
 	// Set email headers with MIME version and content type
 	headers := make(map[string]string)
 	headers["From"] = service.Email
 	headers["To"] = to
 	headers["Subject"] = subject
 	headers["MIME-Version"] = "1.0"
-	headers["Content-Type"] = "text/html; charset=UTF-8"
+
+	var content strings.Builder
+	if len(attachments) == 0 {
+		headers["Content-Type"] = "text/html; charset=UTF-8"
+		content.WriteString(body)
+	} else {
+		writer := multipart.NewWriter(&content)
+		headers["Content-Type"] = fmt.Sprintf("multipart/mixed; boundary=%s", writer.Boundary())
+
+		part, err := writer.CreatePart(textproto.MIMEHeader{"Content-Type": {"text/html; charset=UTF-8"}})
+		if err != nil {
+			return err
+		}
+		part.Write([]byte(body))
+
+		for _, attachment := range attachments {
+			part, err := writer.CreatePart(textproto.MIMEHeader{
+				"Content-Type":              {attachment.ContentType},
+				"Content-Transfer-Encoding": {"base64"},
+				"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Filename})},
+			})
+			if err != nil {
+				return err
+			}
+			part.Write([]byte(encodeBase64Lines(attachment.Data)))
+		}
+
+		if err := writer.Close(); err != nil {
+			return err
+		}
+	}
 
 	// Build the message with headers
 	var message strings.Builder
@@ -48,7 +95,7 @@ func (service *EmailService) SendEmail(to, subject, body string) error {
 		message.WriteString(fmt.Sprintf("%s: %s\r\n", key, value))
 	}
 	message.WriteString("\r\n")
-	message.WriteString(body)
+	message.WriteString(content.String())
 
 	addr := fmt.Sprintf("%s:%s", service.Host, service.Port)
 	return smtp.SendMail(
@@ -59,3 +106,17 @@ func (service *EmailService) SendEmail(to, subject, body string) error {
 		[]byte(message.String()),
 	)
 }
+
+// Helper function: encode data in base64, in lines of 76 characters as required by MIME
+func encodeBase64Lines(data []byte) string {
+	encoded := base64.StdEncoding.EncodeToString(data)
+
+	var sb strings.Builder
+	for len(encoded) > 76 {
+		sb.WriteString(encoded[:76])
+		sb.WriteString("\r\n")
+		encoded = encoded[76:]
+	}
+	sb.WriteString(encoded)
+	return sb.String()
+}
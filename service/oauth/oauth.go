@@ -0,0 +1,133 @@
+package oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+/*
+ * Social login manager: keep the configured providers, and the state of each login in progress.
+ * - oauth:state:{state} : provider name, nonce and PKCE code verifier of a login, deleted as soon as the callback uses it
+ */
+
+const STATE_TTL = 10 * time.Minute
+
+var (
+	ErrUnknownProvider = errors.New("unknown OAuth provider")
+	ErrInvalidState    = errors.New("invalid or expired OAuth state")
+)
+
+// Login in progress
+type authState struct {
+	Provider     string `json:"provider"`
+	Nonce        string `json:"nonce"`
+	CodeVerifier string `json:"code_verifier"`
+}
+
+// Social login manager
+type Manager struct {
+	client    *redis.Client
+	providers map[string]*Provider
+}
+
+// Constructor method for social login manager
+func NewManager(client *redis.Client, providers ...*Provider) *Manager {
+	manager := &Manager{client: client, providers: map[string]*Provider{}}
+	for _, provider := range providers {
+		manager.providers[provider.Name()] = provider
+	}
+	return manager
+}
+
+// Helper: generate a random URL-safe string
+func randomToken() (string, error) {
+	data := make([]byte, 32)
+	if _, err := rand.Read(data); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// Build the PKCE code challenge (S256) of a code verifier
+func CodeChallenge(codeVerifier string) string {
+	sum := sha256.Sum256([]byte(codeVerifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// Start a login with a provider: store a new state, nonce and code verifier, and return the URL to redirect the user to
+func (manager *Manager) AuthorizationURL(ctx context.Context, providerName string) (string, error) {
+	provider, ok := manager.providers[providerName]
+	if !ok {
+		return "", ErrUnknownProvider
+	}
+
+	state, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	nonce, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	codeVerifier, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+
+	authURL, err := provider.AuthCodeURL(ctx, state, nonce, CodeChallenge(codeVerifier))
+	if err != nil {
+		return "", err
+	}
+
+	data, err := json.Marshal(authState{Provider: providerName, Nonce: nonce, CodeVerifier: codeVerifier})
+	if err != nil {
+		return "", err
+	}
+	if err := manager.client.Set(ctx, fmt.Sprintf("oauth:state:%s", state), data, STATE_TTL).Err(); err != nil {
+		return "", err
+	}
+
+	return authURL, nil
+}
+
+// Complete a login: consume the state, exchange the code and verify the ID token. Return the provider name and the claims
+func (manager *Manager) Complete(ctx context.Context, state, code string) (string, *Claims, error) {
+	// A state can only be used once
+	data, err := manager.client.GetDel(ctx, fmt.Sprintf("oauth:state:%s", state)).Bytes()
+	if err == redis.Nil {
+		return "", nil, ErrInvalidState
+	}
+	if err != nil {
+		return "", nil, err
+	}
+
+	var saved authState
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return "", nil, err
+	}
+
+	provider, ok := manager.providers[saved.Provider]
+	if !ok {
+		return "", nil, ErrUnknownProvider
+	}
+
+	idToken, err := provider.Exchange(ctx, code, saved.CodeVerifier)
+	if err != nil {
+		return "", nil, err
+	}
+
+	claims, err := provider.VerifyIDToken(ctx, idToken, saved.Nonce)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return saved.Provider, claims, nil
+}
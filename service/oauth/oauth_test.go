@@ -0,0 +1,271 @@
+package oauth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"tekticket/util"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	ctx    = context.Background()
+	client *redis.Client
+)
+
+func TestMain(m *testing.M) {
+	// The integration tests need a running Redis, so they are skipped in CI environment, or when Redis is not reachable.
+	// The other tests always run
+	if strings.TrimSpace(os.Getenv("CI")) == "" {
+		redisClient := redis.NewClient(&redis.Options{Addr: os.Getenv("REDIS_ADDR")})
+		if err := redisClient.Ping(ctx).Err(); err != nil {
+			util.LOGGER.Warn("failed to connect to Redis for testing, skip integration tests", "error", err)
+		} else {
+			client = redisClient
+		}
+	}
+
+	os.Exit(m.Run())
+}
+
+// Helper: skip an integration test when Redis is not available
+func requireRedis(t *testing.T) {
+	if client == nil {
+		t.Skip("Redis is not available")
+	}
+}
+
+// Local mock OIDC provider: remember the authorization requests, and issue RS256 ID tokens for their codes
+type mockProvider struct {
+	server   *httptest.Server
+	key      *rsa.PrivateKey
+	clientID string
+
+	mu     sync.Mutex
+	grants map[string]url.Values // code -> authorization request parameters
+	claims map[string]any        // Claims to override in the next ID token
+}
+
+func newMockProvider(t *testing.T) *mockProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	mock := &mockProvider{key: key, clientID: "tekticket-test", grants: map[string]url.Values{}}
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"issuer":                 mock.server.URL,
+			"authorization_endpoint": mock.server.URL + "/authorize",
+			"token_endpoint":         mock.server.URL + "/token",
+			"jwks_uri":               mock.server.URL + "/jwks",
+		})
+	})
+
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]any{{
+			"kty": "RSA",
+			"kid": "test-key",
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		w.Header().Set("Content-Type", "application/json")
+
+		mock.mu.Lock()
+		grant, ok := mock.grants[r.PostForm.Get("code")]
+		delete(mock.grants, r.PostForm.Get("code"))
+		mock.mu.Unlock()
+
+		// Check the PKCE code verifier against the challenge of the authorization request
+		if !ok || r.PostForm.Get("client_id") != mock.clientID ||
+			CodeChallenge(r.PostForm.Get("code_verifier")) != grant.Get("code_challenge") {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]any{"error": "invalid_grant"})
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]any{
+			"access_token": util.RandomString(32),
+			"token_type":   "Bearer",
+			"id_token":     mock.sign(t, grant.Get("nonce")),
+		})
+	})
+
+	mock.server = httptest.NewServer(mux)
+	t.Cleanup(mock.server.Close)
+	return mock
+}
+
+// Simulate the user logging in at the provider: return the code the provider would send back to the redirect URL
+func (mock *mockProvider) authorize(t *testing.T, authURL string) (string, string) {
+	parsed, err := url.Parse(authURL)
+	require.NoError(t, err)
+
+	params := parsed.Query()
+	require.Equal(t, "code", params.Get("response_type"))
+	require.Equal(t, "S256", params.Get("code_challenge_method"))
+	require.NotEmpty(t, params.Get("nonce"))
+
+	code := util.RandomString(16)
+	mock.mu.Lock()
+	mock.grants[code] = params
+	mock.mu.Unlock()
+
+	return params.Get("state"), code
+}
+
+// Sign an ID token
+func (mock *mockProvider) sign(t *testing.T, nonce string) string {
+	claims := map[string]any{
+		"iss":            mock.server.URL,
+		"sub":            "user-123",
+		"aud":            mock.clientID,
+		"exp":            time.Now().Add(time.Hour).Unix(),
+		"iat":            time.Now().Unix(),
+		"nonce":          nonce,
+		"email":          "john.doe@example.com",
+		"email_verified": true,
+		"given_name":     "John",
+		"family_name":    "Doe",
+	}
+	for key, value := range mock.claims {
+		claims[key] = value
+	}
+
+	header, _ := json.Marshal(map[string]any{"alg": "RS256", "typ": "JWT", "kid": "test-key"})
+	payload, err := json.Marshal(claims)
+	require.NoError(t, err)
+
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, mock.key, crypto.SHA256, digest[:])
+	require.NoError(t, err)
+
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func (mock *mockProvider) manager() *Manager {
+	return NewManager(client, NewProvider(ProviderConfig{
+		Name:         "mock",
+		Issuer:       mock.server.URL,
+		ClientID:     mock.clientID,
+		ClientSecret: "secret",
+		RedirectURL:  "http://localhost:3000/auth/callback",
+	}))
+}
+
+// Test: full authorization code flow with PKCE
+func TestLogin(t *testing.T) {
+	requireRedis(t)
+
+	mock := newMockProvider(t)
+	manager := mock.manager()
+
+	authURL, err := manager.AuthorizationURL(ctx, "mock")
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(authURL, mock.server.URL+"/authorize?"))
+
+	state, code := mock.authorize(t, authURL)
+	provider, claims, err := manager.Complete(ctx, state, code)
+	require.NoError(t, err)
+	require.Equal(t, "mock", provider)
+	require.Equal(t, "user-123", claims.Subject)
+	require.Equal(t, "john.doe@example.com", claims.Email)
+	require.True(t, bool(claims.EmailVerified))
+	require.Equal(t, "John", claims.GivenName)
+
+	// The state can't be replayed
+	_, _, err = manager.Complete(ctx, state, code)
+	require.ErrorIs(t, err, ErrInvalidState)
+}
+
+// Test: unknown provider and state
+func TestInvalidRequest(t *testing.T) {
+	requireRedis(t)
+
+	mock := newMockProvider(t)
+	manager := mock.manager()
+
+	_, err := manager.AuthorizationURL(ctx, "unknown")
+	require.ErrorIs(t, err, ErrUnknownProvider)
+
+	_, _, err = manager.Complete(ctx, util.RandomString(32), util.RandomString(16))
+	require.ErrorIs(t, err, ErrInvalidState)
+
+	// Wrong code: the provider refuses the exchange
+	authURL, err := manager.AuthorizationURL(ctx, "mock")
+	require.NoError(t, err)
+	state, _ := mock.authorize(t, authURL)
+	_, _, err = manager.Complete(ctx, state, "wrong-code")
+	require.ErrorIs(t, err, ErrExchangeFailed)
+}
+
+// Test: ID tokens with wrong claims are rejected
+func TestVerifyIDToken(t *testing.T) {
+	requireRedis(t)
+
+	mock := newMockProvider(t)
+	manager := mock.manager()
+
+	testCases := []struct {
+		name   string
+		claims map[string]any
+	}{
+		{"wrong nonce", map[string]any{"nonce": "forged"}},
+		{"wrong audience", map[string]any{"aud": "another-client"}},
+		{"wrong issuer", map[string]any{"iss": "https://evil.example.com"}},
+		{"expired", map[string]any{"exp": time.Now().Add(-time.Hour).Unix()}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mock.claims = tc.claims
+			defer func() { mock.claims = nil }()
+
+			authURL, err := manager.AuthorizationURL(ctx, "mock")
+			require.NoError(t, err)
+
+			state, code := mock.authorize(t, authURL)
+			_, _, err = manager.Complete(ctx, state, code)
+			require.ErrorIs(t, err, ErrInvalidIDToken)
+		})
+	}
+
+	// Tampered payload: the signature doesn't match anymore
+	provider := manager.providers["mock"]
+	token := mock.sign(t, "nonce")
+	segments := strings.Split(token, ".")
+	payload, _ := json.Marshal(map[string]any{"sub": "admin", "nonce": "nonce"})
+	segments[1] = base64.RawURLEncoding.EncodeToString(payload)
+	_, err := provider.VerifyIDToken(ctx, strings.Join(segments, "."), "nonce")
+	require.ErrorIs(t, err, ErrInvalidIDToken)
+}
+
+// Test: Google issuer with or without the scheme
+func TestIssuerMatches(t *testing.T) {
+	require.True(t, issuerMatches(GOOGLE_ISSUER, GOOGLE_ISSUER))
+	require.True(t, issuerMatches("accounts.google.com", GOOGLE_ISSUER))
+	require.False(t, issuerMatches("accounts.google.com.evil.example.com", GOOGLE_ISSUER))
+	require.False(t, issuerMatches("example.com", "https://example.com"))
+}
@@ -0,0 +1,448 @@
+package oauth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+ * OpenID Connect provider: discovery, authorization code exchange and ID token verification.
+ * Only what we need for login is implemented: authorization code flow with PKCE, client_secret_post authentication,
+ * and RS256/ES256 signed ID tokens.
+ */
+
+const (
+	GOOGLE_ISSUER = "https://accounts.google.com"
+	CLOCK_SKEW    = time.Minute     // Allowed clock drift when checking the ID token times
+	JWKS_MIN_AGE  = 5 * time.Minute // Minimum time between 2 JWKS fetches, when an unknown key ID is seen
+)
+
+var (
+	ErrInvalidIDToken = errors.New("invalid ID token")
+	ErrExchangeFailed = errors.New("authorization code exchange failed")
+)
+
+// Provider config
+type ProviderConfig struct {
+	Name         string   // Name used in the API path, like "google"
+	Issuer       string   // Issuer URL, the discovery document is at {Issuer}/.well-known/openid-configuration
+	ClientID     string   // OAuth client ID
+	ClientSecret string   // OAuth client secret
+	RedirectURL  string   // Where the provider redirects the user after login
+	Scopes       []string // Requested scopes, default to openid, email and profile
+}
+
+// Google provider config
+func GoogleConfig(clientID, clientSecret, redirectURL string) ProviderConfig {
+	return ProviderConfig{
+		Name:         "google",
+		Issuer:       GOOGLE_ISSUER,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  redirectURL,
+	}
+}
+
+// OpenID Connect discovery document (only the fields we use)
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// ID token claims
+type Claims struct {
+	Issuer        string   `json:"iss"`
+	Subject       string   `json:"sub"`
+	Audience      audience `json:"aud"`
+	AuthorizedBy  string   `json:"azp"`
+	Expiry        int64    `json:"exp"`
+	IssuedAt      int64    `json:"iat"`
+	Nonce         string   `json:"nonce"`
+	Email         string   `json:"email"`
+	EmailVerified flexBool `json:"email_verified"`
+	Name          string   `json:"name"`
+	GivenName     string   `json:"given_name"`
+	FamilyName    string   `json:"family_name"`
+	Picture       string   `json:"picture"`
+}
+
+// Audience claim, can be either a string or an array of strings
+type audience []string
+
+func (aud *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*aud = audience{single}
+		return nil
+	}
+
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return err
+	}
+	*aud = multiple
+	return nil
+}
+
+// Boolean claim, some providers send email_verified as a string
+type flexBool bool
+
+func (b *flexBool) UnmarshalJSON(data []byte) error {
+	switch strings.Trim(string(data), `"`) {
+	case "true":
+		*b = true
+	case "false", "null", "":
+		*b = false
+	default:
+		return fmt.Errorf("invalid boolean value: %s", data)
+	}
+	return nil
+}
+
+// OpenID Connect provider
+type Provider struct {
+	config ProviderConfig
+	client *http.Client
+
+	mu            sync.Mutex
+	metadata      *discovery
+	keys          map[string]crypto.PublicKey
+	keysFetchedAt time.Time
+}
+
+// Constructor method for provider. Discovery is done lazily on first use, so that the server can start even if the
+// provider is unreachable
+func NewProvider(config ProviderConfig) *Provider {
+	if len(config.Scopes) == 0 {
+		config.Scopes = []string{"openid", "email", "profile"}
+	}
+
+	return &Provider{
+		config: config,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Provider name
+func (provider *Provider) Name() string {
+	return provider.config.Name
+}
+
+// Helper: GET a JSON document
+func (provider *Provider) getJSON(ctx context.Context, url string, result any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := provider.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: unexpected status %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// Helper: get the discovery document, fetched once
+func (provider *Provider) discover(ctx context.Context) (*discovery, error) {
+	provider.mu.Lock()
+	defer provider.mu.Unlock()
+
+	if provider.metadata != nil {
+		return provider.metadata, nil
+	}
+
+	url := strings.TrimSuffix(provider.config.Issuer, "/") + "/.well-known/openid-configuration"
+	var metadata discovery
+	if err := provider.getJSON(ctx, url, &metadata); err != nil {
+		return nil, err
+	}
+
+	// The issuer in the document must be the one we are configured with (OpenID Connect Discovery, section 4.3)
+	if strings.TrimSuffix(metadata.Issuer, "/") != strings.TrimSuffix(provider.config.Issuer, "/") {
+		return nil, fmt.Errorf("issuer mismatch: expected %s, got %s", provider.config.Issuer, metadata.Issuer)
+	}
+
+	provider.metadata = &metadata
+	return provider.metadata, nil
+}
+
+// Build the URL to redirect the user to, for the authorization code flow with PKCE (S256)
+func (provider *Provider) AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	metadata, err := provider.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("client_id", provider.config.ClientID)
+	params.Set("redirect_uri", provider.config.RedirectURL)
+	params.Set("scope", strings.Join(provider.config.Scopes, " "))
+	params.Set("state", state)
+	params.Set("nonce", nonce)
+	params.Set("code_challenge", codeChallenge)
+	params.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(metadata.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return metadata.AuthorizationEndpoint + separator + params.Encode(), nil
+}
+
+// Exchange an authorization code for the raw ID token
+func (provider *Provider) Exchange(ctx context.Context, code, codeVerifier string) (string, error) {
+	metadata, err := provider.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", provider.config.RedirectURL)
+	form.Set("client_id", provider.config.ClientID)
+	form.Set("client_secret", provider.config.ClientSecret)
+	form.Set("code_verifier", codeVerifier)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := provider.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrExchangeFailed, err)
+	}
+
+	if resp.StatusCode != http.StatusOK || result.Error != "" {
+		return "", fmt.Errorf("%w: %s %s", ErrExchangeFailed, result.Error, result.ErrorDescription)
+	}
+	if result.IDToken == "" {
+		return "", fmt.Errorf("%w: no ID token in response", ErrExchangeFailed)
+	}
+
+	return result.IDToken, nil
+}
+
+// JSON Web Key (only the fields of RSA and EC keys)
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// Helper: parse a JSON Web Key into a public key
+func (key jwk) publicKey() (crypto.PublicKey, error) {
+	decode := func(s string) (*big.Int, error) {
+		data, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil {
+			return nil, err
+		}
+		return new(big.Int).SetBytes(data), nil
+	}
+
+	switch key.Kty {
+	case "RSA":
+		n, err := decode(key.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(key.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if key.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve: %s", key.Crv)
+		}
+		x, err := decode(key.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(key.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type: %s", key.Kty)
+	}
+}
+
+// Helper: get the signing key with this ID. The key set is refetched when the ID is unknown, since providers rotate their keys
+func (provider *Provider) publicKey(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	metadata, err := provider.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	provider.mu.Lock()
+	defer provider.mu.Unlock()
+
+	if key, ok := provider.keys[kid]; ok {
+		return key, nil
+	}
+
+	if provider.keys != nil && time.Since(provider.keysFetchedAt) < JWKS_MIN_AGE {
+		return nil, fmt.Errorf("%w: unknown key ID %s", ErrInvalidIDToken, kid)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := provider.getJSON(ctx, metadata.JWKSURI, &set); err != nil {
+		return nil, err
+	}
+
+	keys := map[string]crypto.PublicKey{}
+	for _, key := range set.Keys {
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+		if publicKey, err := key.publicKey(); err == nil {
+			keys[key.Kid] = publicKey
+		}
+	}
+	provider.keys = keys
+	provider.keysFetchedAt = time.Now()
+
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("%w: unknown key ID %s", ErrInvalidIDToken, kid)
+}
+
+// Verify an ID token: signature, issuer, audience, times and nonce. Return its claims
+func (provider *Provider) VerifyIDToken(ctx context.Context, rawToken, nonce string) (*Claims, error) {
+	segments := strings.Split(rawToken, ".")
+	if len(segments) != 3 {
+		return nil, fmt.Errorf("%w: malformed token", ErrInvalidIDToken)
+	}
+
+	// Header
+	headerData, err := base64.RawURLEncoding.DecodeString(segments[0])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := json.Unmarshal(headerData, &header); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	// Signature
+	signature, err := base64.RawURLEncoding.DecodeString(segments[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	key, err := provider.publicKey(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+
+	digest := sha256.Sum256([]byte(segments[0] + "." + segments[1]))
+	switch publicKey := key.(type) {
+	case *rsa.PublicKey:
+		if header.Alg != "RS256" || rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, digest[:], signature) != nil {
+			return nil, fmt.Errorf("%w: bad signature", ErrInvalidIDToken)
+		}
+	case *ecdsa.PublicKey:
+		if header.Alg != "ES256" || len(signature) != 64 {
+			return nil, fmt.Errorf("%w: bad signature", ErrInvalidIDToken)
+		}
+		r, s := new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])
+		if !ecdsa.Verify(publicKey, digest[:], r, s) {
+			return nil, fmt.Errorf("%w: bad signature", ErrInvalidIDToken)
+		}
+	default:
+		return nil, fmt.Errorf("%w: unsupported algorithm %s", ErrInvalidIDToken, header.Alg)
+	}
+
+	// Claims
+	payload, err := base64.RawURLEncoding.DecodeString(segments[1])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+	var claims Claims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	metadata, err := provider.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	switch {
+	case !issuerMatches(claims.Issuer, metadata.Issuer):
+		return nil, fmt.Errorf("%w: issuer mismatch", ErrInvalidIDToken)
+	case !slices.Contains(claims.Audience, provider.config.ClientID):
+		return nil, fmt.Errorf("%w: audience mismatch", ErrInvalidIDToken)
+	case len(claims.Audience) > 1 && claims.AuthorizedBy != provider.config.ClientID:
+		return nil, fmt.Errorf("%w: authorized party mismatch", ErrInvalidIDToken)
+	case now.After(time.Unix(claims.Expiry, 0).Add(CLOCK_SKEW)):
+		return nil, fmt.Errorf("%w: token expired", ErrInvalidIDToken)
+	case time.Unix(claims.IssuedAt, 0).After(now.Add(CLOCK_SKEW)):
+		return nil, fmt.Errorf("%w: token issued in the future", ErrInvalidIDToken)
+	case claims.Nonce != nonce:
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	case claims.Subject == "":
+		return nil, fmt.Errorf("%w: missing subject", ErrInvalidIDToken)
+	}
+
+	return &claims, nil
+}
+
+// Helper function: whether the issuer of an ID token is the one of the provider. Google issues ID tokens with its issuer
+// with or without the scheme
+func issuerMatches(issuer, expected string) bool {
+	if issuer == expected {
+		return true
+	}
+	return expected == GOOGLE_ISSUER && issuer == strings.TrimPrefix(GOOGLE_ISSUER, "https://")
+}
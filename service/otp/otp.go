@@ -0,0 +1,281 @@
+package otp
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"tekticket/db"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+/*
+ * One-time password manager, backed by Redis.
+ * Every OTP is bound to a purpose (verify account, reset password, ...) and a subject (usually the user ID), and stored as:
+ * - otp:{purpose}:{subject}          : HMAC of the code, expired after the policy TTL
+ * - otp:{purpose}:{subject}:attempts : number of failed verification attempts, kept across the issued codes until a code is
+ *                                      verified, expired after the lockout without a new failure
+ * - otp:{purpose}:{subject}:lock     : set when the subject failed too many times, block both issuing and verifying
+ * - otp:{purpose}:{subject}:cooldown : set when a code is requested, block requesting another one until expired
+ * Only the HMAC of the code is stored, so reading Redis doesn't reveal any valid code.
+ */
+
+// OTP purposes
+const (
+	PURPOSE_VERIFY_ACCOUNT = "verify"
+)
+
+// Default policy values, used when the dynamic config doesn't set them
+const (
+	DEFAULT_TTL             = 5 * time.Minute
+	DEFAULT_MAX_ATTEMPTS    = 5
+	DEFAULT_LOCKOUT         = 15 * time.Minute
+	DEFAULT_RESEND_COOLDOWN = time.Minute
+	CODE_LENGTH             = 6
+)
+
+var (
+	ErrExpired  = errors.New("otp expired or not issued")
+	ErrInvalid  = errors.New("otp invalid")
+	ErrLocked   = errors.New("too many failed attempts")
+	ErrCooldown = errors.New("otp was requested recently")
+)
+
+// Error returned when the caller has to wait before trying again (ErrLocked or ErrCooldown)
+type WaitError struct {
+	Err        error
+	RetryAfter time.Duration
+}
+
+func (e *WaitError) Error() string {
+	return fmt.Sprintf("%s, retry after %s", e.Err.Error(), e.RetryAfter.Round(time.Second))
+}
+
+func (e *WaitError) Unwrap() error {
+	return e.Err
+}
+
+// Policy of an OTP flow
+type Policy struct {
+	Purpose        string
+	TTL            time.Duration // How long a code is valid
+	MaxAttempts    int           // Number of failed attempts before the subject get locked
+	Lockout        time.Duration // How long the subject is locked
+	ResendCooldown time.Duration // Minimum time between 2 code requests
+}
+
+// Build the policy of an OTP flow from the dynamic config
+func NewPolicy(purpose string, setting db.Setting) Policy {
+	policy := Policy{
+		Purpose:        purpose,
+		TTL:            time.Duration(setting.OTPTTLSeconds) * time.Second,
+		MaxAttempts:    setting.OTPMaxAttempts,
+		Lockout:        time.Duration(setting.OTPLockoutMinutes) * time.Minute,
+		ResendCooldown: time.Duration(setting.OTPResendCooldownSeconds) * time.Second,
+	}
+
+	if policy.TTL <= 0 {
+		policy.TTL = DEFAULT_TTL
+	}
+	if policy.MaxAttempts <= 0 {
+		policy.MaxAttempts = DEFAULT_MAX_ATTEMPTS
+	}
+	if policy.Lockout <= 0 {
+		policy.Lockout = DEFAULT_LOCKOUT
+	}
+	if policy.ResendCooldown <= 0 {
+		policy.ResendCooldown = DEFAULT_RESEND_COOLDOWN
+	}
+
+	return policy
+}
+
+// OTP manager
+type Manager struct {
+	client *redis.Client
+	secret []byte
+}
+
+// Constructor method for OTP manager. The secret is used to HMAC the codes before storing them
+func NewManager(client *redis.Client, secret string) *Manager {
+	return &Manager{
+		client: client,
+		secret: []byte(secret),
+	}
+}
+
+// Helper method: build the Redis key of an OTP
+func (manager *Manager) key(policy Policy, subject string, suffix string) string {
+	key := fmt.Sprintf("otp:%s:%s", policy.Purpose, subject)
+	if suffix != "" {
+		key += ":" + suffix
+	}
+	return key
+}
+
+// Helper method: hash the code with the manager secret
+func (manager *Manager) hash(policy Policy, subject, code string) string {
+	mac := hmac.New(sha256.New, manager.secret)
+	mac.Write(fmt.Appendf(nil, "%s:%s:%s", policy.Purpose, subject, code))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Helper method: return a WaitError if the subject is currently locked
+func (manager *Manager) checkLock(ctx context.Context, policy Policy, subject string) error {
+	ttl, err := manager.client.PTTL(ctx, manager.key(policy, subject, "lock")).Result()
+	if err != nil {
+		return err
+	}
+
+	// PTTL return negative value if the key doesn't exist
+	if ttl > 0 {
+		return &WaitError{Err: ErrLocked, RetryAfter: ttl}
+	}
+
+	return nil
+}
+
+// Generate a random numeric code using a cryptographically secure source
+func GenerateCode() (string, error) {
+	upper := big.NewInt(1)
+	for range CODE_LENGTH {
+		upper.Mul(upper, big.NewInt(10))
+	}
+
+	n, err := rand.Int(rand.Reader, upper)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%0*d", CODE_LENGTH, n), nil
+}
+
+// Start the resend cooldown of a subject. This should be called by the API handler before asking for a new code, so that the
+// client can be told right away to wait. Return a WaitError if the subject is locked or still in cooldown.
+func (manager *Manager) StartCooldown(ctx context.Context, policy Policy, subject string) error {
+	if err := manager.checkLock(ctx, policy, subject); err != nil {
+		return err
+	}
+
+	key := manager.key(policy, subject, "cooldown")
+	ok, err := manager.client.SetNX(ctx, key, 1, policy.ResendCooldown).Result()
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		ttl, err := manager.client.PTTL(ctx, key).Result()
+		if err != nil {
+			return err
+		}
+		return &WaitError{Err: ErrCooldown, RetryAfter: max(ttl, time.Second)}
+	}
+
+	return nil
+}
+
+// Issue a new code for the subject, replacing any previous one. The failed attempts counter is kept, so that requesting
+// new codes doesn't reset the way to the lockout.
+// The plain code is returned so that the caller can deliver it, it's never stored.
+func (manager *Manager) Issue(ctx context.Context, policy Policy, subject string) (string, error) {
+	if err := manager.checkLock(ctx, policy, subject); err != nil {
+		return "", err
+	}
+
+	code, err := GenerateCode()
+	if err != nil {
+		return "", err
+	}
+
+	err = manager.client.Set(ctx, manager.key(policy, subject, ""), manager.hash(policy, subject, code), policy.TTL).Err()
+	if err != nil {
+		return "", err
+	}
+
+	return code, nil
+}
+
+// Put back a verified code of the subject, when the action it confirmed failed afterward, so that the subject can retry it
+// without waiting for a new code. A code issued in the meantime is kept.
+func (manager *Manager) Restore(ctx context.Context, policy Policy, subject, code string) error {
+	return manager.client.SetNX(ctx, manager.key(policy, subject, ""), manager.hash(policy, subject, code), policy.TTL).Err()
+}
+
+// Results of the verify script
+const (
+	verifyOK = iota
+	verifyExpired
+	verifyInvalid
+	verifyLocked
+)
+
+// KEYS[1]: code, KEYS[2]: failed attempts, KEYS[3]: lock
+// ARGV[1]: hash of the code to verify, ARGV[2]: max attempts, ARGV[3]: lockout (ms)
+// Return: {result, time left of the lock (ms) if locked}
+var verifyScript = redis.NewScript(`
+local lock = redis.call('PTTL', KEYS[3])
+if lock > 0 then
+	return {3, lock}
+end
+
+local stored = redis.call('GET', KEYS[1])
+if not stored then
+	return {1, 0}
+end
+if stored == ARGV[1] then
+	redis.call('DEL', KEYS[1], KEYS[2])
+	return {0, 0}
+end
+
+local attempts = redis.call('INCR', KEYS[2])
+redis.call('PEXPIRE', KEYS[2], ARGV[3])
+if attempts < tonumber(ARGV[2]) then
+	return {2, 0}
+end
+
+redis.call('SET', KEYS[3], 1, 'PX', ARGV[3])
+redis.call('DEL', KEYS[1], KEYS[2])
+return {3, tonumber(ARGV[3])}
+`)
+
+// Verify a code of the subject. On success, the code is consumed and can't be used again.
+// Return ErrExpired if there is no code to verify against, ErrInvalid if the code is wrong, or a WaitError wrapping ErrLocked
+// if the subject failed too many times.
+// The check, the consumption and the failed attempts counter are updated by a single script, so concurrent attempts can't
+// verify the same code twice or exceed the max attempts. The counter is only reset by a successful verification, or once
+// the lockout passed since the last failure.
+func (manager *Manager) Verify(ctx context.Context, policy Policy, subject, code string) error {
+	keys := []string{
+		manager.key(policy, subject, ""),
+		manager.key(policy, subject, "attempts"),
+		manager.key(policy, subject, "lock"),
+	}
+	result, err := verifyScript.Run(
+		ctx,
+		manager.client,
+		keys,
+		manager.hash(policy, subject, code),
+		policy.MaxAttempts,
+		policy.Lockout.Milliseconds(),
+	).Int64Slice()
+	if err != nil {
+		return err
+	}
+
+	switch result[0] {
+	case verifyOK:
+		return nil
+	case verifyExpired:
+		return ErrExpired
+	case verifyInvalid:
+		return ErrInvalid
+	default:
+		return &WaitError{Err: ErrLocked, RetryAfter: time.Duration(result[1]) * time.Millisecond}
+	}
+}
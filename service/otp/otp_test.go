@@ -0,0 +1,258 @@
+package otp
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"tekticket/db"
+	"tekticket/util"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	ctx     = context.Background()
+	manager *Manager
+	policy  = Policy{
+		Purpose:        "test",
+		TTL:            time.Minute,
+		MaxAttempts:    3,
+		Lockout:        time.Minute,
+		ResendCooldown: time.Minute,
+	}
+)
+
+func TestMain(m *testing.M) {
+	// The integration tests need a running Redis, so they are skipped in CI environment, or when Redis is not reachable.
+	// The other tests always run
+	if strings.TrimSpace(os.Getenv("CI")) == "" {
+		client := redis.NewClient(&redis.Options{Addr: os.Getenv("REDIS_ADDR")})
+		if err := client.Ping(ctx).Err(); err != nil {
+			util.LOGGER.Warn("failed to connect to Redis for testing, skip integration tests", "error", err)
+		} else {
+			manager = NewManager(client, util.RandomString(32))
+		}
+	}
+
+	os.Exit(m.Run())
+}
+
+// Helper: skip an integration test when Redis is not available
+func requireRedis(t *testing.T) {
+	if manager == nil {
+		t.Skip("Redis is not available")
+	}
+}
+
+// Test: generated codes are numeric and have a fixed length
+func TestGenerateCode(t *testing.T) {
+	for range 100 {
+		code, err := GenerateCode()
+		require.NoError(t, err)
+		require.Len(t, code, CODE_LENGTH)
+		for _, c := range code {
+			require.True(t, c >= '0' && c <= '9')
+		}
+	}
+}
+
+// Test: policy fallback to default value when the setting doesn't provide them
+func TestNewPolicy(t *testing.T) {
+	result := NewPolicy(PURPOSE_VERIFY_ACCOUNT, db.Setting{OTPTTLSeconds: 30})
+	require.Equal(t, PURPOSE_VERIFY_ACCOUNT, result.Purpose)
+	require.Equal(t, 30*time.Second, result.TTL)
+	require.Equal(t, DEFAULT_MAX_ATTEMPTS, result.MaxAttempts)
+	require.Equal(t, DEFAULT_LOCKOUT, result.Lockout)
+	require.Equal(t, DEFAULT_RESEND_COOLDOWN, result.ResendCooldown)
+}
+
+// Test: an issued code can be verified exactly once
+func TestIssueAndVerify(t *testing.T) {
+	requireRedis(t)
+
+	subject := util.RandomString(12)
+
+	code, err := manager.Issue(ctx, policy, subject)
+	require.NoError(t, err)
+	require.NoError(t, manager.Verify(ctx, policy, subject, code))
+	require.ErrorIs(t, manager.Verify(ctx, policy, subject, code), ErrExpired)
+}
+
+// Test: a restored code can be verified again, unless a new code was issued
+func TestRestore(t *testing.T) {
+	requireRedis(t)
+
+	subject := util.RandomString(12)
+
+	code, err := manager.Issue(ctx, policy, subject)
+	require.NoError(t, err)
+	require.NoError(t, manager.Verify(ctx, policy, subject, code))
+	require.NoError(t, manager.Restore(ctx, policy, subject, code))
+	require.NoError(t, manager.Verify(ctx, policy, subject, code))
+
+	newCode, err := manager.Issue(ctx, policy, subject)
+	require.NoError(t, err)
+	require.NoError(t, manager.Restore(ctx, policy, subject, code))
+	require.NoError(t, manager.Verify(ctx, policy, subject, newCode))
+}
+
+// Test: a code is bound to its subject
+func TestVerifyOtherSubject(t *testing.T) {
+	requireRedis(t)
+
+	subject, other := util.RandomString(12), util.RandomString(12)
+
+	code, err := manager.Issue(ctx, policy, subject)
+	require.NoError(t, err)
+	require.ErrorIs(t, manager.Verify(ctx, policy, other, code), ErrExpired)
+}
+
+// Test: issuing a new code invalidate the previous one
+func TestIssueReplacePreviousCode(t *testing.T) {
+	requireRedis(t)
+
+	subject := util.RandomString(12)
+
+	first, err := manager.Issue(ctx, policy, subject)
+	require.NoError(t, err)
+	second, err := manager.Issue(ctx, policy, subject)
+	require.NoError(t, err)
+
+	if first != second {
+		require.ErrorIs(t, manager.Verify(ctx, policy, subject, first), ErrInvalid)
+	}
+	require.NoError(t, manager.Verify(ctx, policy, subject, second))
+}
+
+// Test: the subject get locked after too many failed attempts, even the correct code is rejected
+func TestVerifyLockout(t *testing.T) {
+	requireRedis(t)
+
+	subject := util.RandomString(12)
+
+	code, err := manager.Issue(ctx, policy, subject)
+	require.NoError(t, err)
+
+	wrong := "000000"
+	if code == wrong {
+		wrong = "111111"
+	}
+
+	for range policy.MaxAttempts - 1 {
+		require.ErrorIs(t, manager.Verify(ctx, policy, subject, wrong), ErrInvalid)
+	}
+
+	err = manager.Verify(ctx, policy, subject, wrong)
+	require.ErrorIs(t, err, ErrLocked)
+
+	var waitErr *WaitError
+	require.True(t, errors.As(err, &waitErr))
+	require.Equal(t, policy.Lockout, waitErr.RetryAfter)
+
+	require.ErrorIs(t, manager.Verify(ctx, policy, subject, code), ErrLocked)
+	_, err = manager.Issue(ctx, policy, subject)
+	require.ErrorIs(t, err, ErrLocked)
+}
+
+// Test: requesting a new code doesn't reset the failed attempts, and a successful verification does
+func TestVerifyLockoutAcrossCodes(t *testing.T) {
+	requireRedis(t)
+
+	subject, other := util.RandomString(12), util.RandomString(12)
+
+	// Issue a code of a subject, and return a wrong one
+	issue := func(subject string) (string, string) {
+		code, err := manager.Issue(ctx, policy, subject)
+		require.NoError(t, err)
+		if code == "000000" {
+			return code, "111111"
+		}
+		return code, "000000"
+	}
+
+	_, wrong := issue(subject)
+	for range policy.MaxAttempts - 1 {
+		require.ErrorIs(t, manager.Verify(ctx, policy, subject, wrong), ErrInvalid)
+	}
+
+	// Resend, then fail again
+	code, wrong := issue(subject)
+	require.ErrorIs(t, manager.Verify(ctx, policy, subject, wrong), ErrLocked)
+	require.ErrorIs(t, manager.Verify(ctx, policy, subject, code), ErrLocked)
+
+	// A verified code starts over
+	code, wrong = issue(other)
+	require.ErrorIs(t, manager.Verify(ctx, policy, other, wrong), ErrInvalid)
+	require.NoError(t, manager.Verify(ctx, policy, other, code))
+	_, wrong = issue(other)
+	for range policy.MaxAttempts - 1 {
+		require.ErrorIs(t, manager.Verify(ctx, policy, other, wrong), ErrInvalid)
+	}
+}
+
+// Test: concurrent attempts can't exceed the max attempts, or verify a code twice
+func TestVerifyConcurrent(t *testing.T) {
+	requireRedis(t)
+
+	subject := util.RandomString(12)
+
+	code, err := manager.Issue(ctx, policy, subject)
+	require.NoError(t, err)
+
+	wrong := "000000"
+	if code == wrong {
+		wrong = "111111"
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		verified int
+		invalid  int
+	)
+	for i := range 2 * policy.MaxAttempts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			attempt := wrong
+			if i%2 == 0 {
+				attempt = code
+			}
+
+			err := manager.Verify(ctx, policy, subject, attempt)
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				verified++
+			case errors.Is(err, ErrInvalid):
+				invalid++
+			}
+		}()
+	}
+	wg.Wait()
+
+	require.LessOrEqual(t, verified, 1)
+	require.Less(t, invalid, policy.MaxAttempts)
+}
+
+// Test: a new code can't be requested during the cooldown
+func TestStartCooldown(t *testing.T) {
+	requireRedis(t)
+
+	subject := util.RandomString(12)
+
+	require.NoError(t, manager.StartCooldown(ctx, policy, subject))
+
+	err := manager.StartCooldown(ctx, policy, subject)
+	require.ErrorIs(t, err, ErrCooldown)
+
+	var waitErr *WaitError
+	require.True(t, errors.As(err, &waitErr))
+	require.Greater(t, waitErr.RetryAfter, time.Duration(0))
+}
@@ -115,3 +115,21 @@ func CreateRefund(paymentIntentID string, reason RefundReason, amount int64) (*s
 
 	return refund, nil
 }
+
+// Same as CreateRefund, but Stripe answers the requests with the same idempotency key with the same refund, so that a
+// retried refund is never made twice
+func CreateIdempotentRefund(paymentIntentID string, reason RefundReason, amount int64, idempotencyKey string) (*stripe.Refund, error) {
+	params := &stripe.RefundParams{
+		PaymentIntent: stripe.String(string(paymentIntentID)),
+		Amount:        stripe.Int64(amount),
+		Reason:        stripe.String(string(reason)),
+	}
+	params.SetIdempotencyKey(idempotencyKey)
+
+	return refund.New(params)
+}
+
+// Get a refund, to follow a refund that Stripe didn't complete right away
+func GetRefund(refundID string) (*stripe.Refund, error) {
+	return refund.Get(refundID, &stripe.RefundParams{})
+}
@@ -0,0 +1,196 @@
+package promo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+/*
+ * Usage counter of the promo codes, backed by Redis. A booking created with a code holds a use of it until the booking is
+ * paid, and the use counts for good once the payment is confirmed. The hold expires with the reservation of the booking,
+ * so a booking that expires, is canceled or whose payment fails gives its use back without any cleanup. The holds count
+ * toward the limits like the confirmed uses, and the check of the limits and the count happen inside Lua scripts, so that
+ * concurrent bookings from multiple server instances cannot exceed the limits.
+ */
+
+// Drop the expired holds of a code. KEYS[4]: holds (booking -> expiry), KEYS[5]: holders (booking -> customer), ARGV[1]: now
+const dropExpiredHolds = `
+local expired = redis.call('ZRANGEBYSCORE', KEYS[4], '-inf', ARGV[1])
+for _, booking in ipairs(expired) do
+	redis.call('HDEL', KEYS[5], booking)
+end
+redis.call('ZREMRANGEBYSCORE', KEYS[4], '-inf', ARGV[1])
+
+local function userHolds(userID)
+	local count = 0
+	for _, holder in ipairs(redis.call('HVALS', KEYS[5])) do
+		if holder == userID then
+			count = count + 1
+		end
+	end
+	return count
+end
+`
+
+// KEYS[1]: confirmed uses of the code, KEYS[2]: confirmed uses of the customer, KEYS[3]: confirmed redemptions (booking ->
+// customer), KEYS[4]: holds, KEYS[5]: holders
+// ARGV[1]: now, ARGV[2]: total limit (0 for no limit), ARGV[3]: per customer limit (0 for no limit), ARGV[4]: booking ID,
+// ARGV[5]: customer ID, ARGV[6]: end of the hold
+// Return: 1 if held (or already held or redeemed by the booking), -1 if the total limit is reached, -2 for the customer limit
+var holdScript = redis.NewScript(dropExpiredHolds + `
+if redis.call('HEXISTS', KEYS[3], ARGV[4]) == 1 or redis.call('ZSCORE', KEYS[4], ARGV[4]) then
+	return 1
+end
+
+local limit = tonumber(ARGV[2])
+local userLimit = tonumber(ARGV[3])
+if limit > 0 and tonumber(redis.call('GET', KEYS[1]) or '0') + redis.call('ZCARD', KEYS[4]) >= limit then
+	return -1
+end
+if userLimit > 0 and tonumber(redis.call('GET', KEYS[2]) or '0') + userHolds(ARGV[5]) >= userLimit then
+	return -2
+end
+
+redis.call('ZADD', KEYS[4], ARGV[6], ARGV[4])
+redis.call('HSET', KEYS[5], ARGV[4], ARGV[5])
+return 1
+`)
+
+// KEYS: as holdScript. ARGV[1]: booking ID, ARGV[2]: customer ID
+// Return: 1 if redeemed, 0 if the booking had already redeemed the code
+var redeemScript = redis.NewScript(`
+if redis.call('HEXISTS', KEYS[3], ARGV[1]) == 1 then
+	return 0
+end
+
+redis.call('ZREM', KEYS[4], ARGV[1])
+redis.call('HDEL', KEYS[5], ARGV[1])
+redis.call('INCR', KEYS[1])
+redis.call('INCR', KEYS[2])
+redis.call('HSET', KEYS[3], ARGV[1], ARGV[2])
+return 1
+`)
+
+// KEYS: as holdScript. ARGV[1]: now, ARGV[2]: customer ID
+// Return: the uses of the code and the uses of the customer, confirmed or held
+var usageScript = redis.NewScript(dropExpiredHolds + `
+local total = tonumber(redis.call('GET', KEYS[1]) or '0') + redis.call('ZCARD', KEYS[4])
+local user = tonumber(redis.call('GET', KEYS[2]) or '0') + userHolds(ARGV[2])
+return {total, user}
+`)
+
+// Redis usage counter of the promo codes
+type Counter struct {
+	client *redis.Client
+	prefix string
+}
+
+// Constructor method for Counter. The client should be the shared Redis connection (db.Queries.Cache)
+func NewCounter(client *redis.Client) *Counter {
+	return &Counter{
+		client: client,
+		prefix: "promo",
+	}
+}
+
+// Current uses of a code, in total and by a customer, with the holds still running at now
+func (counter *Counter) Usage(ctx context.Context, codeID, userID string, now time.Time) (total, user int, err error) {
+	values, err := usageScript.Run(ctx, counter.client, counter.keys(codeID, userID), now.Unix(), userID).Int64Slice()
+	if err != nil {
+		return 0, 0, err
+	}
+	return int(values[0]), int(values[1]), nil
+}
+
+// Check the limits of a code, and hold a use of it for the booking of a customer until expiresAt if they are not reached.
+// Holding again for the same booking is a no-op. Return ErrUsageLimit or ErrUserUsageLimit if a limit is reached
+func (counter *Counter) Hold(
+	ctx context.Context,
+	codeID string,
+	limit, userLimit int,
+	bookingID, userID string,
+	now, expiresAt time.Time,
+) error {
+	result, err := holdScript.Run(
+		ctx,
+		counter.client,
+		counter.keys(codeID, userID),
+		now.Unix(),
+		limit,
+		userLimit,
+		bookingID,
+		userID,
+		expiresAt.Unix(),
+	).Int()
+	if err != nil {
+		return err
+	}
+
+	switch result {
+	case 1:
+		return nil
+	case -1:
+		return ErrUsageLimit
+	case -2:
+		return ErrUserUsageLimit
+	default:
+		return fmt.Errorf("unexpected promo code hold script result: %d", result)
+	}
+}
+
+// Count the use of a code by a paid booking for good, whether its hold is still running or not: the customer paid the
+// discounted price. Redeeming again for the same booking is a no-op. Return whether the use was counted now
+func (counter *Counter) Redeem(ctx context.Context, codeID, bookingID, userID string) (bool, error) {
+	redeemed, err := redeemScript.Run(ctx, counter.client, counter.keys(codeID, userID), bookingID, userID).Int()
+	return redeemed == 1, err
+}
+
+// Release the hold of a booking that failed to be created, before it expires. Return whether the booking held a use
+func (counter *Counter) Release(ctx context.Context, codeID, bookingID string) (bool, error) {
+	pipe := counter.client.TxPipeline()
+	removed := pipe.ZRem(ctx, counter.holdsKey(codeID), bookingID)
+	pipe.HDel(ctx, counter.holdersKey(codeID), bookingID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return false, err
+	}
+	return removed.Val() == 1, nil
+}
+
+// Helper method: keys of the scripts, for a code and a customer
+func (counter *Counter) keys(codeID, userID string) []string {
+	return []string{
+		counter.usedKey(codeID),
+		counter.userKey(codeID, userID),
+		counter.redemptionsKey(codeID),
+		counter.holdsKey(codeID),
+		counter.holdersKey(codeID),
+	}
+}
+
+// Helper method: key of the total uses of a code
+func (counter *Counter) usedKey(codeID string) string {
+	return fmt.Sprintf("%s:%s:used", counter.prefix, codeID)
+}
+
+// Helper method: key of the uses of a code by a customer
+func (counter *Counter) userKey(codeID, userID string) string {
+	return fmt.Sprintf("%s:%s:user:%s", counter.prefix, codeID, userID)
+}
+
+// Helper method: key of the redemptions of a code
+func (counter *Counter) redemptionsKey(codeID string) string {
+	return fmt.Sprintf("%s:%s:redemptions", counter.prefix, codeID)
+}
+
+// Helper method: key of the holds of a code, scored by their expiry
+func (counter *Counter) holdsKey(codeID string) string {
+	return fmt.Sprintf("%s:%s:holds", counter.prefix, codeID)
+}
+
+// Helper method: key of the customers holding a code, by booking
+func (counter *Counter) holdersKey(codeID string) string {
+	return fmt.Sprintf("%s:%s:holders", counter.prefix, codeID)
+}
@@ -0,0 +1,139 @@
+package promo
+
+import (
+	"errors"
+	"math"
+	"slices"
+	"strings"
+	"tekticket/db"
+	"tekticket/util"
+	"time"
+)
+
+/*
+ * Promo codes of the discount campaigns. A code takes a percentage (optionally capped) or a fixed amount off the tickets it
+ * applies to: the tickets of its event, of the events of its category, and of its ticket rank, when these are set. A code is
+ * valid between its start and end time, and for a number of bookings in total and per customer.
+ * Stacking with the membership discount: a stackable code applies on top of the member prices. Otherwise the customer gets
+ * the better of the two discounts, and the code is only used if it is the better one.
+ */
+
+// Discount types
+const (
+	DISCOUNT_TYPE_PERCENTAGE = "percentage"
+	DISCOUNT_TYPE_FIXED      = "fixed"
+)
+
+// Status of a code that can be used
+const STATUS_PUBLISHED = "published"
+
+var (
+	ErrCodeInactive      = errors.New("promo code is not active")
+	ErrCodeNotStarted    = errors.New("promo code is not valid yet")
+	ErrCodeExpired       = errors.New("promo code has expired")
+	ErrCodeNotApplicable = errors.New("promo code does not apply to these tickets")
+	ErrUsageLimit        = errors.New("promo code has reached its usage limit")
+	ErrUserUsageLimit    = errors.New("you have reached the usage limit of this promo code")
+)
+
+// A ticket of a checkout
+type Item struct {
+	Price      int
+	TicketRank string
+}
+
+// The tickets a customer is about to book
+type Checkout struct {
+	EventID        string
+	CategoryID     string
+	Items          []Item
+	MemberDiscount float64 // Membership discount of the customer, in percent
+}
+
+// Price of a checkout with its discounts
+type Quote struct {
+	Subtotal       int  `json:"subtotal"`        // Price of the tickets
+	MemberDiscount int  `json:"member_discount"` // Discount of the membership
+	PromoDiscount  int  `json:"promo_discount"`  // Discount of the code, 0 if the code is not used
+	Total          int  `json:"total"`           // Price after the discounts, before the payment fee
+	Applied        bool `json:"applied"`         // Whether the code is used, and counts toward its usage limits
+}
+
+// Normalize a code typed by a customer
+func Normalize(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// Check that a code can be used for a checkout at now: its status, its validity window and its scope
+func Check(code db.PromoCode, checkout Checkout, now time.Time) error {
+	if code.Status != STATUS_PUBLISHED {
+		return ErrCodeInactive
+	}
+	if code.StartTime != nil && now.Before(time.Time(*code.StartTime)) {
+		return ErrCodeNotStarted
+	}
+	if code.EndTime != nil && !now.Before(time.Time(*code.EndTime)) {
+		return ErrCodeExpired
+	}
+	if code.Event != nil && code.Event.ID != checkout.EventID {
+		return ErrCodeNotApplicable
+	}
+	if code.Category != nil && code.Category.ID != checkout.CategoryID {
+		return ErrCodeNotApplicable
+	}
+	if !slices.ContainsFunc(checkout.Items, func(item Item) bool { return applies(code, item) }) {
+		return ErrCodeNotApplicable
+	}
+	return nil
+}
+
+// Price a checkout with the membership discount and, if not nil, a code already checked
+func Apply(code *db.PromoCode, checkout Checkout) Quote {
+	var quote Quote
+	memberTotal, eligible, eligibleMember := 0, 0, 0
+	for _, item := range checkout.Items {
+		memberPrice := util.MemberPrice(item.Price, checkout.MemberDiscount)
+		quote.Subtotal += item.Price
+		memberTotal += memberPrice
+		if code != nil && applies(*code, item) {
+			eligible += item.Price
+			eligibleMember += memberPrice
+		}
+	}
+	quote.MemberDiscount = quote.Subtotal - memberTotal
+	quote.Total = memberTotal
+	if code == nil {
+		return quote
+	}
+
+	if code.StackableWithMembership {
+		quote.PromoDiscount = discount(*code, eligibleMember)
+	} else if promoDiscount := discount(*code, eligible); promoDiscount > quote.MemberDiscount {
+		// The code replaces the membership discount
+		quote.MemberDiscount, quote.PromoDiscount = 0, promoDiscount
+	}
+	quote.Applied = quote.PromoDiscount > 0
+	quote.Total = quote.Subtotal - quote.MemberDiscount - quote.PromoDiscount
+	return quote
+}
+
+// Helper function: whether a code applies to a ticket
+func applies(code db.PromoCode, item Item) bool {
+	return code.TicketRank == "" || strings.EqualFold(code.TicketRank, item.TicketRank)
+}
+
+// Helper function: discount of a code on an amount, never more than the amount
+func discount(code db.PromoCode, amount int) int {
+	value := max(float64(code.Value), 0)
+	off := 0
+	switch code.DiscountType {
+	case DISCOUNT_TYPE_PERCENTAGE:
+		off = int(math.Round(float64(amount) * min(value, 100) / 100))
+		if code.MaxDiscount > 0 {
+			off = min(off, code.MaxDiscount)
+		}
+	case DISCOUNT_TYPE_FIXED:
+		off = int(value)
+	}
+	return min(max(off, 0), amount)
+}
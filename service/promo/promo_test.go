@@ -0,0 +1,179 @@
+package promo
+
+import (
+	"context"
+	"os"
+	"strings"
+	"tekticket/db"
+	"tekticket/util"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	ctx     = context.Background()
+	counter *Counter
+)
+
+func TestMain(m *testing.M) {
+	// The integration tests need a running Redis, so they are skipped in CI environment, or when Redis is not reachable.
+	// The other tests always run
+	if strings.TrimSpace(os.Getenv("CI")) == "" {
+		client := redis.NewClient(&redis.Options{Addr: os.Getenv("REDIS_ADDR")})
+		if err := client.Ping(ctx).Err(); err != nil {
+			util.LOGGER.Warn("failed to connect to Redis for testing, skip integration tests", "error", err)
+		} else {
+			counter = NewCounter(client)
+		}
+	}
+
+	os.Exit(m.Run())
+}
+
+// Helper: skip an integration test when Redis is not available
+func requireRedis(t *testing.T) {
+	if counter == nil {
+		t.Skip("Redis is not available")
+	}
+}
+
+// Test: status, validity window and scope of a code
+func TestCheck(t *testing.T) {
+	now := time.Now()
+	before, after := db.DateTime(now.Add(-time.Hour)), db.DateTime(now.Add(time.Hour))
+	code := db.PromoCode{
+		Status:     STATUS_PUBLISHED,
+		Event:      &db.Event{ID: "event"},
+		TicketRank: "VIP",
+		StartTime:  &before,
+		EndTime:    &after,
+	}
+	checkout := Checkout{EventID: "event", Items: []Item{{Price: 100000, TicketRank: "Standard"}, {Price: 300000, TicketRank: "vip"}}}
+	require.NoError(t, Check(code, checkout, now))
+
+	testCases := []struct {
+		name   string
+		update func(code *db.PromoCode, checkout *Checkout)
+		err    error
+	}{
+		{"draft", func(code *db.PromoCode, checkout *Checkout) { code.Status = "draft" }, ErrCodeInactive},
+		{"not started", func(code *db.PromoCode, checkout *Checkout) { code.StartTime = &after }, ErrCodeNotStarted},
+		{"expired", func(code *db.PromoCode, checkout *Checkout) { code.EndTime = &before }, ErrCodeExpired},
+		{"other event", func(code *db.PromoCode, checkout *Checkout) { checkout.EventID = "other" }, ErrCodeNotApplicable},
+		{"other category", func(code *db.PromoCode, checkout *Checkout) { code.Category = &db.Category{ID: "category"} }, ErrCodeNotApplicable},
+		{"other rank", func(code *db.PromoCode, checkout *Checkout) { checkout.Items = checkout.Items[:1] }, ErrCodeNotApplicable},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			code, checkout := code, checkout
+			tc.update(&code, &checkout)
+			require.ErrorIs(t, Check(code, checkout, now), tc.err)
+		})
+	}
+}
+
+// Test: discounts of the codes, and stacking with the membership discount
+func TestApply(t *testing.T) {
+	items := []Item{{Price: 100000, TicketRank: "Standard"}, {Price: 300000, TicketRank: "VIP"}}
+
+	// Membership only
+	quote := Apply(nil, Checkout{Items: items, MemberDiscount: 10})
+	require.Equal(t, Quote{Subtotal: 400000, MemberDiscount: 40000, Total: 360000}, quote)
+
+	testCases := []struct {
+		name           string
+		code           db.PromoCode
+		memberDiscount float64
+		quote          Quote
+	}{
+		{
+			"percentage",
+			db.PromoCode{DiscountType: DISCOUNT_TYPE_PERCENTAGE, Value: 20},
+			0,
+			Quote{Subtotal: 400000, PromoDiscount: 80000, Total: 320000, Applied: true},
+		},
+		{
+			"capped percentage",
+			db.PromoCode{DiscountType: DISCOUNT_TYPE_PERCENTAGE, Value: 20, MaxDiscount: 50000},
+			0,
+			Quote{Subtotal: 400000, PromoDiscount: 50000, Total: 350000, Applied: true},
+		},
+		{
+			"fixed on a rank",
+			db.PromoCode{DiscountType: DISCOUNT_TYPE_FIXED, Value: 500000, TicketRank: "Standard"},
+			0,
+			Quote{Subtotal: 400000, PromoDiscount: 100000, Total: 300000, Applied: true},
+		},
+		{
+			"stacked on the member prices",
+			db.PromoCode{DiscountType: DISCOUNT_TYPE_PERCENTAGE, Value: 50, StackableWithMembership: true},
+			10,
+			Quote{Subtotal: 400000, MemberDiscount: 40000, PromoDiscount: 180000, Total: 180000, Applied: true},
+		},
+		{
+			"better than the membership",
+			db.PromoCode{DiscountType: DISCOUNT_TYPE_PERCENTAGE, Value: 20},
+			10,
+			Quote{Subtotal: 400000, PromoDiscount: 80000, Total: 320000, Applied: true},
+		},
+		{
+			"worse than the membership",
+			db.PromoCode{DiscountType: DISCOUNT_TYPE_FIXED, Value: 10000},
+			10,
+			Quote{Subtotal: 400000, MemberDiscount: 40000, Total: 360000},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.quote, Apply(&tc.code, Checkout{Items: items, MemberDiscount: tc.memberDiscount}))
+		})
+	}
+}
+
+// Test: usage limits in total and per customer, counting the holds until they expire, and the redemption of a paid booking
+func TestCounter(t *testing.T) {
+	requireRedis(t)
+
+	codeID := "test-" + util.RandomString(12)
+	defer counter.client.Del(ctx, counter.usedKey(codeID), counter.redemptionsKey(codeID), counter.holdsKey(codeID),
+		counter.holdersKey(codeID), counter.userKey(codeID, "alice"), counter.userKey(codeID, "bob"))
+
+	now := time.Now()
+	expiresAt := now.Add(time.Minute)
+	require.NoError(t, counter.Hold(ctx, codeID, 2, 1, "booking-1", "alice", now, expiresAt))
+	require.NoError(t, counter.Hold(ctx, codeID, 2, 1, "booking-1", "alice", now, expiresAt)) // Same booking
+	require.ErrorIs(t, counter.Hold(ctx, codeID, 2, 1, "booking-2", "alice", now, expiresAt), ErrUserUsageLimit)
+	require.NoError(t, counter.Hold(ctx, codeID, 2, 1, "booking-3", "bob", now, expiresAt))
+	require.ErrorIs(t, counter.Hold(ctx, codeID, 2, 0, "booking-4", "carol", now, expiresAt), ErrUsageLimit)
+
+	// The payment of a booking counts its use for good
+	redeemed, err := counter.Redeem(ctx, codeID, "booking-1", "alice")
+	require.NoError(t, err)
+	require.True(t, redeemed)
+	redeemed, err = counter.Redeem(ctx, codeID, "booking-1", "alice")
+	require.NoError(t, err)
+	require.False(t, redeemed)
+
+	total, user, err := counter.Usage(ctx, codeID, "alice", now)
+	require.NoError(t, err)
+	require.Equal(t, 2, total)
+	require.Equal(t, 1, user)
+
+	// A released hold, or one that expired, counts no more
+	released, err := counter.Release(ctx, codeID, "booking-3")
+	require.NoError(t, err)
+	require.True(t, released)
+	released, err = counter.Release(ctx, codeID, "booking-3")
+	require.NoError(t, err)
+	require.False(t, released)
+
+	require.NoError(t, counter.Hold(ctx, codeID, 2, 0, "booking-4", "carol", now, expiresAt))
+	total, _, err = counter.Usage(ctx, codeID, "carol", expiresAt.Add(time.Second))
+	require.NoError(t, err)
+	require.Equal(t, 1, total)
+}
@@ -0,0 +1,116 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+/*
+ * Sliding window log rate limiter backed by Redis.
+ * Every accepted request is recorded in a sorted set (score = request time in milliseconds), and old entries that fall out
+ * of the window are trimmed before counting. The whole check-and-record happens inside a Lua script so that concurrent
+ * requests from multiple server instances cannot exceed the limit.
+ */
+
+// Rule describes how many requests are allowed in a time window
+type Rule struct {
+	Limit  int
+	Window time.Duration
+}
+
+// Result of a rate limit check
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	RetryAfter time.Duration // How long the client should wait before retrying. Only set when Allowed is false
+	ResetAfter time.Duration // How long until the oldest request in the window expires and a slot is freed
+}
+
+// KEYS[1]: the bucket key
+// ARGV[1]: current time (ms), ARGV[2]: window (ms), ARGV[3]: limit, ARGV[4]: unique member for this request
+// Return: {allowed (0|1), remaining, reset_after_ms}
+var slidingWindowScript = redis.NewScript(`
+local key = KEYS[1]
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+
+redis.call('ZREMRANGEBYSCORE', key, 0, now - window)
+local count = redis.call('ZCARD', key)
+
+local allowed = 0
+if count < limit then
+	redis.call('ZADD', key, now, ARGV[4])
+	redis.call('PEXPIRE', key, window)
+	count = count + 1
+	allowed = 1
+end
+
+local reset = window
+local oldest = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
+if #oldest == 2 then
+	reset = window - (now - tonumber(oldest[2]))
+end
+
+return {allowed, limit - count, reset}
+`)
+
+// Redis rate limiter
+type Limiter struct {
+	client *redis.Client
+	prefix string
+}
+
+// Constructor method for Limiter. The client should be the shared Redis connection (db.Queries.Cache)
+func NewLimiter(client *redis.Client) *Limiter {
+	return &Limiter{
+		client: client,
+		prefix: "ratelimit",
+	}
+}
+
+// Check if one more request is allowed for the given key under the rule, and record it if so
+func (limiter *Limiter) Allow(ctx context.Context, key string, rule Rule) (Result, error) {
+	now := time.Now().UnixMilli()
+	bucket := fmt.Sprintf("%s:%s", limiter.prefix, key)
+
+	values, err := slidingWindowScript.Run(
+		ctx,
+		limiter.client,
+		[]string{bucket},
+		now,
+		rule.Window.Milliseconds(),
+		rule.Limit,
+		fmt.Sprintf("%d-%s", now, uuid.New().String()),
+	).Int64Slice()
+	if err != nil {
+		return Result{}, err
+	}
+
+	if len(values) != 3 {
+		return Result{}, fmt.Errorf("unexpected rate limit script result: %v", values)
+	}
+
+	result := Result{
+		Allowed:    values[0] == 1,
+		Limit:      rule.Limit,
+		Remaining:  int(max(values[1], 0)),
+		ResetAfter: time.Duration(values[2]) * time.Millisecond,
+	}
+
+	if !result.Allowed {
+		result.RetryAfter = result.ResetAfter
+	}
+
+	return result, nil
+}
+
+// Remove every recorded request of a key, for example after a successful login
+func (limiter *Limiter) Reset(ctx context.Context, key string) error {
+	return limiter.client.Del(ctx, fmt.Sprintf("%s:%s", limiter.prefix, key)).Err()
+}
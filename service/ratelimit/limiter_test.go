@@ -0,0 +1,93 @@
+package ratelimit
+
+import (
+	"context"
+	"os"
+	"strings"
+	"tekticket/util"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	ctx     = context.Background()
+	limiter *Limiter
+)
+
+func TestMain(m *testing.M) {
+	// This integration test need a running Redis, so we skip it in CI environment
+	if strings.TrimSpace(os.Getenv("CI")) != "" {
+		util.LOGGER.Warn("CI environment, skip integration test")
+		return
+	}
+
+	client := redis.NewClient(&redis.Options{Addr: os.Getenv("REDIS_ADDR")})
+	if err := client.Ping(ctx).Err(); err != nil {
+		util.LOGGER.Error("failed to connect to Redis for testing", "error", err)
+		os.Exit(1)
+	}
+
+	limiter = NewLimiter(client)
+	os.Exit(m.Run())
+}
+
+// Test: requests within the limit are allowed, the next one is rejected with a retry hint
+func TestAllow(t *testing.T) {
+	key := "test:" + util.RandomString(12)
+	rule := Rule{Limit: 3, Window: time.Minute}
+	defer limiter.Reset(ctx, key)
+
+	for i := range rule.Limit {
+		result, err := limiter.Allow(ctx, key, rule)
+		require.NoError(t, err)
+		require.True(t, result.Allowed)
+		require.Equal(t, rule.Limit-i-1, result.Remaining)
+	}
+
+	result, err := limiter.Allow(ctx, key, rule)
+	require.NoError(t, err)
+	require.False(t, result.Allowed)
+	require.Equal(t, 0, result.Remaining)
+	require.Greater(t, result.RetryAfter, time.Duration(0))
+	require.LessOrEqual(t, result.RetryAfter, rule.Window)
+}
+
+// Test: once the window slides past the old requests, new requests are allowed again
+func TestAllowAfterWindow(t *testing.T) {
+	key := "test:" + util.RandomString(12)
+	rule := Rule{Limit: 1, Window: time.Second}
+	defer limiter.Reset(ctx, key)
+
+	result, err := limiter.Allow(ctx, key, rule)
+	require.NoError(t, err)
+	require.True(t, result.Allowed)
+
+	result, err = limiter.Allow(ctx, key, rule)
+	require.NoError(t, err)
+	require.False(t, result.Allowed)
+
+	time.Sleep(result.RetryAfter + 50*time.Millisecond)
+
+	result, err = limiter.Allow(ctx, key, rule)
+	require.NoError(t, err)
+	require.True(t, result.Allowed)
+}
+
+// Test: keys are independent from each other
+func TestAllowSeparateKeys(t *testing.T) {
+	first, second := "test:"+util.RandomString(12), "test:"+util.RandomString(12)
+	rule := Rule{Limit: 1, Window: time.Minute}
+	defer limiter.Reset(ctx, first)
+	defer limiter.Reset(ctx, second)
+
+	result, err := limiter.Allow(ctx, first, rule)
+	require.NoError(t, err)
+	require.True(t, result.Allowed)
+
+	result, err = limiter.Allow(ctx, second, rule)
+	require.NoError(t, err)
+	require.True(t, result.Allowed)
+}
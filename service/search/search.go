@@ -0,0 +1,411 @@
+package search
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"tekticket/db"
+	"tekticket/util"
+	"time"
+	"unicode"
+)
+
+/*
+ * Event search. Directus filters the events by the words of the text, case-insensitively, and by the schedules, tickets
+ * and bounding box of the query. But it cannot rank a full-text match, keep the events within the radius of a bounding
+ * box, or sort by values computed from the relations of an event (nearest start time, lowest price).
+ * So the candidates are matched, scored and sorted here, and paginated after sorting, when the query needs it.
+ */
+
+// Sort orders computed by the search
+const (
+	SORT_RELEVANCE  = "relevance"
+	SORT_START_TIME = "start_time"
+	SORT_PRICE      = "price"
+	SORT_PRICE_DESC = "-price"
+	SORT_DISTANCE   = "distance"
+)
+
+// Sort orders of Directus fields, sorted by Directus, or here when the candidates are matched after Directus
+const (
+	SORT_NAME              = "name"
+	SORT_NAME_DESC         = "-name"
+	SORT_DATE_CREATED      = "date_created"
+	SORT_DATE_CREATED_DESC = "-date_created"
+)
+
+// Weights of a matched term
+const (
+	NAME_WEIGHT        = 3.0
+	DESCRIPTION_WEIGHT = 1.0
+	WORD_START_BONUS   = 1.0 // The term starts a word, "rock" in "rock night" rather than "rock" in "hardrock"
+	PHRASE_BONUS       = 5.0 // The whole text is in the name
+)
+
+// Mean radius of the Earth, in kilometers
+const EARTH_RADIUS = 6371.0
+
+// Status of the tickets and selling schedules on sale
+const PUBLISHED = "published"
+
+// A geographic point, in degrees
+type Point struct {
+	Latitude  float64
+	Longitude float64
+}
+
+// Search query. Unset filters are not applied
+type Query struct {
+	Text      string
+	From      *time.Time // Schedules starting at or after
+	To        *time.Time // Schedules starting at or before
+	MinPrice  *int
+	MaxPrice  *int
+	Available bool   // Only events with tickets on sale
+	Near      *Point // Center of the geo filter
+	Radius    float64
+}
+
+// A matched event, with the values computed for the query
+type Result struct {
+	Event     db.Event
+	Score     float64    // Relevance of the text, 0 without text
+	StartTime *time.Time // Nearest upcoming start time among the matched schedules, or the latest past one
+	MinPrice  *int       // Lowest price among the matched tickets
+	Distance  *float64   // Distance to the center, in kilometers
+}
+
+// Split a text into folded terms
+func Terms(text string) []string {
+	return strings.FieldsFunc(util.Fold(text), isSeparator)
+}
+
+// Split a text into lowercase words, with their accents, for the text filter of Directus
+func Words(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), isSeparator)
+}
+
+// Helper function: whether a rune separates the words of a text
+func isSeparator(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+}
+
+// Great-circle distance between 2 points, in kilometers
+func Distance(a, b Point) float64 {
+	lat1, lat2 := a.Latitude*math.Pi/180, b.Latitude*math.Pi/180
+	dLat := lat2 - lat1
+	dLon := (b.Longitude - a.Longitude) * math.Pi / 180
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * EARTH_RADIUS * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// Bounding box of a circle, to narrow the candidates before computing the distances: min and max latitude, min and max
+// longitude
+func BoundingBox(center Point, radius float64) (float64, float64, float64, float64) {
+	dLat := radius / EARTH_RADIUS * 180 / math.Pi
+	minLat, maxLat := max(center.Latitude-dLat, -90), min(center.Latitude+dLat, 90)
+
+	// Near the poles, every longitude is in range
+	if minLat == -90 || maxLat == 90 {
+		return minLat, maxLat, -180, 180
+	}
+
+	dLon := dLat / math.Cos(center.Latitude*math.Pi/180)
+	return minLat, maxLat, max(center.Longitude-dLon, -180), min(center.Longitude+dLon, 180)
+}
+
+// Score the terms in a name and a description. Every term must match, otherwise the score is 0
+func Score(terms []string, name, description string) float64 {
+	if len(terms) == 0 {
+		return 0
+	}
+
+	name, description = util.Fold(name), util.Fold(description)
+	score := 0.0
+	for _, term := range terms {
+		termScore := scoreTerm(term, name, NAME_WEIGHT) + scoreTerm(term, description, DESCRIPTION_WEIGHT)
+		if termScore == 0 {
+			return 0
+		}
+		score += termScore
+	}
+
+	if len(terms) > 1 && strings.Contains(name, strings.Join(terms, " ")) {
+		score += PHRASE_BONUS
+	}
+	return score
+}
+
+// Helper function: score the occurrences of a term in a folded text. Repeated occurrences count less and less
+func scoreTerm(term, text string, weight float64) float64 {
+	score := 0.0
+	occurrence := 0
+	for i := 0; ; {
+		index := strings.Index(text[i:], term)
+		if index < 0 {
+			break
+		}
+		index += i
+		occurrence++
+
+		value := weight
+		if index == 0 || !isWordRune(text[index-1]) {
+			value += WORD_START_BONUS
+		}
+		score += value / float64(occurrence)
+		i = index + len(term)
+	}
+	return score
+}
+
+// Helper function: whether a byte of a folded text belongs to a word
+func isWordRune(b byte) bool {
+	return b >= 0x80 || unicode.IsLetter(rune(b)) || unicode.IsDigit(rune(b))
+}
+
+// Match an event against a query. Return false if the event does not match
+func Match(event db.Event, query Query, now time.Time) (Result, bool) {
+	result := Result{Event: event}
+
+	if terms := Terms(query.Text); len(terms) > 0 {
+		result.Score = Score(terms, event.Name, event.Description)
+		if result.Score == 0 {
+			return result, false
+		}
+	}
+
+	if query.Near != nil {
+		if event.Latitude == nil || event.Longitude == nil {
+			return result, false
+		}
+		distance := Distance(*query.Near, Point{*event.Latitude, *event.Longitude})
+		if distance > query.Radius {
+			return result, false
+		}
+		result.Distance = &distance
+	}
+
+	// Schedules in the date range
+	for _, schedule := range event.EventSchedules {
+		if schedule.StartTime == nil {
+			continue
+		}
+		start := time.Time(*schedule.StartTime)
+		if (query.From != nil && start.Before(*query.From)) || (query.To != nil && start.After(*query.To)) {
+			continue
+		}
+		if result.StartTime == nil || nearer(start, *result.StartTime, now) {
+			result.StartTime = &start
+		}
+	}
+	if result.StartTime == nil && (query.From != nil || query.To != nil) {
+		return result, false
+	}
+
+	// Tickets in the price range
+	for _, ticket := range event.Tickets {
+		if ticket.Status != PUBLISHED {
+			continue
+		}
+		if (query.MinPrice != nil && ticket.BasePrice < *query.MinPrice) || (query.MaxPrice != nil && ticket.BasePrice > *query.MaxPrice) {
+			continue
+		}
+		if query.Available && !OnSale(ticket, now) {
+			continue
+		}
+		if result.MinPrice == nil || ticket.BasePrice < *result.MinPrice {
+			price := ticket.BasePrice
+			result.MinPrice = &price
+		}
+	}
+	if result.MinPrice == nil && (query.MinPrice != nil || query.MaxPrice != nil || query.Available) {
+		return result, false
+	}
+
+	return result, true
+}
+
+// Whether a ticket has a published selling schedule with available tickets, that has not ended
+func OnSale(ticket db.Ticket, now time.Time) bool {
+	for _, schedule := range ticket.TicketSellingSchedules {
+		if schedule.Status != PUBLISHED || schedule.Avaible <= 0 {
+			continue
+		}
+		if schedule.EndSellingTime != nil && !time.Time(*schedule.EndSellingTime).After(now) {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// Helper function: whether a start time is nearer than another. Upcoming times come first, nearest first, then past
+// times, latest first
+func nearer(a, b, now time.Time) bool {
+	aPast, bPast := a.Before(now), b.Before(now)
+	if aPast != bPast {
+		return !aPast
+	}
+	return a.Sub(now).Abs() < b.Sub(now).Abs()
+}
+
+// Whether an order is computed by the search, rather than a Directus field
+func Computed(order string) bool {
+	return slices.Contains([]string{SORT_RELEVANCE, SORT_START_TIME, SORT_PRICE, SORT_PRICE_DESC, SORT_DISTANCE}, order)
+}
+
+// Compare function of an order, or nil if the order can't be sorted by the search. Results without the sorted value
+// come last, and ties are broken by event ID, so that the order is total and a page can resume after a result
+func Comparator(order string, now time.Time) func(a, b Result) int {
+	var compare func(a, b Result) int
+	switch order {
+	case SORT_RELEVANCE:
+		compare = func(a, b Result) int { return cmp.Compare(b.Score, a.Score) }
+	case SORT_START_TIME:
+		compare = func(a, b Result) int {
+			return compareOptional(a.StartTime, b.StartTime, func(x, y time.Time) int {
+				switch {
+				case x.Equal(y):
+					return 0
+				case nearer(x, y, now):
+					return -1
+				default:
+					return 1
+				}
+			})
+		}
+	case SORT_PRICE:
+		compare = func(a, b Result) int { return compareOptional(a.MinPrice, b.MinPrice, cmp.Compare[int]) }
+	case SORT_PRICE_DESC:
+		compare = func(a, b Result) int {
+			return compareOptional(a.MinPrice, b.MinPrice, func(x, y int) int { return cmp.Compare(y, x) })
+		}
+	case SORT_DISTANCE:
+		compare = func(a, b Result) int { return compareOptional(a.Distance, b.Distance, cmp.Compare[float64]) }
+	case SORT_NAME:
+		compare = func(a, b Result) int { return cmp.Compare(a.Event.Name, b.Event.Name) }
+	case SORT_NAME_DESC:
+		compare = func(a, b Result) int { return cmp.Compare(b.Event.Name, a.Event.Name) }
+	case SORT_DATE_CREATED:
+		compare = func(a, b Result) int {
+			return compareOptional(a.Event.DateCreated, b.Event.DateCreated, compareDateTime)
+		}
+	case SORT_DATE_CREATED_DESC:
+		compare = func(a, b Result) int {
+			return compareOptional(a.Event.DateCreated, b.Event.DateCreated, func(x, y db.DateTime) int {
+				return compareDateTime(y, x)
+			})
+		}
+	default:
+		return nil
+	}
+
+	return func(a, b Result) int {
+		return cmp.Or(compare(a, b), cmp.Compare(a.Event.ID, b.Event.ID))
+	}
+}
+
+// Sort the results. Return false if the order can't be sorted by the search, and the results keep the order of Directus
+func Sort(results []Result, order string, now time.Time) bool {
+	compare := Comparator(order, now)
+	if compare == nil {
+		return false
+	}
+
+	slices.SortFunc(results, compare)
+	return true
+}
+
+// Sort key of a result in an order, empty if the result has no sorted value
+func Key(result Result, order string) string {
+	switch order {
+	case SORT_RELEVANCE:
+		return strconv.FormatFloat(result.Score, 'g', -1, 64)
+	case SORT_START_TIME:
+		if result.StartTime != nil {
+			return result.StartTime.Format(time.RFC3339Nano)
+		}
+	case SORT_PRICE, SORT_PRICE_DESC:
+		if result.MinPrice != nil {
+			return strconv.Itoa(*result.MinPrice)
+		}
+	case SORT_DISTANCE:
+		if result.Distance != nil {
+			return strconv.FormatFloat(*result.Distance, 'g', -1, 64)
+		}
+	case SORT_NAME, SORT_NAME_DESC:
+		return result.Event.Name
+	case SORT_DATE_CREATED, SORT_DATE_CREATED_DESC:
+		if result.Event.DateCreated != nil {
+			return time.Time(*result.Event.DateCreated).Format(time.RFC3339Nano)
+		}
+	}
+	return ""
+}
+
+// Resume a sorted list after the result of a sort key and an event ID, as returned by Key
+func After(results []Result, order, key, id string, now time.Time) ([]Result, error) {
+	compare := Comparator(order, now)
+	if compare == nil {
+		return nil, fmt.Errorf("order %q can't be sorted by the search", order)
+	}
+
+	pivot := Result{Event: db.Event{ID: id}}
+	if key != "" {
+		var err error
+		switch order {
+		case SORT_RELEVANCE:
+			pivot.Score, err = strconv.ParseFloat(key, 64)
+		case SORT_START_TIME:
+			var startTime time.Time
+			startTime, err = time.Parse(time.RFC3339Nano, key)
+			pivot.StartTime = &startTime
+		case SORT_PRICE, SORT_PRICE_DESC:
+			var price int
+			price, err = strconv.Atoi(key)
+			pivot.MinPrice = &price
+		case SORT_DISTANCE:
+			var distance float64
+			distance, err = strconv.ParseFloat(key, 64)
+			pivot.Distance = &distance
+		case SORT_NAME, SORT_NAME_DESC:
+			pivot.Event.Name = key
+		case SORT_DATE_CREATED, SORT_DATE_CREATED_DESC:
+			var dateCreated time.Time
+			dateCreated, err = time.Parse(time.RFC3339Nano, key)
+			pivot.Event.DateCreated = (*db.DateTime)(&dateCreated)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid sort key %q: %w", key, err)
+		}
+	}
+
+	index, _ := slices.BinarySearchFunc(results, pivot, compare)
+	if index < len(results) && compare(results[index], pivot) == 0 {
+		index++
+	}
+	return results[index:], nil
+}
+
+// Helper function: compare 2 datetimes
+func compareDateTime(x, y db.DateTime) int {
+	return time.Time(x).Compare(time.Time(y))
+}
+
+// Helper function: compare optional values, nil last
+func compareOptional[T any](a, b *T, compare func(x, y T) int) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return 1
+	case b == nil:
+		return -1
+	default:
+		return compare(*a, *b)
+	}
+}
@@ -0,0 +1,215 @@
+package search
+
+import (
+	"tekticket/db"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Helper function: build a datetime relative to now
+func at(now time.Time, offset time.Duration) *db.DateTime {
+	dt := db.DateTime(now.Add(offset))
+	return &dt
+}
+
+// Helper function: build a published ticket with a selling schedule
+func ticket(price, available int, end *db.DateTime) db.Ticket {
+	return db.Ticket{
+		BasePrice: price,
+		Status:    PUBLISHED,
+		TicketSellingSchedules: []db.TicketSellingSchedule{
+			{Avaible: available, EndSellingTime: end, Status: PUBLISHED},
+		},
+	}
+}
+
+// Test: split texts into folded terms
+func TestTerms(t *testing.T) {
+	require.Equal(t, []string{"hoa", "nhac", "2025"}, Terms("  Hòa-nhạc, 2025! "))
+	require.Empty(t, Terms(" !! "))
+
+	require.Equal(t, []string{"hòa", "nhạc", "2025"}, Words("  Hòa-nhạc, 2025! "))
+}
+
+// Test: score the terms, name matches rank above description matches
+func TestScore(t *testing.T) {
+	require.Zero(t, Score(Terms("rock jazz"), "Rock night", "Live music"))
+
+	name := Score(Terms("rock"), "Rock night", "")
+	description := Score(Terms("rock"), "Music night", "Rock bands")
+	partial := Score(Terms("rock"), "Hardrock night", "")
+	require.Greater(t, name, description)
+	require.Greater(t, name, partial)
+	require.Greater(t, partial, 0.0)
+
+	// Accents are ignored, and the phrase in the name ranks higher
+	require.Greater(t, Score(Terms("dem nhac"), "Đêm nhạc", ""), Score(Terms("nhac dem"), "Đêm nhạc", ""))
+}
+
+// Test: compute distances and bounding boxes
+func TestDistance(t *testing.T) {
+	hanoi := Point{21.0285, 105.8542}
+	saigon := Point{10.8231, 106.6297}
+	require.InDelta(t, 1140, Distance(hanoi, saigon), 10)
+	require.Zero(t, Distance(hanoi, hanoi))
+
+	minLat, maxLat, minLon, maxLon := BoundingBox(hanoi, 10)
+	require.Less(t, minLat, hanoi.Latitude)
+	require.Greater(t, maxLat, hanoi.Latitude)
+	require.InDelta(t, 10, Distance(hanoi, Point{maxLat, hanoi.Longitude}), 0.01)
+	require.InDelta(t, 10, Distance(hanoi, Point{hanoi.Latitude, maxLon}), 0.1)
+	require.Less(t, minLon, hanoi.Longitude)
+
+	_, _, minLon, maxLon = BoundingBox(Point{89.99, 0}, 10)
+	require.Equal(t, -180.0, minLon)
+	require.Equal(t, 180.0, maxLon)
+}
+
+// Test: match events against the filters
+func TestMatch(t *testing.T) {
+	now := time.Now()
+	lat, lon := 21.0285, 105.8542
+	event := db.Event{
+		Name:      "Rock night",
+		Latitude:  &lat,
+		Longitude: &lon,
+		EventSchedules: []db.EventSchedule{
+			{StartTime: at(now, -48*time.Hour)},
+			{StartTime: at(now, 72*time.Hour)},
+			{StartTime: at(now, 24*time.Hour)},
+		},
+		Tickets: []db.Ticket{
+			ticket(300, 0, at(now, time.Hour)),
+			ticket(500, 10, at(now, time.Hour)),
+			ticket(100, 10, at(now, -time.Hour)),
+			{BasePrice: 50, Status: "draft"},
+		},
+	}
+
+	// No filter: nearest upcoming schedule and lowest published price
+	result, ok := Match(event, Query{}, now)
+	require.True(t, ok)
+	require.WithinDuration(t, now.Add(24*time.Hour), *result.StartTime, time.Second)
+	require.Equal(t, 100, *result.MinPrice)
+	require.Nil(t, result.Distance)
+
+	// Date range
+	from, to := now.Add(48*time.Hour), now.Add(96*time.Hour)
+	result, ok = Match(event, Query{From: &from, To: &to}, now)
+	require.True(t, ok)
+	require.WithinDuration(t, now.Add(72*time.Hour), *result.StartTime, time.Second)
+
+	from = now.Add(100 * time.Hour)
+	_, ok = Match(event, Query{From: &from}, now)
+	require.False(t, ok)
+
+	// Price range and availability
+	minPrice, maxPrice := 200, 400
+	result, ok = Match(event, Query{MinPrice: &minPrice, MaxPrice: &maxPrice}, now)
+	require.True(t, ok)
+	require.Equal(t, 300, *result.MinPrice)
+
+	_, ok = Match(event, Query{MinPrice: &minPrice, MaxPrice: &maxPrice, Available: true}, now)
+	require.False(t, ok)
+
+	result, ok = Match(event, Query{Available: true}, now)
+	require.True(t, ok)
+	require.Equal(t, 500, *result.MinPrice)
+
+	// Text
+	_, ok = Match(event, Query{Text: "jazz"}, now)
+	require.False(t, ok)
+	result, ok = Match(event, Query{Text: "ROCK"}, now)
+	require.True(t, ok)
+	require.Greater(t, result.Score, 0.0)
+
+	// Geo
+	result, ok = Match(event, Query{Near: &Point{21.03, 105.85}, Radius: 5}, now)
+	require.True(t, ok)
+	require.Less(t, *result.Distance, 1.0)
+	_, ok = Match(event, Query{Near: &Point{10.8231, 106.6297}, Radius: 50}, now)
+	require.False(t, ok)
+	_, ok = Match(db.Event{Name: "Somewhere"}, Query{Near: &Point{21.03, 105.85}, Radius: 5}, now)
+	require.False(t, ok)
+}
+
+// Test: sort the results by the computed orders
+func TestSort(t *testing.T) {
+	now := time.Now()
+	timeAt := func(offset time.Duration) *time.Time {
+		value := now.Add(offset)
+		return &value
+	}
+	price := func(value int) *int { return &value }
+
+	results := []Result{
+		{Event: db.Event{ID: "past"}, Score: 1, StartTime: timeAt(-time.Hour), MinPrice: price(200)},
+		{Event: db.Event{ID: "none"}, Score: 3},
+		{Event: db.Event{ID: "later"}, Score: 2, StartTime: timeAt(48 * time.Hour), MinPrice: price(100)},
+		{Event: db.Event{ID: "soon"}, Score: 2, StartTime: timeAt(time.Hour), MinPrice: price(300)},
+	}
+	ids := func() []string {
+		values := []string{}
+		for _, result := range results {
+			values = append(values, result.Event.ID)
+		}
+		return values
+	}
+
+	require.True(t, Sort(results, SORT_START_TIME, now))
+	require.Equal(t, []string{"soon", "later", "past", "none"}, ids())
+
+	require.True(t, Sort(results, SORT_PRICE, now))
+	require.Equal(t, []string{"later", "past", "soon", "none"}, ids())
+
+	require.True(t, Sort(results, SORT_PRICE_DESC, now))
+	require.Equal(t, []string{"soon", "past", "later", "none"}, ids())
+
+	// Ties are broken by ID
+	require.True(t, Sort(results, SORT_RELEVANCE, now))
+	require.Equal(t, []string{"none", "later", "soon", "past"}, ids())
+
+	require.False(t, Sort(results, "status", now))
+	require.Equal(t, []string{"none", "later", "soon", "past"}, ids())
+
+	// Field orders, when the events are matched after Directus
+	results[0].Event.Name, results[1].Event.Name, results[2].Event.Name, results[3].Event.Name = "B", "D", "A", "C"
+	results[2].Event.DateCreated, results[3].Event.DateCreated = at(now, -time.Hour), at(now, -2*time.Hour)
+
+	require.True(t, Sort(results, SORT_NAME_DESC, now))
+	require.Equal(t, []string{"later", "past", "none", "soon"}, ids())
+
+	require.True(t, Sort(results, SORT_DATE_CREATED_DESC, now))
+	require.Equal(t, []string{"soon", "past", "later", "none"}, ids())
+}
+
+// Test: resume a sorted list after a result, by its sort key
+func TestAfter(t *testing.T) {
+	now := time.Now()
+	price := func(value int) *int { return &value }
+	results := []Result{
+		{Event: db.Event{ID: "a"}, MinPrice: price(100)},
+		{Event: db.Event{ID: "b"}, MinPrice: price(200)},
+		{Event: db.Event{ID: "c"}, MinPrice: price(200)},
+		{Event: db.Event{ID: "d"}},
+	}
+	Sort(results, SORT_PRICE, now)
+
+	for i, result := range results {
+		rest, err := After(results, SORT_PRICE, Key(result, SORT_PRICE), result.Event.ID, now)
+		require.NoError(t, err)
+		require.Equal(t, results[i+1:], rest)
+	}
+
+	// The last result of the previous page was deleted
+	rest, err := After(results, SORT_PRICE, "200", "bb", now)
+	require.NoError(t, err)
+	require.Equal(t, results[2:], rest)
+
+	_, err = After(results, SORT_PRICE, "cheap", "a", now)
+	require.Error(t, err)
+	_, err = After(results, "status", "", "a", now)
+	require.Error(t, err)
+}
@@ -0,0 +1,192 @@
+package seatmap
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+/*
+ * Seat map import. A file is either:
+ * - CSV, with a header line and the columns seat_number (required), row, x and y (optional, in any order)
+ * - JSON, with an array of seats, an object {"seats": [...]}, or a compact layout (see Layout)
+ * When the positions are not given, seats are placed in file order, grouped by row (see place)
+ */
+
+// Parse a seat map file, by its extension
+func Parse(filename string, data []byte) ([]Seat, error) {
+	var (
+		seats []Seat
+		err   error
+	)
+
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv":
+		seats, err = ParseCSV(bytes.NewReader(data))
+	case ".json":
+		seats, err = ParseJSON(data)
+	default:
+		return nil, invalid("unsupported file type %q, use CSV or JSON", filepath.Ext(filename))
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	return seats, Validate(seats)
+}
+
+// Parse a CSV seat map
+func ParseCSV(r io.Reader) ([]Seat, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, invalid("empty file")
+	}
+	if err != nil {
+		return nil, invalid("%s", err)
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		// Excel adds a byte order mark at the start of the file
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+
+	numberColumn, ok := columns["seat_number"]
+	if !ok {
+		return nil, invalid("missing seat_number column")
+	}
+	xColumn, hasX := columns["x"]
+	yColumn, hasY := columns["y"]
+	rowColumn, hasRow := columns["row"]
+	positioned := hasX && hasY
+
+	seats := []Seat{}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, invalid("%s", err)
+		}
+
+		line, _ := reader.FieldPos(0)
+		seat := Seat{SeatNumber: strings.TrimSpace(record[numberColumn])}
+		if hasRow {
+			seat.Row = strings.TrimSpace(record[rowColumn])
+		}
+
+		if positioned {
+			if seat.X, err = strconv.Atoi(strings.TrimSpace(record[xColumn])); err != nil {
+				return nil, invalid("line %d: invalid x", line)
+			}
+			if seat.Y, err = strconv.Atoi(strings.TrimSpace(record[yColumn])); err != nil {
+				return nil, invalid("line %d: invalid y", line)
+			}
+		}
+
+		seats = append(seats, seat)
+		if len(seats) > MAX_SEATS {
+			return nil, invalid("more than %d seats", MAX_SEATS)
+		}
+	}
+
+	if !positioned {
+		place(seats)
+	}
+	return seats, nil
+}
+
+// Parse a JSON seat map
+func ParseJSON(data []byte) ([]Seat, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return nil, invalid("empty file")
+	}
+
+	// Array of seats
+	if data[0] == '[' {
+		var seats []positionedSeat
+		if err := json.Unmarshal(data, &seats); err != nil {
+			return nil, invalid("%s", err)
+		}
+		return fromPositioned(seats), nil
+	}
+
+	// Object of seats, or layout
+	var object struct {
+		Seats []positionedSeat `json:"seats"`
+		Layout
+	}
+	if err := json.Unmarshal(data, &object); err != nil {
+		return nil, invalid("%s", err)
+	}
+
+	if object.Seats != nil {
+		return fromPositioned(object.Seats), nil
+	}
+	if object.Rows != "" {
+		return Generate(object.Layout)
+	}
+
+	return nil, invalid("expected an array of seats, an object with seats, or a layout")
+}
+
+// Seat of a JSON file, where the position is optional
+type positionedSeat struct {
+	SeatNumber string `json:"seat_number"`
+	Row        string `json:"row"`
+	X          *int   `json:"x"`
+	Y          *int   `json:"y"`
+}
+
+// Helper function: convert the seats of a JSON file, placing them if any position is missing
+func fromPositioned(items []positionedSeat) []Seat {
+	seats := make([]Seat, 0, len(items))
+	positioned := true
+	for _, item := range items {
+		seat := Seat{SeatNumber: strings.TrimSpace(item.SeatNumber), Row: strings.TrimSpace(item.Row)}
+		if item.X != nil && item.Y != nil {
+			seat.X, seat.Y = *item.X, *item.Y
+		} else {
+			positioned = false
+		}
+		seats = append(seats, seat)
+	}
+
+	if !positioned {
+		place(seats)
+	}
+	return seats
+}
+
+// Helper function: place the seats without position, in order. The row of a seat is its row column, or the letters its
+// number starts with ("AB12" is in row "AB"). Each new row goes behind the previous ones, and seats are placed from left
+// to right in their row
+func place(seats []Seat) {
+	rows := map[string]int{}
+	columns := map[string]int{}
+
+	for i := range seats {
+		if seats[i].Row == "" {
+			seats[i].Row = strings.TrimRightFunc(seats[i].SeatNumber, unicode.IsDigit)
+		}
+
+		row := seats[i].Row
+		if _, ok := rows[row]; !ok {
+			rows[row] = len(rows)
+		}
+
+		seats[i].Y = rows[row]
+		seats[i].X = columns[row]
+		columns[row]++
+	}
+}
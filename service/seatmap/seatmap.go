@@ -0,0 +1,163 @@
+package seatmap
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+/*
+ * Seat map of a seat zone: the seats to create, with their position on the map, so that frontends can draw it.
+ * Positions are grid coordinates: y is the row index from the front, x the column index from the left, counting the
+ * aisles and skipped seats as empty columns so that the rows stay aligned.
+ * A seat map is either generated from a compact layout (see Layout), or imported from a CSV or JSON file (see import.go)
+ */
+
+// Status of the generated seats
+const SEAT_STATUS_AVAILABLE = "available"
+
+// Maximum number of seats in a zone, to keep a mistyped layout from creating millions of seats
+const MAX_SEATS = 10000
+
+var ErrInvalidSeatMap = errors.New("invalid seat map")
+
+// A seat on the map
+type Seat struct {
+	SeatNumber string `json:"seat_number"`
+	Row        string `json:"row"`
+	X          int    `json:"x"`
+	Y          int    `json:"y"`
+}
+
+// Compact layout of a seat zone, like {"rows": "A-J", "seats_per_row": 20, "aisles": [5, 15], "skip": ["13", "A1"]}
+type Layout struct {
+	Rows        string   `json:"rows"`          // Row labels: ranges and single labels separated by commas, like "A-H,J-K"
+	SeatsPerRow int      `json:"seats_per_row"` // Seats are numbered from 1 to SeatsPerRow in each row
+	Aisles      []int    `json:"aisles"`        // Seat numbers followed by an aisle
+	Skip        []string `json:"skip"`          // Skipped seats: a number ("13") in every row, or a seat number ("A13")
+}
+
+// Helper function: wrap an error message into ErrInvalidSeatMap
+func invalid(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrInvalidSeatMap, fmt.Sprintf(format, args...))
+}
+
+// Parse the row labels of a layout, like "A-H,J-K" into A, B, ..., H, J, K. A range is between 2 single letters
+func ParseRows(rows string) ([]string, error) {
+	labels := []string{}
+	for part := range strings.SplitSeq(rows, ",") {
+		part = strings.ToUpper(strings.TrimSpace(part))
+		if part == "" {
+			continue
+		}
+
+		from, to, isRange := strings.Cut(part, "-")
+		if !isRange {
+			labels = append(labels, part)
+			continue
+		}
+
+		from, to = strings.TrimSpace(from), strings.TrimSpace(to)
+		if len(from) != 1 || len(to) != 1 || from[0] < 'A' || to[0] > 'Z' || from[0] > to[0] {
+			return nil, invalid("invalid row range %q", part)
+		}
+		for c := from[0]; c <= to[0]; c++ {
+			labels = append(labels, string(c))
+		}
+	}
+
+	if len(labels) == 0 {
+		return nil, invalid("no row")
+	}
+
+	for i, label := range labels {
+		if slices.Contains(labels[:i], label) {
+			return nil, invalid("duplicated row %q", label)
+		}
+	}
+
+	return labels, nil
+}
+
+// Generate the seats of a layout, row by row from the front
+func Generate(layout Layout) ([]Seat, error) {
+	rows, err := ParseRows(layout.Rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if layout.SeatsPerRow <= 0 {
+		return nil, invalid("seats per row must be greater than 0")
+	}
+	// Divided rather than multiplied, which could overflow
+	if layout.SeatsPerRow > MAX_SEATS/len(rows) {
+		return nil, invalid("more than %d seats", MAX_SEATS)
+	}
+
+	for _, aisle := range layout.Aisles {
+		if aisle <= 0 || aisle >= layout.SeatsPerRow {
+			return nil, invalid("aisle after seat %d is outside of the row", aisle)
+		}
+	}
+
+	skipped := map[string]bool{}
+	for _, skip := range layout.Skip {
+		skipped[strings.ToUpper(strings.TrimSpace(skip))] = true
+	}
+
+	seats := []Seat{}
+	for y, row := range rows {
+		x := 0
+		for number := 1; number <= layout.SeatsPerRow; number++ {
+			seatNumber := row + strconv.Itoa(number)
+			if !skipped[strconv.Itoa(number)] && !skipped[seatNumber] {
+				seats = append(seats, Seat{SeatNumber: seatNumber, Row: row, X: x, Y: y})
+			}
+
+			x++
+			if slices.Contains(layout.Aisles, number) {
+				x++
+			}
+		}
+	}
+
+	if len(seats) == 0 {
+		return nil, invalid("every seat is skipped")
+	}
+
+	return seats, nil
+}
+
+// Validate an imported seat map: every seat has a number, numbers are unique, and positions are not negative
+func Validate(seats []Seat) error {
+	if len(seats) == 0 {
+		return invalid("no seat")
+	}
+	if len(seats) > MAX_SEATS {
+		return invalid("more than %d seats", MAX_SEATS)
+	}
+
+	numbers := make(map[string]bool, len(seats))
+	positions := make(map[[2]int]string, len(seats))
+	for _, seat := range seats {
+		if seat.SeatNumber == "" {
+			return invalid("seat without number")
+		}
+		if numbers[seat.SeatNumber] {
+			return invalid("duplicated seat %q", seat.SeatNumber)
+		}
+		numbers[seat.SeatNumber] = true
+
+		if seat.X < 0 || seat.Y < 0 {
+			return invalid("seat %q has a negative position", seat.SeatNumber)
+		}
+		if other, ok := positions[[2]int{seat.X, seat.Y}]; ok {
+			return invalid("seats %q and %q are at the same position", other, seat.SeatNumber)
+		}
+		positions[[2]int{seat.X, seat.Y}] = seat.SeatNumber
+	}
+
+	return nil
+}
@@ -0,0 +1,94 @@
+package seatmap
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Test: parse row labels
+func TestParseRows(t *testing.T) {
+	rows, err := ParseRows("A-C, e ,G-H")
+	require.NoError(t, err)
+	require.Equal(t, []string{"A", "B", "C", "E", "G", "H"}, rows)
+
+	for _, invalid := range []string{"", "C-A", "A-ZZ", "A-C,B"} {
+		_, err := ParseRows(invalid)
+		require.ErrorIs(t, err, ErrInvalidSeatMap, invalid)
+	}
+}
+
+// Test: generate seats from a layout, with aisles and skipped seats
+func TestGenerate(t *testing.T) {
+	seats, err := Generate(Layout{Rows: "A-B", SeatsPerRow: 6, Aisles: []int{3}, Skip: []string{"4", "b6"}})
+	require.NoError(t, err)
+	require.NoError(t, Validate(seats))
+
+	numbers := []string{}
+	for _, seat := range seats {
+		numbers = append(numbers, seat.SeatNumber)
+	}
+	require.Equal(t, []string{"A1", "A2", "A3", "A5", "A6", "B1", "B2", "B3", "B5"}, numbers)
+
+	// The aisle and the skipped seat leave empty columns
+	require.Equal(t, Seat{SeatNumber: "A3", Row: "A", X: 2, Y: 0}, seats[2])
+	require.Equal(t, Seat{SeatNumber: "A5", Row: "A", X: 5, Y: 0}, seats[3])
+	require.Equal(t, Seat{SeatNumber: "B1", Row: "B", X: 0, Y: 1}, seats[5])
+
+	_, err = Generate(Layout{Rows: "A", SeatsPerRow: 0})
+	require.ErrorIs(t, err, ErrInvalidSeatMap)
+	_, err = Generate(Layout{Rows: "A-Z", SeatsPerRow: MAX_SEATS})
+	require.ErrorIs(t, err, ErrInvalidSeatMap)
+	_, err = Generate(Layout{Rows: "A-B", SeatsPerRow: math.MaxInt/2 + 1}) // Overflows once multiplied by the rows
+	require.ErrorIs(t, err, ErrInvalidSeatMap)
+	_, err = Generate(Layout{Rows: "A", SeatsPerRow: 5, Aisles: []int{5}})
+	require.ErrorIs(t, err, ErrInvalidSeatMap)
+}
+
+// Test: import CSV files, with and without positions
+func TestParseCSV(t *testing.T) {
+	seats, err := Parse("zone.csv", []byte("\ufeffseat_number,row,x,y\nA1,A,0,0\nA2,A,2,0\nB1,B,0,1\n"))
+	require.NoError(t, err)
+	require.Len(t, seats, 3)
+	require.Equal(t, Seat{SeatNumber: "A2", Row: "A", X: 2, Y: 0}, seats[1])
+
+	seats, err = Parse("zone.CSV", []byte("seat_number\nAA1\nAA2\nAB1\n"))
+	require.NoError(t, err)
+	require.Equal(t, Seat{SeatNumber: "AA2", Row: "AA", X: 1, Y: 0}, seats[1])
+	require.Equal(t, Seat{SeatNumber: "AB1", Row: "AB", X: 0, Y: 1}, seats[2])
+
+	testCases := map[string]string{
+		"missing column":     "number\nA1\n",
+		"invalid position":   "seat_number,x,y\nA1,one,0\n",
+		"duplicated seat":    "seat_number\nA1\nA1\n",
+		"same position":      "seat_number,x,y\nA1,0,0\nA2,0,0\n",
+		"no seat":            "seat_number\n",
+		"inconsistent lines": "seat_number,row\nA1\n",
+	}
+	for name, content := range testCases {
+		_, err := Parse("zone.csv", []byte(content))
+		require.ErrorIs(t, err, ErrInvalidSeatMap, name)
+	}
+}
+
+// Test: import JSON files, in each supported shape
+func TestParseJSON(t *testing.T) {
+	seats, err := Parse("zone.json", []byte(`[{"seat_number": "A1", "x": 0, "y": 0}, {"seat_number": "A2", "x": 1, "y": 0}]`))
+	require.NoError(t, err)
+	require.Len(t, seats, 2)
+
+	seats, err = Parse("zone.json", []byte(`{"seats": [{"seat_number": "A1"}, {"seat_number": "B1"}]}`))
+	require.NoError(t, err)
+	require.Equal(t, Seat{SeatNumber: "B1", Row: "B", X: 0, Y: 1}, seats[1])
+
+	seats, err = Parse("zone.json", []byte(`{"rows": "A-C", "seats_per_row": 10}`))
+	require.NoError(t, err)
+	require.Len(t, seats, 30)
+
+	_, err = Parse("zone.json", []byte(`{"name": "zone"}`))
+	require.ErrorIs(t, err, ErrInvalidSeatMap)
+	_, err = Parse("zone.xlsx", []byte(strings.Repeat("x", 10)))
+	require.ErrorIs(t, err, ErrInvalidSeatMap)
+}
@@ -0,0 +1,264 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"tekticket/util"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+/*
+ * Sessions as seen by the user: one per login, with the device it was made from. A session keeps its ID across token
+ * refreshes, so the user can recognize and revoke it:
+ * - sessions:{userID}:devices         : hash of session ID -> Session (JSON)
+ * - sessions:denylist:{sha256(token)} : access tokens of revoked sessions, until they expire. Unlike the revoked_at
+ *                                       timestamp, this rejects a single session without logging out the others
+ */
+
+var ErrSessionNotFound = errors.New("session not found")
+
+// Device a session was created from
+type Device struct {
+	UserAgent string
+	IP        string
+}
+
+// Session of a user
+type Session struct {
+	ID           string           `json:"id"`
+	UserAgent    string           `json:"user_agent"`
+	IP           string           `json:"ip"`
+	CreatedAt    time.Time        `json:"created_at"`
+	LastUsedAt   time.Time        `json:"last_used_at"`
+	RefreshHash  string           `json:"refresh_hash"`  // Hash of the current refresh token
+	AccessTokens map[string]int64 `json:"access_tokens"` // Hash of the access tokens not expired yet -> expiration time
+}
+
+// Check if the access token belongs to the session
+func (session *Session) Owns(accessToken string) bool {
+	_, ok := session.AccessTokens[hashToken(accessToken)]
+	return ok
+}
+
+// Helper method: remember an access token of the session, and forget the expired ones
+func (session *Session) addAccessToken(accessToken string, now time.Time) {
+	for hash, expiresAt := range session.AccessTokens {
+		if expiresAt <= now.Unix() {
+			delete(session.AccessTokens, hash)
+		}
+	}
+
+	// If the expiration can't be read, keep it for the longest a Directus access token can live
+	expiresAt, err := util.ExtractExpiresAtFromToken(accessToken)
+	if err != nil {
+		expiresAt = now.Add(SESSION_TTL)
+	}
+	session.AccessTokens[hashToken(accessToken)] = expiresAt.Unix()
+}
+
+// Helper method: save a session
+func (manager *Manager) saveSession(ctx context.Context, userID string, session *Session) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+
+	key := fmt.Sprintf("sessions:%s:devices", userID)
+	pipe := manager.client.TxPipeline()
+	pipe.HSet(ctx, key, session.ID, data)
+	pipe.Expire(ctx, key, SESSION_TTL)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// Helper method: get every session saved for the user, including the ones whose refresh token is gone
+func (manager *Manager) getSessions(ctx context.Context, userID string) ([]Session, error) {
+	values, err := manager.client.HGetAll(ctx, fmt.Sprintf("sessions:%s:devices", userID)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := make([]Session, 0, len(values))
+	for _, value := range values {
+		var session Session
+		if err := json.Unmarshal([]byte(value), &session); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions, nil
+}
+
+// Helper method: find the session holding the refresh token
+func (manager *Manager) findSession(ctx context.Context, userID, refreshToken string) (*Session, error) {
+	sessions, err := manager.getSessions(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	hash := hashToken(refreshToken)
+	for i := range sessions {
+		if sessions[i].RefreshHash == hash {
+			return &sessions[i], nil
+		}
+	}
+
+	return nil, ErrSessionNotFound
+}
+
+// Start a new session after login: track the refresh token and save the device it was issued to. Return the session ID
+func (manager *Manager) Start(ctx context.Context, userID, accessToken, refreshToken string, device Device) (string, error) {
+	if err := manager.Track(ctx, userID, refreshToken); err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	session := &Session{
+		ID:           util.RandomString(16),
+		UserAgent:    device.UserAgent,
+		IP:           device.IP,
+		CreatedAt:    now,
+		LastUsedAt:   now,
+		RefreshHash:  hashToken(refreshToken),
+		AccessTokens: map[string]int64{},
+	}
+	session.addAccessToken(accessToken, now)
+
+	return session.ID, manager.saveSession(ctx, userID, session)
+}
+
+// Move a session to the tokens issued by a refresh
+func (manager *Manager) Rotate(ctx context.Context, userID, oldRefreshToken, accessToken, refreshToken string, device Device) error {
+	if err := manager.Untrack(ctx, userID, oldRefreshToken); err != nil {
+		return err
+	}
+
+	session, err := manager.findSession(ctx, userID, oldRefreshToken)
+	if errors.Is(err, ErrSessionNotFound) {
+		// Session started before devices were recorded
+		_, err = manager.Start(ctx, userID, accessToken, refreshToken, device)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := manager.Track(ctx, userID, refreshToken); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	session.IP = device.IP
+	session.LastUsedAt = now
+	session.RefreshHash = hashToken(refreshToken)
+	session.addAccessToken(accessToken, now)
+
+	return manager.saveSession(ctx, userID, session)
+}
+
+// End a session after the user logged out with its refresh token
+func (manager *Manager) End(ctx context.Context, userID, refreshToken string) error {
+	if err := manager.Untrack(ctx, userID, refreshToken); err != nil {
+		return err
+	}
+
+	session, err := manager.findSession(ctx, userID, refreshToken)
+	if errors.Is(err, ErrSessionNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return manager.client.HDel(ctx, fmt.Sprintf("sessions:%s:devices", userID), session.ID).Err()
+}
+
+// List the active sessions of the user, most recently used first
+func (manager *Manager) List(ctx context.Context, userID string) ([]Session, error) {
+	sessions, err := manager.getSessions(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	tracked, err := manager.client.HGetAll(ctx, fmt.Sprintf("sessions:%s", userID)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	// A session whose refresh token is not tracked anymore has expired or has been logged out
+	active := make([]Session, 0, len(sessions))
+	for _, session := range sessions {
+		if _, ok := tracked[session.RefreshHash]; !ok {
+			if err := manager.client.HDel(ctx, fmt.Sprintf("sessions:%s:devices", userID), session.ID).Err(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		active = append(active, session)
+	}
+
+	sort.Slice(active, func(i, j int) bool {
+		return active[i].LastUsedAt.After(active[j].LastUsedAt)
+	})
+
+	return active, nil
+}
+
+// Revoke a single session of the user: log out its refresh token and reject its access tokens
+func (manager *Manager) Revoke(ctx context.Context, userID, sessionID string) error {
+	key := fmt.Sprintf("sessions:%s:devices", userID)
+	data, err := manager.client.HGet(ctx, key, sessionID).Bytes()
+	if err == redis.Nil {
+		return ErrSessionNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	var session Session
+	if err := json.Unmarshal(data, &session); err != nil {
+		return err
+	}
+
+	// Reject the access tokens first, like RevokeAll
+	now := time.Now()
+	for hash, expiresAt := range session.AccessTokens {
+		ttl := time.Unix(expiresAt, 0).Sub(now)
+		if ttl <= 0 {
+			continue
+		}
+		if err := manager.client.Set(ctx, fmt.Sprintf("sessions:denylist:%s", hash), userID, ttl).Err(); err != nil {
+			return err
+		}
+	}
+
+	encoded, err := manager.client.HGet(ctx, fmt.Sprintf("sessions:%s", userID), session.RefreshHash).Result()
+	if err != nil && err != redis.Nil {
+		return err
+	}
+
+	// Not tracked anymore: the refresh token has already expired or logged out
+	if err == nil {
+		if err := manager.logoutRefreshToken(ctx, userID, session.RefreshHash, encoded); err != nil {
+			return err
+		}
+	}
+
+	return manager.client.HDel(ctx, key, sessionID).Err()
+}
+
+// Helper method: check if an access token belongs to a revoked session
+func (manager *Manager) isDenied(ctx context.Context, accessToken string) (bool, error) {
+	count, err := manager.client.Exists(ctx, fmt.Sprintf("sessions:denylist:%s", hashToken(accessToken))).Result()
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
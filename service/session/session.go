@@ -0,0 +1,168 @@
+package session
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"tekticket/db"
+	"tekticket/util"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+/*
+ * Session manager: keep track of the Directus refresh tokens issued to each user, so that we can revoke them all at once
+ * (for example when the password changes). Directus doesn't expose a way to list or revoke the sessions of a user, so:
+ * - sessions:{userID}            : hash of sha256(refresh token) -> encrypted refresh token, used to log out every session
+ * - sessions:{userID}:revoked_at : unix time of the last revocation. Access tokens issued before that are rejected, since
+ *                                  Directus access tokens are stateless JWTs and stay valid until they expire
+ * Sessions of social login users are issued by us instead of Directus, see token.go. The devices of the sessions and the
+ * revocation of a single session are in device.go
+ */
+
+// How long a session is tracked. This should be at least the Directus REFRESH_TOKEN_TTL
+const SESSION_TTL = 7 * 24 * time.Hour
+
+// Session manager
+type Manager struct {
+	client       *redis.Client
+	secret       []byte
+	directusAddr string
+	staticToken  string
+}
+
+// Constructor method for session manager
+func NewManager(client *redis.Client, secret, directusAddr, staticToken string) *Manager {
+	return &Manager{
+		client:       client,
+		secret:       []byte(secret),
+		directusAddr: directusAddr,
+		staticToken:  staticToken,
+	}
+}
+
+// Helper method: hash a refresh token, so that it can be used as a lookup key
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Track a refresh token issued to the user, after login or token refresh
+func (manager *Manager) Track(ctx context.Context, userID, refreshToken string) error {
+	encrypted, err := util.Encrypt(manager.secret, []byte(refreshToken))
+	if err != nil {
+		return err
+	}
+
+	key := fmt.Sprintf("sessions:%s", userID)
+	pipe := manager.client.TxPipeline()
+	pipe.HSet(ctx, key, hashToken(refreshToken), util.Encode(string(encrypted)))
+	pipe.Expire(ctx, key, SESSION_TTL)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// Stop tracking a refresh token, after logout or when it has been rotated by a refresh
+func (manager *Manager) Untrack(ctx context.Context, userID, refreshToken string) error {
+	return manager.client.HDel(ctx, fmt.Sprintf("sessions:%s", userID), hashToken(refreshToken)).Err()
+}
+
+// Revoke every session of the user: log out every tracked refresh token in Directus, and reject every access token issued
+// before now.
+func (manager *Manager) RevokeAll(ctx context.Context, userID string) error {
+	// Reject the current access tokens first, so that even if logging out in Directus failed halfway, the user is logged out
+	now := time.Now().Unix()
+	revokedKey := fmt.Sprintf("sessions:%s:revoked_at", userID)
+	if err := manager.client.Set(ctx, revokedKey, now, SESSION_TTL).Err(); err != nil {
+		return err
+	}
+
+	key := fmt.Sprintf("sessions:%s", userID)
+	tokens, err := manager.client.HGetAll(ctx, key).Result()
+	if err != nil {
+		return err
+	}
+
+	for hash, encoded := range tokens {
+		if err := manager.logoutRefreshToken(ctx, userID, hash, encoded); err != nil {
+			return err
+		}
+	}
+
+	if err := manager.clearAccessToken(ctx, userID); err != nil {
+		return err
+	}
+
+	return manager.client.Del(ctx, fmt.Sprintf("sessions:%s:devices", userID)).Err()
+}
+
+// Helper method: log out a tracked refresh token, given its hash and encrypted value, and stop tracking it
+func (manager *Manager) logoutRefreshToken(ctx context.Context, userID, hash, encoded string) error {
+	// Refresh tokens we issued ourselves only need to be dropped, Directus doesn't know about them
+	deleted, err := manager.client.Del(ctx, fmt.Sprintf("sessions:refresh:%s", hash)).Result()
+	if err != nil {
+		return err
+	}
+
+	if deleted == 0 {
+		decoded, err := util.Decode(encoded)
+		if err != nil {
+			return err
+		}
+
+		refreshToken, err := util.Decrypt(manager.secret, []byte(decoded))
+		if err != nil {
+			return err
+		}
+
+		// If the refresh token has already expired or logged out, Directus return an error, which we don't care about
+		url := fmt.Sprintf("%s/auth/logout", manager.directusAddr)
+		body := map[string]any{"refresh_token": string(refreshToken)}
+		if status, err := db.MakeRequest("POST", url, body, manager.staticToken, nil); err != nil && !db.IsDirectusError(err) {
+			util.LOGGER.Error("failed to log out session in Directus", "user_id", userID, "status", status, "error", err)
+			return err
+		}
+	}
+
+	return manager.client.HDel(ctx, fmt.Sprintf("sessions:%s", userID), hash).Err()
+}
+
+// Check if an access token has been revoked, either with its session or with every session of the user
+func (manager *Manager) IsRevoked(ctx context.Context, accessToken string) (bool, error) {
+	if denied, err := manager.isDenied(ctx, accessToken); err != nil || denied {
+		return denied, err
+	}
+
+	// Directus never expires the static tokens of the sessions we issue, so we do
+	if issued, valid := manager.checkAccessToken(accessToken, time.Now()); issued && !valid {
+		return true, nil
+	}
+
+	userID, err := util.ExtractIDFromToken(accessToken)
+	if err != nil {
+		return false, err
+	}
+
+	issuedAt, err := util.ExtractIssuedAtFromToken(accessToken)
+	if err != nil {
+		return false, err
+	}
+
+	val, err := manager.client.Get(ctx, fmt.Sprintf("sessions:%s:revoked_at", userID)).Result()
+	if err == redis.Nil {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	revokedAt, err := strconv.ParseInt(val, 10, 64)
+	if err != nil {
+		return false, err
+	}
+
+	return issuedAt.Unix() < revokedAt, nil
+}
@@ -0,0 +1,278 @@
+package session
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+	"tekticket/db"
+	"tekticket/util"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	ctx     = context.Background()
+	manager *Manager
+)
+
+func TestMain(m *testing.M) {
+	// The integration tests need a running Redis and Directus, so they are skipped in CI environment, or when Redis is not
+	// reachable. The other tests always run
+	if strings.TrimSpace(os.Getenv("CI")) == "" {
+		client := redis.NewClient(&redis.Options{Addr: os.Getenv("REDIS_ADDR")})
+		if err := client.Ping(ctx).Err(); err != nil {
+			util.LOGGER.Warn("failed to connect to Redis for testing, skip integration tests", "error", err)
+		} else {
+			manager = NewManager(
+				client,
+				util.RandomString(32),
+				os.Getenv("DIRECTUS_ADDR"),
+				os.Getenv("DIRECTUS_STATIC_TOKEN"),
+			)
+		}
+	}
+
+	os.Exit(m.Run())
+}
+
+// Helper: skip an integration test when Redis is not available
+func requireRedis(t *testing.T) {
+	if manager == nil {
+		t.Skip("Redis is not available")
+	}
+}
+
+// Helper: create an unsigned JWT with the given user ID and issued time. Only the payload matters for the session manager
+func fakeAccessToken(userID string, issuedAt time.Time) string {
+	payload := fmt.Sprintf(`{"id":"%s","iat":%d}`, userID, issuedAt.Unix())
+	return "header." + base64.RawURLEncoding.EncodeToString([]byte(payload)) + ".signature"
+}
+
+// Test: access tokens issued before a revocation are rejected, the ones issued after are not
+func TestRevokeAll(t *testing.T) {
+	requireRedis(t)
+
+	userID := uuid.New().String()
+	before := fakeAccessToken(userID, time.Now().Add(-time.Minute))
+
+	revoked, err := manager.IsRevoked(ctx, before)
+	require.NoError(t, err)
+	require.False(t, revoked)
+
+	require.NoError(t, manager.RevokeAll(ctx, userID))
+
+	revoked, err = manager.IsRevoked(ctx, before)
+	require.NoError(t, err)
+	require.True(t, revoked)
+
+	after := fakeAccessToken(userID, time.Now().Add(time.Second))
+	revoked, err = manager.IsRevoked(ctx, after)
+	require.NoError(t, err)
+	require.False(t, revoked)
+}
+
+// Test: track and untrack refresh tokens
+func TestTrack(t *testing.T) {
+	requireRedis(t)
+
+	userID := uuid.New().String()
+	refreshToken := util.RandomString(64)
+	key := fmt.Sprintf("sessions:%s", userID)
+
+	require.NoError(t, manager.Track(ctx, userID, refreshToken))
+	count, err := manager.client.HLen(ctx, key).Result()
+	require.NoError(t, err)
+	require.Equal(t, int64(1), count)
+
+	require.NoError(t, manager.Untrack(ctx, userID, refreshToken))
+	count, err = manager.client.HLen(ctx, key).Result()
+	require.NoError(t, err)
+	require.Equal(t, int64(0), count)
+}
+
+// Helper: create a Directus user, deleted after the test. The sessions we issue set the static token of the user
+func createUser(t *testing.T) string {
+	url := fmt.Sprintf("%s/users", manager.directusAddr)
+	body := map[string]any{"email": fmt.Sprintf("%s@example.com", util.RandomString(12)), "status": "active"}
+	var user db.User
+	_, err := db.MakeRequest("POST", url, body, manager.staticToken, &user)
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		db.MakeRequest("DELETE", fmt.Sprintf("%s/users/%s", manager.directusAddr, user.ID), nil, manager.staticToken, nil)
+	})
+	return user.ID
+}
+
+// Test: sessions issued by us can be refreshed once, logged out, and are revoked with the others
+func TestIssue(t *testing.T) {
+	requireRedis(t)
+
+	userID := createUser(t)
+
+	tokens, err := manager.Issue(ctx, userID, Device{})
+	require.NoError(t, err)
+	require.Equal(t, userID, tokens.UserID)
+
+	id, err := util.ExtractIDFromToken(tokens.AccessToken)
+	require.NoError(t, err)
+	require.Equal(t, userID, id)
+
+	// Directus authenticates the user with the access token
+	var me db.User
+	_, err = db.MakeRequest("GET", fmt.Sprintf("%s/users/me?fields=id", manager.directusAddr), nil, tokens.AccessToken, &me)
+	require.NoError(t, err)
+	require.Equal(t, userID, me.ID)
+
+	// Rotation: the old refresh token can't be used again
+	refreshed, err := manager.Refresh(ctx, tokens.RefreshToken, Device{})
+	require.NoError(t, err)
+	require.NotEqual(t, tokens.RefreshToken, refreshed.RefreshToken)
+
+	_, err = manager.Refresh(ctx, tokens.RefreshToken, Device{})
+	require.ErrorIs(t, err, ErrUnknownRefreshToken)
+
+	// Logout
+	ok, err := manager.Logout(ctx, refreshed.RefreshToken)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	ok, err = manager.Logout(ctx, refreshed.RefreshToken)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	// Revocation
+	tokens, err = manager.Issue(ctx, userID, Device{})
+	require.NoError(t, err)
+	require.NoError(t, manager.RevokeAll(ctx, userID))
+
+	_, err = manager.Refresh(ctx, tokens.RefreshToken, Device{})
+	require.ErrorIs(t, err, ErrUnknownRefreshToken)
+
+	_, err = db.MakeRequest("GET", fmt.Sprintf("%s/users/me?fields=id", manager.directusAddr), nil, tokens.AccessToken, nil)
+	require.Error(t, err)
+}
+
+// Test: the access tokens we issue are rejected once tampered or expired
+func TestCheckAccessToken(t *testing.T) {
+	manager := NewManager(nil, util.RandomString(32), "", "")
+	now := time.Now()
+	userID := uuid.New().String()
+
+	token, err := manager.signAccessToken(userID, now)
+	require.NoError(t, err)
+
+	issued, valid := manager.checkAccessToken(token, now)
+	require.True(t, issued)
+	require.True(t, valid)
+
+	_, valid = manager.checkAccessToken(token, now.Add(ACCESS_TOKEN_TTL))
+	require.False(t, valid)
+
+	segments := strings.Split(token, ".")
+	forged, err := manager.signAccessToken(uuid.New().String(), now)
+	require.NoError(t, err)
+	_, valid = manager.checkAccessToken(segments[0]+"."+strings.Split(forged, ".")[1]+"."+segments[2], now)
+	require.False(t, valid)
+
+	// Directus tokens are not ours
+	issued, _ = manager.checkAccessToken(fakeAccessToken(userID, now), now)
+	require.False(t, issued)
+}
+
+// Test: while the access token of a user is replaced, the other requests don't wait for it
+func TestAccessTokenBusy(t *testing.T) {
+	requireRedis(t)
+
+	userID := uuid.New().String()
+	key := fmt.Sprintf("sessions:access:%s", userID)
+	require.NoError(t, manager.client.Set(ctx, key+":lock", 1, time.Minute).Err())
+	t.Cleanup(func() { manager.client.Del(ctx, key, key+":lock") })
+
+	// No token to use yet
+	_, _, err := manager.accessToken(ctx, userID)
+	require.ErrorIs(t, err, ErrAccessTokenBusy)
+	require.ErrorIs(t, manager.ClearExpiredAccessToken(ctx, userID), ErrAccessTokenBusy)
+
+	// The current token is used until it's replaced, even past half of its lifetime
+	current, err := manager.signAccessToken(userID, time.Now())
+	require.NoError(t, err)
+	require.NoError(t, manager.client.Set(ctx, key, current, ACCESS_TOKEN_TTL/4).Err())
+	token, ttl, err := manager.accessToken(ctx, userID)
+	require.NoError(t, err)
+	require.Equal(t, current, token)
+	require.LessOrEqual(t, ttl, ACCESS_TOKEN_TTL/4)
+
+	// A token replaced before it expired is cleared by its replacement
+	require.NoError(t, manager.client.Del(ctx, key+":lock").Err())
+	require.NoError(t, manager.ClearExpiredAccessToken(ctx, userID))
+	require.Equal(t, int64(1), manager.client.Exists(ctx, key).Val())
+}
+
+// Test: sessions keep their ID across refreshes, and can be revoked one by one
+func TestDevices(t *testing.T) {
+	requireRedis(t)
+
+	userID := createUser(t)
+	phone := Device{UserAgent: "Mozilla/5.0 (iPhone)", IP: "10.0.0.1"}
+	laptop := Device{UserAgent: "Mozilla/5.0 (Macintosh)", IP: "10.0.0.2"}
+
+	first, err := manager.Issue(ctx, userID, phone)
+	require.NoError(t, err)
+	second, err := manager.Issue(ctx, userID, laptop)
+	require.NoError(t, err)
+
+	// The sessions of a user share its static token
+	require.Equal(t, first.AccessToken, second.AccessToken)
+
+	sessions, err := manager.List(ctx, userID)
+	require.NoError(t, err)
+	require.Len(t, sessions, 2)
+
+	// Refresh: same session, new tokens
+	refreshed, err := manager.Refresh(ctx, first.RefreshToken, phone)
+	require.NoError(t, err)
+
+	sessions, err = manager.List(ctx, userID)
+	require.NoError(t, err)
+	require.Len(t, sessions, 2)
+	require.Equal(t, phone.UserAgent, sessions[0].UserAgent)
+	require.True(t, sessions[0].Owns(first.AccessToken))
+	require.True(t, sessions[0].Owns(refreshed.AccessToken))
+
+	// Revoke the phone: its access tokens are rejected. The laptop is still logged in, and gets a new one on refresh
+	require.NoError(t, manager.Revoke(ctx, userID, sessions[0].ID))
+	require.ErrorIs(t, manager.Revoke(ctx, userID, sessions[0].ID), ErrSessionNotFound)
+
+	for _, token := range []string{first.AccessToken, refreshed.AccessToken} {
+		revoked, err := manager.IsRevoked(ctx, token)
+		require.NoError(t, err)
+		require.True(t, revoked)
+	}
+
+	second, err = manager.Refresh(ctx, second.RefreshToken, laptop)
+	require.NoError(t, err)
+	require.NotEqual(t, first.AccessToken, second.AccessToken)
+
+	revoked, err := manager.IsRevoked(ctx, second.AccessToken)
+	require.NoError(t, err)
+	require.False(t, revoked)
+
+	_, err = manager.Refresh(ctx, refreshed.RefreshToken, phone)
+	require.ErrorIs(t, err, ErrUnknownRefreshToken)
+
+	// Logout ends the session
+	ok, err := manager.Logout(ctx, second.RefreshToken)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	sessions, err = manager.List(ctx, userID)
+	require.NoError(t, err)
+	require.Empty(t, sessions)
+}
@@ -0,0 +1,332 @@
+package session
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"tekticket/db"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+/*
+ * Sessions issued by us instead of Directus, for users authenticated by an external identity provider (social login).
+ * Directus can only log in a user with a password, so we impersonate the user with a Directus static token instead:
+ * - the access token is set as the static token of the user, with the admin token. It's shaped like a JWT signed with our
+ *   secret, so that the API reads its claims like the ones of a Directus access token, but its issuer is not "directus",
+ *   so that Directus looks it up as a static token instead of verifying it.
+ *   A user has a single static token, so the sessions of the user share it: sessions:access:{userID} holds the current one
+ *   until it expires, and it's replaced once past half of its lifetime, by one request at a time. The requests that come
+ *   while it's replaced keep using the current one rather than waiting. Directus never expires a static token, so the
+ *   expired ones are rejected by IsRevoked, and cleared from Directus by ClearExpiredAccessToken once they expired (a task
+ *   scheduled with the session) or by RevokeAll
+ * - the refresh token is an opaque token, stored in sessions:refresh:{sha256(refresh token)} and rotated on every use.
+ *   It is also tracked like a Directus refresh token, so that RevokeAll logs it out as well
+ */
+
+// Lifetime of the issued access tokens, same as the Directus default ACCESS_TOKEN_TTL
+const ACCESS_TOKEN_TTL = 15 * time.Minute
+
+// Issuer of the access tokens we issue, anything but "directus"
+const ACCESS_TOKEN_ISSUER = "tekticket"
+
+var (
+	ErrUnknownRefreshToken = errors.New("unknown refresh token")
+	ErrAccessTokenBusy     = errors.New("the access token of the user is being replaced")
+)
+
+// Issued session
+type Tokens struct {
+	UserID       string
+	AccessToken  string
+	RefreshToken string
+	Expires      int // Access token lifetime in milliseconds, like Directus
+}
+
+// Owner of an issued refresh token
+type refreshOwner struct {
+	UserID string `json:"user_id"`
+}
+
+// Helper method: sign an access token (HS256 JWT) for the user
+func (manager *Manager) signAccessToken(userID string, now time.Time) (string, error) {
+	header, err := json.Marshal(map[string]any{"alg": "HS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+
+	payload, err := json.Marshal(map[string]any{
+		"id":  userID,
+		"iat": now.Unix(),
+		"exp": now.Add(ACCESS_TOKEN_TTL).Unix(),
+		"iss": ACCESS_TOKEN_ISSUER,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return unsigned + "." + manager.signature(unsigned), nil
+}
+
+// Helper method: signature of an access token
+func (manager *Manager) signature(unsigned string) string {
+	mac := hmac.New(sha256.New, manager.secret)
+	mac.Write([]byte(unsigned))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Helper method: whether an access token was issued by us, and if so, whether it is genuine and not expired
+func (manager *Manager) checkAccessToken(accessToken string, now time.Time) (issued bool, valid bool) {
+	segments := strings.Split(accessToken, ".")
+	if len(segments) != 3 {
+		return false, false
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(segments[1])
+	if err != nil {
+		return false, false
+	}
+
+	var claims struct {
+		Issuer    string `json:"iss"`
+		ExpiresAt int64  `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Issuer != ACCESS_TOKEN_ISSUER {
+		return false, false
+	}
+
+	signature := manager.signature(segments[0] + "." + segments[1])
+	return true, hmac.Equal([]byte(signature), []byte(segments[2])) && now.Unix() < claims.ExpiresAt
+}
+
+// Helper method: the current access token of the user, or else a new one set as the static token of the user in Directus.
+// Return the token and its remaining lifetime. While another request replaces the token, the current one is returned if it
+// can still be used, or else ErrAccessTokenBusy
+func (manager *Manager) accessToken(ctx context.Context, userID string) (string, time.Duration, error) {
+	key := fmt.Sprintf("sessions:access:%s", userID)
+
+	current, ttl, err := manager.currentAccessToken(ctx, key)
+	if err != nil {
+		return "", 0, err
+	}
+	if ttl > ACCESS_TOKEN_TTL/2 {
+		return current, ttl, nil
+	}
+
+	// Only one request replaces the token
+	lockKey := key + ":lock"
+	locked, err := manager.client.SetNX(ctx, lockKey, 1, 10*time.Second).Result()
+	if err != nil {
+		return "", 0, err
+	}
+	if !locked {
+		if ttl > 0 {
+			return current, ttl, nil
+		}
+		return "", 0, ErrAccessTokenBusy
+	}
+	defer manager.client.Del(ctx, lockKey)
+
+	// The token may have been replaced before the lock was taken
+	current, ttl, err = manager.currentAccessToken(ctx, key)
+	if err != nil {
+		return "", 0, err
+	}
+	if ttl > ACCESS_TOKEN_TTL/2 {
+		return current, ttl, nil
+	}
+
+	accessToken, err := manager.signAccessToken(userID, time.Now())
+	if err != nil {
+		return "", 0, err
+	}
+
+	url := fmt.Sprintf("%s/users/%s", manager.directusAddr, userID)
+	if status, err := db.MakeRequest("PATCH", url, map[string]any{"token": accessToken}, manager.staticToken, nil); err != nil {
+		return "", 0, fmt.Errorf("failed to set static token of user (status %d): %w", status, err)
+	}
+
+	if err := manager.client.Set(ctx, key, accessToken, ACCESS_TOKEN_TTL).Err(); err != nil {
+		return "", 0, err
+	}
+
+	return accessToken, ACCESS_TOKEN_TTL, nil
+}
+
+// Helper method: the current access token of the user and its remaining lifetime, 0 if there is none or it's revoked
+func (manager *Manager) currentAccessToken(ctx context.Context, key string) (string, time.Duration, error) {
+	current, err := manager.client.Get(ctx, key).Result()
+	if err == redis.Nil {
+		return "", 0, nil
+	}
+	if err != nil {
+		return "", 0, err
+	}
+
+	ttl, err := manager.client.TTL(ctx, key).Result()
+	if err != nil || ttl <= 0 {
+		return "", 0, err
+	}
+	denied, err := manager.isDenied(ctx, current)
+	if err != nil || denied {
+		return "", 0, err
+	}
+	return current, ttl, nil
+}
+
+// Clear the static token of the user from Directus once their access token expired, unless it was replaced since: the
+// replacing token clears it at its own expiry. Return ErrAccessTokenBusy if the token is being replaced
+func (manager *Manager) ClearExpiredAccessToken(ctx context.Context, userID string) error {
+	key := fmt.Sprintf("sessions:access:%s", userID)
+
+	lockKey := key + ":lock"
+	locked, err := manager.client.SetNX(ctx, lockKey, 1, 10*time.Second).Result()
+	if err != nil {
+		return err
+	}
+	if !locked {
+		return ErrAccessTokenBusy
+	}
+	defer manager.client.Del(ctx, lockKey)
+
+	exists, err := manager.client.Exists(ctx, key).Result()
+	if err != nil || exists == 1 {
+		return err
+	}
+
+	url := fmt.Sprintf("%s/users/%s", manager.directusAddr, userID)
+	if status, err := db.MakeRequest("PATCH", url, map[string]any{"token": nil}, manager.staticToken, nil); err != nil {
+		return fmt.Errorf("failed to clear static token of user (status %d): %w", status, err)
+	}
+	return nil
+}
+
+// Helper method: clear the static token of the user, if we set one
+func (manager *Manager) clearAccessToken(ctx context.Context, userID string) error {
+	deleted, err := manager.client.Del(ctx, fmt.Sprintf("sessions:access:%s", userID)).Result()
+	if err != nil || deleted == 0 {
+		return err
+	}
+
+	url := fmt.Sprintf("%s/users/%s", manager.directusAddr, userID)
+	if status, err := db.MakeRequest("PATCH", url, map[string]any{"token": nil}, manager.staticToken, nil); err != nil {
+		return fmt.Errorf("failed to clear static token of user (status %d): %w", status, err)
+	}
+	return nil
+}
+
+// Helper method: get an access token and create a refresh token for the user
+func (manager *Manager) newTokens(ctx context.Context, userID string) (*Tokens, error) {
+	accessToken, ttl, err := manager.accessToken(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, err
+	}
+	refreshToken := hex.EncodeToString(raw)
+
+	owner, err := json.Marshal(refreshOwner{UserID: userID})
+	if err != nil {
+		return nil, err
+	}
+
+	key := fmt.Sprintf("sessions:refresh:%s", hashToken(refreshToken))
+	if err := manager.client.Set(ctx, key, owner, SESSION_TTL).Err(); err != nil {
+		return nil, err
+	}
+
+	return &Tokens{
+		UserID:       userID,
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		Expires:      int(ttl.Milliseconds()),
+	}, nil
+}
+
+// Issue a new session for the user, without going through Directus login
+func (manager *Manager) Issue(ctx context.Context, userID string, device Device) (*Tokens, error) {
+	tokens, err := manager.newTokens(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := manager.Start(ctx, userID, tokens.AccessToken, tokens.RefreshToken, device); err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+// Rotate a refresh token issued by us. Return ErrUnknownRefreshToken if we didn't issue it (it may be a Directus one)
+func (manager *Manager) Refresh(ctx context.Context, refreshToken string, device Device) (*Tokens, error) {
+	key := fmt.Sprintf("sessions:refresh:%s", hashToken(refreshToken))
+	var (
+		get *redis.StringCmd
+		ttl *redis.DurationCmd
+	)
+	_, err := manager.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		get = pipe.Get(ctx, key)
+		ttl = pipe.PTTL(ctx, key)
+		pipe.Del(ctx, key)
+		return nil
+	})
+	if err == redis.Nil {
+		return nil, ErrUnknownRefreshToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	data := []byte(get.Val())
+
+	var owner refreshOwner
+	if err := json.Unmarshal(data, &owner); err != nil {
+		return nil, err
+	}
+
+	tokens, err := manager.newTokens(ctx, owner.UserID)
+	if errors.Is(err, ErrAccessTokenBusy) && ttl.Val() > 0 {
+		// The refresh token can be used again once the access token is replaced
+		if restoreErr := manager.client.Set(ctx, key, data, ttl.Val()).Err(); restoreErr != nil {
+			return nil, restoreErr
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := manager.Rotate(ctx, owner.UserID, refreshToken, tokens.AccessToken, tokens.RefreshToken, device); err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+// Log out a refresh token issued by us. Return false if we didn't issue it (it may be a Directus one)
+func (manager *Manager) Logout(ctx context.Context, refreshToken string) (bool, error) {
+	data, err := manager.client.GetDel(ctx, fmt.Sprintf("sessions:refresh:%s", hashToken(refreshToken))).Bytes()
+	if err == redis.Nil {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	var owner refreshOwner
+	if err := json.Unmarshal(data, &owner); err != nil {
+		return false, err
+	}
+
+	return true, manager.End(ctx, owner.UserID, refreshToken)
+}
@@ -23,20 +23,25 @@ func NewUploader(directusAddr, directusStaticToken string) *Uploader {
 }
 
 func (uploader *Uploader) Upload(filename string, image []byte) (string, int, error) {
+	return uploader.UploadFile(filename, "image/png", image)
+}
+
+// Upload any file to Directus, return the file ID
+func (uploader *Uploader) UploadFile(filename, contentType string, data []byte) (string, int, error) {
 	body := &bytes.Buffer{}
 	writer := multipart.NewWriter(body)
 
 	// Create part with custom Content-Type header
 	h := make(textproto.MIMEHeader)
 	h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file"; filename="%s"`, filename))
-	h.Set("Content-Type", "image/png")
+	h.Set("Content-Type", contentType)
 
 	part, err := writer.CreatePart(h)
 	if err != nil {
 		return "", http.StatusInternalServerError, err
 	}
 
-	if _, err := part.Write(image); err != nil {
+	if _, err := part.Write(data); err != nil {
 		return "", http.StatusInternalServerError, err
 	}
 	writer.Close()
@@ -0,0 +1,261 @@
+package waitlist
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+/*
+ * FIFO waitlists of the sold-out ticket types, backed by Redis. Each ticket type has a queue of customers, a sorted set
+ * scored by the order of joining, and a sorted set of the offers, scored by the time (ms) they expire at. When a ticket
+ * frees up, the head of the queue is moved to the offers: the ticket is reserved for them until the offer expires. An offer
+ * that is not claimed by a booking in time is dropped, and the ticket is offered to the next in line.
+ * Moving a customer from the queue to the offers happens inside a Lua script, so that concurrent offers from multiple
+ * workers never offer the same place twice.
+ * While offers are running, a booking being created holds its tickets in a sorted set scored by the time (ms) the hold
+ * expires at, until the booking is created and the tickets are counted as sold. The tickets available beyond the reserved
+ * and held ones are checked and held in the same Lua script, so that concurrent bookings never sell a reserved ticket.
+ */
+
+// How long a booking being created holds its tickets, at most. The hold is released once the booking is created
+const BOOKING_HOLD_TTL = time.Minute
+
+var (
+	ErrAlreadyOffered  = errors.New("a ticket is already reserved for you")
+	ErrTicketsReserved = errors.New("tickets are reserved for the customers on the waitlist")
+)
+
+// KEYS[1]: queue, KEYS[2]: sequence of the queue, KEYS[3]: offers
+// ARGV[1]: customer ID, ARGV[2]: current time (ms)
+// Return: position of the customer in the queue (1 for the head), -1 if a ticket is already offered to them
+var joinScript = redis.NewScript(`
+local offer = redis.call('ZSCORE', KEYS[3], ARGV[1])
+if offer and tonumber(offer) > tonumber(ARGV[2]) then
+	return -1
+end
+
+if not redis.call('ZSCORE', KEYS[1], ARGV[1]) then
+	redis.call('ZADD', KEYS[1], redis.call('INCR', KEYS[2]), ARGV[1])
+end
+return redis.call('ZRANK', KEYS[1], ARGV[1]) + 1
+`)
+
+// KEYS[1]: queue, KEYS[2]: offers
+// ARGV[1]: expiry of the offer (ms)
+// Return: the customer offered a ticket, false if the queue is empty
+var offerScript = redis.NewScript(`
+local head = redis.call('ZPOPMIN', KEYS[1])
+if #head == 0 then
+	return false
+end
+
+redis.call('ZADD', KEYS[2], ARGV[1], head[1])
+return head[1]
+`)
+
+// KEYS[1]: offers
+// ARGV[1]: customer ID, ARGV[2]: current time (ms)
+// Return: 1 if the offer of the customer was expired and is dropped, 0 otherwise
+var expireScript = redis.NewScript(`
+local offer = redis.call('ZSCORE', KEYS[1], ARGV[1])
+if not offer or tonumber(offer) > tonumber(ARGV[2]) then
+	return 0
+end
+
+redis.call('ZREM', KEYS[1], ARGV[1])
+return 1
+`)
+
+// KEYS[1]: offers, KEYS[2]: holds of the bookings being created
+// ARGV[1]: customer ID, ARGV[2]: current time (ms), ARGV[3]: tickets available, ARGV[4]: expiry of the holds (ms),
+// ARGV[5...]: the holds of the booking, one per ticket
+// Return: {-1, 0} if the tickets are reserved, else {expiry (ms) of the offer of the customer claimed by the booking, 0 if none,
+// 1 if the tickets are held, 0 if nothing is reserved}
+var holdScript = redis.NewScript(`
+redis.call('ZREMRANGEBYSCORE', KEYS[2], '-inf', ARGV[2])
+local reserved = redis.call('ZCOUNT', KEYS[1], '(' .. ARGV[2], '+inf')
+if reserved == 0 then
+	return {0, 0}
+end
+
+local free = tonumber(ARGV[3]) - reserved - redis.call('ZCARD', KEYS[2])
+local offer = redis.call('ZSCORE', KEYS[1], ARGV[1])
+local claimed = 0
+if offer and tonumber(offer) > tonumber(ARGV[2]) then
+	claimed = tonumber(offer)
+	free = free + 1
+end
+if #ARGV - 4 > free then
+	return {-1, 0}
+end
+
+for i = 5, #ARGV do
+	redis.call('ZADD', KEYS[2], ARGV[4], ARGV[i])
+end
+if claimed > 0 then
+	redis.call('ZREM', KEYS[1], ARGV[1])
+end
+return {claimed, 1}
+`)
+
+// Tickets of a type held by a booking being created
+type Hold struct {
+	TicketID       string
+	UserID         string
+	Members        []string  // Members of the holds set, one per ticket, empty if nothing is reserved
+	OfferExpiresAt time.Time // End of the offer of the customer claimed by the booking, zero if none
+}
+
+// Redis waitlists of the ticket types
+type Queue struct {
+	client *redis.Client
+	prefix string
+}
+
+// Constructor method for Queue. The client should be the shared Redis connection (db.Queries.Cache)
+func NewQueue(client *redis.Client) *Queue {
+	return &Queue{
+		client: client,
+		prefix: "waitlist",
+	}
+}
+
+// Add a customer to the waitlist of a ticket type, if not in it yet. Return their position, 1 for the head of the queue, or
+// ErrAlreadyOffered if a ticket of the type is already reserved for them
+func (queue *Queue) Join(ctx context.Context, ticketID, userID string, now time.Time) (int, error) {
+	position, err := joinScript.Run(
+		ctx,
+		queue.client,
+		[]string{queue.queueKey(ticketID), queue.sequenceKey(ticketID), queue.offersKey(ticketID)},
+		userID,
+		now.UnixMilli(),
+	).Int()
+	if err != nil {
+		return 0, err
+	}
+	if position < 0 {
+		return 0, ErrAlreadyOffered
+	}
+	return position, nil
+}
+
+// Position of a customer in the waitlist of a ticket type, 0 if not in it
+func (queue *Queue) Position(ctx context.Context, ticketID, userID string) (int, error) {
+	rank, err := queue.client.ZRank(ctx, queue.queueKey(ticketID), userID).Result()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return int(rank) + 1, nil
+}
+
+// Reserve a ticket for the head of the waitlist of a ticket type until expiresAt. Return the customer, or "" if nobody is
+// waiting
+func (queue *Queue) Offer(ctx context.Context, ticketID string, expiresAt time.Time) (string, error) {
+	userID, err := offerScript.Run(
+		ctx,
+		queue.client,
+		[]string{queue.queueKey(ticketID), queue.offersKey(ticketID)},
+		expiresAt.UnixMilli(),
+	).Text()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return userID, err
+}
+
+// Drop the offer of a customer if it expired unclaimed at now. Return whether it was dropped, in which case its ticket is
+// free again
+func (queue *Queue) Expire(ctx context.Context, ticketID, userID string, now time.Time) (bool, error) {
+	expired, err := expireScript.Run(ctx, queue.client, []string{queue.offersKey(ticketID)}, userID, now.UnixMilli()).Int()
+	return expired == 1, err
+}
+
+// Hold count tickets of a type for the booking of a customer being created, given the tickets available on sale. While
+// offers are running, only the tickets beyond the reserved and held ones can be booked, plus the one offered to the customer,
+// whose offer is claimed by the booking. Return ErrTicketsReserved if there are not enough. The hold must be released once
+// the booking is created or failed
+func (queue *Queue) Hold(ctx context.Context, ticketID, userID, bookingID string, count, available int, now time.Time) (Hold, error) {
+	hold := Hold{TicketID: ticketID, UserID: userID}
+	args := []any{userID, now.UnixMilli(), available, now.Add(BOOKING_HOLD_TTL).UnixMilli()}
+	members := make([]string, 0, count)
+	for i := range count {
+		member := fmt.Sprintf("%s:%d", bookingID, i)
+		members = append(members, member)
+		args = append(args, member)
+	}
+
+	result, err := holdScript.Run(ctx, queue.client, []string{queue.offersKey(ticketID), queue.holdsKey(ticketID)}, args...).Int64Slice()
+	if err != nil {
+		return hold, err
+	}
+	if result[0] < 0 {
+		return hold, ErrTicketsReserved
+	}
+	if result[0] > 0 {
+		hold.OfferExpiresAt = time.UnixMilli(result[0])
+	}
+	if result[1] == 1 {
+		hold.Members = members
+	}
+	return hold, nil
+}
+
+// Release the hold of a booking. If the booking failed to be created, the offer it claimed is given back to the customer
+func (queue *Queue) Release(ctx context.Context, hold Hold, failed bool) error {
+	pipe := queue.client.TxPipeline()
+	if len(hold.Members) > 0 {
+		pipe.ZRem(ctx, queue.holdsKey(hold.TicketID), hold.Members)
+	}
+	if failed && !hold.OfferExpiresAt.IsZero() {
+		pipe.ZAdd(ctx, queue.offersKey(hold.TicketID), redis.Z{Score: float64(hold.OfferExpiresAt.UnixMilli()), Member: hold.UserID})
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Offer of a customer still running at now: whether they have one, and when it expires
+func (queue *Queue) OfferOf(ctx context.Context, ticketID, userID string, now time.Time) (bool, time.Time, error) {
+	score, err := queue.client.ZScore(ctx, queue.offersKey(ticketID), userID).Result()
+	if err == redis.Nil {
+		return false, time.Time{}, nil
+	}
+	if err != nil {
+		return false, time.Time{}, err
+	}
+	expiresAt := time.UnixMilli(int64(score))
+	return expiresAt.After(now), expiresAt, nil
+}
+
+// Number of tickets of a type reserved by the offers still running at now
+func (queue *Queue) Reserved(ctx context.Context, ticketID string, now time.Time) (int, error) {
+	from := fmt.Sprintf("(%d", now.UnixMilli()) // Exclusive
+	count, err := queue.client.ZCount(ctx, queue.offersKey(ticketID), from, "+inf").Result()
+	return int(count), err
+}
+
+// Helper method: key of the queue of a ticket type
+func (queue *Queue) queueKey(ticketID string) string {
+	return fmt.Sprintf("%s:%s:queue", queue.prefix, ticketID)
+}
+
+// Helper method: key of the sequence numbering the customers joining the queue of a ticket type
+func (queue *Queue) sequenceKey(ticketID string) string {
+	return fmt.Sprintf("%s:%s:seq", queue.prefix, ticketID)
+}
+
+// Helper method: key of the offers of a ticket type
+func (queue *Queue) offersKey(ticketID string) string {
+	return fmt.Sprintf("%s:%s:offers", queue.prefix, ticketID)
+}
+
+// Helper method: key of the tickets of a type held by the bookings being created
+func (queue *Queue) holdsKey(ticketID string) string {
+	return fmt.Sprintf("%s:%s:holds", queue.prefix, ticketID)
+}
@@ -0,0 +1,107 @@
+package waitlist
+
+import (
+	"context"
+	"os"
+	"strings"
+	"tekticket/util"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	ctx   = context.Background()
+	queue *Queue
+)
+
+func TestMain(m *testing.M) {
+	// This integration test need a running Redis, so we skip it in CI environment
+	if strings.TrimSpace(os.Getenv("CI")) != "" {
+		util.LOGGER.Warn("CI environment, skip integration test")
+		return
+	}
+
+	client := redis.NewClient(&redis.Options{Addr: os.Getenv("REDIS_ADDR")})
+	if err := client.Ping(ctx).Err(); err != nil {
+		util.LOGGER.Error("failed to connect to Redis for testing", "error", err)
+		os.Exit(1)
+	}
+
+	queue = NewQueue(client)
+	os.Exit(m.Run())
+}
+
+// Test: customers are offered the freed tickets in the order they joined, and an expired offer frees its ticket again
+func TestQueue(t *testing.T) {
+	ticketID := "test-" + util.RandomString(12)
+	defer queue.client.Del(ctx, queue.queueKey(ticketID), queue.sequenceKey(ticketID), queue.offersKey(ticketID), queue.holdsKey(ticketID))
+	now := time.Now()
+
+	for i, userID := range []string{"alice", "bob", "carol"} {
+		position, err := queue.Join(ctx, ticketID, userID, now)
+		require.NoError(t, err)
+		require.Equal(t, i+1, position)
+	}
+	position, err := queue.Join(ctx, ticketID, "alice", now) // Already in the queue
+	require.NoError(t, err)
+	require.Equal(t, 1, position)
+
+	// Offer to the head
+	userID, err := queue.Offer(ctx, ticketID, now.Add(time.Minute))
+	require.NoError(t, err)
+	require.Equal(t, "alice", userID)
+	_, err = queue.Join(ctx, ticketID, "alice", now)
+	require.ErrorIs(t, err, ErrAlreadyOffered)
+	position, err = queue.Position(ctx, ticketID, "bob")
+	require.NoError(t, err)
+	require.Equal(t, 1, position)
+	reserved, err := queue.Reserved(ctx, ticketID, now)
+	require.NoError(t, err)
+	require.Equal(t, 1, reserved)
+
+	// Not expired yet. The reserved ticket is only booked by the customer it is offered to, which claims the offer
+	expired, err := queue.Expire(ctx, ticketID, "alice", now)
+	require.NoError(t, err)
+	require.False(t, expired)
+	_, err = queue.Hold(ctx, ticketID, "dave", "booking-1", 1, 1, now)
+	require.ErrorIs(t, err, ErrTicketsReserved)
+	hold, err := queue.Hold(ctx, ticketID, "alice", "booking-2", 1, 1, now)
+	require.NoError(t, err)
+	require.False(t, hold.OfferExpiresAt.IsZero())
+	require.Len(t, hold.Members, 1)
+
+	// The booking failed: the offer is given back
+	require.NoError(t, queue.Release(ctx, hold, true))
+	reserved, err = queue.Reserved(ctx, ticketID, now)
+	require.NoError(t, err)
+	require.Equal(t, 1, reserved)
+	hold, err = queue.Hold(ctx, ticketID, "alice", "booking-3", 1, 1, now)
+	require.NoError(t, err)
+	require.NoError(t, queue.Release(ctx, hold, false))
+
+	// Unclaimed offer, dropped once expired
+	userID, err = queue.Offer(ctx, ticketID, now.Add(time.Minute))
+	require.NoError(t, err)
+	require.Equal(t, "bob", userID)
+	expired, err = queue.Expire(ctx, ticketID, "bob", now.Add(2*time.Minute))
+	require.NoError(t, err)
+	require.True(t, expired)
+	reserved, err = queue.Reserved(ctx, ticketID, now)
+	require.NoError(t, err)
+	require.Zero(t, reserved)
+
+	// Nothing reserved: nothing is held
+	hold, err = queue.Hold(ctx, ticketID, "dave", "booking-4", 2, 2, now)
+	require.NoError(t, err)
+	require.Empty(t, hold.Members)
+
+	// Empty queue
+	_, err = queue.Offer(ctx, ticketID, now.Add(time.Minute))
+	require.NoError(t, err)
+	userID, err = queue.Offer(ctx, ticketID, now.Add(time.Minute))
+	require.NoError(t, err)
+	require.Empty(t, userID)
+}
@@ -0,0 +1,310 @@
+package wallet
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"time"
+
+	"github.com/smallstep/pkcs7"
+)
+
+// Content type of the Apple Wallet passes
+const PKPASS_CONTENT_TYPE = "application/vnd.apple.pkpass"
+
+// Apple Push Notification service, which tells the devices to fetch the updated passes
+const APNS_ADDR = "https://api.push.apple.com"
+
+// Brand color of the passes
+var passColor = color.RGBA{R: 0x63, G: 0x66, B: 0xf1, A: 0xff}
+
+var ErrInvalidCertificate = errors.New("invalid pass certificate")
+
+// Apple Wallet configuration
+type AppleConfig struct {
+	PassTypeID       string // Pass type identifier, the subject of the pass certificate
+	TeamID           string
+	OrganizationName string
+	Certificate      []byte // PEM pass certificate
+	PrivateKey       []byte // PEM private key of the pass certificate
+	WWDRCertificate  []byte // PEM Apple Worldwide Developer Relations intermediate certificate
+	WebServiceURL    string // URL of the PassKit web service, without the /v1 version
+	Secret           string // Secret of the authentication tokens of the passes
+}
+
+// Apple Wallet pass signer
+type AppleWallet struct {
+	config      AppleConfig
+	certificate *x509.Certificate
+	key         crypto.PrivateKey
+	wwdr        *x509.Certificate
+	client      *http.Client // APNs client, authenticated by the pass certificate
+	apnsAddr    string
+}
+
+// Constructor method for the Apple Wallet pass signer
+func NewAppleWallet(config AppleConfig) (*AppleWallet, error) {
+	certificate, err := parseCertificate(config.Certificate)
+	if err != nil {
+		return nil, err
+	}
+	wwdr, err := parseCertificate(config.WWDRCertificate)
+	if err != nil {
+		return nil, err
+	}
+
+	keyPair, err := tls.X509KeyPair(config.Certificate, config.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidCertificate, err)
+	}
+
+	return &AppleWallet{
+		config:      config,
+		certificate: certificate,
+		key:         keyPair.PrivateKey,
+		wwdr:        wwdr,
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+			Transport: &http.Transport{
+				TLSClientConfig:   &tls.Config{Certificates: []tls.Certificate{keyPair}},
+				ForceAttemptHTTP2: true,
+			},
+		},
+		apnsAddr: APNS_ADDR,
+	}, nil
+}
+
+// Pass type identifier of the passes
+func (wallet *AppleWallet) PassTypeID() string {
+	return wallet.config.PassTypeID
+}
+
+// Check the authentication token sent by a device for a pass
+func (wallet *AppleWallet) Authenticate(serialNumber, token string) bool {
+	return hmac.Equal([]byte(token), []byte(authenticationToken(serialNumber, wallet.config.Secret)))
+}
+
+// pass.json of an event ticket
+type Pass struct {
+	FormatVersion       int            `json:"formatVersion"`
+	PassTypeIdentifier  string         `json:"passTypeIdentifier"`
+	SerialNumber        string         `json:"serialNumber"`
+	TeamIdentifier      string         `json:"teamIdentifier"`
+	OrganizationName    string         `json:"organizationName"`
+	Description         string         `json:"description"`
+	WebServiceURL       string         `json:"webServiceURL,omitempty"`
+	AuthenticationToken string         `json:"authenticationToken,omitempty"`
+	RelevantDate        string         `json:"relevantDate,omitempty"`
+	ExpirationDate      string         `json:"expirationDate,omitempty"`
+	Locations           []PassLocation `json:"locations,omitempty"`
+	Barcodes            []PassBarcode  `json:"barcodes"`
+	BackgroundColor     string         `json:"backgroundColor"`
+	ForegroundColor     string         `json:"foregroundColor"`
+	LabelColor          string         `json:"labelColor"`
+	EventTicket         PassStructure  `json:"eventTicket"`
+}
+
+type PassLocation struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+type PassBarcode struct {
+	Format          string `json:"format"`
+	Message         string `json:"message"`
+	MessageEncoding string `json:"messageEncoding"`
+}
+
+type PassStructure struct {
+	PrimaryFields   []PassField `json:"primaryFields"`
+	SecondaryFields []PassField `json:"secondaryFields,omitempty"`
+	AuxiliaryFields []PassField `json:"auxiliaryFields,omitempty"`
+	BackFields      []PassField `json:"backFields,omitempty"`
+}
+
+type PassField struct {
+	Key           string `json:"key"`
+	Label         string `json:"label,omitempty"`
+	Value         any    `json:"value"`
+	ChangeMessage string `json:"changeMessage,omitempty"` // Notification shown when the value changes, %@ is the new value
+	DateStyle     string `json:"dateStyle,omitempty"`
+	TimeStyle     string `json:"timeStyle,omitempty"`
+}
+
+// Build the pass.json of a ticket
+func (wallet *AppleWallet) Pass(ticket Ticket) Pass {
+	pass := Pass{
+		FormatVersion:       1,
+		PassTypeIdentifier:  wallet.config.PassTypeID,
+		SerialNumber:        ticket.SerialNumber,
+		TeamIdentifier:      wallet.config.TeamID,
+		OrganizationName:    wallet.config.OrganizationName,
+		Description:         "Ticket for " + ticket.EventName,
+		WebServiceURL:       wallet.config.WebServiceURL,
+		AuthenticationToken: authenticationToken(ticket.SerialNumber, wallet.config.Secret),
+		Barcodes: []PassBarcode{
+			{Format: "PKBarcodeFormatQR", Message: ticket.Barcode, MessageEncoding: "iso-8859-1"},
+		},
+		BackgroundColor: fmt.Sprintf("rgb(%d, %d, %d)", passColor.R, passColor.G, passColor.B),
+		ForegroundColor: "rgb(255, 255, 255)",
+		LabelColor:      "rgb(224, 231, 255)",
+		EventTicket: PassStructure{
+			PrimaryFields: []PassField{{Key: "event", Label: "EVENT", Value: ticket.EventName}},
+			BackFields: []PassField{
+				{Key: "venue", Label: "Venue", Value: ticket.Venue},
+				{Key: "booking", Label: "Booking", Value: ticket.BookingID},
+				{Key: "ticket", Label: "Ticket", Value: ticket.ItemID},
+			},
+		},
+	}
+
+	if ticket.Start != nil {
+		start := ticket.Start.UTC().Format(time.RFC3339)
+		pass.RelevantDate = start
+		pass.EventTicket.SecondaryFields = append(pass.EventTicket.SecondaryFields, PassField{
+			Key:           "start",
+			Label:         "STARTS",
+			Value:         start,
+			ChangeMessage: "The event now starts at %@",
+			DateStyle:     "PKDateStyleMedium",
+			TimeStyle:     "PKDateStyleShort",
+		})
+	}
+	if ticket.End != nil {
+		pass.ExpirationDate = ticket.End.Add(24 * time.Hour).UTC().Format(time.RFC3339)
+	}
+	if ticket.Seat != "" {
+		pass.EventTicket.SecondaryFields = append(pass.EventTicket.SecondaryFields, PassField{Key: "seat", Label: "SEAT", Value: ticket.Seat})
+	}
+	if ticket.Rank != "" {
+		pass.EventTicket.AuxiliaryFields = append(pass.EventTicket.AuxiliaryFields, PassField{Key: "rank", Label: "TICKET", Value: ticket.Rank})
+	}
+	if ticket.Holder != "" {
+		pass.EventTicket.AuxiliaryFields = append(pass.EventTicket.AuxiliaryFields, PassField{Key: "holder", Label: "HOLDER", Value: ticket.Holder})
+	}
+	if ticket.Latitude != nil && ticket.Longitude != nil {
+		pass.Locations = []PassLocation{{Latitude: *ticket.Latitude, Longitude: *ticket.Longitude}}
+	}
+	return pass
+}
+
+// Build the signed .pkpass bundle of a ticket: the pass, its images, the manifest of their SHA-1 hashes, and the detached
+// PKCS #7 signature of the manifest
+func (wallet *AppleWallet) Bundle(ticket Ticket) ([]byte, error) {
+	passJSON, err := json.Marshal(wallet.Pass(ticket))
+	if err != nil {
+		return nil, err
+	}
+
+	files := map[string][]byte{"pass.json": passJSON}
+	for name, size := range map[string]int{"icon.png": 29, "icon@2x.png": 58, "logo.png": 50, "logo@2x.png": 100} {
+		if files[name], err = squareImage(size); err != nil {
+			return nil, err
+		}
+	}
+
+	manifest := map[string]string{}
+	for name, data := range files {
+		sum := sha1.Sum(data)
+		manifest[name] = hex.EncodeToString(sum[:])
+	}
+	files["manifest.json"], err = json.Marshal(manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	if files["signature"], err = wallet.sign(files["manifest.json"]); err != nil {
+		return nil, err
+	}
+
+	var buffer bytes.Buffer
+	writer := zip.NewWriter(&buffer)
+	for name, data := range files {
+		file, err := writer.Create(name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := file.Write(data); err != nil {
+			return nil, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// Notify a device that its passes were updated, so that it fetches them from the web service
+func (wallet *AppleWallet) Push(ctx context.Context, pushToken string) error {
+	url := fmt.Sprintf("%s/3/device/%s", wallet.apnsAddr, pushToken)
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader([]byte("{}")))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("apns-topic", wallet.config.PassTypeID)
+	req.Header.Set("apns-push-type", "background")
+
+	resp, err := wallet.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("APNs push failed: status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Helper method: detached PKCS #7 signature of the manifest, by the pass certificate, with the WWDR certificate
+func (wallet *AppleWallet) sign(manifest []byte) ([]byte, error) {
+	signedData, err := pkcs7.NewSignedData(manifest)
+	if err != nil {
+		return nil, err
+	}
+	signedData.SetDigestAlgorithm(pkcs7.OIDDigestAlgorithmSHA256)
+	if err := signedData.AddSignerChain(wallet.certificate, wallet.key, []*x509.Certificate{wallet.wwdr}, pkcs7.SignerInfoConfig{}); err != nil {
+		return nil, err
+	}
+	signedData.Detach()
+	return signedData.Finish()
+}
+
+// Helper function: parse a PEM certificate
+func parseCertificate(data []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, ErrInvalidCertificate
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// Helper function: a square PNG of the brand color, the icon and logo of the passes
+func squareImage(size int) ([]byte, error) {
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	for x := range size {
+		for y := range size {
+			img.Set(x, y, passColor)
+		}
+	}
+
+	var buffer bytes.Buffer
+	if err := png.Encode(&buffer, img); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
@@ -0,0 +1,315 @@
+package wallet
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Google Wallet endpoints
+const (
+	GOOGLE_SAVE_URL    = "https://pay.google.com/gp/v/save/"
+	GOOGLE_WALLET_API  = "https://walletobjects.googleapis.com/walletobjects/v1"
+	GOOGLE_TOKEN_URL   = "https://oauth2.googleapis.com/token"
+	GOOGLE_API_SCOPE   = "https://www.googleapis.com/auth/wallet_object.issuer"
+	GOOGLE_SAVE_SCHEME = "savetowallet"
+)
+
+var ErrInvalidServiceAccount = errors.New("invalid Google service account key")
+
+// Google Wallet configuration
+type GoogleConfig struct {
+	IssuerID       string
+	IssuerName     string
+	ServiceAccount []byte   // JSON key of the service account
+	Origins        []string // Origins of the web pages showing the save links
+}
+
+// Google Wallet pass issuer
+type GoogleWallet struct {
+	config   GoogleConfig
+	email    string
+	key      *rsa.PrivateKey
+	tokenURL string
+	apiURL   string
+	client   *http.Client
+}
+
+// Constructor method for the Google Wallet pass issuer
+func NewGoogleWallet(config GoogleConfig) (*GoogleWallet, error) {
+	var account struct {
+		ClientEmail string `json:"client_email"`
+		PrivateKey  string `json:"private_key"`
+		TokenURI    string `json:"token_uri"`
+	}
+	if err := json.Unmarshal(config.ServiceAccount, &account); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidServiceAccount, err)
+	}
+
+	block, _ := pem.Decode([]byte(account.PrivateKey))
+	if block == nil || account.ClientEmail == "" {
+		return nil, ErrInvalidServiceAccount
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidServiceAccount, err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, ErrInvalidServiceAccount
+	}
+
+	tokenURL := account.TokenURI
+	if tokenURL == "" {
+		tokenURL = GOOGLE_TOKEN_URL
+	}
+
+	return &GoogleWallet{
+		config:   config,
+		email:    account.ClientEmail,
+		key:      key,
+		tokenURL: tokenURL,
+		apiURL:   GOOGLE_WALLET_API,
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+// Localized string of Google Wallet
+type LocalizedString struct {
+	DefaultValue TranslatedString `json:"defaultValue"`
+}
+
+type TranslatedString struct {
+	Language string `json:"language"`
+	Value    string `json:"value"`
+}
+
+// Event ticket class: the event and the schedule, shared by the passes of the schedule
+type EventTicketClass struct {
+	ID                 string          `json:"id"`
+	IssuerName         string          `json:"issuerName"`
+	ReviewStatus       string          `json:"reviewStatus"`
+	EventName          LocalizedString `json:"eventName"`
+	Venue              *EventVenue     `json:"venue,omitempty"`
+	DateTime           *EventDateTime  `json:"dateTime,omitempty"`
+	Locations          []LatLongPoint  `json:"locations,omitempty"`
+	HexBackgroundColor string          `json:"hexBackgroundColor,omitempty"`
+}
+
+type EventVenue struct {
+	Name    LocalizedString `json:"name"`
+	Address LocalizedString `json:"address"`
+}
+
+type EventDateTime struct {
+	Start string `json:"start,omitempty"`
+	End   string `json:"end,omitempty"`
+}
+
+type LatLongPoint struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// Event ticket object: the pass of a ticket
+type EventTicketObject struct {
+	ID               string           `json:"id"`
+	ClassID          string           `json:"classId"`
+	State            string           `json:"state"`
+	Barcode          Barcode          `json:"barcode"`
+	TicketHolderName string           `json:"ticketHolderName,omitempty"`
+	TicketNumber     string           `json:"ticketNumber,omitempty"`
+	TicketType       *LocalizedString `json:"ticketType,omitempty"`
+	SeatInfo         *EventSeat       `json:"seatInfo,omitempty"`
+}
+
+type Barcode struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type EventSeat struct {
+	Seat LocalizedString `json:"seat"`
+}
+
+// Build the event ticket class of the schedule of a ticket
+func (wallet *GoogleWallet) Class(ticket Ticket) EventTicketClass {
+	class := EventTicketClass{
+		ID:                 fmt.Sprintf("%s.schedule-%s", wallet.config.IssuerID, ticket.ScheduleID),
+		IssuerName:         wallet.config.IssuerName,
+		ReviewStatus:       "UNDER_REVIEW",
+		EventName:          localized(ticket.EventName),
+		HexBackgroundColor: fmt.Sprintf("#%02x%02x%02x", passColor.R, passColor.G, passColor.B),
+	}
+	if ticket.Venue != "" {
+		class.Venue = &EventVenue{Name: localized(ticket.Venue), Address: localized(ticket.Venue)}
+	}
+	if ticket.Start != nil {
+		class.DateTime = &EventDateTime{Start: ticket.Start.UTC().Format(time.RFC3339)}
+		if ticket.End != nil {
+			class.DateTime.End = ticket.End.UTC().Format(time.RFC3339)
+		}
+	}
+	if ticket.Latitude != nil && ticket.Longitude != nil {
+		class.Locations = []LatLongPoint{{Latitude: *ticket.Latitude, Longitude: *ticket.Longitude}}
+	}
+	return class
+}
+
+// Build the event ticket object of a ticket
+func (wallet *GoogleWallet) Object(ticket Ticket) EventTicketObject {
+	object := EventTicketObject{
+		ID:               fmt.Sprintf("%s.ticket-%s", wallet.config.IssuerID, ticket.SerialNumber),
+		ClassID:          wallet.Class(ticket).ID,
+		State:            "ACTIVE",
+		Barcode:          Barcode{Type: "QR_CODE", Value: ticket.Barcode},
+		TicketHolderName: ticket.Holder,
+		TicketNumber:     ticket.ItemID,
+	}
+	if ticket.Rank != "" {
+		rank := localized(ticket.Rank)
+		object.TicketType = &rank
+	}
+	if ticket.Seat != "" {
+		object.SeatInfo = &EventSeat{Seat: localized(ticket.Seat)}
+	}
+	return object
+}
+
+// Build the "Add to Google Wallet" link of a ticket: a JWT signed by the service account, embedding the class and the
+// object, which Google creates when the pass is saved
+func (wallet *GoogleWallet) SaveLink(ticket Ticket) (string, error) {
+	claims := map[string]any{
+		"iss":     wallet.email,
+		"aud":     "google",
+		"typ":     GOOGLE_SAVE_SCHEME,
+		"iat":     time.Now().Unix(),
+		"origins": wallet.config.Origins,
+		"payload": map[string]any{
+			"eventTicketClasses": []EventTicketClass{wallet.Class(ticket)},
+			"eventTicketObjects": []EventTicketObject{wallet.Object(ticket)},
+		},
+	}
+
+	token, err := signJWT(claims, wallet.key)
+	if err != nil {
+		return "", err
+	}
+	return GOOGLE_SAVE_URL + token, nil
+}
+
+// Update the class of a schedule, so that every saved pass of the schedule shows the new event and schedule. Return
+// false if no pass of the schedule was saved yet, so the class doesn't exist
+func (wallet *GoogleWallet) UpdateClass(ctx context.Context, ticket Ticket) (bool, error) {
+	accessToken, err := wallet.accessToken(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	class := wallet.Class(ticket)
+	body, err := json.Marshal(class)
+	if err != nil {
+		return false, err
+	}
+
+	endpoint := fmt.Sprintf("%s/eventTicketClass/%s", wallet.apiURL, url.PathEscape(class.ID))
+	req, err := http.NewRequestWithContext(ctx, "PUT", endpoint, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := wallet.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return false, nil
+	case resp.StatusCode >= 400:
+		return false, fmt.Errorf("update Google Wallet class: status %d", resp.StatusCode)
+	}
+	return true, nil
+}
+
+// Helper method: get an access token of the Google Wallet API for the service account
+func (wallet *GoogleWallet) accessToken(ctx context.Context) (string, error) {
+	now := time.Now()
+	assertion, err := signJWT(map[string]any{
+		"iss":   wallet.email,
+		"scope": GOOGLE_API_SCOPE,
+		"aud":   wallet.tokenURL,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	}, wallet.key)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "urn:ietf:params:oauth:grant-type:jwt-bearer")
+	form.Set("assertion", assertion)
+	req, err := http.NewRequestWithContext(ctx, "POST", wallet.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := wallet.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("get Google access token: status %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", err
+	}
+	return token.AccessToken, nil
+}
+
+// Helper function: a localized string in the default language
+func localized(value string) LocalizedString {
+	return LocalizedString{DefaultValue: TranslatedString{Language: "en-US", Value: value}}
+}
+
+// Helper function: sign the claims of a JWT with RS256
+func signJWT(claims map[string]any, key *rsa.PrivateKey) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
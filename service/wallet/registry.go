@@ -0,0 +1,148 @@
+package wallet
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+/*
+ * Registry of the devices holding Apple Wallet passes, for the PassKit web service:
+ * - wallet:devices:{deviceID}        : hash of the push token of the device
+ * - wallet:devices:{deviceID}:passes : set of the serial numbers registered by the device
+ * - wallet:passes:{serialNumber}     : set of the devices holding the pass
+ * - wallet:updated:{serialNumber}    : unix time of the last update of the pass, so that a device can fetch only the passes
+ *                                      updated since its last fetch
+ */
+
+// How long a registration is kept without activity. Passes expire a day after their event, so this outlives them
+const REGISTRATION_TTL = 365 * 24 * time.Hour
+
+// Registry of the devices holding the passes
+type Registry struct {
+	client *redis.Client
+}
+
+// Constructor method for the device registry
+func NewRegistry(client *redis.Client) *Registry {
+	return &Registry{client: client}
+}
+
+// Register a device for the updates of a pass. Return false if the device already registered the pass
+func (registry *Registry) Register(ctx context.Context, deviceID, pushToken, serialNumber string) (bool, error) {
+	deviceKey := fmt.Sprintf("wallet:devices:%s", deviceID)
+	passesKey := deviceKey + ":passes"
+	devicesKey := fmt.Sprintf("wallet:passes:%s", serialNumber)
+
+	pipe := registry.client.TxPipeline()
+	pipe.HSet(ctx, deviceKey, "push_token", pushToken)
+	added := pipe.SAdd(ctx, passesKey, serialNumber)
+	pipe.SAdd(ctx, devicesKey, deviceID)
+	for _, key := range []string{deviceKey, passesKey, devicesKey} {
+		pipe.Expire(ctx, key, REGISTRATION_TTL)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return false, err
+	}
+	return added.Val() == 1, nil
+}
+
+// Unregister a device from the updates of a pass, once the pass is removed from the device
+func (registry *Registry) Unregister(ctx context.Context, deviceID, serialNumber string) error {
+	pipe := registry.client.TxPipeline()
+	pipe.SRem(ctx, fmt.Sprintf("wallet:devices:%s:passes", deviceID), serialNumber)
+	pipe.SRem(ctx, fmt.Sprintf("wallet:passes:%s", serialNumber), deviceID)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Unregister every device holding a pass, once the pass is revoked: its ticket was reissued to another holder
+func (registry *Registry) Revoke(ctx context.Context, serialNumber string) error {
+	devicesKey := fmt.Sprintf("wallet:passes:%s", serialNumber)
+	deviceIDs, err := registry.client.SMembers(ctx, devicesKey).Result()
+	if err != nil {
+		return err
+	}
+
+	pipe := registry.client.TxPipeline()
+	for _, deviceID := range deviceIDs {
+		pipe.SRem(ctx, fmt.Sprintf("wallet:devices:%s:passes", deviceID), serialNumber)
+	}
+	pipe.Del(ctx, devicesKey, fmt.Sprintf("wallet:updated:%s", serialNumber))
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// List the passes registered by a device that were updated after the given unix time (0 for every pass), with the time of
+// the latest update
+func (registry *Registry) UpdatedPasses(ctx context.Context, deviceID string, since int64) ([]string, int64, error) {
+	serialNumbers, err := registry.client.SMembers(ctx, fmt.Sprintf("wallet:devices:%s:passes", deviceID)).Result()
+	if err != nil || len(serialNumbers) == 0 {
+		return nil, 0, err
+	}
+
+	var (
+		updated = []string{}
+		latest  int64
+	)
+	for _, serialNumber := range serialNumbers {
+		updatedAt, err := registry.LastUpdated(ctx, serialNumber)
+		if err != nil {
+			return nil, 0, err
+		}
+		if updatedAt > since || since == 0 {
+			updated = append(updated, serialNumber)
+		}
+		latest = max(latest, updatedAt)
+	}
+	return updated, latest, nil
+}
+
+// Unix time of the last update of a pass, 0 if it was never updated since it was issued
+func (registry *Registry) LastUpdated(ctx context.Context, serialNumber string) (int64, error) {
+	value, err := registry.client.Get(ctx, fmt.Sprintf("wallet:updated:%s", serialNumber)).Result()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(value, 10, 64)
+}
+
+// Mark the passes as updated now, and return the push tokens of the devices holding them
+func (registry *Registry) MarkUpdated(ctx context.Context, serialNumbers ...string) ([]string, error) {
+	now := time.Now().Unix()
+
+	var pushTokens []string
+	seen := map[string]bool{}
+	for _, serialNumber := range serialNumbers {
+		if err := registry.client.Set(ctx, fmt.Sprintf("wallet:updated:%s", serialNumber), now, REGISTRATION_TTL).Err(); err != nil {
+			return nil, err
+		}
+
+		deviceIDs, err := registry.client.SMembers(ctx, fmt.Sprintf("wallet:passes:%s", serialNumber)).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, deviceID := range deviceIDs {
+			if seen[deviceID] {
+				continue
+			}
+			seen[deviceID] = true
+
+			pushToken, err := registry.client.HGet(ctx, fmt.Sprintf("wallet:devices:%s", deviceID), "push_token").Result()
+			if err == redis.Nil {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			pushTokens = append(pushTokens, pushToken)
+		}
+	}
+	return pushTokens, nil
+}
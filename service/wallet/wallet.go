@@ -0,0 +1,202 @@
+package wallet
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"tekticket/db"
+	"tekticket/util"
+	"time"
+)
+
+/*
+ * Phone wallet passes of tickets. A booking item is issued as an Apple Wallet pass (a signed .pkpass bundle) or as a
+ * Google Wallet save link (a signed JWT embedding the pass). Both carry the check-in URL of the ticket QR as their barcode.
+ * Passes follow the schedule of their event:
+ * - Apple Wallet registers the devices holding a pass through the PassKit web service, and fetches the latest pass when
+ *   it is notified by a push
+ * - Google Wallet passes share a class per schedule, so updating the class updates every pass of the schedule
+ */
+
+// Wallet types
+const (
+	APPLE  = "apple"
+	GOOGLE = "google"
+)
+
+// Ticket shown on a pass
+type Ticket struct {
+	SerialNumber string // Booking item ID, with the fingerprint of its check-in token
+	ItemID       string
+	BookingID    string
+	ScheduleID   string
+	EventName    string
+	Venue        string
+	Latitude     *float64
+	Longitude    *float64
+	Start        *time.Time
+	End          *time.Time
+	Rank         string
+	Seat         string
+	Holder       string
+	Price        int
+	Barcode      string // Check-in URL, the content of the ticket QR
+}
+
+// Build the ticket of a booking item. The item must include its booking with the event and the customer, its schedule,
+// ticket and seat
+func NewTicket(item db.BookingItem, barcode string) Ticket {
+	ticket := Ticket{SerialNumber: SerialNumber(item.ID, item.CheckinToken), ItemID: item.ID, Price: item.Price, Barcode: barcode}
+
+	if item.Booking != nil {
+		ticket.BookingID = item.Booking.ID
+		if item.Booking.Customer != nil {
+			ticket.Holder = strings.TrimSpace(item.Booking.Customer.FirstName + " " + item.Booking.Customer.LastName)
+		}
+		if item.Booking.Event != nil {
+			setEvent(&ticket, *item.Booking.Event)
+		}
+	}
+	if item.EventSchedule != nil {
+		setSchedule(&ticket, *item.EventSchedule)
+	}
+	if item.Ticket != nil {
+		ticket.Rank = item.Ticket.Rank
+	}
+	if item.Seat != nil {
+		ticket.Seat = item.Seat.SeatNumber
+		if item.Seat.Row != "" {
+			ticket.Seat = fmt.Sprintf("Row %s, seat %s", item.Seat.Row, item.Seat.SeatNumber)
+		}
+	}
+	return ticket
+}
+
+// Serial number of the pass of a booking item: the item ID with a fingerprint of its check-in token. The token is rotated
+// when the ticket is reissued to another holder, so the new pass gets a new serial number, and the pass of the previous
+// holder (with its authentication token) is never updated with the new token. Items issued before the check-in tokens
+// were stored keep their ID
+func SerialNumber(itemID, checkinToken string) string {
+	if checkinToken == "" {
+		return itemID
+	}
+	sum := sha256.Sum256([]byte("wallet#" + checkinToken))
+	return itemID + "." + hex.EncodeToString(sum[:8])
+}
+
+// Booking item ID of the serial number of a pass
+func ItemID(serialNumber string) string {
+	itemID, _, _ := strings.Cut(serialNumber, ".")
+	return itemID
+}
+
+// Build the part of a ticket shared by every pass of a schedule: the event and the schedule
+func NewScheduleTicket(event db.Event, schedule db.EventSchedule) Ticket {
+	var ticket Ticket
+	setEvent(&ticket, event)
+	setSchedule(&ticket, schedule)
+	return ticket
+}
+
+// Helper function: set the event of a ticket
+func setEvent(ticket *Ticket, event db.Event) {
+	venue := make([]string, 0, 3)
+	for _, part := range []string{event.Address, event.City, event.Country} {
+		if part = strings.TrimSpace(part); part != "" {
+			venue = append(venue, part)
+		}
+	}
+
+	ticket.EventName = event.Name
+	ticket.Venue = strings.Join(venue, ", ")
+	ticket.Latitude = event.Latitude
+	ticket.Longitude = event.Longitude
+}
+
+// Helper function: set the schedule of a ticket
+func setSchedule(ticket *Ticket, schedule db.EventSchedule) {
+	ticket.ScheduleID = schedule.ID
+	if schedule.StartTime != nil {
+		start := time.Time(*schedule.StartTime)
+		ticket.Start = &start
+	}
+	if schedule.EndTime != nil {
+		end := time.Time(*schedule.EndTime)
+		ticket.End = &end
+	}
+}
+
+// Issuer of the passes. A wallet is nil when it is not configured
+type Issuer struct {
+	Apple  *AppleWallet
+	Google *GoogleWallet
+}
+
+// Constructor method for the pass issuer, with the wallets configured in the static config. A wallet that fails to load
+// is disabled, so that a wrong certificate doesn't prevent the server from starting
+func NewIssuer(config *util.Config) *Issuer {
+	issuer := &Issuer{}
+
+	if config.AppleWalletPassTypeID != "" {
+		apple, err := loadAppleWallet(config)
+		if err != nil {
+			util.LOGGER.Error("failed to load Apple Wallet certificates, Apple Wallet passes are disabled", "error", err)
+		} else {
+			issuer.Apple = apple
+		}
+	}
+
+	if config.GoogleWalletIssuerID != "" {
+		serviceAccount, err := os.ReadFile(config.GoogleWalletServiceAccount)
+		if err == nil {
+			issuer.Google, err = NewGoogleWallet(GoogleConfig{
+				IssuerID:       config.GoogleWalletIssuerID,
+				IssuerName:     WALLET_ORGANIZATION,
+				ServiceAccount: serviceAccount,
+				Origins:        []string{config.ServerDomain},
+			})
+		}
+		if err != nil {
+			util.LOGGER.Error("failed to load Google Wallet service account, Google Wallet passes are disabled", "error", err)
+		}
+	}
+
+	return issuer
+}
+
+// Helper function: load the Apple Wallet certificates from the files of the static config
+func loadAppleWallet(config *util.Config) (*AppleWallet, error) {
+	files := map[string][]byte{}
+	for _, path := range []string{config.AppleWalletCertificate, config.AppleWalletPrivateKey, config.AppleWalletWWDRCertificate} {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		files[path] = data
+	}
+
+	return NewAppleWallet(AppleConfig{
+		PassTypeID:       config.AppleWalletPassTypeID,
+		TeamID:           config.AppleWalletTeamID,
+		OrganizationName: WALLET_ORGANIZATION,
+		Certificate:      files[config.AppleWalletCertificate],
+		PrivateKey:       files[config.AppleWalletPrivateKey],
+		WWDRCertificate:  files[config.AppleWalletWWDRCertificate],
+		WebServiceURL:    config.ServerDomain + "/api/wallet",
+		Secret:           config.SecretKey,
+	})
+}
+
+// Organization shown on the passes
+const WALLET_ORGANIZATION = "Tekticket"
+
+// Helper function: the authentication token of a pass, derived from its serial number so that it needs no storage. Since
+// the serial number carries the fingerprint of the check-in token, the authentication token is bound to it
+func authenticationToken(serialNumber, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("wallet#" + serialNumber))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,286 @@
+package wallet
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"tekticket/db"
+	"testing"
+	"time"
+
+	"github.com/smallstep/pkcs7"
+	"github.com/stretchr/testify/require"
+)
+
+// Helper function: build a ticket of a booking item
+func testTicket(t *testing.T) Ticket {
+	start := db.DateTime(time.Date(2025, 12, 31, 20, 0, 0, 0, time.UTC))
+	end := db.DateTime(time.Date(2025, 12, 31, 23, 0, 0, 0, time.UTC))
+	lat, lon := 21.0285, 105.8542
+
+	ticket := NewTicket(db.BookingItem{
+		ID:           "item-1",
+		Price:        500000,
+		CheckinToken: "token-1",
+		Booking: &db.Booking{
+			ID:       "booking-1",
+			Customer: &db.User{FirstName: "John", LastName: "Doe"},
+			Event:    &db.Event{Name: "Countdown", Address: "1 Trang Tien", City: "Hanoi", Latitude: &lat, Longitude: &lon},
+		},
+		EventSchedule: &db.EventSchedule{ID: "schedule-1", StartTime: &start, EndTime: &end},
+		Ticket:        &db.Ticket{Rank: "VIP"},
+		Seat:          &db.Seat{Row: "A", SeatNumber: "A1"},
+	}, "https://tekticket.com/checkin?token=abc")
+
+	require.Equal(t, "John Doe", ticket.Holder)
+	require.Equal(t, "1 Trang Tien, Hanoi", ticket.Venue)
+	require.Equal(t, "Row A, seat A1", ticket.Seat)
+	require.Equal(t, "schedule-1", ticket.ScheduleID)
+	return ticket
+}
+
+// Helper function: generate a test WWDR certificate, and a pass certificate issued by it
+func testCertificates(t *testing.T) (certPEM, keyPEM, wwdrPEM []byte) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test WWDR"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	require.NoError(t, err)
+	ca, err := x509.ParseCertificate(caDER)
+	require.NoError(t, err)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "Pass Type ID: pass.com.tekticket.test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+	require.NoError(t, err)
+
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	wwdrPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER})
+	return certPEM, keyPEM, wwdrPEM
+}
+
+// Test: build a signed .pkpass bundle
+func TestAppleBundle(t *testing.T) {
+	certPEM, keyPEM, wwdrPEM := testCertificates(t)
+	wallet, err := NewAppleWallet(AppleConfig{
+		PassTypeID:       "pass.com.tekticket.test",
+		TeamID:           "TEAM123456",
+		OrganizationName: "Tekticket",
+		Certificate:      certPEM,
+		PrivateKey:       keyPEM,
+		WWDRCertificate:  wwdrPEM,
+		WebServiceURL:    "https://api.tekticket.com/api/wallet",
+		Secret:           "secret",
+	})
+	require.NoError(t, err)
+
+	ticket := testTicket(t)
+	bundle, err := wallet.Bundle(ticket)
+	require.NoError(t, err)
+
+	// Read the files of the bundle
+	reader, err := zip.NewReader(bytes.NewReader(bundle), int64(len(bundle)))
+	require.NoError(t, err)
+	files := map[string][]byte{}
+	for _, file := range reader.File {
+		content, err := file.Open()
+		require.NoError(t, err)
+		files[file.Name], err = io.ReadAll(content)
+		require.NoError(t, err)
+	}
+	require.Contains(t, files, "pass.json")
+	require.Contains(t, files, "icon.png")
+
+	// The pass embeds the check-in URL, and authenticates its devices
+	var pass Pass
+	require.NoError(t, json.Unmarshal(files["pass.json"], &pass))
+	require.Equal(t, ticket.Barcode, pass.Barcodes[0].Message)
+	require.Equal(t, SerialNumber("item-1", "token-1"), pass.SerialNumber)
+	require.Equal(t, "item-1", ItemID(pass.SerialNumber))
+	require.Equal(t, "2025-12-31T20:00:00Z", pass.RelevantDate)
+	require.True(t, wallet.Authenticate(pass.SerialNumber, pass.AuthenticationToken))
+	require.False(t, wallet.Authenticate("item-2", pass.AuthenticationToken))
+
+	// A reissued ticket gets a new serial number, which the token of the previous pass doesn't authenticate
+	require.NotEqual(t, pass.SerialNumber, SerialNumber("item-1", "token-2"))
+	require.False(t, wallet.Authenticate(SerialNumber("item-1", "token-2"), pass.AuthenticationToken))
+	require.Equal(t, "item-1", SerialNumber("item-1", ""))
+
+	// The manifest lists the SHA-1 of every other file
+	var manifest map[string]string
+	require.NoError(t, json.Unmarshal(files["manifest.json"], &manifest))
+	require.Len(t, manifest, len(files)-2)
+	for name, hash := range manifest {
+		sum := sha1.Sum(files[name])
+		require.Equal(t, hex.EncodeToString(sum[:]), hash, name)
+	}
+
+	// The signature is a detached signature of the manifest, by the pass certificate, including the WWDR certificate
+	p7, err := pkcs7.Parse(files["signature"])
+	require.NoError(t, err)
+	p7.Content = files["manifest.json"]
+	require.NoError(t, p7.Verify())
+	require.Len(t, p7.Certificates, 2)
+
+	p7.Content = []byte(`{"pass.json":"tampered"}`)
+	require.Error(t, p7.Verify())
+
+	// A certificate without its key is rejected
+	_, err = NewAppleWallet(AppleConfig{Certificate: certPEM, PrivateKey: []byte("nope"), WWDRCertificate: wwdrPEM})
+	require.ErrorIs(t, err, ErrInvalidCertificate)
+}
+
+// Test: notify a device through APNs
+func TestApplePush(t *testing.T) {
+	certPEM, keyPEM, wwdrPEM := testCertificates(t)
+	wallet, err := NewAppleWallet(AppleConfig{PassTypeID: "pass.com.tekticket.test", Certificate: certPEM, PrivateKey: keyPEM, WWDRCertificate: wwdrPEM})
+	require.NoError(t, err)
+
+	var topic, path string
+	apns := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		topic, path = r.Header.Get("apns-topic"), r.URL.Path
+		if strings.HasSuffix(r.URL.Path, "/expired") {
+			w.WriteHeader(http.StatusGone)
+		}
+	}))
+	defer apns.Close()
+	wallet.apnsAddr = apns.URL
+	wallet.client = apns.Client()
+
+	require.NoError(t, wallet.Push(context.Background(), "token"))
+	require.Equal(t, "pass.com.tekticket.test", topic)
+	require.Equal(t, "/3/device/token", path)
+	require.Error(t, wallet.Push(context.Background(), "expired"))
+}
+
+// Helper function: generate a test service account key
+func testServiceAccount(t *testing.T, tokenURI string) ([]byte, *rsa.PrivateKey) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	account, err := json.Marshal(map[string]string{
+		"client_email": "wallet@tekticket.iam.gserviceaccount.com",
+		"private_key":  string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"token_uri":    tokenURI,
+	})
+	require.NoError(t, err)
+	return account, key
+}
+
+// Helper function: verify a JWT signed with RS256, and return its claims
+func verifyJWT(t *testing.T, token string, key *rsa.PublicKey) map[string]any {
+	segments := strings.Split(token, ".")
+	require.Len(t, segments, 3)
+
+	signature, err := base64.RawURLEncoding.DecodeString(segments[2])
+	require.NoError(t, err)
+	digest := sha256.Sum256([]byte(segments[0] + "." + segments[1]))
+	require.NoError(t, rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature))
+
+	payload, err := base64.RawURLEncoding.DecodeString(segments[1])
+	require.NoError(t, err)
+	var claims map[string]any
+	require.NoError(t, json.Unmarshal(payload, &claims))
+	return claims
+}
+
+// Test: build a Google Wallet save link
+func TestGoogleSaveLink(t *testing.T) {
+	account, key := testServiceAccount(t, "")
+	wallet, err := NewGoogleWallet(GoogleConfig{IssuerID: "3388000000012345678", IssuerName: "Tekticket", ServiceAccount: account})
+	require.NoError(t, err)
+
+	ticket := testTicket(t)
+	link, err := wallet.SaveLink(ticket)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(link, GOOGLE_SAVE_URL))
+
+	claims := verifyJWT(t, strings.TrimPrefix(link, GOOGLE_SAVE_URL), &key.PublicKey)
+	require.Equal(t, "google", claims["aud"])
+	require.Equal(t, GOOGLE_SAVE_SCHEME, claims["typ"])
+
+	payload := claims["payload"].(map[string]any)
+	object := payload["eventTicketObjects"].([]any)[0].(map[string]any)
+	require.Equal(t, "3388000000012345678.ticket-"+SerialNumber("item-1", "token-1"), object["id"])
+	require.Equal(t, "3388000000012345678.schedule-schedule-1", object["classId"])
+	require.Equal(t, ticket.Barcode, object["barcode"].(map[string]any)["value"])
+
+	_, err = NewGoogleWallet(GoogleConfig{ServiceAccount: []byte(`{"client_email":"a@b.c"}`)})
+	require.ErrorIs(t, err, ErrInvalidServiceAccount)
+}
+
+// Test: update the class of a schedule through the Google Wallet API
+func TestGoogleUpdateClass(t *testing.T) {
+	var (
+		account []byte
+		key     *rsa.PrivateKey
+		class   EventTicketClass
+	)
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/token":
+			require.NoError(t, r.ParseForm())
+			claims := verifyJWT(t, r.Form.Get("assertion"), &key.PublicKey)
+			require.Equal(t, GOOGLE_API_SCOPE, claims["scope"])
+			json.NewEncoder(w).Encode(map[string]string{"access_token": "access"})
+		case strings.HasSuffix(r.URL.Path, ".schedule-missing"):
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			require.Equal(t, "Bearer access", r.Header.Get("Authorization"))
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&class))
+		}
+	}))
+	defer api.Close()
+
+	account, key = testServiceAccount(t, api.URL+"/token")
+	wallet, err := NewGoogleWallet(GoogleConfig{IssuerID: "3388000000012345678", ServiceAccount: account})
+	require.NoError(t, err)
+	wallet.apiURL = api.URL
+
+	ticket := testTicket(t)
+	updated, err := wallet.UpdateClass(context.Background(), ticket)
+	require.NoError(t, err)
+	require.True(t, updated)
+	require.Equal(t, "2025-12-31T20:00:00Z", class.DateTime.Start)
+
+	ticket.ScheduleID = "missing"
+	updated, err = wallet.UpdateClass(context.Background(), ticket)
+	require.NoError(t, err)
+	require.False(t, updated)
+}
@@ -0,0 +1,567 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	neturl "net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"tekticket/db"
+	"tekticket/service/payment"
+	"tekticket/util"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"github.com/redis/go-redis/v9"
+	"github.com/stripe/stripe-go/v82"
+)
+
+/*
+ * Event cancellation: every successful payment of a canceled event is refunded in full by its own task, so that a failed
+ * refund is retried alone. The refund tasks are scheduled in batches, to stay below the rate limits of Stripe and Directus.
+ * Each refund task:
+ * 1. refunds what is left of the payment in Stripe, with an idempotency key so that a retry never refunds twice
+ * 2. marks the tickets of the booking as refunded and the booking as canceled
+ * 3. notifies the customer through every channel
+ * The tickets received by a transfer are in bookings of their own, without a payment: the refund goes to the payment of the
+ * sender, and a task per such booking invalidates its tickets and notifies its holder.
+ * A payment succeeding after the event was canceled is refunded the same way, scheduled by the booking confirmation.
+ * The resale listings of the event are canceled beforehand. The progress is tracked in Redis, and read back as the
+ * reconciliation report of the cancellation.
+ */
+
+type CancelEventPayload struct {
+	EventID string `json:"event_id"`
+	Reason  string `json:"reason"` // Shown to the attendees
+}
+
+type RefundEventPaymentPayload struct {
+	EventID   string `json:"event_id"`
+	PaymentID string `json:"payment_id"`
+	Reason    string `json:"reason"`
+}
+
+// Cancel a booking of a canceled event that holds transferred tickets, paid by another booking
+type CancelEventBookingPayload struct {
+	EventID   string `json:"event_id"`
+	BookingID string `json:"booking_id"`
+	Reason    string `json:"reason"`
+}
+
+const (
+	CancelEvent        = "cancel-event"
+	RefundEventPayment = "refund-event-payment"
+	CancelEventBooking = "cancel-event-booking"
+)
+
+// Status of an event cancellation
+const (
+	CANCELLATION_STATUS_IN_PROGRESS = "in_progress"
+	CANCELLATION_STATUS_COMPLETED   = "completed"
+)
+
+// Reason of the refunds of canceled events
+const EVENT_CANCELED_REFUND_REASON = "event-canceled"
+
+const (
+	CANCEL_REFUND_BATCH_SIZE     = 20               // Refund tasks scheduled at once
+	CANCEL_REFUND_BATCH_INTERVAL = 10 * time.Second // Delay between 2 batches
+	CANCEL_REFUND_MAX_RETRY      = 10
+	CANCELLATION_TTL             = 30 * 24 * time.Hour // How long the report of a cancellation is kept
+)
+
+// Progress of an event cancellation, and its reconciliation report once completed
+type EventCancellation struct {
+	EventID          string                     `json:"event_id"`
+	Reason           string                     `json:"reason"`
+	Status           string                     `json:"status"`
+	StartedAt        string                     `json:"started_at"`
+	FinishedAt       string                     `json:"finished_at,omitempty"`
+	TotalPayments    int                        `json:"total_payments"`    // Successful payments of the event
+	RefundedPayments int                        `json:"refunded_payments"` // Payments refunded, or with nothing left to refund
+	FailedPayments   int                        `json:"failed_payments"`   // Payments whose refund failed after every retry
+	PaidAmount       int                        `json:"paid_amount"`       // Total of the successful payments
+	RefundedAmount   int                        `json:"refunded_amount"`   // Refunded by the cancellation
+	Failures         []EventCancellationFailure `json:"failures"`
+}
+
+type EventCancellationFailure struct {
+	PaymentID string `json:"payment_id"`
+	Error     string `json:"error"`
+}
+
+// Fields of a payment refunded by the cancellation
+var refundEventPaymentFields = []string{
+	"id", "amount", "status", "transaction_id",
+	"booking_id.id", "booking_id.event_id.name",
+	"booking_id.customer_id.id", "booking_id.customer_id.email",
+	"booking_id.customer_id.first_name", "booking_id.customer_id.last_name",
+	"booking_id.customer_id.user_telegrams.telegram_chat_id",
+	"booking_id.booking_items.id", "booking_id.booking_items.status",
+	"refunds.id", "refunds.amount", "refunds.status", "refunds.reason",
+}
+
+// Cancel an event: schedule the refund of every successful payment of the event
+func (processor *RedisTaskProcessor) CancelEvent(payload CancelEventPayload) error {
+	ctx := context.Background()
+
+	queryParams := neturl.Values{}
+	queryParams.Add("fields", "id,amount")
+	queryParams.Add("filter[booking_id][event_id][_eq]", payload.EventID)
+	queryParams.Add("filter[status][_eq]", "success")
+	queryParams.Add("limit", "-1")
+	url := fmt.Sprintf("%s/items/payments?%s", processor.config.DirectusAddr, queryParams.Encode())
+	var payments []db.Payment
+	status, err := db.MakeRequest("GET", url, nil, processor.config.DirectusStaticToken, &payments)
+	if err != nil {
+		util.LOGGER.Error("failed to get payments of event", "task", CancelEvent, "event_id", payload.EventID, "status", status, "error", err)
+		return err
+	}
+
+	// The bookings of the transferred tickets, completed without a payment of their own
+	queryParams = neturl.Values{}
+	queryParams.Add("fields", "id,payments.status")
+	queryParams.Add("filter[event_id][_eq]", payload.EventID)
+	queryParams.Add("filter[status][_eq]", "completed")
+	queryParams.Add("limit", "-1")
+	url = fmt.Sprintf("%s/items/bookings?%s", processor.config.DirectusAddr, queryParams.Encode())
+	var bookings []db.Booking
+	if status, err := db.MakeRequest("GET", url, nil, processor.config.DirectusStaticToken, &bookings); err != nil {
+		util.LOGGER.Error("failed to get bookings of event", "task", CancelEvent, "event_id", payload.EventID, "status", status, "error", err)
+		return err
+	}
+	unpaid := []string{}
+	for _, booking := range bookings {
+		if !slices.ContainsFunc(booking.Payments, func(payment db.Payment) bool { return payment.Status == "success" }) {
+			unpaid = append(unpaid, booking.ID)
+		}
+	}
+
+	// The tickets of the event are not for sale anymore
+	queryParams = neturl.Values{}
+	queryParams.Add("fields", "id")
+	queryParams.Add("filter[booking_item_id][booking_id][event_id][_eq]", payload.EventID)
+	queryParams.Add("filter[status][_eq]", RESALE_STATUS_ACTIVE)
+	queryParams.Add("limit", "-1")
+	url = fmt.Sprintf("%s/items/resale_listings?%s", processor.config.DirectusAddr, queryParams.Encode())
+	var listings []db.ResaleListing
+	if status, err := db.MakeRequest("GET", url, nil, processor.config.DirectusStaticToken, &listings); err != nil {
+		util.LOGGER.Error("failed to get resale listings of event", "task", CancelEvent, "event_id", payload.EventID, "status", status, "error", err)
+		return err
+	}
+	listingIDs := make([]string, 0, len(listings))
+	for _, listing := range listings {
+		listingIDs = append(listingIDs, listing.ID)
+	}
+	if err := processor.patchItems("resale_listings", listingIDs, map[string]any{"status": RESALE_STATUS_CANCELED}); err != nil {
+		util.LOGGER.Error("failed to cancel resale listings of event", "task", CancelEvent, "event_id", payload.EventID, "error", err)
+		return err
+	}
+
+	// Start the report. A retry of this task keeps the progress already made
+	paidAmount := 0
+	for _, payment := range payments {
+		paidAmount += payment.Amount
+	}
+	key := cancellationKey(payload.EventID)
+	_, err = processor.queries.Cache.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSetNX(ctx, key, "reason", payload.Reason)
+		pipe.HSetNX(ctx, key, "status", CANCELLATION_STATUS_IN_PROGRESS)
+		pipe.HSetNX(ctx, key, "started_at", time.Now().UTC().Format(time.RFC3339))
+		pipe.HSetNX(ctx, key, "total_payments", len(payments))
+		pipe.HSetNX(ctx, key, "paid_amount", paidAmount)
+		pipe.Expire(ctx, key, CANCELLATION_TTL)
+		return nil
+	})
+	if err != nil {
+		util.LOGGER.Error("failed to start cancellation report", "task", CancelEvent, "event_id", payload.EventID, "error", err)
+		return err
+	}
+
+	// One refund task per payment, in batches
+	for i, payment := range payments {
+		delay := time.Duration(i/CANCEL_REFUND_BATCH_SIZE) * CANCEL_REFUND_BATCH_INTERVAL
+		if err := processor.scheduleEventRefund(payload.EventID, payment.ID, delay); err != nil {
+			return err
+		}
+	}
+
+	for i, bookingID := range unpaid {
+		err := processor.distributor.DistributeTask(
+			ctx,
+			CancelEventBooking,
+			CancelEventBookingPayload{EventID: payload.EventID, BookingID: bookingID, Reason: payload.Reason},
+			asynq.Queue(HIGH_IMPACT),
+			asynq.MaxRetry(CANCEL_REFUND_MAX_RETRY),
+			asynq.ProcessIn(time.Duration((len(payments)+i)/CANCEL_REFUND_BATCH_SIZE)*CANCEL_REFUND_BATCH_INTERVAL),
+			asynq.TaskID(fmt.Sprintf("%s:%s", CancelEventBooking, bookingID)),
+		)
+		if err != nil && !errors.Is(err, asynq.ErrTaskIDConflict) {
+			util.LOGGER.Error("failed to schedule booking cancellation", "task", CancelEvent, "booking_id", bookingID, "error", err)
+			return err
+		}
+	}
+
+	util.LOGGER.Info("event cancellation scheduled", "event_id", payload.EventID, "payments", len(payments), "unpaid_bookings", len(unpaid))
+	return processor.completeCancellation(ctx, payload.EventID)
+}
+
+// Refund a payment of a canceled event, and notify its customer
+func (processor *RedisTaskProcessor) RefundEventPayment(payload RefundEventPaymentPayload) error {
+	ctx := context.Background()
+
+	queryParams := neturl.Values{}
+	queryParams.Add("fields", strings.Join(refundEventPaymentFields, ","))
+	url := fmt.Sprintf("%s/items/payments/%s?%s", processor.config.DirectusAddr, payload.PaymentID, queryParams.Encode())
+	var paymentInfo db.Payment
+	status, err := db.MakeRequest("GET", url, nil, processor.config.DirectusStaticToken, &paymentInfo)
+	if err != nil {
+		util.LOGGER.Error("failed to get payment", "task", RefundEventPayment, "payment_id", payload.PaymentID, "status", status, "error", err)
+		return err
+	}
+	if paymentInfo.Booking == nil {
+		return fmt.Errorf("payment %s has no booking: %w", paymentInfo.ID, asynq.SkipRetry)
+	}
+
+	refunded, err := processor.refundEventPayment(paymentInfo)
+	if err != nil {
+		return err
+	}
+
+	// The tickets that were not refunded before are refunded by the cancellation
+	release := ReleaseTicketsPayload{Reason: "event canceled"}
+	for _, item := range paymentInfo.Booking.BookingItems {
+		if item.Status != "refunded" {
+			release.BookingItemIDs = append(release.BookingItemIDs, item.ID)
+		}
+	}
+	if err := release.execute(processor); err != nil {
+		return err
+	}
+	if err := processor.patchItem("bookings", paymentInfo.Booking.ID, map[string]any{"status": "canceled"}); err != nil {
+		return err
+	}
+
+	if paymentInfo.Booking.Customer != nil {
+		eventName := ""
+		if paymentInfo.Booking.Event != nil {
+			eventName = paymentInfo.Booking.Event.Name
+		}
+		body := fmt.Sprintf("%s has been canceled by its organizer", eventName)
+		if payload.Reason != "" {
+			body += ": " + payload.Reason
+		}
+		body += fmt.Sprintf(". Your booking %s is refunded (%d VND), the refund may take a few days to appear.", paymentInfo.Booking.ID, refunded)
+		err := processor.notifyCustomer(*paymentInfo.Booking.Customer, SendNotificationPayload{
+			Name:  "event-canceled",
+			Title: "Event canceled",
+			Body:  body,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// Progress: a payment is only counted once, even if this task is retried after counting it
+	key := cancellationKey(payload.EventID)
+	added, err := processor.queries.Cache.SAdd(ctx, key+":refunded", paymentInfo.ID).Result()
+	if err != nil {
+		return err
+	}
+	if added == 1 {
+		_, err = processor.queries.Cache.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.HIncrBy(ctx, key, "refunded_amount", int64(refunded))
+			pipe.HDel(ctx, key+":failures", paymentInfo.ID)
+			pipe.Expire(ctx, key+":refunded", CANCELLATION_TTL)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return processor.completeCancellation(ctx, payload.EventID)
+}
+
+// Cancel a booking of transferred tickets of a canceled event: invalidate its tickets, and notify its customer that the
+// refund goes to the sender who paid for them
+func (processor *RedisTaskProcessor) CancelEventBooking(payload CancelEventBookingPayload) error {
+	fields := []string{
+		"id", "status", "event_id.name",
+		"customer_id.id", "customer_id.email", "customer_id.first_name", "customer_id.last_name",
+		"customer_id.user_telegrams.telegram_chat_id",
+		"booking_items.id", "booking_items.status",
+	}
+	url := fmt.Sprintf("%s/items/bookings/%s?fields=%s", processor.config.DirectusAddr, payload.BookingID, strings.Join(fields, ","))
+	var booking db.Booking
+	status, err := db.MakeRequest("GET", url, nil, processor.config.DirectusStaticToken, &booking)
+	if err != nil {
+		util.LOGGER.Error("failed to get booking", "task", CancelEventBooking, "booking_id", payload.BookingID, "status", status, "error", err)
+		return err
+	}
+	if booking.Status == "canceled" {
+		return nil
+	}
+
+	release := ReleaseTicketsPayload{Reason: "event canceled"}
+	for _, item := range booking.BookingItems {
+		if item.Status != "refunded" {
+			release.BookingItemIDs = append(release.BookingItemIDs, item.ID)
+		}
+	}
+	if err := release.execute(processor); err != nil {
+		return err
+	}
+	if err := processor.patchItem("bookings", booking.ID, map[string]any{"status": "canceled"}); err != nil {
+		return err
+	}
+
+	if booking.Customer == nil || len(release.BookingItemIDs) == 0 {
+		return nil
+	}
+	eventName := ""
+	if booking.Event != nil {
+		eventName = booking.Event.Name
+	}
+	body := fmt.Sprintf("%s has been canceled by its organizer", eventName)
+	if payload.Reason != "" {
+		body += ": " + payload.Reason
+	}
+	body += ". The tickets you received are no longer valid, and are refunded to the customer who paid for them."
+	return processor.notifyCustomer(*booking.Customer, SendNotificationPayload{
+		Name:  "event-canceled",
+		Title: "Event canceled",
+		Body:  body,
+	})
+}
+
+// Helper method: schedule the refund of a payment of a canceled event. The task ID keeps a payment from being refunded by 2
+// tasks, when the cancellation is retried or the payment succeeded after the event was canceled
+func (processor *RedisTaskProcessor) scheduleEventRefund(eventID, paymentID string, delay time.Duration) error {
+	ctx := context.Background()
+
+	// The reason is shown to the attendees, and kept by the report of the cancellation
+	reason, err := processor.queries.Cache.HGet(ctx, cancellationKey(eventID), "reason").Result()
+	if err != nil && err != redis.Nil {
+		return err
+	}
+
+	err = processor.distributor.DistributeTask(
+		ctx,
+		RefundEventPayment,
+		RefundEventPaymentPayload{EventID: eventID, PaymentID: paymentID, Reason: reason},
+		asynq.Queue(HIGH_IMPACT),
+		asynq.MaxRetry(CANCEL_REFUND_MAX_RETRY),
+		asynq.ProcessIn(delay),
+		asynq.TaskID(fmt.Sprintf("%s:%s", RefundEventPayment, paymentID)),
+	)
+	if err != nil && !errors.Is(err, asynq.ErrTaskIDConflict) {
+		util.LOGGER.Error("failed to schedule refund", "event_id", eventID, "payment_id", paymentID, "error", err)
+		return err
+	}
+	return nil
+}
+
+// Helper method: add a payment that succeeded after its event was canceled to the report of the cancellation, once. A
+// completed cancellation is in progress again until the payment is refunded
+func (processor *RedisTaskProcessor) countLateEventPayment(eventID string, paid db.Payment) error {
+	ctx := context.Background()
+	key := cancellationKey(eventID)
+
+	exists, err := processor.queries.Cache.Exists(ctx, key).Result()
+	if err != nil || exists == 0 {
+		return err
+	}
+	added, err := processor.queries.Cache.SAdd(ctx, key+":late", paid.ID).Result()
+	if err != nil || added == 0 {
+		return err
+	}
+
+	_, err = processor.queries.Cache.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HIncrBy(ctx, key, "total_payments", 1)
+		pipe.HIncrBy(ctx, key, "paid_amount", int64(paid.Amount))
+		pipe.HSet(ctx, key, "status", CANCELLATION_STATUS_IN_PROGRESS)
+		pipe.HDel(ctx, key, "finished_at")
+		pipe.Expire(ctx, key+":late", CANCELLATION_TTL)
+		return nil
+	})
+	return err
+}
+
+// Helper method: refund what is left of a payment, and return the refunded amount. The refund record of a previous attempt
+// is reused, and gives the idempotency key of the Stripe refund
+func (processor *RedisTaskProcessor) refundEventPayment(paymentInfo db.Payment) (int, error) {
+	var record *db.Refund
+	refunded := 0
+	for _, refund := range paymentInfo.Refunds {
+		if refund.Status == "failed" {
+			continue
+		}
+		if refund.Reason == EVENT_CANCELED_REFUND_REASON {
+			record = &refund
+			continue
+		}
+		refunded += refund.Amount
+	}
+
+	if record == nil {
+		amount := paymentInfo.Amount - refunded
+		if amount <= 0 {
+			// Already refunded by the customer
+			return 0, nil
+		}
+
+		var itemIDs []string
+		for _, item := range paymentInfo.Booking.BookingItems {
+			if item.Status != "refunded" {
+				itemIDs = append(itemIDs, item.ID)
+			}
+		}
+		url := fmt.Sprintf("%s/items/refunds?fields=id,amount,status", processor.config.DirectusAddr)
+		body := map[string]any{
+			"amount":        amount,
+			"status":        "pending",
+			"payment_id":    paymentInfo.ID,
+			"reason":        EVENT_CANCELED_REFUND_REASON,
+			"booking_items": itemIDs,
+		}
+		record = &db.Refund{}
+		if status, err := db.MakeRequest("POST", url, body, processor.config.DirectusStaticToken, record); err != nil {
+			return 0, fmt.Errorf("create refund record: status %d: %w", status, err)
+		}
+	}
+	if record.Status == "success" {
+		return record.Amount, nil
+	}
+
+	refund, err := payment.CreateIdempotentRefund(
+		paymentInfo.TransactionID,
+		payment.RequestedByCustomer,
+		int64(record.Amount),
+		fmt.Sprintf("%s:%s", RefundEventPayment, record.ID),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("refund in Stripe: %w", err)
+	}
+
+	if err := processor.settleRefund(record.ID, refund, "event canceled"); err != nil {
+		return 0, err
+	}
+	return record.Amount, nil
+}
+
+// Helper method: record the outcome of a Stripe refund on its pending refund record. A refund failed in Stripe is an error,
+// and the record is marked as failed so that the next retry makes a new refund
+func (processor *RedisTaskProcessor) settleRefund(recordID string, refund *stripe.Refund, reason string) error {
+	switch refund.Status {
+	case stripe.RefundStatusSucceeded:
+		command := SetRefundStatusPayload{RefundID: recordID, Status: "success", PreviousStatus: "pending", Reason: reason}
+		return command.execute(processor)
+	case stripe.RefundStatusFailed, stripe.RefundStatusCanceled:
+		command := SetRefundStatusPayload{RefundID: recordID, Status: "failed", PreviousStatus: "pending", Reason: reason}
+		if err := command.execute(processor); err != nil {
+			return err
+		}
+		return fmt.Errorf("refund failed in Stripe: %s", refund.FailureReason)
+	default:
+		// Accepted by Stripe, the refund record stays pending until it completes, followed by a task of its own
+		payload := SettleRefundPayload{RefundID: recordID, StripeRefundID: refund.ID}
+		return ScheduleRefundSettlement(context.Background(), processor.distributor, payload)
+	}
+}
+
+// Helper method: report a payment whose refund failed after every retry
+func (processor *RedisTaskProcessor) failEventRefund(payload RefundEventPaymentPayload, refundErr error) error {
+	ctx := context.Background()
+	key := cancellationKey(payload.EventID)
+	_, err := processor.queries.Cache.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, key+":failures", payload.PaymentID, refundErr.Error())
+		pipe.Expire(ctx, key+":failures", CANCELLATION_TTL)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return processor.completeCancellation(ctx, payload.EventID)
+}
+
+// Helper method: mark the cancellation as completed once every payment is refunded or failed
+func (processor *RedisTaskProcessor) completeCancellation(ctx context.Context, eventID string) error {
+	cancellation, err := GetEventCancellation(ctx, processor.queries.Cache, eventID)
+	if err != nil || cancellation == nil || cancellation.Status == CANCELLATION_STATUS_COMPLETED {
+		return err
+	}
+	if cancellation.RefundedPayments+cancellation.FailedPayments < cancellation.TotalPayments {
+		return nil
+	}
+
+	err = processor.queries.Cache.HSet(
+		ctx,
+		cancellationKey(eventID),
+		"status", CANCELLATION_STATUS_COMPLETED,
+		"finished_at", time.Now().UTC().Format(time.RFC3339),
+	).Err()
+	if err == nil {
+		util.LOGGER.Info(
+			"event cancellation completed",
+			"event_id", eventID,
+			"refunded", cancellation.RefundedPayments,
+			"failed", cancellation.FailedPayments,
+		)
+	}
+	return err
+}
+
+// Get the progress of the cancellation of an event, nil if the event was not canceled
+func GetEventCancellation(ctx context.Context, client *redis.Client, eventID string) (*EventCancellation, error) {
+	key := cancellationKey(eventID)
+	var fields *redis.MapStringStringCmd
+	var refunded *redis.IntCmd
+	var failures *redis.MapStringStringCmd
+	_, err := client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		fields = pipe.HGetAll(ctx, key)
+		refunded = pipe.SCard(ctx, key+":refunded")
+		failures = pipe.HGetAll(ctx, key+":failures")
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(fields.Val()) == 0 {
+		return nil, nil
+	}
+
+	values := fields.Val()
+	cancellation := &EventCancellation{
+		EventID:          eventID,
+		Reason:           values["reason"],
+		Status:           values["status"],
+		StartedAt:        values["started_at"],
+		FinishedAt:       values["finished_at"],
+		TotalPayments:    atoi(values["total_payments"]),
+		RefundedPayments: int(refunded.Val()),
+		FailedPayments:   len(failures.Val()),
+		PaidAmount:       atoi(values["paid_amount"]),
+		RefundedAmount:   atoi(values["refunded_amount"]),
+		Failures:         []EventCancellationFailure{},
+	}
+	for paymentID, message := range failures.Val() {
+		cancellation.Failures = append(cancellation.Failures, EventCancellationFailure{PaymentID: paymentID, Error: message})
+	}
+	slices.SortFunc(cancellation.Failures, func(a, b EventCancellationFailure) int {
+		return strings.Compare(a.PaymentID, b.PaymentID)
+	})
+	return cancellation, nil
+}
+
+// Helper function: parse a counter of the report, 0 if not set
+func atoi(value string) int {
+	n, _ := strconv.Atoi(value)
+	return n
+}
+
+// Helper function: Redis key of the report of the cancellation of an event
+func cancellationKey(eventID string) string {
+	return "event:cancel:" + eventID
+}
@@ -0,0 +1,22 @@
+package worker
+
+import (
+	"context"
+	"time"
+)
+
+// Clear the static token of a social login user from Directus once their access token expired
+type ClearAccessTokenPayload struct {
+	UserID string `json:"user_id"`
+}
+
+const ClearAccessToken = "clear-access-token"
+
+// Delay after the expiry of an access token before its static token is cleared, so that the token is surely expired
+const CLEAR_ACCESS_TOKEN_DELAY = 10 * time.Second
+
+// Clear the static token of the user, unless their access token was replaced since. A token being replaced is an error,
+// so that the task is retried
+func (processor *RedisTaskProcessor) ClearAccessToken(payload ClearAccessTokenPayload) error {
+	return processor.sessions.ClearExpiredAccessToken(context.Background(), payload.UserID)
+}
@@ -0,0 +1,159 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"tekticket/db"
+	"tekticket/util"
+
+	"github.com/hibiken/asynq"
+)
+
+/*
+ * Outbox of domain commands: the typed changes of payments, refunds and tickets that the API issues after a call to Stripe,
+ * so that they are retried if Directus is down. Each command is a task of its own type, executed by the worker with the
+ * static token, since the user token may have expired by the time of a retry and must not sit in the queue.
+ * Each command declares its compensation, the command undoing it, next to it.
+ */
+
+// Task types of the commands
+const (
+	SetPaymentStatus = "set-payment-status"
+	SetRefundStatus  = "set-refund-status"
+	ReleaseTickets   = "release-tickets"
+)
+
+// Domain command
+type Command interface {
+	TaskName() string
+	Compensation() Command // The command undoing this one, nil if it can't be undone
+	execute(processor *RedisTaskProcessor) error
+}
+
+// Command: set the status of a payment, with the Stripe details known at that point
+type SetPaymentStatusPayload struct {
+	PaymentID      string `json:"payment_id"`
+	Status         string `json:"status"`
+	PreviousStatus string `json:"previous_status,omitempty"` // Status restored by the compensation
+	TransactionID  string `json:"transaction_id,omitempty"`  // Stripe payment intent ID
+	PaymentMethod  string `json:"payment_method,omitempty"`
+	Reason         string `json:"reason"` // Why the command was issued, used simply for logging
+}
+
+func (command SetPaymentStatusPayload) TaskName() string { return SetPaymentStatus }
+
+// Compensation: restore the previous status
+func (command SetPaymentStatusPayload) Compensation() Command {
+	return SetPaymentStatusPayload{
+		PaymentID:      command.PaymentID,
+		Status:         command.PreviousStatus,
+		PreviousStatus: command.Status,
+		Reason:         "compensate: " + command.Reason,
+	}
+}
+
+func (command SetPaymentStatusPayload) execute(processor *RedisTaskProcessor) error {
+	body := map[string]any{"status": command.Status}
+	if command.TransactionID != "" {
+		body["transaction_id"] = command.TransactionID
+	}
+	if command.PaymentMethod != "" {
+		body["payment_method"] = command.PaymentMethod
+	}
+	return processor.patchItem("payments", command.PaymentID, body)
+}
+
+// Command: set the status of a refund
+type SetRefundStatusPayload struct {
+	RefundID       string `json:"refund_id"`
+	Status         string `json:"status"`
+	PreviousStatus string `json:"previous_status,omitempty"` // Status restored by the compensation
+	Reason         string `json:"reason"`                    // Why the command was issued, used simply for logging
+}
+
+func (command SetRefundStatusPayload) TaskName() string { return SetRefundStatus }
+
+// Compensation: restore the previous status
+func (command SetRefundStatusPayload) Compensation() Command {
+	return SetRefundStatusPayload{
+		RefundID:       command.RefundID,
+		Status:         command.PreviousStatus,
+		PreviousStatus: command.Status,
+		Reason:         "compensate: " + command.Reason,
+	}
+}
+
+func (command SetRefundStatusPayload) execute(processor *RedisTaskProcessor) error {
+	return processor.patchItem("refunds", command.RefundID, map[string]any{"status": command.Status})
+}
+
+// Command: release the tickets of a refund. The tickets are marked as refunded and lose their QR, so that they can't be
+// checked in anymore, and their seats are available again
+type ReleaseTicketsPayload struct {
+	BookingItemIDs []string `json:"booking_item_ids"`
+	SeatIDs        []string `json:"seat_ids"`
+	Reason         string   `json:"reason"` // Why the command was issued, used simply for logging
+}
+
+func (command ReleaseTicketsPayload) TaskName() string { return ReleaseTickets }
+
+// Compensation: none, the seats may already be booked again
+func (command ReleaseTicketsPayload) Compensation() Command { return nil }
+
+func (command ReleaseTicketsPayload) execute(processor *RedisTaskProcessor) error {
+	body := map[string]any{"status": "refunded", "qr": nil, "checkin_token": nil}
+	if err := processor.patchItems("booking_items", command.BookingItemIDs, body); err != nil {
+		return err
+	}
+	return processor.patchItems("seats", command.SeatIDs, map[string]any{"status": "available", "reserved_by": nil})
+}
+
+// Issue a command: distribute it as a task of its own type
+func IssueCommand(ctx context.Context, distributor TaskDistributor, command Command) error {
+	return distributor.DistributeTask(ctx, command.TaskName(), command, asynq.Queue(HIGH_IMPACT), asynq.MaxRetry(5))
+}
+
+// Helper function: the task handler of a command type
+func handleCommand[T Command](processor *RedisTaskProcessor) asynq.HandlerFunc {
+	return func(ctx context.Context, t *asynq.Task) error {
+		// Unmarshal payload
+		var command T
+		if err := json.Unmarshal(t.Payload(), &command); err != nil {
+			util.LOGGER.Error("failed to unmarshal task's payload", "task", t.Type(), "error", err)
+			return err
+		}
+
+		// Process
+		if err := command.execute(processor); err != nil {
+			util.LOGGER.Error("failed to process task", "task", t.Type(), "command", command, "error", err)
+			return err
+		}
+
+		util.LOGGER.Info("task success", "task", t.Type(), "command", command)
+		return nil
+	}
+}
+
+// Helper method: update an item of a collection with the static token
+func (processor *RedisTaskProcessor) patchItem(collection, id string, body map[string]any) error {
+	url := fmt.Sprintf("%s/items/%s/%s", processor.config.DirectusAddr, collection, id)
+	status, err := db.MakeRequest("PATCH", url, body, processor.config.DirectusStaticToken, nil)
+	if err != nil {
+		return fmt.Errorf("update %s %s: status %d: %w", collection, id, status, err)
+	}
+	return nil
+}
+
+// Helper method: update several items of a collection at once with the static token
+func (processor *RedisTaskProcessor) patchItems(collection string, ids []string, body map[string]any) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	url := fmt.Sprintf("%s/items/%s", processor.config.DirectusAddr, collection)
+	status, err := db.MakeRequest("PATCH", url, map[string]any{"keys": ids, "data": body}, processor.config.DirectusStaticToken, nil)
+	if err != nil {
+		return fmt.Errorf("update %s %v: status %d: %w", collection, ids, status, err)
+	}
+	return nil
+}
@@ -0,0 +1,367 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	neturl "net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"tekticket/db"
+	"tekticket/service/payment"
+	"tekticket/util"
+
+	"github.com/hibiken/asynq"
+	"github.com/stripe/stripe-go/v82"
+)
+
+/*
+ * Booking confirmation: the pipeline that runs once the payment of a booking succeeded. Each step is idempotent, and the
+ * completed steps are recorded in the confirmation_steps of the booking, so that a retry of the task resumes after the last
+ * completed step instead of starting over:
+ * 1. payment : record the payment as successful
+ * 2. resale  : for the purchase of a resale listing, move the ticket to the booking and schedule the payout of the seller
+ * 3. promo   : count the use of the promo code of the booking for good, in place of its hold
+ * 4. booking : mark the booking as completed
+ * 5. tickets : publish the QRs of the tickets that are not issued yet
+ * 6. points  : credit the loyalty points of the booking, once per booking
+ * 7. notify  : send the confirmation to the email, the in app channel and the Telegram chats of the customer
+ * If the event was canceled while the customer paid, only the payment is recorded: it is then refunded as the other payments
+ * of the event, and the booking is never completed.
+ */
+
+type ConfirmBookingPayload struct {
+	BookingID     string `json:"booking_id"`
+	PaymentID     string `json:"payment_id"`     // The successful payment. If empty, the processing payment of the booking
+	PaymentMethod string `json:"payment_method"` // Payment method of the successful payment
+}
+
+const ConfirmBooking = "confirm-booking"
+
+// Steps of the booking confirmation, in order
+const (
+	CONFIRM_STEP_PAYMENT = "payment"
+	CONFIRM_STEP_RESALE  = "resale"
+	CONFIRM_STEP_PROMO   = "promo"
+	CONFIRM_STEP_BOOKING = "booking"
+	CONFIRM_STEP_TICKETS = "tickets"
+	CONFIRM_STEP_POINTS  = "points"
+	CONFIRM_STEP_NOTIFY  = "notify"
+)
+
+var ConfirmBookingSteps = []string{
+	CONFIRM_STEP_PAYMENT,
+	CONFIRM_STEP_RESALE,
+	CONFIRM_STEP_PROMO,
+	CONFIRM_STEP_BOOKING,
+	CONFIRM_STEP_TICKETS,
+	CONFIRM_STEP_POINTS,
+	CONFIRM_STEP_NOTIFY,
+}
+
+var (
+	ErrBookingNotPaid        = errors.New("booking has no successful payment")
+	ErrBookingAmountMismatch = errors.New("payment doesn't match the amount of the booking")
+)
+
+// Fields of a booking used by the confirmation
+var confirmBookingFields = []string{
+	"id", "status", "confirmation_steps", "discount",
+	"customer_id.id", "customer_id.email", "customer_id.first_name", "customer_id.last_name",
+	"customer_id.user_telegrams.telegram_chat_id",
+	"event_id.id", "event_id.name", "event_id.status",
+	"booking_items.id", "booking_items.status", "booking_items.price",
+	"payments.id", "payments.amount", "payments.status", "payments.items_total", "payments.transaction_id",
+	"resale_listing_id.id", "resale_listing_id.price", "promo_code_id.id",
+}
+
+// Run the remaining steps of the confirmation of a booking
+func (processor *RedisTaskProcessor) ConfirmBooking(payload ConfirmBookingPayload) error {
+	queryParams := neturl.Values{}
+	queryParams.Add("fields", strings.Join(confirmBookingFields, ","))
+	url := fmt.Sprintf("%s/items/bookings/%s?%s", processor.config.DirectusAddr, payload.BookingID, queryParams.Encode())
+	var booking db.Booking
+	status, err := db.MakeRequest("GET", url, nil, processor.config.DirectusStaticToken, &booking)
+	if err != nil {
+		util.LOGGER.Error("failed to get booking", "task", ConfirmBooking, "booking_id", payload.BookingID, "status", status, "error", err)
+		return err
+	}
+
+	// The payment of the booking. Never confirm a booking that was not paid: a payment still processing is only paid once
+	// its payment intent succeeded in Stripe
+	paid := getBookingPayment(booking, payload.PaymentID)
+	if paid != nil && paid.Status == "processing" {
+		intent, err := payment.GetPaymentIntent(paid.TransactionID)
+		if err != nil {
+			util.LOGGER.Error("failed to get payment intent", "task", ConfirmBooking, "payment_id", paid.ID, "error", err)
+			return err
+		}
+		if intent.Status != stripe.PaymentIntentStatusSucceeded || intent.Amount != int64(paid.Amount) {
+			util.LOGGER.Warn("payment intent not succeeded", "task", ConfirmBooking, "payment_id", paid.ID, "intent_status", intent.Status)
+			paid = nil
+		}
+	}
+	if paid == nil {
+		util.LOGGER.Error("booking has no successful payment, skip confirmation", "task", ConfirmBooking, "booking_id", booking.ID)
+		return fmt.Errorf("%w: %w", ErrBookingNotPaid, asynq.SkipRetry)
+	}
+
+	// The amount of a payment is sent by the client, so it must be the amount of the booking priced by the server. Once the
+	// payment is recorded the tickets may change hands, so only the first attempt checks it
+	if !slices.Contains(booking.ConfirmationSteps, CONFIRM_STEP_PAYMENT) {
+		if amount := util.BookingAmount(booking, processor.config.PaymentFeePercent); paid.Amount != amount {
+			util.LOGGER.Error("payment doesn't match booking, skip confirmation", "task", ConfirmBooking, "booking_id", booking.ID, "paid", paid.Amount, "amount", amount)
+			return fmt.Errorf("%w: paid %d of %d VND: %w", ErrBookingAmountMismatch, paid.Amount, amount, asynq.SkipRetry)
+		}
+	}
+
+	if booking.Event != nil && booking.Event.Status == "canceled" {
+		if !slices.Contains(booking.ConfirmationSteps, CONFIRM_STEP_PAYMENT) {
+			if err := processor.confirmPayment(&booking, *paid, payload); err != nil {
+				util.LOGGER.Error("booking confirmation step failed", "task", ConfirmBooking, "booking_id", booking.ID, "step", CONFIRM_STEP_PAYMENT, "error", err)
+				return err
+			}
+			if err := processor.countLateEventPayment(booking.Event.ID, *paid); err != nil {
+				return err
+			}
+			if err := processor.recordConfirmationStep(&booking, CONFIRM_STEP_PAYMENT); err != nil {
+				return err
+			}
+		}
+		util.LOGGER.Warn("event is canceled, refund the payment", "task", ConfirmBooking, "booking_id", booking.ID, "payment_id", paid.ID)
+		return processor.scheduleEventRefund(booking.Event.ID, paid.ID, 0)
+	}
+
+	steps := map[string]func(*db.Booking, db.Payment, ConfirmBookingPayload) error{
+		CONFIRM_STEP_PAYMENT: processor.confirmPayment,
+		CONFIRM_STEP_RESALE:  processor.completeResale,
+		CONFIRM_STEP_PROMO:   processor.redeemPromoCode,
+		CONFIRM_STEP_BOOKING: processor.completeBooking,
+		CONFIRM_STEP_TICKETS: processor.publishBookingTickets,
+		CONFIRM_STEP_POINTS:  processor.creditBookingPoints,
+		CONFIRM_STEP_NOTIFY:  processor.notifyBookingConfirmed,
+	}
+	for _, step := range ConfirmBookingSteps {
+		if slices.Contains(booking.ConfirmationSteps, step) {
+			continue
+		}
+
+		if err := steps[step](&booking, *paid, payload); err != nil {
+			util.LOGGER.Error("booking confirmation step failed", "task", ConfirmBooking, "booking_id", booking.ID, "step", step, "error", err)
+			return err
+		}
+
+		if err := processor.recordConfirmationStep(&booking, step); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Helper method: record a completed step of the confirmation of a booking, so that a retry resumes from the next step
+func (processor *RedisTaskProcessor) recordConfirmationStep(booking *db.Booking, step string) error {
+	booking.ConfirmationSteps = append(booking.ConfirmationSteps, step)
+	url := fmt.Sprintf("%s/items/bookings/%s", processor.config.DirectusAddr, booking.ID)
+	body := map[string]any{"confirmation_steps": booking.ConfirmationSteps}
+	if status, err := db.MakeRequest("PATCH", url, body, processor.config.DirectusStaticToken, nil); err != nil {
+		util.LOGGER.Error("failed to record booking confirmation step", "task", ConfirmBooking, "booking_id", booking.ID, "step", step, "status", status, "error", err)
+		return err
+	}
+	util.LOGGER.Info("booking confirmation step completed", "task", ConfirmBooking, "booking_id", booking.ID, "step", step)
+	return nil
+}
+
+// Helper function: the payment of a booking to confirm it with, the given one or else a successful one, or else one being
+// processed. A processing payment is not paid yet, the caller checks its payment intent
+func getBookingPayment(booking db.Booking, paymentID string) *db.Payment {
+	var processing *db.Payment
+	for _, payment := range booking.Payments {
+		if paymentID != "" && payment.ID != paymentID {
+			continue
+		}
+		switch payment.Status {
+		case "success":
+			return &payment
+		case "processing":
+			if processing == nil {
+				processing = &payment
+			}
+		}
+	}
+	return processing
+}
+
+// Step: record the payment as successful, with the price of the items it paid for. The items may later move to other
+// bookings by a transfer or a resale, so the refunds split the payment by the recorded price rather than by the items left
+func (processor *RedisTaskProcessor) confirmPayment(booking *db.Booking, payment db.Payment, payload ConfirmBookingPayload) error {
+	err := SetPaymentStatusPayload{
+		PaymentID:      payment.ID,
+		Status:         "success",
+		PreviousStatus: payment.Status,
+		PaymentMethod:  payload.PaymentMethod,
+		Reason:         "booking confirmation",
+	}.execute(processor)
+	if err != nil || payment.ItemsTotal != 0 {
+		return err
+	}
+
+	itemsTotal := 0
+	for _, item := range booking.BookingItems {
+		itemsTotal += item.Price
+	}
+	if itemsTotal == 0 {
+		return nil
+	}
+	return processor.patchItem("payments", payment.ID, map[string]any{"items_total": itemsTotal})
+}
+
+// Step: mark the booking as completed
+func (processor *RedisTaskProcessor) completeBooking(booking *db.Booking, payment db.Payment, payload ConfirmBookingPayload) error {
+	return processor.patchItem("bookings", booking.ID, map[string]any{"status": "completed"})
+}
+
+// Step: count the use of the promo code of the booking for good. The hold of the booking may have expired while the customer
+// paid, the use counts anyway since the discounted price was paid
+func (processor *RedisTaskProcessor) redeemPromoCode(booking *db.Booking, payment db.Payment, payload ConfirmBookingPayload) error {
+	if booking.PromoCode == nil || booking.Customer == nil {
+		return nil
+	}
+
+	_, err := processor.promoCounter.Redeem(context.Background(), booking.PromoCode.ID, booking.ID, booking.Customer.ID)
+	return err
+}
+
+// Step: publish the QRs of the tickets that are not issued yet, and not refunded in the meantime
+func (processor *RedisTaskProcessor) publishBookingTickets(booking *db.Booking, payment db.Payment, payload ConfirmBookingPayload) error {
+	var pending []string
+	for _, item := range booking.BookingItems {
+		if item.Status != "valid" && item.Status != "refunded" {
+			pending = append(pending, item.ID)
+		}
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+
+	return processor.PublishQRTickets(PublishQRTicketPayload{BookingItemIDs: pending, CheckInURL: processor.config.CheckinURL})
+}
+
+// Step: credit the loyalty points of the booking. The membership log references the booking, so that the points are never
+// credited twice, even if recording the step failed
+func (processor *RedisTaskProcessor) creditBookingPoints(booking *db.Booking, payment db.Payment, payload ConfirmBookingPayload) error {
+	points := BookingPoints(payment.Amount, processor.config.MoneyToPointRate)
+	if points <= 0 || booking.Customer == nil {
+		return nil
+	}
+
+	// Already credited
+	queryParams := neturl.Values{}
+	queryParams.Add("fields", "id")
+	queryParams.Add("filter[booking_id][_eq]", booking.ID)
+	queryParams.Add("limit", "1")
+	url := fmt.Sprintf("%s/items/user_membership_logs?%s", processor.config.DirectusAddr, queryParams.Encode())
+	var logs []db.UserMembershipLog
+	if _, err := db.MakeRequest("GET", url, nil, processor.config.DirectusStaticToken, &logs); err != nil {
+		return err
+	}
+	if len(logs) != 0 {
+		return nil
+	}
+
+	// Current points of the customer: the resulting points of the latest log
+	queryParams = neturl.Values{}
+	queryParams.Add("fields", "id,resulting_points")
+	queryParams.Add("filter[customer_id][_eq]", booking.Customer.ID)
+	queryParams.Add("sort", "-date_updated")
+	queryParams.Add("limit", "1")
+	url = fmt.Sprintf("%s/items/user_membership_logs?%s", processor.config.DirectusAddr, queryParams.Encode())
+	if _, err := db.MakeRequest("GET", url, nil, processor.config.DirectusStaticToken, &logs); err != nil {
+		return err
+	}
+	current := 0
+	if len(logs) != 0 {
+		current = logs[0].ResultingPoints
+	}
+
+	url = fmt.Sprintf("%s/items/user_membership_logs", processor.config.DirectusAddr)
+	_, err := db.MakeRequest("POST", url, map[string]any{
+		"customer_id":      booking.Customer.ID,
+		"booking_id":       booking.ID,
+		"points_delta":     points,
+		"resulting_points": current + points,
+	}, processor.config.DirectusStaticToken, nil)
+	return err
+}
+
+// Loyalty points earned by a payment: one point per money_to_point_rate VND
+func BookingPoints(amount, moneyToPointRate int) int {
+	if moneyToPointRate <= 0 || amount <= 0 {
+		return 0
+	}
+	return amount / moneyToPointRate
+}
+
+// Step: send the confirmation through every channel of the customer
+func (processor *RedisTaskProcessor) notifyBookingConfirmed(booking *db.Booking, payment db.Payment, payload ConfirmBookingPayload) error {
+	if booking.Customer == nil {
+		return nil
+	}
+
+	eventName := ""
+	if booking.Event != nil {
+		eventName = booking.Event.Name
+	}
+	return processor.notifyCustomer(*booking.Customer, SendNotificationPayload{
+		Name:  "booking-confirmed",
+		Title: "Booking confirmed",
+		Body: fmt.Sprintf(
+			"Your booking %s for %s is confirmed. Your %d ticket(s) will be sent to you shortly.",
+			booking.ID, eventName, len(booking.BookingItems),
+		),
+	})
+}
+
+// Notification task to a channel
+type notificationTask struct {
+	name string
+	dest NotificationChannel
+}
+
+// Helper method: send a notification through every channel of a customer: the in app channel, the email and the Telegram
+// chats. Each channel is its own task, with its own retries
+func (processor *RedisTaskProcessor) notifyCustomer(customer db.User, notification SendNotificationPayload) error {
+	notification.Dest = NotificationChannel{Email: customer.Email, Channel: customer.ID} // In app channel of the user
+
+	// One task per channel
+	tasks := []notificationTask{{SendInAppNotification, notification.Dest}}
+	if customer.Email != "" {
+		tasks = append(tasks, notificationTask{SendEmailNotification, notification.Dest})
+	}
+	for _, telegram := range customer.UserTelegrams {
+		chatID, err := strconv.Atoi(telegram.TelegramChatID)
+		if err != nil {
+			util.LOGGER.Warn("invalid Telegram chat ID", "notification", notification.Name, "chat_id", telegram.TelegramChatID)
+			continue
+		}
+		dest := notification.Dest
+		dest.ChatID = chatID
+		tasks = append(tasks, notificationTask{SendTelegramNotification, dest})
+	}
+
+	for _, task := range tasks {
+		notification.Dest = task.dest
+		err := processor.distributor.DistributeTask(
+			context.Background(),
+			task.name,
+			notification,
+			asynq.Queue(MEDIUM_IMPACT),
+			asynq.MaxRetry(5),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"tekticket/db"
+	"tekticket/service/payment"
+	"tekticket/util"
+
+	"github.com/hibiken/asynq"
+)
+
+/*
+ * Expiry of the bookings not paid in time: the task is scheduled at the end of the reservation of a booking when it is
+ * created. A booking still pending by then can't be paid anymore: its pending payment intents are canceled in Stripe, its
+ * tickets and seats are released, the booking is canceled, and the freed tickets are offered to the waitlists of their types.
+ * A booking whose payment is being processed or succeeded is left to its confirmation.
+ */
+
+// Expire a booking if it is still unpaid
+type ExpireBookingPayload struct {
+	BookingID string `json:"booking_id"`
+}
+
+const ExpireBooking = "expire-booking"
+
+// Expire a booking not paid by the end of its reservation
+func (processor *RedisTaskProcessor) ExpireBooking(payload ExpireBookingPayload) error {
+	fields := []string{
+		"id", "status",
+		"payments.id", "payments.status", "payments.transaction_id",
+		"booking_items.id", "booking_items.status", "booking_items.ticket_id.id", "booking_items.seat_id.id",
+	}
+	url := fmt.Sprintf("%s/items/bookings/%s?fields=%s", processor.config.DirectusAddr, payload.BookingID, strings.Join(fields, ","))
+	var booking db.Booking
+	status, err := db.MakeRequest("GET", url, nil, processor.config.DirectusStaticToken, &booking)
+	if err != nil {
+		util.LOGGER.Error("failed to get booking", "task", ExpireBooking, "booking_id", payload.BookingID, "status", status, "error", err)
+		return err
+	}
+	if booking.Status != "pending" {
+		return nil
+	}
+
+	for _, paymentInfo := range booking.Payments {
+		if paymentInfo.Status == "processing" || paymentInfo.Status == "success" {
+			util.LOGGER.Info("booking is being paid, skip expiry", "task", ExpireBooking, "booking_id", booking.ID)
+			return nil
+		}
+	}
+
+	for _, paymentInfo := range booking.Payments {
+		if paymentInfo.Status != "pending" {
+			continue
+		}
+		if paymentInfo.TransactionID != "" {
+			if err := payment.CancelPaymentIntent(paymentInfo.TransactionID); err != nil {
+				return fmt.Errorf("cancel payment intent of payment %s: %w", paymentInfo.ID, err)
+			}
+		}
+		err := SetPaymentStatusPayload{
+			PaymentID:      paymentInfo.ID,
+			Status:         "failed",
+			PreviousStatus: "pending",
+			Reason:         "booking expired",
+		}.execute(processor)
+		if err != nil {
+			return err
+		}
+	}
+
+	release := ReleaseTicketsPayload{Reason: "booking expired"}
+	ticketIDs := []string{}
+	for _, item := range booking.BookingItems {
+		if item.Status == "refunded" {
+			continue
+		}
+		release.BookingItemIDs = append(release.BookingItemIDs, item.ID)
+		if item.Seat != nil {
+			release.SeatIDs = append(release.SeatIDs, item.Seat.ID)
+		}
+		if item.Ticket != nil {
+			ticketIDs = append(ticketIDs, item.Ticket.ID)
+		}
+	}
+	if err := release.execute(processor); err != nil {
+		return err
+	}
+	if err := processor.patchItem("bookings", booking.ID, map[string]any{"status": "canceled"}); err != nil {
+		return err
+	}
+
+	// The booking is canceled from here, so a retry would skip the offers. The failures are only logged
+	for _, ticketID := range ticketIDs {
+		err := processor.distributor.DistributeTask(
+			context.Background(),
+			OfferWaitlist,
+			OfferWaitlistPayload{TicketID: ticketID},
+			asynq.Queue(HIGH_IMPACT),
+			asynq.MaxRetry(5),
+		)
+		if err != nil {
+			util.LOGGER.Error("failed to distribute waitlist offer", "task", ExpireBooking, "ticket_id", ticketID, "error", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,250 @@
+package worker
+
+import (
+	"archive/zip"
+	"bytes"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/url"
+	"strconv"
+	"strings"
+	"tekticket/db"
+	"tekticket/util"
+	"time"
+)
+
+type ExportUserDataPayload struct {
+	UserID       string `json:"user_id"`
+	Format       string `json:"format"`
+	Username     string `json:"username"`
+	DownloadLink string `json:"download_link"`
+	ExpiresIn    string `json:"expires_in"`
+}
+
+type DeleteDataExportsPayload struct {
+	UserID string `json:"user_id"`
+	Before int64  `json:"before"` // Unix time, only the exports uploaded before are deleted
+}
+
+const (
+	ExportUserData    = "export-user-data"
+	DeleteDataExports = "delete-data-exports"
+)
+
+// Data export formats
+const (
+	DATA_EXPORT_FORMAT_ZIP  = "zip"
+	DATA_EXPORT_FORMAT_JSON = "json"
+)
+
+// How long the download link of a data export is valid. The export is deleted after that
+const DATA_EXPORT_LINK_TTL = 24 * time.Hour
+
+var ErrInvalidDataExportToken = errors.New("invalid or expired data export token")
+
+//go:embed data_export.html
+var dataExportFS embed.FS
+
+// Collections included in a data export, along with the filter that selects the records of the user.
+// Financial records are exported as-is, they are the user's data as much as the profile is
+var dataExportSections = []struct {
+	Name       string
+	Collection string
+	Filter     string
+}{
+	{"bookings", "items/bookings", "filter[customer_id][_eq]"},
+	{"booking_items", "items/booking_items", "filter[booking_id][customer_id][_eq]"},
+	{"payments", "items/payments", "filter[booking_id][customer_id][_eq]"},
+	{"refunds", "items/refunds", "filter[payment_id][booking_id][customer_id][_eq]"},
+	{"checkins", "items/checkins", "filter[booking_item_id][booking_id][customer_id][_eq]"},
+	{"membership_logs", "items/user_membership_logs", "filter[customer_id][_eq]"},
+	{"telegram_links", "items/user_telegrams", "filter[user_id][_eq]"},
+	{"social_identities", "items/user_identities", "filter[user_id][_eq]"},
+}
+
+// Helper: the filename prefix of the data exports of a user, used to find them for cleanup
+func dataExportPrefix(userID string) string {
+	return fmt.Sprintf("data-export-%s-", userID)
+}
+
+// Helper method: generate the download token of a data export: the file ID, the owner and the expiration time, encrypted
+func (processor *RedisTaskProcessor) generateDataExportToken(fileID, userID string) (string, error) {
+	rawToken := fmt.Sprintf("%s#%s#%d", fileID, userID, time.Now().Add(DATA_EXPORT_LINK_TTL).Unix())
+	encrypt, err := util.Encrypt([]byte(processor.config.SecretKey), []byte(rawToken))
+	if err != nil {
+		return "", err
+	}
+
+	return util.Encode(string(encrypt)), nil
+}
+
+// Verify the download token of a data export. Return the file ID and the user ID
+func VerifyDataExportToken(token, secretKey string) (string, string, error) {
+	decodeToken, err := util.Decode(token)
+	if err != nil {
+		return "", "", ErrInvalidDataExportToken
+	}
+
+	raw, err := util.Decrypt([]byte(secretKey), []byte(decodeToken))
+	if err != nil {
+		return "", "", ErrInvalidDataExportToken
+	}
+
+	segments := strings.Split(string(raw), "#")
+	if len(segments) != 3 {
+		return "", "", ErrInvalidDataExportToken
+	}
+
+	expiresAt, err := strconv.ParseInt(segments[2], 10, 64)
+	if err != nil || time.Now().After(time.Unix(expiresAt, 0)) {
+		return "", "", ErrInvalidDataExportToken
+	}
+
+	return segments[0], segments[1], nil
+}
+
+// Helper method: collect every record we store about the user
+func (processor *RedisTaskProcessor) collectUserData(userID string) (map[string]any, error) {
+	data := map[string]any{"exported_at": time.Now().UTC().Format(time.RFC3339)}
+
+	// User record. The fields are listed explicitly, so that secrets (password hash, 2FA secret, static token) never leak
+	fields := []string{
+		"id", "first_name", "last_name", "email", "location", "avatar", "status", "role.name", "last_access", "provider",
+	}
+	var user map[string]any
+	url := fmt.Sprintf("%s/users/%s?fields=%s", processor.config.DirectusAddr, userID, strings.Join(fields, ","))
+	if _, err := db.MakeRequest("GET", url, nil, processor.config.DirectusStaticToken, &user); err != nil {
+		return nil, err
+	}
+	data["user"] = user
+
+	for _, section := range dataExportSections {
+		var records []map[string]any
+		url := fmt.Sprintf(
+			"%s/%s?fields=*&limit=-1&%s=%s",
+			processor.config.DirectusAddr,
+			section.Collection,
+			section.Filter,
+			userID,
+		)
+		if _, err := db.MakeRequest("GET", url, nil, processor.config.DirectusStaticToken, &records); err != nil {
+			return nil, err
+		}
+		data[section.Name] = records
+	}
+
+	return data, nil
+}
+
+// Build the archive of a data export: a single JSON document, or a ZIP with one JSON file per section.
+// Return the archive, its content type and file extension
+func BuildDataExportArchive(data map[string]any, format string) ([]byte, string, string, error) {
+	if format == DATA_EXPORT_FORMAT_JSON {
+		content, err := json.MarshalIndent(data, "", "  ")
+		if err != nil {
+			return nil, "", "", err
+		}
+		return content, "application/json", "json", nil
+	}
+
+	var buffer bytes.Buffer
+	writer := zip.NewWriter(&buffer)
+	for name, section := range data {
+		content, err := json.MarshalIndent(section, "", "  ")
+		if err != nil {
+			return nil, "", "", err
+		}
+
+		file, err := writer.Create(name + ".json")
+		if err != nil {
+			return nil, "", "", err
+		}
+		if _, err := file.Write(content); err != nil {
+			return nil, "", "", err
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, "", "", err
+	}
+	return buffer.Bytes(), "application/zip", "zip", nil
+}
+
+// Export every data of the user, upload the archive and email the download link
+func (processor *RedisTaskProcessor) ExportUserData(payload ExportUserDataPayload) error {
+	data, err := processor.collectUserData(payload.UserID)
+	if err != nil {
+		return err
+	}
+
+	archive, contentType, extension, err := BuildDataExportArchive(data, payload.Format)
+	if err != nil {
+		return err
+	}
+
+	// Upload the archive
+	filename := fmt.Sprintf("%s%d.%s", dataExportPrefix(payload.UserID), time.Now().Unix(), extension)
+	fileID, status, err := processor.uploadService.UploadFile(filename, contentType, archive)
+	if err != nil {
+		util.LOGGER.Error("failed to upload data export", "status", status, "error", err)
+		return err
+	}
+
+	// Create download link
+	token, err := processor.generateDataExportToken(fileID, payload.UserID)
+	if err != nil {
+		return err
+	}
+	payload.DownloadLink = fmt.Sprintf("%s/api/exports/download?token=%s", processor.config.ServerDomain, token)
+	payload.ExpiresIn = util.FormatDuration(DATA_EXPORT_LINK_TTL)
+	payload.Format = strings.ToUpper(extension)
+
+	user, _ := data["user"].(map[string]any)
+	email, _ := user["email"].(string)
+	if payload.Username == "" {
+		firstname, _ := user["first_name"].(string)
+		lastname, _ := user["last_name"].(string)
+		payload.Username = strings.TrimSpace(firstname + " " + lastname)
+	}
+
+	// Prepare the HTML email body
+	tmpl, err := template.ParseFS(dataExportFS, "data_export.html")
+	if err != nil {
+		return err
+	}
+	var buffer bytes.Buffer
+	if err = tmpl.Execute(&buffer, payload); err != nil {
+		return err
+	}
+
+	return processor.mailService.SendEmail(email, "Your data export is ready", buffer.String())
+}
+
+// Delete the data exports of the user uploaded before the given time
+func (processor *RedisTaskProcessor) DeleteDataExports(payload DeleteDataExportsPayload) error {
+	params := url.Values{}
+	params.Add("fields", "id")
+	params.Add("limit", "-1")
+	params.Add("filter[filename_download][_starts_with]", dataExportPrefix(payload.UserID))
+	params.Add("filter[uploaded_on][_lte]", time.Unix(payload.Before, 0).UTC().Format(time.RFC3339))
+
+	var files []db.DirectusImage
+	url := fmt.Sprintf("%s/files?%s", processor.config.DirectusAddr, params.Encode())
+	if status, err := db.MakeRequest("GET", url, nil, processor.config.DirectusStaticToken, &files); err != nil {
+		util.LOGGER.Error("failed to list data exports", "status", status, "error", err)
+		return err
+	}
+
+	for _, file := range files {
+		url := fmt.Sprintf("%s/files/%s", processor.config.DirectusAddr, file.ID)
+		if status, err := db.MakeRequest("DELETE", url, nil, processor.config.DirectusStaticToken, nil); err != nil {
+			util.LOGGER.Error("failed to delete data export", "id", file.ID, "status", status, "error", err)
+			return err
+		}
+	}
+
+	return nil
+}
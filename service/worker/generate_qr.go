@@ -1,14 +1,17 @@
 package worker
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	neturl "net/url"
 	"strings"
 	"sync"
 	"tekticket/db"
 	"tekticket/util"
 
 	"github.com/google/uuid"
+	"github.com/hibiken/asynq"
 )
 
 type PublishQRTicketPayload struct {
@@ -19,8 +22,13 @@ type PublishQRTicketPayload struct {
 const PublishQRTicket = "publish-qr-ticket"
 
 func (processor *RedisTaskProcessor) generateQRToken(bookingItemID string) (string, error) {
+	return GenerateQRToken(bookingItemID, processor.config.SecretKey)
+}
+
+// Generate the check-in token of a booking item, the token of its QR
+func GenerateQRToken(bookingItemID, secretKey string) (string, error) {
 	// Generate token: encrypt AES booking_item_id
-	encryption, err := util.Encrypt([]byte(processor.config.SecretKey), []byte(bookingItemID))
+	encryption, err := util.Encrypt([]byte(secretKey), []byte(bookingItemID))
 	if err != nil {
 		return "", err
 	}
@@ -53,6 +61,7 @@ func (processor *RedisTaskProcessor) PublishQRTickets(payload PublishQRTicketPay
 		wg        = sync.WaitGroup{}
 		mutex     = sync.Mutex{}
 		qrMapping = map[string]string{}
+		tokens    = map[string]string{}
 		errs      = make(chan error, len(payload.BookingItemIDs))
 	)
 
@@ -98,6 +107,7 @@ func (processor *RedisTaskProcessor) PublishQRTickets(payload PublishQRTicketPay
 			// Record the mapping payload into the map
 			mutex.Lock()
 			qrMapping[bookingItem] = respID
+			tokens[bookingItem] = token
 			mutex.Unlock()
 		}(bookingItem)
 	}
@@ -125,9 +135,10 @@ func (processor *RedisTaskProcessor) PublishQRTickets(payload PublishQRTicketPay
 	body := []map[string]any{}
 	for bookingItemID, mappingData := range qrMapping {
 		body = append(body, map[string]any{
-			"id":     bookingItemID,
-			"qr":     mappingData,
-			"status": "valid",
+			"id":            bookingItemID,
+			"qr":            mappingData,
+			"checkin_token": tokens[bookingItemID], // Embedded in the wallet passes of the item
+			"status":        "valid",
 		})
 	}
 	status, err := db.MakeRequest("PATCH", url, body, processor.config.DirectusStaticToken, nil)
@@ -136,5 +147,38 @@ func (processor *RedisTaskProcessor) PublishQRTickets(payload PublishQRTicketPay
 		return err
 	}
 
+	// Render the ticket documents of the bookings. The QRs are already published, so a failure here must not retry this task
+	queryParams := neturl.Values{}
+	queryParams.Add("fields", "booking_id")
+	queryParams.Add("filter[id][_in]", strings.Join(payload.BookingItemIDs, ","))
+	queryParams.Add("limit", "-1")
+	url = fmt.Sprintf("%s/items/booking_items?%s", processor.config.DirectusAddr, queryParams.Encode())
+	var items []struct {
+		BookingID string `json:"booking_id"`
+	}
+	if status, err := db.MakeRequest("GET", url, nil, processor.config.DirectusStaticToken, &items); err != nil {
+		util.LOGGER.Error("failed to get bookings of the tickets", "task", PublishQRTicket, "status", status, "error", err)
+		return nil
+	}
+
+	bookings := map[string]bool{}
+	for _, item := range items {
+		if item.BookingID == "" || bookings[item.BookingID] {
+			continue
+		}
+		bookings[item.BookingID] = true
+
+		err := processor.distributor.DistributeTask(
+			context.Background(),
+			GenerateTicketPDF,
+			GenerateTicketPDFPayload{BookingID: item.BookingID},
+			asynq.Queue(MEDIUM_IMPACT),
+			asynq.MaxRetry(5),
+		)
+		if err != nil {
+			util.LOGGER.Error("failed to distribute task", "task", GenerateTicketPDF, "booking_id", item.BookingID, "error", err)
+		}
+	}
+
 	return nil
 }
@@ -1,16 +1,25 @@
 package worker
 
 import (
+	"archive/zip"
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"slices"
 	"strings"
 	"tekticket/db"
 	"tekticket/service/bot"
 	"tekticket/service/notify"
+	"tekticket/service/otp"
 	"tekticket/service/uploader"
+	"tekticket/service/wallet"
 	"tekticket/util"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/hibiken/asynq"
@@ -74,12 +83,15 @@ func TestMain(m *testing.M) {
 
 // Test: send verify email with random OTP
 func TestSendVerifyEmail(t *testing.T) {
+	code, err := otp.GenerateCode()
+	require.NoError(t, err)
+
 	// Send email
-	err := processor.(*RedisTaskProcessor).SendVerifyEmail(SendVerifyEmailPayload{
+	err = processor.(*RedisTaskProcessor).SendVerifyEmail(SendVerifyEmailPayload{
 		ID:       util.RandomString(12),
 		Email:    os.Getenv("RECEIVE_EMAIL"),
 		Username: util.RandomString(10),
-		OTP:      util.GenerateRandomOTP(),
+		OTP:      code,
 	})
 	require.NoError(t, err)
 }
@@ -138,3 +150,429 @@ func TestVerifyQRToken(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, bookingItem, result)
 }
+
+// Test: a reset password token can only be consumed once
+func TestConsumeResetPasswordToken(t *testing.T) {
+	// Generate random test data
+	id := uuid.New().String()
+	email := util.RandomString(12)
+	secretKey := processor.(*RedisTaskProcessor).config.SecretKey
+	cache := processor.(*RedisTaskProcessor).queries.Cache
+
+	// Generate token
+	token, err := processor.(*RedisTaskProcessor).generateResetPasswordToken(id, email)
+	require.NoError(t, err)
+
+	// Consume token
+	userID, err := ConsumeResetPasswordToken(ctx, cache, token, secretKey)
+	require.NoError(t, err)
+	require.Equal(t, id, userID)
+
+	// Consume it again
+	_, err = ConsumeResetPasswordToken(ctx, cache, token, secretKey)
+	require.ErrorIs(t, err, ErrResetTokenExpired)
+
+	// Tampered token
+	_, err = ConsumeResetPasswordToken(ctx, cache, util.Encode(util.RandomString(40)), secretKey)
+	require.ErrorIs(t, err, ErrInvalidResetToken)
+}
+
+// Test: issuing a new reset password token, or revoking it, invalidate the previous token
+func TestRevokeResetPasswordToken(t *testing.T) {
+	// Generate random test data
+	id := uuid.New().String()
+	email := util.RandomString(12)
+	secretKey := processor.(*RedisTaskProcessor).config.SecretKey
+	cache := processor.(*RedisTaskProcessor).queries.Cache
+
+	// Issue 2 tokens, only the latest one is valid
+	first, err := processor.(*RedisTaskProcessor).generateResetPasswordToken(id, email)
+	require.NoError(t, err)
+	second, err := processor.(*RedisTaskProcessor).generateResetPasswordToken(id, email)
+	require.NoError(t, err)
+
+	_, err = ConsumeResetPasswordToken(ctx, cache, first, secretKey)
+	require.ErrorIs(t, err, ErrResetTokenExpired)
+
+	// Revoke the latest token
+	require.NoError(t, RevokeResetPasswordToken(ctx, cache, id))
+	_, err = ConsumeResetPasswordToken(ctx, cache, second, secretKey)
+	require.ErrorIs(t, err, ErrResetTokenExpired)
+}
+
+// Test: data export download token
+func TestDataExportToken(t *testing.T) {
+	// Generate random test data
+	fileID := uuid.New().String()
+	userID := uuid.New().String()
+	secretKey := processor.(*RedisTaskProcessor).config.SecretKey
+
+	// Generate token
+	token, err := processor.(*RedisTaskProcessor).generateDataExportToken(fileID, userID)
+	require.NoError(t, err)
+	require.NotEmpty(t, token)
+
+	// Verify token
+	gotFileID, gotUserID, err := VerifyDataExportToken(token, secretKey)
+	require.NoError(t, err)
+	require.Equal(t, fileID, gotFileID)
+	require.Equal(t, userID, gotUserID)
+
+	// Tampered token
+	_, _, err = VerifyDataExportToken(token[:len(token)-4]+"abcd", secretKey)
+	require.ErrorIs(t, err, ErrInvalidDataExportToken)
+}
+
+// Test: build data export archive in both formats
+func TestBuildDataExportArchive(t *testing.T) {
+	data := map[string]any{
+		"user":     map[string]any{"id": uuid.New().String(), "email": "john.doe@example.com"},
+		"bookings": []map[string]any{{"id": uuid.New().String(), "status": "completed"}},
+	}
+
+	// JSON: a single document
+	archive, contentType, extension, err := BuildDataExportArchive(data, DATA_EXPORT_FORMAT_JSON)
+	require.NoError(t, err)
+	require.Equal(t, "application/json", contentType)
+	require.Equal(t, "json", extension)
+
+	var document map[string]any
+	require.NoError(t, json.Unmarshal(archive, &document))
+	require.Contains(t, document, "user")
+	require.Contains(t, document, "bookings")
+
+	// ZIP: one file per section
+	archive, contentType, extension, err = BuildDataExportArchive(data, DATA_EXPORT_FORMAT_ZIP)
+	require.NoError(t, err)
+	require.Equal(t, "application/zip", contentType)
+	require.Equal(t, "zip", extension)
+
+	reader, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	require.NoError(t, err)
+
+	names := []string{}
+	for _, file := range reader.File {
+		names = append(names, file.Name)
+	}
+	require.ElementsMatch(t, []string{"user.json", "bookings.json"}, names)
+}
+
+// Test: render the ticket document of a booking, one page per ticket
+func TestBuildTicketPDF(t *testing.T) {
+	start := db.DateTime(time.Date(2025, 12, 31, 20, 0, 0, 0, time.UTC))
+	booking := db.Booking{
+		ID:    uuid.New().String(),
+		Event: &db.Event{Name: "Đêm nhạc Trịnh", Address: "1 Tràng Tiền", City: "Hà Nội", Country: "Việt Nam"},
+		BookingItems: []db.BookingItem{
+			{ID: uuid.New().String(), Price: 1500000, Ticket: &db.Ticket{Rank: "VIP"}, Seat: &db.Seat{Row: "A", SeatNumber: "A1"}, EventSchedule: &db.EventSchedule{StartTime: &start}},
+			{ID: uuid.New().String(), Price: 500000, Ticket: &db.Ticket{Rank: "Standard"}, Seat: &db.Seat{SeatNumber: "B7"}},
+		},
+	}
+
+	qrs := map[string][]byte{}
+	for _, item := range booking.BookingItems {
+		qr, err := util.GenerateQR("https://example.com/checkin?token=" + item.ID)
+		require.NoError(t, err)
+		qrs[item.ID] = qr
+	}
+
+	document, err := BuildTicketPDF(booking, qrs)
+	require.NoError(t, err)
+	require.True(t, bytes.HasPrefix(document, []byte("%PDF-")))
+	require.Contains(t, string(document), "/Count 2")
+
+	// Every ticket needs its QR
+	delete(qrs, booking.BookingItems[1].ID)
+	_, err = BuildTicketPDF(booking, qrs)
+	require.Error(t, err)
+
+	require.Equal(t, "1.500.000 VND", formatVND(1500000))
+	require.Equal(t, "500 VND", formatVND(500))
+}
+
+// Test: loyalty points of a payment, and the payment confirming a booking
+func TestConfirmBookingPayment(t *testing.T) {
+	require.Equal(t, 150, BookingPoints(1500000, 10000))
+	require.Equal(t, 0, BookingPoints(1500000, 0))
+	require.Equal(t, 0, BookingPoints(9999, 10000))
+
+	booking := db.Booking{Payments: []db.Payment{
+		{ID: "failed", Status: "failed"},
+		{ID: "processing", Status: "processing"},
+		{ID: "success", Status: "success"},
+	}}
+	require.Equal(t, "success", getBookingPayment(booking, "").ID)
+	require.Equal(t, "processing", getBookingPayment(booking, "processing").ID)
+	require.Equal(t, "success", getBookingPayment(booking, "success").ID)
+	require.Nil(t, getBookingPayment(booking, "failed"))
+	require.Nil(t, getBookingPayment(db.Booking{}, ""))
+}
+
+func TestCommandCompensation(t *testing.T) {
+	processing := SetPaymentStatusPayload{PaymentID: "payment", Status: "processing", PreviousStatus: "pending"}
+	compensation := processing.Compensation()
+	require.Equal(t, SetPaymentStatus, compensation.TaskName())
+	require.Equal(t, "payment", compensation.(SetPaymentStatusPayload).PaymentID)
+	require.Equal(t, "pending", compensation.(SetPaymentStatusPayload).Status)
+	require.Equal(t, "processing", compensation.Compensation().(SetPaymentStatusPayload).Status)
+
+	refunded := SetRefundStatusPayload{RefundID: "refund", Status: "success", PreviousStatus: "pending"}
+	require.Equal(t, SetRefundStatusPayload{RefundID: "refund", Status: "pending", PreviousStatus: "success", Reason: "compensate: "}, refunded.Compensation())
+	require.Nil(t, ReleaseTicketsPayload{}.Compensation())
+}
+
+func TestUpdatePaymentRecordCommand(t *testing.T) {
+	payload := UpdatePaymentRecordPayload{
+		URL:     "http://directus:8055/items/payments/payment",
+		Body:    map[string]any{"transaction_id": "pi_123", "status": "pending"},
+		Caller:  "POST /api/payments",
+		Context: "create payment intent",
+	}
+	command, err := payload.command()
+	require.NoError(t, err)
+	require.Equal(t, SetPaymentStatusPayload{
+		PaymentID:     "payment",
+		Status:        "pending",
+		TransactionID: "pi_123",
+		Reason:        "POST /api/payments: create payment intent",
+	}, command)
+
+	payload.URL, payload.Body = "http://directus:8055/items/refunds/refund", map[string]any{"status": "failed"}
+	command, err = payload.command()
+	require.NoError(t, err)
+	require.Equal(t, SetRefundStatus, command.TaskName())
+	require.Equal(t, "refund", command.(SetRefundStatusPayload).RefundID)
+
+	for _, url := range []string{"http://directus:8055/items/bookings/booking", "http://directus:8055/users/user", "%zz"} {
+		payload.URL = url
+		_, err = payload.command()
+		require.Error(t, err, url)
+	}
+}
+
+func TestEventCancellationReport(t *testing.T) {
+	redisProcessor := processor.(*RedisTaskProcessor)
+	eventID := uuid.NewString()
+	key := cancellationKey(eventID)
+	defer redisProcessor.queries.Cache.Del(ctx, key, key+":refunded", key+":failures", key+":late")
+
+	cancellation, err := GetEventCancellation(ctx, redisProcessor.queries.Cache, eventID)
+	require.NoError(t, err)
+	require.Nil(t, cancellation)
+
+	err = redisProcessor.queries.Cache.HSet(ctx, key,
+		"status", CANCELLATION_STATUS_IN_PROGRESS, "total_payments", 2, "paid_amount", 300000, "refunded_amount", 100000,
+	).Err()
+	require.NoError(t, err)
+	require.NoError(t, redisProcessor.queries.Cache.SAdd(ctx, key+":refunded", "payment-1").Err())
+
+	// Not completed until every payment is refunded or failed
+	require.NoError(t, redisProcessor.completeCancellation(ctx, eventID))
+	cancellation, err = GetEventCancellation(ctx, redisProcessor.queries.Cache, eventID)
+	require.NoError(t, err)
+	require.Equal(t, CANCELLATION_STATUS_IN_PROGRESS, cancellation.Status)
+	require.Equal(t, 1, cancellation.RefundedPayments)
+
+	require.NoError(t, redisProcessor.failEventRefund(RefundEventPaymentPayload{EventID: eventID, PaymentID: "payment-2"}, asynq.SkipRetry))
+	cancellation, err = GetEventCancellation(ctx, redisProcessor.queries.Cache, eventID)
+	require.NoError(t, err)
+	require.Equal(t, CANCELLATION_STATUS_COMPLETED, cancellation.Status)
+	require.Equal(t, 1, cancellation.FailedPayments)
+	require.Equal(t, "payment-2", cancellation.Failures[0].PaymentID)
+	require.Equal(t, 100000, cancellation.RefundedAmount)
+
+	// A payment succeeding after the cancellation is counted once, and the cancellation waits for its refund
+	for range 2 {
+		require.NoError(t, redisProcessor.countLateEventPayment(eventID, db.Payment{ID: "payment-3", Amount: 50000}))
+	}
+	cancellation, err = GetEventCancellation(ctx, redisProcessor.queries.Cache, eventID)
+	require.NoError(t, err)
+	require.Equal(t, CANCELLATION_STATUS_IN_PROGRESS, cancellation.Status)
+	require.Empty(t, cancellation.FinishedAt)
+	require.Equal(t, 3, cancellation.TotalPayments)
+	require.Equal(t, 350000, cancellation.PaidAmount)
+
+	// Nothing to count for an event that was not canceled
+	require.NoError(t, redisProcessor.countLateEventPayment(uuid.NewString(), db.Payment{ID: "payment-4"}))
+}
+
+// Test: the resale step only applies to the purchases of resale listings, and moves the ticket before it is issued
+func TestConfirmBookingResaleStep(t *testing.T) {
+	require.Less(t, slices.Index(ConfirmBookingSteps, CONFIRM_STEP_PAYMENT), slices.Index(ConfirmBookingSteps, CONFIRM_STEP_RESALE))
+	require.Less(t, slices.Index(ConfirmBookingSteps, CONFIRM_STEP_RESALE), slices.Index(ConfirmBookingSteps, CONFIRM_STEP_TICKETS))
+
+	booking := db.Booking{ID: "booking", BookingItems: []db.BookingItem{{ID: "item", Status: "valid"}}}
+	require.NoError(t, processor.(*RedisTaskProcessor).completeResale(&booking, db.Payment{}, ConfirmBookingPayload{}))
+	require.Len(t, booking.BookingItems, 1)
+}
+
+// Request received by the fake Directus
+type directusRequest struct {
+	Method string
+	Path   string
+	Body   map[string]any
+}
+
+// Distributor recording the distributed tasks instead of enqueuing them
+type recordingDistributor struct {
+	tasks []string
+}
+
+func (distributor *recordingDistributor) DistributeTask(ctx context.Context, taskName string, payload any, opts ...asynq.Option) error {
+	distributor.tasks = append(distributor.tasks, taskName)
+	return nil
+}
+
+// Helper function: a copy of the processor talking to a fake Directus, which answers the GET requests of a path with
+// the given item, and records the other requests and answers them with a created item
+func newFakeDirectusProcessor(t *testing.T, items map[string]any) (*RedisTaskProcessor, *recordingDistributor, *[]directusRequest) {
+	requests := []directusRequest{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+		data, ok := items[r.URL.Path]
+		if r.Method != "GET" {
+			requests = append(requests, directusRequest{Method: r.Method, Path: r.URL.Path, Body: body})
+			data, ok = map[string]any{"id": uuid.NewString()}, true
+		}
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]any{"errors": []map[string]any{{"message": "not found"}}})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"data": data})
+	}))
+	t.Cleanup(server.Close)
+
+	copied := *processor.(*RedisTaskProcessor)
+	config := *copied.config
+	config.DirectusAddr = server.URL
+	config.PaymentFeePercent = 10
+	copied.config = &config
+	distributor := &recordingDistributor{}
+	copied.distributor = distributor
+	return &copied, distributor, &requests
+}
+
+// Test: the purchase of a resale listing is paid in full before the ticket moves to the buyer with a new QR
+func TestCompleteResale(t *testing.T) {
+	itemID, checkinToken := uuid.NewString(), uuid.NewString()
+	listing := db.ResaleListing{
+		ID:          "listing",
+		Status:      RESALE_STATUS_ACTIVE,
+		Price:       100000,
+		Booking:     &db.Booking{ID: "buyer-booking"},
+		FromBooking: &db.Booking{ID: "seller-booking"},
+		BookingItem: &db.BookingItem{
+			ID: itemID, Status: "valid", CheckinToken: checkinToken, Booking: &db.Booking{ID: "seller-booking"},
+		},
+	}
+	redisProcessor, distributor, requests := newFakeDirectusProcessor(t, map[string]any{"/items/resale_listings/listing": &listing})
+	booking := db.Booking{ID: "buyer-booking", ResaleListing: &db.ResaleListing{ID: "listing"}}
+
+	// The payment must cover the price and the fee of the listing
+	err := redisProcessor.completeResale(&booking, db.Payment{Amount: 109999}, ConfirmBookingPayload{})
+	require.ErrorIs(t, err, ErrResaleUnderpaid)
+	require.ErrorIs(t, err, asynq.SkipRetry)
+	require.Empty(t, *requests)
+	require.Empty(t, distributor.tasks)
+	require.Empty(t, booking.BookingItems)
+
+	// The wallet pass of the seller is revoked, and the ticket moves without its QR
+	serialNumber := wallet.SerialNumber(itemID, checkinToken)
+	defer redisProcessor.queries.Cache.Del(ctx, "wallet:devices:device", "wallet:devices:device:passes")
+	_, err = redisProcessor.walletRegistry.Register(ctx, "device", "push-token", serialNumber)
+	require.NoError(t, err)
+
+	require.NoError(t, redisProcessor.completeResale(&booking, db.Payment{Amount: 110000}, ConfirmBookingPayload{}))
+	devices, err := redisProcessor.queries.Cache.SMembers(ctx, fmt.Sprintf("wallet:passes:%s", serialNumber)).Result()
+	require.NoError(t, err)
+	require.Empty(t, devices)
+
+	require.Len(t, *requests, 2)
+	require.Equal(t, directusRequest{
+		Method: "PATCH",
+		Path:   "/items/booking_items/" + itemID,
+		Body:   map[string]any{"booking_id": "buyer-booking", "status": "pending", "qr": nil, "checkin_token": nil},
+	}, (*requests)[0])
+	require.Equal(t, "/items/resale_listings/listing", (*requests)[1].Path)
+	require.Equal(t, RESALE_STATUS_SOLD, (*requests)[1].Body["status"])
+	require.Equal(t, []string{PayOutResale}, distributor.tasks)
+	require.Equal(t, []db.BookingItem{{ID: itemID, Status: "pending"}}, booking.BookingItems)
+
+	// A retry after the ticket moved only schedules the payout again
+	*requests = (*requests)[:0]
+	listing.Status = RESALE_STATUS_SOLD
+	listing.BookingItem.Booking = &db.Booking{ID: "buyer-booking"}
+	booking.BookingItems = nil
+	require.NoError(t, redisProcessor.completeResale(&booking, db.Payment{Amount: 110000}, ConfirmBookingPayload{}))
+	require.Empty(t, *requests)
+	require.Equal(t, []string{PayOutResale, PayOutResale}, distributor.tasks)
+	require.Len(t, booking.BookingItems, 1)
+
+	// A ticket that left the booking of the seller can't be sold
+	listing.Status = RESALE_STATUS_ACTIVE
+	listing.BookingItem.Booking = &db.Booking{ID: "other-booking"}
+	err = redisProcessor.completeResale(&booking, db.Payment{Amount: 110000}, ConfirmBookingPayload{})
+	require.ErrorIs(t, err, ErrResaleUnavailable)
+	require.Empty(t, *requests)
+}
+
+// Test: the payout of a listing is refunded up to what the seller paid for the ticket, and a refund record is reused
+// unless it failed
+func TestRefundResalePayout(t *testing.T) {
+	redisProcessor, _, requests := newFakeDirectusProcessor(t, nil)
+	listing := db.ResaleListing{
+		ID:          "listing",
+		Payout:      90000,
+		BookingItem: &db.BookingItem{ID: "item", Price: 120000},
+		FromBooking: &db.Booking{Payments: []db.Payment{
+			{ID: "failed", Status: "failed", Amount: 500000},
+			{ID: "paid", Status: "success", Amount: 150000, TransactionID: "pi_invalid", Refunds: []db.Refund{
+				{ID: "refunded", Status: "success", Amount: 100000},
+				{ID: "failed", Status: "failed", Amount: 20000},
+			}},
+		}},
+	}
+
+	// A settled refund record is reused, without refunding again
+	listing.Refund = &db.Refund{ID: "refund", Status: "success", Amount: 50000}
+	refunded, err := redisProcessor.refundResalePayout(listing)
+	require.NoError(t, err)
+	require.Equal(t, 50000, refunded)
+	require.Empty(t, *requests)
+
+	// A failed one is replaced by a refund of what is left of the payment of the seller, here below the payout
+	listing.Refund.Status = "failed"
+	_, err = redisProcessor.refundResalePayout(listing)
+	require.Error(t, err) // The transaction is unknown to Stripe
+	require.Len(t, *requests, 2)
+	require.Equal(t, "POST", (*requests)[0].Method)
+	require.Equal(t, "/items/refunds", (*requests)[0].Path)
+	require.EqualValues(t, 50000, (*requests)[0].Body["amount"])
+	require.Equal(t, "paid", (*requests)[0].Body["payment_id"])
+	require.Equal(t, RESALE_REFUND_REASON, (*requests)[0].Body["reason"])
+	require.Equal(t, "/items/resale_listings/listing", (*requests)[1].Path)
+
+	// The refund is capped at the price paid for the ticket
+	*requests = (*requests)[:0]
+	listing.Refund = nil
+	listing.Payout = 200000
+	listing.FromBooking.Payments[1].Refunds = nil
+	_, err = redisProcessor.refundResalePayout(listing)
+	require.Error(t, err)
+	require.EqualValues(t, 120000, (*requests)[0].Body["amount"])
+
+	// Nothing is refunded to a seller who received the ticket by a transfer, or whose payment is fully refunded
+	*requests = (*requests)[:0]
+	listing.FromBooking.Payments[1].Refunds = []db.Refund{{Status: "success", Amount: 150000}}
+	refunded, err = redisProcessor.refundResalePayout(listing)
+	require.NoError(t, err)
+	require.Zero(t, refunded)
+
+	listing.FromBooking = &db.Booking{ID: "transfer"}
+	refunded, err = redisProcessor.refundResalePayout(listing)
+	require.NoError(t, err)
+	require.Zero(t, refunded)
+	require.Empty(t, *requests)
+}
@@ -1,10 +1,17 @@
 package worker
 
 import (
-	"tekticket/db"
-	"tekticket/util"
+	"fmt"
+	neturl "net/url"
+	"strings"
 )
 
+/*
+ * Legacy payment record updates, replaced by the domain commands. The tasks still queued by the previous release are
+ * forwarded to SetPaymentStatus or SetRefundStatus, with the static token rather than the queued user token.
+ * Deprecated: to be removed in the next release, once the queues are drained.
+ */
+
 type UpdatePaymentRecordPayload struct {
 	URL     string         `json:"url"`
 	Body    map[string]any `json:"body"`
@@ -15,32 +22,46 @@ type UpdatePaymentRecordPayload struct {
 
 const UpdatePaymentRecord = "update-payment-record"
 
-// This method is for database rollback when payment (create, confirm, refund) failed
+// Forward a legacy payment record update to the command of its collection
 func (processor *RedisTaskProcessor) RetryUpdatePaymentRecord(payload UpdatePaymentRecordPayload) error {
-	// Log start
-	util.LOGGER.Info("background log", "task", UpdatePaymentRecord, "caller", payload.Caller, "context", payload.Context)
-
-	// Make request
-	status, err := db.MakeRequest("PATCH", payload.URL, payload.Body, payload.Token, nil)
+	command, err := payload.command()
 	if err != nil {
-		util.LOGGER.Error(
-			"background log info",
-			"task", UpdatePaymentRecord,
-			"caller", payload.Caller,
-			"context", payload.Context,
-			"status", status,
-			"error", err,
-		)
 		return err
 	}
+	return command.execute(processor)
+}
+
+// Helper method: the command of a legacy payment record update, from the URL of the payment or refund it updates
+func (payload UpdatePaymentRecordPayload) command() (Command, error) {
+	url, err := neturl.Parse(payload.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url %q: %w", payload.URL, err)
+	}
 
-	util.LOGGER.Info(
-		"background log",
-		"task", UpdatePaymentRecord,
-		"caller", payload.Caller,
-		"context", payload.Context,
-		"status", "success",
-	)
+	segments := strings.Split(strings.Trim(url.Path, "/"), "/")
+	if len(segments) < 3 || segments[len(segments)-3] != "items" {
+		return nil, fmt.Errorf("invalid url %q: not an item", payload.URL)
+	}
+	collection, id := segments[len(segments)-2], segments[len(segments)-1]
 
-	return nil
+	field := func(name string) string {
+		value, _ := payload.Body[name].(string)
+		return value
+	}
+	reason := fmt.Sprintf("%s: %s", payload.Caller, payload.Context)
+
+	switch collection {
+	case "payments":
+		return SetPaymentStatusPayload{
+			PaymentID:     id,
+			Status:        field("status"),
+			TransactionID: field("transaction_id"),
+			PaymentMethod: field("payment_method"),
+			Reason:        reason,
+		}, nil
+	case "refunds":
+		return SetRefundStatusPayload{RefundID: id, Status: field("status"), Reason: reason}, nil
+	default:
+		return nil, fmt.Errorf("invalid url %q: unknown collection %s", payload.URL, collection)
+	}
 }
@@ -3,10 +3,16 @@ package worker
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"tekticket/db"
 	"tekticket/service/bot"
 	"tekticket/service/notify"
+	"tekticket/service/otp"
+	"tekticket/service/promo"
+	"tekticket/service/session"
 	"tekticket/service/uploader"
+	"tekticket/service/waitlist"
+	"tekticket/service/wallet"
 	"tekticket/util"
 
 	"github.com/hibiken/asynq"
@@ -39,6 +45,9 @@ type RedisTaskProcessor struct {
 	// Asynq server
 	server *asynq.Server
 
+	// Distributor of the follow-up tasks
+	distributor TaskDistributor
+
 	// Dependencies
 	queries *db.Queries
 
@@ -47,6 +56,14 @@ type RedisTaskProcessor struct {
 	ablyService   *notify.AblyService
 	bot           *bot.Chatbot
 	uploadService *uploader.Uploader
+	otpManager    *otp.Manager
+	waitlist      *waitlist.Queue
+	promoCounter  *promo.Counter
+	sessions      *session.Manager
+
+	// Wallet passes
+	walletIssuer   *wallet.Issuer
+	walletRegistry *wallet.Registry
 
 	// Config
 	config *util.Config
@@ -63,13 +80,20 @@ func NewRedisTaskProcessor(
 	config *util.Config,
 ) TaskProcessor {
 	return &RedisTaskProcessor{
-		server:        asynq.NewServer(redisOpts, asynq.Config{Queues: Queues}),
-		queries:       queries,
-		mailService:   mailService,
-		uploadService: uploadService,
-		ablyService:   ablyService,
-		bot:           bot,
-		config:        config,
+		server:         asynq.NewServer(redisOpts, asynq.Config{Queues: Queues}),
+		distributor:    NewRedisTaskDistributor(redisOpts),
+		queries:        queries,
+		mailService:    mailService,
+		uploadService:  uploadService,
+		ablyService:    ablyService,
+		bot:            bot,
+		otpManager:     otp.NewManager(queries.Cache, config.SecretKey),
+		waitlist:       waitlist.NewQueue(queries.Cache),
+		promoCounter:   promo.NewCounter(queries.Cache),
+		sessions:       session.NewManager(queries.Cache, config.SecretKey, config.DirectusAddr, config.DirectusStaticToken),
+		walletIssuer:   wallet.NewIssuer(config),
+		walletRegistry: wallet.NewRegistry(queries.Cache),
+		config:         config,
 	}
 }
 
@@ -169,6 +193,24 @@ func (processor *RedisTaskProcessor) Start() error {
 		return nil
 	})
 
+	mux.HandleFunc(NotifyCustomer, func(ctx context.Context, t *asynq.Task) error {
+		// Unmarshal payload
+		var payload NotifyCustomerPayload
+		if err := json.Unmarshal(t.Payload(), &payload); err != nil {
+			util.LOGGER.Error("failed to unmarshal task's payload", "task", NotifyCustomer, "error", err)
+			return err
+		}
+
+		// Process
+		if err := processor.NotifyCustomer(payload); err != nil {
+			util.LOGGER.Error("failed to process task", "task", NotifyCustomer, "error", err)
+			return err
+		}
+
+		util.LOGGER.Info("task success", "task", NotifyCustomer)
+		return nil
+	})
+
 	mux.HandleFunc(PublishQRTicket, func(ctx context.Context, t *asynq.Task) error {
 		// Unmarshal payload
 		var payload PublishQRTicketPayload
@@ -188,21 +230,293 @@ func (processor *RedisTaskProcessor) Start() error {
 
 	})
 
+	mux.HandleFunc(GenerateTicketPDF, func(ctx context.Context, t *asynq.Task) error {
+		// Unmarshal payload
+		var payload GenerateTicketPDFPayload
+		if err := json.Unmarshal(t.Payload(), &payload); err != nil {
+			util.LOGGER.Error("failed to unmarshal task's payload", "task", GenerateTicketPDF, "error", err)
+			return err
+		}
+
+		// Process
+		if err := processor.GenerateTicketPDF(payload); err != nil {
+			util.LOGGER.Error("failed to process task", "task", GenerateTicketPDF, "error", err)
+			return err
+		}
+
+		util.LOGGER.Info("task success", "task", GenerateTicketPDF)
+		return nil
+	})
+
+	mux.HandleFunc(CancelEvent, func(ctx context.Context, t *asynq.Task) error {
+		// Unmarshal payload
+		var payload CancelEventPayload
+		if err := json.Unmarshal(t.Payload(), &payload); err != nil {
+			util.LOGGER.Error("failed to unmarshal task's payload", "task", CancelEvent, "error", err)
+			return err
+		}
+
+		// Process
+		if err := processor.CancelEvent(payload); err != nil {
+			util.LOGGER.Error("failed to process task", "task", CancelEvent, "error", err)
+			return err
+		}
+
+		util.LOGGER.Info("task success", "task", CancelEvent)
+		return nil
+	})
+
+	mux.HandleFunc(RefundEventPayment, func(ctx context.Context, t *asynq.Task) error {
+		// Unmarshal payload
+		var payload RefundEventPaymentPayload
+		if err := json.Unmarshal(t.Payload(), &payload); err != nil {
+			util.LOGGER.Error("failed to unmarshal task's payload", "task", RefundEventPayment, "error", err)
+			return err
+		}
+
+		// Process
+		if err := processor.RefundEventPayment(payload); err != nil {
+			util.LOGGER.Error("failed to process task", "task", RefundEventPayment, "payment_id", payload.PaymentID, "error", err)
+
+			// Out of retries: report the payment in the cancellation, to refund it manually
+			retried, _ := asynq.GetRetryCount(ctx)
+			maxRetry, _ := asynq.GetMaxRetry(ctx)
+			if retried >= maxRetry || errors.Is(err, asynq.SkipRetry) {
+				if err := processor.failEventRefund(payload, err); err != nil {
+					util.LOGGER.Error("failed to report refund failure", "task", RefundEventPayment, "payment_id", payload.PaymentID, "error", err)
+				}
+			}
+			return err
+		}
+
+		util.LOGGER.Info("task success", "task", RefundEventPayment, "payment_id", payload.PaymentID)
+		return nil
+	})
+
+	mux.HandleFunc(CancelEventBooking, func(ctx context.Context, t *asynq.Task) error {
+		// Unmarshal payload
+		var payload CancelEventBookingPayload
+		if err := json.Unmarshal(t.Payload(), &payload); err != nil {
+			util.LOGGER.Error("failed to unmarshal task's payload", "task", CancelEventBooking, "error", err)
+			return err
+		}
+
+		// Process
+		if err := processor.CancelEventBooking(payload); err != nil {
+			util.LOGGER.Error("failed to process task", "task", CancelEventBooking, "booking_id", payload.BookingID, "error", err)
+			return err
+		}
+
+		util.LOGGER.Info("task success", "task", CancelEventBooking, "booking_id", payload.BookingID)
+		return nil
+	})
+
+	mux.HandleFunc(PayOutResale, func(ctx context.Context, t *asynq.Task) error {
+		// Unmarshal payload
+		var payload PayOutResalePayload
+		if err := json.Unmarshal(t.Payload(), &payload); err != nil {
+			util.LOGGER.Error("failed to unmarshal task's payload", "task", PayOutResale, "error", err)
+			return err
+		}
+
+		// Process
+		if err := processor.PayOutResale(payload); err != nil {
+			util.LOGGER.Error("failed to process task", "task", PayOutResale, "listing_id", payload.ListingID, "error", err)
+			return err
+		}
+
+		util.LOGGER.Info("task success", "task", PayOutResale, "listing_id", payload.ListingID)
+		return nil
+	})
+
+	mux.HandleFunc(ClearAccessToken, func(ctx context.Context, t *asynq.Task) error {
+		// Unmarshal payload
+		var payload ClearAccessTokenPayload
+		if err := json.Unmarshal(t.Payload(), &payload); err != nil {
+			util.LOGGER.Error("failed to unmarshal task's payload", "task", ClearAccessToken, "error", err)
+			return err
+		}
+
+		// Process
+		if err := processor.ClearAccessToken(payload); err != nil {
+			util.LOGGER.Error("failed to process task", "task", ClearAccessToken, "user_id", payload.UserID, "error", err)
+			return err
+		}
+
+		util.LOGGER.Info("task success", "task", ClearAccessToken, "user_id", payload.UserID)
+		return nil
+	})
+
+	mux.HandleFunc(SettleRefund, func(ctx context.Context, t *asynq.Task) error {
+		// Unmarshal payload
+		var payload SettleRefundPayload
+		if err := json.Unmarshal(t.Payload(), &payload); err != nil {
+			util.LOGGER.Error("failed to unmarshal task's payload", "task", SettleRefund, "error", err)
+			return err
+		}
+
+		// Process
+		if err := processor.SettleRefund(payload); err != nil {
+			util.LOGGER.Error("failed to process task", "task", SettleRefund, "refund_id", payload.RefundID, "error", err)
+			return err
+		}
+
+		util.LOGGER.Info("task success", "task", SettleRefund, "refund_id", payload.RefundID)
+		return nil
+	})
+
+	mux.HandleFunc(ExpireBooking, func(ctx context.Context, t *asynq.Task) error {
+		// Unmarshal payload
+		var payload ExpireBookingPayload
+		if err := json.Unmarshal(t.Payload(), &payload); err != nil {
+			util.LOGGER.Error("failed to unmarshal task's payload", "task", ExpireBooking, "error", err)
+			return err
+		}
+
+		// Process
+		if err := processor.ExpireBooking(payload); err != nil {
+			util.LOGGER.Error("failed to process task", "task", ExpireBooking, "booking_id", payload.BookingID, "error", err)
+			return err
+		}
+
+		util.LOGGER.Info("task success", "task", ExpireBooking, "booking_id", payload.BookingID)
+		return nil
+	})
+
+	mux.HandleFunc(OfferWaitlist, func(ctx context.Context, t *asynq.Task) error {
+		// Unmarshal payload
+		var payload OfferWaitlistPayload
+		if err := json.Unmarshal(t.Payload(), &payload); err != nil {
+			util.LOGGER.Error("failed to unmarshal task's payload", "task", OfferWaitlist, "error", err)
+			return err
+		}
+
+		// Process
+		if err := processor.OfferWaitlist(payload); err != nil {
+			util.LOGGER.Error("failed to process task", "task", OfferWaitlist, "ticket_id", payload.TicketID, "error", err)
+			return err
+		}
+
+		util.LOGGER.Info("task success", "task", OfferWaitlist, "ticket_id", payload.TicketID)
+		return nil
+	})
+
+	mux.HandleFunc(ExpireWaitlistOffer, func(ctx context.Context, t *asynq.Task) error {
+		// Unmarshal payload
+		var payload ExpireWaitlistOfferPayload
+		if err := json.Unmarshal(t.Payload(), &payload); err != nil {
+			util.LOGGER.Error("failed to unmarshal task's payload", "task", ExpireWaitlistOffer, "error", err)
+			return err
+		}
+
+		// Process
+		if err := processor.ExpireWaitlistOffer(payload); err != nil {
+			util.LOGGER.Error(
+				"failed to process task",
+				"task", ExpireWaitlistOffer,
+				"ticket_id", payload.TicketID,
+				"customer_id", payload.CustomerID,
+				"error", err,
+			)
+			return err
+		}
+
+		util.LOGGER.Info("task success", "task", ExpireWaitlistOffer, "ticket_id", payload.TicketID, "customer_id", payload.CustomerID)
+		return nil
+	})
+
+	// Domain commands
+	mux.HandleFunc(SetPaymentStatus, handleCommand[SetPaymentStatusPayload](processor))
+	mux.HandleFunc(SetRefundStatus, handleCommand[SetRefundStatusPayload](processor))
+	mux.HandleFunc(ReleaseTickets, handleCommand[ReleaseTicketsPayload](processor))
+
 	mux.HandleFunc(UpdatePaymentRecord, func(ctx context.Context, t *asynq.Task) error {
 		// Unmarshal payload
 		var payload UpdatePaymentRecordPayload
 		if err := json.Unmarshal(t.Payload(), &payload); err != nil {
-			util.LOGGER.Error("failed to process task", "task", UpdatePaymentRecord, "error", err)
+			util.LOGGER.Error("failed to unmarshal task's payload", "task", UpdatePaymentRecord, "error", err)
 			return err
 		}
 
-		err := processor.RetryUpdatePaymentRecord(payload)
-		if err != nil {
-			util.LOGGER.Error("failed to process task", "task", UpdatePaymentRecord, "error", err)
+		// Process
+		if err := processor.RetryUpdatePaymentRecord(payload); err != nil {
+			util.LOGGER.Error("failed to process task", "task", UpdatePaymentRecord, "caller", payload.Caller, "error", err)
+			return err
+		}
+
+		util.LOGGER.Info("task success", "task", UpdatePaymentRecord, "caller", payload.Caller, "context", payload.Context)
+		return nil
+	})
+
+	mux.HandleFunc(ExportUserData, func(ctx context.Context, t *asynq.Task) error {
+		// Unmarshal payload
+		var payload ExportUserDataPayload
+		if err := json.Unmarshal(t.Payload(), &payload); err != nil {
+			util.LOGGER.Error("failed to unmarshal task's payload", "task", ExportUserData, "error", err)
+			return err
+		}
+
+		// Process
+		if err := processor.ExportUserData(payload); err != nil {
+			util.LOGGER.Error("failed to process task", "task", ExportUserData, "error", err)
+			return err
+		}
+
+		util.LOGGER.Info("task success", "task", ExportUserData)
+		return nil
+	})
+
+	mux.HandleFunc(DeleteDataExports, func(ctx context.Context, t *asynq.Task) error {
+		// Unmarshal payload
+		var payload DeleteDataExportsPayload
+		if err := json.Unmarshal(t.Payload(), &payload); err != nil {
+			util.LOGGER.Error("failed to unmarshal task's payload", "task", DeleteDataExports, "error", err)
+			return err
+		}
+
+		// Process
+		if err := processor.DeleteDataExports(payload); err != nil {
+			util.LOGGER.Error("failed to process task", "task", DeleteDataExports, "error", err)
+			return err
+		}
+
+		util.LOGGER.Info("task success", "task", DeleteDataExports)
+		return nil
+	})
+
+	mux.HandleFunc(ConfirmBooking, func(ctx context.Context, t *asynq.Task) error {
+		// Unmarshal payload
+		var payload ConfirmBookingPayload
+		if err := json.Unmarshal(t.Payload(), &payload); err != nil {
+			util.LOGGER.Error("failed to unmarshal task's payload", "task", ConfirmBooking, "error", err)
+			return err
+		}
+
+		// Process
+		if err := processor.ConfirmBooking(payload); err != nil {
+			util.LOGGER.Error("failed to process task", "task", ConfirmBooking, "error", err)
+			return err
+		}
+
+		util.LOGGER.Info("task success", "task", ConfirmBooking)
+		return nil
+	})
+
+	mux.HandleFunc(UpdateWalletPasses, func(ctx context.Context, t *asynq.Task) error {
+		// Unmarshal payload
+		var payload UpdateWalletPassesPayload
+		if err := json.Unmarshal(t.Payload(), &payload); err != nil {
+			util.LOGGER.Error("failed to unmarshal task's payload", "task", UpdateWalletPasses, "error", err)
+			return err
+		}
+
+		// Process
+		if err := processor.UpdateWalletPasses(payload); err != nil {
+			util.LOGGER.Error("failed to process task", "task", UpdateWalletPasses, "error", err)
 			return err
 		}
 
-		util.LOGGER.Info("task success", "task", UpdatePaymentRecord)
+		util.LOGGER.Info("task success", "task", UpdateWalletPasses)
 		return nil
 	})
 
@@ -0,0 +1,251 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	neturl "net/url"
+	"strings"
+	"tekticket/db"
+	"tekticket/service/payment"
+	"tekticket/service/wallet"
+	"tekticket/util"
+	"time"
+
+	"github.com/hibiken/asynq"
+)
+
+/*
+ * Resale marketplace: once the buyer of a listing paid through the normal payment flow, the confirmation of their booking
+ * moves the ticket to it, and the ticket gets a new QR like any other ticket of the booking. The payout of the seller is
+ * then a task of its own, retried alone: the payout minus the platform fee is refunded on the payment of the seller, with
+ * an idempotency key so that a retry never pays twice, and the seller is notified.
+ * A refund can't exceed what the seller paid for the ticket, and a seller who received the ticket by a transfer paid
+ * nothing, so the part of the payout above the refund is recorded as pending on the listing, for the platform to pay out,
+ * and reported in the notification of the seller.
+ */
+
+type PayOutResalePayload struct {
+	ListingID string `json:"listing_id"`
+}
+
+const PayOutResale = "pay-out-resale"
+
+// Status of the resale listings
+const (
+	RESALE_STATUS_ACTIVE   = "active" // On sale, or held by a buyer until its reserved_until
+	RESALE_STATUS_SOLD     = "sold"
+	RESALE_STATUS_CANCELED = "canceled"
+)
+
+// Reason of the refunds paying out a resale
+const RESALE_REFUND_REASON = "resold"
+
+const PAY_OUT_RESALE_MAX_RETRY = 10
+
+var ErrResaleUnavailable = errors.New("resale listing is no longer available to the booking")
+var ErrResaleUnderpaid = errors.New("payment doesn't cover the resale listing")
+
+// Fields of a listing used by the payout
+var payOutResaleFields = []string{
+	"id", "status", "price", "platform_fee", "payout", "payout_pending",
+	"refund_id.id", "refund_id.amount", "refund_id.status", "refund_id.payment_id.transaction_id",
+	"seller_id.id", "seller_id.email", "seller_id.first_name", "seller_id.last_name",
+	"seller_id.user_telegrams.telegram_chat_id",
+	"booking_item_id.id", "booking_item_id.price",
+	"from_booking_id.id", "from_booking_id.event_id.name",
+	"from_booking_id.payments.id", "from_booking_id.payments.status", "from_booking_id.payments.amount",
+	"from_booking_id.payments.transaction_id",
+	"from_booking_id.payments.refunds.id", "from_booking_id.payments.refunds.amount",
+	"from_booking_id.payments.refunds.status",
+}
+
+// Step: for the purchase of a resale listing, move the ticket to the booking of the buyer, revoking the QR of the seller,
+// mark the listing as sold and schedule the payout of the seller
+func (processor *RedisTaskProcessor) completeResale(booking *db.Booking, payment db.Payment, payload ConfirmBookingPayload) error {
+	if booking.ResaleListing == nil {
+		return nil
+	}
+
+	fields := []string{
+		"id", "status", "price", "booking_id.id", "from_booking_id.id",
+		"booking_item_id.id", "booking_item_id.status", "booking_item_id.checkin_token", "booking_item_id.booking_id.id",
+	}
+	url := fmt.Sprintf(
+		"%s/items/resale_listings/%s?fields=%s",
+		processor.config.DirectusAddr, booking.ResaleListing.ID, strings.Join(fields, ","),
+	)
+	var listing db.ResaleListing
+	if status, err := db.MakeRequest("GET", url, nil, processor.config.DirectusStaticToken, &listing); err != nil {
+		return fmt.Errorf("get resale listing: status %d: %w", status, err)
+	}
+	if listing.Booking == nil || listing.Booking.ID != booking.ID || listing.BookingItem == nil || listing.FromBooking == nil {
+		return fmt.Errorf("%w: listing %s: %w", ErrResaleUnavailable, listing.ID, asynq.SkipRetry)
+	}
+
+	// The amount of a payment is chosen by the client, so it must cover the listing with its fee before the ticket moves
+	fee := util.PaymentFee(listing.Price, processor.config.PaymentFeePercent)
+	if payment.Amount < listing.Price+fee {
+		return fmt.Errorf(
+			"%w: listing %s: paid %d of %d VND: %w",
+			ErrResaleUnderpaid, listing.ID, payment.Amount, listing.Price+fee, asynq.SkipRetry,
+		)
+	}
+
+	// Move the ticket, unless a previous attempt did
+	item := listing.BookingItem
+	if item.Booking == nil || item.Booking.ID != booking.ID {
+		if listing.Status != RESALE_STATUS_ACTIVE || item.Status != "valid" || item.Booking == nil ||
+			item.Booking.ID != listing.FromBooking.ID {
+			return fmt.Errorf("%w: listing %s: %w", ErrResaleUnavailable, listing.ID, asynq.SkipRetry)
+		}
+		if err := processor.walletRegistry.Revoke(context.Background(), wallet.SerialNumber(item.ID, item.CheckinToken)); err != nil {
+			util.LOGGER.Warn("failed to revoke wallet pass", "task", ConfirmBooking, "booking_item_id", item.ID, "error", err)
+		}
+		body := map[string]any{"booking_id": booking.ID, "status": "pending", "qr": nil, "checkin_token": nil}
+		if err := processor.patchItem("booking_items", item.ID, body); err != nil {
+			return err
+		}
+	}
+	if listing.Status != RESALE_STATUS_SOLD {
+		body := map[string]any{"status": RESALE_STATUS_SOLD, "date_sold": time.Now().UTC().Format(time.RFC3339)}
+		if err := processor.patchItem("resale_listings", listing.ID, body); err != nil {
+			return err
+		}
+	}
+
+	// The next steps issue the QR of the ticket and notify the buyer
+	booking.BookingItems = append(booking.BookingItems, db.BookingItem{ID: item.ID, Status: "pending"})
+
+	// The task ID keeps a retry of this step from paying out twice
+	err := processor.distributor.DistributeTask(
+		context.Background(),
+		PayOutResale,
+		PayOutResalePayload{ListingID: listing.ID},
+		asynq.Queue(HIGH_IMPACT),
+		asynq.MaxRetry(PAY_OUT_RESALE_MAX_RETRY),
+		asynq.TaskID(fmt.Sprintf("%s:%s", PayOutResale, listing.ID)),
+	)
+	if err != nil && !errors.Is(err, asynq.ErrTaskIDConflict) {
+		return err
+	}
+	return nil
+}
+
+// Pay out the seller of a sold listing, and notify them
+func (processor *RedisTaskProcessor) PayOutResale(payload PayOutResalePayload) error {
+	queryParams := neturl.Values{}
+	queryParams.Add("fields", strings.Join(payOutResaleFields, ","))
+	url := fmt.Sprintf("%s/items/resale_listings/%s?%s", processor.config.DirectusAddr, payload.ListingID, queryParams.Encode())
+	var listing db.ResaleListing
+	status, err := db.MakeRequest("GET", url, nil, processor.config.DirectusStaticToken, &listing)
+	if err != nil {
+		util.LOGGER.Error("failed to get resale listing", "task", PayOutResale, "listing_id", payload.ListingID, "status", status, "error", err)
+		return err
+	}
+	if listing.Status != RESALE_STATUS_SOLD {
+		return fmt.Errorf("listing %s is not sold: %w", listing.ID, asynq.SkipRetry)
+	}
+
+	refunded, err := processor.refundResalePayout(listing)
+	if err != nil {
+		return err
+	}
+
+	// The rest of the payout is owed by the platform
+	if pending := max(listing.Payout-refunded, 0); pending != listing.PayoutPending {
+		if err := processor.patchItem("resale_listings", listing.ID, map[string]any{"payout_pending": pending}); err != nil {
+			return err
+		}
+	}
+
+	if listing.Seller == nil {
+		return nil
+	}
+	eventName := ""
+	if listing.FromBooking != nil && listing.FromBooking.Event != nil {
+		eventName = listing.FromBooking.Event.Name
+	}
+	body := fmt.Sprintf(
+		"Your ticket for %s was sold for %d VND. After the platform fee of %d VND, %d VND is refunded to your payment method, the refund may take a few days to appear.",
+		eventName, listing.Price, listing.PlatformFee, refunded,
+	)
+	if due := listing.Payout - refunded; due > 0 {
+		body += fmt.Sprintf(" The remaining %d VND will be paid out to you by the platform.", due)
+	}
+	return processor.notifyCustomer(*listing.Seller, SendNotificationPayload{
+		Name:  "resale-sold",
+		Title: "Ticket sold",
+		Body:  body,
+	})
+}
+
+// Helper method: refund the payout of a listing on the payment of the seller, up to what the seller paid for the ticket,
+// and return the refunded amount. The refund record of a previous attempt is reused unless it failed, and gives the
+// idempotency key of the Stripe refund
+func (processor *RedisTaskProcessor) refundResalePayout(listing db.ResaleListing) (int, error) {
+	record := listing.Refund
+	if record == nil || record.Status == "failed" {
+		// The successful payment of the seller. A ticket received by a transfer has none, and nothing to refund
+		var paid *db.Payment
+		if listing.FromBooking != nil {
+			for _, payment := range listing.FromBooking.Payments {
+				if payment.Status == "success" {
+					paid = &payment
+					break
+				}
+			}
+		}
+		if paid == nil || listing.BookingItem == nil {
+			return 0, nil
+		}
+
+		remaining := paid.Amount
+		for _, refund := range paid.Refunds {
+			if refund.Status != "failed" {
+				remaining -= refund.Amount
+			}
+		}
+		amount := min(listing.Payout, listing.BookingItem.Price, remaining)
+		if amount <= 0 {
+			return 0, nil
+		}
+
+		url := fmt.Sprintf("%s/items/refunds?fields=id,amount,status", processor.config.DirectusAddr)
+		body := map[string]any{
+			"amount":     amount,
+			"status":     "pending",
+			"payment_id": paid.ID,
+			"reason":     RESALE_REFUND_REASON,
+		}
+		record = &db.Refund{}
+		if status, err := db.MakeRequest("POST", url, body, processor.config.DirectusStaticToken, record); err != nil {
+			return 0, fmt.Errorf("create refund record: status %d: %w", status, err)
+		}
+		record.Payment = paid
+		if err := processor.patchItem("resale_listings", listing.ID, map[string]any{"refund_id": record.ID}); err != nil {
+			return 0, err
+		}
+	}
+	if record.Status == "success" {
+		return record.Amount, nil
+	}
+
+	if record.Payment == nil {
+		return 0, fmt.Errorf("refund %s has no payment: %w", record.ID, asynq.SkipRetry)
+	}
+
+	refund, err := payment.CreateIdempotentRefund(
+		record.Payment.TransactionID,
+		payment.RequestedByCustomer,
+		int64(record.Amount),
+		fmt.Sprintf("%s:%s", PayOutResale, record.ID),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("refund in Stripe: %w", err)
+	}
+	if err := processor.settleRefund(record.ID, refund, "resale payout"); err != nil {
+		return 0, err
+	}
+	return record.Amount, nil
+}
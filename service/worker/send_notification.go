@@ -2,6 +2,8 @@ package worker
 
 import (
 	"context"
+	"fmt"
+	"tekticket/db"
 	"tekticket/service/bot"
 	"tekticket/util"
 )
@@ -19,10 +21,19 @@ type SendNotificationPayload struct {
 	Dest  NotificationChannel `json:"dest"`
 }
 
+// Notification to a customer, sent through all of their channels
+type NotifyCustomerPayload struct {
+	CustomerID string `json:"customer_id"`
+	Name       string `json:"name"`
+	Title      string `json:"title"`
+	Body       string `json:"body"`
+}
+
 const (
 	SendEmailNotification    = "send-email-notification"
 	SendInAppNotification    = "send-inapp-notification"
 	SendTelegramNotification = "send-telegram-notification"
+	NotifyCustomer           = "notify-customer"
 )
 
 func (processor *RedisTaskProcessor) SendEmailNotification(email, title, body string) error {
@@ -45,3 +56,15 @@ func (processor *RedisTaskProcessor) SendTelegramNotification(chatID int, title,
 	// Send message to telegram
 	return processor.bot.SendMessage(chatID, util.FormatNotificationHTML(title, body))
 }
+
+// Send a notification through every channel of a customer
+func (processor *RedisTaskProcessor) NotifyCustomer(payload NotifyCustomerPayload) error {
+	url := fmt.Sprintf("%s/users/%s?fields=id,email,user_telegrams.telegram_chat_id", processor.config.DirectusAddr, payload.CustomerID)
+	var customer db.User
+	if status, err := db.MakeRequest("GET", url, nil, processor.config.DirectusStaticToken, &customer); err != nil {
+		util.LOGGER.Error("failed to get customer", "task", NotifyCustomer, "customer_id", payload.CustomerID, "status", status, "error", err)
+		return err
+	}
+
+	return processor.notifyCustomer(customer, SendNotificationPayload{Name: payload.Name, Title: payload.Title, Body: payload.Body})
+}
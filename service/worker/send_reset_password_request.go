@@ -2,7 +2,9 @@ package worker
 
 import (
 	"bytes"
+	"context"
 	"embed"
+	"errors"
 	"fmt"
 	"html/template"
 	"strconv"
@@ -10,6 +12,9 @@ import (
 
 	"tekticket/util"
 	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
 )
 
 type SendResetPasswordPayload struct {
@@ -20,54 +25,113 @@ type SendResetPasswordPayload struct {
 
 const SendResetPassword = "send-reset-password"
 
+// How long a reset password token is valid
+const RESET_PASSWORD_TOKEN_TTL = time.Hour
+
+var (
+	ErrInvalidResetToken = errors.New("invalid reset password token")
+	ErrResetTokenExpired = errors.New("reset password token expired, used or revoked")
+)
+
 //go:embed reset_password.html
 var resetFS embed.FS
 
+// Consume the token ID only if it is still the latest one issued to the user, so that a token can only be used once.
+// KEYS[1]: reset password key of the user, ARGV[1]: the token ID
+var consumeResetTokenScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// Helper: the cache key holding the ID of the latest reset password token of a user
+func resetPasswordKey(userID string) string {
+	return fmt.Sprintf("reset-password:%s", userID)
+}
+
 // Helper method: generate reset password token. Since this method only use internally for the processor to send email,
 // we are not export it.
+// Each token carries a unique ID (jti), which is recorded in cache as the only valid token of the user. Issuing a new token
+// overrides the previous one, which revokes it.
 func (processor *RedisTaskProcessor) generateResetPasswordToken(id, email string) (string, error) {
 	// Generate token
-	rawToken := fmt.Sprintf("%s#%s#%d", id, email, time.Now().UnixNano())
+	jti := uuid.New().String()
+	rawToken := fmt.Sprintf("%s#%s#%s#%d", id, email, jti, time.Now().UnixNano())
 	encrypt, err := util.Encrypt([]byte(processor.config.SecretKey), []byte(rawToken))
 	if err != nil {
 		return "", err
 	}
+
+	// Record the token ID
+	err = processor.queries.Cache.Set(context.Background(), resetPasswordKey(id), jti, RESET_PASSWORD_TOKEN_TTL).Err()
+	if err != nil {
+		return "", err
+	}
+
 	return util.Encode(string(encrypt)), nil
 }
 
+// Helper method: verify reset password token. This should be use by the client (API handler), so it should be exported.
+// It only checks the token integrity and expiration time, use ConsumeResetPasswordToken to actually use the token.
+// Return the token segments: user ID, email, token ID and timestamp
 func VerifyResetPasswordToken(token string, secretKey string) ([]string, error) {
 	// Decode base64 token
 	decodeToken, err := util.Decode(token)
 	if err != nil {
-		return nil, err
+		return nil, ErrInvalidResetToken
 	}
 
 	// Decrypt token
 	raw, err := util.Decrypt([]byte(secretKey), []byte(decodeToken))
 	if err != nil {
-		return nil, err
+		return nil, ErrInvalidResetToken
 	}
 
 	// Split the raw token into segments, separate by the delimiter #
 	segments := strings.Split(string(raw), "#")
-	if len(segments) != 3 {
-		return nil, fmt.Errorf("invalid token, segments length must be 3")
+	if len(segments) != 4 {
+		return nil, ErrInvalidResetToken
 	}
 
 	// Check if token has expired or not
-	timestamp, err := strconv.ParseInt(segments[2], 10, 64)
+	timestamp, err := strconv.ParseInt(segments[3], 10, 64)
 	if err != nil {
-		return nil, err
+		return nil, ErrInvalidResetToken
 	}
 
-	if time.Now().After(time.Unix(0, int64(timestamp)).Add(time.Hour)) {
-		return nil, fmt.Errorf("token expired")
+	if time.Now().After(time.Unix(0, timestamp).Add(RESET_PASSWORD_TOKEN_TTL)) {
+		return nil, ErrResetTokenExpired
 	}
 
 	return segments, nil
 }
 
-// Helper method: verify reset password token. This should be use by the client (API handler), so it should be exported
+// Verify and consume a reset password token. A token can only be consumed once, and only if no newer token has been issued
+// and the password hasn't been changed since. Return the user ID the token was issued to.
+func ConsumeResetPasswordToken(ctx context.Context, cache *redis.Client, token, secretKey string) (string, error) {
+	segments, err := VerifyResetPasswordToken(token, secretKey)
+	if err != nil {
+		return "", err
+	}
+
+	deleted, err := consumeResetTokenScript.Run(ctx, cache, []string{resetPasswordKey(segments[0])}, segments[2]).Int()
+	if err != nil {
+		return "", err
+	}
+
+	if deleted == 0 {
+		return "", ErrResetTokenExpired
+	}
+
+	return segments[0], nil
+}
+
+// Revoke the reset password token of a user (if any), for example after the password has been changed
+func RevokeResetPasswordToken(ctx context.Context, cache *redis.Client, userID string) error {
+	return cache.Del(ctx, resetPasswordKey(userID)).Err()
+}
+
 func (processor *RedisTaskProcessor) SendResetPassword(payload SendResetPasswordPayload) error {
 	// Generate token
 	token, err := processor.generateResetPasswordToken(payload.ID, payload.Email)
@@ -78,7 +142,6 @@ func (processor *RedisTaskProcessor) SendResetPassword(payload SendResetPassword
 	// Create reset link
 	link := fmt.Sprintf("%s?token=%s", processor.config.ResetPasswordURL, token)
 	payload.ResetLink = link
-	util.LOGGER.Info("Link", "val", link)
 
 	// Prepare the HTML email body
 	tmpl, err := template.ParseFS(resetFS, "reset_password.html")
@@ -6,15 +6,16 @@ import (
 	"embed"
 	"fmt"
 	"html/template"
+	"tekticket/service/otp"
 	"tekticket/util"
-	"time"
 )
 
 type SendVerifyEmailPayload struct {
-	ID       string `json:"id"`
-	Email    string `json:"email"`
-	Username string `json:"username"`
-	OTP      string `json:"otp"`
+	ID        string `json:"id"`
+	Email     string `json:"email"`
+	Username  string `json:"username"`
+	OTP       string `json:"otp"`
+	ExpiresIn string `json:"expires_in"`
 }
 
 const SendVerifyEmail = "send-verify-email"
@@ -23,27 +24,14 @@ const SendVerifyEmail = "send-verify-email"
 var verifyFS embed.FS
 
 func (processor *RedisTaskProcessor) SendVerifyEmail(payload SendVerifyEmailPayload) error {
-	// Generate OTP
-	otp := util.GenerateRandomOTP()
-	payload.OTP = otp
-
-	// Check if the OTP already registered to avoid collisions
-	ok := false
-	for !ok {
-		_, err := processor.queries.GetCache(context.Background(), otp)
-		if processor.queries.IsCacheMiss(err) {
-			// If cache miss
-			ok = true
-		} else {
-			// If cache error, return error
-			if err != nil {
-				return fmt.Errorf("failed to check if OTP exists in cache: %v", err)
-			}
-
-			// If cache hit -> OTP in used -> create new one
-			otp = util.GenerateRandomOTP()
-		}
+	// Issue a new OTP for this user. The previous one (if any) is replaced, and only its hash is stored in cache
+	policy := otp.NewPolicy(otp.PURPOSE_VERIFY_ACCOUNT, processor.config.Setting)
+	code, err := processor.otpManager.Issue(context.Background(), policy, payload.ID)
+	if err != nil {
+		return fmt.Errorf("failed to issue OTP: %v", err)
 	}
+	payload.OTP = code
+	payload.ExpiresIn = util.FormatDuration(policy.TTL)
 
 	// Prepare the HTML email body
 	tmpl, err := template.ParseFS(verifyFS, "verify_email.html")
@@ -56,14 +44,5 @@ func (processor *RedisTaskProcessor) SendVerifyEmail(payload SendVerifyEmailPayl
 	}
 
 	// Send email
-	err = processor.mailService.SendEmail(payload.Email, "Welcome to Ticket - Verify your account", buffer.String())
-	if err != nil {
-		return err
-	}
-
-	// Register OTP into cache
-	// Although the OTP should expired in 30 seconds, we add some time for latency
-	processor.queries.SetCache(context.Background(), otp, payload.ID, time.Second*45)
-
-	return nil
+	return processor.mailService.SendEmail(payload.Email, "Welcome to Ticket - Verify your account", buffer.String())
 }
@@ -0,0 +1,97 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"tekticket/service/payment"
+	"tekticket/util"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"github.com/stripe/stripe-go/v82"
+)
+
+/*
+ * Refund settlement: Stripe may accept a refund without completing it, while it is pending at the bank of the customer or
+ * requires an action from them. Its refund record stays pending, and this task follows the refund in Stripe until it ends:
+ * - succeeded          : the record is marked as successful, and its tickets are released and offered to the waitlists
+ * - failed or canceled : the record is marked as failed, so that its tickets can be refunded again
+ * A refund still running is an error, so that the task is retried later.
+ */
+
+type SettleRefundPayload struct {
+	RefundID       string                `json:"refund_id"`        // Refund record
+	StripeRefundID string                `json:"stripe_refund_id"` // Refund in Stripe
+	Release        ReleaseTicketsPayload `json:"release"`          // Tickets released once refunded, none if already released
+	TicketIDs      []string              `json:"ticket_ids"`       // Ticket types whose waitlists are offered the released tickets
+}
+
+const SettleRefund = "settle-refund"
+
+const (
+	SETTLE_REFUND_DELAY     = 10 * time.Minute // Delay before the first check of the refund
+	SETTLE_REFUND_MAX_RETRY = 20               // With the backoff of asynq, the refund is followed for several days
+)
+
+var ErrRefundPending = errors.New("refund is still running in Stripe")
+
+// Schedule the settlement of a refund that Stripe didn't complete. The task ID keeps a refund from being followed twice
+func ScheduleRefundSettlement(ctx context.Context, distributor TaskDistributor, payload SettleRefundPayload) error {
+	err := distributor.DistributeTask(
+		ctx,
+		SettleRefund,
+		payload,
+		asynq.Queue(HIGH_IMPACT),
+		asynq.MaxRetry(SETTLE_REFUND_MAX_RETRY),
+		asynq.ProcessIn(SETTLE_REFUND_DELAY),
+		asynq.TaskID(fmt.Sprintf("%s:%s", SettleRefund, payload.RefundID)),
+	)
+	if errors.Is(err, asynq.ErrTaskIDConflict) {
+		return nil
+	}
+	return err
+}
+
+// Settle a refund once it ended in Stripe
+func (processor *RedisTaskProcessor) SettleRefund(payload SettleRefundPayload) error {
+	refund, err := payment.GetRefund(payload.StripeRefundID)
+	if err != nil {
+		return fmt.Errorf("get refund in Stripe: %w", err)
+	}
+
+	switch refund.Status {
+	case stripe.RefundStatusSucceeded:
+		command := SetRefundStatusPayload{RefundID: payload.RefundID, Status: "success", PreviousStatus: "pending", Reason: "refund in Stripe succeeded"}
+		if err := command.execute(processor); err != nil {
+			return err
+		}
+		if len(payload.Release.BookingItemIDs) == 0 {
+			return nil
+		}
+		if err := payload.Release.execute(processor); err != nil {
+			return err
+		}
+
+		// The refunded tickets are back on sale, offered to the waitlists first
+		for _, ticketID := range payload.TicketIDs {
+			err := processor.distributor.DistributeTask(
+				context.Background(),
+				OfferWaitlist,
+				OfferWaitlistPayload{TicketID: ticketID},
+				asynq.Queue(HIGH_IMPACT),
+				asynq.MaxRetry(5),
+			)
+			if err != nil {
+				util.LOGGER.Error("failed to schedule waitlist offer", "task", SettleRefund, "ticket_id", ticketID, "error", err)
+			}
+		}
+		return nil
+	case stripe.RefundStatusFailed, stripe.RefundStatusCanceled:
+		util.LOGGER.Warn("refund failed in Stripe", "task", SettleRefund, "refund_id", payload.RefundID, "reason", refund.FailureReason)
+		command := SetRefundStatusPayload{RefundID: payload.RefundID, Status: "failed", PreviousStatus: "pending", Reason: "refund in Stripe failed"}
+		return command.execute(processor)
+	default:
+		return fmt.Errorf("%w: %s", ErrRefundPending, refund.Status)
+	}
+}
@@ -0,0 +1,270 @@
+package worker
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"tekticket/db"
+	"tekticket/service/notify"
+	"tekticket/util"
+	"time"
+
+	"github.com/go-pdf/fpdf"
+)
+
+type GenerateTicketPDFPayload struct {
+	BookingID string `json:"booking_id"`
+}
+
+const GenerateTicketPDF = "generate-ticket-pdf"
+
+// Content type of the ticket documents
+const PDF_CONTENT_TYPE = "application/pdf"
+
+//go:embed tickets.html
+var ticketsFS embed.FS
+
+// Fields of a booking printed on its tickets
+var ticketPDFFields = []string{
+	"id", "tickets_pdf",
+	"customer_id.email", "customer_id.first_name", "customer_id.last_name",
+	"event_id.name", "event_id.address", "event_id.city", "event_id.country",
+	"booking_items.id", "booking_items.price", "booking_items.qr", "booking_items.status",
+	"booking_items.seat_id.seat_number", "booking_items.seat_id.row",
+	"booking_items.ticket_id.rank",
+	"booking_items.event_schedule_id.start_time", "booking_items.event_schedule_id.end_time",
+}
+
+// Data of the email sending the tickets
+type ticketsEmail struct {
+	Username  string
+	EventName string
+	BookingID string
+	Tickets   int
+}
+
+// Filename of the ticket document of a booking
+func TicketPDFFilename(bookingID string) string {
+	return fmt.Sprintf("tickets-%s.pdf", bookingID)
+}
+
+// Render the ticket document of a booking: one A5 page per booking item, with its QR. The QRs are the PNG images of the
+// items, by booking item ID.
+// The PDF core fonts only cover Latin-1, so the accents of the texts are removed
+func BuildTicketPDF(booking db.Booking, qrs map[string][]byte) ([]byte, error) {
+	pdf := fpdf.New("P", "mm", "A5", "")
+	pdf.SetTitle("Tickets "+booking.ID, true)
+	pdf.SetAutoPageBreak(false, 0)
+	translate := pdf.UnicodeTranslatorFromDescriptor("")
+	text := func(value string) string { return translate(util.RemoveAccents(value)) }
+
+	var event db.Event
+	if booking.Event != nil {
+		event = *booking.Event
+	}
+	venue := make([]string, 0, 3)
+	for _, part := range []string{event.Address, event.City, event.Country} {
+		if part = strings.TrimSpace(part); part != "" {
+			venue = append(venue, part)
+		}
+	}
+
+	width, _ := pdf.GetPageSize()
+	left, _, right, _ := pdf.GetMargins()
+	content := width - left - right
+	for i, item := range booking.BookingItems {
+		qr, ok := qrs[item.ID]
+		if !ok {
+			return nil, fmt.Errorf("missing QR of booking item %s", item.ID)
+		}
+
+		pdf.AddPage()
+		pdf.SetFont("Helvetica", "B", 18)
+		pdf.MultiCell(content, 8, text(event.Name), "", "C", false)
+		pdf.Ln(4)
+
+		// Details of the ticket
+		rows := [][2]string{
+			{"Schedule", ticketSchedule(item.EventSchedule)},
+			{"Venue", strings.Join(venue, ", ")},
+			{"Ticket", ""},
+			{"Seat", ""},
+			{"Price", formatVND(item.Price)},
+		}
+		if item.Ticket != nil {
+			rows[2][1] = item.Ticket.Rank
+		}
+		if item.Seat != nil {
+			rows[3][1] = item.Seat.SeatNumber
+			if item.Seat.Row != "" {
+				rows[3][1] = fmt.Sprintf("Row %s, seat %s", item.Seat.Row, item.Seat.SeatNumber)
+			}
+		}
+		for _, row := range rows {
+			pdf.SetFont("Helvetica", "B", 11)
+			pdf.CellFormat(30, 7, row[0], "", 0, "L", false, 0, "")
+			pdf.SetFont("Helvetica", "", 11)
+			pdf.MultiCell(content-30, 7, text(row[1]), "", "L", false)
+		}
+
+		// QR, centered
+		name := "qr-" + item.ID
+		pdf.RegisterImageOptionsReader(name, fpdf.ImageOptions{ImageType: "PNG"}, bytes.NewReader(qr))
+		size := 70.0
+		pdf.ImageOptions(name, (width-size)/2, pdf.GetY()+6, size, size, false, fpdf.ImageOptions{ImageType: "PNG"}, 0, "")
+		pdf.SetY(pdf.GetY() + size + 10)
+
+		pdf.SetFont("Helvetica", "", 9)
+		pdf.CellFormat(content, 5, "Booking "+booking.ID, "", 1, "C", false, 0, "")
+		pdf.CellFormat(content, 5, fmt.Sprintf("Ticket %d of %d - %s", i+1, len(booking.BookingItems), item.ID), "", 1, "C", false, 0, "")
+		pdf.CellFormat(content, 5, "Show this QR code at the entrance", "", 1, "C", false, 0, "")
+	}
+
+	var buffer bytes.Buffer
+	if err := pdf.Output(&buffer); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// Render the ticket document of a booking, store it, and email it to the customer
+func (processor *RedisTaskProcessor) GenerateTicketPDF(payload GenerateTicketPDFPayload) error {
+	queryParams := url.Values{}
+	queryParams.Add("fields", strings.Join(ticketPDFFields, ","))
+	queryParams.Add("deep[booking_items][_filter][status][_eq]", "valid")
+	url := fmt.Sprintf("%s/items/bookings/%s?%s", processor.config.DirectusAddr, payload.BookingID, queryParams.Encode())
+	var booking db.Booking
+	status, err := db.MakeRequest("GET", url, nil, processor.config.DirectusStaticToken, &booking)
+	if err != nil {
+		util.LOGGER.Error("failed to get booking", "task", GenerateTicketPDF, "booking_id", payload.BookingID, "status", status, "error", err)
+		return err
+	}
+	if len(booking.BookingItems) == 0 {
+		util.LOGGER.Warn("booking has no valid ticket", "task", GenerateTicketPDF, "booking_id", payload.BookingID)
+		return nil
+	}
+
+	// QRs of the tickets
+	qrs := map[string][]byte{}
+	for _, item := range booking.BookingItems {
+		if item.QR == "" {
+			return fmt.Errorf("booking item %s has no QR yet", item.ID)
+		}
+		qr, err := processor.getAsset(item.QR)
+		if err != nil {
+			util.LOGGER.Error("failed to get QR", "task", GenerateTicketPDF, "booking_item_id", item.ID, "error", err)
+			return err
+		}
+		qrs[item.ID] = qr
+	}
+
+	document, err := BuildTicketPDF(booking, qrs)
+	if err != nil {
+		return err
+	}
+
+	// Store the document, replacing the previous one
+	fileID, status, err := processor.uploadService.UploadFile(TicketPDFFilename(booking.ID), PDF_CONTENT_TYPE, document)
+	if err != nil {
+		util.LOGGER.Error("failed to upload ticket PDF", "task", GenerateTicketPDF, "status", status, "error", err)
+		return err
+	}
+	url = fmt.Sprintf("%s/items/bookings/%s", processor.config.DirectusAddr, booking.ID)
+	if status, err := db.MakeRequest("PATCH", url, map[string]any{"tickets_pdf": fileID}, processor.config.DirectusStaticToken, nil); err != nil {
+		util.LOGGER.Error("failed to update booking with ticket PDF", "task", GenerateTicketPDF, "status", status, "error", err)
+		return err
+	}
+	if booking.TicketsPDF != "" {
+		url = fmt.Sprintf("%s/files/%s", processor.config.DirectusAddr, booking.TicketsPDF)
+		if status, err := db.MakeRequest("DELETE", url, nil, processor.config.DirectusStaticToken, nil); err != nil {
+			util.LOGGER.Warn("failed to delete previous ticket PDF", "task", GenerateTicketPDF, "status", status, "error", err)
+		}
+	}
+
+	if booking.Customer == nil || booking.Customer.Email == "" {
+		return nil
+	}
+
+	// Prepare the HTML email body
+	data := ticketsEmail{
+		Username:  strings.TrimSpace(booking.Customer.FirstName + " " + booking.Customer.LastName),
+		BookingID: booking.ID,
+		Tickets:   len(booking.BookingItems),
+	}
+	if booking.Event != nil {
+		data.EventName = booking.Event.Name
+	}
+	tmpl, err := template.ParseFS(ticketsFS, "tickets.html")
+	if err != nil {
+		return err
+	}
+	var buffer bytes.Buffer
+	if err = tmpl.Execute(&buffer, data); err != nil {
+		return err
+	}
+
+	return processor.mailService.SendEmailWithAttachments(
+		booking.Customer.Email,
+		fmt.Sprintf("Your tickets for %s", data.EventName),
+		buffer.String(),
+		notify.Attachment{Filename: TicketPDFFilename(booking.ID), ContentType: PDF_CONTENT_TYPE, Data: document},
+	)
+}
+
+// Helper method: download a file from Directus
+func (processor *RedisTaskProcessor) getAsset(id string) ([]byte, error) {
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s/assets/%s", processor.config.DirectusAddr, id), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+processor.config.DirectusStaticToken)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("get asset %s: status %d", id, resp.StatusCode)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// Helper function: the time of a schedule, in UTC
+func ticketSchedule(schedule *db.EventSchedule) string {
+	if schedule == nil || schedule.StartTime == nil {
+		return ""
+	}
+
+	start := time.Time(*schedule.StartTime).UTC()
+	value := start.Format("Mon, 02 Jan 2006 15:04")
+	if schedule.EndTime != nil {
+		end := time.Time(*schedule.EndTime).UTC()
+		if end.YearDay() == start.YearDay() && end.Year() == start.Year() {
+			value += end.Format(" - 15:04")
+		} else {
+			value += end.Format(" - Mon, 02 Jan 2006 15:04")
+		}
+	}
+	return value + " (UTC)"
+}
+
+// Helper function: format an amount in VND, with dots between thousands
+func formatVND(amount int) string {
+	digits := strconv.Itoa(max(amount, 0))
+	var sb strings.Builder
+	for i, digit := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			sb.WriteByte('.')
+		}
+		sb.WriteRune(digit)
+	}
+	return sb.String() + " VND"
+}
@@ -0,0 +1,97 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	neturl "net/url"
+	"strings"
+	"tekticket/db"
+	"tekticket/service/wallet"
+	"tekticket/util"
+)
+
+type UpdateWalletPassesPayload struct {
+	ScheduleID string `json:"schedule_id"`
+}
+
+const UpdateWalletPasses = "update-wallet-passes"
+
+// Fields of a schedule shown on the wallet passes
+var walletScheduleFields = []string{
+	"id", "start_time", "end_time",
+	"event_id.name", "event_id.address", "event_id.city", "event_id.country", "event_id.latitude", "event_id.longitude",
+}
+
+// Update the wallet passes of the tickets of a schedule, after the schedule changed:
+// - Google Wallet: update the class of the schedule, shared by its passes
+// - Apple Wallet: mark the passes as updated, and notify the devices holding them so that they fetch the new passes
+func (processor *RedisTaskProcessor) UpdateWalletPasses(payload UpdateWalletPassesPayload) error {
+	if processor.walletIssuer.Apple == nil && processor.walletIssuer.Google == nil {
+		return nil
+	}
+
+	ctx := context.Background()
+	queryParams := neturl.Values{}
+	queryParams.Add("fields", strings.Join(walletScheduleFields, ","))
+	url := fmt.Sprintf("%s/items/event_schedules/%s?%s", processor.config.DirectusAddr, payload.ScheduleID, queryParams.Encode())
+	var schedule db.EventSchedule
+	status, err := db.MakeRequest("GET", url, nil, processor.config.DirectusStaticToken, &schedule)
+	if err != nil {
+		util.LOGGER.Error("failed to get schedule", "task", UpdateWalletPasses, "schedule_id", payload.ScheduleID, "status", status, "error", err)
+		return err
+	}
+	var event db.Event
+	if schedule.Event != nil {
+		event = *schedule.Event
+	}
+	ticket := wallet.NewScheduleTicket(event, schedule)
+
+	if processor.walletIssuer.Google != nil {
+		updated, err := processor.walletIssuer.Google.UpdateClass(ctx, ticket)
+		if err != nil {
+			util.LOGGER.Error("failed to update Google Wallet class", "task", UpdateWalletPasses, "schedule_id", schedule.ID, "error", err)
+			return err
+		}
+		util.LOGGER.Info("Google Wallet class", "schedule_id", schedule.ID, "updated", updated)
+	}
+
+	if processor.walletIssuer.Apple == nil {
+		return nil
+	}
+
+	// Tickets of the schedule
+	queryParams = neturl.Values{}
+	queryParams.Add("fields", "id,checkin_token")
+	queryParams.Add("filter[event_schedule_id][_eq]", schedule.ID)
+	queryParams.Add("filter[status][_eq]", "valid")
+	queryParams.Add("limit", "-1")
+	url = fmt.Sprintf("%s/items/booking_items?%s", processor.config.DirectusAddr, queryParams.Encode())
+	var items []db.BookingItem
+	if status, err := db.MakeRequest("GET", url, nil, processor.config.DirectusStaticToken, &items); err != nil {
+		util.LOGGER.Error("failed to get tickets of schedule", "task", UpdateWalletPasses, "schedule_id", schedule.ID, "status", status, "error", err)
+		return err
+	}
+	if len(items) == 0 {
+		return nil
+	}
+
+	serialNumbers := make([]string, 0, len(items))
+	for _, item := range items {
+		serialNumbers = append(serialNumbers, wallet.SerialNumber(item.ID, item.CheckinToken))
+	}
+	pushTokens, err := processor.walletRegistry.MarkUpdated(ctx, serialNumbers...)
+	if err != nil {
+		util.LOGGER.Error("failed to mark passes as updated", "task", UpdateWalletPasses, "schedule_id", schedule.ID, "error", err)
+		return err
+	}
+
+	// The passes are already marked as updated, so a failed push must not retry this task: the devices also fetch the
+	// updated passes on their own
+	for _, pushToken := range pushTokens {
+		if err := processor.walletIssuer.Apple.Push(ctx, pushToken); err != nil {
+			util.LOGGER.Warn("failed to notify device of updated pass", "task", UpdateWalletPasses, "schedule_id", schedule.ID, "error", err)
+		}
+	}
+	util.LOGGER.Info("Apple Wallet passes updated", "schedule_id", schedule.ID, "passes", len(serialNumbers), "devices", len(pushTokens))
+	return nil
+}
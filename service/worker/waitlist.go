@@ -0,0 +1,149 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"tekticket/db"
+	"tekticket/util"
+	"time"
+
+	"github.com/hibiken/asynq"
+)
+
+/*
+ * Waitlist of the sold-out ticket types: each ticket freed by a booking expiry (see ExpireBooking), a refund or a
+ * cancellation is offered to the next customer in line while its type is on sale, who is notified and has the ticket
+ * reserved for the offer window. The expiry of the offer is a task scheduled at its end: an offer still unclaimed by then
+ * is dropped, and the ticket is offered to the next in line.
+ */
+
+// Offer a freed ticket of a ticket type to the next customer in its waitlist
+type OfferWaitlistPayload struct {
+	TicketID string `json:"ticket_id"`
+}
+
+// Roll over the offer of a customer if it is still unclaimed at its end
+type ExpireWaitlistOfferPayload struct {
+	TicketID   string `json:"ticket_id"`
+	CustomerID string `json:"customer_id"`
+}
+
+const (
+	OfferWaitlist       = "offer-waitlist"
+	ExpireWaitlistOffer = "expire-waitlist-offer"
+)
+
+var ErrWaitlistOfferRunning = errors.New("waitlist offer is still running")
+
+// Offer a freed ticket to the next customer in the waitlist of its type, if any, while the type is on sale
+func (processor *RedisTaskProcessor) OfferWaitlist(payload OfferWaitlistPayload) error {
+	fields := "id,rank,event_id.name,ticket_selling_schedules.start_selling_time,ticket_selling_schedules.end_selling_time"
+	url := fmt.Sprintf("%s/items/tickets/%s?fields=%s", processor.config.DirectusAddr, payload.TicketID, fields)
+	var ticket db.Ticket
+	if status, err := db.MakeRequest("GET", url, nil, processor.config.DirectusStaticToken, &ticket); err != nil {
+		return fmt.Errorf("get ticket: status %d: %w", status, err)
+	}
+
+	// A ticket can't be booked once the selling windows of its type are closed
+	now := time.Now()
+	if _, selling := TicketsOnSale(ticket, now); !selling {
+		util.LOGGER.Info("ticket is not on sale, skip waitlist offer", "task", OfferWaitlist, "ticket_id", payload.TicketID)
+		return nil
+	}
+
+	policy := util.NewWaitlistPolicy(processor.config.Setting)
+	expiresAt := now.Add(policy.OfferWindow)
+	customerID, err := processor.waitlist.Offer(context.Background(), payload.TicketID, expiresAt)
+	if err != nil {
+		return err
+	}
+	if customerID == "" {
+		util.LOGGER.Info("waitlist is empty, the ticket stays on sale", "task", OfferWaitlist, "ticket_id", payload.TicketID)
+		return nil
+	}
+
+	// The ticket is offered from here, so the task must not be retried: a retry would offer a second ticket. The failures are
+	// only logged, an offer without its expiry task still ends at its time but doesn't roll over
+	err = processor.distributor.DistributeTask(
+		context.Background(),
+		ExpireWaitlistOffer,
+		ExpireWaitlistOfferPayload{TicketID: payload.TicketID, CustomerID: customerID},
+		asynq.Queue(HIGH_IMPACT),
+		asynq.MaxRetry(5),
+		asynq.ProcessAt(expiresAt),
+	)
+	if err != nil {
+		util.LOGGER.Error("failed to schedule waitlist offer expiry", "task", OfferWaitlist, "customer_id", customerID, "error", err)
+	}
+
+	eventName := ""
+	if ticket.Event != nil {
+		eventName = ticket.Event.Name
+	}
+	err = processor.distributor.DistributeTask(
+		context.Background(),
+		NotifyCustomer,
+		NotifyCustomerPayload{
+			CustomerID: customerID,
+			Name:       "waitlist-offer",
+			Title:      "A ticket is waiting for you",
+			Body: fmt.Sprintf(
+				"A %s ticket for %s is available, and reserved for you for %s. Book it before then, or it will be offered to the next customer on the waitlist.",
+				ticket.Rank, eventName, util.FormatDuration(policy.OfferWindow),
+			),
+		},
+		asynq.Queue(MEDIUM_IMPACT),
+		asynq.MaxRetry(5),
+	)
+	if err != nil {
+		util.LOGGER.Error("failed to notify waitlist offer", "task", OfferWaitlist, "customer_id", customerID, "error", err)
+	}
+	return nil
+}
+
+// Drop the offer of a customer if they didn't claim it in time, and offer its ticket to the next in line
+func (processor *RedisTaskProcessor) ExpireWaitlistOffer(payload ExpireWaitlistOfferPayload) error {
+	now := time.Now()
+	running, _, err := processor.waitlist.OfferOf(context.Background(), payload.TicketID, payload.CustomerID, now)
+	if err != nil {
+		return err
+	}
+	if running {
+		// The task ran early, the retry gets it after the end of the offer
+		return ErrWaitlistOfferRunning
+	}
+
+	expired, err := processor.waitlist.Expire(context.Background(), payload.TicketID, payload.CustomerID, now)
+	if err != nil {
+		return err
+	}
+	if !expired {
+		// Claimed by a booking
+		return nil
+	}
+
+	return processor.distributor.DistributeTask(
+		context.Background(),
+		OfferWaitlist,
+		OfferWaitlistPayload{TicketID: payload.TicketID},
+		asynq.Queue(HIGH_IMPACT),
+		asynq.MaxRetry(5),
+	)
+}
+
+// Tickets of a type still available in its selling schedules on sale at now, and whether any is on sale
+func TicketsOnSale(ticket db.Ticket, now time.Time) (int, bool) {
+	available, selling := 0, false
+	for _, schedule := range ticket.TicketSellingSchedules {
+		if schedule.StartSellingTime != nil && now.Before(time.Time(*schedule.StartSellingTime)) {
+			continue
+		}
+		if schedule.EndSellingTime != nil && !now.Before(time.Time(*schedule.EndSellingTime)) {
+			continue
+		}
+		available += max(schedule.Avaible, 0)
+		selling = true
+	}
+	return available, selling
+}
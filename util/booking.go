@@ -0,0 +1,48 @@
+package util
+
+import (
+	"tekticket/db"
+	"time"
+)
+
+/*
+ * Booking policy. A pending booking reserves its tickets while the customer pays. Once the reservation ends unpaid, the
+ * booking expires: its tickets are released, and offered to the waitlists of their types.
+ */
+
+// Default reservation of a pending booking, used when the dynamic config doesn't set the reservation hold
+const DEFAULT_BOOKING_RESERVATION = 15 * time.Minute
+
+// Booking policy
+type BookingPolicy struct {
+	Reservation time.Duration // How long a pending booking reserves its tickets
+}
+
+// Build the booking policy from the dynamic config
+func NewBookingPolicy(setting db.Setting) BookingPolicy {
+	policy := BookingPolicy{Reservation: time.Duration(setting.MaxReservationHoldMinutes) * time.Minute}
+	if policy.Reservation <= 0 {
+		policy.Reservation = DEFAULT_BOOKING_RESERVATION
+	}
+	return policy
+}
+
+// Payment fee charged on an amount, in VND
+func PaymentFee(amount int, feePercent db.DecimalFloat) int {
+	return int(float64(feePercent) * float64(amount) / 100)
+}
+
+// Amount to pay for a booking, with the payment fee: the price of the resale listing it buys, or else the price of its
+// tickets minus the discounts of the membership and the promo code
+func BookingAmount(booking db.Booking, feePercent db.DecimalFloat) int {
+	if booking.ResaleListing != nil {
+		return booking.ResaleListing.Price + PaymentFee(booking.ResaleListing.Price, feePercent)
+	}
+
+	price := 0
+	for _, item := range booking.BookingItems {
+		price += item.Price
+	}
+	price = max(price-booking.Discount, 0)
+	return price + PaymentFee(price, feePercent)
+}
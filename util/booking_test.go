@@ -0,0 +1,31 @@
+package util
+
+import (
+	"tekticket/db"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Test: the reservation of a booking falls back to the default
+func TestBookingPolicy(t *testing.T) {
+	require.Equal(t, 5*time.Minute, NewBookingPolicy(db.Setting{MaxReservationHoldMinutes: 5}).Reservation)
+	require.Equal(t, DEFAULT_BOOKING_RESERVATION, NewBookingPolicy(db.Setting{}).Reservation)
+}
+
+// Test: the amount of a booking is the price of its tickets after the discounts, or of its resale listing, with the fee
+func TestBookingAmount(t *testing.T) {
+	booking := db.Booking{
+		BookingItems: []db.BookingItem{{Price: 100000}, {Price: 300000}},
+		Discount:     50000,
+	}
+	require.Equal(t, 357000, BookingAmount(booking, 2))
+	require.Equal(t, 350000, BookingAmount(booking, 0))
+
+	booking.Discount = 500000
+	require.Zero(t, BookingAmount(booking, 2))
+
+	resale := db.Booking{ResaleListing: &db.ResaleListing{Price: 200000}}
+	require.Equal(t, 204000, BookingAmount(resale, 2))
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"strings"
 	"tekticket/db"
 
 	"github.com/joho/godotenv"
@@ -20,12 +21,35 @@ type Config struct {
 	DirectusAddr string
 	// Used to make request to Directus API that required admin access.
 	DirectusStaticToken string
+	// Read-only token of a restricted Directus user, used to read the published catalog for anonymous visitors
+	DirectusPublicToken string
 	// Since Directus also depend on Cloudinary for its cloud storage, we can't dynamically configure it
 	CloudStorageName     string // Cloudinary cloud name
 	CloudStorageKey      string // Cloudinary API key
 	CloudStorageSecret   string // Cloudinary secret key
 	DockerServerDomain   string // Use for internal service communication
 	DockerTelegramDomain string // Use for internal service communication
+	// Social login (OAuth2/OIDC). A provider is only enabled when its client ID is set
+	OAuthRedirectURL   string // The frontend URL of the social login callback page, registered in every provider
+	GoogleClientID     string // Google OAuth client ID
+	GoogleClientSecret string // Google OAuth client secret
+	OIDCProviderName   string // Name of the generic OIDC provider, used in the API path
+	OIDCIssuer         string // Issuer URL of the generic OIDC provider
+	OIDCClientID       string // Client ID of the generic OIDC provider
+	OIDCClientSecret   string // Client secret of the generic OIDC provider
+	// Shared secret of the webhooks called by Directus flows
+	WebhookSecret string
+	// Addresses or CIDRs of the reverse proxies in front of the server, whose X-Forwarded-For header is trusted to get the
+	// client IP. None by default, so the client IP is the address of the connection
+	TrustedProxies []string
+	// Phone wallet passes. A wallet is only enabled when its pass type ID or issuer ID is set
+	AppleWalletPassTypeID      string // Pass type identifier registered in the Apple Developer account
+	AppleWalletTeamID          string // Apple Developer team ID
+	AppleWalletCertificate     string // Path of the PEM pass certificate
+	AppleWalletPrivateKey      string // Path of the PEM private key of the pass certificate
+	AppleWalletWWDRCertificate string // Path of the PEM Apple WWDR intermediate certificate
+	GoogleWalletIssuerID       string // Google Wallet issuer ID
+	GoogleWalletServiceAccount string // Path of the JSON key of the Google Wallet service account
 
 	// Dynamic config
 	db.Setting
@@ -43,26 +67,71 @@ func (config *Config) LoadStaticConfig(path string) error {
 		config.RedisAddr = os.Getenv("DOCKER_REDIS_ADDR")
 		config.DirectusAddr = os.Getenv("DOCKER_DIRECTUS_DOMAIN")
 		config.DirectusStaticToken = os.Getenv("DIRECTUS_STATIC_TOKEN")
+		config.DirectusPublicToken = os.Getenv("DIRECTUS_PUBLIC_TOKEN")
 		config.DockerServerDomain = os.Getenv("DOCKER_SERVER_DOMAIN")
 		config.DockerTelegramDomain = os.Getenv("DOCKER_TELEGRAM_DOMAIN")
 		config.CloudStorageName = os.Getenv("CLOUDINARY_NAME")
 		config.CloudStorageKey = os.Getenv("CLOUDINARY_APIKEY")
 		config.CloudStorageSecret = os.Getenv("CLOUDINARY_APISECRET")
+		config.OAuthRedirectURL = os.Getenv("OAUTH_REDIRECT_URL")
+		config.GoogleClientID = os.Getenv("GOOGLE_CLIENT_ID")
+		config.GoogleClientSecret = os.Getenv("GOOGLE_CLIENT_SECRET")
+		config.OIDCProviderName = os.Getenv("OIDC_PROVIDER_NAME")
+		config.OIDCIssuer = os.Getenv("OIDC_ISSUER")
+		config.OIDCClientID = os.Getenv("OIDC_CLIENT_ID")
+		config.OIDCClientSecret = os.Getenv("OIDC_CLIENT_SECRET")
+		config.WebhookSecret = os.Getenv("WEBHOOK_SECRET")
+		config.TrustedProxies = splitList(os.Getenv("TRUSTED_PROXIES"))
+		config.AppleWalletPassTypeID = os.Getenv("APPLE_WALLET_PASS_TYPE_ID")
+		config.AppleWalletTeamID = os.Getenv("APPLE_WALLET_TEAM_ID")
+		config.AppleWalletCertificate = os.Getenv("APPLE_WALLET_CERTIFICATE")
+		config.AppleWalletPrivateKey = os.Getenv("APPLE_WALLET_PRIVATE_KEY")
+		config.AppleWalletWWDRCertificate = os.Getenv("APPLE_WALLET_WWDR_CERTIFICATE")
+		config.GoogleWalletIssuerID = os.Getenv("GOOGLE_WALLET_ISSUER_ID")
+		config.GoogleWalletServiceAccount = os.Getenv("GOOGLE_WALLET_SERVICE_ACCOUNT")
 		return err
 	}
 
 	config.RedisAddr = os.Getenv("DOCKER_REDIS_ADDR")
 	config.DirectusAddr = os.Getenv("DOCKER_DIRECTUS_DOMAIN")
 	config.DirectusStaticToken = os.Getenv("DIRECTUS_STATIC_TOKEN")
+	config.DirectusPublicToken = os.Getenv("DIRECTUS_PUBLIC_TOKEN")
 	config.DockerServerDomain = os.Getenv("DOCKER_SERVER_DOMAIN")
 	config.DockerTelegramDomain = os.Getenv("DOCKER_TELEGRAM_DOMAIN")
 	config.CloudStorageName = os.Getenv("CLOUDINARY_NAME")
 	config.CloudStorageKey = os.Getenv("CLOUDINARY_APIKEY")
 	config.CloudStorageSecret = os.Getenv("CLOUDINARY_APISECRET")
+	config.OAuthRedirectURL = os.Getenv("OAUTH_REDIRECT_URL")
+	config.GoogleClientID = os.Getenv("GOOGLE_CLIENT_ID")
+	config.GoogleClientSecret = os.Getenv("GOOGLE_CLIENT_SECRET")
+	config.OIDCProviderName = os.Getenv("OIDC_PROVIDER_NAME")
+	config.OIDCIssuer = os.Getenv("OIDC_ISSUER")
+	config.OIDCClientID = os.Getenv("OIDC_CLIENT_ID")
+	config.OIDCClientSecret = os.Getenv("OIDC_CLIENT_SECRET")
+	config.WebhookSecret = os.Getenv("WEBHOOK_SECRET")
+	config.TrustedProxies = splitList(os.Getenv("TRUSTED_PROXIES"))
+	config.AppleWalletPassTypeID = os.Getenv("APPLE_WALLET_PASS_TYPE_ID")
+	config.AppleWalletTeamID = os.Getenv("APPLE_WALLET_TEAM_ID")
+	config.AppleWalletCertificate = os.Getenv("APPLE_WALLET_CERTIFICATE")
+	config.AppleWalletPrivateKey = os.Getenv("APPLE_WALLET_PRIVATE_KEY")
+	config.AppleWalletWWDRCertificate = os.Getenv("APPLE_WALLET_WWDR_CERTIFICATE")
+	config.GoogleWalletIssuerID = os.Getenv("GOOGLE_WALLET_ISSUER_ID")
+	config.GoogleWalletServiceAccount = os.Getenv("GOOGLE_WALLET_SERVICE_ACCOUNT")
 
 	return nil
 }
 
+// Helper function: split a comma-separated list, without the empty items
+func splitList(value string) []string {
+	var items []string
+	for item := range strings.SplitSeq(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 // Load config from Directus collection. Since this will need both DirectusAddr and DirectusStaticToken,
 // make sure to run the config.LoadStaticConfig() first
 func (config *Config) LoadDynamicConfig() error {
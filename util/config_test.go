@@ -0,0 +1,13 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Test: split the comma-separated lists of the static config
+func TestSplitList(t *testing.T) {
+	require.Equal(t, []string{"10.0.0.1", "172.16.0.0/12"}, splitList(" 10.0.0.1, ,172.16.0.0/12,"))
+	require.Nil(t, splitList(""))
+}
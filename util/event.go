@@ -0,0 +1,166 @@
+package util
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"tekticket/db"
+	"time"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+/*
+ * Event policy, enforced when organizers create or update the schedules of an event and the selling schedules of its
+ * tickets. The limits come from the dynamic config, and a limit that is not set (zero) is not enforced.
+ */
+
+// Maximum length of a generated slug, before the suffix that makes it unique
+const SLUG_MAX_LENGTH = 80
+
+// Event policy
+type EventPolicy struct {
+	MinEventDuration   time.Duration // Minimum time between the start and the end of a schedule
+	MinLeadTime        time.Duration // Minimum time between now and the start of a new schedule
+	MinSellingDuration time.Duration // Minimum time between the start and the end of a ticket selling schedule
+}
+
+// Build the event policy from the dynamic config
+func NewEventPolicy(setting db.Setting) EventPolicy {
+	return EventPolicy{
+		MinEventDuration:   time.Duration(max(setting.MinEventDurationMinutes, 0)) * time.Minute,
+		MinLeadTime:        time.Duration(max(setting.MinEventLeadDays, 0)) * 24 * time.Hour,
+		MinSellingDuration: time.Duration(max(setting.MinSellingDurationMinutes, 0)) * time.Minute,
+	}
+}
+
+// Validate an event schedule. The check-in times are optional (zero). Return the violated rules by field, or an empty map
+// if the schedule is valid
+func (policy EventPolicy) ValidateSchedule(start, end, startCheckin, endCheckin, now time.Time) map[string][]string {
+	violations := map[string][]string{}
+
+	if !start.After(now.Add(policy.MinLeadTime)) {
+		message := "must be in the future"
+		if policy.MinLeadTime > 0 {
+			message = fmt.Sprintf("must be at least %s from now", FormatDuration(policy.MinLeadTime))
+		}
+		violations["start_time"] = append(violations["start_time"], message)
+	}
+
+	if !end.After(start) {
+		violations["end_time"] = append(violations["end_time"], "must be after start time")
+	} else if end.Sub(start) < policy.MinEventDuration {
+		violations["end_time"] = append(
+			violations["end_time"],
+			fmt.Sprintf("event must last at least %s", FormatDuration(policy.MinEventDuration)),
+		)
+	}
+
+	if startCheckin.IsZero() != endCheckin.IsZero() {
+		violations["checkin_time"] = append(violations["checkin_time"], "start and end check-in time must be set together")
+	} else if !startCheckin.IsZero() {
+		if !endCheckin.After(startCheckin) {
+			violations["end_checkin_time"] = append(violations["end_checkin_time"], "must be after start check-in time")
+		}
+		if !startCheckin.Before(end) {
+			violations["start_checkin_time"] = append(violations["start_checkin_time"], "must be before end time")
+		}
+		if endCheckin.After(end) {
+			violations["end_checkin_time"] = append(violations["end_checkin_time"], "must not be after end time")
+		}
+	}
+
+	return violations
+}
+
+// Validate a ticket selling schedule. Selling must end before the last schedule of the event ends (eventEnd, zero if the
+// event has no schedule yet). Return the violated rules by field, or an empty map if the schedule is valid
+func (policy EventPolicy) ValidateSellingSchedule(start, end, eventEnd time.Time, total int) map[string][]string {
+	violations := map[string][]string{}
+
+	if total <= 0 {
+		violations["total"] = append(violations["total"], "must be greater than 0")
+	}
+
+	if !end.After(start) {
+		violations["end_selling_time"] = append(violations["end_selling_time"], "must be after start selling time")
+	} else if end.Sub(start) < policy.MinSellingDuration {
+		violations["end_selling_time"] = append(
+			violations["end_selling_time"],
+			fmt.Sprintf("selling must last at least %s", FormatDuration(policy.MinSellingDuration)),
+		)
+	}
+
+	if !eventEnd.IsZero() && end.After(eventEnd) {
+		violations["end_selling_time"] = append(violations["end_selling_time"], "must not be after the end of the event")
+	}
+
+	return violations
+}
+
+// Time after which the tickets of a schedule can't change hands anymore: the start of the check-in, or the start of the
+// schedule if it has no check-in time. Zero if the schedule has no time
+func TicketTransferDeadline(schedule db.EventSchedule) time.Time {
+	if schedule.StartCheckinTime != nil {
+		return time.Time(*schedule.StartCheckinTime)
+	}
+	if schedule.StartTime != nil {
+		return time.Time(*schedule.StartTime)
+	}
+	return time.Time{}
+}
+
+// Price of a ticket for a member, with the discount of their membership tier, in percent
+func MemberPrice(basePrice int, discount float64) int {
+	discount = min(max(discount, 0), 100)
+	return int(math.Round(float64(basePrice) * (100 - discount) / 100))
+}
+
+// Fold a text for accent-insensitive comparisons: lowercase, without accents, so "Hòa nhạc Đêm" becomes "hoa nhac dem"
+func Fold(text string) string {
+	return strings.ToLower(RemoveAccents(text))
+}
+
+// Remove the accents of a text, so "Hòa nhạc Đêm" becomes "Hoa nhac Dem"
+func RemoveAccents(text string) string {
+	var sb strings.Builder
+	for _, r := range norm.NFD.String(text) {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+			// Accent mark, separated from its letter by NFD
+			continue
+		case r == 'đ':
+			// Vietnamese "đ" has no decomposition
+			r = 'd'
+		case r == 'Đ':
+			r = 'D'
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+// Generate the URL slug of a name: lowercase ASCII letters and digits separated by dashes. Accents are removed, so
+// "Hòa nhạc Đêm" becomes "hoa-nhac-dem"
+func Slugify(name string) string {
+	var sb strings.Builder
+	dash := false
+
+	for _, r := range Fold(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			if dash && sb.Len() > 0 {
+				sb.WriteByte('-')
+			}
+			sb.WriteRune(r)
+			dash = false
+			if sb.Len() >= SLUG_MAX_LENGTH {
+				break
+			}
+		} else {
+			dash = true
+		}
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,91 @@
+package util
+
+import (
+	"strings"
+	"tekticket/db"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Test: validate event schedules against the policy
+func TestValidateSchedule(t *testing.T) {
+	policy := NewEventPolicy(db.Setting{MinEventDurationMinutes: 60, MinEventLeadDays: 7})
+	now := time.Now()
+	start := now.Add(10 * 24 * time.Hour)
+
+	testCases := []struct {
+		name                     string
+		start, end               time.Time
+		startCheckin, endCheckin time.Time
+		fields                   []string
+	}{
+		{"valid", start, start.Add(2 * time.Hour), start.Add(-time.Hour), start.Add(time.Hour), nil},
+		{"valid without check-in", start, start.Add(time.Hour), time.Time{}, time.Time{}, nil},
+		{"too soon", now.Add(24 * time.Hour), now.Add(26 * time.Hour), time.Time{}, time.Time{}, []string{"start_time"}},
+		{"end before start", start, start.Add(-time.Hour), time.Time{}, time.Time{}, []string{"end_time"}},
+		{"too short", start, start.Add(30 * time.Minute), time.Time{}, time.Time{}, []string{"end_time"}},
+		{"partial check-in", start, start.Add(time.Hour), start, time.Time{}, []string{"checkin_time"}},
+		{"check-in after end", start, start.Add(time.Hour), start.Add(2 * time.Hour), start.Add(3 * time.Hour),
+			[]string{"start_checkin_time", "end_checkin_time"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			violations := policy.ValidateSchedule(tc.start, tc.end, tc.startCheckin, tc.endCheckin, now)
+			fields := []string{}
+			for field := range violations {
+				fields = append(fields, field)
+			}
+			require.ElementsMatch(t, tc.fields, fields)
+		})
+	}
+}
+
+// Test: validate ticket selling schedules against the policy
+func TestValidateSellingSchedule(t *testing.T) {
+	policy := NewEventPolicy(db.Setting{MinSellingDurationMinutes: 30})
+	start := time.Now()
+	eventEnd := start.Add(24 * time.Hour)
+
+	require.Empty(t, policy.ValidateSellingSchedule(start, start.Add(time.Hour), eventEnd, 100))
+	require.Empty(t, policy.ValidateSellingSchedule(start, start.Add(time.Hour), time.Time{}, 100))
+	require.Contains(t, policy.ValidateSellingSchedule(start, start.Add(time.Hour), eventEnd, 0), "total")
+	require.Contains(t, policy.ValidateSellingSchedule(start, start.Add(10*time.Minute), eventEnd, 100), "end_selling_time")
+	require.Contains(t, policy.ValidateSellingSchedule(start, eventEnd.Add(time.Hour), eventEnd, 100), "end_selling_time")
+}
+
+// Test: tickets can change hands until the check-in starts, or the schedule if it has no check-in
+func TestTicketTransferDeadline(t *testing.T) {
+	start := db.DateTime(time.Now().Add(48 * time.Hour))
+	checkin := db.DateTime(time.Now().Add(47 * time.Hour))
+
+	require.Equal(t, time.Time(checkin), TicketTransferDeadline(db.EventSchedule{StartTime: &start, StartCheckinTime: &checkin}))
+	require.Equal(t, time.Time(start), TicketTransferDeadline(db.EventSchedule{StartTime: &start}))
+	require.True(t, TicketTransferDeadline(db.EventSchedule{}).IsZero())
+}
+
+// Test: apply the membership discount to ticket prices
+func TestMemberPrice(t *testing.T) {
+	require.Equal(t, 90000, MemberPrice(100000, 10))
+	require.Equal(t, 100000, MemberPrice(100000, 0))
+	require.Equal(t, 84975, MemberPrice(99970, 15))
+	require.Equal(t, 0, MemberPrice(100000, 150))
+	require.Equal(t, 100000, MemberPrice(100000, -5))
+}
+
+// Test: fold texts for accent-insensitive comparisons
+func TestFold(t *testing.T) {
+	require.Equal(t, "hoa nhac dem trang", Fold("Hòa nhạc Đêm Trăng"))
+	require.Equal(t, "rock & roll", Fold("ROCK & Roll"))
+	require.Equal(t, "Hoa nhac Dem Trang", RemoveAccents("Hòa nhạc Đêm Trăng"))
+}
+
+// Test: generate slugs from event names
+func TestSlugify(t *testing.T) {
+	require.Equal(t, "hoa-nhac-dem-trang", Slugify("Hòa nhạc Đêm Trăng"))
+	require.Equal(t, "rock-roll-2025", Slugify("  Rock & Roll -- 2025!  "))
+	require.Equal(t, "", Slugify("!!!"))
+	require.Len(t, Slugify(strings.Repeat("a", 200)), SLUG_MAX_LENGTH)
+}
@@ -14,6 +14,7 @@ import (
 	"os"
 	"strings"
 	"tekticket/db"
+	"time"
 
 	"github.com/skip2/go-qrcode"
 )
@@ -41,11 +42,6 @@ func GenerateQR(content string) ([]byte, error) {
 	return qrcode.Encode(content, qrcode.Medium, 256)
 }
 
-// Generate random OTP code (6 digits code)
-func GenerateRandomOTP() string {
-	return fmt.Sprintf("%d", rand.Intn(999999-100000+1)+100000)
-}
-
 // Generate the URL of image using its ID
 func CreateImageLink(domain, id string) string {
 	return fmt.Sprintf("%s/images/%s", domain, id)
@@ -122,10 +118,35 @@ func FormatNotificationHTML(title, body string) string {
 	return fmt.Sprintf("<b>%s</b>\n\n%s", strings.ToUpper(title), body)
 }
 
+// Helper: format a duration in a human readable way for messages, e.g. "5 minutes" or "45 seconds"
+func FormatDuration(d time.Duration) string {
+	switch {
+	case d >= time.Hour && d%time.Hour == 0:
+		return pluralize(int(d/time.Hour), "hour")
+	case d >= time.Minute && d%time.Minute == 0:
+		return pluralize(int(d/time.Minute), "minute")
+	default:
+		return pluralize(int(d.Round(time.Second)/time.Second), "second")
+	}
+}
+
+// Helper: prefix a unit with its count, and add plural suffix if needed
+func pluralize(n int, unit string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, unit)
+	}
+	return fmt.Sprintf("%d %ss", n, unit)
+}
+
 // Helper method: get user ID from access token
 func ExtractIDFromToken(token string) (string, error) {
 	// Decode base64 token to get the JWT payload
-	jwtPayload, err := base64.RawURLEncoding.DecodeString(strings.Split(token, ".")[1])
+	segments := strings.Split(token, ".")
+	if len(segments) != 3 {
+		return "", fmt.Errorf("invalid JWT format")
+	}
+
+	jwtPayload, err := base64.RawURLEncoding.DecodeString(segments[1])
 	if err != nil {
 		return "", err
 	}
@@ -144,10 +165,52 @@ func ExtractIDFromToken(token string) (string, error) {
 	return "", fmt.Errorf("failed to parse ID")
 }
 
+// Helper method: get the issued time (iat claim) from access token
+func ExtractIssuedAtFromToken(token string) (time.Time, error) {
+	return extractTimeFromToken(token, "iat")
+}
+
+// Helper method: get the expiration time (exp claim) from access token
+func ExtractExpiresAtFromToken(token string) (time.Time, error) {
+	return extractTimeFromToken(token, "exp")
+}
+
+// Helper method: get a time claim from access token
+func extractTimeFromToken(token, claim string) (time.Time, error) {
+	// Decode base64 token to get the JWT payload
+	segments := strings.Split(token, ".")
+	if len(segments) != 3 {
+		return time.Time{}, fmt.Errorf("invalid JWT format")
+	}
+
+	jwtPayload, err := base64.RawURLEncoding.DecodeString(segments[1])
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	// If decode success, try unmarshal payload to get the claim
+	var tokenPayload map[string]any
+	if err := json.Unmarshal(jwtPayload, &tokenPayload); err != nil {
+		return time.Time{}, err
+	}
+
+	// JSON number is always unmarshalled into float64
+	if value, ok := tokenPayload[claim].(float64); ok {
+		return time.Unix(int64(value), 0), nil
+	}
+
+	return time.Time{}, fmt.Errorf("failed to parse %s claim", claim)
+}
+
 // Helper method: extract role from access token
 func ExtractRoleFromToken(token, directusAddr, staticAccessToken string) (string, error) {
 	// Decode base64 token to get the JWT payload
-	jwtPayload, err := base64.RawURLEncoding.DecodeString(strings.Split(token, ".")[1])
+	segments := strings.Split(token, ".")
+	if len(segments) != 3 {
+		return "", fmt.Errorf("invalid JWT format")
+	}
+
+	jwtPayload, err := base64.RawURLEncoding.DecodeString(segments[1])
 	if err != nil {
 		return "", err
 	}
@@ -163,7 +226,7 @@ func ExtractRoleFromToken(token, directusAddr, staticAccessToken string) (string
 		roleID string
 		ok     bool
 	)
-	if roleID, ok = tokenPayload["id"].(string); !ok {
+	if roleID, ok = tokenPayload["role"].(string); !ok {
 		return "", fmt.Errorf("failed to parse role ID from access token")
 	}
 
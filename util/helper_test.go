@@ -0,0 +1,21 @@
+package util
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Test: user ID of an access token, and the malformed tokens rejected without panicking
+func TestExtractIDFromToken(t *testing.T) {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(`{"id":"user-1"}`))
+	id, err := ExtractIDFromToken("header." + payload + ".signature")
+	require.NoError(t, err)
+	require.Equal(t, "user-1", id)
+
+	for _, token := range []string{"", "abc", "Bearer abc", "header." + payload, "header.!!!.signature"} {
+		_, err := ExtractIDFromToken(token)
+		require.Error(t, err, token)
+	}
+}
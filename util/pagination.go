@@ -0,0 +1,42 @@
+package util
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+)
+
+/*
+ * Pagination cursor. A cursor points after the last item of a page, by the sort key and the ID of that item, so that
+ * the next page starts after it even when items are inserted or deleted meanwhile, unlike an offset.
+ * It is opaque to clients: base64 encoded JSON, bound to the sort order it was issued for.
+ */
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Pagination cursor
+type Cursor struct {
+	Sort  string `json:"s"` // Sort order the cursor was issued for
+	Value string `json:"v"` // Sort key of the last item
+	ID    string `json:"i"` // ID of the last item, to break the ties of the sort key
+}
+
+// Encode a cursor into an opaque string
+func EncodeCursor(cursor Cursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// Decode an opaque cursor, issued for a sort order
+func DecodeCursor(encoded, sort string) (Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	var cursor Cursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.ID == "" || cursor.Sort != sort {
+		return Cursor{}, ErrInvalidCursor
+	}
+	return cursor, nil
+}
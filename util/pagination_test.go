@@ -0,0 +1,25 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Test: encode and decode cursors, bound to their sort order
+func TestCursor(t *testing.T) {
+	cursor := Cursor{Sort: "-date_created", Value: "2025-01-02T03:04:05.000Z", ID: "42"}
+	encoded := EncodeCursor(cursor)
+
+	decoded, err := DecodeCursor(encoded, "-date_created")
+	require.NoError(t, err)
+	require.Equal(t, cursor, decoded)
+
+	_, err = DecodeCursor(encoded, "name")
+	require.ErrorIs(t, err, ErrInvalidCursor)
+
+	for _, invalid := range []string{"", "not a cursor!", EncodeCursor(Cursor{Sort: "name"})} {
+		_, err = DecodeCursor(invalid, "name")
+		require.ErrorIs(t, err, ErrInvalidCursor, invalid)
+	}
+}
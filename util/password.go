@@ -0,0 +1,163 @@
+package util
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"tekticket/db"
+	"unicode"
+	"unicode/utf8"
+)
+
+/*
+ * Password policy, enforced everywhere a password is set (register, reset password, update profile).
+ * The breached password check works offline, against the lists bundled in the passwords directory. Like the k-anonymity
+ * model of Have I Been Pwned, passwords are never stored in plain text: each file is named after the first hex character
+ * of the uppercase SHA-1 of the password, and holds the remaining 39 characters of each hash, one per line. An optional
+ * ":COUNT" suffix is allowed, so HIBP range data can be appended after moving the extra prefix characters into each line.
+ */
+
+// Default policy values, used when the dynamic config doesn't set them
+const (
+	DEFAULT_PASSWORD_MIN_LENGTH       = 8
+	DEFAULT_PASSWORD_MIN_CHAR_CLASSES = 3
+	PASSWORD_MAX_LENGTH               = 128
+)
+
+//go:embed passwords/*.txt
+var breachedFS embed.FS
+
+// Password policy
+type PasswordPolicy struct {
+	MinLength      int  // Minimum number of characters
+	MinCharClasses int  // Minimum number of character classes (lowercase, uppercase, digits, symbols) used
+	ForbidEmail    bool // Reject password that contains the email (or its local part)
+	CheckBreached  bool // Reject password that is in the bundled common/breached password lists
+}
+
+// Build the password policy from the dynamic config
+func NewPasswordPolicy(setting db.Setting) PasswordPolicy {
+	policy := PasswordPolicy{
+		MinLength:      setting.PasswordMinLength,
+		MinCharClasses: setting.PasswordMinCharClasses,
+		ForbidEmail:    true,
+		CheckBreached:  true,
+	}
+
+	if policy.MinLength <= 0 {
+		policy.MinLength = DEFAULT_PASSWORD_MIN_LENGTH
+	}
+	if policy.MinCharClasses <= 0 {
+		policy.MinCharClasses = DEFAULT_PASSWORD_MIN_CHAR_CLASSES
+	}
+	policy.MinCharClasses = min(policy.MinCharClasses, 4)
+
+	return policy
+}
+
+// Validate a password against the policy. Return the list of violated rules as user-friendly messages, or an empty slice if
+// the password is valid. The email is used for the email substring rule and can be empty
+func (policy PasswordPolicy) Validate(password, email string) []string {
+	violations := []string{}
+
+	// Length
+	length := utf8.RuneCountInString(password)
+	if length < policy.MinLength {
+		violations = append(violations, fmt.Sprintf("must be at least %d characters long", policy.MinLength))
+	}
+	if length > PASSWORD_MAX_LENGTH {
+		violations = append(violations, fmt.Sprintf("must be at most %d characters long", PASSWORD_MAX_LENGTH))
+	}
+
+	// Character classes
+	var hasLower, hasUpper, hasDigit, hasSymbol bool
+	for _, c := range password {
+		switch {
+		case unicode.IsLower(c):
+			hasLower = true
+		case unicode.IsUpper(c):
+			hasUpper = true
+		case unicode.IsDigit(c):
+			hasDigit = true
+		default:
+			hasSymbol = true
+		}
+	}
+
+	classes := 0
+	for _, ok := range []bool{hasLower, hasUpper, hasDigit, hasSymbol} {
+		if ok {
+			classes++
+		}
+	}
+
+	if classes < policy.MinCharClasses {
+		violations = append(violations, fmt.Sprintf(
+			"must contain at least %d of the following: lowercase letters, uppercase letters, digits, symbols",
+			policy.MinCharClasses,
+		))
+	}
+
+	// Email substring
+	if policy.ForbidEmail && containsEmail(password, email) {
+		violations = append(violations, "must not contain your email")
+	}
+
+	// Common or breached password
+	if policy.CheckBreached && IsBreachedPassword(password) {
+		violations = append(violations, "is too common or has appeared in a data breach, please choose another one")
+	}
+
+	return violations
+}
+
+// Helper: check if the password contains the email, or its local part (the part before @)
+func containsEmail(password, email string) bool {
+	password = strings.ToLower(password)
+	email = strings.ToLower(strings.TrimSpace(email))
+	if email == "" {
+		return false
+	}
+
+	if strings.Contains(password, email) {
+		return true
+	}
+
+	// Very short local part (like 'a@x.com') would reject too many passwords, so we ignore them
+	local, _, _ := strings.Cut(email, "@")
+	return len(local) >= 3 && strings.Contains(password, local)
+}
+
+// Check if a password is in the bundled common/breached password lists. Both the password and its lowercase form are checked,
+// since changing the case of a common password doesn't make it any safer
+func IsBreachedPassword(password string) bool {
+	candidates := []string{password}
+	if lower := strings.ToLower(password); lower != password {
+		candidates = append(candidates, lower)
+	}
+
+	for _, candidate := range candidates {
+		sum := sha1.Sum([]byte(candidate))
+		hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+		data, err := breachedFS.ReadFile(fmt.Sprintf("passwords/%s.txt", hash[:1]))
+		if err != nil {
+			// No file for this prefix -> no breached password with this prefix
+			continue
+		}
+
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		for scanner.Scan() {
+			suffix, _, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+			if strings.EqualFold(suffix, hash[1:]) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,57 @@
+package util
+
+import (
+	"strings"
+	"tekticket/db"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Test: policy fallback to default value when the setting doesn't provide them
+func TestNewPasswordPolicy(t *testing.T) {
+	policy := NewPasswordPolicy(db.Setting{})
+	require.Equal(t, DEFAULT_PASSWORD_MIN_LENGTH, policy.MinLength)
+	require.Equal(t, DEFAULT_PASSWORD_MIN_CHAR_CLASSES, policy.MinCharClasses)
+	require.True(t, policy.ForbidEmail)
+	require.True(t, policy.CheckBreached)
+
+	policy = NewPasswordPolicy(db.Setting{PasswordMinLength: 12, PasswordMinCharClasses: 10})
+	require.Equal(t, 12, policy.MinLength)
+	require.Equal(t, 4, policy.MinCharClasses)
+}
+
+// Test: validate password against each rule of the policy
+func TestValidatePassword(t *testing.T) {
+	policy := PasswordPolicy{MinLength: 10, MinCharClasses: 3, ForbidEmail: true, CheckBreached: true}
+	email := "john.doe@example.com"
+
+	testCases := []struct {
+		name       string
+		password   string
+		violations int
+	}{
+		{"valid", "Tr0ub4dor&3-horse", 0},
+		{"too short", "Ab1!x", 1},
+		{"too long", "Ab1!" + strings.Repeat("x", PASSWORD_MAX_LENGTH), 1},
+		{"not enough character classes", "onlylowercaseletters", 1},
+		{"contains email local part", "My-John.Doe-2024", 1},
+		{"breached", "Password@123", 1},
+		{"breached with different case", "PASSWORD123", 2}, // Not enough character classes and breached
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			violations := policy.Validate(tc.password, email)
+			require.Len(t, violations, tc.violations, violations)
+		})
+	}
+}
+
+// Test: breached password lookup in the bundled lists
+func TestIsBreachedPassword(t *testing.T) {
+	require.True(t, IsBreachedPassword("123456"))
+	require.True(t, IsBreachedPassword("P@ssw0rd"))
+	require.True(t, IsBreachedPassword("QWERTY123"))
+	require.False(t, IsBreachedPassword(RandomString(24)))
+}
@@ -0,0 +1,28 @@
+package util
+
+import (
+	"tekticket/db"
+	"time"
+)
+
+/*
+ * Promo code policy. A booking created with a code holds a use of the code while the customer pays, for as long as the
+ * reservation of the booking. The use only counts for good once the payment is confirmed.
+ */
+
+// Default hold of a use of a code, used when the dynamic config doesn't set the reservation hold
+const DEFAULT_PROMO_HOLD = 15 * time.Minute
+
+// Promo code policy
+type PromoPolicy struct {
+	Hold time.Duration // How long a pending booking holds a use of its code
+}
+
+// Build the promo code policy from the dynamic config
+func NewPromoPolicy(setting db.Setting) PromoPolicy {
+	policy := PromoPolicy{Hold: time.Duration(setting.MaxReservationHoldMinutes) * time.Minute}
+	if policy.Hold <= 0 {
+		policy.Hold = DEFAULT_PROMO_HOLD
+	}
+	return policy
+}
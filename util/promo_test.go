@@ -0,0 +1,15 @@
+package util
+
+import (
+	"tekticket/db"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Test: the hold of a promo code follows the reservation hold, with a default
+func TestPromoPolicy(t *testing.T) {
+	require.Equal(t, 5*time.Minute, NewPromoPolicy(db.Setting{MaxReservationHoldMinutes: 5}).Hold)
+	require.Equal(t, DEFAULT_PROMO_HOLD, NewPromoPolicy(db.Setting{}).Hold)
+}
@@ -0,0 +1,101 @@
+package util
+
+import (
+	"cmp"
+	"slices"
+	"tekticket/db"
+	"time"
+)
+
+/*
+ * Refund policy, enforced when customers cancel their tickets. The refunded percent of a ticket depends on the time left
+ * before the start of its schedule, following the tiers of the dynamic config, like "100% up to 7 days before, 50% up to
+ * 2 days before, nothing after". A full refund is still granted during a grace period after the payment, and nothing is
+ * refunded once the schedule started.
+ */
+
+// Refund reasons the customer can choose
+const (
+	REFUND_REASON_CANNOT_ATTEND      = "cannot-attend"
+	REFUND_REASON_SCHEDULE_CONFLICT  = "schedule-conflict"
+	REFUND_REASON_EVENT_CHANGED      = "event-changed"
+	REFUND_REASON_DUPLICATE_PURCHASE = "duplicate-purchase"
+	REFUND_REASON_OTHER              = "other"
+)
+
+var RefundReasons = []string{
+	REFUND_REASON_CANNOT_ATTEND,
+	REFUND_REASON_SCHEDULE_CONFLICT,
+	REFUND_REASON_EVENT_CHANGED,
+	REFUND_REASON_DUPLICATE_PURCHASE,
+	REFUND_REASON_OTHER,
+}
+
+// Default tiers, used when the dynamic config doesn't set them
+var DEFAULT_REFUND_TIERS = []db.RefundTier{
+	{MinHoursBeforeStart: 7 * 24, Percent: 100},
+	{MinHoursBeforeStart: 2 * 24, Percent: 50},
+}
+
+// Refund policy
+type RefundPolicy struct {
+	Tiers       []db.RefundTier // Sorted from the earliest cancellation to the latest
+	GracePeriod time.Duration   // Time after the payment during which a full refund is granted
+}
+
+// Build the refund policy from the dynamic config
+func NewRefundPolicy(setting db.Setting) RefundPolicy {
+	tiers := slices.Clone(setting.RefundTiers)
+	if len(tiers) == 0 {
+		tiers = slices.Clone(DEFAULT_REFUND_TIERS)
+	}
+	slices.SortFunc(tiers, func(a, b db.RefundTier) int {
+		return cmp.Compare(b.MinHoursBeforeStart, a.MinHoursBeforeStart)
+	})
+
+	return RefundPolicy{
+		Tiers:       tiers,
+		GracePeriod: time.Duration(max(setting.MaxFullRefundHours, 0)) * time.Hour,
+	}
+}
+
+// Percent of its price refunded for a ticket of a schedule starting at start, paid at paidAt (zero if unknown)
+func (policy RefundPolicy) Percent(start, paidAt, now time.Time) int {
+	if !now.Before(start) {
+		return 0
+	}
+	if policy.GracePeriod > 0 && !paidAt.IsZero() && now.Before(paidAt.Add(policy.GracePeriod)) {
+		return 100
+	}
+
+	left := start.Sub(now)
+	for _, tier := range policy.Tiers {
+		if left >= time.Duration(tier.MinHoursBeforeStart)*time.Hour {
+			return min(max(tier.Percent, 0), 100)
+		}
+	}
+	return 0
+}
+
+// Refunded amount of a ticket: its share of the paid amount, which includes the fees, so that refunding every ticket of a
+// payment in full refunds the whole payment
+func RefundAmount(price, totalPrice, paid, percent int) int {
+	if price <= 0 || totalPrice <= 0 || paid <= 0 || percent <= 0 {
+		return 0
+	}
+	return int(int64(paid) * int64(price) * int64(min(percent, 100)) / (int64(totalPrice) * 100))
+}
+
+// Why a ticket can't be refunded, empty if it can. Only valid tickets are refunded, a ticket scanned at the door was used
+// even though its status doesn't change
+func RefundBlockedReason(item db.BookingItem, checkedIn bool) string {
+	switch {
+	case item.Status == "refunded" || (item.Refund != nil && item.Refund.Status != "failed"):
+		return "already refunded"
+	case checkedIn:
+		return "already checked in"
+	case item.Status != "valid":
+		return "ticket is not valid"
+	}
+	return ""
+}
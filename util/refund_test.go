@@ -0,0 +1,81 @@
+package util
+
+import (
+	"tekticket/db"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Test: refunded percent by the time left before the start of the schedule
+func TestRefundPercent(t *testing.T) {
+	policy := NewRefundPolicy(db.Setting{
+		MaxFullRefundHours: 24,
+		RefundTiers: []db.RefundTier{
+			{MinHoursBeforeStart: 48, Percent: 50},
+			{MinHoursBeforeStart: 240, Percent: 100},
+		},
+	})
+	now := time.Now()
+	day := 24 * time.Hour
+	paid := now.Add(-3 * day)
+
+	testCases := []struct {
+		name    string
+		start   time.Time
+		paidAt  time.Time
+		percent int
+	}{
+		{"early", now.Add(20 * day), paid, 100},
+		{"middle tier", now.Add(5 * day), paid, 50},
+		{"late", now.Add(day), paid, 0},
+		{"grace period", now.Add(day), now.Add(-time.Hour), 100},
+		{"unknown payment time", now.Add(5 * day), time.Time{}, 50},
+		{"started", now.Add(-time.Hour), now.Add(-2 * time.Hour), 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.percent, policy.Percent(tc.start, tc.paidAt, now))
+		})
+	}
+
+	// Default tiers
+	policy = NewRefundPolicy(db.Setting{})
+	require.Equal(t, DEFAULT_REFUND_TIERS, policy.Tiers)
+	require.Zero(t, policy.GracePeriod)
+}
+
+// Test: refunded amount of a ticket, with its share of the fees
+func TestRefundAmount(t *testing.T) {
+	// 2 tickets of 100000 and 300000, paid 420000 with the fees
+	require.Equal(t, 105000, RefundAmount(100000, 400000, 420000, 100))
+	require.Equal(t, 157500, RefundAmount(300000, 400000, 420000, 50))
+	require.Equal(t, 420000, RefundAmount(100000, 400000, 420000, 100)+RefundAmount(300000, 400000, 420000, 100))
+	require.Zero(t, RefundAmount(100000, 400000, 420000, 0))
+	require.Zero(t, RefundAmount(100000, 0, 420000, 100))
+}
+
+// Test: tickets refunded, checked in or not valid can't be refunded
+func TestRefundBlockedReason(t *testing.T) {
+	testCases := []struct {
+		name      string
+		item      db.BookingItem
+		checkedIn bool
+		reason    string
+	}{
+		{"valid", db.BookingItem{Status: "valid"}, false, ""},
+		{"failed refund", db.BookingItem{Status: "valid", Refund: &db.Refund{Status: "failed"}}, false, ""},
+		{"refunded", db.BookingItem{Status: "refunded"}, false, "already refunded"},
+		{"refund in progress", db.BookingItem{Status: "valid", Refund: &db.Refund{Status: "pending"}}, false, "already refunded"},
+		{"checked in", db.BookingItem{Status: "valid"}, true, "already checked in"},
+		{"not valid", db.BookingItem{Status: "canceled"}, false, "ticket is not valid"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.reason, RefundBlockedReason(tc.item, tc.checkedIn))
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package util
+
+import (
+	"tekticket/db"
+	"time"
+)
+
+/*
+ * Resale policy of the marketplace. A customer can resell a ticket they can't use, at a price capped at a percentage over
+ * the original price of the ticket, so that tickets are not scalped. Once sold, the platform keeps a fee on the price and
+ * the rest is paid out to the seller. A buyer holds a listing for a while to pay, after which the listing is on sale again.
+ */
+
+// Defaults, used when the dynamic config doesn't set them
+const (
+	DEFAULT_RESALE_MAX_MARKUP_PERCENT = 20
+	DEFAULT_RESALE_HOLD               = 15 * time.Minute
+)
+
+// Resale policy
+type ResalePolicy struct {
+	MaxMarkupPercent int           // Cap of the price, over the original price
+	FeePercent       float64       // Platform fee on the price
+	Hold             time.Duration // How long a buyer holds a listing to pay
+}
+
+// Build the resale policy from the dynamic config
+func NewResalePolicy(setting db.Setting) ResalePolicy {
+	policy := ResalePolicy{
+		MaxMarkupPercent: setting.ResaleMaxMarkupPercent,
+		FeePercent:       min(max(float64(setting.ResaleFeePercent), 0), 100),
+		Hold:             time.Duration(setting.MaxReservationHoldMinutes) * time.Minute,
+	}
+	if policy.MaxMarkupPercent <= 0 {
+		policy.MaxMarkupPercent = DEFAULT_RESALE_MAX_MARKUP_PERCENT
+	}
+	if policy.Hold <= 0 {
+		policy.Hold = DEFAULT_RESALE_HOLD
+	}
+	return policy
+}
+
+// Highest price a ticket bought at originalPrice can be resold at
+func (policy ResalePolicy) MaxPrice(originalPrice int) int {
+	return int(int64(max(originalPrice, 0)) * int64(100+policy.MaxMarkupPercent) / 100)
+}
+
+// Platform fee and payout of the seller of a ticket sold at price
+func (policy ResalePolicy) Split(price int) (fee, payout int) {
+	if price <= 0 {
+		return 0, 0
+	}
+	fee = int(float64(price) * policy.FeePercent / 100)
+	return fee, price - fee
+}
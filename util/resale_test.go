@@ -0,0 +1,51 @@
+package util
+
+import (
+	"tekticket/db"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Test: defaults of the resale policy, when the dynamic config doesn't set it
+func TestResalePolicyDefaults(t *testing.T) {
+	policy := NewResalePolicy(db.Setting{ResaleFeePercent: 150})
+	require.Equal(t, DEFAULT_RESALE_MAX_MARKUP_PERCENT, policy.MaxMarkupPercent)
+	require.Equal(t, DEFAULT_RESALE_HOLD, policy.Hold)
+	require.Equal(t, float64(100), policy.FeePercent)
+
+	policy = NewResalePolicy(db.Setting{ResaleMaxMarkupPercent: 10, MaxReservationHoldMinutes: 5})
+	require.Equal(t, 10, policy.MaxMarkupPercent)
+	require.Equal(t, 5*time.Minute, policy.Hold)
+	require.Zero(t, policy.FeePercent)
+}
+
+// Test: price cap and split of the price between the platform and the seller
+func TestResalePrice(t *testing.T) {
+	policy := NewResalePolicy(db.Setting{ResaleMaxMarkupPercent: 20, ResaleFeePercent: 5})
+
+	require.Equal(t, 120_000, policy.MaxPrice(100_000))
+	require.Equal(t, 0, policy.MaxPrice(-1))
+
+	testCases := []struct {
+		name   string
+		price  int
+		fee    int
+		payout int
+	}{
+		{"capped price", 120_000, 6_000, 114_000},
+		{"discounted price", 50_000, 2_500, 47_500},
+		{"rounded down fee", 999, 49, 950},
+		{"no price", 0, 0, 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fee, payout := policy.Split(tc.price)
+			require.Equal(t, tc.fee, fee)
+			require.Equal(t, tc.payout, payout)
+			require.Equal(t, tc.price, fee+payout)
+		})
+	}
+}
@@ -0,0 +1,31 @@
+package util
+
+import (
+	"tekticket/db"
+	"time"
+)
+
+/*
+ * Waitlist policy of the sold-out ticket types. When a ticket frees up, it is offered to the next customer in line, and
+ * reserved for them for a while to book it. An offer not claimed in time rolls over to the next customer.
+ */
+
+// Default window of an offer, used when the dynamic config sets neither the offer window nor the reservation hold
+const DEFAULT_WAITLIST_OFFER_WINDOW = 15 * time.Minute
+
+// Waitlist policy
+type WaitlistPolicy struct {
+	OfferWindow time.Duration // How long an offer reserves a ticket for the customer
+}
+
+// Build the waitlist policy from the dynamic config. The offer window defaults to the reservation hold of a booking
+func NewWaitlistPolicy(setting db.Setting) WaitlistPolicy {
+	policy := WaitlistPolicy{OfferWindow: time.Duration(setting.WaitlistOfferMinutes) * time.Minute}
+	if policy.OfferWindow <= 0 {
+		policy.OfferWindow = time.Duration(setting.MaxReservationHoldMinutes) * time.Minute
+	}
+	if policy.OfferWindow <= 0 {
+		policy.OfferWindow = DEFAULT_WAITLIST_OFFER_WINDOW
+	}
+	return policy
+}
@@ -0,0 +1,16 @@
+package util
+
+import (
+	"tekticket/db"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Test: the offer window falls back to the reservation hold, then to the default
+func TestWaitlistPolicy(t *testing.T) {
+	require.Equal(t, 10*time.Minute, NewWaitlistPolicy(db.Setting{WaitlistOfferMinutes: 10, MaxReservationHoldMinutes: 5}).OfferWindow)
+	require.Equal(t, 5*time.Minute, NewWaitlistPolicy(db.Setting{MaxReservationHoldMinutes: 5}).OfferWindow)
+	require.Equal(t, DEFAULT_WAITLIST_OFFER_WINDOW, NewWaitlistPolicy(db.Setting{}).OfferWindow)
+}